@@ -0,0 +1,140 @@
+package threadsafequeue
+
+import "time"
+
+// AdaptiveOption configures WithAdaptiveCapacity.
+type AdaptiveOption func(*adaptive)
+
+// AdaptiveTargetLatency sets the wait that WithAdaptiveCapacity treats as
+// consumers keeping up: the bound grows while the estimated wait stays at or
+// below d and shrinks once it exceeds d. The default is 100 milliseconds.
+func AdaptiveTargetLatency(d time.Duration) AdaptiveOption {
+	if d <= 0 {
+		panic("threadsafequeue: AdaptiveTargetLatency needs a positive duration")
+	}
+	return func(a *adaptive) {
+		a.target = d
+	}
+}
+
+// AdaptiveInterval sets how often WithAdaptiveCapacity adjusts the bound, and
+// so the span over which it measures the dequeue rate. The default is a
+// second.
+func AdaptiveInterval(d time.Duration) AdaptiveOption {
+	if d <= 0 {
+		panic("threadsafequeue: AdaptiveInterval needs a positive duration")
+	}
+	return func(a *adaptive) {
+		a.interval = d
+	}
+}
+
+// WithAdaptiveCapacity bounds the queue with a capacity that follows its
+// consumers between floor and ceiling, instead of a fixed one: generous
+// while they keep up, so bursts are absorbed, and tight while they lag, so
+// that backpressure, or the overflow policy, engages earlier. The bound
+// starts at the capacity set by WithCapacity, kept between floor and
+// ceiling, or at floor without one.
+//
+// Every interval, the queue estimates how long an item arriving now would
+// wait from its size and the rate at which items were dequeued over the
+// interval. If the estimate is within the target latency, the bound grows by
+// a quarter, up to ceiling; otherwise it halves, down to floor. A bound
+// shrunk below the items already queued lets no item in until consumers
+// catch up, except that DropOldest evicts down to it. Stats.Capacity reports
+// the current bound. The adjustments run on a timer of the queue's clock and
+// stop when the queue is closed. They also pause while the queue is left
+// alone: once the bound has settled at floor or ceiling and no item was
+// dequeued over an interval, the timer is stopped until the size next
+// changes, so that an idle queue dropped without Close holds no timer and
+// can be garbage collected. It panics unless 0 < floor <= ceiling.
+func WithAdaptiveCapacity(floor, ceiling int, opts ...AdaptiveOption) Option {
+	if floor < 1 || ceiling < floor {
+		panic("threadsafequeue: WithAdaptiveCapacity needs 0 < floor <= ceiling")
+	}
+	a := &adaptive{floor: floor, ceiling: ceiling, target: 100 * time.Millisecond, interval: time.Second}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return func(q *ThreadSafeQueue) {
+		q.adaptive = a
+	}
+}
+
+// adaptive is the state behind WithAdaptiveCapacity, protected by the
+// queue's lock.
+type adaptive struct {
+	floor, ceiling int
+	target         time.Duration
+	interval       time.Duration
+	timer          Timer
+	last           time.Time // Start of the current interval.
+	dequeued       uint64    // Dequeued total at the start of the interval.
+	paused         bool      // The timer is stopped until the size changes.
+}
+
+// startAdaptive sets the initial bound and starts the timer.
+// NewThreadSafeQueue calls it once the queue is otherwise ready.
+func (q *ThreadSafeQueue) startAdaptive() {
+	a := q.adaptive
+	q.capacity = min(max(q.capacity, a.floor), a.ceiling)
+	a.last = q.clock.Now()
+	a.timer = q.clock.AfterFunc(a.interval, q.adapt)
+}
+
+// adapt adjusts the bound at the end of an interval and starts the next,
+// unless nothing is left to adjust.
+func (q *ThreadSafeQueue) adapt() {
+	q.lock()
+	defer q.unlock() // Admits the producers a grown bound has room for.
+	if q.closed {
+		return
+	}
+	a := q.adaptive
+	now := q.clock.Now()
+	prev := q.capacity
+	if q.adaptiveLag(now) <= a.target {
+		q.capacity = min(q.capacity+max(q.capacity/4, 1), a.ceiling)
+	} else {
+		q.capacity = max(q.capacity/2, a.floor)
+	}
+	if q.capacity == prev && q.dequeued == a.dequeued {
+		// Until the size changes, every interval would estimate the same
+		// lag and find the bound where it is.
+		a.paused = true
+		return
+	}
+	a.last = now
+	a.dequeued = q.dequeued
+	a.timer.Reset(a.interval)
+}
+
+// resumeAdaptive restarts the adjustments adapt paused, once the size has
+// changed. The caller must hold q.mu exclusively.
+func (q *ThreadSafeQueue) resumeAdaptive() {
+	a := q.adaptive
+	a.paused = false
+	a.last = q.clock.Now()
+	a.dequeued = q.dequeued
+	a.timer.Reset(a.interval)
+}
+
+// adaptiveLag estimates how long an item enqueued now would wait, from the
+// size and the dequeues over the interval ending at now. The caller must
+// hold q.mu.
+func (q *ThreadSafeQueue) adaptiveLag(now time.Time) time.Duration {
+	a := q.adaptive
+	return littleLag(q.len(), q.dequeued-a.dequeued, now.Sub(a.last))
+}
+
+// littleLag estimates by Little's law how long an item joining n others
+// would wait, when out items left over elapsed.
+func littleLag(n int, out uint64, elapsed time.Duration) time.Duration {
+	if n == 0 {
+		return 0
+	}
+	if out == 0 || elapsed <= 0 {
+		return time.Duration(1<<63 - 1) // Nothing is moving.
+	}
+	return time.Duration(float64(n) / float64(out) * float64(elapsed))
+}
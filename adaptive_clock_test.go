@@ -0,0 +1,79 @@
+package threadsafequeue_test
+
+import (
+	"testing"
+	"time"
+
+	queue "github.com/sandeepkv93/threadsafequeue"
+	"github.com/sandeepkv93/threadsafequeue/queuetest"
+)
+
+// Test that an adaptive bound expands while the consumer keeps up with a
+// burst and contracts once it slows down
+func TestFakeClockAdaptiveCapacity(t *testing.T) {
+	c := queuetest.NewFakeClock(epoch)
+	q := queue.NewThreadSafeQueue(queue.WithClock(c), queue.WithAdaptiveCapacity(10, 1000,
+		queue.AdaptiveTargetLatency(time.Second), queue.AdaptiveInterval(time.Second)))
+	defer q.Close()
+	second := func(produce, consume int) {
+		for i := 0; i < produce; i++ {
+			q.TryEnqueue(i)
+		}
+		for i := 0; i < consume && !q.IsEmpty(); i++ {
+			q.TryDequeue()
+		}
+		c.Advance(time.Second)
+	}
+	for i := 0; i < 30; i++ {
+		second(500, 600) // A burst the consumer keeps up with.
+	}
+	if got := q.Cap(); got < 500 {
+		t.Errorf("Expected the bound to expand to fit the burst, got %d", got)
+	}
+	for i := 0; i < 10; i++ {
+		second(500, 20) // The consumer slows down.
+	}
+	if got := q.Cap(); got != 10 {
+		t.Errorf("Expected the bound to contract to the floor, got %d", got)
+	}
+}
+
+// Test that the adjustments pause once an idle queue has settled, resume
+// when its size changes, and stop for good on Close
+func TestFakeClockAdaptivePause(t *testing.T) {
+	c := queuetest.NewFakeClock(epoch)
+	q := queue.NewThreadSafeQueue(queue.WithClock(c), queue.WithAdaptiveCapacity(4, 8,
+		queue.AdaptiveTargetLatency(time.Second), queue.AdaptiveInterval(time.Second)))
+	for i := 0; i < 4; i++ {
+		c.Advance(time.Second) // From 4 to 5, 6, 7 and 8.
+	}
+	if got := q.Cap(); got != 8 {
+		t.Fatalf("Expected the idle bound to grow to the ceiling, got %d", got)
+	}
+	c.Advance(time.Second) // Still 8.
+	if n := c.Timers(); n != 0 {
+		t.Fatalf("Expected no timer once the idle queue settled, got %d", n)
+	}
+
+	q.EnqueueBatch(1, 2, 3, 4, 5, 6, 7, 8) // A consumer that never comes.
+	if n := c.Timers(); n != 1 {
+		t.Fatalf("Expected the adjustments to resume with the new items, got %d timers", n)
+	}
+	for i := 0; i < 2; i++ {
+		c.Advance(time.Second) // Halved to 4, then still 4.
+	}
+	if got, n := q.Cap(), c.Timers(); got != 4 || n != 0 {
+		t.Fatalf("Expected the bound at the floor and no timer, got %d and %d timers", got, n)
+	}
+
+	q.TryDequeue()
+	c.Advance(time.Second)
+	if n := c.Timers(); n != 1 {
+		t.Fatalf("Expected the adjustments to carry on after a dequeue, got %d timers", n)
+	}
+	q.Close()
+	c.Advance(time.Second)
+	if n := c.Timers(); n != 0 {
+		t.Errorf("Expected Close to stop the adjustments, got %d timers", n)
+	}
+}
@@ -0,0 +1,76 @@
+package threadsafequeue
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that the adaptive bound starts at the capacity, kept between the
+// floor and the ceiling
+func TestAdaptiveCapacityStart(t *testing.T) {
+	for _, c := range []struct{ capacity, want int }{{0, 10}, {5, 10}, {50, 50}, {500, 100}} {
+		q := NewThreadSafeQueue(WithCapacity(c.capacity), WithAdaptiveCapacity(10, 100))
+		if got := q.Cap(); got != c.want {
+			t.Errorf("Expected a capacity of %d to start at %d, got %d", c.capacity, c.want, got)
+		}
+		q.Close()
+	}
+}
+
+// Test that the bound grows while consumers keep up and halves once they
+// lag
+func TestAdaptiveCapacity(t *testing.T) {
+	clock := newManualClock()
+	q := NewThreadSafeQueue(WithClock(clock),
+		WithAdaptiveCapacity(4, 8, AdaptiveTargetLatency(time.Second), AdaptiveInterval(time.Hour)))
+	defer q.Close()
+	step := func(in, out int) int {
+		for i := 0; i < in; i++ {
+			q.TryEnqueue(i)
+		}
+		for i := 0; i < out; i++ {
+			q.TryDequeue()
+		}
+		clock.advance(time.Second)
+		q.adapt()
+		return q.Stats().Capacity
+	}
+	for i, want := range []int{5, 6, 7, 8, 8} {
+		if got := step(10, 10); got != want {
+			t.Errorf("Expected a capacity of %d after healthy interval %d, got %d", want, i, got)
+		}
+	}
+	// 6 items left, 2 taken per second: an item would wait 3s, then 2s.
+	for i, want := range []int{4, 4} {
+		if got := step(10, 2); got != want {
+			t.Errorf("Expected a capacity of %d after lagging interval %d, got %d", want, i, got)
+		}
+	}
+}
+
+// Test that a grown bound admits the producers blocked on the old one
+func TestAdaptiveCapacityAdmitsProducers(t *testing.T) {
+	clock := newManualClock()
+	q := NewThreadSafeQueue(WithClock(clock),
+		WithAdaptiveCapacity(4, 8, AdaptiveTargetLatency(time.Minute), AdaptiveInterval(time.Hour)))
+	defer q.Close()
+	q.EnqueueBatch(1, 2, 3, 4)
+	q.TryDequeue()
+	q.Enqueue(5)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.Enqueue(6)
+	}()
+	awaitCount(t, q.WaitingProducers, 1)
+	clock.advance(time.Second)
+	q.adapt()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the grown bound to admit the blocked producer")
+	}
+	if s := q.Stats(); s.Size != 5 || s.Capacity != 5 {
+		t.Errorf("Expected 5 items at a capacity of 5, got %d and %d", s.Size, s.Capacity)
+	}
+}
@@ -0,0 +1,197 @@
+package threadsafequeue
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// auditBuffer is the number of audit records that can wait for the
+	// writer before further ones are dropped.
+	auditBuffer = 4096
+	// auditFlush is how long a written audit line may wait in the buffer
+	// before it is flushed.
+	auditFlush = time.Second
+)
+
+// WithAuditWriter makes the queue write a line to w for every item enqueued,
+// dequeued, drained or dropped by the overflow policy: the time of the
+// operation in RFC 3339 format, a space, and the text returned by format
+// for the operation and the item, or, if format is nil, the operation and
+// the item as formatted by fmt. An item that DropNewest discards on arrival
+// gets a single OpDrop line.
+//
+// Records are handed from the queue's lock to a goroutine of the queue's
+// own through a buffer of a few thousand records, and formatted and written
+// there, through a buffered writer flushed within a second, when the queue
+// is closed, and once it is closed and empty, after which the goroutine
+// exits. The audit never slows the queue down: when the writer falls so far
+// behind that the buffer is full, records are dropped, and counted by
+// AuditDropped, rather than blocking the operation. A write error is
+// logged, and the lines still buffered when it happens and the records
+// after it are dropped and counted too.
+func WithAuditWriter(w io.Writer, format func(op HistoryOp, item interface{}) string) Option {
+	return func(q *ThreadSafeQueue) {
+		q.audit = &audit{w: bufio.NewWriter(w), format: format}
+	}
+}
+
+// AuditDropped returns the number of audit records dropped because the
+// writer given to WithAuditWriter fell behind or failed.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) AuditDropped() uint64 {
+	if q.audit == nil {
+		return 0
+	}
+	return q.audit.dropped.Load()
+}
+
+// audit is the state behind WithAuditWriter. The channel is written and
+// closed under the queue's lock; the rest belongs to the goroutine.
+type audit struct {
+	w       *bufio.Writer
+	format  func(HistoryOp, interface{}) string
+	records chan auditRecord
+	flush   chan struct{} // Signalled by Close.
+	closed  bool          // records is closed.
+	exited  chan struct{}
+	dropped atomic.Uint64
+}
+
+// auditRecord is an operation waiting to be written.
+type auditRecord struct {
+	op   HistoryOp
+	item interface{}
+	time time.Time
+}
+
+// startAudit starts the audit goroutine. NewThreadSafeQueue calls it once
+// the queue is otherwise ready.
+func (q *ThreadSafeQueue) startAudit() {
+	a := q.audit
+	a.records = make(chan auditRecord, auditBuffer)
+	a.flush = make(chan struct{}, 1)
+	a.exited = make(chan struct{})
+	go q.writeAudit(a)
+}
+
+// audited hands an operation on item to the audit goroutine, or counts it
+// as dropped if the goroutine is behind. The caller must hold q.mu
+// exclusively, and call auditClosed after the last of the operation's items.
+func (q *ThreadSafeQueue) audited(op HistoryOp, item interface{}) {
+	a := q.audit
+	if a.closed {
+		return
+	}
+	select {
+	case a.records <- auditRecord{op: op, item: item, time: q.clock.Now()}:
+	default:
+		a.dropped.Add(1)
+	}
+}
+
+// auditClosed flushes the audit when the queue is closed, and ends it once
+// the queue is also empty, since nothing is left to happen to it. The
+// caller must hold q.mu exclusively.
+func (q *ThreadSafeQueue) auditClosed() {
+	a := q.audit
+	if !q.closed || a.closed {
+		return
+	}
+	if q.len() == 0 {
+		a.closed = true
+		close(a.records)
+		return
+	}
+	select {
+	case a.flush <- struct{}{}:
+	default:
+	}
+}
+
+// writeAudit writes the audit records as they come until the channel is
+// closed, flushing the lines written within auditFlush.
+func (q *ThreadSafeQueue) writeAudit(a *audit) {
+	defer close(a.exited)
+	var timer Timer // Created on first use and reused.
+	var tick <-chan time.Time
+	armed := false
+	var failed error
+	unflushed := uint64(0) // Lines in a.w, lost if it fails.
+	fail := func(err error) {
+		a.dropped.Add(unflushed)
+		unflushed = 0
+		failed = err
+		q.auditFailed(err)
+	}
+	write := func(r auditRecord) {
+		if failed != nil {
+			a.dropped.Add(1)
+			return
+		}
+		a.w.WriteString(r.time.Format(time.RFC3339Nano))
+		a.w.WriteByte(' ')
+		if a.format != nil {
+			a.w.WriteString(a.format(r.op, r.item))
+		} else {
+			fmt.Fprintf(a.w, "%v %v", r.op, r.item)
+		}
+		unflushed++
+		if err := a.w.WriteByte('\n'); err != nil {
+			fail(err)
+		}
+	}
+	flush := func() {
+		if failed == nil {
+			if err := a.w.Flush(); err != nil {
+				fail(err)
+			}
+			unflushed = 0
+		}
+	}
+	for {
+		select {
+		case r, ok := <-a.records:
+			if !ok {
+				if timer != nil {
+					timer.Stop()
+				}
+				flush()
+				return
+			}
+			write(r)
+			if !armed {
+				armed = true
+				if timer == nil {
+					timer = q.clock.NewTimer(auditFlush)
+					tick = timer.C()
+				} else {
+					timer.Reset(auditFlush)
+				}
+			}
+		case <-tick:
+			armed = false
+			flush()
+		case <-a.flush:
+			for n := len(a.records); n > 0; n-- { // Those recorded before Close.
+				if r, ok := <-a.records; ok {
+					write(r)
+				}
+			}
+			flush()
+		}
+	}
+}
+
+// auditFailed logs a failure to write the audit.
+func (q *ThreadSafeQueue) auditFailed(err error) {
+	if q.logger != nil {
+		q.log(logEvent{level: slog.LevelError, msg: "audit write failed", size: q.Size(), attrs: []slog.Attr{
+			slog.String(LogKeyError, err.Error()),
+		}})
+	}
+}
@@ -0,0 +1,156 @@
+package threadsafequeue
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// auditLines waits for the audit of q to finish and returns its lines
+func auditLines(t *testing.T, q *ThreadSafeQueue, buf *bytes.Buffer) []string {
+	t.Helper()
+	select {
+	case <-q.audit.exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the audit to finish once the queue is closed and empty")
+	}
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+// Test that the audit writes a line for every operation under concurrency
+func TestAuditWriter(t *testing.T) {
+	var buf bytes.Buffer
+	q := NewThreadSafeQueue(WithCapacity(16), WithAuditWriter(&buf, nil))
+	var wg sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				q.Enqueue(p*1000 + i)
+			}
+		}(p)
+	}
+	for c := 0; c < 4; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 496; i++ {
+				q.Dequeue()
+			}
+		}()
+	}
+	wg.Wait()
+	q.Close()
+	q.Drain()
+
+	lines := auditLines(t, q, &buf)
+	s := q.Stats()
+	if want := int(s.Enqueued + s.Dequeued + s.Dropped); len(lines) != want {
+		t.Errorf("Expected %d audit lines, got %d", want, len(lines))
+	}
+	counts := map[string]int{}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			t.Fatalf("Expected a time, an operation and an item, got %q", line)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, fields[0]); err != nil {
+			t.Errorf("Expected a timestamp, got %v", err)
+		}
+		counts[fields[1]]++
+	}
+	if counts["Enqueue"] != 2000 || counts["Dequeue"] != 1984 || counts["Drain"] != 16 {
+		t.Errorf("Expected 2000 enqueues, 1984 dequeues and 16 drained, got %v", counts)
+	}
+	if n := q.AuditDropped(); n != 0 {
+		t.Errorf("Expected no dropped records, got %d", n)
+	}
+}
+
+// Test that drops are audited with the format given
+func TestAuditFormat(t *testing.T) {
+	var buf bytes.Buffer
+	format := func(op HistoryOp, item interface{}) string { return fmt.Sprintf("op=%s item=%v", op, item) }
+	q := NewThreadSafeQueue(WithCapacity(1), WithOverflowPolicy(DropNewest), WithAuditWriter(&buf, format))
+	q.Enqueue(1)
+	q.Enqueue(2)
+	q.Close()
+	q.Dequeue()
+
+	lines := auditLines(t, q, &buf)
+	want := []string{"op=Enqueue item=1", "op=Drop item=2", "op=Dequeue item=1"}
+	if len(lines) != len(want) {
+		t.Fatalf("Expected %d lines, got %q", len(want), lines)
+	}
+	for i, line := range lines {
+		if _, text, _ := strings.Cut(line, " "); text != want[i] {
+			t.Errorf("Expected line %d to be %q, got %q", i, want[i], text)
+		}
+	}
+}
+
+// blockingWriter blocks every write until released
+type blockingWriter struct {
+	release chan struct{}
+	mu      sync.Mutex
+	lines   int
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	w.mu.Lock()
+	w.lines += bytes.Count(p, []byte("\n"))
+	w.mu.Unlock()
+	return len(p), nil
+}
+
+// Test that a stalled writer never blocks the queue, and that the records
+// it misses are counted
+func TestAuditSlowWriter(t *testing.T) {
+	w := &blockingWriter{release: make(chan struct{})}
+	q := NewThreadSafeQueue(WithAuditWriter(w, nil))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 3*auditBuffer; i++ {
+			q.Enqueue(i)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the queue not to wait for the audit writer")
+	}
+	if q.AuditDropped() == 0 {
+		t.Error("Expected records to be dropped while the writer is stalled")
+	}
+	close(w.release)
+	q.Close()
+	q.Drain()
+	<-q.audit.exited
+	if got, want := uint64(w.lines)+q.AuditDropped(), uint64(6*auditBuffer); got != want {
+		t.Errorf("Expected lines and dropped records to add up to %d, got %d", want, got)
+	}
+}
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, errors.New("disk full") }
+
+// Test that records after a write error are counted as dropped
+func TestAuditWriteError(t *testing.T) {
+	q := NewThreadSafeQueue(WithAuditWriter(failingWriter{}, nil))
+	q.EnqueueBatch(1, 2, 3)
+	q.Close()
+	q.Drain()
+	<-q.audit.exited
+	if n := q.AuditDropped(); n == 0 {
+		t.Error("Expected records to be dropped after a write error")
+	}
+}
@@ -0,0 +1,92 @@
+package threadsafequeue
+
+import "time"
+
+// WithAutoscale lets the worker pool grow and shrink between min and max
+// workers with the load, instead of running a fixed number. The pool starts
+// with the count given to RunWorkers, brought within the bounds. At the end
+// of every interval, it estimates how long an item enqueued then would wait,
+// by Little's law from the size and the dequeue rate over the interval, as
+// WithAdaptiveCapacity does. Above targetLatency, the pool grows by a
+// quarter, and at least one worker; at half of it or below, it shrinks by as
+// much. A worker retired to shrink the pool finishes the item it holds, if
+// any, and then stops. The interval runs on a timer of the queue's clock.
+//
+// The workers running are counted in Stats.Workers, along with those of any
+// other pool of the queue. It panics unless 0 < min <= max and targetLatency
+// and interval are positive.
+func WithAutoscale(min, max int, targetLatency, interval time.Duration) WorkerOption {
+	if min < 1 || max < min || targetLatency <= 0 || interval <= 0 {
+		panic("threadsafequeue: WithAutoscale needs 0 < min <= max and a positive targetLatency and interval")
+	}
+	return func(p *workerPool) {
+		p.scale = &autoscale{min: min, max: max, target: targetLatency, interval: interval, workers: make(map[*worker]struct{})}
+	}
+}
+
+// autoscale is the state behind WithAutoscale, protected by p.mu.
+type autoscale struct {
+	min, max int
+	target   time.Duration
+	interval time.Duration
+	workers  map[*worker]struct{} // Workers not retired.
+	timer    Timer
+	last     time.Time // Start of the current interval.
+	dequeued uint64    // Dequeued total of the queue at the start of the interval.
+	stopped  bool
+}
+
+// startAutoscale starts the timer once the first workers are running. The
+// caller must hold p.mu.
+func (p *workerPool) startAutoscale() {
+	s := p.scale
+	s.last = p.q.clock.Now()
+	p.q.rlock()
+	s.dequeued = p.q.dequeued
+	p.q.mu.RUnlock()
+	s.timer = p.q.clock.AfterFunc(s.interval, p.rescale)
+}
+
+// rescale adjusts the number of workers at the end of an interval and starts
+// the next.
+func (p *workerPool) rescale() {
+	q := p.q
+	q.rlock()
+	n, dequeued := q.len(), q.dequeued
+	q.mu.RUnlock()
+	now := q.clock.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.scale
+	if s.stopped || p.active == 0 {
+		return // Every worker stopped, so spawning one would race with p.wg.Wait.
+	}
+	want := len(s.workers)
+	lag := littleLag(n, dequeued-s.dequeued, now.Sub(s.last))
+	switch {
+	case lag > s.target:
+		want = min(want+max(want/4, 1), s.max)
+	case lag <= s.target/2:
+		want = max(want-max(want/4, 1), s.min)
+	}
+	for len(s.workers) < want {
+		p.spawn()
+	}
+	for w := range s.workers {
+		if len(s.workers) <= want {
+			break
+		}
+		delete(s.workers, w)
+		w.retire() // The worker stops once it has handled its current item.
+	}
+	s.last, s.dequeued = now, dequeued
+	s.timer.Reset(s.interval)
+}
+
+// stopAutoscale stops the timer when the pool stops.
+func (p *workerPool) stopAutoscale() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.scale.stopped = true
+	p.scale.timer.Stop()
+}
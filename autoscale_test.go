@@ -0,0 +1,52 @@
+package threadsafequeue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Test that an autoscaled pool starts within its bounds, and that the
+// workers are counted in Stats until they stop
+func TestAutoscaleBounds(t *testing.T) {
+	for _, c := range []struct{ n, want int }{{0, 3}, {4, 4}, {20, 5}} {
+		q := NewThreadSafeQueue()
+		release := make(chan struct{})
+		result := make(chan error, 1)
+		go func() {
+			result <- q.RunWorkers(context.Background(), c.n, func(ctx context.Context, item interface{}) error {
+				<-release
+				return nil
+			}, WithAutoscale(3, 5, time.Second, time.Hour))
+		}()
+		awaitCount(t, q.Workers, c.want)
+		if s := q.Stats(); s.Workers != c.want {
+			t.Errorf("Expected %d workers in Stats, got %d", c.want, s.Workers)
+		}
+		close(release)
+		q.Close()
+		if err := <-result; err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+		if n := q.Workers(); n != 0 {
+			t.Errorf("Expected no worker left, got %d", n)
+		}
+	}
+}
+
+// Test that WithAutoscale rejects inconsistent bounds
+func TestAutoscaleInvalid(t *testing.T) {
+	for _, c := range []struct {
+		min, max         int
+		target, interval time.Duration
+	}{{0, 1, time.Second, time.Second}, {2, 1, time.Second, time.Second}, {1, 2, 0, time.Second}, {1, 2, time.Second, 0}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected a panic for %+v", c)
+				}
+			}()
+			WithAutoscale(c.min, c.max, c.target, c.interval)
+		}()
+	}
+}
@@ -0,0 +1,126 @@
+package threadsafequeue
+
+// BackpressureLevel is how strongly a queue asks its producers to slow down,
+// as sent by Backpressure.
+type BackpressureLevel int
+
+const (
+	// BackpressureNone means the queue is below its soft threshold.
+	BackpressureNone BackpressureLevel = iota
+	// BackpressureSoft means the queue reached its soft threshold:
+	// producers should ease off, say with smaller batches.
+	BackpressureSoft
+	// BackpressureHard means the queue reached its hard threshold:
+	// producers should pause.
+	BackpressureHard
+)
+
+// String returns the name of the level.
+func (l BackpressureLevel) String() string {
+	switch l {
+	case BackpressureNone:
+		return "None"
+	case BackpressureSoft:
+		return "Soft"
+	case BackpressureHard:
+		return "Hard"
+	default:
+		return "BackpressureLevel(unknown)"
+	}
+}
+
+// WithBackpressure sets the depths at which Backpressure reports a level:
+// BackpressureSoft once the queue holds soft items and BackpressureHard once
+// it holds hard. To keep the level from flapping around a threshold, it is
+// only left when the size falls more than hysteresis items below it. The
+// level is worked out inside every operation that changes the size, like
+// the crossings of WithWatermarks. It panics unless 0 < soft <= hard and
+// 0 <= hysteresis < soft.
+func WithBackpressure(soft, hard, hysteresis int) Option {
+	if soft < 1 || hard < soft || hysteresis < 0 || hysteresis >= soft {
+		panic("threadsafequeue: WithBackpressure needs 0 < soft <= hard and 0 <= hysteresis < soft")
+	}
+	return func(q *ThreadSafeQueue) {
+		q.pressure = &backpressure{soft: soft, hard: hard, hysteresis: hysteresis}
+	}
+}
+
+// Backpressure returns a channel that receives the backpressure level of the
+// queue, set by WithBackpressure, first as it is now and then whenever it
+// changes, so that producers can select on it and slow themselves down
+// instead of blocking on a full queue. The channel holds a single value: a
+// receiver that falls behind finds only the latest level, and never holds
+// the queue up. The channel is closed when the queue is closed. Without
+// WithBackpressure, the level stays BackpressureNone.
+//
+// Each call returns a channel of its own, kept until the queue is closed, so
+// a producer should call it once rather than on every item.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) Backpressure() <-chan BackpressureLevel {
+	ch := make(chan BackpressureLevel, 1)
+	q.lock()
+	defer q.unlock()
+	if q.pressure == nil {
+		q.pressure = &backpressure{} // Without thresholds, for the channels.
+	}
+	ch <- q.pressure.level
+	if q.closed {
+		close(ch)
+		return ch
+	}
+	q.pressure.chans = append(q.pressure.chans, ch)
+	return ch
+}
+
+// backpressure is the state behind WithBackpressure and Backpressure,
+// protected by the queue's lock.
+type backpressure struct {
+	soft, hard, hysteresis int // Zero soft means no thresholds.
+	level                  BackpressureLevel
+	chans                  []chan BackpressureLevel
+}
+
+// check works out the level for the size n of the queue and sends it to the
+// channels if it changed. The caller must hold q.mu exclusively.
+func (b *backpressure) check(n int) {
+	if b.soft == 0 {
+		return
+	}
+	l := b.level
+	if n >= b.hard {
+		l = BackpressureHard
+	} else if n >= b.soft && l == BackpressureNone {
+		l = BackpressureSoft
+	}
+	if l == BackpressureHard && n < b.hard-b.hysteresis {
+		l = BackpressureSoft
+	}
+	if l == BackpressureSoft && n < b.soft-b.hysteresis {
+		l = BackpressureNone
+	}
+	if l == b.level {
+		return
+	}
+	b.level = l
+	for _, ch := range b.chans {
+		select {
+		case ch <- l:
+		default:
+			select {
+			case <-ch: // Replace the level the receiver has not taken.
+			default:
+			}
+			ch <- l
+		}
+	}
+}
+
+// close closes the channels of a closed queue. The caller must hold q.mu
+// exclusively.
+func (b *backpressure) close() {
+	for i, ch := range b.chans {
+		close(ch)
+		b.chans[i] = nil
+	}
+	b.chans = nil
+}
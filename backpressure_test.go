@@ -0,0 +1,114 @@
+package threadsafequeue
+
+import (
+	"testing"
+)
+
+// Test that the level follows the thresholds with hysteresis, and that a
+// receiver that falls behind finds only the latest level
+func TestBackpressure(t *testing.T) {
+	q := NewThreadSafeQueue(WithBackpressure(4, 8, 2))
+	ch := q.Backpressure()
+	if l := <-ch; l != BackpressureNone {
+		t.Fatalf("Expected the current level None first, but got %v", l)
+	}
+	expect := func(want BackpressureLevel) {
+		t.Helper()
+		select {
+		case l := <-ch:
+			if l != want {
+				t.Errorf("Expected level %v, but got %v", want, l)
+			}
+		default:
+			t.Errorf("Expected level %v, but got none", want)
+		}
+	}
+	expectNone := func() {
+		t.Helper()
+		select {
+		case l := <-ch:
+			t.Errorf("Expected no change of level, but got %v", l)
+		default:
+		}
+	}
+
+	for i := 0; i < 4; i++ {
+		q.Enqueue(i)
+	}
+	expect(BackpressureSoft)
+	q.TryDequeue()
+	q.TryDequeue() // 2 is not below 4-2.
+	q.Enqueue(4)
+	expectNone()
+	q.TryDequeue()
+	q.TryDequeue() // 1 is.
+	expect(BackpressureNone)
+
+	q.EnqueueBatch(1, 2, 3, 4, 5, 6, 7, 8, 9) // Soft, then Hard, unread.
+	expect(BackpressureHard)
+	for i := 0; i < 4; i++ {
+		q.TryDequeue() // Down to 6: still Hard.
+	}
+	expectNone()
+	q.TryDequeue() // 5 is below 8-2.
+	expect(BackpressureSoft)
+	q.Drain()
+	expect(BackpressureNone)
+}
+
+// Test that Close closes every channel, and that a channel taken from a
+// closed queue comes closed after the current level
+func TestBackpressureClose(t *testing.T) {
+	q := NewThreadSafeQueue(WithBackpressure(1, 1, 0))
+	a, b := q.Backpressure(), q.Backpressure()
+	q.Enqueue(1)
+	q.Close()
+	for _, ch := range []<-chan BackpressureLevel{a, b} {
+		var got []BackpressureLevel
+		for l := range ch {
+			got = append(got, l)
+		}
+		if len(got) != 1 || got[0] != BackpressureHard {
+			t.Errorf("Expected Hard, replacing the unread None, before the close, but got %v", got)
+		}
+	}
+	ch := q.Backpressure()
+	if l, ok := <-ch; !ok || l != BackpressureHard {
+		t.Errorf("Expected the current level Hard, but got %v, %v", l, ok)
+	}
+	if _, ok := <-ch; ok {
+		t.Error("Expected the channel of a closed queue to be closed")
+	}
+}
+
+// Test that without WithBackpressure the level stays None
+func TestBackpressureDisabled(t *testing.T) {
+	q := NewThreadSafeQueue()
+	ch := q.Backpressure()
+	<-ch
+	for i := 0; i < 100; i++ {
+		q.Enqueue(i)
+	}
+	select {
+	case l := <-ch:
+		t.Errorf("Expected no level without thresholds, but got %v", l)
+	default:
+	}
+}
+
+// Test that WithBackpressure rejects inconsistent thresholds
+func TestBackpressureInvalid(t *testing.T) {
+	for _, c := range [][3]int{{0, 1, 0}, {2, 1, 0}, {2, 4, -1}, {2, 4, 2}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected a panic for %v", c)
+				}
+			}()
+			WithBackpressure(c[0], c[1], c[2])
+		}()
+	}
+	if s := BackpressureHard.String(); s != "Hard" {
+		t.Errorf("Expected Hard, but got %q", s)
+	}
+}
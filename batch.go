@@ -0,0 +1,108 @@
+package threadsafequeue
+
+import "sync"
+
+// batchPool recycles the slices returned by DequeueBatch once callers hand
+// them back with ReleaseBatch. It holds pointers to slices, so recycling a
+// batch costs a small header allocation instead of a new backing array.
+var batchPool sync.Pool
+
+// DequeueBatch removes and returns up to max items from the front of the
+// queue, in FIFO order, taking the lock once. If the queue is empty, it
+// blocks like Dequeue until at least one item is available; it returns an
+// empty slice only once the queue is closed and drained. A max of zero or
+// less takes every available item.
+//
+// The slice comes from an internal pool when one is available. Callers that
+// are done with it may return it with ReleaseBatch to avoid allocating a new
+// one on the next call.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) DequeueBatch(max int) []interface{} {
+	q.lock()
+	defer q.unlock()
+	first, _, handed := q.awaitItems()
+	if handed {
+		q.mu.Lock() // Look for more items behind the one handed over.
+	}
+	n := q.len()
+	if handed {
+		n++
+	}
+	if max > 0 && n > max {
+		n = max
+	}
+	var batch []interface{}
+	if p, ok := batchPool.Get().(*[]interface{}); ok && cap(*p) >= n {
+		batch = (*p)[:0]
+	} else {
+		if ok {
+			batchPool.Put(p) // Too small for this batch; leave it for a smaller one.
+		}
+		batch = make([]interface{}, 0, n)
+	}
+	if handed {
+		batch = append(batch, first)
+		n--
+	}
+	return q.takeInto(batch, n)
+}
+
+// DequeueBatchInto is like DequeueBatch, but stores up to cap(buf) items in
+// buf, which it returns resliced to the items taken. Reusing the same buffer
+// across calls makes batch dequeues allocation-free. It panics if cap(buf) is
+// zero.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) DequeueBatchInto(buf []interface{}) []interface{} {
+	if cap(buf) == 0 {
+		panic("threadsafequeue: DequeueBatchInto needs a buffer with room")
+	}
+	q.lock()
+	defer q.unlock()
+	first, _, handed := q.awaitItems()
+	buf = buf[:0]
+	if handed {
+		q.mu.Lock() // Look for more items behind the one handed over.
+		buf = append(buf, first)
+	}
+	n := q.len()
+	if n > cap(buf)-len(buf) {
+		n = cap(buf) - len(buf)
+	}
+	return q.takeInto(buf, n)
+}
+
+// ReleaseBatch returns a slice obtained from DequeueBatch to the pool it
+// came from. The slice is cleared first, so no item stays reachable through
+// the pool; the caller must not use it afterwards.
+func ReleaseBatch(batch []interface{}) {
+	batch = batch[:cap(batch)]
+	for i := range batch {
+		batch[i] = nil
+	}
+	batch = batch[:0]
+	batchPool.Put(&batch)
+}
+
+// awaitItems waits until the queue has items or is closed. If a producer
+// handed the caller an item while it was parked, awaitItems returns it and
+// what was kept beside it with true and, as with awaitItem, without holding q.mu; it was
+// the front item, so it comes before any still queued. The caller must hold
+// q.mu.
+func (q *ThreadSafeQueue) awaitItems() (interface{}, extra, bool) {
+	for attempt := 0; q.len() == 0 && !q.closed; attempt++ {
+		if item, x, ok := q.awaitItem(nil, attempt, false); ok {
+			return item, x, true
+		}
+	}
+	return nil, extra{}, false
+}
+
+// takeInto appends n items from the front of the queue to dst. The caller
+// must hold q.mu.
+func (q *ThreadSafeQueue) takeInto(dst []interface{}, n int) []interface{} {
+	for i := 0; i < n; i++ {
+		item, _ := q.remove()
+		dst = append(dst, item)
+	}
+	return dst
+}
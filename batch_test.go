@@ -0,0 +1,102 @@
+package threadsafequeue
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that DequeueBatch takes up to max items in order
+func TestDequeueBatch(t *testing.T) {
+	q := NewThreadSafeQueue()
+	for i := 0; i < 10; i++ {
+		q.Enqueue(i)
+	}
+	batch := q.DequeueBatch(4)
+	if len(batch) != 4 || batch[0] != 0 || batch[3] != 3 {
+		t.Fatalf("Expected [0 1 2 3], got %v", batch)
+	}
+	ReleaseBatch(batch)
+	batch = q.DequeueBatch(0)
+	if len(batch) != 6 || batch[0] != 4 || batch[5] != 9 {
+		t.Fatalf("Expected [4 5 6 7 8 9], got %v", batch)
+	}
+	if q.Size() != 0 {
+		t.Errorf("Expected size to be 0, got %d", q.Size())
+	}
+
+	q.Close()
+	if batch := q.DequeueBatch(4); len(batch) != 0 {
+		t.Errorf("Expected an empty batch from a closed queue, got %v", batch)
+	}
+}
+
+// Test that DequeueBatchInto blocks for the first item and reuses the buffer
+func TestDequeueBatchInto(t *testing.T) {
+	q := NewThreadSafeQueue()
+	buf := make([]interface{}, 0, 3)
+	result := make(chan []interface{})
+	go func() {
+		result <- q.DequeueBatchInto(buf)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	q.EnqueueBatch(1, 2, 3, 4)
+	got := <-result
+	if len(got) != 3 || got[0] != 1 || got[2] != 3 {
+		t.Fatalf("Expected [1 2 3], got %v", got)
+	}
+	if &got[0] != &buf[:1][0] {
+		t.Error("Expected the batch to be stored in the caller's buffer")
+	}
+	if got = q.DequeueBatchInto(got); len(got) != 1 || got[0] != 4 {
+		t.Errorf("Expected [4], got %v", got)
+	}
+}
+
+// Test that a released batch keeps no references to items
+func TestReleaseBatchClears(t *testing.T) {
+	q := NewThreadSafeQueue()
+	q.EnqueueBatch("a", "b")
+	batch := q.DequeueBatch(0)
+	full := batch[:cap(batch)]
+	ReleaseBatch(batch)
+	for i, item := range full {
+		if item != nil {
+			t.Errorf("Expected slot %d to be cleared, got %v", i, item)
+		}
+	}
+}
+
+// Benchmark dequeueing 10k-item batches with a fresh slice, a pooled slice
+// and a caller-owned buffer
+func BenchmarkDequeueBatch10k(b *testing.B) {
+	const size = 10000
+	items := make([]interface{}, size)
+	for i := range items {
+		items[i] = struct{}{}
+	}
+	b.Run("Allocate", func(b *testing.B) {
+		q := NewThreadSafeQueue()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			q.EnqueueBatch(items...)
+			_ = q.DequeueBatch(size)
+		}
+	})
+	b.Run("Pooled", func(b *testing.B) {
+		q := NewThreadSafeQueue()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			q.EnqueueBatch(items...)
+			ReleaseBatch(q.DequeueBatch(size))
+		}
+	})
+	b.Run("Into", func(b *testing.B) {
+		q := NewThreadSafeQueue()
+		buf := make([]interface{}, 0, size)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			q.EnqueueBatch(items...)
+			buf = q.DequeueBatchInto(buf)
+		}
+	})
+}
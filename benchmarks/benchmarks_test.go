@@ -0,0 +1,105 @@
+package benchmarks
+
+import (
+	"flag"
+	"fmt"
+	"testing"
+)
+
+var long = flag.Bool("long", false, "run the throughput regression test")
+
+// scenarios are the producer/consumer mixes the throughput benchmarks cover.
+var scenarios = []struct {
+	name                 string
+	producers, consumers int
+}{
+	{"SPSC", 1, 1},
+	{"MPSC4", 4, 1},
+	{"MPSC16", 16, 1},
+	{"MPMC4", 4, 4},
+	{"MPMC16", 16, 16},
+}
+
+// items are the payloads the throughput benchmarks move, by size.
+var items = []struct {
+	name string
+	item interface{}
+}{
+	{"8B", 8},
+	{"64B", [64]byte{}},
+	{"1KB", [1024]byte{}},
+}
+
+// Test that every backend delivers every item in every scenario it supports
+func TestBackends(t *testing.T) {
+	for _, backend := range Backends() {
+		for _, s := range scenarios {
+			if !backend.Supports(s.producers, s.consumers) {
+				continue
+			}
+			t.Run(backend.Name+"/"+s.name, func(t *testing.T) {
+				q := backend.New(Capacity)
+				defer q.Close()
+				if got := Move(q, s.producers, s.consumers, 10000, 1); got != 10000 {
+					t.Errorf("Expected 10000 items, got %d", got)
+				}
+			})
+		}
+	}
+}
+
+// Test that no backend is grossly slower than a buffered channel. Timing
+// tests are noisy, so this only runs with -long and allows a wide margin.
+func TestNoGrossRegression(t *testing.T) {
+	if !*long {
+		t.Skip("run with -long to measure throughput")
+	}
+	const factor = 20
+	var channel Backend
+	for _, backend := range Backends() {
+		if backend.Name == "Channel" {
+			channel = backend
+		}
+	}
+	for _, s := range scenarios {
+		baseline := testing.Benchmark(func(b *testing.B) { Run(b, channel, s.producers, s.consumers, 8) })
+		for _, backend := range Backends() {
+			if backend.Reference || !backend.Supports(s.producers, s.consumers) {
+				continue
+			}
+			r := testing.Benchmark(func(b *testing.B) { Run(b, backend, s.producers, s.consumers, 8) })
+			if r.NsPerOp() > factor*baseline.NsPerOp() {
+				t.Errorf("%s/%s: %d ns/op, more than %dx the channel's %d ns/op",
+					backend.Name, s.name, r.NsPerOp(), factor, baseline.NsPerOp())
+			}
+		}
+	}
+}
+
+// Benchmark throughput for every backend, scenario and item size
+func BenchmarkThroughput(b *testing.B) {
+	for _, s := range scenarios {
+		for _, it := range items {
+			for _, backend := range Backends() {
+				if !backend.Supports(s.producers, s.consumers) {
+					continue
+				}
+				b.Run(fmt.Sprintf("%s/%s/%s", s.name, it.name, backend.Name), func(b *testing.B) {
+					Run(b, backend, s.producers, s.consumers, it.item)
+				})
+			}
+		}
+	}
+}
+
+// Benchmark wake-up latency for every backend
+func BenchmarkPingPong(b *testing.B) {
+	for _, backend := range Backends() {
+		if !backend.Supports(1, 1) {
+			continue
+		}
+		b.Run(backend.Name, func(b *testing.B) {
+			PingPong(b, backend)
+		})
+	}
+}
@@ -0,0 +1,249 @@
+// Package benchmarks compares the queues in threadsafequeue with each other
+// and with a buffered channel. The harness in this file adapts every queue to
+// a common interface and drives it through producer/consumer scenarios; the
+// benchmarks themselves live in the package's tests, so one
+// `go test -bench . ./benchmarks` run evaluates every backend.
+//
+// To evaluate a new backend, add it to Backends.
+package benchmarks
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	queue "github.com/sandeepkv93/threadsafequeue"
+)
+
+// Queue is what the harness needs from a backend. Dequeue blocks until an
+// item is available and returns false once the queue is closed and drained.
+type Queue interface {
+	Enqueue(item interface{})
+	Dequeue() (interface{}, bool)
+	Close()
+}
+
+// Backend describes a queue implementation under test.
+type Backend struct {
+	Name string
+	// New creates an empty queue. capacity is a hint for bounded backends,
+	// which must hold at least that many items.
+	New func(capacity int) Queue
+	// MaxProducers and MaxConsumers limit the scenarios the backend can
+	// take part in; zero means unlimited.
+	MaxProducers, MaxConsumers int
+	// Reference marks a backend from outside the library, kept for
+	// comparison, which the regression test does not hold to its margin.
+	Reference bool
+}
+
+// Supports reports whether the backend can run with the given numbers of
+// producer and consumer goroutines.
+func (b Backend) Supports(producers, consumers int) bool {
+	return (b.MaxProducers == 0 || producers <= b.MaxProducers) &&
+		(b.MaxConsumers == 0 || consumers <= b.MaxConsumers)
+}
+
+// Capacity is the capacity passed to bounded backends.
+const Capacity = 1024
+
+// Backends returns every backend the benchmarks compare. RingQueue is left
+// out because it overwrites items when full, so consumers cannot count on
+// receiving every item.
+func Backends() []Backend {
+	return []Backend{
+		{Name: "ThreadSafeQueue", New: func(int) Queue { return queue.NewThreadSafeQueue() }},
+		{Name: "BoundedQueue", New: func(n int) Queue { return queue.NewThreadSafeQueue(queue.WithCapacity(n)) }},
+		{Name: "Channel", New: func(n int) Queue { return make(channelQueue, n) }, Reference: true},
+		{Name: "TypedQueue", New: func(int) Queue { return queue.NewTypedQueue[interface{}]() }},
+		{Name: "TwoLockQueue", New: func(int) Queue { return queue.NewTwoLockQueue() }},
+		{Name: "ShardedQueue", New: func(int) Queue { return queue.NewShardedQueue(runtime.GOMAXPROCS(0)) }},
+		{Name: "LockFreeQueue", New: func(int) Queue { return newLockFreeQueue() }},
+		{Name: "SyncMap", New: func(int) Queue { return newSyncMapQueue() }, Reference: true},
+		{Name: "MPSCQueue", New: func(int) Queue { return mpscQueue{queue.NewMPSCQueue()} }, MaxConsumers: 1},
+		{Name: "SPSCQueue", New: func(n int) Queue { return newSPSCQueue(n) }, MaxProducers: 1, MaxConsumers: 1},
+	}
+}
+
+// Run moves b.N copies of item through a new queue from the backend, with
+// the given numbers of producer and consumer goroutines, and reports the
+// throughput as ops/s. The backend must support the scenario.
+func Run(b *testing.B, backend Backend, producers, consumers int, item interface{}) {
+	q := backend.New(Capacity)
+	b.ReportAllocs()
+	b.ResetTimer()
+	Move(q, producers, consumers, b.N, item)
+	b.StopTimer()
+	q.Close()
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "ops/s")
+}
+
+// Move enqueues n copies of item on q from the given number of producer
+// goroutines while the given number of consumer goroutines dequeue them, and
+// returns how many items the consumers received once all of them are done.
+func Move(q Queue, producers, consumers, n int, item interface{}) int {
+	var wg sync.WaitGroup
+	received := make([]int, consumers)
+	for c := 0; c < consumers; c++ {
+		wg.Add(1)
+		go func(c, n int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				if _, ok := q.Dequeue(); ok {
+					received[c]++
+				}
+			}
+		}(c, share(n, consumers, c))
+	}
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				q.Enqueue(item)
+			}
+		}(share(n, producers, p))
+	}
+	wg.Wait()
+	total := 0
+	for _, r := range received {
+		total += r
+	}
+	return total
+}
+
+// PingPong measures wake-up latency: an item is passed back and forth
+// between two goroutines through a pair of queues, each hop waking a
+// goroutine blocked in Dequeue. ns/op is the time of one round trip.
+func PingPong(b *testing.B, backend Backend) {
+	ping, pong := backend.New(Capacity), backend.New(Capacity)
+	go func() {
+		for {
+			item, ok := ping.Dequeue()
+			if !ok {
+				return
+			}
+			pong.Enqueue(item)
+		}
+	}()
+	var item interface{} = 1
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ping.Enqueue(item)
+		pong.Dequeue()
+	}
+	b.StopTimer()
+	ping.Close()
+	pong.Close()
+}
+
+// share returns how many of n operations the i-th of parts goroutines runs.
+func share(n, parts, i int) int {
+	s := n / parts
+	if i < n%parts {
+		s++
+	}
+	return s
+}
+
+// channelQueue adapts a buffered channel.
+type channelQueue chan interface{}
+
+func (c channelQueue) Enqueue(item interface{}) { c <- item }
+func (c channelQueue) Close()                   { close(c) }
+func (c channelQueue) Dequeue() (interface{}, bool) {
+	item, ok := <-c
+	return item, ok
+}
+
+// lockFreeQueue adds a blocking Dequeue to LockFreeQueue by yielding the
+// processor until an item appears.
+type lockFreeQueue struct {
+	q    *queue.LockFreeQueue
+	done chan struct{}
+	once sync.Once
+}
+
+func newLockFreeQueue() *lockFreeQueue {
+	return &lockFreeQueue{q: queue.NewLockFreeQueue(), done: make(chan struct{})}
+}
+
+func (l *lockFreeQueue) Enqueue(item interface{}) { l.q.Enqueue(item) }
+func (l *lockFreeQueue) Close()                   { l.once.Do(func() { close(l.done) }) }
+
+func (l *lockFreeQueue) Dequeue() (interface{}, bool) {
+	for {
+		if item, ok := l.q.TryDequeue(); ok {
+			return item, true
+		}
+		select {
+		case <-l.done:
+			return l.q.TryDequeue()
+		default:
+			runtime.Gosched()
+		}
+	}
+}
+
+// syncMapQueue is a queue over a sync.Map keyed by position: producers and
+// consumers claim positions from atomic tail and head counters, so they
+// never share a lock, and a consumer yields the processor until the item at
+// its position is stored, as lockFreeQueue does.
+type syncMapQueue struct {
+	m          sync.Map
+	head, tail atomic.Uint64
+	done       chan struct{}
+	once       sync.Once
+}
+
+func newSyncMapQueue() *syncMapQueue {
+	return &syncMapQueue{done: make(chan struct{})}
+}
+
+func (s *syncMapQueue) Enqueue(item interface{}) { s.m.Store(s.tail.Add(1)-1, item) }
+func (s *syncMapQueue) Close()                   { s.once.Do(func() { close(s.done) }) }
+
+func (s *syncMapQueue) Dequeue() (interface{}, bool) {
+	pos := s.head.Add(1) - 1
+	for {
+		if item, ok := s.m.LoadAndDelete(pos); ok {
+			return item, true
+		}
+		select {
+		case <-s.done:
+			if pos >= s.tail.Load() {
+				return nil, false // Nothing will be stored there.
+			}
+		default:
+		}
+		runtime.Gosched()
+	}
+}
+
+// mpscQueue adapts MPSCQueue, which already blocks.
+type mpscQueue struct{ *queue.MPSCQueue }
+
+// spscQueue adapts SPSCQueue through its parking wrappers. SPSCQueue has no
+// Close, so Close cancels the wrappers' context instead, which abandons any
+// items still queued; the harness only closes queues once it is done.
+type spscQueue struct {
+	q      *queue.SPSCQueue
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newSPSCQueue(capacity int) spscQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	return spscQueue{q: queue.NewSPSCQueue(capacity), ctx: ctx, cancel: cancel}
+}
+
+func (s spscQueue) Enqueue(item interface{}) { s.q.EnqueueWait(s.ctx, item) }
+func (s spscQueue) Close()                   { s.cancel() }
+
+func (s spscQueue) Dequeue() (interface{}, bool) {
+	item, err := s.q.DequeueWait(s.ctx)
+	return item, err == nil
+}
@@ -0,0 +1,222 @@
+package threadsafequeue
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of the circuit breaker of WithCircuitBreaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets workers take items as usual.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen stops workers taking items until the cooldown is over.
+	BreakerOpen
+	// BreakerHalfOpen lets a single item through, as a trial.
+	BreakerHalfOpen
+)
+
+// String returns the name of the state.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "Closed"
+	case BreakerOpen:
+		return "Open"
+	case BreakerHalfOpen:
+		return "HalfOpen"
+	default:
+		return "BreakerState(unknown)"
+	}
+}
+
+// WithCircuitBreaker pauses the worker pool while the handler keeps failing,
+// say because a service it calls is down, rather than burning through the
+// queue. The breaker opens once the failed handler calls over the last window
+// reach failureRatio of all calls: workers then take no items, which stay
+// queued, for the cooldown, except that a worker already waiting for one may
+// still take it. It is then half-open: one worker takes a single item as a
+// trial; if the handler succeeds the breaker closes and the pool resumes,
+// otherwise it opens again for another cooldown. Items a worker already
+// holds, such as those held back by WithKeyFunc, are still handled.
+//
+// Every handler call counts, retries of WithRetry included; panics and
+// timeouts count as failures. As the ratio is over whatever calls the window
+// holds, a single failure opens the breaker after a quiet spell. State
+// changes are passed to the function given to WithBreakerHook and logged by
+// the queue's logger. The cooldown runs on a timer of the queue's clock. It
+// panics unless window and cooldown are positive and 0 < failureRatio <= 1.
+func WithCircuitBreaker(window time.Duration, failureRatio float64, cooldown time.Duration) WorkerOption {
+	if window <= 0 || cooldown <= 0 || failureRatio <= 0 || failureRatio > 1 {
+		panic("threadsafequeue: WithCircuitBreaker needs a positive window and cooldown and 0 < failureRatio <= 1")
+	}
+	return func(p *workerPool) {
+		p.breaker = &breaker{window: window, ratio: failureRatio, cooldown: cooldown}
+	}
+}
+
+// WithBreakerHook calls fn with the new state whenever the circuit breaker
+// of WithCircuitBreaker changes state, so that an outage can raise an alert.
+// It is called from the goroutine that caused the change, without any lock
+// held.
+func WithBreakerHook(fn func(state BreakerState)) WorkerOption {
+	return func(p *workerPool) {
+		p.breakerHook = fn
+	}
+}
+
+// breaker is the state behind WithCircuitBreaker.
+type breaker struct {
+	window   time.Duration
+	ratio    float64
+	cooldown time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	calls    ring[breakerCall] // Calls within the window, oldest first.
+	failures int               // Failed calls in calls.
+	trial    bool              // Set while the trial item of the half-open state is out.
+	changed  chan struct{}     // Closed when workers waiting to take an item may go on.
+	timer    Timer             // Ends the cooldown.
+}
+
+// breakerCall is the outcome of a handler call, as the breaker counts it.
+type breakerCall struct {
+	at     time.Time
+	failed bool
+}
+
+// admit waits until the breaker lets the worker take an item. It returns
+// whether the item is the trial of the half-open state, and false as its
+// second value if next was done first.
+func (p *workerPool) admit(next context.Context) (trial, ok bool) {
+	b := p.breaker
+	for {
+		b.mu.Lock()
+		switch {
+		case b.state == BreakerClosed:
+			b.mu.Unlock()
+			return false, true
+		case b.state == BreakerHalfOpen && !b.trial:
+			b.trial = true
+			b.mu.Unlock()
+			return true, true
+		}
+		if b.changed == nil {
+			b.changed = make(chan struct{})
+		}
+		changed := b.changed
+		b.mu.Unlock()
+		select {
+		case <-changed:
+		case <-next.Done():
+			return false, false
+		}
+	}
+}
+
+// noTrial gives back the trial admitted by admit when the worker took no
+// item after all.
+func (p *workerPool) noTrial() {
+	b := p.breaker
+	b.mu.Lock()
+	b.trial = false
+	b.release()
+	b.mu.Unlock()
+}
+
+// record counts the outcome of a handler call, trial telling whether its item
+// was the trial of the half-open state, and changes state as it calls for.
+func (p *workerPool) record(trial, failed bool) {
+	b := p.breaker
+	now := p.q.clock.Now()
+	b.mu.Lock()
+	state := b.state
+	switch {
+	case trial && failed:
+		b.trial = false
+		p.openBreaker()
+	case trial:
+		b.trial = false
+		b.calls = ring[breakerCall]{}
+		b.failures = 0
+		b.state = BreakerClosed
+		b.release()
+	case b.state == BreakerClosed:
+		b.calls.pushBack(breakerCall{at: now, failed: failed})
+		if failed {
+			b.failures++
+		}
+		for c, ok := b.calls.front(); ok && now.Sub(c.at) > b.window; c, ok = b.calls.front() {
+			if b.calls.popFront(); c.failed {
+				b.failures--
+			}
+		}
+		if float64(b.failures) >= b.ratio*float64(b.calls.len()) && b.failures > 0 {
+			p.openBreaker()
+		}
+	}
+	changed, state := b.state != state, b.state
+	b.mu.Unlock()
+	if changed {
+		p.breakerChanged(state)
+	}
+}
+
+// openBreaker opens the breaker and starts the cooldown. The caller must
+// hold b.mu.
+func (p *workerPool) openBreaker() {
+	b := p.breaker
+	b.state = BreakerOpen
+	b.timer = p.q.clock.AfterFunc(b.cooldown, func() {
+		b.mu.Lock()
+		if b.state != BreakerOpen {
+			b.mu.Unlock()
+			return
+		}
+		b.state = BreakerHalfOpen
+		b.release()
+		b.mu.Unlock()
+		p.breakerChanged(BreakerHalfOpen)
+	})
+}
+
+// release wakes the workers waiting in admit. The caller must hold b.mu.
+func (b *breaker) release() {
+	if b.changed != nil {
+		close(b.changed)
+		b.changed = nil
+	}
+}
+
+// stopBreaker stops the cooldown when the pool stops.
+func (p *workerPool) stopBreaker() {
+	b := p.breaker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	b.state = BreakerClosed // The cooldown timer, if running, does nothing.
+}
+
+// breakerChanged announces the new state of the breaker to the hook and the
+// logger.
+func (p *workerPool) breakerChanged(state BreakerState) {
+	if q := p.q; q.logger != nil {
+		level, msg := slog.LevelInfo, "circuit breaker closed"
+		switch state {
+		case BreakerOpen:
+			level, msg = slog.LevelWarn, "circuit breaker opened"
+		case BreakerHalfOpen:
+			msg = "circuit breaker half-open"
+		}
+		q.log(logEvent{level: level, msg: msg, size: q.Size()})
+	}
+	if p.breakerHook != nil {
+		p.breakerHook(state)
+	}
+}
@@ -0,0 +1,177 @@
+package threadsafequeue_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	queue "github.com/sandeepkv93/threadsafequeue"
+	"github.com/sandeepkv93/threadsafequeue/queuetest"
+)
+
+// logBuffer collects the lines of a slog.TextHandler, which may write from
+// several goroutines.
+type logBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (l *logBuffer) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.b.Write(p)
+}
+
+// lines returns the level and message of each line, before the queue name.
+func (l *logBuffer) lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(l.b.String()), "\n") {
+		line, _, _ = strings.Cut(line, " queue=")
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Test that the breaker logs each change of state, and that no item is taken
+// while it is open
+func TestFakeClockCircuitBreakerLogging(t *testing.T) {
+	clock := queuetest.NewFakeClock(epoch)
+	var logs logBuffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	q := queue.NewThreadSafeQueue(queue.WithClock(clock), queue.WithLogger(logger), queue.WithName("jobs"))
+	var failing atomic.Bool
+	failing.Store(true)
+	var calls atomic.Int32
+	states := make(chan queue.BreakerState, 10)
+	result := make(chan error, 1)
+	go func() {
+		result <- q.RunWorkers(context.Background(), 1, func(ctx context.Context, item interface{}) error {
+			calls.Add(1)
+			if failing.Load() {
+				return errors.New("down")
+			}
+			return nil
+		}, queue.WithCircuitBreaker(time.Minute, 1, 30*time.Second), queue.WithBreakerHook(func(state queue.BreakerState) {
+			if state == queue.BreakerHalfOpen {
+				failing.Store(false)
+			}
+			states <- state
+		}))
+	}()
+	q.Enqueue(1)
+	if s := <-states; s != queue.BreakerOpen {
+		t.Fatalf("Expected the breaker to open, but got %v", s)
+	}
+	for i := 2; i <= 10; i++ {
+		q.Enqueue(i)
+	}
+	clock.BlockUntilTimers(1) // The cooldown.
+	clock.Advance(30*time.Second - time.Nanosecond)
+	if n := q.Size(); n != 9 {
+		t.Errorf("Expected the items to stay queued while the breaker is open, but %d are left", n)
+	}
+	clock.Advance(time.Nanosecond)
+	for _, want := range []queue.BreakerState{queue.BreakerHalfOpen, queue.BreakerClosed} {
+		if s := <-states; s != want {
+			t.Fatalf("Expected the breaker %v, but got %v", want, s)
+		}
+	}
+	q.Close()
+	<-result
+	if n := calls.Load(); n != 10 {
+		t.Errorf("Expected every item handled once the breaker closed, but got %d calls", n)
+	}
+	want := []string{
+		`level=WARN msg="circuit breaker opened"`,
+		`level=INFO msg="circuit breaker half-open"`,
+		`level=INFO msg="circuit breaker closed"`,
+		`level=INFO msg="queue closed"`,
+	}
+	if got := logs.lines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the records %q, but got %q", want, got)
+	}
+}
+
+// Test that a circuit breaker walks from closed to open while the handler
+// fails, stays open through a failed trial, and closes after a good one
+func TestFakeClockCircuitBreaker(t *testing.T) {
+	clock := queuetest.NewFakeClock(epoch)
+	q := queue.NewThreadSafeQueue(queue.WithClock(clock))
+	failing := make(chan bool, 1)
+	failing <- true
+	handled := make(chan interface{}, 10)
+	states := make(chan queue.BreakerState, 10)
+	result := make(chan error, 1)
+	go func() {
+		result <- q.RunWorkers(context.Background(), 1, func(ctx context.Context, item interface{}) error {
+			f := <-failing
+			failing <- f
+			handled <- item
+			if f {
+				return errors.New("down")
+			}
+			return nil
+		}, queue.WithCircuitBreaker(10*time.Second, 0.5, 30*time.Second), queue.WithBreakerHook(func(s queue.BreakerState) {
+			states <- s
+		}))
+	}()
+	expect := func(item interface{}, want ...queue.BreakerState) {
+		t.Helper()
+		if got := <-handled; got != item {
+			t.Fatalf("Expected item %v handled, got %v", item, got)
+		}
+		for _, w := range want {
+			if s := <-states; s != w {
+				t.Fatalf("Expected the breaker %v, got %v", w, s)
+			}
+		}
+	}
+
+	q.Enqueue(1)
+	expect(1, queue.BreakerOpen) // Closed -> open.
+	q.EnqueueBatch(2, 3)
+	clock.BlockUntilTimers(1)
+	clock.Advance(30*time.Second - time.Nanosecond)
+	if n := q.Size(); n != 2 {
+		t.Fatalf("Expected the items to stay queued through the cooldown, got %d left", n)
+	}
+	clock.Advance(time.Nanosecond)
+	if s := <-states; s != queue.BreakerHalfOpen {
+		t.Fatalf("Expected the breaker half-open after the cooldown, got %v", s)
+	}
+	expect(2, queue.BreakerOpen) // The trial failed.
+	if n := q.Size(); n != 1 {
+		t.Fatalf("Expected a single trial item, got %d left", n)
+	}
+
+	<-failing
+	failing <- false // The downstream recovers.
+	clock.BlockUntilTimers(1)
+	clock.Advance(30 * time.Second)
+	if s := <-states; s != queue.BreakerHalfOpen {
+		t.Fatalf("Expected the breaker half-open again, got %v", s)
+	}
+	expect(3, queue.BreakerClosed)
+	q.Enqueue(4)
+	expect(4)
+	q.Close()
+	if err := <-result; err == nil {
+		t.Error("Expected the failures of items 1 and 2 reported")
+	}
+}
@@ -0,0 +1,26 @@
+package threadsafequeue
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that WithCircuitBreaker rejects invalid arguments
+func TestCircuitBreakerInvalid(t *testing.T) {
+	for _, c := range []struct {
+		window, cooldown time.Duration
+		ratio            float64
+	}{{0, 1, 0.5}, {1, 0, 0.5}, {1, 1, 0}, {1, 1, 1.5}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected a panic for %+v", c)
+				}
+			}()
+			WithCircuitBreaker(c.window, c.ratio, c.cooldown)
+		}()
+	}
+	if s := BreakerHalfOpen.String(); s != "HalfOpen" {
+		t.Errorf("Expected HalfOpen, but got %q", s)
+	}
+}
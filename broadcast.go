@@ -0,0 +1,76 @@
+package threadsafequeue
+
+import "sync"
+
+// Broadcaster delivers every broadcast item to every attached queue, for
+// cases such as cache invalidation where all consumers need all items.
+//
+// Broadcast is atomic with respect to Attach and Detach: a queue attached
+// before a Broadcast call returns receives its item, a queue attached after
+// it does not, and every attached queue sees broadcast items in the same
+// order.
+type Broadcaster struct {
+	subs    []*ThreadSafeQueue // Attached queues, in attach order.
+	members sync.Map           // Set of attached queues, used by Detach.
+	opts    []Option           // Options applied to every attached queue.
+	mu      sync.Mutex         // Mutex to serialize broadcasts with attach and detach.
+}
+
+// NewBroadcaster initializes and returns a new Broadcaster. The given options
+// are applied to every queue returned by Attach. With a bounded queue using
+// the Block policy, Broadcast waits for that subscriber to make room.
+func NewBroadcaster(opts ...Option) *Broadcaster {
+	return &Broadcaster{opts: opts}
+}
+
+// Attach returns a new queue that receives every item broadcast from now on.
+// This method is safe for concurrent use.
+func (b *Broadcaster) Attach() *ThreadSafeQueue {
+	q := NewThreadSafeQueue(b.opts...)
+	b.mu.Lock()
+	b.subs = append(b.subs, q)
+	b.members.Store(q, struct{}{})
+	b.mu.Unlock()
+	return q
+}
+
+// Detach stops broadcasting to q, a queue returned by Attach, and closes it
+// so that its consumer exits after draining the items already delivered. It
+// reports whether q was attached.
+// This method is safe for concurrent use.
+func (b *Broadcaster) Detach(q *ThreadSafeQueue) bool {
+	if _, ok := b.members.LoadAndDelete(q); !ok {
+		return false
+	}
+	// Close first: it releases a Broadcast blocked on q being full, which
+	// would otherwise hold b.mu forever.
+	q.Close()
+	b.mu.Lock()
+	for i, sub := range b.subs {
+		if sub == q {
+			b.subs = append(b.subs[:i], b.subs[i+1:]...)
+			break
+		}
+	}
+	b.mu.Unlock()
+	return true
+}
+
+// Broadcast enqueues item onto every attached queue. Like Enqueue, it panics
+// if the queues refuse the item, as with WithRejectNil or WithElementType.
+// This method is safe for concurrent use.
+func (b *Broadcaster) Broadcast(item interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock() // Enqueue may panic.
+	for _, q := range b.subs {
+		q.Enqueue(item)
+	}
+}
+
+// Subscribers returns the number of attached queues.
+// This method is safe for concurrent use.
+func (b *Broadcaster) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
@@ -0,0 +1,178 @@
+package threadsafequeue
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test that every attached queue receives every broadcast item
+func TestBroadcast(t *testing.T) {
+	b := NewBroadcaster()
+	q1 := b.Attach()
+	q2 := b.Attach()
+
+	b.Broadcast("invalidate")
+
+	for _, q := range []*ThreadSafeQueue{q1, q2} {
+		if item, ok := q.Dequeue(); !ok || item != "invalidate" {
+			t.Errorf("Expected to dequeue invalidate, got %v", item)
+		}
+	}
+
+	late := b.Attach()
+	if !late.IsEmpty() {
+		t.Error("A queue attached after Broadcast should not receive its item")
+	}
+}
+
+// Test that Detach closes the queue and stops delivery
+func TestBroadcastDetach(t *testing.T) {
+	b := NewBroadcaster()
+	q := b.Attach()
+	b.Broadcast(1)
+
+	if !b.Detach(q) {
+		t.Error("Expected Detach to report an attached queue")
+	}
+	if b.Detach(q) {
+		t.Error("Expected a second Detach to report no queue")
+	}
+	if b.Detach(NewThreadSafeQueue()) {
+		t.Error("Expected Detach of a foreign queue to report no queue")
+	}
+
+	b.Broadcast(2)
+	if item, ok := q.Dequeue(); !ok || item != 1 {
+		t.Errorf("Expected to drain 1, got %v", item)
+	}
+	if _, ok := q.Dequeue(); ok {
+		t.Error("Dequeue should fail on a detached queue")
+	}
+	if b.Subscribers() != 0 {
+		t.Errorf("Expected no subscribers, got %d", b.Subscribers())
+	}
+}
+
+// Test that Detach releases a Broadcast blocked on a full subscriber
+func TestBroadcastDetachFullSubscriber(t *testing.T) {
+	b := NewBroadcaster(WithCapacity(1))
+	q := b.Attach()
+	b.Broadcast(1)
+
+	done := make(chan bool)
+	go func() {
+		b.Broadcast(2) // Blocks: q is full.
+		done <- true
+	}()
+
+	// Allow some time for Broadcast to block
+	time.Sleep(100 * time.Millisecond)
+	b.Detach(q)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Detach did not release a blocked Broadcast")
+	}
+}
+
+// Test attach/detach churn while broadcasting 100k items
+func TestBroadcastChurn(t *testing.T) {
+	b := NewBroadcaster()
+	const count = 100000
+	const stable = 4
+
+	var consumers sync.WaitGroup
+	check := func(q *ThreadSafeQueue, full bool) {
+		defer consumers.Done()
+		next := -1
+		received := 0
+		for {
+			item, ok := q.Dequeue()
+			if !ok {
+				break
+			}
+			n := item.(int)
+			if next >= 0 && n != next {
+				t.Errorf("Expected item %d, got %d", next, n)
+				return
+			}
+			if full && next < 0 && n != 0 {
+				t.Errorf("Expected the first item to be 0, got %d", n)
+				return
+			}
+			next = n + 1
+			received++
+			if full && received == count {
+				return
+			}
+		}
+		if full {
+			t.Errorf("Expected %d items, got %d", count, received)
+		}
+	}
+
+	for i := 0; i < stable; i++ {
+		consumers.Add(1)
+		go check(b.Attach(), true)
+	}
+
+	stop := make(chan struct{})
+	var churn sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		churn.Add(1)
+		go func() {
+			defer churn.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				q := b.Attach()
+				consumers.Add(1)
+				go check(q, false)
+				time.Sleep(time.Millisecond)
+				b.Detach(q)
+			}
+		}()
+	}
+
+	for i := 0; i < count; i++ {
+		b.Broadcast(i)
+	}
+	close(stop)
+	churn.Wait()
+	consumers.Wait()
+}
+
+// Test that a refused item does not leave the broadcaster locked
+func TestBroadcastRefusedItem(t *testing.T) {
+	b := NewBroadcaster(WithRejectNil(true))
+	q := b.Attach()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected Broadcast(nil) to panic")
+			}
+		}()
+		b.Broadcast(nil)
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		b.Broadcast(1)
+		b.Attach()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Broadcast and Attach should not block after a refused item")
+	}
+	if item, ok := q.TryDequeue(); !ok || item != 1 {
+		t.Errorf("Expected to dequeue 1, got %v", item)
+	}
+}
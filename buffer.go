@@ -0,0 +1,223 @@
+package threadsafequeue
+
+// minRingSize is the smallest non-empty backing array a ring allocates.
+const minRingSize = 16
+
+// storage is the backing store of a ThreadSafeQueue: a FIFO that also
+// accepts items at the front. Implementations are not safe for concurrent
+// use; the queue's mutex guards every call.
+type storage interface {
+	len() int                                 // Number of items held.
+	cap() int                                 // Items that fit before the storage must allocate.
+	pushBack(v interface{})                   // Add v at the back.
+	pushFront(v interface{})                  // Add v at the front.
+	popFront() (interface{}, bool)            // Remove and return the front item.
+	front() (interface{}, bool)               // Return the front item.
+	at(i int) interface{}                     // Return the i-th item from the front.
+	appendTo(dst []interface{}) []interface{} // Append the items, front first, to dst.
+	clear()                                   // Remove every item.
+	preallocate(n int)                        // Make room for at least n items.
+	shrink(minSize int) bool                  // Release spare room, keeping at least minSize.
+	compact()                                 // Release all spare room.
+}
+
+// ring is a double-ended FIFO buffer backed by a circular array whose length
+// is always zero or a power of two. Unlike re-slicing a plain slice, removing
+// from the front releases the slot immediately, so neither the backing array
+// nor dead references accumulate in a long-running queue: the array only
+// grows to the largest number of items held at once.
+//
+// A ring is not safe for concurrent use; its owner provides the locking.
+type ring[T any] struct {
+	buf  []T // Circular storage.
+	head int // Index of the front item.
+	n    int // Number of items.
+}
+
+// len returns the number of items in the ring.
+func (r *ring[T]) len() int {
+	return r.n
+}
+
+// cap returns the length of the backing array.
+func (r *ring[T]) cap() int {
+	return len(r.buf)
+}
+
+// pushBack adds v at the back of the ring.
+func (r *ring[T]) pushBack(v T) {
+	if r.n == len(r.buf) {
+		r.grow()
+	}
+	r.buf[(r.head+r.n)&(len(r.buf)-1)] = v
+	r.n++
+}
+
+// pushBackPtr adds *p at the back of the ring, copying it straight into its
+// slot.
+func (r *ring[T]) pushBackPtr(p *T) {
+	if r.n == len(r.buf) {
+		r.grow()
+	}
+	r.buf[(r.head+r.n)&(len(r.buf)-1)] = *p
+	r.n++
+}
+
+// pushFront adds v at the front of the ring.
+func (r *ring[T]) pushFront(v T) {
+	if r.n == len(r.buf) {
+		r.grow()
+	}
+	r.head = (r.head - 1) & (len(r.buf) - 1)
+	r.buf[r.head] = v
+	r.n++
+}
+
+// popFront removes and returns the front item.
+func (r *ring[T]) popFront() (T, bool) {
+	var zero T
+	if r.n == 0 {
+		return zero, false
+	}
+	v := r.buf[r.head]
+	r.buf[r.head] = zero // Drop the reference so the item can be collected.
+	r.head = (r.head + 1) & (len(r.buf) - 1)
+	r.n--
+	return v, true
+}
+
+// popFrontInto moves the front item into *dst and reports whether there was
+// one, copying it only once.
+func (r *ring[T]) popFrontInto(dst *T) bool {
+	if r.n == 0 {
+		return false
+	}
+	var zero T
+	*dst = r.buf[r.head]
+	r.buf[r.head] = zero // Drop the reference so the item can be collected.
+	r.head = (r.head + 1) & (len(r.buf) - 1)
+	r.n--
+	return true
+}
+
+// popBack removes and returns the back item.
+func (r *ring[T]) popBack() (T, bool) {
+	var zero T
+	if r.n == 0 {
+		return zero, false
+	}
+	r.n--
+	i := (r.head + r.n) & (len(r.buf) - 1)
+	v := r.buf[i]
+	r.buf[i] = zero // Drop the reference so the item can be collected.
+	return v, true
+}
+
+// front returns the front item without removing it.
+func (r *ring[T]) front() (T, bool) {
+	if r.n == 0 {
+		var zero T
+		return zero, false
+	}
+	return r.buf[r.head], true
+}
+
+// at returns the i-th item from the front; i must be in [0, len).
+func (r *ring[T]) at(i int) T {
+	return r.buf[(r.head+i)&(len(r.buf)-1)]
+}
+
+// set replaces the i-th item from the front with v; i must be in [0, len).
+func (r *ring[T]) set(i int, v T) {
+	r.buf[(r.head+i)&(len(r.buf)-1)] = v
+}
+
+// appendTo appends the items, front first, to dst and returns the result.
+func (r *ring[T]) appendTo(dst []T) []T {
+	if r.n == 0 {
+		return dst
+	}
+	end := r.head + r.n
+	if end <= len(r.buf) {
+		return append(dst, r.buf[r.head:end]...)
+	}
+	dst = append(dst, r.buf[r.head:]...)
+	return append(dst, r.buf[:end&(len(r.buf)-1)]...)
+}
+
+// clear removes every item, keeping the backing array.
+func (r *ring[T]) clear() {
+	var zero T
+	for i := 0; i < r.n; i++ {
+		r.buf[(r.head+i)&(len(r.buf)-1)] = zero
+	}
+	r.head, r.n = 0, 0
+}
+
+// grow doubles the backing array, unwrapping the items to start at index zero.
+func (r *ring[T]) grow() {
+	size := len(r.buf) * 2
+	if size < minRingSize {
+		size = minRingSize
+	}
+	r.resize(size)
+}
+
+// resize moves the items into a new backing array of the given power-of-two
+// size, which must be at least len.
+func (r *ring[T]) resize(size int) {
+	if size == 0 {
+		r.buf, r.head = nil, 0
+		return
+	}
+	buf := make([]T, size)
+	r.appendTo(buf[:0])
+	r.buf = buf
+	r.head = 0
+}
+
+// preallocate grows the backing array to hold at least n items.
+func (r *ring[T]) preallocate(n int) {
+	if size := nextPowerOfTwo(n); size > len(r.buf) {
+		r.resize(size)
+	}
+}
+
+// compact reallocates the backing array to the smallest power of two that
+// holds the items, releasing it entirely when the ring is empty.
+func (r *ring[T]) compact() {
+	if size := nextPowerOfTwo(r.n); size < len(r.buf) {
+		r.resize(size)
+	}
+}
+
+// shrink reallocates the backing array to the smallest power of two that is
+// at least minSize and twice the number of items, if that is smaller than
+// the current array. It reports whether the array was replaced.
+func (r *ring[T]) shrink(minSize int) bool {
+	size := nextPowerOfTwo(minSize)
+	for size < 2*r.n {
+		size *= 2
+	}
+	if r.n == 0 && minSize <= 0 {
+		size = 0
+	}
+	if size >= len(r.buf) {
+		return false
+	}
+	r.resize(size)
+	return true
+}
+
+// nextPowerOfTwo returns the smallest power of two that is at least n, or
+// zero if n is not positive.
+func nextPowerOfTwo(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	size := 1
+	for size < n {
+		size *= 2
+	}
+	return size
+}
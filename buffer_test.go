@@ -0,0 +1,87 @@
+package threadsafequeue
+
+import "testing"
+
+// Test ring operations at both ends across wrap-around and growth
+func TestRing(t *testing.T) {
+	var r ring[int]
+	if _, ok := r.popFront(); ok {
+		t.Error("popFront on an empty ring should fail")
+	}
+
+	// Wrap the head around the end of the array, then force growth.
+	for i := 0; i < minRingSize-2; i++ {
+		r.pushBack(i)
+	}
+	for i := 0; i < minRingSize-2; i++ {
+		r.popFront()
+	}
+	for i := 0; i < 3*minRingSize; i++ {
+		r.pushBack(i)
+	}
+	r.pushFront(-1)
+
+	if r.len() != 3*minRingSize+1 {
+		t.Fatalf("Expected length %d, got %d", 3*minRingSize+1, r.len())
+	}
+	if r.cap()&(r.cap()-1) != 0 {
+		t.Errorf("Expected a power-of-two capacity, got %d", r.cap())
+	}
+
+	items := r.appendTo(nil)
+	for i, v := range items {
+		if v != i-1 || r.at(i) != v {
+			t.Fatalf("Expected %d at position %d, got %d", i-1, i, v)
+		}
+	}
+
+	if v, _ := r.popBack(); v != 3*minRingSize-1 {
+		t.Errorf("Expected popBack to return %d, got %d", 3*minRingSize-1, v)
+	}
+	if v, _ := r.front(); v != -1 {
+		t.Errorf("Expected front to be -1, got %d", v)
+	}
+
+	r.clear()
+	if r.len() != 0 {
+		t.Errorf("Expected an empty ring after clear, got %d items", r.len())
+	}
+}
+
+// Test that at and set address items from the front across wrap-around
+func TestRingAtAndSet(t *testing.T) {
+	var r ring[int]
+	var want []int
+	for i := 0; i < minRingSize/2; i++ {
+		r.pushBack(i)
+		r.pushFront(-i - 1) // Wraps the head around.
+		want = append([]int{-i - 1}, append(want, i)...)
+	}
+	for i := range want {
+		if v := r.at(i); v != want[i] {
+			t.Fatalf("Expected %d at position %d, got %d", want[i], i, v)
+		}
+		r.set(i, 100+i)
+	}
+	for i, v := range r.appendTo(nil) {
+		if v != 100+i {
+			t.Fatalf("Expected %d at position %d after set, got %d", 100+i, i, v)
+		}
+	}
+}
+
+// Test that popped slots no longer reference their items
+func TestRingReleasesReferences(t *testing.T) {
+	var r ring[*int]
+	for i := 0; i < 4; i++ {
+		v := i
+		r.pushBack(&v)
+	}
+	r.popFront()
+	r.popBack()
+	for i, p := range r.buf {
+		if p != nil && (*p == 0 || *p == 3) {
+			t.Errorf("Slot %d still references a removed item", i)
+		}
+	}
+}
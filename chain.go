@@ -0,0 +1,179 @@
+package threadsafequeue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// StageError describes an item that a pipeline stage failed to process.
+type StageError struct {
+	Item interface{} // The input item.
+	Err  error       // The error returned by the stage function or by the destination queue.
+}
+
+// Error implements the error interface.
+func (e *StageError) Error() string {
+	return fmt.Sprintf("threadsafequeue: stage failed on %v: %v", e.Item, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// StageOption configures a stage started by Chain.
+type StageOption func(*stage)
+
+// WithErrorQueue sends a *StageError for every failed item to q.
+func WithErrorQueue(q *ThreadSafeQueue) StageOption {
+	return func(s *stage) {
+		s.errQueue = q
+	}
+}
+
+// WithErrorHandler calls fn for every failed item. It is called from the
+// worker goroutines, so it must be safe for concurrent use.
+func WithErrorHandler(fn func(item interface{}, err error)) StageOption {
+	return func(s *stage) {
+		s.errHandler = fn
+	}
+}
+
+// HaltOnError stops the stage at the first failed item instead of reporting
+// it and moving on. Wait then returns the *StageError of that item.
+func HaltOnError() StageOption {
+	return func(s *stage) {
+		s.halt = true
+	}
+}
+
+// WithReorderWindow caps how many items ProcessOrdered may have taken from
+// its source but not yet released, which bounds the memory used to buffer
+// results that finished ahead of an earlier, slower item. It has no effect
+// on Chain.
+func WithReorderWindow(n int) StageOption {
+	return func(s *stage) {
+		s.window = n
+	}
+}
+
+// CloseDestination closes the destination queue once the stage has stopped,
+// so that shutdown cascades down a pipeline of chained stages.
+func CloseDestination() StageOption {
+	return func(s *stage) {
+		s.closeDst = true
+	}
+}
+
+// Stage is a running pipeline stage started by Chain.
+type Stage struct {
+	done chan struct{} // Closed once every worker has stopped.
+	err  error         // Why the stage stopped; set before done is closed.
+}
+
+type stage struct {
+	errQueue   *ThreadSafeQueue
+	errHandler func(item interface{}, err error)
+	closeDst   bool
+	halt       bool
+	window     int
+}
+
+// Chain starts a pool of workers that dequeue items from src, apply fn, and
+// enqueue the results onto dst. Enqueueing uses EnqueueContext, so a bounded
+// dst with the Block policy slows the stage down instead of growing without
+// limit.
+//
+// Items for which fn returns an error, or whose result dst rejects, are
+// reported to the error queue and error handler, if configured, and
+// otherwise dropped; with HaltOnError the first failure stops the stage.
+// The stage stops once src is closed and drained, when ctx is done, or when
+// it halts; an item that fails to get through after that, including one
+// whose result dst was still to take, is put back at the front of src, as
+// FanOut does. If CloseDestination is given, dst is closed after the last
+// worker stops, so a chain of stages shuts down in order when the first
+// source is closed.
+func Chain(ctx context.Context, src, dst *ThreadSafeQueue, workers int, fn func(interface{}) (interface{}, error), opts ...StageOption) *Stage {
+	if workers < 1 {
+		workers = 1
+	}
+	cfg := &stage{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	s := &Stage{done: make(chan struct{})}
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	var haltOnce sync.Once
+	var haltErr error
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				item, err := src.DequeueContext(ctx)
+				if err != nil {
+					return
+				}
+				result, err := fn(item)
+				if err == nil {
+					err = dst.EnqueueContext(ctx, result)
+				}
+				if err != nil {
+					if ctx.Err() != nil {
+						src.putBack(item) // Stopped before the item got through.
+						return
+					}
+					cfg.report(item, err)
+					if cfg.halt {
+						haltOnce.Do(func() {
+							haltErr = &StageError{Item: item, Err: err}
+							cancel()
+						})
+						return
+					}
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		cancel()
+		s.err = parent.Err()
+		if haltErr != nil {
+			s.err = haltErr
+		}
+		if cfg.closeDst {
+			dst.Close()
+		}
+		close(s.done)
+	}()
+	return s
+}
+
+// report forwards a failed item to the configured error sinks.
+func (s *stage) report(item interface{}, err error) {
+	if s.errHandler != nil {
+		s.errHandler(item, err)
+	}
+	if s.errQueue != nil {
+		s.errQueue.Enqueue(&StageError{Item: item, Err: err})
+	}
+}
+
+// Done returns a channel that is closed once the stage has stopped and, if
+// requested, the destination queue has been closed.
+func (s *Stage) Done() <-chan struct{} {
+	return s.done
+}
+
+// Wait blocks until the stage has stopped. It returns nil if the source was
+// drained, the context's error if the stage was cancelled, and the
+// *StageError that stopped it under HaltOnError.
+func (s *Stage) Wait() error {
+	<-s.done
+	return s.err
+}
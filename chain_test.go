@@ -0,0 +1,187 @@
+package threadsafequeue
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test that chained stages compose and shut down in order
+func TestChainPipeline(t *testing.T) {
+	ctx := context.Background()
+	raw, doubled, out := NewThreadSafeQueue(), NewThreadSafeQueue(), NewThreadSafeQueue()
+
+	s1 := Chain(ctx, raw, doubled, 4, func(v interface{}) (interface{}, error) {
+		return v.(int) * 2, nil
+	}, CloseDestination())
+	s2 := Chain(ctx, doubled, out, 4, func(v interface{}) (interface{}, error) {
+		return v.(int) + 1, nil
+	}, CloseDestination())
+
+	for i := 0; i < 100; i++ {
+		raw.Enqueue(i)
+	}
+	raw.Close()
+
+	var results []int
+	for {
+		item, ok := out.Dequeue()
+		if !ok {
+			break
+		}
+		results = append(results, item.(int))
+	}
+
+	if err := s1.Wait(); err != nil {
+		t.Errorf("Expected stage 1 to finish cleanly, got %v", err)
+	}
+	if err := s2.Wait(); err != nil {
+		t.Errorf("Expected stage 2 to finish cleanly, got %v", err)
+	}
+
+	sort.Ints(results)
+	if len(results) != 100 {
+		t.Fatalf("Expected 100 results, got %d", len(results))
+	}
+	for i, r := range results {
+		if r != i*2+1 {
+			t.Errorf("Expected %d, got %d", i*2+1, r)
+		}
+	}
+}
+
+// Test that failed items reach the error queue and handler
+func TestChainErrors(t *testing.T) {
+	src, dst, errs := NewThreadSafeQueue(), NewThreadSafeQueue(), NewThreadSafeQueue()
+	errOdd := errors.New("odd")
+	var mu sync.Mutex
+	var handled []interface{}
+
+	s := Chain(context.Background(), src, dst, 2, func(v interface{}) (interface{}, error) {
+		if v.(int)%2 == 1 {
+			return nil, errOdd
+		}
+		return v, nil
+	}, WithErrorQueue(errs), WithErrorHandler(func(item interface{}, err error) {
+		mu.Lock()
+		handled = append(handled, item)
+		mu.Unlock()
+	}))
+
+	for i := 0; i < 10; i++ {
+		src.Enqueue(i)
+	}
+	src.Close()
+	s.Wait()
+
+	if dst.Size() != 5 {
+		t.Errorf("Expected 5 results, got %d", dst.Size())
+	}
+	if len(handled) != 5 {
+		t.Errorf("Expected 5 handled errors, got %d", len(handled))
+	}
+	if errs.Size() != 5 {
+		t.Fatalf("Expected 5 queued errors, got %d", errs.Size())
+	}
+	item, _ := errs.Dequeue()
+	se, ok := item.(*StageError)
+	if !ok || !errors.Is(se, errOdd) || se.Item.(int)%2 != 1 {
+		t.Errorf("Unexpected error item %v", item)
+	}
+}
+
+// Test that a bounded destination applies backpressure to the stage
+func TestChainBackpressure(t *testing.T) {
+	src, dst := NewThreadSafeQueue(), NewThreadSafeQueue(WithCapacity(3))
+	for i := 0; i < 10; i++ {
+		src.Enqueue(i)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := Chain(ctx, src, dst, 1, func(v interface{}) (interface{}, error) { return v, nil })
+
+	// Allow some time for the stage to fill the destination and block
+	time.Sleep(100 * time.Millisecond)
+	if dst.Size() != 3 {
+		t.Errorf("Expected the destination to stop at capacity 3, got %d", dst.Size())
+	}
+	if src.Size() != 6 {
+		t.Errorf("Expected 6 items left in the source, got %d", src.Size())
+	}
+
+	cancel()
+	if err := s.Wait(); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if src.Size() != 7 {
+		t.Errorf("Expected the blocked item back in the source, leaving 7, got %d", src.Size())
+	}
+	if dst.TryEnqueue(nil) != ErrFull {
+		t.Error("Destination should not be closed without CloseDestination")
+	}
+}
+
+// Test that HaltOnError stops the stage at the first failure
+func TestChainHaltOnError(t *testing.T) {
+	src, dst := NewThreadSafeQueue(), NewThreadSafeQueue()
+	errBad := errors.New("bad")
+	for i := 0; i < 100; i++ {
+		src.Enqueue(i)
+	}
+
+	s := Chain(context.Background(), src, dst, 1, func(v interface{}) (interface{}, error) {
+		if v == 10 {
+			return nil, errBad
+		}
+		return v, nil
+	}, HaltOnError(), CloseDestination())
+
+	err := s.Wait()
+	var se *StageError
+	if !errors.As(err, &se) || se.Item != 10 || !errors.Is(err, errBad) {
+		t.Errorf("Expected the stage error for item 10, got %v", err)
+	}
+	if dst.Size() != 10 {
+		t.Errorf("Expected 10 results before the failure, got %d", dst.Size())
+	}
+	if src.Size() != 89 {
+		t.Errorf("Expected 89 items left in the source, got %d", src.Size())
+	}
+}
+
+// Test that HaltOnError puts back the items other workers were holding
+func TestChainHaltOnErrorPutsBack(t *testing.T) {
+	src, dst := NewThreadSafeQueue(), NewThreadSafeQueue(WithCapacity(1))
+	errBad := errors.New("bad")
+	for i := 0; i < 10; i++ {
+		src.Enqueue(i)
+	}
+	dst.Enqueue(-1) // Full, so the other workers block on their results.
+
+	var calls atomic.Int32
+	var others sync.WaitGroup
+	others.Add(3)
+	s := Chain(context.Background(), src, dst, 4, func(v interface{}) (interface{}, error) {
+		if calls.Add(1) <= 3 {
+			others.Done()
+			return v, nil
+		}
+		others.Wait()
+		return nil, errBad
+	}, HaltOnError())
+
+	var se *StageError
+	if err := s.Wait(); !errors.As(err, &se) || !errors.Is(err, errBad) {
+		t.Fatalf("Expected the stage error, got %v", err)
+	}
+	if src.Size() != 9 {
+		t.Errorf("Expected every item but the failed one back in the source, leaving 9, got %d", src.Size())
+	}
+	if dst.Size() != 1 {
+		t.Errorf("Expected the destination to hold only its first item, got %d", dst.Size())
+	}
+}
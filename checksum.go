@@ -0,0 +1,160 @@
+package threadsafequeue
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// ErrVersion is wrapped by the error returned for a snapshot or write-ahead
+// log written in a newer format than this package reads.
+var ErrVersion = errors.New("threadsafequeue: unsupported format version")
+
+// The files written by Save, StartSnapshots and WithWAL carry a format
+// version after their magic string. The version changes whenever the
+// format does; readers accept every version up to their own, reading older
+// ones through a shim for each, and refuse newer ones with ErrVersion
+// rather than guess at them.
+//
+// Version 1 framed records by their length alone, as a uvarint. Version 2
+// gives the length a fixed size and checksums records with CRC-32C,
+// separately for the part giving the length and for the body, so that a
+// damaged length is caught before it is used and the records after a
+// damaged body can still be found:
+//
+//	record: head, body length (uint32), checksum of both (uint32),
+//	        body, checksum of the body (uint32)
+//
+// The head is the record type in a write-ahead log and empty in a snapshot.
+// Numbers are big-endian.
+const (
+	formatV1      = 1
+	formatV2      = 2
+	formatVersion = formatV2
+
+	checksumLen = 4
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// The causes of a CorruptError for a record that fails its checksums: only
+// one damaged in its body can be skipped.
+var (
+	errChecksum       = errors.New("checksum mismatch")
+	errHeaderChecksum = errors.New("length checksum mismatch")
+)
+
+// CorruptError describes a damaged record of a snapshot or write-ahead log.
+// It wraps ErrCorrupt as well as the cause.
+type CorruptError struct {
+	File   string // Base name of the file, or empty for a stream given to Load.
+	Record int    // Index of the record in the file or stream, from zero.
+	Offset int64  // Offset of the record in the file or stream.
+	Err    error  // What is wrong with the record.
+}
+
+func (e *CorruptError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("%v: record %d at offset %d: %v", ErrCorrupt, e.Record, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("%v: %s: record %d at offset %d: %v", ErrCorrupt, e.File, e.Record, e.Offset, e.Err)
+}
+
+// Unwrap returns ErrCorrupt and the cause.
+func (e *CorruptError) Unwrap() []error {
+	return []error{ErrCorrupt, e.Err}
+}
+
+// checkVersion returns an error for a format version this package does not
+// read. what names the kind of file.
+func checkVersion(v uint16, what string) error {
+	if v == 0 || v > formatVersion {
+		return fmt.Errorf("%w: %s format version %d, newest supported %d", ErrVersion, what, v, formatVersion)
+	}
+	return nil
+}
+
+// appendChecksum appends the checksum of p to b.
+func appendChecksum(b, p []byte) []byte {
+	return binary.BigEndian.AppendUint32(b, crc32.Checksum(p, castagnoli))
+}
+
+// appendRecord appends a record of head and body to b, in the format of
+// version 2.
+func appendRecord(b []byte, head []byte, body []byte) []byte {
+	start := len(b)
+	b = append(b, head...)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(body)))
+	b = appendChecksum(b, b[start:])
+	b = append(b, body...)
+	return appendChecksum(b, body)
+}
+
+// readRecord reads a record written by appendRecord from r, filling head
+// and putting the body in buf. It returns io.EOF if r ends before the
+// record and io.ErrUnexpectedEOF if it ends within it, errHeaderChecksum if
+// the length cannot be trusted, and errChecksum if only the body is damaged,
+// in which case r is left at the next record.
+func readRecord(r io.Reader, head []byte, buf *bytes.Buffer) error {
+	cr := &checksumReader{r: r}
+	if _, err := io.ReadFull(cr, head); err != nil {
+		return err
+	}
+	var b [4]byte
+	if _, err := io.ReadFull(cr, b[:]); err != nil {
+		if err == io.EOF && len(head) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if err := readChecksum(r, cr.sum); err != nil {
+		if err == errChecksum {
+			err = errHeaderChecksum
+		}
+		return err
+	}
+	n := binary.BigEndian.Uint32(b[:])
+	if n > maxFrameLen {
+		return fmt.Errorf("item length %d out of range", n)
+	}
+	buf.Reset()
+	cr.sum = 0
+	if _, err := io.CopyN(buf, cr, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return readChecksum(r, cr.sum)
+}
+
+// checksumReader computes the checksum of the bytes read through it.
+type checksumReader struct {
+	r   io.Reader
+	sum uint32
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.sum = crc32.Update(c.sum, castagnoli, p[:n])
+	return n, err
+}
+
+// readChecksum reads a checksum from r and returns errChecksum if it is not
+// sum.
+func readChecksum(r io.Reader, sum uint32) error {
+	var b [checksumLen]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if binary.BigEndian.Uint32(b[:]) != sum {
+		return errChecksum
+	}
+	return nil
+}
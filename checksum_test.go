@@ -0,0 +1,77 @@
+package threadsafequeue
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Test that records read back as written, and that damage to a body is told
+// apart from damage to a length and leaves the next record readable
+func TestRecords(t *testing.T) {
+	var data []byte
+	for _, body := range []string{"one", "", "three"} {
+		data = appendRecord(data, []byte{walEnqueue}, []byte(body))
+	}
+	read := func(data []byte) []error {
+		var errs []error
+		r := bytes.NewReader(data)
+		head := make([]byte, 1)
+		var buf bytes.Buffer
+		for {
+			err := readRecord(r, head, &buf)
+			if err == io.EOF {
+				return errs
+			}
+			errs = append(errs, err)
+			if err != nil && err != errChecksum {
+				return errs
+			}
+		}
+	}
+	if errs := read(data); len(errs) != 3 || errors.Join(errs...) != nil {
+		t.Fatalf("Expected three intact records, got %v", errs)
+	}
+
+	bad := append([]byte(nil), data...)
+	bad[1+4+4] ^= 1 // The first byte of the first body.
+	if errs := read(bad); len(errs) != 3 || errs[0] != errChecksum || errs[1] != nil || errs[2] != nil {
+		t.Errorf("Expected only the damaged body to fail its checksum, got %v", errs)
+	}
+	bad = append([]byte(nil), data...)
+	bad[2] ^= 0x80 // The length of the first record.
+	if errs := read(bad); len(errs) != 1 || errs[0] != errHeaderChecksum {
+		t.Errorf("Expected a damaged length to fail its checksum, got %v", errs)
+	}
+	if errs := read(data[:len(data)-1]); len(errs) != 3 || errs[2] != io.ErrUnexpectedEOF {
+		t.Errorf("Expected a record cut short to end unexpectedly, got %v", errs)
+	}
+}
+
+// Test that CorruptError wraps ErrCorrupt and its cause and names the record
+func TestCorruptError(t *testing.T) {
+	err := error(&CorruptError{File: "00000000000000000001.wal", Record: 7, Offset: 150, Err: errChecksum})
+	if !errors.Is(err, ErrCorrupt) || !errors.Is(err, errChecksum) {
+		t.Errorf("Expected the error to wrap ErrCorrupt and its cause, got %v", err)
+	}
+	for _, want := range []string{"00000000000000000001.wal", "record 7", "offset 150", "checksum mismatch"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q to mention %q", err, want)
+		}
+	}
+}
+
+// Test that only format versions from 1 to the current one are accepted
+func TestCheckVersion(t *testing.T) {
+	for v := uint16(0); v <= formatVersion+1; v++ {
+		err := checkVersion(v, "snapshot")
+		if ok := v >= formatV1 && v <= formatVersion; ok != (err == nil) {
+			t.Errorf("Expected version %d to be accepted %v, got %v", v, ok, err)
+		}
+		if err != nil && !errors.Is(err, ErrVersion) {
+			t.Errorf("Expected ErrVersion for version %d, got %v", v, err)
+		}
+	}
+}
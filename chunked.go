@@ -0,0 +1,204 @@
+package threadsafequeue
+
+import "sync"
+
+// maxFreeChunks is how many emptied chunks a chunk list keeps for reuse.
+const maxFreeChunks = 4
+
+// WithChunkedStorage backs the queue with a linked list of fixed-size chunks
+// instead of a single ring buffer. Enqueue and Dequeue stay O(1), and because
+// the storage grows and shrinks one chunk at a time, no operation ever copies
+// the whole backlog, which keeps latency flat for queues whose size swings
+// widely. Emptied chunks are kept on a small free list for reuse, and any
+// beyond it go to a sync.Pool that the garbage collector can empty. chunkSize
+// must be positive.
+func WithChunkedStorage(chunkSize int) Option {
+	if chunkSize <= 0 {
+		panic("threadsafequeue: chunk size must be positive")
+	}
+	return func(q *ThreadSafeQueue) {
+		q.items = &chunkList{size: chunkSize}
+	}
+}
+
+// chunk is a fixed-size block of a chunkList.
+type chunk struct {
+	items []interface{}
+	next  *chunk
+}
+
+// chunkList is a storage made of fixed-size chunks linked from front to back.
+// Only the head chunk can have free slots before its first item and only the
+// tail chunk can have free slots after its last item.
+type chunkList struct {
+	size   int       // Items per chunk.
+	head   *chunk    // Chunk holding the front item, or nil when no chunk is in use.
+	tail   *chunk    // Chunk holding the back item.
+	start  int       // Index of the front item in head.
+	end    int       // Index one past the back item in tail.
+	n      int       // Number of items.
+	chunks int       // Number of chunks in use.
+	free   *chunk    // Emptied chunks kept for reuse.
+	nfree  int       // Number of chunks on the free list.
+	pool   sync.Pool // Emptied chunks that did not fit on the free list.
+}
+
+// alloc returns an empty chunk, reusing one from the free list if possible.
+func (l *chunkList) alloc() *chunk {
+	l.chunks++
+	if c := l.free; c != nil {
+		l.free = c.next
+		l.nfree--
+		c.next = nil
+		return c
+	}
+	if c, ok := l.pool.Get().(*chunk); ok {
+		return c
+	}
+	return &chunk{items: make([]interface{}, l.size)}
+}
+
+// release returns an emptied chunk to the free list, or to the pool if the
+// free list is full. The chunk's slots must already be cleared.
+func (l *chunkList) release(c *chunk) {
+	l.chunks--
+	if l.nfree >= maxFreeChunks {
+		c.next = nil
+		l.pool.Put(c)
+		return
+	}
+	c.next = l.free
+	l.free = c
+	l.nfree++
+}
+
+func (l *chunkList) len() int {
+	return l.n
+}
+
+func (l *chunkList) cap() int {
+	return (l.chunks + l.nfree) * l.size
+}
+
+func (l *chunkList) pushBack(v interface{}) {
+	switch {
+	case l.head == nil:
+		l.head = l.alloc()
+		l.tail = l.head
+		l.start, l.end = 0, 0
+	case l.end == l.size:
+		c := l.alloc()
+		l.tail.next = c
+		l.tail = c
+		l.end = 0
+	}
+	l.tail.items[l.end] = v
+	l.end++
+	l.n++
+}
+
+func (l *chunkList) pushFront(v interface{}) {
+	switch {
+	case l.head == nil:
+		l.head = l.alloc()
+		l.tail = l.head
+		l.start, l.end = l.size, l.size
+	case l.start == 0:
+		c := l.alloc()
+		c.next = l.head
+		l.head = c
+		l.start = l.size
+	}
+	l.start--
+	l.head.items[l.start] = v
+	l.n++
+}
+
+func (l *chunkList) popFront() (interface{}, bool) {
+	if l.n == 0 {
+		return nil, false
+	}
+	v := l.head.items[l.start]
+	l.head.items[l.start] = nil // Drop the reference so the item can be collected.
+	l.start++
+	l.n--
+	switch {
+	case l.n == 0:
+		l.release(l.head)
+		l.head, l.tail = nil, nil
+	case l.start == l.size:
+		c := l.head
+		l.head = c.next
+		l.start = 0
+		l.release(c)
+	}
+	return v, true
+}
+
+// at returns the i-th item from the front, walking the chunks before it.
+func (l *chunkList) at(i int) interface{} {
+	c := l.head
+	for i += l.start; i >= l.size; i -= l.size {
+		c = c.next
+	}
+	return c.items[i]
+}
+
+func (l *chunkList) front() (interface{}, bool) {
+	if l.n == 0 {
+		return nil, false
+	}
+	return l.head.items[l.start], true
+}
+
+func (l *chunkList) appendTo(dst []interface{}) []interface{} {
+	for c := l.head; c != nil; c = c.next {
+		lo, hi := 0, l.size
+		if c == l.head {
+			lo = l.start
+		}
+		if c == l.tail {
+			hi = l.end
+		}
+		dst = append(dst, c.items[lo:hi]...)
+	}
+	return dst
+}
+
+func (l *chunkList) clear() {
+	for c := l.head; c != nil; {
+		next := c.next
+		for i := range c.items {
+			c.items[i] = nil
+		}
+		l.release(c)
+		c = next
+	}
+	l.head, l.tail, l.n = nil, nil, 0
+}
+
+// preallocate fills the free list until n items fit, ignoring its usual
+// limit so the chunks are not dropped before they are used.
+func (l *chunkList) preallocate(n int) {
+	for l.cap() < n {
+		l.free = &chunk{items: make([]interface{}, l.size), next: l.free}
+		l.nfree++
+	}
+}
+
+// shrink drops free chunks while at least minSize items still fit.
+func (l *chunkList) shrink(minSize int) bool {
+	shrunk := false
+	for l.free != nil && l.cap()-l.size >= minSize {
+		l.free = l.free.next
+		l.nfree--
+		shrunk = true
+	}
+	return shrunk
+}
+
+// compact drops the free list; chunks in use hold at most one chunk's worth
+// of spare room at each end.
+func (l *chunkList) compact() {
+	l.free, l.nfree = nil, 0
+}
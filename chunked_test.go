@@ -0,0 +1,218 @@
+package threadsafequeue
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that chunked storage keeps FIFO order across chunk boundaries
+func TestChunkedStorageOrder(t *testing.T) {
+	q := NewThreadSafeQueue(WithChunkedStorage(4))
+	for i := 0; i < 10; i++ {
+		q.Enqueue(i)
+	}
+	q.EnqueueFront(-1)
+	q.EnqueueFront(-2)
+
+	want := []interface{}{-2, -1, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	got := q.ToSlice()
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, got)
+		}
+	}
+	for _, w := range want {
+		if item, _ := q.Dequeue(); item != w {
+			t.Fatalf("Expected to dequeue %v, got %v", w, item)
+		}
+	}
+	if !q.IsEmpty() {
+		t.Error("Expected the queue to be empty")
+	}
+}
+
+// Test that emptied chunks are recycled instead of accumulating
+func TestChunkedStorageRecycles(t *testing.T) {
+	q := NewThreadSafeQueue(WithChunkedStorage(8))
+	for round := 0; round < 100; round++ {
+		for i := 0; i < 100; i++ {
+			q.Enqueue(i)
+		}
+		for i := 0; i < 100; i++ {
+			if item, _ := q.Dequeue(); item != i {
+				t.Fatalf("Expected to dequeue %d, got %v", i, item)
+			}
+		}
+	}
+	if c := q.Stats().StorageCapacity; c != maxFreeChunks*8 {
+		t.Errorf("Expected only the free list to remain, got %d slots", c)
+	}
+	if _, after := q.Compact(); after != 0 {
+		t.Errorf("Expected Compact to release the free list, got %d slots", after)
+	}
+}
+
+// Test that at finds every item across chunks, from a front chunk that
+// starts part way
+func TestChunkedStorageAt(t *testing.T) {
+	l := &chunkList{size: 3}
+	var want []interface{}
+	for i := 0; i < 5; i++ {
+		l.pushBack(i)
+		l.pushFront(-i - 1)
+		want = append([]interface{}{-i - 1}, append(want, i)...)
+	}
+	for i := range want {
+		if v := l.at(i); v != want[i] {
+			t.Fatalf("Expected %v at position %d, got %v", want[i], i, v)
+		}
+	}
+}
+
+// Test that chunked storage works with Drain, Peek and preallocation
+func TestChunkedStorageOperations(t *testing.T) {
+	q := NewThreadSafeQueue(WithChunkedStorage(4), WithInitialCapacity(10))
+	if c := q.Stats().StorageCapacity; c != 12 {
+		t.Errorf("Expected 12 preallocated slots, got %d", c)
+	}
+	for i := 0; i < 10; i++ {
+		q.Enqueue(i)
+	}
+	if item, ok := q.Peek(); !ok || item != 0 {
+		t.Errorf("Expected to peek 0, got %v", item)
+	}
+	if items := q.Drain(); len(items) != 10 || items[9] != 9 {
+		t.Errorf("Expected to drain 0..9, got %v", items)
+	}
+	if q.Size() != 0 {
+		t.Errorf("Expected size to be 0, got %d", q.Size())
+	}
+	q.Enqueue("again")
+	if item, _ := q.Dequeue(); item != "again" {
+		t.Errorf("Expected to dequeue again, got %v", item)
+	}
+}
+
+// Test that Dequeue blocks on an empty chunked queue until an item arrives
+func TestChunkedStorageBlocks(t *testing.T) {
+	q := NewThreadSafeQueue(WithChunkedStorage(4))
+	result := make(chan interface{})
+	go func() {
+		item, _ := q.Dequeue()
+		result <- item
+	}()
+	time.Sleep(100 * time.Millisecond)
+	q.Enqueue(42)
+	if item := <-result; item != 42 {
+		t.Errorf("Expected to dequeue 42, got %v", item)
+	}
+}
+
+// Test that WithChunkedStorage rejects a non-positive chunk size
+func TestChunkedStorageInvalidSize(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected WithChunkedStorage(0) to panic")
+		}
+	}()
+	WithChunkedStorage(0)
+}
+
+// sliceStorage is the append-and-reslice backing the queue started out with,
+// kept here as a baseline for the storage benchmarks.
+type sliceStorage struct {
+	items []interface{}
+}
+
+func (s *sliceStorage) len() int                { return len(s.items) }
+func (s *sliceStorage) cap() int                { return cap(s.items) }
+func (s *sliceStorage) pushBack(v interface{})  { s.items = append(s.items, v) }
+func (s *sliceStorage) pushFront(v interface{}) { s.items = append([]interface{}{v}, s.items...) }
+func (s *sliceStorage) popFront() (interface{}, bool) {
+	if len(s.items) == 0 {
+		return nil, false
+	}
+	v := s.items[0]
+	s.items = s.items[1:]
+	return v, true
+}
+func (s *sliceStorage) front() (interface{}, bool) {
+	if len(s.items) == 0 {
+		return nil, false
+	}
+	return s.items[0], true
+}
+func (s *sliceStorage) at(i int) interface{}                     { return s.items[i] }
+func (s *sliceStorage) appendTo(dst []interface{}) []interface{} { return append(dst, s.items...) }
+func (s *sliceStorage) clear()                                   { s.items = nil }
+func (s *sliceStorage) preallocate(n int)                        {}
+func (s *sliceStorage) shrink(minSize int) bool                  { return false }
+func (s *sliceStorage) compact()                                 {}
+
+// Benchmark the storage backings under different workloads
+func BenchmarkStorage(b *testing.B) {
+	backings := []struct {
+		name string
+		new  func() *ThreadSafeQueue
+	}{
+		{"Slice", func() *ThreadSafeQueue {
+			q := NewThreadSafeQueue()
+			q.items = &sliceStorage{}
+			return q
+		}},
+		{"Ring", func() *ThreadSafeQueue { return NewThreadSafeQueue() }},
+		{"Chunked", func() *ThreadSafeQueue { return NewThreadSafeQueue(WithChunkedStorage(256)) }},
+	}
+	var item interface{} = struct{}{}
+	for _, bk := range backings {
+		b.Run("EnqueueHeavy/"+bk.name, func(b *testing.B) {
+			q := bk.new()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				q.Enqueue(item)
+			}
+		})
+		b.Run("DequeueHeavy/"+bk.name, func(b *testing.B) {
+			q := bk.new()
+			for i := 0; i < b.N; i++ {
+				q.Enqueue(item)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				q.Dequeue()
+			}
+		})
+		b.Run("Balanced/"+bk.name, func(b *testing.B) {
+			q := bk.new()
+			for i := 0; i < 1000; i++ {
+				q.Enqueue(item)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				q.Enqueue(item)
+				q.Dequeue()
+			}
+		})
+	}
+}
+
+// Benchmark churn through a chunked queue, which recycles chunks beyond the
+// free list through a pool
+func BenchmarkChunkedChurn(b *testing.B) {
+	q := NewThreadSafeQueue(WithChunkedStorage(64))
+	var item interface{} = struct{}{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 1000; j++ {
+			q.Enqueue(item)
+		}
+		for j := 0; j < 1000; j++ {
+			q.Dequeue()
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package threadsafequeue
+
+import "time"
+
+// Clock is the source of time for a queue's time-based behavior: the sleeps
+// of the WaitSleep strategy, the timers behind WithStuckWaiterHandler,
+// WithIdleCallback and StartSnapshots, and the timestamps of TeeEvents. The default is the
+// system clock; tests may supply a fake, such as queuetest.FakeClock, to
+// control time instead of sleeping.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTimer returns a timer that sends the current time on its channel
+	// after d.
+	NewTimer(d time.Duration) Timer
+	// After is like NewTimer(d).C().
+	After(d time.Duration) <-chan time.Time
+	// AfterFunc returns a timer that calls f after d. Its channel is nil.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a timer created by a Clock, like a time.Timer.
+type Timer interface {
+	// C returns the channel on which the time is sent when the timer fires.
+	C() <-chan time.Time
+	// Stop prevents the timer from firing. It returns false if the timer
+	// already fired or was stopped.
+	Stop() bool
+	// Reset makes the timer fire after d. It returns true if the timer was
+	// pending.
+	Reset(d time.Duration) bool
+}
+
+// WithClock makes the queue take time from c instead of the system clock.
+func WithClock(c Clock) Option {
+	return func(q *ThreadSafeQueue) {
+		q.clock = c
+	}
+}
+
+// systemClock is the Clock backed by package time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) NewTimer(d time.Duration) Timer         { return systemTimer{time.NewTimer(d)} }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return systemTimer{time.AfterFunc(d, f)}
+}
+
+// systemTimer adapts a time.Timer to Timer.
+type systemTimer struct {
+	t *time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time        { return t.t.C }
+func (t systemTimer) Stop() bool                 { return t.t.Stop() }
+func (t systemTimer) Reset(d time.Duration) bool { return t.t.Reset(d) }
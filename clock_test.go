@@ -0,0 +1,80 @@
+package threadsafequeue
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test that the system clock's timers fire, stop and reset like time.Timer
+func TestSystemClock(t *testing.T) {
+	var c Clock = systemClock{}
+	if d := time.Since(c.Now()); d < 0 || d > time.Second {
+		t.Errorf("Expected Now to be the current time, got %v off", d)
+	}
+	select {
+	case <-c.NewTimer(time.Millisecond).C():
+	case <-time.After(time.Second):
+		t.Error("Expected the timer to fire")
+	}
+	<-c.After(time.Millisecond)
+
+	fired := make(chan struct{}, 1)
+	timer := c.AfterFunc(time.Hour, func() { fired <- struct{}{} })
+	if timer.C() != nil {
+		t.Error("Expected an AfterFunc timer to have no channel")
+	}
+	if !timer.Reset(time.Millisecond) {
+		t.Error("Expected Reset to report the timer pending")
+	}
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Error("Expected the reset timer to fire")
+	}
+	if timer.Stop() {
+		t.Error("Expected Stop of a fired timer to return false")
+	}
+}
+
+// Test that queues use the system clock unless given another
+func TestWithClock(t *testing.T) {
+	if _, ok := NewThreadSafeQueue().clock.(systemClock); !ok {
+		t.Error("Expected a new queue to use the system clock")
+	}
+	var q ThreadSafeQueue
+	q.Enqueue(1)
+	if _, ok := q.clock.(systemClock); !ok {
+		t.Error("Expected the zero value to use the system clock")
+	}
+	c := systemClock{}
+	if q := NewThreadSafeQueue(WithClock(c)); q.clock != c {
+		t.Error("Expected WithClock to set the clock")
+	}
+}
+
+// manualClock is a Clock whose Now only moves when a test advances it; its
+// timers are the system's. Tests of unexported state use it, as they cannot
+// use queuetest.FakeClock, which imports the package; tests that need fake
+// timers live in the external test package instead.
+type manualClock struct {
+	systemClock
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newManualClock() *manualClock {
+	return &manualClock{now: time.Unix(1700000000, 0)}
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
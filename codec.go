@@ -0,0 +1,66 @@
+package threadsafequeue
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"io"
+)
+
+// Codec encodes items to, and decodes them from, the files written by Save,
+// StartSnapshots, WithWAL and Export. Each call handles a single item, so a
+// queue is written and read one item at a time, never as a whole, and an
+// error names the item it concerns. JSONCodec and GobCodec are provided;
+// any other format can be plugged in by implementing Codec.
+type Codec interface {
+	// Encode writes item to w.
+	Encode(w io.Writer, item interface{}) error
+	// Decode reads an item written by Encode from r, which holds exactly
+	// the bytes Encode wrote.
+	Decode(r io.Reader) (interface{}, error)
+}
+
+// JSONCodec is a Codec encoding items as JSON. Like ReadNDJSON, it decodes
+// each item into the pointer returned by New, such as new(Order), and
+// returns that pointer; if New is nil, items are decoded into interface{},
+// as maps, slices, strings, float64s, bools or nils.
+type JSONCodec struct {
+	New func() interface{}
+}
+
+// Encode writes item to w as JSON.
+func (c JSONCodec) Encode(w io.Writer, item interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(item)
+}
+
+// Decode reads an item written by Encode from r.
+func (c JSONCodec) Decode(r io.Reader) (interface{}, error) {
+	if c.New == nil {
+		var item interface{}
+		err := json.NewDecoder(r).Decode(&item)
+		return item, err
+	}
+	item := c.New()
+	return item, json.NewDecoder(r).Decode(item)
+}
+
+// GobCodec is a Codec encoding items with encoding/gob. Items are decoded
+// with their own type, which must have been registered with gob.Register,
+// as for GobEncode; gob flattens pointers, so an item stored as *T decodes
+// as T unless *T is the type registered. Each item carries its type
+// description, so GobCodec suits a mix of types better than a compact
+// encoding of one.
+type GobCodec struct{}
+
+// Encode writes item to w with gob.
+func (GobCodec) Encode(w io.Writer, item interface{}) error {
+	return gob.NewEncoder(w).Encode(&item)
+}
+
+// Decode reads an item written by Encode from r.
+func (GobCodec) Decode(r io.Reader) (interface{}, error) {
+	var item interface{}
+	err := gob.NewDecoder(r).Decode(&item)
+	return item, err
+}
@@ -0,0 +1,86 @@
+package threadsafequeue
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// Test that GobCodec round-trips a mix of registered types through Save and Load
+func TestGobCodec(t *testing.T) {
+	q := NewThreadSafeQueue()
+	for i := 0; i < 100; i++ {
+		q.Enqueue(gobItem(i))
+	}
+	var buf bytes.Buffer
+	if err := q.Save(&buf, GobCodec{}); err != nil {
+		t.Fatalf("Expected Save to succeed, got %v", err)
+	}
+	loaded := NewThreadSafeQueue()
+	if err := loaded.Load(&buf, GobCodec{}); err != nil {
+		t.Fatalf("Expected Load to succeed, got %v", err)
+	}
+	if !reflect.DeepEqual(loaded.ToSlice(), q.ToSlice()) {
+		t.Errorf("Expected the items to round-trip, got %v", loaded.ToSlice())
+	}
+
+	type unregistered struct{ A int }
+	q.Enqueue(unregistered{1})
+	if err := q.Save(&bytes.Buffer{}, GobCodec{}); err == nil {
+		t.Error("Expected Save to fail on an unregistered type")
+	}
+}
+
+// Test that JSONCodec decodes into interface{} or into the items New returns
+func TestJSONCodec(t *testing.T) {
+	q := NewThreadSafeQueue()
+	q.EnqueueBatch(gobPoint{1, 2}, gobPoint{3, 4})
+	var buf bytes.Buffer
+	if err := q.Save(&buf, JSONCodec{}); err != nil {
+		t.Fatalf("Expected Save to succeed, got %v", err)
+	}
+	data := buf.Bytes()
+
+	generic := NewThreadSafeQueue()
+	if err := generic.Load(bytes.NewReader(data), JSONCodec{}); err != nil {
+		t.Fatalf("Expected Load to succeed, got %v", err)
+	}
+	if want := []interface{}{map[string]interface{}{"X": 1.0, "Y": 2.0}, map[string]interface{}{"X": 3.0, "Y": 4.0}}; !reflect.DeepEqual(generic.ToSlice(), want) {
+		t.Errorf("Expected %v, got %v", want, generic.ToSlice())
+	}
+
+	typed := NewThreadSafeQueue()
+	codec := JSONCodec{New: func() interface{} { return new(gobPoint) }}
+	if err := typed.Load(bytes.NewReader(data), codec); err != nil {
+		t.Fatalf("Expected Load to succeed, got %v", err)
+	}
+	if want := []interface{}{&gobPoint{1, 2}, &gobPoint{3, 4}}; !reflect.DeepEqual(typed.ToSlice(), want) {
+		t.Errorf("Expected %v, got %v", want, typed.ToSlice())
+	}
+}
+
+// Test that the provided codecs serve the write-ahead log and Import as well
+func TestCodecsWithWALAndImport(t *testing.T) {
+	for _, c := range []struct {
+		codec Codec
+		items []interface{}
+	}{
+		{GobCodec{}, []interface{}{gobPoint{1, 2}, gobPoint{3, 4}}},
+		{JSONCodec{New: func() interface{} { return new(gobPoint) }}, []interface{}{&gobPoint{1, 2}, &gobPoint{3, 4}}},
+	} {
+		dir := t.TempDir()
+		q := NewThreadSafeQueue(WithWAL(dir, c.codec, 1))
+		q.EnqueueBatch(c.items...)
+		q.Dequeue()
+		items, err := RecoverWAL(dir, c.codec)
+		if err != nil || !reflect.DeepEqual(items, c.items[1:]) {
+			t.Errorf("Expected %T to recover %v, got %v and %v", c.codec, c.items[1:], items, err)
+		}
+
+		var buf bytes.Buffer
+		q.Export(&buf, c.codec, nil)
+		if n, err := NewThreadSafeQueue().Import(&buf, c.codec, nil); err != nil || n != 1 {
+			t.Errorf("Expected %T to import 1 item, got %d and %v", c.codec, n, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package threadsafequeue
+
+// WithShrink makes the queue give memory back after a spike. Whenever a
+// Dequeue leaves fewer than storage-capacity/factor items in the queue, the
+// backing array is reallocated to fit the remaining items with room to
+// double, but never below minCap or the size requested with
+// WithInitialCapacity. The check runs inside the Dequeue critical
+// section, so no background goroutine is involved, and the reallocation cost
+// is proportional to the items left, which amortizes against the Dequeues
+// that emptied the array. factor must be greater than one; the default is
+// not to shrink.
+func WithShrink(minCap int, factor float64) Option {
+	if factor <= 1 {
+		panic("threadsafequeue: shrink factor must be greater than one")
+	}
+	return func(q *ThreadSafeQueue) {
+		q.shrinkMin = minCap
+		q.shrinkFactor = factor
+	}
+}
+
+// maybeShrink applies the shrink policy. The caller must hold q.mu.
+func (q *ThreadSafeQueue) maybeShrink() {
+	if q.shrinkFactor == 0 {
+		return
+	}
+	floor := q.shrinkMin
+	if q.initialCap > floor {
+		floor = q.initialCap
+	}
+	if q.items.cap() <= floor {
+		return
+	}
+	if float64(q.items.len()) < float64(q.items.cap())/q.shrinkFactor {
+		q.items.shrink(floor)
+	}
+}
+
+// Compact reallocates the backing storage to the smallest size that holds
+// the items currently queued, independent of any shrink policy, and returns
+// the storage capacity before and after. Items keep their order. Storage
+// already at that size is left untouched; an empty queue releases its
+// storage entirely.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) Compact() (before, after int) {
+	q.lock()
+	defer q.unlock()
+	before = q.items.cap()
+	q.items.compact()
+	return before, q.items.cap()
+}
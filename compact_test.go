@@ -0,0 +1,177 @@
+package threadsafequeue
+
+import "testing"
+
+// Test that the backing storage shrinks after a spike is consumed
+func TestShrinkAfterSpike(t *testing.T) {
+	q := NewThreadSafeQueue(WithShrink(64, 4))
+	const spike = 100000
+	for i := 0; i < spike; i++ {
+		q.Enqueue(i)
+	}
+	peak := q.Stats().StorageCapacity
+	if peak < spike {
+		t.Fatalf("Expected the storage to hold the spike, got %d", peak)
+	}
+
+	for i := 0; i < spike-100; i++ {
+		if item, _ := q.Dequeue(); item != i {
+			t.Fatalf("Expected to dequeue %d, got %v", i, item)
+		}
+	}
+
+	if c := q.Stats().StorageCapacity; c > 256 {
+		t.Errorf("Expected the storage to shrink to at most 256, got %d", c)
+	}
+
+	// The remaining items survive the reallocations in order.
+	for i := spike - 100; i < spike; i++ {
+		if item, _ := q.Dequeue(); item != i {
+			t.Fatalf("Expected to dequeue %d, got %v", i, item)
+		}
+	}
+	if c := q.Stats().StorageCapacity; c != 64 {
+		t.Errorf("Expected the storage to stop at the minimum of 64, got %d", c)
+	}
+}
+
+// Test that an idle queue without the option keeps its storage
+func TestNoShrinkByDefault(t *testing.T) {
+	q := NewThreadSafeQueue()
+	for i := 0; i < 1000; i++ {
+		q.Enqueue(i)
+	}
+	peak := q.Stats().StorageCapacity
+	q.Drain()
+	if c := q.Stats().StorageCapacity; c != peak {
+		t.Errorf("Expected the storage to stay at %d, got %d", peak, c)
+	}
+}
+
+// Test that Drain also applies the shrink policy
+func TestShrinkOnDrain(t *testing.T) {
+	q := NewThreadSafeQueue(WithShrink(0, 2))
+	for i := 0; i < 1000; i++ {
+		q.Enqueue(i)
+	}
+	q.Drain()
+	if c := q.Stats().StorageCapacity; c != 0 {
+		t.Errorf("Expected the storage to be released, got %d", c)
+	}
+	q.Enqueue(1)
+	if item, _ := q.Dequeue(); item != 1 {
+		t.Errorf("Expected to dequeue 1, got %v", item)
+	}
+}
+
+// Test that WithShrink rejects factors that would thrash
+func TestShrinkInvalidFactor(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected WithShrink(0, 1) to panic")
+		}
+	}()
+	WithShrink(0, 1)
+}
+
+// Benchmark the steady-state hot path with the shrink check enabled
+func BenchmarkEnqueueDequeueWithShrink(b *testing.B) {
+	q := NewThreadSafeQueue(WithShrink(64, 4))
+	var item interface{} = struct{}{}
+	for i := 0; i < 100; i++ {
+		q.Enqueue(item)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q.Enqueue(item)
+		q.Dequeue()
+	}
+}
+
+// Benchmark repeated spikes with and without shrinking
+func BenchmarkSpike(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"NoShrink", nil},
+		{"Shrink", []Option{WithShrink(64, 4)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			q := NewThreadSafeQueue(bc.opts...)
+			var item interface{} = struct{}{}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for j := 0; j < 10000; j++ {
+					q.Enqueue(item)
+				}
+				for j := 0; j < 10000; j++ {
+					q.Dequeue()
+				}
+			}
+		})
+	}
+}
+
+// Test that Compact fits the storage to the queued items and keeps their order
+func TestCompact(t *testing.T) {
+	q := NewThreadSafeQueue()
+	for i := 0; i < 10000; i++ {
+		q.Enqueue(i)
+	}
+	// Advance the head so the remaining items wrap around the array.
+	for i := 0; i < 9990; i++ {
+		q.Dequeue()
+	}
+	for i := 10000; i < 10003; i++ {
+		q.Enqueue(i)
+	}
+
+	before, after := q.Compact()
+	if before != 16384 || after != 16 {
+		t.Errorf("Expected Compact to go from 16384 to 16, got %d to %d", before, after)
+	}
+	for i := 9990; i < 10003; i++ {
+		if item, _ := q.Dequeue(); item != i {
+			t.Fatalf("Expected to dequeue %d, got %v", i, item)
+		}
+	}
+
+	if before, after = q.Compact(); before != 16 || after != 0 {
+		t.Errorf("Expected Compact of an empty queue to go from 16 to 0, got %d to %d", before, after)
+	}
+	q.Enqueue(1)
+	if item, _ := q.Dequeue(); item != 1 {
+		t.Errorf("Expected to dequeue 1, got %v", item)
+	}
+}
+
+// Test that Compact is safe alongside producers and consumers
+func TestCompactConcurrent(t *testing.T) {
+	q := NewThreadSafeQueue()
+	const n = 10000
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < n; i++ {
+			q.Enqueue(i)
+		}
+	}()
+	go func() {
+		defer close(done)
+		for i := 0; i < n; i++ {
+			if item, _ := q.Dequeue(); item != i {
+				t.Errorf("Expected to dequeue %d, got %v", i, item)
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+			q.Compact()
+		}
+	}
+}
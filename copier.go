@@ -0,0 +1,34 @@
+package threadsafequeue
+
+// WithCopier makes the queue store copy(item) instead of each enqueued item,
+// so that a producer changing an item after enqueueing it, such as reusing a
+// buffer, cannot change what a consumer later dequeues. The copy is made
+// before the queue's lock is taken, once per item and after any checks set
+// by WithRejectNil or WithElementType.
+//
+// Copying is a per-queue policy that trades an allocation per item for
+// isolation; it is off by default. CopyBytes covers byte slices, and callers
+// supply their own function to deep-copy their structs.
+func WithCopier(copy func(interface{}) interface{}) Option {
+	return func(q *ThreadSafeQueue) {
+		q.copier = copy
+	}
+}
+
+// CopyBytes is a copier for WithCopier that copies []byte items and returns
+// every other item unchanged.
+func CopyBytes(item interface{}) interface{} {
+	if b, ok := item.([]byte); ok && b != nil {
+		return append([]byte(nil), b...)
+	}
+	return item
+}
+
+// copyItem returns what the queue stores for item: its copy if the queue has
+// a copier, or item itself. The caller must not hold q.mu.
+func (q *ThreadSafeQueue) copyItem(item interface{}) interface{} {
+	if q.copier == nil {
+		return item
+	}
+	return q.copier(item)
+}
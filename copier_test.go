@@ -0,0 +1,70 @@
+package threadsafequeue
+
+import (
+	"context"
+	"testing"
+)
+
+// Test that changing an item after enqueueing it does not change what is
+// dequeued when the queue copies items, whichever method enqueued it
+func TestCopierIsolatesItems(t *testing.T) {
+	q := NewThreadSafeQueue(WithCopier(CopyBytes))
+	buf := []byte("aaa")
+	q.Enqueue(buf)
+	copy(buf, "bbb")
+	q.EnqueueBatch(buf, buf)
+	copy(buf, "ccc")
+	q.TryEnqueue(buf)
+	copy(buf, "ddd")
+	q.EnqueueContext(context.Background(), buf)
+	copy(buf, "eee")
+	q.EnqueueFront(buf)
+	copy(buf, "fff")
+
+	for _, want := range []string{"eee", "aaa", "bbb", "bbb", "ccc", "ddd"} {
+		item, _ := q.Dequeue()
+		if got := string(item.([]byte)); got != want {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+	}
+}
+
+// Test that without a copier the queue stores the producer's item itself
+func TestNoCopierSharesItems(t *testing.T) {
+	q := NewThreadSafeQueue()
+	buf := []byte("aaa")
+	q.Enqueue(buf)
+	copy(buf, "bbb")
+	if item, _ := q.Dequeue(); string(item.([]byte)) != "bbb" {
+		t.Errorf("Expected the dequeued item to share the producer's buffer, got %q", item)
+	}
+}
+
+// Test that a custom copier deep-copies a struct and that CopyBytes leaves
+// other items alone
+func TestCustomCopier(t *testing.T) {
+	type order struct {
+		ID    int
+		Lines []string
+	}
+	q := NewThreadSafeQueue(WithCopier(func(item interface{}) interface{} {
+		o := *item.(*order)
+		o.Lines = append([]string(nil), o.Lines...)
+		return &o
+	}))
+	o := &order{ID: 1, Lines: []string{"apple"}}
+	q.Enqueue(o)
+	o.ID = 2
+	o.Lines[0] = "pear"
+	item, _ := q.Dequeue()
+	if got := item.(*order); got.ID != 1 || got.Lines[0] != "apple" {
+		t.Errorf("Expected the order as enqueued, got %+v", got)
+	}
+
+	if got := CopyBytes("abc"); got != "abc" {
+		t.Errorf("Expected CopyBytes to return a string unchanged, got %v", got)
+	}
+	if got := CopyBytes([]byte(nil)).([]byte); got != nil {
+		t.Errorf("Expected CopyBytes to keep a nil slice nil, got %v", got)
+	}
+}
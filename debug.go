@@ -0,0 +1,273 @@
+package threadsafequeue
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+)
+
+// debugChecksDefault turns on WithDebugChecks for every queue created by
+// NewThreadSafeQueue. The tests set it to run in debug mode.
+var debugChecksDefault atomic.Bool
+
+// WithDebugChecks makes the queue verify its internal invariants at the end
+// of every operation that takes its lock exclusively, and panic with a dump
+// of its state as soon as one is broken: the size counter and the totals of
+// Stats against the items, the indices of the storage, the wait lists, and
+// the agreement between waiters and the queue's contents. The checks walk
+// the whole queue and are meant for tests and for chasing a suspected bug;
+// with them off, the cost is one boolean test per operation.
+func WithDebugChecks(on bool) Option {
+	return func(q *ThreadSafeQueue) {
+		q.debug = on
+	}
+}
+
+// checkInvariants panics with a state dump if the queue is inconsistent. It
+// runs after settle, so every waiter the state allows to proceed has been
+// served. The caller must hold q.mu.
+func (q *ThreadSafeQueue) checkInvariants() {
+	if q.overBound > 0 && q.len() <= q.capacity {
+		q.overBound = 0 // The items put back beyond the capacity are gone.
+	}
+	if err := q.invariantError(); err != nil {
+		panic(fmt.Sprintf("threadsafequeue: broken invariant: %v\n%s", err, q.dumpState()))
+	}
+}
+
+// invariantError returns the first broken invariant found, or nil.
+func (q *ThreadSafeQueue) invariantError() error {
+	n, slots := q.len(), q.items.len()
+	if size := q.size.Load(); size != int64(n) {
+		return fmt.Errorf("size counter is %d but the queue holds %d items", size, n)
+	}
+	if c, ok := q.items.(interface{ check() error }); ok {
+		if err := c.check(); err != nil {
+			return fmt.Errorf("storage: %v", err)
+		}
+	}
+	if in, out := q.enqueued, q.dequeued+q.dropped; in-out != uint64(n) {
+		return fmt.Errorf("%d items enqueued and %d dequeued or dropped, but %d held", in, out, n)
+	}
+	if n > q.highWater {
+		return fmt.Errorf("%d items held above the high-water mark of %d", n, q.highWater)
+	}
+	if q.capacity > 0 && n > q.capacity+q.overBound && q.adaptive == nil { // A shrinking adaptive bound may leave more.
+		return fmt.Errorf("%d items exceed the capacity of %d", n, q.capacity)
+	}
+	if n == 0 && len(q.emptyChans) > 0 {
+		return fmt.Errorf("%d NotifyEmpty channels left open on an empty queue", len(q.emptyChans))
+	}
+	if n > 0 && len(q.filledChans) > 0 {
+		return fmt.Errorf("%d NotifyNonEmpty channels left open on a queue of %d items", len(q.filledChans), n)
+	}
+	if q.tags != nil {
+		pending := 0
+		for _, s := range q.tags.byTag {
+			pending += s.Pending
+		}
+		if pending != n {
+			return fmt.Errorf("%d items pending by tag but %d queued", pending, n)
+		}
+	}
+	if q.unfinished < n {
+		return fmt.Errorf("%d unfinished items but %d queued", q.unfinished, n)
+	}
+	if q.unfinished == 0 && len(q.joinChans) > 0 {
+		return fmt.Errorf("%d calls to Join left waiting with no unfinished item", len(q.joinChans))
+	}
+	if q.closed && n == 0 && len(q.watchers) > 0 {
+		return fmt.Errorf("%d WatchSize streams left open on a closed, empty queue", len(q.watchers))
+	}
+	for _, w := range q.sizeWaits {
+		if n >= w.n || q.closed {
+			return fmt.Errorf("WaitForSize(%d) still waiting on a queue of %d items, closed %v", w.n, n, q.closed)
+		}
+	}
+	if q.tracing {
+		if q.tasks.len() != slots {
+			return fmt.Errorf("%d trace tasks for %d slots", q.tasks.len(), slots)
+		}
+		if err := q.tasks.check(); err != nil {
+			return fmt.Errorf("trace tasks: %v", err)
+		}
+	}
+	if q.latency {
+		if q.stamps.len() != slots {
+			return fmt.Errorf("%d enqueue times for %d slots", q.stamps.len(), slots)
+		}
+		if err := q.stamps.check(); err != nil {
+			return fmt.Errorf("enqueue times: %v", err)
+		}
+	}
+	if q.keepsExtras() {
+		if q.extras.len() != slots {
+			return fmt.Errorf("%d extras for %d slots", q.extras.len(), slots)
+		}
+		if err := q.extras.check(); err != nil {
+			return fmt.Errorf("extras: %v", err)
+		}
+		tombs := 0
+		for i := 0; i < slots; i++ {
+			x := q.extras.at(i)
+			if x.canceled {
+				tombs++
+				continue
+			}
+			if t := x.ticket; t != nil && (!t.queued || t.pos-q.extrasBase != i) {
+				return fmt.Errorf("ticket of item %d points at %d", i, t.pos-q.extrasBase)
+			}
+		}
+		if tombs != q.tombs {
+			return fmt.Errorf("%d cancelled slots, counted as %d", tombs, q.tombs)
+		}
+		if slots > 0 && q.extras.at(0).canceled {
+			return fmt.Errorf("the front slot holds a cancelled item")
+		}
+	} else if q.tombs != 0 {
+		return fmt.Errorf("%d cancelled slots without extras", q.tombs)
+	}
+	if err := q.waitq.check(); err != nil {
+		return fmt.Errorf("consumer wait list: %v", err)
+	}
+	if err := q.putq.check(); err != nil {
+		return fmt.Errorf("producer wait list: %v", err)
+	}
+	if q.polling < 0 {
+		return fmt.Errorf("%d polling consumers", q.polling)
+	}
+	if q.waitq.len > 0 && n > 0 {
+		return fmt.Errorf("%d consumers parked while %d items are queued", q.waitq.len, n)
+	}
+	if q.putq.len > 0 && (!q.full() || q.closed) {
+		return fmt.Errorf("%d producers blocked while the queue has room or is closed", q.putq.len)
+	}
+	if q.closed && q.waitq.len > 0 {
+		return fmt.Errorf("%d consumers parked on a closed queue", q.waitq.len)
+	}
+	if h := q.history; h != nil && (h.len > len(h.records) || h.next < 0 || h.next >= len(h.records)) {
+		return fmt.Errorf("history holds %d of %d records, next at %d", h.len, len(h.records), h.next)
+	}
+	return nil
+}
+
+// dumpState describes the queue's internal state for a debug check failure.
+// The caller must hold q.mu.
+func (q *ThreadSafeQueue) dumpState() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\titems: %d (storage capacity %d, size counter %d, cancelled slots %d)\n", q.len(), q.items.cap(), q.size.Load(), q.tombs)
+	fmt.Fprintf(&b, "\tcapacity: %d, overflow: %v, closed: %v, dropped: %d\n", q.capacity, q.overflow, q.closed, q.dropped)
+	fmt.Fprintf(&b, "\tparked consumers: %d, polling consumers: %d, blocked producers: %d\n", q.waitq.len, q.polling, q.putq.len)
+	switch s := q.items.(type) {
+	case *ring[interface{}]:
+		fmt.Fprintf(&b, "\tring: head %d, len %d, buffer %d\n", s.head, s.n, len(s.buf))
+	case *chunkList:
+		fmt.Fprintf(&b, "\tchunks: %d in use, %d free, size %d, start %d, end %d\n", s.chunks, s.nfree, s.size, s.start, s.end)
+	}
+	if q.tracing {
+		fmt.Fprintf(&b, "\ttrace tasks: %d\n", q.tasks.len())
+	}
+	return b.String()
+}
+
+// check returns the first broken invariant of the ring, or nil: the buffer
+// length is zero or a power of two, head and n lie within it, and every
+// slot outside the items holds the zero value, so no removed item stays
+// reachable.
+func (r *ring[T]) check() error {
+	size := len(r.buf)
+	if size&(size-1) != 0 {
+		return fmt.Errorf("ring buffer of %d is not a power of two", size)
+	}
+	if r.n < 0 || r.n > size {
+		return fmt.Errorf("ring holds %d items in a buffer of %d", r.n, size)
+	}
+	if r.head < 0 || (size > 0 && r.head >= size) || (size == 0 && r.head != 0) {
+		return fmt.Errorf("ring head %d is outside a buffer of %d", r.head, size)
+	}
+	for i := r.n; i < size; i++ {
+		slot := (r.head + i) & (size - 1)
+		if !reflect.ValueOf(&r.buf[slot]).Elem().IsZero() {
+			return fmt.Errorf("free ring slot %d still holds an item", slot)
+		}
+	}
+	return nil
+}
+
+// check returns the first broken invariant of the chunk list, or nil: the
+// chunks from head to tail account for the item count and the chunks in
+// use, the indices lie within a chunk, the free list matches its count, and
+// slots outside the items are cleared.
+func (l *chunkList) check() error {
+	if l.head == nil {
+		if l.tail != nil || l.n != 0 || l.chunks != 0 {
+			return fmt.Errorf("no head chunk but tail %v, %d items and %d chunks", l.tail != nil, l.n, l.chunks)
+		}
+	} else {
+		if l.start < 0 || l.start >= l.size || l.end <= 0 || l.end > l.size {
+			return fmt.Errorf("start %d or end %d outside a chunk of %d", l.start, l.end, l.size)
+		}
+		chunks, items := 0, 0
+		var last *chunk
+		for c := l.head; c != nil; c = c.next {
+			chunks++
+			lo, hi := 0, l.size
+			if c == l.head {
+				lo = l.start
+			}
+			if c == l.tail {
+				hi = l.end
+			}
+			if len(c.items) != l.size {
+				return fmt.Errorf("chunk of %d slots in a list of size %d", len(c.items), l.size)
+			}
+			for i, v := range c.items {
+				if (i < lo || i >= hi) && v != nil {
+					return fmt.Errorf("free slot %d of chunk %d still holds an item", i, chunks-1)
+				}
+			}
+			items += hi - lo
+			last = c
+		}
+		if last != l.tail {
+			return fmt.Errorf("tail is not the last chunk")
+		}
+		if chunks != l.chunks || items != l.n {
+			return fmt.Errorf("%d chunks holding %d items, counted as %d and %d", chunks, items, l.chunks, l.n)
+		}
+	}
+	free := 0
+	for c := l.free; c != nil; c = c.next {
+		free++
+	}
+	if free != l.nfree {
+		return fmt.Errorf("%d free chunks, counted as %d", free, l.nfree)
+	}
+	return nil
+}
+
+// check returns the first broken invariant of the wait list, or nil: the
+// links agree in both directions, every waiter is marked as queued, and the
+// length matches.
+func (l *waitList) check() error {
+	n := 0
+	var prev *waiter
+	for w := l.head; w != nil; w = w.next {
+		if w.prev != prev {
+			return fmt.Errorf("waiter %d links back to the wrong waiter", n)
+		}
+		if !w.queued {
+			return fmt.Errorf("waiter %d is listed but not marked queued", n)
+		}
+		prev = w
+		n++
+	}
+	if prev != l.tail {
+		return fmt.Errorf("tail is not the last waiter")
+	}
+	if n != l.len {
+		return fmt.Errorf("%d waiters, counted as %d", n, l.len)
+	}
+	return nil
+}
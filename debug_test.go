@@ -0,0 +1,137 @@
+package threadsafequeue
+
+import (
+	"flag"
+	"os"
+	"strings"
+	"testing"
+)
+
+var debugChecks = flag.Bool("debugchecks", false, "create every queue in the tests with WithDebugChecks(true)")
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	debugChecksDefault.Store(*debugChecks)
+	os.Exit(m.Run())
+}
+
+// Test that the stress tests pass with every queue checking its invariants
+// after each operation. With -debugchecks, every test already does.
+func TestStressWithDebugChecks(t *testing.T) {
+	if *debugChecks {
+		t.Skip("-debugchecks already runs the stress tests in debug mode")
+	}
+	debugChecksDefault.Store(true)
+	defer debugChecksDefault.Store(false)
+	for name, test := range map[string]func(*testing.T){
+		"ConcurrentOperations":         TestConcurrentOperations,
+		"SizeWithConcurrentOperations": TestSizeWithConcurrentOperations,
+		"ContendedBoundedStress":       TestContendedBoundedStress,
+		"WaitListStress":               TestWaitListStress,
+		"ProducerWaitListStress":       TestProducerWaitListStress,
+		"WakeTransitionsRandomized":    TestWakeTransitionsRandomized,
+		"Linearizability":              TestLinearizability,
+	} {
+		t.Run(name, test)
+	}
+}
+
+// Test that debug checks pass through ordinary use of every storage
+func TestDebugChecksPass(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"Ring":       nil,
+		"Chunked":    {WithChunkedStorage(2)},
+		"Tracing":    {WithTracing(true)},
+		"History":    {WithHistory(3)},
+		"Latency":    {WithLatencyTracking(true)},
+		"Propagator": {WithPropagator(testPropagator{})},
+	} {
+		t.Run(name, func(t *testing.T) {
+			q := NewThreadSafeQueue(append(opts, WithCapacity(5), WithOverflowPolicy(DropOldest), WithDebugChecks(true))...)
+			for i := 0; i < 12; i++ {
+				q.Enqueue(i)
+				if i%3 == 0 {
+					q.EnqueueFront(-i)
+				}
+				if i%4 == 0 {
+					q.Dequeue()
+				}
+			}
+			q.Drain()
+			q.Enqueue(1)
+			q.Close()
+			q.Dequeue()
+		})
+	}
+}
+
+// Test that a broken invariant panics with a dump of the queue's state
+func TestDebugChecksPanic(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		corrupt func(q *ThreadSafeQueue)
+		want    string
+	}{
+		{"SizeCounter", nil, func(q *ThreadSafeQueue) { q.size.Add(1) }, "size counter is 3"},
+		{"RingSlot", nil, func(q *ThreadSafeQueue) {
+			r := q.items.(*ring[interface{}])
+			r.buf[(r.head+r.n)&(len(r.buf)-1)] = "leaked"
+		}, "free ring slot"},
+		{"RingHead", nil, func(q *ThreadSafeQueue) { q.items.(*ring[interface{}]).head = -1 }, "ring head -1"},
+		{"Chunks", []Option{WithChunkedStorage(2)}, func(q *ThreadSafeQueue) { q.items.(*chunkList).chunks++ }, "1 chunks holding 2 items, counted as 2 and 2"},
+		{"Capacity", []Option{WithCapacity(2)}, func(q *ThreadSafeQueue) { q.capacity = 1 }, "exceed the capacity of 1"},
+		{"Polling", nil, func(q *ThreadSafeQueue) { q.polling = -1 }, "-1 polling consumers"},
+		{"WaitList", nil, func(q *ThreadSafeQueue) { q.waitq.len = 1 }, "consumer wait list: 0 waiters, counted as 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewThreadSafeQueue(append(tt.opts, WithDebugChecks(true))...)
+			q.Enqueue(1)
+			q.Enqueue(2)
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			tt.corrupt(q)
+			defer func() {
+				msg, _ := recover().(string)
+				if !strings.Contains(msg, tt.want) {
+					t.Errorf("Expected a panic mentioning %q, got %q", tt.want, msg)
+				}
+				if !strings.Contains(msg, "parked consumers:") {
+					t.Errorf("Expected the panic to dump the queue's state, got %q", msg)
+				}
+			}()
+			q.checkInvariants()
+		})
+	}
+}
+
+// Test that operations run the debug checks before releasing the lock
+func TestDebugChecksOnOperation(t *testing.T) {
+	q := NewThreadSafeQueue(WithDebugChecks(true))
+	q.Enqueue(1)
+	q.size.Add(1) // Corrupt the counter.
+	defer func() {
+		msg, _ := recover().(string)
+		if !strings.Contains(msg, "size counter is 3 but the queue holds 2 items") {
+			t.Errorf("Expected Enqueue to panic on the drifted counter, got %q", msg)
+		}
+	}()
+	q.Enqueue(2)
+}
+
+// Test that queues check nothing unless asked to
+func TestDebugChecksOff(t *testing.T) {
+	if *debugChecks {
+		t.Skip("-debugchecks turns the checks on")
+	}
+	q := NewThreadSafeQueue()
+	q.Enqueue(1)
+	q.mu.Lock()
+	q.polling = -1
+	q.mu.Unlock()
+	q.TryDequeue() // Must not panic.
+	if q.debug {
+		t.Error("Expected debug checks to be off by default")
+	}
+}
@@ -0,0 +1,74 @@
+package threadsafequeue
+
+import "time"
+
+// DepthSample is the size of a queue at one moment, kept by
+// WithDepthSampling.
+type DepthSample struct {
+	Time time.Time
+	Size int
+}
+
+// WithDepthSampling makes the queue keep its last samples sizes, taken at
+// least interval apart, so that DepthHistory can show the shape of recent
+// bursts. There is no sampling goroutine: operations on the queue take a
+// sample on their way out once interval has passed since the last one, so an
+// idle queue records nothing until it is used again. Nothing is kept if
+// interval or samples is zero or less; a queue without sampling pays a single
+// branch per operation.
+func WithDepthSampling(interval time.Duration, samples int) Option {
+	return func(q *ThreadSafeQueue) {
+		if interval <= 0 || samples <= 0 {
+			q.depth = nil
+			return
+		}
+		q.depth = &depthSampler{interval: interval, samples: make([]DepthSample, samples)}
+	}
+}
+
+// DepthHistory returns a copy of the samples kept by WithDepthSampling,
+// oldest first, or nil if the queue keeps none.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) DepthHistory() []DepthSample {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	d := q.depth
+	if d == nil {
+		return nil
+	}
+	samples := make([]DepthSample, 0, d.len)
+	start := d.next - d.len
+	if start < 0 {
+		start += len(d.samples)
+	}
+	for i := 0; i < d.len; i++ {
+		samples = append(samples, d.samples[(start+i)%len(d.samples)])
+	}
+	return samples
+}
+
+// depthSampler is the ring behind WithDepthSampling, protected by the
+// queue's lock.
+type depthSampler struct {
+	interval time.Duration
+	samples  []DepthSample
+	next     int       // Index of the slot the next sample goes in.
+	len      int       // Number of samples kept.
+	last     time.Time // When the last sample was taken.
+}
+
+// sampleDepth records the size of the queue if the interval has passed since
+// the last sample. The caller must hold q.mu exclusively.
+func (q *ThreadSafeQueue) sampleDepth() {
+	d := q.depth
+	now := q.clock.Now()
+	if d.len > 0 && now.Sub(d.last) < d.interval {
+		return
+	}
+	d.last = now
+	d.samples[d.next] = DepthSample{Time: now, Size: q.len()}
+	d.next = (d.next + 1) % len(d.samples)
+	if d.len < len(d.samples) {
+		d.len++
+	}
+}
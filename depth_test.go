@@ -0,0 +1,58 @@
+package threadsafequeue
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that depth samples are taken by operations at most once per interval
+// and that the ring keeps the most recent ones
+func TestDepthSampling(t *testing.T) {
+	c := newManualClock()
+	start := c.Now()
+	q := NewThreadSafeQueue(WithDepthSampling(time.Second, 3), WithClock(c))
+	q.Enqueue(1) // Sampled: the first operation always is.
+	q.Enqueue(2)
+	c.advance(500 * time.Millisecond)
+	q.Enqueue(3) // Too soon.
+	c.advance(500 * time.Millisecond)
+	q.Enqueue(4) // Sampled.
+	c.advance(5 * time.Second)
+	q.Dequeue() // Sampled, after a quiet spell.
+	q.Dequeue()
+	c.advance(time.Second)
+	q.Drain() // Sampled, evicting the first sample.
+
+	want := []DepthSample{
+		{start.Add(time.Second), 4},
+		{start.Add(6 * time.Second), 3},
+		{start.Add(7 * time.Second), 0},
+	}
+	got := q.DepthHistory()
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d samples, got %v", len(want), got)
+	}
+	for i := range want {
+		if !got[i].Time.Equal(want[i].Time) || got[i].Size != want[i].Size {
+			t.Errorf("Expected sample %d to be %v, got %v", i, want[i], got[i])
+		}
+	}
+	got[0].Size = -1 // The copy is the caller's.
+	if q.DepthHistory()[0].Size != 4 {
+		t.Error("Expected DepthHistory to return a copy")
+	}
+}
+
+// Test that a queue without depth sampling keeps nothing
+func TestNoDepthSampling(t *testing.T) {
+	for _, q := range []*ThreadSafeQueue{
+		NewThreadSafeQueue(),
+		NewThreadSafeQueue(WithDepthSampling(0, 10)),
+		NewThreadSafeQueue(WithDepthSampling(time.Second, 0)),
+	} {
+		q.Enqueue(1)
+		if h := q.DepthHistory(); h != nil {
+			t.Errorf("Expected no depth history, got %v", h)
+		}
+	}
+}
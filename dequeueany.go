@@ -0,0 +1,47 @@
+package threadsafequeue
+
+import "context"
+
+// DequeueAny blocks until any of the given queues has an item, removes it,
+// and reports the index of the queue it came from. Queues are checked in
+// argument order, so earlier queues take precedence when several have items;
+// this lets a consumer put a control-plane queue ahead of a data-plane one.
+//
+// It returns ctx.Err() when ctx is done and ErrClosed once every queue has
+// been closed and drained; in both cases the index is -1. Concurrent calls
+// over overlapping sets of queues never receive the same item, and a caller
+// is woken whenever an item arrives on any queue it is waiting on.
+func DequeueAny(ctx context.Context, queues ...*ThreadSafeQueue) (index int, item interface{}, err error) {
+	// Register before the first scan, so that an item arriving between a
+	// failed scan and the wait still leaves a token behind.
+	notify := make(chan struct{}, 1)
+	for _, q := range queues {
+		q.addNotifier(notify)
+	}
+	defer func() {
+		for _, q := range queues {
+			q.removeNotifier(notify)
+		}
+	}()
+
+	for {
+		drained := true
+		for i, q := range queues {
+			item, ok, closed := q.poll()
+			if ok {
+				return i, item, nil
+			}
+			if !closed {
+				drained = false
+			}
+		}
+		if drained {
+			return -1, nil, ErrClosed
+		}
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return -1, nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package threadsafequeue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test that DequeueAny reports which queue an item came from
+func TestDequeueAny(t *testing.T) {
+	control, data := NewThreadSafeQueue(), NewThreadSafeQueue()
+	data.Enqueue("row")
+	control.Enqueue("pause")
+
+	// The earlier queue takes precedence.
+	i, item, err := DequeueAny(context.Background(), control, data)
+	if err != nil || i != 0 || item != "pause" {
+		t.Errorf("Expected (0, pause), got (%d, %v, %v)", i, item, err)
+	}
+
+	i, item, err = DequeueAny(context.Background(), control, data)
+	if err != nil || i != 1 || item != "row" {
+		t.Errorf("Expected (1, row), got (%d, %v, %v)", i, item, err)
+	}
+}
+
+// Test that DequeueAny blocks until an item arrives on any queue
+func TestDequeueAnyWaits(t *testing.T) {
+	q0, q1 := NewThreadSafeQueue(), NewThreadSafeQueue()
+	type result struct {
+		index int
+		item  interface{}
+	}
+	done := make(chan result)
+
+	go func() {
+		i, item, _ := DequeueAny(context.Background(), q0, q1)
+		done <- result{i, item}
+	}()
+
+	// Allow some time for DequeueAny to start and block
+	time.Sleep(100 * time.Millisecond)
+	q1.Enqueue(42)
+
+	select {
+	case r := <-done:
+		if r.index != 1 || r.item != 42 {
+			t.Errorf("Expected (1, 42), got (%d, %v)", r.index, r.item)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("DequeueAny was not woken by Enqueue")
+	}
+}
+
+// Test cancellation and close handling
+func TestDequeueAnyCancelAndClose(t *testing.T) {
+	q0, q1 := NewThreadSafeQueue(), NewThreadSafeQueue()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if i, _, err := DequeueAny(ctx, q0, q1); err != context.DeadlineExceeded || i != -1 {
+		t.Errorf("Expected (-1, context.DeadlineExceeded), got (%d, %v)", i, err)
+	}
+
+	q0.Close()
+	q1.Enqueue(1)
+	q1.Close()
+	if i, item, err := DequeueAny(context.Background(), q0, q1); err != nil || i != 1 || item != 1 {
+		t.Errorf("Expected to drain (1, 1), got (%d, %v, %v)", i, item, err)
+	}
+	if _, _, err := DequeueAny(context.Background(), q0, q1); err != ErrClosed {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+
+	if len(q0.notifiers) != 0 || len(q1.notifiers) != 0 {
+		t.Error("DequeueAny left notifiers registered")
+	}
+}
+
+// Test that concurrent callers over overlapping queues never share an item
+// and are never left asleep while items are available
+func TestDequeueAnyConcurrent(t *testing.T) {
+	queues := []*ThreadSafeQueue{NewThreadSafeQueue(), NewThreadSafeQueue(), NewThreadSafeQueue()}
+	const perQueue = 2000
+	const total = perQueue * 3
+	seen := make([]int32, total)
+	var received int64
+	var wg sync.WaitGroup
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Each consumer watches a different pair of queues.
+	for c := 0; c < 6; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			set := []*ThreadSafeQueue{queues[c%3], queues[(c+1)%3]}
+			for {
+				_, item, err := DequeueAny(ctx, set...)
+				if err != nil {
+					return
+				}
+				atomic.AddInt32(&seen[item.(int)], 1)
+				if atomic.AddInt64(&received, 1) == total {
+					cancel()
+				}
+			}
+		}(c)
+	}
+
+	for i := 0; i < perQueue; i++ {
+		for j, q := range queues {
+			q.Enqueue(j*perQueue + i)
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Consumers stalled with %d of %d items received", atomic.LoadInt64(&received), total)
+	}
+	wg.Wait()
+
+	for i, n := range seen {
+		if n != 1 {
+			t.Fatalf("Item %d was received %d times", i, n)
+		}
+	}
+}
@@ -2,20 +2,23 @@ package main
 
 import (
 	"fmt"
-	"time"
 
 	queue "github.com/sandeepkv93/threadsafequeue"
 )
 
-func producer(q *queue.ThreadSafeQueue) {
+func producer(q queue.Queue) {
 	for i := 0; i < 10; i++ {
 		q.Enqueue(i)
 	}
+	q.Close() // Lets the consumer finish once it has taken every item
 }
 
-func consumer(q *queue.ThreadSafeQueue) {
-	for i := 0; i < 10; i++ {
-		item, _ := q.Dequeue()
+func consumer(q queue.Queue) {
+	for {
+		item, ok := q.Dequeue()
+		if !ok {
+			return
+		}
 		fmt.Println("Consumed:", item)
 	}
 }
@@ -24,7 +27,5 @@ func main() {
 	q := queue.NewThreadSafeQueue()
 
 	go producer(q)
-	go consumer(q)
-
-	time.Sleep(time.Second) // Allow time for producer and consumer to complete
+	consumer(q)
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime/trace"
+	"sync"
+	"time"
+
+	queue "github.com/sandeepkv93/threadsafequeue"
+)
+
+// Run this example, then open the trace with `go tool trace trace.out`. The
+// "User-defined tasks" view shows how long each item spent in the queue and
+// the "User-defined regions" view shows the Enqueue, Dequeue and wait regions.
+func main() {
+	f, err := os.Create("trace.out")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := trace.Start(f); err != nil {
+		log.Fatal(err)
+	}
+	defer trace.Stop()
+
+	q := queue.NewThreadSafeQueue(queue.WithCapacity(4), queue.WithTracing(true))
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			item, ok := q.Dequeue()
+			if !ok {
+				return
+			}
+			// Simulate a slow consumer so items wait in the queue
+			time.Sleep(10 * time.Millisecond)
+			fmt.Println("Dequeued", item)
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		q.Enqueue(i)
+	}
+	q.Close()
+	wg.Wait()
+
+	fmt.Println("Wrote trace.out")
+}
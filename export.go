@@ -0,0 +1,79 @@
+package threadsafequeue
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Export writes the items in the queue for which filter returns true to w,
+// in FIFO order and in the format of Save, encoding each with codec, and
+// returns the number written. A nil filter exports every item. Like Save,
+// it copies the list of items in a single critical section and encodes
+// them without holding the lock, one at a time, so a large queue is
+// streamed out as a consistent snapshot without stalling producers and
+// consumers; filter is called first, for every item, also without the
+// lock. The queue is not modified. If an item cannot be encoded, Export
+// returns zero and the error, which gives the item's position among those
+// exported.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) Export(w io.Writer, codec Codec, filter func(item interface{}) bool) (int, error) {
+	items := q.ToSlice()
+	if filter != nil {
+		kept := items[:0]
+		for _, item := range items {
+			if filter(item) {
+				kept = append(kept, item)
+			}
+		}
+		clear(items[len(kept):])
+		items = kept
+	}
+	if err := save(w, items, codec); err != nil {
+		return 0, err
+	}
+	return len(items), nil
+}
+
+// Import is ImportContext without a context.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) Import(r io.Reader, codec Codec, transform func(item interface{}) (interface{}, bool)) (int, error) {
+	return q.ImportContext(context.Background(), r, codec, transform)
+}
+
+// ImportContext reads items written by Export or Save from r, decoding each
+// with codec, and enqueues them in the order read, as EnqueueContext would,
+// returning the number enqueued. Before an item is enqueued it is passed to
+// transform, which returns the item to enqueue, changed or not, and false
+// to leave it out; a nil transform enqueues every item as decoded.
+//
+// Unlike Load, ImportContext streams: each item is enqueued as soon as it is
+// read, so a dump larger than memory can be moved into a queue drained as it
+// fills. A full bounded queue blocks ImportContext until there is room, and
+// items dropped by the DropNewest policy or shed by WithLoadShedding are
+// counted as enqueued. ImportContext stops at the first item it cannot read,
+// that the queue refuses, or that finds ctx done, whether blocked or not, and
+// returns the error with the items before it already enqueued: one wrapping
+// ErrClosed once the queue is closed, the context's error on cancellation,
+// and one wrapping ErrCorrupt, as described for Load, for a damaged stream.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) ImportContext(ctx context.Context, r io.Reader, codec Codec, transform func(item interface{}) (interface{}, bool)) (int, error) {
+	n := 0
+	_, err := readSnapshot(r, "", codec, false, func(i int, item interface{}) error {
+		if transform != nil {
+			var keep bool
+			if item, keep = transform(item); !keep {
+				return nil
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := q.EnqueueContext(ctx, item); err != nil && err != ErrFull && err != ErrShed {
+			return fmt.Errorf("threadsafequeue: item %d: %w", i, err)
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
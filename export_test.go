@@ -0,0 +1,136 @@
+package threadsafequeue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Test that Export writes the items filter keeps and Import enqueues them
+// through transform, in order
+func TestExportImport(t *testing.T) {
+	q := NewThreadSafeQueue()
+	for i := 0; i < 10; i++ {
+		q.Enqueue(i)
+	}
+	var buf bytes.Buffer
+	n, err := q.Export(&buf, &intCodec{}, func(item interface{}) bool { return item.(int)%2 == 0 })
+	if err != nil || n != 5 {
+		t.Fatalf("Expected 5 items exported, got %d and %v", n, err)
+	}
+	if q.Size() != 10 {
+		t.Errorf("Expected Export to leave the queue unchanged, got %d items", q.Size())
+	}
+
+	dst := NewThreadSafeQueue()
+	dst.Enqueue(-1)
+	n, err = dst.Import(bytes.NewReader(buf.Bytes()), &intCodec{}, func(item interface{}) (interface{}, bool) {
+		return item.(int) * 10, item != 4
+	})
+	if err != nil || n != 4 {
+		t.Fatalf("Expected 4 items imported, got %d and %v", n, err)
+	}
+	if want := []interface{}{-1, 0, 20, 60, 80}; !reflect.DeepEqual(dst.ToSlice(), want) {
+		t.Errorf("Expected %v, got %v", want, dst.ToSlice())
+	}
+
+	all := NewThreadSafeQueue()
+	if n, err := all.Import(bytes.NewReader(buf.Bytes()), &intCodec{}, nil); err != nil || n != 5 {
+		t.Errorf("Expected a nil transform to import every item, got %d and %v", n, err)
+	}
+}
+
+// Test that Import blocks on a full bounded queue and streams into it as it
+// is drained
+func TestImportBlocks(t *testing.T) {
+	src := NewThreadSafeQueue()
+	for i := 0; i < 100; i++ {
+		src.Enqueue(i)
+	}
+	var buf bytes.Buffer
+	src.Export(&buf, &intCodec{}, nil)
+
+	q := NewThreadSafeQueue(WithCapacity(3))
+	done := make(chan error)
+	go func() {
+		_, err := q.Import(&buf, &intCodec{}, nil)
+		done <- err
+	}()
+	for i := 0; i < 100; i++ {
+		if item, ok := q.Dequeue(); !ok || item != i {
+			t.Fatalf("Expected item %d, got %v", i, item)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Expected the import to finish, got %v", err)
+	}
+}
+
+// Test that ImportContext returns when its context is cancelled, with the
+// items before enqueued
+func TestImportContextCancel(t *testing.T) {
+	src := NewThreadSafeQueue()
+	src.EnqueueBatch(1, 2, 3, 4)
+	var buf bytes.Buffer
+	src.Export(&buf, &intCodec{}, nil)
+
+	q := NewThreadSafeQueue(WithCapacity(2))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	n, err := q.ImportContext(ctx, bytes.NewReader(buf.Bytes()), &intCodec{}, nil)
+	if !errors.Is(err, context.DeadlineExceeded) || n != 2 {
+		t.Errorf("Expected the deadline after 2 items, got %d and %v", n, err)
+	}
+
+	cancel()
+	n, err = NewThreadSafeQueue().ImportContext(ctx, bytes.NewReader(buf.Bytes()), &intCodec{}, nil)
+	if !errors.Is(err, context.DeadlineExceeded) || n != 0 {
+		t.Errorf("Expected a done context to import nothing, got %d and %v", n, err)
+	}
+}
+
+// Test that Import reports a damaged stream and Export an encoding failure
+func TestExportImportErrors(t *testing.T) {
+	q := NewThreadSafeQueue()
+	q.EnqueueBatch(1, 2, 3)
+	var buf bytes.Buffer
+	q.Export(&buf, &intCodec{}, nil)
+	bad := buf.Bytes()
+	bad[len(bad)-1] ^= 1
+
+	dst := NewThreadSafeQueue()
+	n, err := dst.Import(bytes.NewReader(bad), &intCodec{}, nil)
+	var cerr *CorruptError
+	if !errors.As(err, &cerr) || cerr.Record != 2 || n != 2 {
+		t.Errorf("Expected a CorruptError for item 2 after 2 items, got %d and %v", n, err)
+	}
+
+	codec := &intCodec{}
+	codec.fail.Store(true)
+	if n, err := q.Export(&bytes.Buffer{}, codec, nil); err == nil || n != 0 {
+		t.Errorf("Expected Export to fail, got %d and %v", n, err)
+	}
+}
+
+// Test that items shed by the queue are counted as imported and the import
+// carries on
+func TestImportLoadShedding(t *testing.T) {
+	src := NewThreadSafeQueue()
+	for i := 0; i < 20; i++ {
+		src.Enqueue(i)
+	}
+	var buf bytes.Buffer
+	src.Export(&buf, &intCodec{}, nil)
+
+	q := NewThreadSafeQueue(WithCapacity(10), WithLoadShedding(1, 1), WithRand(fixedRand(0)))
+	n, err := q.Import(&buf, &intCodec{}, nil)
+	if err != nil || n != 20 {
+		t.Fatalf("Expected the 20 items imported, got %d and %v", n, err)
+	}
+	if s := q.Stats(); s.Shed == 0 || s.Size+int(s.Shed) != 20 {
+		t.Errorf("Expected the 20 items queued or shed, some shed, got %+v", s)
+	}
+}
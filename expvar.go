@@ -0,0 +1,71 @@
+package threadsafequeue
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+)
+
+// ErrExpvarTaken is returned by PublishExpvar when a variable it would
+// publish already exists and does not belong to the queue.
+var ErrExpvarTaken = errors.New("threadsafequeue: expvar name already published")
+
+var (
+	expvarMu     sync.Mutex
+	expvarQueues = make(map[string]*ThreadSafeQueue) // Queues by the prefix they published under.
+)
+
+// PublishExpvar publishes the queue's statistics through package expvar, as
+// functions evaluated whenever the variables are read, for example on
+// /debug/vars:
+//
+//	prefix.size               Stats().Size
+//	prefix.capacity           Stats().Capacity
+//	prefix.enqueued           Stats().Enqueued
+//	prefix.dequeued           Stats().Dequeued
+//	prefix.dropped            Stats().Dropped
+//	prefix.high_water         Stats().HighWater
+//	prefix.waiting_consumers  Stats().WaitingConsumers
+//
+// expvar variables cannot be removed, so the queue stays reachable from
+// them. Publishing the same queue under the same prefix again does nothing.
+// If any of the names is already taken, by another queue or by anything
+// else, PublishExpvar publishes nothing and returns an error wrapping
+// ErrExpvarTaken, instead of letting expvar panic.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) PublishExpvar(prefix string) error {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+	if published, ok := expvarQueues[prefix]; ok {
+		if published == q {
+			return nil
+		}
+		return fmt.Errorf("%w: %s.size", ErrExpvarTaken, prefix)
+	}
+	vars := []struct {
+		name  string
+		value func(Stats) interface{}
+	}{
+		{"size", func(s Stats) interface{} { return s.Size }},
+		{"capacity", func(s Stats) interface{} { return s.Capacity }},
+		{"enqueued", func(s Stats) interface{} { return s.Enqueued }},
+		{"dequeued", func(s Stats) interface{} { return s.Dequeued }},
+		{"dropped", func(s Stats) interface{} { return s.Dropped }},
+		{"high_water", func(s Stats) interface{} { return s.HighWater }},
+		{"waiting_consumers", func(s Stats) interface{} { return s.WaitingConsumers }},
+	}
+	for _, v := range vars {
+		if expvar.Get(prefix+"."+v.name) != nil {
+			return fmt.Errorf("%w: %s.%s", ErrExpvarTaken, prefix, v.name)
+		}
+	}
+	for _, v := range vars {
+		value := v.value
+		expvar.Publish(prefix+"."+v.name, expvar.Func(func() interface{} {
+			return value(q.Stats())
+		}))
+	}
+	expvarQueues[prefix] = q
+	return nil
+}
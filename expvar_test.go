@@ -0,0 +1,72 @@
+package threadsafequeue
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+// expvarRuns makes the prefixes of each test run unique, since expvar
+// variables outlive the run.
+var expvarRuns atomic.Int64
+
+func expvarPrefix(name string) string {
+	return fmt.Sprintf("%s%d", name, expvarRuns.Add(1))
+}
+
+// Test that PublishExpvar publishes the queue's statistics as live
+// variables, once per prefix
+func TestPublishExpvar(t *testing.T) {
+	prefix := expvarPrefix("test_publish")
+	q := NewThreadSafeQueue(WithCapacity(10))
+	if err := q.PublishExpvar(prefix); err != nil {
+		t.Fatalf("Expected PublishExpvar to succeed, got %v", err)
+	}
+	q.Enqueue(1)
+	q.Enqueue(2)
+	q.Dequeue()
+
+	want := map[string]string{
+		"size":              "1",
+		"capacity":          "10",
+		"enqueued":          "2",
+		"dequeued":          "1",
+		"dropped":           "0",
+		"high_water":        "2",
+		"waiting_consumers": "0",
+	}
+	for name, value := range want {
+		v := expvar.Get(prefix + "." + name)
+		if v == nil {
+			t.Errorf("Expected %s.%s to be published", prefix, name)
+			continue
+		}
+		if got := v.String(); got != value {
+			t.Errorf("Expected %s.%s to be %s, got %s", prefix, name, value, got)
+		}
+	}
+
+	if err := q.PublishExpvar(prefix); err != nil {
+		t.Errorf("Expected publishing again under the same prefix to do nothing, got %v", err)
+	}
+	err := NewThreadSafeQueue().PublishExpvar(prefix)
+	if !errors.Is(err, ErrExpvarTaken) {
+		t.Errorf("Expected ErrExpvarTaken for another queue under the same prefix, got %v", err)
+	}
+}
+
+// Test that PublishExpvar refuses names taken outside the package, without
+// publishing any
+func TestPublishExpvarTaken(t *testing.T) {
+	prefix := expvarPrefix("test_taken")
+	expvar.NewInt(prefix + ".dropped")
+	err := NewThreadSafeQueue().PublishExpvar(prefix)
+	if !errors.Is(err, ErrExpvarTaken) {
+		t.Fatalf("Expected ErrExpvarTaken, got %v", err)
+	}
+	if expvar.Get(prefix+".size") != nil {
+		t.Error("Expected nothing to be published")
+	}
+}
@@ -0,0 +1,133 @@
+package threadsafequeue
+
+import "time"
+
+// extra is what the queue keeps beside an item: the carrier injected for
+// WithPropagator, the tag counted by WithTagStats, the attributes given to
+// EnqueueWithMeta, and the future and ticket returned by Submit and
+// EnqueueCancelable. It travels with the item from the producer, through
+// the producer wait list, to the storage, and back out to the consumer. The
+// zero value keeps nothing.
+type extra struct {
+	carrier carrier
+	tag     string
+	attrs   map[string]string
+	future  *Future
+	ticket  *Ticket
+	// canceled marks the slot of an item removed by Ticket.Cancel, which
+	// keeps its place until the items ahead of it are gone.
+	canceled bool
+	// enqueuedAt is filled in on the way out, from the stamps kept with
+	// WithLatencyTracking. On the way in, it is the time Requeue keeps for
+	// the item, or zero to stamp it with the current time.
+	enqueuedAt time.Time
+}
+
+// keepsExtras reports whether the queue keeps anything beside its items.
+// Without a propagator, tag statistics or a call to EnqueueWithMeta, Submit
+// or EnqueueCancelable, it keeps nothing and the extras ring stays empty.
+func (q *ThreadSafeQueue) keepsExtras() bool {
+	return q.propagator != nil || q.tags != nil || q.metaOn || q.futuresOn || q.ticketsOn
+}
+
+// startExtras prepares a queue that is about to keep extras, if it did not
+// already, with nothing for the items already queued. The caller must hold
+// q.mu.
+func (q *ThreadSafeQueue) startExtras() {
+	if q.keepsExtras() {
+		return
+	}
+	for i := 0; i < q.items.len(); i++ {
+		q.extras.pushBack(extra{})
+	}
+}
+
+// extraAdded keeps what goes beside item, just stored at the front or the
+// back of the queue. The caller must hold q.mu.
+func (q *ThreadSafeQueue) extraAdded(item interface{}, x extra, front bool) {
+	if !q.keepsExtras() {
+		return
+	}
+	if front {
+		q.extrasBase--
+	}
+	if x.ticket != nil {
+		x.ticket.queued, x.ticket.item = true, item
+		x.ticket.pos = q.extrasBase
+		if !front {
+			x.ticket.pos += q.extras.len()
+		}
+	}
+	if front {
+		q.extras.pushFront(x)
+	} else {
+		q.extras.pushBack(x)
+	}
+}
+
+// extraRemoved drops what was kept beside the item just removed from the
+// front of the queue. The caller must hold q.mu.
+func (q *ThreadSafeQueue) extraRemoved() {
+	if !q.keepsExtras() {
+		return
+	}
+	x, _ := q.extras.popFront()
+	q.extrasBase++
+	q.tagRemoved(x.tag)
+	if x.ticket != nil {
+		x.ticket.queued, x.ticket.item = false, nil
+	}
+}
+
+// extrasCleared drops what was kept beside every item, completing their
+// futures with ErrNoResult, and the slots of cancelled items. The caller
+// must hold q.mu.
+func (q *ThreadSafeQueue) extrasCleared() {
+	if !q.keepsExtras() {
+		return
+	}
+	for i := 0; i < q.extras.len(); i++ {
+		x := q.extras.at(i)
+		if x.canceled {
+			continue // Accounted for by Cancel.
+		}
+		q.tagRemoved(x.tag)
+		x.future.complete(nil, ErrNoResult)
+		if x.ticket != nil {
+			x.ticket.queued, x.ticket.item = false, nil
+		}
+	}
+	q.extras.clear()
+	q.extrasBase = 0
+}
+
+// frontExtra returns what is kept beside the front item, which is about to
+// be removed, with its enqueue time. The caller must hold q.mu.
+func (q *ThreadSafeQueue) frontExtra() extra {
+	var x extra
+	if q.keepsExtras() {
+		x, _ = q.extras.front()
+	}
+	if q.latency {
+		x.enqueuedAt, _ = q.stamps.front()
+	}
+	return x
+}
+
+// dequeueExtra is Dequeue returning also what was kept beside the item.
+func (q *ThreadSafeQueue) dequeueExtra() (interface{}, extra, bool) {
+	r := q.startRegion(traceDequeueRegion)
+	defer endRegion(r)
+	q.lock()
+	item, x, handed := q.awaitItems()
+	if handed {
+		return item, x, true
+	}
+	x = q.frontExtra()
+	item, ok := q.remove()
+	q.unlock()
+	if !ok {
+		return nil, extra{}, false
+	}
+	return item, x, true
+}
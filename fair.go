@@ -0,0 +1,236 @@
+package threadsafequeue
+
+import (
+	"context"
+	"sync"
+)
+
+// FairQueue is a queue that shares its consumers fairly between groups of
+// items, such as the tenants of a shared service, so that a group with a
+// large backlog does not make the others wait behind it as plain FIFO
+// would. Each group has a FIFO of its own, and Dequeue serves the groups
+// that have items in weighted round-robin: a group of weight w gets w items
+// in a row before the next group's turn. Weights default to 1 and are set
+// with WithGroupWeights. A group that runs out of items leaves the rotation,
+// and rejoins at the end when it gets one again, so consumers always take
+// whatever is available.
+//
+// Items of the same group are dequeued in the order they were enqueued;
+// items of different groups in the order the rotation reaches them. Dequeue
+// calls blocked on an empty queue park on the same kind of wait list as
+// ThreadSafeQueue's, and are served in the order they started waiting.
+//
+// FairQueue is deliberately not a ThreadSafeQueue: the options of the latter
+// are built around its single FIFO of items, and a FairQueue keeps one per
+// group. It is unbounded, and so has no capacity or overflow policy, and
+// blocks no producer. It has no clock, since nothing in it is timed, and no
+// Stats, logging, hooks, tracing, persistence or metadata beside its items.
+// Close works as for ThreadSafeQueue. For any of the rest, put a
+// ThreadSafeQueue in front of it, or use one per group.
+type FairQueue struct {
+	mu      sync.Mutex
+	waitq   waitList // Dequeue calls parked on the empty queue, longest-waiting first.
+	groups  map[string]*fairGroup
+	active  []*fairGroup                  // Groups with items, in rotation order.
+	next    int                           // Index in active of the group being served.
+	credit  int                           // Items the group being served may still take in its turn.
+	size    int                           // Number of items in all groups.
+	weights map[string]int                // Set by WithGroupWeights.
+	key     func(item interface{}) string // Set by WithGroupKey.
+	closed  bool                          // Set by Close; no further items are accepted.
+}
+
+// fairGroup is the FIFO of one group of a FairQueue, present while it has
+// items.
+type fairGroup struct {
+	name   string
+	items  ring[interface{}]
+	weight int
+}
+
+// FairOption configures a FairQueue at construction time.
+type FairOption func(*FairQueue)
+
+// WithGroupWeights sets the weights of the groups it names: in each round of
+// the rotation, a group gets as many items in a row as its weight. Groups
+// not named have a weight of 1. It panics if a weight is not positive.
+func WithGroupWeights(weights map[string]int) FairOption {
+	for _, w := range weights {
+		if w <= 0 {
+			panic("threadsafequeue: FairQueue group weights must be positive")
+		}
+	}
+	return func(f *FairQueue) {
+		for group, w := range weights {
+			f.weights[group] = w
+		}
+	}
+}
+
+// WithGroupKey makes Enqueue put every item in the group key(item), as
+// EnqueueGroup does. Without it, Enqueue uses the empty group.
+func WithGroupKey(key func(item interface{}) string) FairOption {
+	return func(f *FairQueue) {
+		f.key = key
+	}
+}
+
+// NewFairQueue creates an empty FairQueue.
+func NewFairQueue(opts ...FairOption) *FairQueue {
+	f := &FairQueue{groups: make(map[string]*fairGroup), weights: make(map[string]int)}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// Enqueue adds an item to the end of its group, chosen by the function given
+// to WithGroupKey, if any, or the empty group. Items enqueued after Close are
+// discarded.
+// This method is safe for concurrent use.
+func (f *FairQueue) Enqueue(item interface{}) {
+	var group string
+	if f.key != nil {
+		group = f.key(item)
+	}
+	f.EnqueueGroup(group, item)
+}
+
+// EnqueueGroup adds an item to the end of group, or hands it to the Dequeue
+// that has waited longest, if any. Items enqueued after Close are discarded.
+// This method is safe for concurrent use.
+func (f *FairQueue) EnqueueGroup(group string, item interface{}) {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return
+	}
+	// Dequeue only parks on an empty queue, and every item serves a parked
+	// Dequeue first, so the queue stays empty while anyone is waiting.
+	if w := handOff(&f.waitq, item); w != nil {
+		f.mu.Unlock()
+		release(w)
+		return
+	}
+	g := f.groups[group]
+	if g == nil {
+		g = &fairGroup{name: group, weight: 1}
+		if w, ok := f.weights[group]; ok {
+			g.weight = w
+		}
+		f.groups[group] = g
+		f.active = append(f.active, g)
+		if len(f.active) == 1 {
+			f.next, f.credit = 0, g.weight
+		}
+	}
+	g.items.pushBack(item)
+	f.size++
+	f.mu.Unlock()
+}
+
+// Dequeue removes and returns the next item in the rotation, blocking while
+// the queue is empty. The boolean value is false only when the queue has
+// been closed and all remaining items have been dequeued.
+// This method is safe for concurrent use.
+func (f *FairQueue) Dequeue() (interface{}, bool) {
+	item, err := f.DequeueContext(context.Background())
+	return item, err == nil
+}
+
+// DequeueContext is like Dequeue but gives up when ctx is done. It returns
+// ctx.Err() on cancellation and ErrClosed once the queue has been closed and
+// drained.
+// This method is safe for concurrent use.
+func (f *FairQueue) DequeueContext(ctx context.Context) (interface{}, error) {
+	f.mu.Lock()
+	if item, ok := f.pop(); ok || f.closed {
+		f.mu.Unlock()
+		if !ok {
+			return nil, ErrClosed
+		}
+		return item, nil
+	}
+	if err := ctx.Err(); err != nil {
+		f.mu.Unlock()
+		return nil, err
+	}
+	return parkOn(ctx, &f.mu, &f.waitq)
+}
+
+// TryDequeue removes and returns the next item in the rotation without
+// blocking. The boolean value is false if the queue is empty.
+// This method is safe for concurrent use.
+func (f *FairQueue) TryDequeue() (interface{}, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.pop()
+}
+
+// pop removes the next item of the group being served and moves the
+// rotation on at the end of its turn. The caller must hold f.mu.
+func (f *FairQueue) pop() (interface{}, bool) {
+	if f.size == 0 {
+		return nil, false
+	}
+	g := f.active[f.next]
+	item, _ := g.items.popFront()
+	f.size--
+	f.credit--
+	if g.items.len() == 0 {
+		// The group leaves the rotation; the one after it takes its place.
+		copy(f.active[f.next:], f.active[f.next+1:])
+		f.active[len(f.active)-1] = nil
+		f.active = f.active[:len(f.active)-1]
+		delete(f.groups, g.name)
+		f.credit = 0
+	} else if f.credit == 0 {
+		f.next++
+	}
+	if f.credit == 0 && len(f.active) > 0 {
+		if f.next >= len(f.active) {
+			f.next = 0
+		}
+		f.credit = f.active[f.next].weight
+	}
+	return item, true
+}
+
+// SizeByGroup returns the number of items in each group that has any.
+// This method is safe for concurrent use.
+func (f *FairQueue) SizeByGroup() map[string]int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sizes := make(map[string]int, len(f.groups))
+	for name, g := range f.groups {
+		sizes[name] = g.items.len()
+	}
+	return sizes
+}
+
+// Close marks the queue as closed. Remaining items can still be dequeued;
+// once they are gone, all blocked and future Dequeue calls return
+// immediately with a false boolean. Items enqueued after Close are
+// discarded.
+// This method is safe for concurrent use.
+func (f *FairQueue) Close() {
+	f.mu.Lock()
+	f.closed = true
+	w := f.waitq.popAll()
+	f.mu.Unlock()
+	release(w) // Every parked Dequeue leaves empty-handed.
+}
+
+// IsEmpty returns true if the queue has no items, and false otherwise.
+// This method is safe for concurrent use.
+func (f *FairQueue) IsEmpty() bool {
+	return f.Size() == 0
+}
+
+// Size returns the number of items in all groups.
+// This method is safe for concurrent use.
+func (f *FairQueue) Size() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.size
+}
@@ -0,0 +1,158 @@
+package threadsafequeue
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test that a small group is served alongside a large backlog instead of
+// behind it
+func TestFairQueueFairness(t *testing.T) {
+	f := NewFairQueue()
+	for i := 0; i < 100000; i++ {
+		f.EnqueueGroup("a", i)
+	}
+	for i := 0; i < 1000; i++ {
+		f.EnqueueGroup("b", "b")
+	}
+	if got, want := f.SizeByGroup(), map[string]int{"a": 100000, "b": 1000}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected sizes %v, but got %v", want, got)
+	}
+	last := 0 // Dequeues until the last item of b.
+	for n := 1; ; n++ {
+		item, ok := f.TryDequeue()
+		if !ok {
+			break
+		}
+		if item == "b" {
+			last = n
+		}
+	}
+	if last == 0 || last > 2000 {
+		t.Errorf("Expected all of b within the first 2000 dequeues, but the last came at %d", last)
+	}
+	if f.Size() != 0 || len(f.SizeByGroup()) != 0 {
+		t.Errorf("Expected an empty queue, but got %d items in %v", f.Size(), f.SizeByGroup())
+	}
+}
+
+// Test that groups take as many items in a row as their weight, and that a
+// group rejoins the rotation when it gets items again
+func TestFairQueueWeights(t *testing.T) {
+	f := NewFairQueue(WithGroupWeights(map[string]int{"a": 3}))
+	for i := 0; i < 6; i++ {
+		f.EnqueueGroup("a", "a"+string(rune('0'+i)))
+	}
+	f.EnqueueGroup("b", "b0")
+	f.EnqueueGroup("b", "b1")
+	var got []string
+	take := func(n int) {
+		for i := 0; i < n; i++ {
+			item, _ := f.TryDequeue()
+			got = append(got, item.(string))
+		}
+	}
+	take(5)
+	f.EnqueueGroup("c", "c0")
+	take(4)
+	want := []string{"a0", "a1", "a2", "b0", "a3", "a4", "a5", "b1", "c0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, but got %v", want, got)
+	}
+}
+
+// Test that concurrent producers and consumers lose nothing and keep each
+// group in order
+func TestFairQueueConcurrent(t *testing.T) {
+	f := NewFairQueue(WithGroupKey(func(item interface{}) string { return strings.SplitN(item.(string), "/", 2)[0] }))
+	const groups, items = 4, 1000
+	var producers sync.WaitGroup
+	for g := 0; g < groups; g++ {
+		producers.Add(1)
+		go func(g int) {
+			defer producers.Done()
+			for i := 0; i < items; i++ {
+				f.Enqueue(string(rune('a'+g)) + "/" + string(rune(i)))
+			}
+		}(g)
+	}
+	results := make(chan []string, 3)
+	for c := 0; c < 3; c++ {
+		go func() {
+			var got []string
+			for item, ok := f.Dequeue(); ok; item, ok = f.Dequeue() {
+				got = append(got, item.(string))
+			}
+			results <- got
+		}()
+	}
+	producers.Wait()
+	f.Close()
+	total := 0
+	for c := 0; c < 3; c++ {
+		last := map[string]rune{}
+		for _, item := range <-results {
+			group, i := item[:1], []rune(item[2:])[0]
+			if prev, ok := last[group]; ok && i <= prev {
+				t.Errorf("Expected group %s in order, but got %d after %d", group, i, prev)
+			}
+			last[group] = i
+			total++
+		}
+	}
+	if total != groups*items {
+		t.Errorf("Expected %d items, but got %d", groups*items, total)
+	}
+}
+
+// Test that DequeueContext gives up on cancellation and reports Close
+func TestFairQueueDequeueContext(t *testing.T) {
+	f := NewFairQueue()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := f.DequeueContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected %v, but got %v", context.DeadlineExceeded, err)
+	}
+	f.Enqueue(1)
+	f.Close()
+	f.Enqueue(2) // Discarded.
+	if item, err := f.DequeueContext(context.Background()); item != 1 || err != nil {
+		t.Errorf("Expected 1 after Close, but got %v and %v", item, err)
+	}
+	if _, err := f.DequeueContext(context.Background()); err != ErrClosed {
+		t.Errorf("Expected %v, but got %v", ErrClosed, err)
+	}
+}
+
+// Test that parked Dequeue calls are served in the order they started
+// waiting
+func TestFairQueueWaitOrder(t *testing.T) {
+	f := NewFairQueue()
+	const consumers = 8
+	type served struct{ consumer, item int }
+	results := make(chan served, consumers)
+
+	for c := 0; c < consumers; c++ {
+		c := c
+		go func() {
+			item, _ := f.Dequeue()
+			results <- served{c, item.(int)}
+		}()
+		awaitListed(t, &f.mu, &f.waitq, c+1)
+	}
+
+	for i := 0; i < consumers; i++ {
+		f.EnqueueGroup(strings.Repeat("g", i%3), i)
+		r := <-results
+		if r.consumer != i || r.item != i {
+			t.Errorf("Expected consumer %d to get item %d, consumer %d got %d", i, i, r.consumer, r.item)
+		}
+	}
+	if !f.IsEmpty() || len(f.SizeByGroup()) != 0 {
+		t.Error("Items handed to parked Dequeue calls should not stay in their groups")
+	}
+}
@@ -0,0 +1,8 @@
+package threadsafequeue_test
+
+import "time"
+
+// epoch is where the FakeClock of each test starts. Tests of time-based
+// features live in this external test package so that they can use
+// queuetest.FakeClock, which imports the package.
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
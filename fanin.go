@@ -0,0 +1,97 @@
+package threadsafequeue
+
+import (
+	"context"
+	"sync"
+)
+
+// FanInGroup tracks the goroutines started by FanInto, one per input
+// channel, that forward items into a queue.
+type FanInGroup struct {
+	done chan struct{} // Closed once every pump has stopped.
+	err  error         // Why the pumps stopped; set before done is closed.
+}
+
+// FanInto starts one goroutine per channel that forwards every item it
+// receives into q, merging the channels in roughly the order items arrive.
+// The pumps use EnqueueContext, so they wait while a bounded queue with the
+// Block policy is full. They stop when their channel is closed, when ctx is
+// done, or when q is closed; an item received while ctx is cancelled during
+// such a wait is lost. An item dropped by the overflow policy or shed by
+// WithLoadShedding is skipped, and the pump carries on.
+//
+// Once every pump has stopped, q is closed if closeWhenDone is true, so its
+// consumers terminate after draining it.
+func FanInto(ctx context.Context, q *ThreadSafeQueue, closeWhenDone bool, chans ...<-chan interface{}) *FanInGroup {
+	g := &FanInGroup{done: make(chan struct{})}
+	var wg sync.WaitGroup
+	for _, ch := range chans {
+		wg.Add(1)
+		go func(ch <-chan interface{}) {
+			defer wg.Done()
+			pump(ctx, q, ch)
+		}(ch)
+	}
+	go func() {
+		wg.Wait()
+		g.err = ctx.Err()
+		if closeWhenDone {
+			q.Close()
+		}
+		close(g.done)
+	}()
+	return g
+}
+
+// FanIn merges the given channels into a new unbounded queue, which is closed
+// once every channel has been closed or ctx is done.
+func FanIn(ctx context.Context, chans ...<-chan interface{}) *ThreadSafeQueue {
+	q := NewThreadSafeQueue()
+	FanInto(ctx, q, true, chans...)
+	return q
+}
+
+// pump forwards items from ch into q until ch is closed, ctx is done, or q is
+// closed.
+func pump(ctx context.Context, q *ThreadSafeQueue, ch <-chan interface{}) {
+	for {
+		select {
+		case item, ok := <-ch:
+			if !ok {
+				return
+			}
+			switch q.EnqueueContext(ctx, item) {
+			case nil, ErrFull, ErrShed:
+				// The overflow policy or load shedding dropped the item.
+			default:
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Done returns a channel that is closed once every pump has stopped and, if
+// requested, the queue has been closed.
+func (g *FanInGroup) Done() <-chan struct{} {
+	return g.done
+}
+
+// Wait blocks until every pump has stopped and returns the same value as Err.
+func (g *FanInGroup) Wait() error {
+	<-g.done
+	return g.err
+}
+
+// Err returns nil while the pumps are running or if they stopped because
+// their channels were closed, and the context's error if they were stopped
+// by cancellation.
+func (g *FanInGroup) Err() error {
+	select {
+	case <-g.done:
+		return g.err
+	default:
+		return nil
+	}
+}
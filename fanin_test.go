@@ -0,0 +1,135 @@
+package threadsafequeue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Test that FanIn merges every channel and closes the queue when they finish
+func TestFanIn(t *testing.T) {
+	a := make(chan interface{})
+	b := make(chan interface{})
+	q := FanIn(context.Background(), a, b)
+
+	go func() {
+		for i := 0; i < 100; i++ {
+			a <- i
+		}
+		close(a)
+	}()
+	go func() {
+		for i := 0; i < 100; i++ {
+			b <- "b"
+		}
+		close(b)
+	}()
+
+	ints, strs := 0, 0
+	for {
+		item, ok := q.Dequeue()
+		if !ok {
+			break
+		}
+		switch v := item.(type) {
+		case int:
+			if v != ints {
+				t.Errorf("Expected %d from channel a, got %d", ints, v)
+			}
+			ints++
+		case string:
+			strs++
+		}
+	}
+
+	if ints != 100 || strs != 100 {
+		t.Errorf("Expected 100 items from each channel, got %d and %d", ints, strs)
+	}
+}
+
+// Test that FanInto stops on cancellation and reports it
+func TestFanIntoCancel(t *testing.T) {
+	q := NewThreadSafeQueue()
+	ch := make(chan interface{})
+	ctx, cancel := context.WithCancel(context.Background())
+	g := FanInto(ctx, q, false, ch)
+
+	ch <- 1
+	if g.Err() != nil {
+		t.Errorf("Expected no error while running, got %v", g.Err())
+	}
+	cancel()
+
+	select {
+	case <-g.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Pumps did not stop after cancellation")
+	}
+
+	if err := g.Wait(); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if q.TryEnqueue(2) != nil {
+		t.Error("Queue should stay open when closeWhenDone is false")
+	}
+	if q.Size() != 2 {
+		t.Errorf("Expected size to be 2, got %d", q.Size())
+	}
+}
+
+// Test that the pumps respect a bounded queue's backpressure
+func TestFanIntoBackpressure(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(2))
+	ch := make(chan interface{}, 10)
+	for i := 0; i < 10; i++ {
+		ch <- i
+	}
+	close(ch)
+
+	g := FanInto(context.Background(), q, true, ch)
+
+	// Allow some time for the pump to fill the queue and block
+	time.Sleep(100 * time.Millisecond)
+	if q.Size() != 2 {
+		t.Errorf("Expected the pump to stop at capacity 2, got %d", q.Size())
+	}
+	if len(ch) != 7 {
+		t.Errorf("Expected 7 items left in the channel, got %d", len(ch))
+	}
+
+	for i := 0; i < 10; i++ {
+		item, ok := q.Dequeue()
+		if !ok || item != i {
+			t.Errorf("Expected to dequeue %d, got %v", i, item)
+		}
+	}
+
+	if err := g.Wait(); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if _, ok := q.Dequeue(); ok {
+		t.Error("Dequeue should fail once the fanned-in queue is closed")
+	}
+}
+
+// Test that a pump carries on past the items load shedding drops
+func TestFanIntoLoadShedding(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(10), WithLoadShedding(1, 1), WithRand(fixedRand(0)))
+	ch := make(chan interface{})
+	g := FanInto(context.Background(), q, true, ch)
+
+	for i := 0; i < 20; i++ {
+		select {
+		case ch <- i:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected the pump to take item %d", i)
+		}
+	}
+	close(ch)
+	if err := g.Wait(); err != nil {
+		t.Errorf("Expected the pump to stop cleanly, got %v", err)
+	}
+	if s := q.Stats(); s.Shed == 0 || s.Size+int(s.Shed) != 20 {
+		t.Errorf("Expected the 20 items queued or shed, some shed, got %+v", s)
+	}
+}
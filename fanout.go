@@ -0,0 +1,132 @@
+package threadsafequeue
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+)
+
+// Strategy decides which output channel FanOut delivers an item to.
+type Strategy interface {
+	// Route returns the index in outs of the output that should receive
+	// item. If that output's buffer is full and spill is true, FanOut hands
+	// the item to the first other output with room instead; otherwise it
+	// waits for the chosen output.
+	Route(item interface{}, outs []chan<- interface{}) (index int, spill bool)
+}
+
+// RoundRobin returns a Strategy that cycles through the outputs in order,
+// spilling over to another output when the next one is full.
+func RoundRobin() Strategy {
+	return &roundRobin{}
+}
+
+type roundRobin struct {
+	next int
+	mu   sync.Mutex
+}
+
+func (r *roundRobin) Route(_ interface{}, outs []chan<- interface{}) (int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := r.next % len(outs)
+	r.next = i + 1
+	return i, true
+}
+
+// LeastPending returns a Strategy that picks the output with the fewest
+// buffered items relative to its capacity. Unbuffered outputs count as full
+// unless a receiver is waiting, so they are picked only when every output is
+// equally loaded.
+func LeastPending() Strategy {
+	return leastPending{}
+}
+
+type leastPending struct{}
+
+func (leastPending) Route(_ interface{}, outs []chan<- interface{}) (int, bool) {
+	best, bestLoad := 0, 2.0
+	for i, ch := range outs {
+		load := 1.0
+		if c := cap(ch); c > 0 {
+			load = float64(len(ch)) / float64(c)
+		}
+		if load < bestLoad {
+			best, bestLoad = i, load
+		}
+	}
+	return best, false
+}
+
+// HashByKey returns a Strategy that sends all items with the same key, as
+// returned by key, to the same output. It never spills over, so per-key
+// ordering is preserved and a full output makes FanOut wait.
+func HashByKey(key func(item interface{}) string) Strategy {
+	return hashByKey(key)
+}
+
+type hashByKey func(item interface{}) string
+
+func (k hashByKey) Route(item interface{}, outs []chan<- interface{}) (int, bool) {
+	return int(hashKey(k(item)) % uint32(len(outs))), false
+}
+
+// hashKey returns the FNV-1a hash of key.
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// FanOut dequeues items from q and distributes them across outs according to
+// strategy, until q is closed and drained (returning nil) or ctx is done
+// (returning ctx.Err()). An item that has been dequeued but not yet
+// delivered when ctx is cancelled is put back at the front of q, so no item
+// is lost: like EnqueueFront, but without waiting for room in a full bounded
+// queue or being discarded by a closed one.
+//
+// FanOut runs in the calling goroutine and does not close the outputs.
+func FanOut(ctx context.Context, q *ThreadSafeQueue, strategy Strategy, outs ...chan<- interface{}) error {
+	if len(outs) == 0 {
+		panic("threadsafequeue: FanOut needs at least one output")
+	}
+	for {
+		item, err := q.DequeueContext(ctx)
+		if err == ErrClosed {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !deliver(ctx, item, strategy, outs) {
+			q.putBack(item)
+			return ctx.Err()
+		}
+	}
+}
+
+// deliver hands item to the output chosen by strategy and reports whether it
+// was delivered before ctx was done.
+func deliver(ctx context.Context, item interface{}, strategy Strategy, outs []chan<- interface{}) bool {
+	i, spill := strategy.Route(item, outs)
+	select {
+	case outs[i] <- item:
+		return true
+	default:
+	}
+	if spill {
+		for j := 1; j < len(outs); j++ {
+			select {
+			case outs[(i+j)%len(outs)] <- item:
+				return true
+			default:
+			}
+		}
+	}
+	select {
+	case outs[i] <- item:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
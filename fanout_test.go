@@ -0,0 +1,179 @@
+package threadsafequeue
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Test that RoundRobin spreads items evenly across the outputs
+func TestFanOutRoundRobin(t *testing.T) {
+	q := NewThreadSafeQueue()
+	outs := []chan interface{}{make(chan interface{}, 10), make(chan interface{}, 10)}
+	for i := 0; i < 6; i++ {
+		q.Enqueue(i)
+	}
+	q.Close()
+
+	if err := FanOut(context.Background(), q, RoundRobin(), outs[0], outs[1]); err != nil {
+		t.Fatalf("Expected FanOut to finish cleanly, got %v", err)
+	}
+
+	if len(outs[0]) != 3 || len(outs[1]) != 3 {
+		t.Errorf("Expected 3 items per output, got %d and %d", len(outs[0]), len(outs[1]))
+	}
+	for _, expected := range []int{0, 2, 4} {
+		if item := <-outs[0]; item != expected {
+			t.Errorf("Expected %d on output 0, got %v", expected, item)
+		}
+	}
+}
+
+// Test that RoundRobin spills over to another output when one is full
+func TestFanOutRoundRobinSpill(t *testing.T) {
+	q := NewThreadSafeQueue()
+	full := make(chan interface{})
+	free := make(chan interface{}, 10)
+	for i := 0; i < 4; i++ {
+		q.Enqueue(i)
+	}
+	q.Close()
+
+	if err := FanOut(context.Background(), q, RoundRobin(), full, free); err != nil {
+		t.Fatalf("Expected FanOut to finish cleanly, got %v", err)
+	}
+	if len(free) != 4 {
+		t.Errorf("Expected every item on the free output, got %d", len(free))
+	}
+}
+
+// Test that LeastPending prefers the emptiest output
+func TestFanOutLeastPending(t *testing.T) {
+	busy := make(chan interface{}, 4)
+	idle := make(chan interface{}, 4)
+	busy <- "x"
+	busy <- "x"
+
+	outs := []chan<- interface{}{busy, idle}
+	if i, _ := LeastPending().Route(nil, outs); i != 1 {
+		t.Errorf("Expected the idle output, got %d", i)
+	}
+
+	q := NewThreadSafeQueue()
+	for i := 0; i < 4; i++ {
+		q.Enqueue(i)
+	}
+	q.Close()
+	FanOut(context.Background(), q, LeastPending(), outs...)
+
+	if len(busy) != 3 || len(idle) != 3 {
+		t.Errorf("Expected loads to even out at 3 and 3, got %d and %d", len(busy), len(idle))
+	}
+}
+
+// Test that HashByKey keeps each key on a single output in order
+func TestFanOutHashByKey(t *testing.T) {
+	q := NewThreadSafeQueue()
+	outs := []chan interface{}{make(chan interface{}, 100), make(chan interface{}, 100), make(chan interface{}, 100)}
+	for i := 0; i < 30; i++ {
+		q.Enqueue(fmt.Sprintf("k%d:%d", i%5, i))
+	}
+	q.Close()
+
+	key := func(item interface{}) string { return item.(string)[:2] }
+	FanOut(context.Background(), q, HashByKey(key), outs[0], outs[1], outs[2])
+
+	owner := map[string]int{}
+	last := map[string]int{}
+	for i, out := range outs {
+		close(out)
+		for item := range out {
+			var k string
+			var n int
+			fmt.Sscanf(item.(string), "k%1s:%d", &k, &n)
+			if o, ok := owner[k]; ok && o != i {
+				t.Errorf("Key %s was sent to outputs %d and %d", k, o, i)
+			}
+			owner[k] = i
+			if l, ok := last[k]; ok && n <= l {
+				t.Errorf("Key %s lost its order: %d after %d", k, n, l)
+			}
+			last[k] = n
+		}
+	}
+	if len(owner) != 5 {
+		t.Errorf("Expected 5 keys, got %d", len(owner))
+	}
+}
+
+// Test that cancellation returns an undelivered item to the front of the queue
+func TestFanOutCancelRequeues(t *testing.T) {
+	q := NewThreadSafeQueue()
+	q.Enqueue("first")
+	q.Enqueue("second")
+	blocked := make(chan interface{}) // Nobody receives.
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- FanOut(ctx, q, RoundRobin(), blocked)
+	}()
+
+	// Allow some time for FanOut to dequeue "first" and block delivering it
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("FanOut did not stop after cancellation")
+	}
+
+	if item, _ := q.TryDequeue(); item != "first" {
+		t.Errorf("Expected the undelivered item back at the front, got %v", item)
+	}
+	if q.Size() != 1 {
+		t.Errorf("Expected size to be 1, got %d", q.Size())
+	}
+}
+
+// Test that an undelivered item goes back into a queue that is full or closed
+func TestFanOutCancelRequeuesFullOrClosed(t *testing.T) {
+	for _, closeQueue := range []bool{false, true} {
+		q := NewThreadSafeQueue(WithCapacity(1), WithDebugChecks(true))
+		q.Enqueue("first")
+		blocked := make(chan interface{}) // Nobody receives.
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- FanOut(ctx, q, RoundRobin(), blocked)
+		}()
+
+		for !q.IsEmpty() { // Wait for FanOut to take "first".
+			time.Sleep(time.Millisecond)
+		}
+		q.Enqueue("second") // Full again.
+		if closeQueue {
+			q.Close()
+		}
+		cancel()
+
+		select {
+		case err := <-done:
+			if err != context.Canceled {
+				t.Errorf("Expected context.Canceled, got %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("FanOut did not stop after cancellation")
+		}
+
+		if items := q.Drain(); len(items) != 2 || items[0] != "first" || items[1] != "second" {
+			t.Errorf("Expected [first second] with closed=%v, got %v", closeQueue, items)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package threadsafequeue
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrNoResult completes the Future of an item that left the queue some way
+// other than through a worker pool, which alone gives results: taken by
+// Dequeue or another consumer, or removed by Drain.
+var ErrNoResult = errors.New("threadsafequeue: item taken without a result")
+
+// Future is the outcome of an item enqueued by Submit, to be awaited by its
+// producer. It is completed once, by the worker pool that handles the item
+// or by whatever else becomes of it.
+type Future struct {
+	once   sync.Once
+	done   chan struct{}
+	result interface{}
+	err    error
+	ticket *Ticket // Nil for an item that failed validation.
+}
+
+// Wait blocks until the future is complete and returns its result and
+// error, or returns ctx.Err() if ctx is done first. The error is the
+// handler's for an item handled by RunTasks or RunWorkers, as reported by
+// the pool after any retries. An item that never reached a handler
+// completes with why: the error Enqueue would have met, such as ErrClosed,
+// ErrFull or ErrShed, including ErrFull for an item DropOldest evicted
+// later, ErrClosed for one left in a closed queue once its worker pools
+// stopped, or ErrNoResult.
+// This method is safe for concurrent use.
+func (f *Future) Wait(ctx context.Context) (interface{}, error) {
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Done returns a channel that is closed once the future is complete, for use
+// in a select statement.
+// This method is safe for concurrent use.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// complete sets the outcome of f, unless it is nil or already complete.
+func (f *Future) complete(result interface{}, err error) {
+	if f == nil {
+		return
+	}
+	f.once.Do(func() {
+		f.result, f.err = result, err
+		close(f.done)
+	})
+}
+
+// Submit is like Enqueue but returns a Future that completes with the
+// outcome of the item: the result and error the handler of RunTasks returns
+// for it, or the error of RunWorkers' handler with a nil result. The queue
+// thus works as an executor of tasks, whose producers await their answers
+// without passing a channel along with each item, and which they can cancel
+// with Future.Cancel while it is queued. A future never hangs on an
+// item the queue discards: one refused on arrival, dropped by the overflow
+// policy or shed completes with the error, and so does one that leaves the
+// queue through any consumer other than a worker pool, with ErrNoResult.
+// Nor does it hang on an item stranded in a closed queue: once the last
+// worker pool stops, because the queue was drained or because of its ctx or
+// WithStopOnError, the futures of the items left complete with ErrClosed,
+// though the items themselves stay queued. An item still queued in an open
+// queue keeps its future pending until it is taken.
+//
+// Unlike Enqueue, Submit does not panic on an item the queue refuses, as
+// with WithRejectNil or WithElementType: the future completes with the
+// reason. Like EnqueueWithMeta, Submit makes the queue keep what goes beside
+// its items from the first call on.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) Submit(item interface{}) *Future {
+	f := &Future{done: make(chan struct{})}
+	if err := q.validate(item); err != nil {
+		f.complete(nil, err)
+		return f
+	}
+	item = q.copyItem(item)
+	q.throttle(nil, 1)
+	r := q.startRegion(traceEnqueueRegion)
+	f.ticket = &Ticket{q: q, future: f}
+	q.lock()
+	q.startExtras()
+	q.futuresOn, q.ticketsOn = true, true
+	if err := q.put(nil, item, extra{future: f, ticket: f.ticket}, false); err != nil {
+		f.complete(nil, err)
+	}
+	q.unlock()
+	endRegion(r)
+	return f
+}
+
+// dequeueContext is DequeueContext returning also what was kept beside the
+// item. With claim, the caller is a worker pool, which completes the item's
+// future itself.
+func (q *ThreadSafeQueue) dequeueContext(ctx context.Context, claim bool) (interface{}, extra, error) {
+	q.lock()
+	for attempt := 0; q.len() == 0 && !q.closed; attempt++ {
+		if err := ctx.Err(); err != nil {
+			q.unlock()
+			return nil, extra{}, err
+		}
+		if item, x, ok := q.awaitItem(ctx.Done(), attempt, claim); ok {
+			return item, x, nil // Handed over by a producer; q.mu is released.
+		}
+	}
+	var x extra
+	if claim {
+		x = q.frontExtra()
+	}
+	q.claim = claim
+	item, ok := q.remove()
+	q.claim = false
+	q.unlock()
+	if !ok {
+		return nil, extra{}, ErrClosed
+	}
+	return item, x, nil
+}
+
+// pollClaim is poll on behalf of a worker pool, returning also what was kept
+// beside the item.
+func (q *ThreadSafeQueue) pollClaim() (item interface{}, x extra, ok, closed bool) {
+	q.lock()
+	defer q.unlock()
+	x = q.frontExtra()
+	q.claim = true
+	item, ok = q.remove()
+	q.claim = false
+	return item, x, ok, q.closed
+}
+
+// orphaned completes the future of the front item, about to be removed by a
+// consumer that gives no result, with ErrNoResult. The caller must hold
+// q.mu.
+func (q *ThreadSafeQueue) orphaned() {
+	if !q.futuresOn || q.claim {
+		return
+	}
+	if x, ok := q.extras.front(); ok {
+		x.future.complete(nil, ErrNoResult)
+	}
+}
+
+// stranded completes the futures of the items left in a closed queue, once
+// its last worker pool stopped, with ErrClosed. The items stay queued, for
+// another consumer to take. The caller must hold q.mu.
+func (q *ThreadSafeQueue) stranded() {
+	if !q.futuresOn {
+		return
+	}
+	for i := 0; i < q.extras.len(); i++ {
+		q.extras.at(i).future.complete(nil, ErrClosed)
+	}
+}
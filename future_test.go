@@ -0,0 +1,181 @@
+package threadsafequeue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Test that RunTasks completes the future of each submitted item with the
+// handler's result or error, whether the workers were waiting for the items
+// or not
+func TestSubmitRunTasks(t *testing.T) {
+	q := NewThreadSafeQueue()
+	errOdd := errors.New("odd")
+	futures := []*Future{q.Submit(1)} // Queued before the workers start.
+	result := make(chan error, 1)
+	go func() {
+		result <- q.RunTasks(context.Background(), 2, func(ctx context.Context, item interface{}) (interface{}, error) {
+			if n := item.(int); n%2 == 0 {
+				return n * 10, nil
+			}
+			return nil, errOdd
+		}, WithWorkerErrorHandler(func(item interface{}, err error) {}))
+	}()
+	awaitCount(t, q.WaitingConsumers, 2)
+	for i := 2; i <= 10; i++ {
+		futures = append(futures, q.Submit(i)) // Handed to a waiting worker.
+	}
+	for i, f := range futures {
+		n := i + 1
+		got, err := f.Wait(context.Background())
+		if n%2 == 0 && (got != n*10 || err != nil) {
+			t.Errorf("Expected %d for item %d, got %v, %v", n*10, n, got, err)
+		}
+		if n%2 == 1 && (got != nil || err != errOdd) {
+			t.Errorf("Expected the handler's error for item %d, got %v, %v", n, got, err)
+		}
+	}
+	q.Close()
+	if err := <-result; err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+// Test that RunWorkers completes futures with a nil result, and with the
+// last error once retries run out
+func TestSubmitRunWorkersRetry(t *testing.T) {
+	q := NewThreadSafeQueue()
+	errFail := errors.New("fail")
+	ok, bad := q.Submit("ok"), q.Submit("bad")
+	q.Close()
+	q.RunWorkers(context.Background(), 1, func(ctx context.Context, item interface{}) error {
+		if item == "bad" {
+			return errFail
+		}
+		return nil
+	}, WithRetry(3, time.Millisecond, time.Millisecond, false))
+	if got, err := ok.Wait(context.Background()); got != nil || err != nil {
+		t.Errorf("Expected a nil result and error, got %v, %v", got, err)
+	}
+	if _, err := bad.Wait(context.Background()); err != errFail {
+		t.Errorf("Expected the error of the last attempt, got %v", err)
+	}
+}
+
+// Test that the future of an item the queue discards, or that a consumer
+// other than a worker pool takes, completes with why
+func TestSubmitDiscarded(t *testing.T) {
+	expect := func(f *Future, want error) {
+		t.Helper()
+		select {
+		case <-f.Done():
+		default:
+			t.Fatalf("Expected the future complete with %v", want)
+		}
+		if _, err := f.Wait(context.Background()); err != want {
+			t.Errorf("Expected %v, got %v", want, err)
+		}
+	}
+
+	q := NewThreadSafeQueue(WithCapacity(1), WithOverflowPolicy(DropNewest), WithRejectNil(true))
+	q.Submit(1)
+	expect(q.Submit(2), ErrFull)
+	expect(q.Submit(nil), ErrNilItem)
+	q.Close()
+	expect(q.Submit(3), ErrClosed)
+
+	q = NewThreadSafeQueue(WithCapacity(1), WithOverflowPolicy(DropOldest))
+	evicted := q.Submit(1)
+	kept := q.Submit(2)
+	expect(evicted, ErrFull)
+	q.Dequeue()
+	expect(kept, ErrNoResult)
+
+	q = NewThreadSafeQueue()
+	q.Enqueue("plain") // Queued before the queue kept futures.
+	a, b := q.Submit(1), q.Submit(2)
+	if item, _ := q.TryDequeue(); item != "plain" {
+		t.Fatalf("Expected the plain item first, got %v", item)
+	}
+	q.TryDequeue()
+	expect(a, ErrNoResult)
+	q.Drain()
+	expect(b, ErrNoResult)
+}
+
+// Test that a consumer parked in Dequeue, handed a submitted item, completes
+// its future with ErrNoResult
+func TestSubmitHandedToDequeue(t *testing.T) {
+	q := NewThreadSafeQueue()
+	got := make(chan interface{}, 1)
+	go func() {
+		item, _ := q.Dequeue()
+		got <- item
+	}()
+	awaitCount(t, q.WaitingConsumers, 1)
+	f := q.Submit(1)
+	if item := <-got; item != 1 {
+		t.Fatalf("Expected item 1, got %v", item)
+	}
+	if _, err := f.Wait(context.Background()); err != ErrNoResult {
+		t.Errorf("Expected ErrNoResult, got %v", err)
+	}
+}
+
+// Test that the futures of items left in a closed queue complete with
+// ErrClosed once the worker pool stops, while the items stay queued
+func TestSubmitStrandedByClose(t *testing.T) {
+	q := NewThreadSafeQueue()
+	errFail := errors.New("fail")
+	futures := []*Future{q.Submit(1), q.Submit(2), q.Submit(3)}
+	q.Close()
+	err := q.RunWorkers(context.Background(), 1, func(ctx context.Context, item interface{}) error {
+		return errFail
+	}, WithStopOnError(true))
+	if err != errFail {
+		t.Fatalf("Expected the pool to stop on the first failure, got %v", err)
+	}
+	for i, want := range []error{errFail, ErrClosed, ErrClosed} {
+		select {
+		case <-futures[i].Done():
+		default:
+			t.Fatalf("Expected the future of item %d complete once the pool stopped", i+1)
+		}
+		if _, err := futures[i].Wait(context.Background()); err != want {
+			t.Errorf("Expected %v for item %d, got %v", want, i+1, err)
+		}
+	}
+	if n := q.Size(); n != 2 {
+		t.Errorf("Expected the stranded items to stay queued, got %d", n)
+	}
+
+	// A pool stopped on an open queue leaves the futures pending.
+	q = NewThreadSafeQueue()
+	f := q.Submit(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	q.RunWorkers(ctx, 1, func(ctx context.Context, item interface{}) error { return nil })
+	select {
+	case <-f.Done():
+		t.Error("Expected the future pending while the queue is open")
+	default:
+	}
+}
+
+// Test that Wait gives up when its context is done while the item is queued
+func TestFutureWaitCancelled(t *testing.T) {
+	q := NewThreadSafeQueue()
+	f := q.Submit(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.Wait(ctx); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	select {
+	case <-f.Done():
+		t.Error("Expected the future still pending")
+	default:
+	}
+}
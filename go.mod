@@ -1,3 +1,3 @@
 module github.com/sandeepkv93/threadsafequeue
 
-go 1.20
+go 1.21
@@ -0,0 +1,84 @@
+package threadsafequeue
+
+import (
+	"bytes"
+	"encoding/gob"
+	"sync"
+)
+
+// GobEncode implements gob.GobEncoder. It encodes a snapshot of the items in
+// the queue, in FIFO order, as a gob-encoded []interface{}, so the concrete
+// type of every item must be registered with gob.Register. Only the items
+// are encoded: options, statistics and whether the queue is closed are not,
+// and neither is anything kept beside an item, such as its tag or metadata.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) GobEncode() ([]byte, error) {
+	items := q.ToSlice()
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(items); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder. It replaces the contents of the queue
+// with the items encoded by GobEncode, so that the zero value, as gob
+// allocates it, decodes into a working queue. The items it replaces are
+// removed as if by Drain, and the new ones are then added as if by
+// EnqueueBatch: consumers waiting on the queue are handed them, and a
+// bounded queue applies its overflow policy to any beyond its capacity.
+// If the queue is closed, GobDecode returns ErrClosed. On any error, the
+// queue is left unchanged.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) GobDecode(data []byte) error {
+	var items []interface{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&items); err != nil {
+		return err
+	}
+	q.lock()
+	defer q.unlock()
+	return q.load(items, true)
+}
+
+// GobEncode implements gob.GobEncoder. It encodes a snapshot of the items in
+// the queue, in FIFO order, as a gob-encoded []T. Whether the queue is
+// closed is not encoded.
+// This method is safe for concurrent use.
+func (q *TypedQueue[T]) GobEncode() ([]byte, error) {
+	q.mu.Lock()
+	items := q.items.appendTo(make([]T, 0, q.items.len()))
+	q.mu.Unlock()
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(items); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder. It replaces the contents of the queue
+// with the items encoded by GobEncode, waking any consumers waiting for them;
+// like Enqueue, it adds nothing to a closed queue. A zero TypedQueue, as gob
+// allocates it, decodes into one ready for use, as if made by NewTypedQueue;
+// it must not be in use by other goroutines while it is decoded. On error,
+// the queue is left unchanged.
+func (q *TypedQueue[T]) GobDecode(data []byte) error {
+	var items []T
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&items); err != nil {
+		return err
+	}
+	if q.cond == nil {
+		q.cond = sync.NewCond(&q.mu)
+	}
+	q.mu.Lock()
+	q.items.clear()
+	if !q.closed {
+		for i := range items {
+			q.items.pushBackPtr(&items[i])
+		}
+	}
+	if q.waiters > 0 {
+		q.cond.Broadcast()
+	}
+	q.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,175 @@
+package threadsafequeue
+
+import (
+	"bytes"
+	"encoding/gob"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type gobPoint struct {
+	X, Y int
+}
+
+type gobLabel struct {
+	Name string
+	Tags []string
+}
+
+func init() {
+	gob.Register(gobPoint{})
+	gob.Register(&gobLabel{})
+}
+
+// gobItem returns the i'th item of a mix of registered types
+func gobItem(i int) interface{} {
+	switch i % 5 {
+	case 0:
+		return i
+	case 1:
+		return "item"
+	case 2:
+		return float64(i) / 2
+	case 3:
+		return gobPoint{X: i, Y: -i}
+	default:
+		return &gobLabel{Name: "label", Tags: []string{"a", "b"}}
+	}
+}
+
+// Test that a queue of mixed registered types round-trips through gob in order
+func TestGobRoundTrip(t *testing.T) {
+	const n = 10000
+	q := NewThreadSafeQueue()
+	for i := 0; i < n; i++ {
+		q.Enqueue(gobItem(i))
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(q); err != nil {
+		t.Fatalf("Expected to encode the queue, got %v", err)
+	}
+	if q.Size() != n {
+		t.Errorf("Expected encoding to leave %d items, got %d", n, q.Size())
+	}
+	var decoded ThreadSafeQueue
+	if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatalf("Expected to decode the queue, got %v", err)
+	}
+	if decoded.Size() != n {
+		t.Fatalf("Expected %d decoded items, got %d", n, decoded.Size())
+	}
+	for i := 0; i < n; i++ {
+		item, _ := decoded.TryDequeue()
+		if want := gobItem(i); !reflect.DeepEqual(item, want) {
+			t.Fatalf("Expected item %d to be %#v, got %#v", i, want, item)
+		}
+	}
+}
+
+// Test that a queue decoded as part of another value is ready for use
+func TestGobDecodedQueueWorks(t *testing.T) {
+	type state struct {
+		Name    string
+		Pending *ThreadSafeQueue
+	}
+	src := state{Name: "worker", Pending: NewThreadSafeQueue()}
+	src.Pending.Enqueue(1)
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(src); err != nil {
+		t.Fatalf("Expected to encode the state, got %v", err)
+	}
+	var dst state
+	if err := gob.NewDecoder(&buf).Decode(&dst); err != nil {
+		t.Fatalf("Expected to decode the state, got %v", err)
+	}
+	q := dst.Pending
+	if item, ok := q.Dequeue(); !ok || item != 1 {
+		t.Fatalf("Expected to dequeue 1, got %v", item)
+	}
+	result := make(chan interface{})
+	go func() {
+		item, _ := q.Dequeue()
+		result <- item
+	}()
+	time.Sleep(50 * time.Millisecond)
+	q.Enqueue(2)
+	if item := <-result; item != 2 {
+		t.Errorf("Expected the waiting consumer to get 2, got %v", item)
+	}
+	q.Close()
+	if _, ok := q.Dequeue(); ok {
+		t.Error("Expected Dequeue on a closed, empty queue to fail")
+	}
+}
+
+// Test that GobDecode replaces the items and hands them to waiting consumers
+func TestGobDecodeReplaces(t *testing.T) {
+	src := NewThreadSafeQueue()
+	src.EnqueueBatch("a", "b")
+	data, err := src.GobEncode()
+	if err != nil {
+		t.Fatalf("Expected to encode the queue, got %v", err)
+	}
+
+	q := NewThreadSafeQueue()
+	q.Enqueue("old")
+	if err := q.GobDecode(data); err != nil {
+		t.Fatalf("Expected to decode the queue, got %v", err)
+	}
+	if got := q.ToSlice(); !reflect.DeepEqual(got, []interface{}{"a", "b"}) {
+		t.Errorf("Expected the decoded items to replace the old ones, got %v", got)
+	}
+
+	empty := NewThreadSafeQueue()
+	result := make(chan interface{})
+	go func() {
+		item, _ := empty.Dequeue()
+		result <- item
+	}()
+	awaitCount(t, empty.WaitingConsumers, 1)
+	if err := empty.GobDecode(data); err != nil {
+		t.Fatalf("Expected to decode the queue, got %v", err)
+	}
+	if item := <-result; item != "a" {
+		t.Errorf("Expected the waiting consumer to get a, got %v", item)
+	}
+
+	if err := q.GobDecode([]byte("garbage")); err == nil {
+		t.Error("Expected an error decoding garbage")
+	}
+	if q.Size() != 2 {
+		t.Errorf("Expected a failed decode to leave 2 items, got %d", q.Size())
+	}
+}
+
+// Test that a TypedQueue round-trips through gob and is ready for use
+func TestGobTypedQueue(t *testing.T) {
+	q := NewTypedQueue[gobPoint]()
+	for i := 0; i < 100; i++ {
+		q.Enqueue(gobPoint{X: i, Y: i * i})
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(q); err != nil {
+		t.Fatalf("Expected to encode the queue, got %v", err)
+	}
+	var decoded TypedQueue[gobPoint]
+	if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatalf("Expected to decode the queue, got %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		if p, ok := decoded.Dequeue(); !ok || p != (gobPoint{X: i, Y: i * i}) {
+			t.Fatalf("Expected item %d to be {%d %d}, got %v", i, i, i*i, p)
+		}
+	}
+	result := make(chan gobPoint)
+	go func() {
+		p, _ := decoded.Dequeue()
+		result <- p
+	}()
+	time.Sleep(50 * time.Millisecond)
+	decoded.Enqueue(gobPoint{X: 7})
+	if p := <-result; p.X != 7 {
+		t.Errorf("Expected the waiting consumer to get {7 0}, got %v", p)
+	}
+}
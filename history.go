@@ -0,0 +1,183 @@
+package threadsafequeue
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// HistoryOp is the kind of an operation kept by WithHistory.
+type HistoryOp int
+
+const (
+	// OpEnqueue is an item stored at the back of the queue.
+	OpEnqueue HistoryOp = iota
+	// OpEnqueueFront is an item stored at the front of the queue.
+	OpEnqueueFront
+	// OpDequeue is an item removed by a consumer.
+	OpDequeue
+	// OpDrop is an item discarded by the overflow policy.
+	OpDrop
+	// OpDrain is every item removed at once by Drain.
+	OpDrain
+	// OpClose is the queue being closed.
+	OpClose
+)
+
+// String returns the name of the operation.
+func (op HistoryOp) String() string {
+	switch op {
+	case OpEnqueue:
+		return "Enqueue"
+	case OpEnqueueFront:
+		return "EnqueueFront"
+	case OpDequeue:
+		return "Dequeue"
+	case OpDrop:
+		return "Drop"
+	case OpDrain:
+		return "Drain"
+	case OpClose:
+		return "Close"
+	default:
+		return "HistoryOp(unknown)"
+	}
+}
+
+// OpRecord is one operation kept by WithHistory.
+type OpRecord struct {
+	Op        HistoryOp
+	Goroutine uint64    // ID of the goroutine that ran the operation, with HistoryGoroutines; otherwise zero.
+	Item      string    // Preview of the item, with HistoryPreview; otherwise empty.
+	Time      time.Time // When the operation happened.
+	Size      int       // Number of items in the queue after the operation.
+}
+
+// String describes the record in one line.
+func (r OpRecord) String() string {
+	s := fmt.Sprintf("%s %s", r.Time.Format(time.RFC3339Nano), r.Op)
+	if r.Item != "" {
+		s += " " + r.Item
+	}
+	if r.Goroutine != 0 {
+		s += fmt.Sprintf(" goroutine %d", r.Goroutine)
+	}
+	return s + fmt.Sprintf(" size %d", r.Size)
+}
+
+// HistoryOption configures the history kept by WithHistory.
+type HistoryOption func(*history)
+
+// HistoryPreview makes the history keep preview(item) for each operation on
+// an item. preview runs under the queue's lock on every such operation, so
+// it should be quick.
+func HistoryPreview(preview func(item interface{}) string) HistoryOption {
+	return func(h *history) {
+		h.preview = preview
+	}
+}
+
+// HistoryGoroutines makes the history keep the ID of the goroutine running
+// each operation. An item handed to a parked consumer, or stored for a
+// blocked producer, is recorded with the goroutine whose operation made that
+// possible. Go offers no cheap way to find the current goroutine, so this
+// costs microseconds per operation; leave it off on hot queues.
+func HistoryGoroutines() HistoryOption {
+	return func(h *history) {
+		h.goroutines = true
+	}
+}
+
+// WithHistory makes the queue keep its last n operations, so that History
+// can show what happened to it before something went wrong. It is a
+// debugging aid: the records are kept in a ring preallocated here, and by
+// default an operation costs a clock reading and no allocation. Nothing is
+// kept if n is zero or less.
+func WithHistory(n int, opts ...HistoryOption) Option {
+	return func(q *ThreadSafeQueue) {
+		if n <= 0 {
+			q.history = nil
+			return
+		}
+		h := &history{records: make([]OpRecord, n)}
+		for _, opt := range opts {
+			opt(h)
+		}
+		q.history = h
+	}
+}
+
+// History returns a copy of the operations kept by WithHistory, oldest
+// first, or nil if the queue keeps no history.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) History() []OpRecord {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	h := q.history
+	if h == nil {
+		return nil
+	}
+	records := make([]OpRecord, 0, h.len)
+	start := h.next - h.len
+	if start < 0 {
+		start += len(h.records)
+	}
+	for i := 0; i < h.len; i++ {
+		records = append(records, h.records[(start+i)%len(h.records)])
+	}
+	return records
+}
+
+// history is the ring behind WithHistory, protected by the queue's lock.
+type history struct {
+	records    []OpRecord
+	next       int // Index of the slot the next record goes in.
+	len        int // Number of records kept.
+	preview    func(interface{}) string
+	goroutines bool
+}
+
+// record keeps an operation on item, if the queue keeps a history, and
+// passes it to the audit, if any. The caller must hold q.mu exclusively,
+// after the operation.
+func (q *ThreadSafeQueue) record(op HistoryOp, item interface{}) {
+	if q.audit != nil && op != OpDrain && op != OpClose {
+		q.audited(op, item) // Drain audits each item itself.
+		q.auditClosed()
+	}
+	h := q.history
+	if h == nil {
+		return
+	}
+	r := &h.records[h.next]
+	*r = OpRecord{Op: op, Time: q.clock.Now(), Size: q.len()}
+	if h.preview != nil && op != OpDrain && op != OpClose {
+		r.Item = h.preview(item)
+	}
+	if h.goroutines {
+		r.Goroutine = goroutineID()
+	}
+	h.next = (h.next + 1) % len(h.records)
+	if h.len < len(h.records) {
+		h.len++
+	}
+}
+
+// goroutineID returns the ID of the calling goroutine, parsed from the
+// header of its stack trace: "goroutine 42 [running]:".
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	const prefix = "goroutine "
+	if len(b) < len(prefix) {
+		return 0
+	}
+	var id uint64
+	for _, c := range b[len(prefix):] {
+		if c < '0' || c > '9' {
+			break
+		}
+		id = id*10 + uint64(c-'0')
+	}
+	return id
+}
@@ -0,0 +1,113 @@
+package threadsafequeue
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func preview(item interface{}) string { return fmt.Sprint(item) }
+
+// Test that the history keeps the last n operations, oldest first, with the
+// size each left behind
+func TestHistory(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(2), WithOverflowPolicy(DropOldest), WithHistory(6, HistoryPreview(preview)))
+	if got := q.History(); len(got) != 0 {
+		t.Errorf("Expected an empty history, got %v", got)
+	}
+	q.Enqueue(1)
+	q.Enqueue(2)
+	q.Enqueue(3)      // Drops 1.
+	q.EnqueueFront(4) // Drops 2.
+	q.Dequeue()
+	q.Drain()
+	q.Close()
+
+	want := []OpRecord{
+		{Op: OpEnqueue, Item: "3", Size: 2},
+		{Op: OpDrop, Item: "2", Size: 1},
+		{Op: OpEnqueueFront, Item: "4", Size: 2},
+		{Op: OpDequeue, Item: "4", Size: 1},
+		{Op: OpDrain, Size: 0},
+		{Op: OpClose, Size: 0},
+	}
+	got := q.History()
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d records, got %v", len(want), got)
+	}
+	for i, r := range got {
+		if r.Op != want[i].Op || r.Item != want[i].Item || r.Size != want[i].Size {
+			t.Errorf("Record %d: expected %v %q size %d, got %v", i, want[i].Op, want[i].Item, want[i].Size, r)
+		}
+		if r.Goroutine != 0 {
+			t.Errorf("Record %d: expected no goroutine without HistoryGoroutines, got %d", i, r.Goroutine)
+		}
+		if i > 0 && r.Time.Before(got[i-1].Time) {
+			t.Errorf("Record %d: expected times in order, got %v before %v", i, got[i-1].Time, r.Time)
+		}
+	}
+	if s := got[3].String(); !strings.Contains(s, "Dequeue 4 size 1") {
+		t.Errorf("Expected the record to describe itself, got %q", s)
+	}
+}
+
+// Test that a history records the goroutine that ran each operation
+func TestHistoryGoroutines(t *testing.T) {
+	q := NewThreadSafeQueue(WithHistory(10, HistoryGoroutines()))
+	var wg sync.WaitGroup
+	var consumer uint64
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		consumer = goroutineID()
+		q.TryDequeue()
+		q.Enqueue(1)
+		q.TryDequeue()
+	}()
+	wg.Wait()
+	q.Enqueue(2)
+	got := q.History()
+	if len(got) != 3 {
+		t.Fatalf("Expected 3 records, got %v", got)
+	}
+	if got[0].Goroutine != consumer || got[1].Goroutine != consumer {
+		t.Errorf("Expected the first records from goroutine %d, got %v", consumer, got)
+	}
+	if main := goroutineID(); got[2].Goroutine != main || main == consumer || main == 0 {
+		t.Errorf("Expected the last record from goroutine %d, got %v", main, got[2])
+	}
+}
+
+// Test that queues keep no history unless asked to
+func TestNoHistory(t *testing.T) {
+	for _, q := range []*ThreadSafeQueue{NewThreadSafeQueue(), NewThreadSafeQueue(WithHistory(0))} {
+		q.Enqueue(1)
+		if got := q.History(); got != nil {
+			t.Errorf("Expected no history, got %v", got)
+		}
+	}
+}
+
+// Benchmark the cost of keeping a history
+func BenchmarkHistory(b *testing.B) {
+	benchmarks := []struct {
+		name string
+		opts []Option
+	}{
+		{"Off", nil},
+		{"On", []Option{WithHistory(1024)}},
+		{"Preview", []Option{WithHistory(1024, HistoryPreview(preview))}},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			q := NewThreadSafeQueue(bm.opts...)
+			var item interface{} = struct{}{}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				q.Enqueue(item)
+				q.Dequeue()
+			}
+		})
+	}
+}
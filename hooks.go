@@ -0,0 +1,120 @@
+package threadsafequeue
+
+import "log/slog"
+
+// WithEnqueueHook makes the queue call fn for every item stored in it, with
+// the number of items the queue held right after. Items discarded by the
+// overflow policy or refused by a closed queue are not stored and fn is not
+// called for them.
+//
+// Hooks run after the operation is done and the queue's lock is released,
+// from the goroutine that released it, so they may call the queue's methods.
+// Several hooks registered with WithEnqueueHook and WithDequeueHook run in the
+// order they were registered, and events in the order they happened. A
+// panicking hook is recovered and, with WithLogger, logged at Error level;
+// the queue is not affected.
+func WithEnqueueHook(fn func(item interface{}, newSize int)) Option {
+	return func(q *ThreadSafeQueue) {
+		q.hooks = append(q.hooks, hook{fn: fn, kind: hookEnqueue})
+	}
+}
+
+// WithDequeueHook makes the queue call fn for every item removed by a
+// consumer, including handed directly to a parked Dequeue or taken by Drain,
+// with the number of items the queue held right after. Items evicted by the
+// DropOldest policy are not dequeued and fn is not called for them. Hooks run
+// as described for WithEnqueueHook.
+func WithDequeueHook(fn func(item interface{}, newSize int)) Option {
+	return func(q *ThreadSafeQueue) {
+		q.hooks = append(q.hooks, hook{fn: fn, kind: hookDequeue})
+	}
+}
+
+// WithDropHook makes the queue call fn for every item it drops: discarded or
+// evicted by the overflow policy, or shed by WithLoadShedding, with the
+// number of items the queue held right after. Hooks run as described for
+// WithEnqueueHook.
+func WithDropHook(fn func(item interface{}, newSize int)) Option {
+	return func(q *ThreadSafeQueue) {
+		q.hooks = append(q.hooks, hook{fn: fn, kind: hookDrop})
+	}
+}
+
+// hookKind is the kind of event a hook is called for.
+type hookKind int
+
+const (
+	hookEnqueue hookKind = iota // An item was stored.
+	hookDequeue                 // An item was removed by a consumer.
+	hookHigh                    // The size rose above the high watermark.
+	hookLow                     // The size fell below the low watermark.
+	hookDrop                    // An item was dropped.
+)
+
+// String names the hooks of the kind in log records.
+func (k hookKind) String() string {
+	switch k {
+	case hookEnqueue:
+		return "enqueue hook"
+	case hookDequeue:
+		return "dequeue hook"
+	case hookHigh:
+		return "high watermark callback"
+	case hookDrop:
+		return "drop hook"
+	default:
+		return "low watermark callback"
+	}
+}
+
+// hook is a function registered by WithEnqueueHook, WithDequeueHook or
+// WithDropHook.
+type hook struct {
+	fn   func(interface{}, int)
+	kind hookKind
+}
+
+// hookEvent is an event waiting for the queue's lock to be released to be
+// passed to the hooks of its kind. item is nil for watermark crossings.
+type hookEvent struct {
+	item interface{}
+	size int
+	kind hookKind
+}
+
+// hookLater queues an event for unlock to pass to the hooks. The caller must
+// hold q.mu exclusively and must have checked that the queue has hooks.
+func (q *ThreadSafeQueue) hookLater(item interface{}, size int, kind hookKind) {
+	q.hookEvents = append(q.hookEvents, hookEvent{item: item, size: size, kind: kind})
+}
+
+// runHooks passes the events queued by hookLater to the hooks, once the lock
+// is released.
+func (q *ThreadSafeQueue) runHooks(events []hookEvent) {
+	for _, e := range events {
+		switch e.kind {
+		case hookHigh:
+			q.runHook(q.marks.onHigh, e)
+		case hookLow:
+			q.runHook(q.marks.onLow, e)
+		default:
+			for _, h := range q.hooks {
+				if h.kind == e.kind {
+					q.runHook(h.fn, e)
+				}
+			}
+		}
+	}
+}
+
+// runHook calls one hook, recovering from any panic.
+func (q *ThreadSafeQueue) runHook(fn func(interface{}, int), e hookEvent) {
+	defer func() {
+		if v := recover(); v != nil && q.logger != nil {
+			q.log(logEvent{level: slog.LevelError, msg: e.kind.String() + " panicked", size: e.size, item: e.item, attrs: []slog.Attr{
+				slog.Any(LogKeyPanic, v),
+			}})
+		}
+	}()
+	fn(e.item, e.size)
+}
@@ -0,0 +1,131 @@
+package threadsafequeue
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Test that hooks see every item stored and removed, with the size after
+// each, in registration order
+func TestHooks(t *testing.T) {
+	var calls []string
+	hook := func(name string) func(interface{}, int) {
+		return func(item interface{}, size int) {
+			calls = append(calls, fmt.Sprintf("%s %v %d", name, item, size))
+		}
+	}
+	q := NewThreadSafeQueue(WithCapacity(2), WithOverflowPolicy(DropNewest),
+		WithEnqueueHook(hook("in1")), WithDequeueHook(hook("out")), WithEnqueueHook(hook("in2")))
+	q.Enqueue(1)
+	q.EnqueueFront(2)
+	q.Enqueue(3) // Dropped.
+	q.Dequeue()
+	q.Enqueue(4)
+	q.Drain()
+	q.Close()
+	q.Enqueue(5) // Refused.
+
+	want := []string{
+		"in1 1 1", "in2 1 1",
+		"in1 2 2", "in2 2 2",
+		"out 2 1",
+		"in1 4 2", "in2 4 2",
+		"out 1 1", "out 4 0",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("Expected hook calls %q, but got %q", want, calls)
+	}
+}
+
+// Test that hooks run outside the lock, so they can use the queue
+func TestHooksCallQueue(t *testing.T) {
+	var q *ThreadSafeQueue
+	var seen []interface{}
+	q = NewThreadSafeQueue(WithEnqueueHook(func(item interface{}, size int) {
+		front, _ := q.Peek()
+		seen = append(seen, front, q.Size())
+	}))
+	q.Enqueue(1)
+	q.Enqueue(2)
+	if want := []interface{}{1, 1, 1, 2}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("Expected hooks to see %v, but got %v", want, seen)
+	}
+}
+
+// Test that the dequeue hook sees items handed to parked consumers
+func TestHooksHandoff(t *testing.T) {
+	var mu sync.Mutex
+	var out []interface{}
+	q := NewThreadSafeQueue(WithDequeueHook(func(item interface{}, size int) {
+		mu.Lock()
+		out = append(out, item)
+		mu.Unlock()
+	}))
+	done := make(chan interface{})
+	go func() {
+		item, _ := q.Dequeue()
+		done <- item
+	}()
+	awaitCount(t, func() int { return q.Stats().WaitingConsumers }, 1)
+	q.Enqueue("x")
+	if item := <-done; item != "x" {
+		t.Errorf("Expected the consumer to get x, but got %v", item)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(out, []interface{}{"x"}) {
+		t.Errorf("Expected the dequeue hook to see [x], but got %v", out)
+	}
+}
+
+// Test that a panicking hook is logged and leaves the queue and the other
+// hooks working
+func TestHooksPanic(t *testing.T) {
+	h := &recordHandler{level: slog.LevelDebug}
+	var after []interface{}
+	q := NewThreadSafeQueue(WithLogger(slog.New(h)),
+		WithEnqueueHook(func(item interface{}, size int) {
+			if item == 1 {
+				panic("boom")
+			}
+		}),
+		WithEnqueueHook(func(item interface{}, size int) {
+			after = append(after, item)
+		}))
+	q.Enqueue(1)
+	q.Enqueue(2)
+
+	if want := []interface{}{1, 2}; !reflect.DeepEqual(after, want) {
+		t.Errorf("Expected the second hook to see %v, but got %v", want, after)
+	}
+	if got := q.ToSlice(); !reflect.DeepEqual(got, []interface{}{1, 2}) {
+		t.Errorf("Expected the queue to hold [1 2], but got %v", got)
+	}
+	logged := h.logged()
+	if len(logged) != 1 || !strings.HasPrefix(logged[0], "ERROR enqueue hook panicked") || !strings.Contains(logged[0], "panic=boom") {
+		t.Errorf("Expected the panic to be logged, but got %q", logged)
+	}
+}
+
+// Test that the drop hook sees the items the overflow policy discards
+func TestDropHook(t *testing.T) {
+	for _, c := range []struct {
+		policy OverflowPolicy
+		want   []string
+	}{
+		{DropNewest, []string{"3 2"}},
+		{DropOldest, []string{"1 1"}},
+	} {
+		var calls []string
+		q := NewThreadSafeQueue(WithCapacity(2), WithOverflowPolicy(c.policy),
+			WithDropHook(func(item interface{}, size int) { calls = append(calls, fmt.Sprintf("%v %d", item, size)) }))
+		q.EnqueueBatch(1, 2, 3)
+		if !reflect.DeepEqual(calls, c.want) {
+			t.Errorf("Expected %v to drop %q, got %q", c.policy, c.want, calls)
+		}
+	}
+}
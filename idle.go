@@ -0,0 +1,68 @@
+package threadsafequeue
+
+import "time"
+
+// WithIdleCallback makes the queue call fn once it has stayed empty for d,
+// so that resources held for its consumers, such as pooled connections, can
+// be released while there is no work. fn is called once per idle period,
+// from its own goroutine and without the queue's lock held; the next call
+// needs the queue to hold an item again and then stay empty for another d.
+//
+// No goroutine polls the queue: a timer is armed when an operation takes the
+// last item and stopped when an item arrives, so an item that comes and goes
+// within d restarts the wait. A new queue is not idle until it has held an
+// item. It panics if d is not positive.
+func WithIdleCallback(d time.Duration, fn func()) Option {
+	if d <= 0 {
+		panic("threadsafequeue: WithIdleCallback needs a positive duration")
+	}
+	return func(q *ThreadSafeQueue) {
+		q.idle = &idleWatch{d: d, fn: fn}
+	}
+}
+
+// idleWatch is the state behind WithIdleCallback, protected by the queue's
+// lock.
+type idleWatch struct {
+	d     time.Duration
+	fn    func()
+	timer Timer     // Created on first use and reused.
+	armed bool      // The queue is empty and fn is due.
+	since time.Time // When the queue became empty.
+}
+
+// idleChanged arms or stops the idle timer after a change to the size n.
+// The caller must hold q.mu exclusively.
+func (q *ThreadSafeQueue) idleChanged(n int) {
+	s := q.idle
+	switch {
+	case n == 0 && !s.armed:
+		s.armed = true
+		s.since = q.clock.Now()
+		if s.timer == nil {
+			s.timer = q.clock.AfterFunc(s.d, q.checkIdle)
+		} else {
+			s.timer.Reset(s.d)
+		}
+	case n > 0 && s.armed:
+		s.armed = false
+		s.timer.Stop()
+	}
+}
+
+// checkIdle runs when the idle timer fires and calls the callback if the
+// queue has stayed empty since the timer was armed. A timer that fired as it
+// was being stopped and rearmed finds less than the duration elapsed and
+// leaves the call to the rearmed one.
+func (q *ThreadSafeQueue) checkIdle() {
+	q.lock()
+	s := q.idle
+	fire := s.armed && q.clock.Now().Sub(s.since) >= s.d
+	if fire {
+		s.armed = false
+	}
+	q.unlock()
+	if fire {
+		s.fn()
+	}
+}
@@ -0,0 +1,49 @@
+package threadsafequeue_test
+
+import (
+	"testing"
+	"time"
+
+	queue "github.com/sandeepkv93/threadsafequeue"
+	"github.com/sandeepkv93/threadsafequeue/queuetest"
+)
+
+// Test that the idle callback fires exactly when the queue has stayed empty
+// for the duration, once per idle period, that a blip within the window
+// restarts the wait, and that a new queue that never held an item is not idle
+func TestFakeClockIdleCallback(t *testing.T) {
+	c := queuetest.NewFakeClock(epoch)
+	idle := 0
+	q := queue.NewThreadSafeQueue(queue.WithClock(c), queue.WithIdleCallback(time.Minute, func() { idle++ }))
+	c.Advance(time.Hour)
+	if idle != 0 {
+		t.Fatalf("Expected no call for a queue that never held an item, got %d", idle)
+	}
+	q.Enqueue(1)
+	q.TryDequeue()
+	c.Advance(40 * time.Second)
+	q.Enqueue(2) // A blip inside the window.
+	q.TryDequeue()
+	c.Advance(40 * time.Second)
+	if idle != 0 {
+		t.Fatalf("Expected no call 40s after the blip, got %d", idle)
+	}
+	c.Advance(20 * time.Second)
+	if idle != 1 {
+		t.Fatalf("Expected a call a minute after the blip, got %d", idle)
+	}
+	c.Advance(time.Hour)
+	if idle != 1 {
+		t.Errorf("Expected one call per idle period, got %d", idle)
+	}
+	q.Enqueue(3)
+	c.Advance(time.Hour)
+	if idle != 1 {
+		t.Errorf("Expected no call while the queue holds an item, got %d", idle)
+	}
+	q.Drain()
+	c.Advance(time.Minute)
+	if idle != 2 {
+		t.Errorf("Expected a call once the queue is idle again, got %d", idle)
+	}
+}
@@ -0,0 +1,13 @@
+package threadsafequeue
+
+import "testing"
+
+// Test that WithIdleCallback panics without a positive duration
+func TestIdleCallbackInvalidDuration(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected WithIdleCallback(0) to panic")
+		}
+	}()
+	WithIdleCallback(0, func() {})
+}
@@ -0,0 +1,145 @@
+package lincheck
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxOps bounds the operations in a history, which Check tracks in a bit set.
+const maxOps = 64
+
+// model is the sequential specification the queue is checked against: a
+// plain slice of items, which a bounded queue keeps within capacity.
+type model struct {
+	items    []int
+	closed   bool
+	capacity int
+}
+
+// apply performs op on m and returns the resulting state, and whether op can
+// run in state m and return what it returned. A call that would block, such
+// as a Dequeue of an empty open queue, cannot run. m itself is left as is, so
+// the search can go back to it.
+func (m model) apply(op Operation) (model, bool) {
+	full := m.capacity > 0 && len(m.items) >= m.capacity
+	switch op.Kind {
+	case Enqueue, EnqueueFront:
+		if m.closed {
+			return m, true // Discarded.
+		}
+		if full {
+			return m, false
+		}
+		if op.Kind == Enqueue {
+			m.items = append(m.items[:len(m.items):len(m.items)], op.Value)
+		} else {
+			m.items = append([]int{op.Value}, m.items...)
+		}
+		return m, true
+	case TryEnqueue:
+		if m.closed || full {
+			return m, !op.OK && op.Closed == m.closed
+		}
+		m.items = append(m.items[:len(m.items):len(m.items)], op.Value)
+		return m, op.OK
+	case Dequeue, TryDequeue, Peek:
+		if len(m.items) == 0 {
+			if op.Kind == Dequeue && !m.closed {
+				return m, false
+			}
+			return m, !op.OK
+		}
+		if !op.OK || op.Item != m.items[0] {
+			return m, false
+		}
+		if op.Kind != Peek {
+			m.items = m.items[1:]
+		}
+		return m, true
+	case Size:
+		return m, op.Item == len(m.items)
+	case Drain:
+		if len(op.Items) != len(m.items) {
+			return m, false
+		}
+		for i, item := range m.items {
+			if op.Items[i] != item {
+				return m, false
+			}
+		}
+		m.items = nil
+		return m, true
+	case Close:
+		m.closed = true
+		return m, true
+	}
+	panic(fmt.Sprintf("lincheck: unknown operation %v", op.Kind))
+}
+
+// key identifies a point in the search: which operations have taken effect
+// and the state they left behind.
+type key struct {
+	done  uint64
+	state string
+}
+
+// Check reports whether history, as returned by Run for a queue bounded by
+// capacity (zero for unbounded), is linearizable: whether its operations can
+// be put in an order that respects real time, where an operation that
+// returned before another started comes first, and in which each returns
+// what it did when applied to the model one at a time. If not, the error
+// lists the history.
+//
+// The search tries every operation that may take effect next and remembers
+// the states it has ruled out, so histories of up to 64 operations check
+// quickly.
+func Check(history []Operation, capacity int) error {
+	if len(history) > maxOps {
+		return fmt.Errorf("lincheck: %d operations exceed %d", len(history), maxOps)
+	}
+	c := checker{ops: history, failed: make(map[key]bool)}
+	if c.search(0, model{capacity: capacity}) {
+		return nil
+	}
+	lines := make([]string, len(history))
+	for i, op := range history {
+		lines[i] = op.String()
+	}
+	return fmt.Errorf("lincheck: history is not linearizable:\n\t%s", strings.Join(lines, "\n\t"))
+}
+
+// checker searches for a linearization of ops.
+type checker struct {
+	ops    []Operation
+	failed map[key]bool // Points from which no linearization exists.
+}
+
+// search reports whether the operations not in done can take effect, one by
+// one, starting from state m.
+func (c *checker) search(done uint64, m model) bool {
+	if done == 1<<len(c.ops)-1 {
+		return true
+	}
+	k := key{done, fmt.Sprint(m.items, m.closed)}
+	if c.failed[k] {
+		return false
+	}
+	// An operation can go next only if it started before every other
+	// remaining one returned.
+	first := int64(-1)
+	for i, op := range c.ops {
+		if done&(1<<i) == 0 && (first < 0 || op.Return < first) {
+			first = op.Return
+		}
+	}
+	for i, op := range c.ops {
+		if done&(1<<i) != 0 || op.Call > first {
+			continue
+		}
+		if next, ok := m.apply(op); ok && c.search(done|1<<i, next) {
+			return true
+		}
+	}
+	c.failed[k] = true
+	return false
+}
@@ -0,0 +1,74 @@
+package lincheck
+
+import "testing"
+
+// Test that Check accepts histories that a sequential queue could produce and
+// rejects those it could not
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		history  []Operation
+		want     bool
+	}{
+		{"Sequential", 0, []Operation{
+			{Kind: Enqueue, Value: 1, Call: 1, Return: 2},
+			{Kind: Enqueue, Value: 2, Call: 3, Return: 4},
+			{Kind: Dequeue, Item: 1, OK: true, Call: 5, Return: 6},
+			{Kind: Size, Item: 1, Call: 7, Return: 8},
+		}, true},
+		{"WrongOrder", 0, []Operation{
+			{Kind: Enqueue, Value: 1, Call: 1, Return: 2},
+			{Kind: Enqueue, Value: 2, Call: 3, Return: 4},
+			{Kind: Dequeue, Item: 2, OK: true, Call: 5, Return: 6},
+		}, false},
+		{"OverlappingEnqueues", 0, []Operation{
+			{Kind: Enqueue, Value: 1, Call: 1, Return: 4},
+			{Client: 1, Kind: Enqueue, Value: 2, Call: 2, Return: 3},
+			{Kind: Dequeue, Item: 2, OK: true, Call: 5, Return: 6},
+		}, true},
+		{"DequeueBeforeEnqueue", 0, []Operation{
+			{Kind: Dequeue, Item: 1, OK: true, Call: 1, Return: 2},
+			{Client: 1, Kind: Enqueue, Value: 1, Call: 3, Return: 4},
+		}, false},
+		{"BlockedDequeue", 0, []Operation{
+			{Kind: Dequeue, Item: 1, OK: true, Call: 1, Return: 4},
+			{Client: 1, Kind: Enqueue, Value: 1, Call: 2, Return: 3},
+		}, true},
+		{"DequeueFalseWhileOpen", 0, []Operation{
+			{Kind: Enqueue, Value: 1, Call: 1, Return: 2},
+			{Kind: Dequeue, Item: 1, OK: true, Call: 3, Return: 4},
+			{Kind: Dequeue, Call: 5, Return: 6},
+			{Kind: Close, Call: 7, Return: 8},
+		}, false},
+		{"DequeueFalseAfterClose", 0, []Operation{
+			{Kind: Close, Call: 1, Return: 2},
+			{Kind: Dequeue, Call: 3, Return: 4},
+		}, true},
+		{"TryEnqueueFull", 1, []Operation{
+			{Kind: TryEnqueue, Value: 1, OK: true, Call: 1, Return: 2},
+			{Kind: TryEnqueue, Value: 2, Call: 3, Return: 4},
+			{Kind: Close, Call: 5, Return: 6},
+			{Kind: TryEnqueue, Value: 3, Closed: true, Call: 7, Return: 8},
+		}, true},
+		{"EnqueueBeyondCapacity", 1, []Operation{
+			{Kind: Enqueue, Value: 1, Call: 1, Return: 2},
+			{Kind: Enqueue, Value: 2, Call: 3, Return: 4},
+		}, false},
+		{"FrontAndDrain", 0, []Operation{
+			{Kind: Enqueue, Value: 1, Call: 1, Return: 2},
+			{Kind: EnqueueFront, Value: 2, Call: 3, Return: 4},
+			{Kind: Peek, Item: 2, OK: true, Call: 5, Return: 6},
+			{Kind: Drain, Items: []int{2, 1}, Call: 7, Return: 8},
+			{Kind: TryDequeue, Call: 9, Return: 10},
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(tt.history, tt.capacity)
+			if got := err == nil; got != tt.want {
+				t.Errorf("Expected linearizable to be %v, got error %v", tt.want, err)
+			}
+		})
+	}
+}
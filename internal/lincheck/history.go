@@ -0,0 +1,240 @@
+// Package lincheck tests a queue for linearizability: it runs random
+// operations against the queue from several goroutines, records when each
+// call started and returned and what it returned, and checks that the
+// history could have come from a plain slice operated on one call at a time,
+// each call taking effect at some instant between its start and return.
+//
+// The package knows nothing of the queue under test. Run hands each
+// operation to a function that performs it on the queue and fills in the
+// results; the tests that wire up a queue live next to it.
+package lincheck
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Kind is the queue method an Operation calls.
+type Kind int
+
+const (
+	// Enqueue adds Value at the back, blocking while a bounded queue is full.
+	// It discards the value once the queue is closed.
+	Enqueue Kind = iota
+	// EnqueueFront adds Value at the front, otherwise like Enqueue.
+	EnqueueFront
+	// TryEnqueue adds Value at the back without blocking. OK reports whether
+	// it was added, and Closed whether it failed because the queue was
+	// closed rather than full.
+	TryEnqueue
+	// Dequeue removes the front item into Item, blocking while the queue is
+	// empty. OK is false once the queue is closed and drained.
+	Dequeue
+	// TryDequeue removes the front item into Item without blocking; OK is
+	// false if there was none.
+	TryDequeue
+	// Peek reads the front item into Item without removing it; OK is false
+	// if there was none.
+	Peek
+	// Size reads the number of items into Item.
+	Size
+	// Drain removes every item into Items.
+	Drain
+	// Close closes the queue.
+	Close
+)
+
+var kindNames = [...]string{"Enqueue", "EnqueueFront", "TryEnqueue", "Dequeue", "TryDequeue", "Peek", "Size", "Drain", "Close"}
+
+// String returns the name of the method.
+func (k Kind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return "Kind(unknown)"
+	}
+	return kindNames[k]
+}
+
+// Operation is one call in a history.
+type Operation struct {
+	Client int  // Goroutine that made the call.
+	Kind   Kind // Method called.
+	Value  int  // Argument of the enqueue kinds; every value in a history is unique.
+
+	// Results, filled in by the function passed to Run.
+	Item   int   // Item returned by Dequeue, TryDequeue and Peek; size returned by Size.
+	OK     bool  // Boolean result, as described for each Kind.
+	Closed bool  // For TryEnqueue, whether it failed with the queue closed.
+	Items  []int // Items returned by Drain.
+
+	// Logical times at which the call started and returned. Times come from
+	// one counter shared by all clients, so an operation whose Call is
+	// after another's Return really started after the other returned.
+	Call, Return int64
+}
+
+// String describes the operation and its result.
+func (op Operation) String() string {
+	var s string
+	switch op.Kind {
+	case Enqueue, EnqueueFront:
+		s = fmt.Sprintf("%v(%d)", op.Kind, op.Value)
+	case TryEnqueue:
+		s = fmt.Sprintf("%v(%d) = %v", op.Kind, op.Value, op.OK)
+		if op.Closed {
+			s += " closed"
+		}
+	case Dequeue, TryDequeue, Peek:
+		s = fmt.Sprintf("%v() = %d, %v", op.Kind, op.Item, op.OK)
+	case Size:
+		s = fmt.Sprintf("%v() = %d", op.Kind, op.Item)
+	case Drain:
+		s = fmt.Sprintf("%v() = %v", op.Kind, op.Items)
+	default:
+		s = fmt.Sprintf("%v()", op.Kind)
+	}
+	return fmt.Sprintf("client %d [%d, %d] %s", op.Client, op.Call, op.Return, s)
+}
+
+// Config describes the random histories Run generates.
+type Config struct {
+	// Seed picks the operations. The interleaving is up to the scheduler,
+	// so a seed reproduces the operations but not necessarily the failure.
+	Seed int64
+	// Clients is the number of goroutines making calls, and Ops the number
+	// of calls each makes. Their product must be below 64.
+	Clients, Ops int
+	// Capacity bounds the queue under test; zero means unbounded. Check
+	// must be given the same value.
+	Capacity int
+	// Timeout bounds how long Run waits for the calls to return once the
+	// queue is closed; zero means a second.
+	Timeout time.Duration
+}
+
+// Run performs a random history on a queue through do, which must call the
+// method given by op.Kind, with op.Value for the enqueue kinds, and record
+// the results in op. Besides the clients, Run closes the queue once the
+// clients stop making progress or have made a random number of calls, so
+// that every call can return.
+//
+// The history is returned in the order the calls started. Run returns an
+// error instead if calls are still blocked after Close: a queue whose Dequeue
+// did not return false once closed and drained would be caught here.
+func Run(cfg Config, do func(op *Operation)) ([]Operation, error) {
+	if cfg.Clients*cfg.Ops+1 > maxOps {
+		panic(fmt.Sprintf("lincheck: %d clients making %d calls each exceed %d operations", cfg.Clients, cfg.Ops, maxOps))
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Second
+	}
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	var clock, returned atomic.Int64
+	ops := make([]Operation, cfg.Clients*cfg.Ops+1)
+	finished := make([]atomic.Bool, len(ops))
+	next := 0
+	for c := 0; c < cfg.Clients; c++ {
+		for i := 0; i < cfg.Ops; i++ {
+			ops[next] = randomOperation(rng, c, next)
+			next++
+		}
+	}
+	ops[next] = Operation{Client: cfg.Clients, Kind: Close}
+	closeAfter := int64(rng.Intn(cfg.Clients*cfg.Ops + 1))
+	yields := make([]int, len(ops))
+	for i := range yields {
+		yields[i] = rng.Intn(3)
+	}
+
+	perform := func(i int) {
+		for y := 0; y < yields[i]; y++ {
+			runtime.Gosched()
+		}
+		op := &ops[i]
+		op.Call = clock.Add(1)
+		do(op)
+		op.Return = clock.Add(1)
+		finished[i].Store(true)
+		returned.Add(1)
+	}
+	var wg sync.WaitGroup
+	for c := 0; c < cfg.Clients; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			for i := c * cfg.Ops; i < (c+1)*cfg.Ops; i++ {
+				perform(i)
+			}
+		}(c)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// Close once enough calls returned, or when the clients are stuck
+		// waiting on each other, which an open queue may legitimately do.
+		last, idle := returned.Load(), 0
+		for n := last; n < closeAfter && idle < 20; n = returned.Load() {
+			if n != last {
+				last, idle = n, 0
+			} else {
+				idle++
+			}
+			time.Sleep(10 * time.Microsecond)
+		}
+		perform(len(ops) - 1)
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(cfg.Timeout):
+		// The blocked goroutines still own their operations, so only the
+		// fields set before they started are read.
+		var pending []string
+		for i := range ops {
+			if !finished[i].Load() {
+				pending = append(pending, fmt.Sprintf("client %d %v(%d)", ops[i].Client, ops[i].Kind, ops[i].Value))
+			}
+		}
+		return nil, fmt.Errorf("lincheck: calls still blocked %v after Close:\n\t%s", cfg.Timeout, strings.Join(pending, "\n\t"))
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].Call < ops[j].Call })
+	return ops, nil
+}
+
+// randomOperation returns a call by client, using value if it enqueues.
+// Enqueues and dequeues are weighted so that the queue is neither always
+// empty nor always full.
+func randomOperation(rng *rand.Rand, client, value int) Operation {
+	op := Operation{Client: client, Value: value}
+	switch n := rng.Intn(20); {
+	case n < 5:
+		op.Kind = Enqueue
+	case n < 7:
+		op.Kind = EnqueueFront
+	case n < 9:
+		op.Kind = TryEnqueue
+	case n < 13:
+		op.Kind = Dequeue
+	case n < 15:
+		op.Kind = TryDequeue
+	case n < 17:
+		op.Kind = Peek
+	case n < 18:
+		op.Kind = Size
+	case n < 19:
+		op.Kind = Drain
+	default:
+		op.Kind = Close
+	}
+	return op
+}
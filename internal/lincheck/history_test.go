@@ -0,0 +1,125 @@
+package lincheck
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sliceQueue is a simple queue guarded by a mutex, against which the harness
+// itself is tested. neverFalse and lifo break it on purpose.
+type sliceQueue struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	items      []int
+	closed     bool
+	capacity   int
+	neverFalse bool // Dequeue keeps waiting after Close.
+	lifo       bool // Dequeue takes the newest item.
+}
+
+func newSliceQueue(capacity int) *sliceQueue {
+	q := &sliceQueue{capacity: capacity}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *sliceQueue) do(op *Operation) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	full := func() bool { return q.capacity > 0 && len(q.items) >= q.capacity }
+	switch op.Kind {
+	case Enqueue, EnqueueFront:
+		for full() && !q.closed {
+			q.cond.Wait()
+		}
+		if q.closed {
+			return
+		}
+		if op.Kind == Enqueue {
+			q.items = append(q.items, op.Value)
+		} else {
+			q.items = append([]int{op.Value}, q.items...)
+		}
+	case TryEnqueue:
+		op.Closed = q.closed
+		if q.closed || full() {
+			return
+		}
+		q.items = append(q.items, op.Value)
+		op.OK = true
+	case Dequeue, TryDequeue, Peek:
+		for op.Kind == Dequeue && len(q.items) == 0 && (!q.closed || q.neverFalse) {
+			q.cond.Wait()
+		}
+		if len(q.items) == 0 {
+			return
+		}
+		i := 0
+		if q.lifo && op.Kind != Peek {
+			i = len(q.items) - 1
+		}
+		op.Item, op.OK = q.items[i], true
+		if op.Kind != Peek {
+			q.items = append(q.items[:i:i], q.items[i+1:]...)
+		}
+	case Size:
+		op.Item = len(q.items)
+	case Drain:
+		op.Items, q.items = q.items, nil
+	case Close:
+		q.closed = true
+	}
+	q.cond.Broadcast()
+}
+
+// Test that histories of a correct queue check out, bounded or not
+func TestRunCorrectQueue(t *testing.T) {
+	for seed := int64(0); seed < 200; seed++ {
+		cfg := Config{Seed: seed, Clients: 4, Ops: 8, Capacity: int(seed % 3)}
+		history, err := Run(cfg, newSliceQueue(cfg.Capacity).do)
+		if err == nil {
+			err = Check(history, cfg.Capacity)
+		}
+		if err != nil {
+			t.Fatalf("Seed %d: %v", seed, err)
+		}
+	}
+}
+
+// Test that Run reports a Dequeue that never returns false after Close
+func TestRunReportsBlockedCalls(t *testing.T) {
+	seed := int64(0)
+	for randomOperation(rand.New(rand.NewSource(seed)), 0, 0).Kind != Dequeue {
+		seed++
+	}
+	q := newSliceQueue(0)
+	q.neverFalse = true
+	_, err := Run(Config{Seed: seed, Clients: 1, Ops: 1, Timeout: 100 * time.Millisecond}, q.do)
+	if err == nil || !strings.Contains(err.Error(), "client 0 Dequeue") {
+		t.Errorf("Expected the blocked Dequeue to be reported, got %v", err)
+	}
+	q.mu.Lock()
+	q.neverFalse = false
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+// Test that Check catches a queue that serves items in the wrong order
+func TestRunCatchesWrongOrder(t *testing.T) {
+	for seed := int64(0); seed < 200; seed++ {
+		cfg := Config{Seed: seed, Clients: 3, Ops: 8}
+		q := newSliceQueue(0)
+		q.lifo = true
+		history, err := Run(cfg, q.do)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if Check(history, 0) != nil {
+			return
+		}
+	}
+	t.Error("Expected a LIFO queue to fail the check")
+}
@@ -0,0 +1,64 @@
+package threadsafequeue
+
+import "context"
+
+// TaskDone tells the queue that a consumer has finished with an item it
+// took, with Dequeue, TryDequeue, DequeueContext, Drain or any other way.
+// Each item stored needs one call once it has been taken and processed, for
+// Join to return; an item put back with EnqueueFront counts as a new one.
+// Items evicted by the DropOldest policy are never taken and need none.
+// TaskDone panics if called more times than items were taken, since that
+// means a call is in the wrong place.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) TaskDone() {
+	q.lock()
+	defer q.unlock()
+	if q.unfinished <= q.len() {
+		panic("threadsafequeue: TaskDone called more times than items were taken")
+	}
+	q.taskDone()
+}
+
+// Join blocks until every item stored in the queue has been taken and
+// marked done with TaskDone, and returns nil, or until ctx is done, and
+// returns ctx.Err(). It returns at once if no work is outstanding. Unlike
+// WaitUntilEmpty, which returns once the last item is taken, Join waits for
+// it to be processed as well.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) Join(ctx context.Context) error {
+	q.lock()
+	if q.unfinished == 0 {
+		q.unlock()
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		q.unlock()
+		return err
+	}
+	ch := make(chan struct{})
+	q.joinChans = append(q.joinChans, ch)
+	q.unlock()
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		q.lock()
+		defer q.unlock()
+		select {
+		case <-ch: // All done concurrently with ctx.
+			return nil
+		default:
+			q.joinChans = removeChan(q.joinChans, ch)
+			return ctx.Err()
+		}
+	}
+}
+
+// taskDone counts one item as finished, releasing the calls to Join once
+// none is left. The caller must hold q.mu exclusively.
+func (q *ThreadSafeQueue) taskDone() {
+	q.unfinished--
+	if q.unfinished == 0 && len(q.joinChans) > 0 {
+		q.joinChans = closeAll(q.joinChans)
+	}
+}
@@ -0,0 +1,89 @@
+package threadsafequeue
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test that Join waits for the last item to be processed, not just taken
+func TestJoin(t *testing.T) {
+	q := NewThreadSafeQueue()
+	const items = 100
+	for i := 0; i < items; i++ {
+		q.Enqueue(i)
+	}
+	var processed atomic.Int64
+	for c := 0; c < 4; c++ {
+		go func() {
+			for {
+				if _, ok := q.Dequeue(); !ok {
+					return
+				}
+				time.Sleep(100 * time.Microsecond) // Processing.
+				processed.Add(1)
+				q.TaskDone()
+			}
+		}()
+	}
+	if err := q.Join(context.Background()); err != nil {
+		t.Fatalf("Expected Join to return nil, but got %v", err)
+	}
+	if got := processed.Load(); got != items {
+		t.Errorf("Expected Join to return once all %d items were processed, but %d were", items, got)
+	}
+	q.Close()
+}
+
+// Test that Join returns at once without outstanding work, and reports
+// cancellation
+func TestJoinEnds(t *testing.T) {
+	q := NewThreadSafeQueue()
+	if err := q.Join(context.Background()); err != nil {
+		t.Errorf("Expected Join on a new queue to return nil, but got %v", err)
+	}
+	q.Enqueue(1)
+	q.TryDequeue()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.Join(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected Join with an unfinished item to return %v, but got %v", context.DeadlineExceeded, err)
+	}
+	q.TaskDone()
+	if err := q.Join(context.Background()); err != nil {
+		t.Errorf("Expected Join to return nil once the item is done, but got %v", err)
+	}
+}
+
+// Test that items evicted by DropOldest need no TaskDone
+func TestJoinDropOldest(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(2), WithOverflowPolicy(DropOldest))
+	for i := 0; i < 5; i++ {
+		q.Enqueue(i)
+	}
+	q.TryEnqueue(5)
+	for range q.Drain() {
+		q.TaskDone()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := q.Join(ctx); err != nil {
+		t.Errorf("Expected Join to return nil, but got %v", err)
+	}
+}
+
+// Test that TaskDone panics when called more times than items were taken
+func TestTaskDoneTooMany(t *testing.T) {
+	q := NewThreadSafeQueue()
+	q.Enqueue(1)
+	q.Enqueue(2)
+	q.TryDequeue()
+	q.TaskDone()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected TaskDone to panic with no item taken")
+		}
+	}()
+	q.TaskDone() // 2 is still queued.
+}
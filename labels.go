@@ -0,0 +1,32 @@
+package threadsafequeue
+
+import (
+	"runtime/pprof"
+	"strconv"
+)
+
+// Profiler label keys of RunWorkers.
+const (
+	labelQueue  = "threadsafequeue.queue"
+	labelWorker = "threadsafequeue.worker"
+	labelItem   = "threadsafequeue.item"
+)
+
+// WithItemLabel labels each handler call with the label threadsafequeue.item,
+// set to what fn returns for the item, such as its kind or its tenant, on
+// top of the labels of its worker. Unlike those, it costs a pprof.Do per
+// item, so fn should be cheap and return few distinct values.
+func WithItemLabel(fn func(item interface{}) string) WorkerOption {
+	return func(p *workerPool) {
+		p.itemLabel = fn
+	}
+}
+
+// labels returns the profiler labels of worker w: its index, and the name
+// of the queue, if any.
+func (p *workerPool) labels(w *worker) pprof.LabelSet {
+	if p.q.name == "" {
+		return pprof.Labels(labelWorker, strconv.Itoa(w.index))
+	}
+	return pprof.Labels(labelQueue, p.q.name, labelWorker, strconv.Itoa(w.index))
+}
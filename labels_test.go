@@ -0,0 +1,104 @@
+package threadsafequeue
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// handlerLabels returns a handler that records the profiler labels of the
+// context of each call.
+func handlerLabels() (func(ctx context.Context, item interface{}) error, func() []map[string]string) {
+	var mu sync.Mutex
+	var got []map[string]string
+	handler := func(ctx context.Context, item interface{}) error {
+		labels := make(map[string]string)
+		pprof.ForLabels(ctx, func(key, value string) bool {
+			labels[key] = value
+			return true
+		})
+		mu.Lock()
+		got = append(got, labels)
+		mu.Unlock()
+		return nil
+	}
+	return handler, func() []map[string]string {
+		mu.Lock()
+		defer mu.Unlock()
+		return got
+	}
+}
+
+// Test that handlers see the labels of the queue, of their worker and of
+// their item
+func TestWorkerLabels(t *testing.T) {
+	q := NewThreadSafeQueue(WithName("emails"))
+	for i := 0; i < 10; i++ {
+		q.Enqueue(i)
+	}
+	q.Close()
+	handler, got := handlerLabels()
+	err := q.RunWorkers(context.Background(), 2, handler, WithItemLabel(func(item interface{}) string {
+		return fmt.Sprintf("kind%d", item.(int)%2)
+	}))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	calls := got()
+	if len(calls) != 10 {
+		t.Fatalf("Expected 10 calls, got %d", len(calls))
+	}
+	for _, labels := range calls {
+		if labels[labelQueue] != "emails" || (labels[labelWorker] != "0" && labels[labelWorker] != "1") ||
+			(labels[labelItem] != "kind0" && labels[labelItem] != "kind1") || len(labels) != 3 {
+			t.Errorf("Expected the queue, worker and item labels, got %v", labels)
+		}
+	}
+}
+
+// Test that without a name or an item label handlers see only the worker
+// label
+func TestWorkerLabelsDefault(t *testing.T) {
+	q := NewThreadSafeQueue()
+	q.Enqueue(1)
+	q.Close()
+	handler, got := handlerLabels()
+	if err := q.RunWorkers(context.Background(), 1, handler); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if calls := got(); len(calls) != 1 || len(calls[0]) != 1 || calls[0][labelWorker] != "0" {
+		t.Errorf("Expected only the worker label 0, got %v", calls)
+	}
+}
+
+// Test that the worker goroutines carry the labels in goroutine profiles
+func TestWorkerLabelsProfile(t *testing.T) {
+	q := NewThreadSafeQueue(WithName("emails"))
+	started, release := make(chan struct{}), make(chan struct{})
+	result := make(chan error, 1)
+	go func() {
+		result <- q.RunWorkers(context.Background(), 1, func(ctx context.Context, item interface{}) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	q.Enqueue(1)
+	<-started
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		t.Fatalf("Expected a goroutine profile, got %v", err)
+	}
+	if !strings.Contains(buf.String(), `"threadsafequeue.queue":"emails"`) {
+		t.Error("Expected the queue label in the goroutine profile")
+	}
+	close(release)
+	q.Close()
+	if err := <-result; err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
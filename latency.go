@@ -0,0 +1,202 @@
+package threadsafequeue
+
+import "time"
+
+// latencyBounds are the upper bounds of the buckets of LatencyStats.
+var latencyBounds = [...]time.Duration{
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+	time.Minute,
+}
+
+// LatencyBucketBounds returns the upper bounds of LatencyStats.Buckets, from
+// the shortest: bucket i counts waits longer than bound i-1 and no longer
+// than bound i, and the last bucket, which has no bound, counts the waits
+// longer than every bound.
+func LatencyBucketBounds() []time.Duration {
+	return append([]time.Duration(nil), latencyBounds[:]...)
+}
+
+// LatencyStats aggregates how long items waited in the queue, from being
+// enqueued to being removed by a consumer or Drain. Items discarded by the
+// overflow policy are not counted.
+type LatencyStats struct {
+	Count   uint64                         // Number of waits recorded.
+	Mean    time.Duration                  // Average wait.
+	Max     time.Duration                  // Longest wait.
+	Buckets [len(latencyBounds) + 1]uint64 // Waits per bucket of LatencyBucketBounds.
+}
+
+// WithLatencyTracking makes the queue measure how long each item waits, and
+// report the aggregate in Stats().Latency and the age of the front item in
+// OldestItemAge. The enqueue time of each item is kept beside it in the
+// queue, so the item handed to consumers is the one that was enqueued.
+// Tracking costs a clock reading on each enqueue and dequeue; with it off,
+// the queue pays a single branch per operation and allocates nothing.
+func WithLatencyTracking(enabled bool) Option {
+	return func(q *ThreadSafeQueue) {
+		q.latency = enabled
+	}
+}
+
+// OldestItemAge returns how long the item at the front of the queue has been
+// waiting, in O(1). The boolean is false if the queue is empty or does not
+// track latency: the age comes from the enqueue times kept by
+// WithLatencyTracking.
+//
+// The age counts from when the item was last stored. An item put back with
+// EnqueueFront, or by FanOut and ProcessOrdered when interrupted, is a new
+// enqueue and starts aging again, so the age is how long the item has been
+// waiting this time round, not since its first enqueue; one put back with
+// Requeue keeps its first enqueue time.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) OldestItemAge() (time.Duration, bool) {
+	q.rlock()
+	defer q.mu.RUnlock()
+	if !q.latency {
+		return 0, false
+	}
+	since, ok := q.stamps.front()
+	if !ok {
+		return 0, false
+	}
+	return q.clock.Now().Sub(since), true
+}
+
+// OnWait registers f to receive the wait of every item that leaves the queue
+// through a consumer or Drain, as measured by WithLatencyTracking, for
+// feeding a histogram of an external metrics library; it is never called on
+// a queue without latency tracking. A later call replaces f, and nil removes
+// it. f runs under the queue's lock, so it must be quick and must not use the
+// queue.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) OnWait(f func(wait time.Duration)) {
+	q.lock()
+	q.onWait = f
+	q.unlock()
+}
+
+// latencyStats is the running aggregate behind LatencyStats, protected by
+// the queue's lock.
+type latencyStats struct {
+	count   uint64
+	total   time.Duration
+	max     time.Duration
+	buckets [len(latencyBounds) + 1]uint64
+}
+
+// observe records one wait.
+func (l *latencyStats) observe(d time.Duration) {
+	l.count++
+	l.total += d
+	if d > l.max {
+		l.max = d
+	}
+	i := 0
+	for i < len(latencyBounds) && d > latencyBounds[i] {
+		i++
+	}
+	l.buckets[i]++
+}
+
+// snapshot returns the aggregate as LatencyStats.
+func (l *latencyStats) snapshot() LatencyStats {
+	s := LatencyStats{Count: l.count, Max: l.max, Buckets: l.buckets}
+	if l.count > 0 {
+		s.Mean = l.total / time.Duration(l.count)
+	}
+	return s
+}
+
+// DequeueWithTime is like Dequeue but also returns when the item was
+// enqueued, so that a consumer can skip stale items. The time is taken inside
+// the critical section that stores the item, so items come out in the order
+// of their times, and is kept only with WithLatencyTracking(true); without
+// it, the time is zero.
+//
+// An item enqueued again after being dequeued, with Enqueue or EnqueueFront,
+// is a new item and gets a new time. To put an item back and keep its time,
+// as when a consumer gives up on it, use Requeue.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) DequeueWithTime() (interface{}, time.Time, bool) {
+	item, x, ok := q.dequeueExtra()
+	return item, x.enqueuedAt, ok
+}
+
+// Requeue puts back at the front of the queue an item a consumer took but
+// could not handle, keeping enqueuedAt, the time DequeueWithTime returned
+// with it, as its enqueue time instead of stamping it anew. Its wait, age
+// and time then count from its first enqueue. A zero enqueuedAt stamps the
+// item with the current time, as EnqueueFront does, which it is like in every
+// other way.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) Requeue(item interface{}, enqueuedAt time.Time) {
+	q.mustValidate(item)
+	item = q.copyItem(item)
+	q.lock()
+	q.put(nil, item, extra{enqueuedAt: enqueuedAt}, true)
+	q.unlock()
+}
+
+// stampAdded keeps the enqueue time of an item just stored at the front or
+// the back of the queue: at, if it is not zero, or now. The caller must hold
+// q.mu.
+func (q *ThreadSafeQueue) stampAdded(at time.Time, front bool) {
+	if !q.latency {
+		return
+	}
+	if at.IsZero() {
+		at = q.clock.Now()
+	}
+	if front {
+		q.stamps.pushFront(at)
+	} else {
+		q.stamps.pushBack(at)
+	}
+}
+
+// stampRemoved drops the enqueue time of the item just removed from the
+// front of the queue. The caller must hold q.mu.
+func (q *ThreadSafeQueue) stampRemoved() {
+	if !q.latency {
+		return
+	}
+	q.stamps.popFront()
+}
+
+// observeWait records the wait of the front item, which is about to go to a
+// consumer. The caller must hold q.mu.
+func (q *ThreadSafeQueue) observeWait() {
+	if !q.latency {
+		return
+	}
+	if since, ok := q.stamps.front(); ok {
+		q.observe(q.clock.Now().Sub(since))
+	}
+}
+
+// stampsCleared records the waits of every item, all removed at once by
+// Drain, and drops their enqueue times. The caller must hold q.mu.
+func (q *ThreadSafeQueue) stampsCleared() {
+	if !q.latency {
+		return
+	}
+	now := q.clock.Now()
+	for since, ok := q.stamps.popFront(); ok; since, ok = q.stamps.popFront() {
+		if !since.IsZero() { // Zero in the slot of a cancelled item.
+			q.observe(now.Sub(since))
+		}
+	}
+}
+
+// observe records the wait of one item. The caller must hold q.mu.
+func (q *ThreadSafeQueue) observe(d time.Duration) {
+	q.waits.observe(d)
+	q.deltaWaits.observe(d)
+	if q.onWait != nil {
+		q.onWait(d)
+	}
+}
@@ -0,0 +1,229 @@
+package threadsafequeue
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test that latency tracking aggregates how long dequeued items waited,
+// whichever way they leave the queue
+func TestLatencyTracking(t *testing.T) {
+	c := newManualClock()
+	q := NewThreadSafeQueue(WithLatencyTracking(true), WithClock(c), WithCapacity(3), WithOverflowPolicy(DropOldest))
+	q.Enqueue("a")
+	c.advance(5 * time.Millisecond)
+	q.EnqueueFront("b")
+	c.advance(5 * time.Millisecond)
+	if item, _ := q.Dequeue(); item != "b" {
+		t.Errorf("Expected the item itself to be dequeued, got %v", item)
+	}
+	if item, _ := q.TryDequeue(); item != "a" {
+		t.Errorf("Expected the item itself to be dequeued, got %v", item)
+	}
+	for i := 0; i < 4; i++ {
+		q.Enqueue(i) // The last one evicts 0, which is not counted.
+	}
+	c.advance(2 * time.Second)
+	q.Drain()
+
+	l := q.Stats().Latency
+	if l.Count != 5 {
+		t.Errorf("Expected 5 waits, got %d", l.Count)
+	}
+	if l.Max != 2*time.Second {
+		t.Errorf("Expected a longest wait of 2s, got %v", l.Max)
+	}
+	if want := (5*time.Millisecond + 10*time.Millisecond + 6*time.Second) / 5; l.Mean != want {
+		t.Errorf("Expected a mean wait of %v, got %v", want, l.Mean)
+	}
+	want := [len(latencyBounds) + 1]uint64{0, 2, 0, 0, 3, 0, 0}
+	if l.Buckets != want {
+		t.Errorf("Expected buckets %v, got %v", want, l.Buckets)
+	}
+}
+
+// Test that items handed straight to a parked consumer are counted
+func TestLatencyTrackingHandOff(t *testing.T) {
+	q := NewThreadSafeQueue(WithLatencyTracking(true))
+	done := make(chan struct{})
+	go func() {
+		q.Dequeue()
+		close(done)
+	}()
+	awaitCount(t, q.WaitingConsumers, 1)
+	q.Enqueue(1)
+	<-done
+	if n := q.Stats().Latency.Count; n != 1 {
+		t.Errorf("Expected 1 wait, got %d", n)
+	}
+}
+
+// Test that the buckets are placed by their upper bounds, inclusive
+func TestLatencyBuckets(t *testing.T) {
+	bounds := LatencyBucketBounds()
+	if !reflect.DeepEqual(bounds, latencyBounds[:]) {
+		t.Errorf("Expected bounds %v, got %v", latencyBounds, bounds)
+	}
+	bounds[0] = 0 // The copy is the caller's.
+	var l latencyStats
+	l.observe(0)
+	l.observe(time.Millisecond)
+	l.observe(time.Millisecond + 1)
+	l.observe(time.Hour)
+	if l.buckets[0] != 2 || l.buckets[1] != 1 || l.buckets[len(latencyBounds)] != 1 {
+		t.Errorf("Expected waits of 0, 1ms, just over 1ms and 1h in buckets 0, 0, 1 and the last, got %v", l.buckets)
+	}
+}
+
+// Test that a queue without latency tracking keeps no times and reports
+// nothing
+func TestLatencyTrackingOff(t *testing.T) {
+	q := NewThreadSafeQueue()
+	q.Enqueue(1)
+	q.Dequeue()
+	if q.stamps.cap() != 0 {
+		t.Error("Expected no enqueue times to be kept")
+	}
+	if l := q.Stats().Latency; l != (LatencyStats{}) {
+		t.Errorf("Expected no latency stats, got %+v", l)
+	}
+	if n := testing.AllocsPerRun(100, func() {
+		q.Enqueue(1)
+		q.Dequeue()
+	}); n != 0 {
+		t.Errorf("Expected no allocations without latency tracking, got %v", n)
+	}
+}
+
+// Test that OldestItemAge follows the front item as items flow, and that an
+// item put back at the front ages from when it was put back
+func TestOldestItemAge(t *testing.T) {
+	c := newManualClock()
+	q := NewThreadSafeQueue(WithLatencyTracking(true), WithClock(c))
+	check := func(want time.Duration, wantOK bool) {
+		t.Helper()
+		if age, ok := q.OldestItemAge(); age != want || ok != wantOK {
+			t.Errorf("Expected an age of %v, %v, got %v, %v", want, wantOK, age, ok)
+		}
+	}
+	check(0, false)
+	q.Enqueue(1)
+	c.advance(time.Second)
+	q.Enqueue(2)
+	check(time.Second, true)
+	c.advance(2 * time.Second)
+	check(3*time.Second, true)
+
+	item, _ := q.Dequeue()
+	check(2*time.Second, true) // Item 2 is now at the front.
+	c.advance(time.Second)
+	q.EnqueueFront(item)
+	check(0, true)
+	q.Dequeue()
+	check(3*time.Second, true)
+
+	q.Drain()
+	check(0, false)
+	q.Enqueue(3)
+	c.advance(time.Minute)
+	check(time.Minute, true)
+
+	q = NewThreadSafeQueue()
+	q.Enqueue(1)
+	if _, ok := q.OldestItemAge(); ok {
+		t.Error("Expected no age without latency tracking")
+	}
+}
+
+// Test that OnWait receives each recorded wait until it is removed
+func TestOnWait(t *testing.T) {
+	c := newManualClock()
+	q := NewThreadSafeQueue(WithLatencyTracking(true), WithClock(c))
+	var waits []time.Duration
+	q.OnWait(func(d time.Duration) { waits = append(waits, d) })
+	q.Enqueue(1)
+	q.Enqueue(2)
+	c.advance(time.Second)
+	q.Dequeue()
+	c.advance(time.Second)
+	q.Drain()
+	q.OnWait(nil)
+	q.Enqueue(3)
+	q.Dequeue()
+	if want := []time.Duration{time.Second, 2 * time.Second}; !reflect.DeepEqual(waits, want) {
+		t.Errorf("Expected waits %v, got %v", want, waits)
+	}
+}
+
+// Test that DequeueWithTime returns when each item was enqueued, that
+// Requeue keeps that time and that enqueueing again does not
+func TestDequeueWithTime(t *testing.T) {
+	c := newManualClock()
+	q := NewThreadSafeQueue(WithLatencyTracking(true), WithClock(c))
+	start := c.Now()
+	q.Enqueue("a")
+	c.advance(time.Second)
+	q.Enqueue("b")
+	c.advance(time.Second)
+
+	item, at, ok := q.DequeueWithTime()
+	if !ok || item != "a" || !at.Equal(start) {
+		t.Errorf("Expected a enqueued at %v, got %v at %v, %v", start, item, at, ok)
+	}
+	q.Requeue(item, at) // Given up on: back to the front with its time.
+	if age, _ := q.OldestItemAge(); age != 2*time.Second {
+		t.Errorf("Expected the requeued item to be 2s old, got %v", age)
+	}
+	item, at, _ = q.DequeueWithTime()
+	if item != "a" || !at.Equal(start) {
+		t.Errorf("Expected a to keep its time %v, got %v at %v", start, item, at)
+	}
+
+	q.Enqueue(item) // A new enqueue, with a new time.
+	_, at, _ = q.DequeueWithTime()
+	if want := start.Add(time.Second); !at.Equal(want) {
+		t.Errorf("Expected b enqueued at %v, got %v", want, at)
+	}
+	_, at, _ = q.DequeueWithTime()
+	if want := start.Add(2 * time.Second); !at.Equal(want) {
+		t.Errorf("Expected a enqueued again at %v, got %v", want, at)
+	}
+
+	q.Requeue("c", time.Time{})
+	if _, at, _ := q.DequeueWithTime(); !at.Equal(c.Now()) {
+		t.Errorf("Expected Requeue with no time to stamp the item now, got %v", at)
+	}
+}
+
+// Test that times are in enqueue order under concurrent producers, and zero
+// without latency tracking
+func TestDequeueWithTimeOrder(t *testing.T) {
+	q := NewThreadSafeQueue(WithLatencyTracking(true))
+	var wg sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				q.Enqueue(i)
+			}
+		}()
+	}
+	wg.Wait()
+	var last time.Time
+	for !q.IsEmpty() {
+		_, at, _ := q.DequeueWithTime()
+		if at.Before(last) {
+			t.Fatalf("Expected times in enqueue order, got %v after %v", at, last)
+		}
+		last = at
+	}
+
+	q = NewThreadSafeQueue()
+	q.Enqueue(1)
+	if _, at, ok := q.DequeueWithTime(); !ok || !at.IsZero() {
+		t.Errorf("Expected a zero time without latency tracking, got %v, %v", at, ok)
+	}
+}
@@ -0,0 +1,176 @@
+package threadsafequeue
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned by TryEnqueue when the enqueue rate limit set by
+// WithEnqueueRateLimit leaves no room for the item.
+var ErrRateLimited = errors.New("threadsafequeue: enqueue rate limited")
+
+// WithEnqueueRateLimit limits the rate at which items enter the queue to
+// perSecond on average, with bursts of up to burst items, to shield the
+// queue and its consumers from a producer that floods it. The limit is a
+// token bucket shared by all the producers: Enqueue and the other blocking
+// enqueue methods wait for a token, EnqueueContext giving up when its
+// context is done, and TryEnqueue returns ErrRateLimited instead. A batch
+// takes a token per item. Producers wait without holding the queue's lock,
+// in the order they arrived, and Close ends their wait. The total time they
+// waited is reported as Stats.Throttled. Items put back with Requeue or
+// restored by Load are not limited.
+func WithEnqueueRateLimit(perSecond float64, burst int) Option {
+	if !(perSecond > 0) || burst < 1 {
+		panic("threadsafequeue: WithEnqueueRateLimit needs a positive rate and burst")
+	}
+	return func(q *ThreadSafeQueue) {
+		q.limit.Store(newLimiter(perSecond, burst))
+	}
+}
+
+// SetEnqueueRateLimit changes the limit set by WithEnqueueRateLimit, or sets
+// one, while the queue is in use. Producers already waiting keep their place
+// and the time they were given; the tokens saved up are cut to the new burst.
+// A rate of zero removes the limit.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) SetEnqueueRateLimit(perSecond float64, burst int) {
+	if perSecond == 0 {
+		q.limit.Store(nil)
+		return
+	}
+	if !(perSecond > 0) || burst < 1 {
+		panic("threadsafequeue: SetEnqueueRateLimit needs a positive rate and burst")
+	}
+	q.lock() // For the clock.
+	now := q.clock.Now()
+	q.unlock()
+	for {
+		if l := q.limit.Load(); l != nil {
+			l.set(now, perSecond, burst)
+			return
+		}
+		if q.limit.CompareAndSwap(nil, newLimiter(perSecond, burst)) {
+			return
+		}
+	}
+}
+
+// limiter is a token bucket. It has a lock of its own, so producers can take
+// tokens without the queue's lock.
+type limiter struct {
+	mu     sync.Mutex
+	rate   float64   // Tokens added per second.
+	burst  float64   // Tokens the bucket holds.
+	tokens float64   // Tokens in the bucket; negative when producers are owed some.
+	last   time.Time // When tokens was last brought up to date; zero at first.
+}
+
+func newLimiter(perSecond float64, burst int) *limiter {
+	return &limiter{rate: perSecond, burst: float64(burst), tokens: float64(burst)}
+}
+
+// advance adds the tokens earned since the last call. The caller must hold
+// l.mu.
+func (l *limiter) advance(now time.Time) {
+	if !l.last.IsZero() && now.After(l.last) {
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	if now.After(l.last) {
+		l.last = now
+	}
+}
+
+// reserve takes n tokens, going into debt if need be, and returns how long
+// to wait until they are earned.
+func (l *limiter) reserve(now time.Time, n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(now)
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(-l.tokens / l.rate * float64(time.Second)))
+}
+
+// take takes n tokens if the bucket has them.
+func (l *limiter) take(now time.Time, n int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(now)
+	if l.tokens < float64(n) {
+		return false
+	}
+	l.tokens -= float64(n)
+	return true
+}
+
+// cancel gives back n tokens reserved by a producer that stopped waiting.
+func (l *limiter) cancel(n int) {
+	l.mu.Lock()
+	l.tokens = math.Min(l.burst, l.tokens+float64(n))
+	l.mu.Unlock()
+}
+
+// set changes the rate and the burst, counting the tokens earned so far at
+// the old rate.
+func (l *limiter) set(now time.Time, perSecond float64, burst int) {
+	l.mu.Lock()
+	l.advance(now)
+	l.rate = perSecond
+	l.burst = float64(burst)
+	l.tokens = math.Min(l.burst, l.tokens)
+	l.mu.Unlock()
+}
+
+// throttle waits, without holding q.mu, for the enqueue rate limit, if any,
+// to let n items in, and adds the wait to the throttled time. It returns
+// early when the queue is closed, leaving put to refuse the items, and with
+// ctx.Err() when a non-nil ctx is done, counting the items as rejected.
+func (q *ThreadSafeQueue) throttle(ctx context.Context, n int) error {
+	l := q.limit.Load()
+	if l == nil {
+		return nil
+	}
+	start := q.clock.Now()
+	wait := l.reserve(start, n)
+	if wait <= 0 {
+		return nil
+	}
+	q.lock()
+	done := q.done()
+	q.unlock()
+	var cancel <-chan struct{}
+	if ctx != nil {
+		cancel = ctx.Done()
+	}
+	t := q.clock.NewTimer(wait)
+	var err error
+	select {
+	case <-t.C():
+	case <-done:
+		t.Stop()
+		l.cancel(n)
+	case <-cancel:
+		t.Stop()
+		l.cancel(n)
+		err = ctx.Err()
+	}
+	q.lock()
+	q.throttled += q.clock.Now().Sub(start)
+	if err != nil {
+		q.rejected += uint64(n)
+	}
+	q.unlock()
+	return err
+}
+
+// rateLimited reports whether the enqueue rate limit, if any, refuses an
+// item now, taking a token for it otherwise. The caller must hold q.mu.
+func (q *ThreadSafeQueue) rateLimited() bool {
+	l := q.limit.Load()
+	return l != nil && !l.take(q.clock.Now(), 1)
+}
@@ -0,0 +1,161 @@
+package threadsafequeue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test that the enqueue rate limit is shared by all producers
+func TestEnqueueRateLimit(t *testing.T) {
+	q := NewThreadSafeQueue(WithEnqueueRateLimit(200, 5))
+	start := time.Now()
+	var wg sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				q.Enqueue(i)
+			}
+		}()
+	}
+	wg.Wait()
+	// 5 items pass at once and the other 35 at 200 per second.
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("Expected 40 items to take at least 175ms, took %v", elapsed)
+	}
+	s := q.Stats()
+	if s.Enqueued != 40 {
+		t.Errorf("Expected 40 items enqueued, got %d", s.Enqueued)
+	}
+	if s.Throttled <= 0 {
+		t.Errorf("Expected producers to be throttled, got %v", s.Throttled)
+	}
+	if d := q.StatsDelta(); d.Throttled != s.Throttled {
+		t.Errorf("Expected the first delta to count %v throttled, got %v", s.Throttled, d.Throttled)
+	}
+}
+
+// Test that TryEnqueue fails once the burst is used up
+func TestTryEnqueueRateLimit(t *testing.T) {
+	q := NewThreadSafeQueue(WithEnqueueRateLimit(1, 3))
+	for i := 0; i < 3; i++ {
+		if err := q.TryEnqueue(i); err != nil {
+			t.Fatalf("Expected item %d to be within the burst, got %v", i, err)
+		}
+	}
+	if err := q.TryEnqueue(3); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited, got %v", err)
+	}
+	if s := q.Stats(); s.Enqueued != 3 || s.Rejected != 1 {
+		t.Errorf("Expected 3 items enqueued and 1 rejected, got %d and %d", s.Enqueued, s.Rejected)
+	}
+}
+
+// limiterTokens returns the tokens in the bucket of the enqueue rate limit
+func limiterTokens(q *ThreadSafeQueue) float64 {
+	l := q.limit.Load()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.tokens
+}
+
+// Test that EnqueueContext gives up waiting for the limit without holding
+// the queue's lock, and gives its token back
+func TestEnqueueContextRateLimit(t *testing.T) {
+	q := NewThreadSafeQueue(WithEnqueueRateLimit(10, 1))
+	q.Enqueue(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() {
+		errc <- q.EnqueueContext(ctx, 1)
+	}()
+	awaitCount(t, func() int {
+		if limiterTokens(q) < 0 {
+			return 1
+		}
+		return 0
+	}, 1)
+	if item, ok := q.TryDequeue(); !ok || item != 0 {
+		t.Errorf("Expected to dequeue 0 while the producer waits, got %v and %v", item, ok)
+	}
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if s := q.Stats(); s.Size != 0 || s.Rejected != 1 {
+		t.Errorf("Expected no items and 1 rejected, got %d and %d", s.Size, s.Rejected)
+	}
+	if tokens := limiterTokens(q); tokens < 0 {
+		t.Errorf("Expected the token to be given back, got %v tokens", tokens)
+	}
+}
+
+// Test that Close ends the wait of a throttled producer
+func TestEnqueueRateLimitClose(t *testing.T) {
+	q := NewThreadSafeQueue(WithEnqueueRateLimit(0.001, 1))
+	q.Enqueue(0)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.Enqueue(1)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	q.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Close to release the throttled producer")
+	}
+	if s := q.Stats(); s.Enqueued != 1 || s.Rejected != 1 {
+		t.Errorf("Expected 1 item enqueued and 1 rejected, got %d and %d", s.Enqueued, s.Rejected)
+	}
+}
+
+// Test that SetEnqueueRateLimit sets, changes and removes the limit
+func TestSetEnqueueRateLimit(t *testing.T) {
+	var q ThreadSafeQueue
+	q.SetEnqueueRateLimit(1, 2)
+	for i := 0; i < 2; i++ {
+		if err := q.TryEnqueue(i); err != nil {
+			t.Fatalf("Expected item %d to be within the burst, got %v", i, err)
+		}
+	}
+	if err := q.TryEnqueue(2); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited, got %v", err)
+	}
+	q.SetEnqueueRateLimit(100, 1)
+	time.Sleep(20 * time.Millisecond)
+	if err := q.TryEnqueue(2); err != nil {
+		t.Errorf("Expected the faster rate to allow an item, got %v", err)
+	}
+	if err := q.TryEnqueue(3); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected the burst of 1 to refuse a second item, got %v", err)
+	}
+	q.SetEnqueueRateLimit(0, 0)
+	for i := 3; i < 10; i++ {
+		if err := q.TryEnqueue(i); err != nil {
+			t.Fatalf("Expected no limit, got %v", err)
+		}
+	}
+}
+
+// Test that WithEnqueueRateLimit rejects a rate or burst that is not positive
+func TestEnqueueRateLimitInvalid(t *testing.T) {
+	for _, c := range []struct {
+		rate  float64
+		burst int
+	}{{0, 1}, {-1, 1}, {1, 0}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected a panic for rate %v and burst %d", c.rate, c.burst)
+				}
+			}()
+			WithEnqueueRateLimit(c.rate, c.burst)
+		}()
+	}
+}
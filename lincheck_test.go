@@ -0,0 +1,88 @@
+package threadsafequeue
+
+import (
+	"flag"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sandeepkv93/threadsafequeue/internal/lincheck"
+)
+
+var lincheckSeed = flag.Int64("lincheck.seed", 0, "run TestLinearizability once per configuration with this seed")
+
+// Test that random concurrent histories of queue operations are
+// linearizable, checking them against a plain slice. A failure names its
+// seed, which -lincheck.seed replays; the interleaving may differ, so a
+// replay can take a few runs to fail again.
+func TestLinearizability(t *testing.T) {
+	configs := []struct {
+		name string
+		opts []Option
+		cap  int
+	}{
+		{"Unbounded", nil, 0},
+		{"Capacity1", []Option{WithCapacity(1)}, 1},
+		{"Capacity3", []Option{WithCapacity(3)}, 3},
+		{"Chunked", []Option{WithChunkedStorage(2)}, 0},
+		{"SpinThenBlock", []Option{WithCapacity(2), WithWaitStrategy(WaitSpinThenBlock)}, 2},
+	}
+	iterations := 300
+	if testing.Short() {
+		iterations = 30
+	}
+	seed := time.Now().UnixNano()
+	if *lincheckSeed != 0 {
+		seed, iterations = *lincheckSeed, 1
+	}
+	for _, c := range configs {
+		t.Run(c.name, func(t *testing.T) {
+			for i := 0; i < iterations; i++ {
+				cfg := lincheck.Config{Seed: seed + int64(i), Clients: 4, Ops: 8, Capacity: c.cap}
+				q := NewThreadSafeQueue(c.opts...)
+				history, err := lincheck.Run(cfg, lincheckDo(q))
+				if err == nil {
+					err = lincheck.Check(history, c.cap)
+				}
+				if err != nil {
+					t.Fatalf("Seed %d: %v", cfg.Seed, err)
+				}
+			}
+		})
+	}
+}
+
+// lincheckDo returns the function through which lincheck.Run operates on q.
+func lincheckDo(q *ThreadSafeQueue) func(op *lincheck.Operation) {
+	return func(op *lincheck.Operation) {
+		var item interface{}
+		switch op.Kind {
+		case lincheck.Enqueue:
+			q.Enqueue(op.Value)
+		case lincheck.EnqueueFront:
+			q.EnqueueFront(op.Value)
+		case lincheck.TryEnqueue:
+			err := q.TryEnqueue(op.Value)
+			op.OK, op.Closed = err == nil, err == ErrClosed
+		case lincheck.Dequeue:
+			item, op.OK = q.Dequeue()
+		case lincheck.TryDequeue:
+			item, op.OK = q.TryDequeue()
+		case lincheck.Peek:
+			item, op.OK = q.Peek()
+		case lincheck.Size:
+			op.Item = q.Size()
+		case lincheck.Drain:
+			for _, item := range q.Drain() {
+				op.Items = append(op.Items, item.(int))
+			}
+		case lincheck.Close:
+			q.Close()
+		default:
+			panic(fmt.Sprintf("unexpected operation %v", op.Kind))
+		}
+		if op.OK && item != nil {
+			op.Item = item.(int)
+		}
+	}
+}
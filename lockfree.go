@@ -0,0 +1,105 @@
+package threadsafequeue
+
+import "sync/atomic"
+
+// LockFreeQueue is an unbounded multi-producer multi-consumer FIFO queue
+// built on Michael and Scott's non-blocking algorithm: Enqueue and
+// TryDequeue update the list with compare-and-swap and never take a lock,
+// so a stalled goroutine cannot hold up the others.
+//
+// There is no blocking Dequeue; callers that need to wait for an item spin,
+// back off or park with their own mechanism. Nodes are never reused, so the
+// garbage collector rules out the ABA problem that manual memory management
+// has to guard against. The node at the front, which serves as the dummy,
+// keeps a reference to the most recently dequeued item until the next
+// TryDequeue moves past it.
+type LockFreeQueue struct {
+	head atomic.Pointer[lockFreeNode] // Dummy node; the front item is head.next.
+	tail atomic.Pointer[lockFreeNode] // Last node, or one behind it while an Enqueue completes.
+	size atomic.Int64                 // Approximate number of items.
+}
+
+// lockFreeNode is a node of a LockFreeQueue. item is written before the node
+// is published and never modified afterwards.
+type lockFreeNode struct {
+	item interface{}
+	next atomic.Pointer[lockFreeNode]
+}
+
+// NewLockFreeQueue initializes and returns a new instance of LockFreeQueue.
+// It is safe to be used concurrently.
+func NewLockFreeQueue() *LockFreeQueue {
+	q := &LockFreeQueue{}
+	dummy := &lockFreeNode{}
+	q.head.Store(dummy)
+	q.tail.Store(dummy)
+	return q
+}
+
+// Enqueue adds an item to the end of the queue.
+// This method is safe for concurrent use.
+func (q *LockFreeQueue) Enqueue(item interface{}) {
+	n := &lockFreeNode{item: item}
+	for {
+		tail := q.tail.Load()
+		next := tail.next.Load()
+		if tail != q.tail.Load() {
+			continue // tail moved while we read it.
+		}
+		if next != nil {
+			// Another Enqueue linked its node but has not swung tail yet;
+			// help it along and retry.
+			q.tail.CompareAndSwap(tail, next)
+			continue
+		}
+		if tail.next.CompareAndSwap(nil, n) {
+			q.tail.CompareAndSwap(tail, n) // Failure means another goroutine already helped.
+			q.size.Add(1)
+			return
+		}
+	}
+}
+
+// TryDequeue removes and returns the item from the front of the queue
+// without blocking. The boolean value is false if the queue is empty.
+// This method is safe for concurrent use.
+func (q *LockFreeQueue) TryDequeue() (interface{}, bool) {
+	for {
+		head := q.head.Load()
+		tail := q.tail.Load()
+		next := head.next.Load()
+		if head != q.head.Load() {
+			continue // head moved while we read it.
+		}
+		if next == nil {
+			return nil, false
+		}
+		if head == tail {
+			// An Enqueue is halfway done; swing tail before moving head past it.
+			q.tail.CompareAndSwap(tail, next)
+			continue
+		}
+		item := next.item
+		if q.head.CompareAndSwap(head, next) {
+			q.size.Add(-1)
+			return item, true
+		}
+	}
+}
+
+// IsEmpty checks if the queue is empty.
+// This method is safe for concurrent use.
+func (q *LockFreeQueue) IsEmpty() bool {
+	return q.head.Load().next.Load() == nil
+}
+
+// Size returns the number of items in the queue. The count is maintained
+// separately from the list, so while operations are in flight it may lag
+// behind them; it is exact whenever the queue is quiescent.
+// This method is safe for concurrent use.
+func (q *LockFreeQueue) Size() int {
+	if n := q.size.Load(); n > 0 {
+		return int(n)
+	}
+	return 0
+}
@@ -0,0 +1,130 @@
+package threadsafequeue
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// Test that the lock-free queue preserves FIFO order
+func TestLockFreeQueueOrder(t *testing.T) {
+	q := NewLockFreeQueue()
+	if !q.IsEmpty() {
+		t.Error("Expected a new queue to be empty")
+	}
+	for i := 0; i < 10; i++ {
+		q.Enqueue(i)
+	}
+	if q.Size() != 10 {
+		t.Errorf("Expected size to be 10, got %d", q.Size())
+	}
+	for i := 0; i < 10; i++ {
+		if item, ok := q.TryDequeue(); !ok || item != i {
+			t.Fatalf("Expected to dequeue %d, got %v", i, item)
+		}
+	}
+	if _, ok := q.TryDequeue(); ok {
+		t.Error("Expected TryDequeue on an empty queue to fail")
+	}
+	if !q.IsEmpty() || q.Size() != 0 {
+		t.Errorf("Expected the queue to be empty, got size %d", q.Size())
+	}
+}
+
+// Test that concurrent producers and consumers deliver every item exactly
+// once and in per-producer order
+func TestLockFreeQueueConcurrent(t *testing.T) {
+	q := NewLockFreeQueue()
+	const producers, consumers, perProducer = 8, 8, 5000
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				q.Enqueue([2]int{p, i})
+			}
+		}(p)
+	}
+
+	var mu sync.Mutex
+	total := 0
+	var cwg sync.WaitGroup
+	for c := 0; c < consumers; c++ {
+		cwg.Add(1)
+		go func() {
+			defer cwg.Done()
+			last := make([]int, producers)
+			for i := range last {
+				last[i] = -1
+			}
+			for {
+				mu.Lock()
+				done := total == producers*perProducer
+				mu.Unlock()
+				if done {
+					return
+				}
+				item, ok := q.TryDequeue()
+				if !ok {
+					continue
+				}
+				v := item.([2]int)
+				if v[1] <= last[v[0]] {
+					t.Errorf("Producer %d: item %d dequeued after %d", v[0], v[1], last[v[0]])
+				}
+				last[v[0]] = v[1]
+				mu.Lock()
+				total++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	cwg.Wait()
+	if q.Size() != 0 {
+		t.Errorf("Expected size to be 0, got %d", q.Size())
+	}
+}
+
+// tryQueue is implemented by the queues compared in the lock-free benchmark.
+type tryQueue interface {
+	Enqueue(item interface{})
+	TryDequeue() (interface{}, bool)
+}
+
+// Benchmark the lock-free and mutex queues at increasing goroutine counts
+func BenchmarkLockFree(b *testing.B) {
+	for _, g := range []int{1, 4, 16, 64} {
+		for _, bc := range []struct {
+			name string
+			new  func() tryQueue
+		}{
+			{"Mutex", func() tryQueue { return NewThreadSafeQueue() }},
+			{"LockFree", func() tryQueue { return NewLockFreeQueue() }},
+		} {
+			b.Run(fmt.Sprintf("%s/%d", bc.name, g), func(b *testing.B) {
+				q := bc.new()
+				var item interface{} = struct{}{}
+				var wg sync.WaitGroup
+				b.ReportAllocs()
+				b.ResetTimer()
+				for w := 0; w < g; w++ {
+					n := b.N / g
+					if w < b.N%g {
+						n++
+					}
+					wg.Add(1)
+					go func(n int) {
+						defer wg.Done()
+						for i := 0; i < n; i++ {
+							q.Enqueue(item)
+							q.TryDequeue()
+						}
+					}(n)
+				}
+				wg.Wait()
+			})
+		}
+	}
+}
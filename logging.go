@@ -0,0 +1,109 @@
+package threadsafequeue
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Attribute keys of the records logged with WithLogger.
+const (
+	LogKeyQueue     = "queue"     // Name set by WithName, if any.
+	LogKeySize      = "size"      // Number of items in the queue after the event.
+	LogKeyItem      = "item"      // Item concerned, as formatted by WithLogFormatter, if set.
+	LogKeyPolicy    = "policy"    // Overflow policy that dropped the item, LoadShedding, TagQuota, or Cancel.
+	LogKeyTag       = "tag"       // Tag given to EnqueueTagged.
+	LogKeyConsumers = "consumers" // Stuck consumers.
+	LogKeyProducers = "producers" // Stuck producers.
+	LogKeyLongest   = "longest"   // How long the longest-stuck waiter has been waiting.
+	LogKeyPanic     = "panic"     // Value a hook or callback panicked with.
+	LogKeyError     = "error"     // Error that made an operation fail.
+)
+
+// WithName names the queue in its log records, and in the profiler labels
+// of its RunWorkers workers.
+func WithName(name string) Option {
+	return func(q *ThreadSafeQueue) {
+		q.name = name
+	}
+}
+
+// WithLogger makes the queue log its notable events to l:
+//
+//	Info   "queue closed"      the first Close
+//	Debug  "item dropped"      an item discarded by the overflow policy or shed
+//	Debug  "item rejected"     an item refused by WithTagQuota
+//	Warn   "waiters stuck"     each report of WithStuckWaiterHandler
+//	Warn   "circuit breaker opened"
+//	                           the breaker of WithCircuitBreaker opened
+//	Info   "circuit breaker half-open", "circuit breaker closed"
+//	                           it let a trial item through, or closed again
+//	Error  "enqueue hook panicked", "dequeue hook panicked", "drop hook panicked",
+//	       "high watermark callback panicked", "low watermark callback panicked"
+//	                           a function given to the queue panicked
+//	Error  "snapshot failed"   a snapshot of StartSnapshots could not be written
+//	Error  "write-ahead log failed"
+//	                           a record of WithWAL could not be written
+//	Error  "write-ahead log compaction failed"
+//	                           a compaction started by WithWALCompaction failed
+//	Error  "replication failed"
+//	                           StartReplication or NewFollower lost its stream
+//	Error  "audit write failed"
+//	                           the writer of WithAuditWriter failed
+//
+// Records carry the attributes named by the LogKey constants. They are
+// logged after the queue's lock is released, from the goroutine whose
+// operation caused the event. Without a logger, the queue formats and
+// allocates nothing for logging.
+func WithLogger(l *slog.Logger) Option {
+	return func(q *ThreadSafeQueue) {
+		q.logger = l
+	}
+}
+
+// WithLogFormatter makes log records include format(item) for events that
+// concern an item. format runs outside the queue's lock, only for records
+// the logger is enabled for.
+func WithLogFormatter(format func(item interface{}) string) Option {
+	return func(q *ThreadSafeQueue) {
+		q.logFormat = format
+	}
+}
+
+// logEvent is a record waiting for the queue's lock to be released.
+type logEvent struct {
+	level slog.Level
+	msg   string
+	size  int
+	item  interface{}
+	attrs []slog.Attr // Attributes specific to the event.
+}
+
+// logLater queues a record for unlock to log. The caller must hold q.mu
+// exclusively and must have checked that the queue has a logger.
+func (q *ThreadSafeQueue) logLater(level slog.Level, msg string, item interface{}, attrs ...slog.Attr) {
+	q.logs = append(q.logs, logEvent{level: level, msg: msg, size: q.len(), item: item, attrs: attrs})
+}
+
+// flushLogs logs the records queued by logLater, once the lock is released.
+func (q *ThreadSafeQueue) flushLogs(events []logEvent) {
+	for _, e := range events {
+		q.log(e)
+	}
+}
+
+// log writes one record, if the logger is enabled for its level.
+func (q *ThreadSafeQueue) log(e logEvent) {
+	ctx := context.Background()
+	if !q.logger.Enabled(ctx, e.level) {
+		return
+	}
+	attrs := make([]slog.Attr, 0, 3+len(e.attrs))
+	if q.name != "" {
+		attrs = append(attrs, slog.String(LogKeyQueue, q.name))
+	}
+	attrs = append(attrs, slog.Int(LogKeySize, e.size))
+	if e.item != nil && q.logFormat != nil {
+		attrs = append(attrs, slog.String(LogKeyItem, q.logFormat(e.item)))
+	}
+	q.logger.LogAttrs(ctx, e.level, e.msg, append(attrs, e.attrs...)...)
+}
@@ -0,0 +1,120 @@
+package threadsafequeue
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordHandler is a slog.Handler that keeps the records it handles.
+type recordHandler struct {
+	mu      sync.Mutex
+	level   slog.Level
+	records []slog.Record
+	onLog   func() // Called for each record, if set.
+}
+
+func (h *recordHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *recordHandler) Handle(_ context.Context, r slog.Record) error {
+	if h.onLog != nil {
+		h.onLog()
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r)
+	return nil
+}
+
+func (h *recordHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *recordHandler) WithGroup(string) slog.Handler      { return h }
+
+// logged returns the message and attributes of each record.
+func (h *recordHandler) logged() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var lines []string
+	for _, r := range h.records {
+		line := r.Level.String() + " " + r.Message
+		r.Attrs(func(a slog.Attr) bool {
+			line += " " + a.String()
+			return true
+		})
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Test that drops and Close are logged with the queue's attributes, and
+// only once the lock is released
+func TestLogger(t *testing.T) {
+	h := &recordHandler{level: slog.LevelDebug}
+	q := NewThreadSafeQueue(WithLogger(slog.New(h)), WithName("jobs"), WithCapacity(1),
+		WithOverflowPolicy(DropNewest), WithLogFormatter(func(item interface{}) string { return fmt.Sprintf("#%v", item) }))
+	h.onLog = func() {
+		if q.mu.TryLock() {
+			q.mu.Unlock()
+		} else {
+			t.Error("Expected records to be logged without the queue's lock")
+		}
+	}
+	q.Enqueue(1)
+	q.Enqueue(2)
+	q.Close()
+	q.Close()
+
+	want := []string{
+		"DEBUG item dropped queue=jobs size=1 item=#2 policy=DropNewest",
+		"INFO queue closed queue=jobs size=1",
+	}
+	got := h.logged()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected records %q, got %q", want, got)
+	}
+}
+
+// Test that stuck waiters are logged as a warning, and that records below
+// the logger's level are skipped
+func TestLoggerStuckWaiters(t *testing.T) {
+	h := &recordHandler{level: slog.LevelWarn}
+	reported := make(chan struct{}, 1)
+	q := NewThreadSafeQueue(WithLogger(slog.New(h)), WithStuckWaiterHandler(10*time.Millisecond, func(StuckReport) {
+		select {
+		case reported <- struct{}{}:
+		default:
+		}
+	}))
+	go q.Dequeue()
+	<-reported
+	q.Close()
+
+	got := h.logged()
+	if len(got) == 0 || !strings.HasPrefix(got[0], "WARN waiters stuck size=0 consumers=1 producers=0 longest=") {
+		t.Errorf("Expected a warning about the stuck consumer, got %q", got)
+	}
+	for _, line := range got {
+		if !strings.HasPrefix(line, "WARN") {
+			t.Errorf("Expected only warnings at the Warn level, got %q", line)
+		}
+	}
+}
+
+// Test that a queue without a logger allocates nothing for logging
+func TestNoLogger(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(1), WithOverflowPolicy(DropOldest))
+	q.Enqueue(0)
+	if n := testing.AllocsPerRun(100, func() {
+		q.Enqueue(1) // Drops the previous item.
+	}); n != 0 {
+		t.Errorf("Expected no allocations without a logger, got %v", n)
+	}
+	if q.logs != nil {
+		t.Error("Expected no records to be queued")
+	}
+}
@@ -0,0 +1,47 @@
+package threadsafequeue
+
+import "time"
+
+// Meta is what DequeueWithMeta returns beside an item.
+type Meta struct {
+	// Attrs are the attributes given to EnqueueWithMeta, or nil for an item
+	// enqueued another way.
+	Attrs map[string]string
+	// EnqueuedAt is when the item was stored, if the queue was created
+	// WithLatencyTracking(true), and the zero time otherwise.
+	EnqueuedAt time.Time
+}
+
+// EnqueueWithMeta is like Enqueue but keeps attrs beside the item, for
+// DequeueWithMeta to return with it. The queue keeps the map itself, not a
+// copy, so it must not be modified afterwards. Items it enqueues can be
+// dequeued by any method; only DequeueWithMeta sees their attributes.
+//
+// A queue keeps nothing beside its items until the first call with non-nil
+// attrs, so that a queue that never uses metadata pays nothing for it; a
+// call with nil attrs is the same as Enqueue.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) EnqueueWithMeta(item interface{}, attrs map[string]string) {
+	q.mustValidate(item)
+	item = q.copyItem(item)
+	q.throttle(nil, 1)
+	r := q.startRegion(traceEnqueueRegion)
+	q.lock()
+	if attrs != nil {
+		q.startExtras()
+		q.metaOn = true
+	}
+	q.put(nil, item, extra{attrs: attrs}, false)
+	q.unlock()
+	endRegion(r)
+}
+
+// DequeueWithMeta is like Dequeue but also returns the item's metadata.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) DequeueWithMeta() (interface{}, Meta, bool) {
+	item, x, ok := q.dequeueExtra()
+	if !ok {
+		return nil, Meta{}, false
+	}
+	return item, Meta{Attrs: x.attrs, EnqueuedAt: x.enqueuedAt}, true
+}
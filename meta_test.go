@@ -0,0 +1,90 @@
+package threadsafequeue
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Test that attributes come back with their items, and that items enqueued
+// without them, before or after, come back with none
+func TestMeta(t *testing.T) {
+	q := NewThreadSafeQueue()
+	q.Enqueue("before")
+	q.EnqueueWithMeta("with", map[string]string{"user": "ann"})
+	q.Enqueue("after")
+	q.EnqueueWithMeta("nil", nil)
+
+	want := []struct {
+		item  string
+		attrs map[string]string
+	}{
+		{"before", nil},
+		{"with", map[string]string{"user": "ann"}},
+		{"after", nil},
+		{"nil", nil},
+	}
+	for _, w := range want {
+		item, meta, ok := q.DequeueWithMeta()
+		if !ok || item != w.item || !reflect.DeepEqual(meta.Attrs, w.attrs) {
+			t.Errorf("Expected %s with %v, but got %v with %v, %v", w.item, w.attrs, item, meta.Attrs, ok)
+		}
+	}
+	q.Close()
+	if _, meta, ok := q.DequeueWithMeta(); ok || meta.Attrs != nil {
+		t.Errorf("Expected no item from a closed, drained queue, but got %v, %v", meta, ok)
+	}
+}
+
+// Test that metadata follows items handed to parked consumers and blocked
+// producers
+func TestMetaHandoff(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(1))
+	q.EnqueueWithMeta(1, map[string]string{"n": "1"})
+	go q.EnqueueWithMeta(2, map[string]string{"n": "2"}) // Blocks on the full queue.
+	awaitCount(t, q.WaitingProducers, 1)
+	for _, want := range []string{"1", "2"} {
+		if _, meta, _ := q.DequeueWithMeta(); meta.Attrs["n"] != want {
+			t.Errorf("Expected attribute %s, but got %v", want, meta.Attrs)
+		}
+	}
+
+	result := make(chan Meta)
+	go func() {
+		_, meta, _ := q.DequeueWithMeta()
+		result <- meta
+	}()
+	awaitCount(t, q.WaitingConsumers, 1)
+	q.EnqueueWithMeta(3, map[string]string{"n": "3"})
+	if meta := <-result; meta.Attrs["n"] != "3" {
+		t.Errorf("Expected attribute 3 for the parked consumer, but got %v", meta.Attrs)
+	}
+}
+
+// Test that EnqueuedAt is filled in with latency tracking
+func TestMetaEnqueuedAt(t *testing.T) {
+	c := newManualClock()
+	q := NewThreadSafeQueue(WithClock(c), WithLatencyTracking(true))
+	at := c.Now()
+	q.Enqueue(1)
+	c.advance(time.Second)
+	if _, meta, _ := q.DequeueWithMeta(); !meta.EnqueuedAt.Equal(at) {
+		t.Errorf("Expected the item enqueued at %v, but got %v", at, meta.EnqueuedAt)
+	}
+}
+
+// Test that a queue never given metadata keeps nothing and allocates nothing
+// for it
+func TestMetaNoOverhead(t *testing.T) {
+	q := NewThreadSafeQueue(WithInitialCapacity(1))
+	allocs := testing.AllocsPerRun(100, func() {
+		q.EnqueueWithMeta(1, nil)
+		q.DequeueWithMeta()
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocation without metadata, but got %v", allocs)
+	}
+	if q.extras.cap() != 0 {
+		t.Error("Expected nothing to be kept beside the items")
+	}
+}
@@ -0,0 +1,193 @@
+package threadsafequeue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// MPSCQueue is an unbounded FIFO queue for many producer goroutines and a
+// single consumer goroutine. Producers push onto a lock-free linked stack
+// with one compare-and-swap and never wait for the consumer; the consumer
+// detaches the whole stack with one atomic swap and serves it oldest first,
+// which makes draining in batches cheap.
+//
+// Only one goroutine at a time may call Dequeue, TryDequeue or DequeueBatch.
+// Builds with the race detector panic when that rule is broken; other builds
+// do not check it. Enqueue, Close and Size may be called from anywhere.
+type MPSCQueue struct {
+	top     atomic.Pointer[mpscNode] // Most recently enqueued node not yet taken by the consumer.
+	size    atomic.Int64             // Number of items.
+	closed  atomic.Bool              // Set by Close; no further items are accepted.
+	parked  atomic.Bool              // Set while the consumer may be waiting on wake.
+	wake    chan struct{}            // Poked when an item arrives or the queue is closed while the consumer is parked.
+	pending []interface{}            // Items taken by the consumer, newest first; served from the end.
+	busy    atomic.Bool              // Set while a consumer call runs in race-detector builds.
+}
+
+// mpscNode is a node of an MPSCQueue's stack.
+type mpscNode struct {
+	item interface{}
+	next *mpscNode
+}
+
+// mpscNodes recycles the nodes of every MPSCQueue.
+var mpscNodes sync.Pool
+
+// NewMPSCQueue initializes and returns a new instance of MPSCQueue.
+func NewMPSCQueue() *MPSCQueue {
+	return &MPSCQueue{wake: make(chan struct{}, 1)}
+}
+
+// Enqueue adds an item to the end of the queue. It never blocks.
+// Items enqueued after Close are discarded.
+// This method is safe for concurrent use.
+func (q *MPSCQueue) Enqueue(item interface{}) {
+	if q.closed.Load() {
+		return
+	}
+	n, _ := mpscNodes.Get().(*mpscNode)
+	if n == nil {
+		n = &mpscNode{}
+	}
+	n.item = item
+	q.size.Add(1) // Count first so Size never drops below the items present.
+	for {
+		n.next = q.top.Load()
+		if q.top.CompareAndSwap(n.next, n) {
+			break
+		}
+	}
+	if q.parked.Load() {
+		notify(q.wake)
+	}
+}
+
+// TryDequeue removes and returns the item from the front of the queue
+// without blocking. The boolean value is false if the queue is empty.
+// Only the consumer goroutine may call it.
+func (q *MPSCQueue) TryDequeue() (interface{}, bool) {
+	defer q.enter()()
+	if !q.fill() {
+		return nil, false
+	}
+	return q.next(), true
+}
+
+// Dequeue removes and returns the item from the front of the queue.
+// If the queue is empty, it blocks until an item is enqueued or the queue is
+// closed. The boolean value is false only once the queue is closed and drained.
+// Only the consumer goroutine may call it.
+func (q *MPSCQueue) Dequeue() (interface{}, bool) {
+	defer q.enter()()
+	if q.wait(context.Background()) != nil {
+		return nil, false
+	}
+	return q.next(), true
+}
+
+// DequeueBatch blocks until at least one item is available, then appends
+// every available item, oldest first, to dst and returns the result. Once the
+// queue is closed and drained it returns dst unchanged and ErrClosed; if ctx
+// is done first it returns ctx.Err().
+// Only the consumer goroutine may call it.
+func (q *MPSCQueue) DequeueBatch(ctx context.Context, dst []interface{}) ([]interface{}, error) {
+	defer q.enter()()
+	if err := q.wait(ctx); err != nil {
+		return dst, err
+	}
+	for len(q.pending) > 0 {
+		dst = append(dst, q.next())
+	}
+	return dst, nil
+}
+
+// Close marks the queue as closed. Items already queued can still be
+// dequeued; once they are gone, Dequeue returns false.
+// This method is safe for concurrent use.
+func (q *MPSCQueue) Close() {
+	q.closed.Store(true)
+	notify(q.wake)
+}
+
+// Size returns the number of items in the queue. Concurrent producers may
+// change it before the caller looks at the result.
+// This method is safe for concurrent use.
+func (q *MPSCQueue) Size() int {
+	return int(q.size.Load())
+}
+
+// IsEmpty checks if the queue is empty.
+// This method is safe for concurrent use.
+func (q *MPSCQueue) IsEmpty() bool {
+	return q.Size() == 0
+}
+
+// fill makes sure pending holds items, detaching the producers' stack if it
+// is empty, and reports whether there are any.
+func (q *MPSCQueue) fill() bool {
+	if len(q.pending) > 0 {
+		return true
+	}
+	// The stack lists items newest first, which is the order pending serves
+	// from its end.
+	for n := q.top.Swap(nil); n != nil; {
+		q.pending = append(q.pending, n.item)
+		next := n.next
+		n.item, n.next = nil, nil
+		mpscNodes.Put(n) // Producers never dereference a node once it is pushed.
+		n = next
+	}
+	return len(q.pending) > 0
+}
+
+// next removes the oldest pending item; pending must not be empty.
+func (q *MPSCQueue) next() interface{} {
+	i := len(q.pending) - 1
+	item := q.pending[i]
+	q.pending[i] = nil // Drop the reference so the item can be collected.
+	q.pending = q.pending[:i]
+	q.size.Add(-1)
+	return item
+}
+
+// wait parks the consumer until pending holds items. It returns ErrClosed
+// once the queue is closed and drained, or ctx.Err() if ctx is done first.
+func (q *MPSCQueue) wait(ctx context.Context) error {
+	for !q.fill() {
+		// Announce the park before checking again, so a producer either sees
+		// the flag or pushes before the check below.
+		q.parked.Store(true)
+		if q.fill() {
+			q.parked.Store(false)
+			return nil
+		}
+		if q.closed.Load() {
+			q.parked.Store(false)
+			if q.fill() { // An Enqueue that raced with Close.
+				return nil
+			}
+			return ErrClosed
+		}
+		select {
+		case <-q.wake:
+		case <-ctx.Done():
+			q.parked.Store(false)
+			return ctx.Err()
+		}
+		q.parked.Store(false)
+	}
+	return nil
+}
+
+// enter guards a consumer call in race-detector builds, panicking if another
+// one is already running. Call the returned function when the call ends.
+func (q *MPSCQueue) enter() (exit func()) {
+	if !raceEnabled {
+		return func() {}
+	}
+	if !q.busy.CompareAndSwap(false, true) {
+		panic("threadsafequeue: concurrent consumers on an MPSCQueue")
+	}
+	return func() { q.busy.Store(false) }
+}
@@ -0,0 +1,178 @@
+package threadsafequeue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test that the MPSC queue preserves FIFO order
+func TestMPSCQueueOrder(t *testing.T) {
+	q := NewMPSCQueue()
+	for i := 0; i < 5; i++ {
+		q.Enqueue(i)
+	}
+	if item, ok := q.TryDequeue(); !ok || item != 0 {
+		t.Fatalf("Expected to dequeue 0, got %v", item)
+	}
+	// Items enqueued while earlier ones are pending come after them.
+	q.Enqueue(5)
+	for i := 1; i < 6; i++ {
+		if item, ok := q.Dequeue(); !ok || item != i {
+			t.Fatalf("Expected to dequeue %d, got %v", i, item)
+		}
+	}
+	if _, ok := q.TryDequeue(); ok {
+		t.Error("Expected TryDequeue on an empty queue to fail")
+	}
+	if !q.IsEmpty() {
+		t.Errorf("Expected the queue to be empty, got size %d", q.Size())
+	}
+}
+
+// Test that DequeueBatch returns every available item in order
+func TestMPSCQueueDequeueBatch(t *testing.T) {
+	q := NewMPSCQueue()
+	for i := 0; i < 10; i++ {
+		q.Enqueue(i)
+	}
+	batch, err := q.DequeueBatch(context.Background(), nil)
+	if err != nil || len(batch) != 10 {
+		t.Fatalf("Expected a batch of 10, got %v (%v)", batch, err)
+	}
+	for i, item := range batch {
+		if item != i {
+			t.Fatalf("Expected %d at index %d, got %v", i, i, item)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := q.DequeueBatch(ctx, nil); err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+}
+
+// Test that Dequeue blocks until an item arrives and returns false once the
+// queue is closed and drained
+func TestMPSCQueueBlockAndClose(t *testing.T) {
+	q := NewMPSCQueue()
+	result := make(chan interface{})
+	go func() {
+		item, _ := q.Dequeue()
+		result <- item
+	}()
+	time.Sleep(100 * time.Millisecond)
+	q.Enqueue(42)
+	if item := <-result; item != 42 {
+		t.Errorf("Expected to dequeue 42, got %v", item)
+	}
+
+	q.Enqueue(1)
+	q.Close()
+	q.Enqueue(2)
+	if item, ok := q.Dequeue(); !ok || item != 1 {
+		t.Errorf("Expected to dequeue 1, got %v", item)
+	}
+	if _, ok := q.Dequeue(); ok {
+		t.Error("Expected Dequeue on a closed, drained queue to return false")
+	}
+	if _, err := q.DequeueBatch(context.Background(), nil); err != ErrClosed {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+}
+
+// Test that many producers deliver every item in per-producer order
+func TestMPSCQueueConcurrent(t *testing.T) {
+	q := NewMPSCQueue()
+	const producers, perProducer = 16, 2000
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				q.Enqueue([2]int{p, i})
+			}
+		}(p)
+	}
+	go func() {
+		wg.Wait()
+		q.Close()
+	}()
+
+	next := make([]int, producers)
+	total := 0
+	var batch []interface{}
+	for {
+		var err error
+		batch, err = q.DequeueBatch(context.Background(), batch[:0])
+		if err == ErrClosed {
+			break
+		}
+		for _, item := range batch {
+			v := item.([2]int)
+			if v[1] != next[v[0]] {
+				t.Fatalf("Producer %d: expected item %d, got %d", v[0], next[v[0]], v[1])
+			}
+			next[v[0]]++
+			total++
+		}
+	}
+	if total != producers*perProducer {
+		t.Errorf("Expected %d items, got %d", producers*perProducer, total)
+	}
+}
+
+// Test that race-detector builds catch a second concurrent consumer
+func TestMPSCQueueConsumerGuard(t *testing.T) {
+	if !raceEnabled {
+		t.Skip("the consumer guard is only active with -race")
+	}
+	q := NewMPSCQueue()
+	exit := q.enter() // Simulate a consumer call in progress.
+	defer exit()
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a second consumer to panic")
+		}
+	}()
+	q.TryDequeue()
+}
+
+// Benchmark 32 producers feeding one consumer
+func BenchmarkMPSC32Producers(b *testing.B) {
+	const producers = 32
+	var item interface{} = struct{}{}
+	produce := func(b *testing.B, enqueue func(interface{})) {
+		for p := 0; p < producers; p++ {
+			n := b.N / producers
+			if p < b.N%producers {
+				n++
+			}
+			go func(n int) {
+				for i := 0; i < n; i++ {
+					enqueue(item)
+				}
+			}(n)
+		}
+	}
+	b.Run("Mutex", func(b *testing.B) {
+		q := NewThreadSafeQueue()
+		b.ReportAllocs()
+		produce(b, q.Enqueue)
+		for i := 0; i < b.N; i++ {
+			q.Dequeue()
+		}
+	})
+	b.Run("MPSC", func(b *testing.B) {
+		q := NewMPSCQueue()
+		b.ReportAllocs()
+		produce(b, q.Enqueue)
+		var batch []interface{}
+		for n := 0; n < b.N; n += len(batch) {
+			batch, _ = q.DequeueBatch(context.Background(), batch[:0])
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package threadsafequeue
+
+import (
+	"context"
+	"sync"
+)
+
+// Multiplexer lets a single consumer loop serve several queues. Its Dequeue
+// takes items from the underlying queues in round-robin order, skipping
+// empty ones, so a busy queue cannot starve the others. It blocks only when
+// every queue is empty, and wakes as soon as any of them receives an item;
+// no polling is involved.
+//
+// The underlying queues remain usable on their own, and a Multiplexer never
+// closes them.
+type Multiplexer struct {
+	queues []*ThreadSafeQueue // Queues served, in round-robin order.
+	next   int                // Index of the queue served first by the next Dequeue.
+	mu     sync.Mutex         // Mutex to serialize rounds and protect next.
+	notify chan struct{}      // Poked by the queues when items arrive or they close.
+	done   chan struct{}      // Closed by Close.
+	once   sync.Once          // Guards Close.
+}
+
+// NewMultiplexer initializes and returns a Multiplexer over the given queues.
+func NewMultiplexer(queues ...*ThreadSafeQueue) *Multiplexer {
+	m := &Multiplexer{
+		queues: append([]*ThreadSafeQueue(nil), queues...),
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	for _, q := range m.queues {
+		q.addNotifier(m.notify)
+	}
+	return m
+}
+
+// Dequeue removes and returns the next item in round-robin order, blocking
+// while every queue is empty. The boolean value is false once every queue
+// has been closed and drained, or the Multiplexer has been closed.
+// This method is safe for concurrent use.
+func (m *Multiplexer) Dequeue() (interface{}, bool) {
+	item, err := m.DequeueContext(context.Background())
+	return item, err == nil
+}
+
+// DequeueContext is like Dequeue but gives up when ctx is done. It returns
+// ctx.Err() on cancellation and ErrClosed once every queue has been closed
+// and drained, or the Multiplexer has been closed.
+// This method is safe for concurrent use.
+func (m *Multiplexer) DequeueContext(ctx context.Context) (interface{}, error) {
+	for {
+		item, ok, drained := m.round()
+		if ok {
+			return item, nil
+		}
+		if drained {
+			return nil, ErrClosed
+		}
+		select {
+		case <-m.notify:
+		case <-m.done:
+			return nil, ErrClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// TryDequeue removes and returns the next item in round-robin order without
+// blocking. The boolean value is false if every queue is empty.
+// This method is safe for concurrent use.
+func (m *Multiplexer) TryDequeue() (interface{}, bool) {
+	item, ok, _ := m.round()
+	return item, ok
+}
+
+// round tries each queue once, starting after the one served last. It
+// reports whether an item was found and, if not, whether every queue is
+// closed and drained.
+func (m *Multiplexer) round() (item interface{}, ok, drained bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	select {
+	case <-m.done:
+		return nil, false, true
+	default:
+	}
+	drained = true
+	for i := range m.queues {
+		idx := (m.next + i) % len(m.queues)
+		item, ok, closed := m.queues[idx].poll()
+		if ok {
+			m.next = idx + 1
+			// Several items may have arrived behind a single token; pass
+			// the wake-up on so that another blocked caller looks again.
+			m.wake()
+			return item, true, false
+		}
+		if !closed {
+			drained = false
+		}
+	}
+	return nil, false, drained
+}
+
+// wake leaves a token for the next blocked Dequeue.
+func (m *Multiplexer) wake() {
+	select {
+	case m.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Size returns the total number of items in the underlying queues.
+// This method is safe for concurrent use.
+func (m *Multiplexer) Size() int {
+	total := 0
+	for _, q := range m.queues {
+		total += q.Size()
+	}
+	return total
+}
+
+// Close detaches the Multiplexer from its queues and makes every blocked and
+// future Dequeue return immediately. The underlying queues are not closed.
+// This method is safe for concurrent use.
+func (m *Multiplexer) Close() {
+	m.once.Do(func() {
+		for _, q := range m.queues {
+			q.removeNotifier(m.notify)
+		}
+		close(m.done)
+	})
+}
@@ -0,0 +1,194 @@
+package threadsafequeue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test that the multiplexer serves queues round-robin, skipping empty ones
+func TestMultiplexerRoundRobin(t *testing.T) {
+	q0, q1, q2 := NewThreadSafeQueue(), NewThreadSafeQueue(), NewThreadSafeQueue()
+	m := NewMultiplexer(q0, q1, q2)
+	defer m.Close()
+
+	q0.Enqueue("a1")
+	q0.Enqueue("a2")
+	q0.Enqueue("a3")
+	q2.Enqueue("c1")
+	q2.Enqueue("c2")
+
+	expected := []string{"a1", "c1", "a2", "c2", "a3"}
+	for _, e := range expected {
+		if item, ok := m.Dequeue(); !ok || item != e {
+			t.Errorf("Expected to dequeue %s, got %v", e, item)
+		}
+	}
+
+	if _, ok := m.TryDequeue(); ok {
+		t.Error("TryDequeue should fail when every queue is empty")
+	}
+}
+
+// Test that a blocked Dequeue wakes when any queue receives an item
+func TestMultiplexerWakes(t *testing.T) {
+	queues := []*ThreadSafeQueue{NewThreadSafeQueue(), NewThreadSafeQueue(), NewThreadSafeQueue()}
+	m := NewMultiplexer(queues...)
+	defer m.Close()
+
+	for i, q := range queues {
+		done := make(chan interface{})
+		go func() {
+			item, _ := m.Dequeue()
+			done <- item
+		}()
+
+		// Allow some time for the Dequeue goroutine to start and block
+		time.Sleep(50 * time.Millisecond)
+		q.Enqueue(i)
+
+		select {
+		case item := <-done:
+			if item != i {
+				t.Errorf("Expected to dequeue %d, got %v", i, item)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Dequeue was not woken by queue %d", i)
+		}
+	}
+}
+
+// Test that several blocked callers are all woken by a burst of items
+func TestMultiplexerMultipleWaiters(t *testing.T) {
+	q0, q1 := NewThreadSafeQueue(), NewThreadSafeQueue()
+	m := NewMultiplexer(q0, q1)
+	defer m.Close()
+
+	const waiters = 8
+	var wg sync.WaitGroup
+	for i := 0; i < waiters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := m.Dequeue(); !ok {
+				t.Error("Dequeue failed when it should have succeeded")
+			}
+		}()
+	}
+
+	// Allow some time for the Dequeue goroutines to start and block
+	time.Sleep(100 * time.Millisecond)
+	for i := 0; i < waiters/2; i++ {
+		q0.Enqueue(i)
+		q1.Enqueue(i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Some Dequeue calls were left blocked while items were available")
+	}
+}
+
+// Test that Dequeue fails once every queue is closed and drained
+func TestMultiplexerClosedQueues(t *testing.T) {
+	q0, q1 := NewThreadSafeQueue(), NewThreadSafeQueue()
+	m := NewMultiplexer(q0, q1)
+	defer m.Close()
+
+	q1.Enqueue(1)
+	q0.Close()
+	q1.Close()
+
+	if item, ok := m.Dequeue(); !ok || item != 1 {
+		t.Errorf("Expected to drain 1, got %v", item)
+	}
+	if _, ok := m.Dequeue(); ok {
+		t.Error("Dequeue should fail once every queue is closed and drained")
+	}
+}
+
+// Test that Close and context cancellation release blocked callers
+func TestMultiplexerCloseAndCancel(t *testing.T) {
+	m := NewMultiplexer(NewThreadSafeQueue())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := m.DequeueContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	done := make(chan bool)
+	go func() {
+		_, ok := m.Dequeue()
+		done <- ok
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	m.Close()
+
+	select {
+	case ok := <-done:
+		if ok {
+			t.Error("Dequeue should fail after Close")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close did not release a blocked Dequeue")
+	}
+}
+
+// Test that a busy queue cannot starve a quiet one
+func TestMultiplexerFairness(t *testing.T) {
+	busy, quiet := NewThreadSafeQueue(), NewThreadSafeQueue()
+	m := NewMultiplexer(busy, quiet)
+	defer m.Close()
+
+	for i := 0; i < 10000; i++ {
+		busy.Enqueue(i)
+	}
+
+	// Every quiet item must be served within two dequeues of its arrival,
+	// however large the busy backlog is.
+	for i := 0; i < 100; i++ {
+		quiet.Enqueue("quiet")
+		served := false
+		for j := 0; j < 2; j++ {
+			if item, _ := m.Dequeue(); item == "quiet" {
+				served = true
+			}
+		}
+		if !served {
+			t.Fatalf("Quiet item %d was starved by the busy queue", i)
+		}
+	}
+
+	// With concurrent skewed producers every item still arrives.
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50000; i++ {
+			busy.Enqueue(i)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			quiet.Enqueue(i)
+		}
+	}()
+	wg.Wait()
+
+	total := busy.Size() + quiet.Size()
+	for i := 0; i < total; i++ {
+		if _, ok := m.TryDequeue(); !ok {
+			t.Fatalf("Expected %d items, got %d", total, i)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package threadsafequeue
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type ndjsonOrder struct {
+	ID   int    `json:"id"`
+	Note string `json:"note"`
+}
+
+// Test that WriteNDJSON writes one line per item in order
+func TestWriteNDJSON(t *testing.T) {
+	q := NewThreadSafeQueue()
+	q.EnqueueBatch(ndjsonOrder{1, "a<b"}, "two", 3)
+	var buf bytes.Buffer
+	n, err := q.WriteNDJSON(&buf)
+	if err != nil || n != 3 {
+		t.Fatalf("Expected to write 3 items, got %d and %v", n, err)
+	}
+	want := "{\"id\":1,\"note\":\"a<b\"}\n\"two\"\n3\n"
+	if buf.String() != want {
+		t.Errorf("Expected %q, got %q", want, buf.String())
+	}
+	if q.Size() != 3 {
+		t.Errorf("Expected WriteNDJSON to leave 3 items, got %d", q.Size())
+	}
+
+	q.Enqueue(make(chan int))
+	buf.Reset()
+	if n, err := q.WriteNDJSON(&buf); err == nil || n != 3 {
+		t.Errorf("Expected an error after 3 items, got %d and %v", n, err)
+	}
+}
+
+// Test that ReadNDJSON round-trips WriteNDJSON and skips blank lines
+func TestReadNDJSON(t *testing.T) {
+	src := NewThreadSafeQueue()
+	for i := 0; i < 100; i++ {
+		src.Enqueue(ndjsonOrder{ID: i})
+	}
+	var buf bytes.Buffer
+	if _, err := src.WriteNDJSON(&buf); err != nil {
+		t.Fatalf("Expected WriteNDJSON to succeed, got %v", err)
+	}
+	buf.WriteString("\n\n")
+
+	q := NewThreadSafeQueue()
+	n, err := q.ReadNDJSON(&buf, func() interface{} { return new(ndjsonOrder) })
+	if err != nil || n != 100 {
+		t.Fatalf("Expected to read 100 items, got %d and %v", n, err)
+	}
+	for i := 0; i < 100; i++ {
+		item, _ := q.TryDequeue()
+		if o := item.(*ndjsonOrder); o.ID != i {
+			t.Fatalf("Expected item %d to have ID %d, got %d", i, i, o.ID)
+		}
+	}
+
+	n, err = q.ReadNDJSON(strings.NewReader("{\"a\":1}\n[true]"), nil)
+	if err != nil || n != 2 {
+		t.Fatalf("Expected to read 2 items, got %d and %v", n, err)
+	}
+	want := []interface{}{map[string]interface{}{"a": 1.0}, []interface{}{true}}
+	if got := q.ToSlice(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+// Test that ReadNDJSON reports the line of a bad item
+func TestReadNDJSONErrors(t *testing.T) {
+	q := NewThreadSafeQueue()
+	n, err := q.ReadNDJSON(strings.NewReader("1\n\n2\n{oops\n4\n"), nil)
+	if n != 2 || err == nil || !strings.Contains(err.Error(), "line 4") {
+		t.Errorf("Expected 2 items and an error at line 4, got %d and %v", n, err)
+	}
+	if q.Size() != 2 {
+		t.Errorf("Expected the 2 items before the error to be enqueued, got %d", q.Size())
+	}
+
+	q.Close()
+	if _, err := q.ReadNDJSON(strings.NewReader("5\n"), nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed reading into a closed queue, got %v", err)
+	}
+}
+
+// Test that lines whose items are shed are counted as read
+func TestReadNDJSONLoadShedding(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(10), WithLoadShedding(1, 1), WithRand(fixedRand(0)))
+	n, err := q.ReadNDJSON(strings.NewReader(strings.Repeat("1\n", 20)), nil)
+	if err != nil || n != 20 {
+		t.Fatalf("Expected to read 20 items, got %d and %v", n, err)
+	}
+	if s := q.Stats(); s.Shed == 0 || s.Size+int(s.Shed) != 20 {
+		t.Errorf("Expected the 20 items queued or shed, some shed, got %+v", s)
+	}
+}
@@ -0,0 +1,343 @@
+package threadsafequeue
+
+import "context"
+
+// sizeChanged is called after every change of one item, or of all of them
+// for Drain, to the size of the queue, to notify whoever watches the size.
+// The caller must hold q.mu exclusively.
+func (q *ThreadSafeQueue) sizeChanged() {
+	n := q.len()
+	if n == 0 && len(q.emptyChans) > 0 {
+		q.emptyChans = closeAll(q.emptyChans)
+	}
+	if n > 0 && len(q.filledChans) > 0 {
+		q.filledChans = closeAll(q.filledChans)
+	}
+	if len(q.sizeWaits) > 0 {
+		q.releaseSizeWaits(n)
+	}
+	if len(q.watchers) > 0 {
+		q.sendSize(n)
+	}
+	if q.marks != nil {
+		q.marks.check(q, n)
+	}
+	if q.pressure != nil {
+		q.pressure.check(n)
+	}
+	if q.idle != nil {
+		q.idleChanged(n)
+	}
+	if q.adaptive != nil && q.adaptive.paused {
+		q.resumeAdaptive()
+	}
+}
+
+// NotifyEmpty returns a channel that is closed the next time the queue
+// becomes empty, when a Dequeue, TryDequeue or Drain takes its last item, or
+// at once if it is empty now. Each call returns a new channel.
+//
+// The transition is caught inside the critical section that empties the
+// queue, so the channel is closed even if an item is enqueued right after and
+// the queue is never seen empty from outside. A channel for a queue that
+// never empties is never closed, and stays referenced by the queue until
+// then.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) NotifyEmpty() <-chan struct{} {
+	ch := make(chan struct{})
+	q.lock()
+	defer q.unlock()
+	if q.len() == 0 {
+		close(ch)
+	} else {
+		q.emptyChans = append(q.emptyChans, ch)
+	}
+	return ch
+}
+
+// NotifyNonEmpty returns a channel that is closed the next time the queue
+// stops being empty, when an item is stored in it, or at once if it holds
+// items now. Each call returns a new channel. It lets an event loop select on
+// the arrival of work and then take it with TryDequeue, instead of keeping a
+// goroutine blocked in Dequeue.
+//
+// Only the transition closes the channel, not every Enqueue, so a busy
+// queue costs its watchers nothing. Checking IsEmpty first is not needed:
+// since the channel is closed at once on a non-empty queue, an item that
+// arrives between such a check and the call cannot be missed. The item may
+// be taken by another consumer before TryDequeue gets to it, as when it is
+// handed straight to a parked Dequeue, so the loop must allow for finding
+// the queue empty again.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) NotifyNonEmpty() <-chan struct{} {
+	ch := make(chan struct{})
+	q.lock()
+	defer q.unlock()
+	if q.len() > 0 {
+		close(ch)
+	} else {
+		q.filledChans = append(q.filledChans, ch)
+	}
+	return ch
+}
+
+// WaitUntilEmpty blocks until the queue is empty, and returns nil, or until
+// ctx is done, and returns ctx.Err(). Unlike NotifyEmpty, it keeps waiting
+// through transient refills: it returns only once it finds the queue empty
+// while holding the lock, at once if the queue is empty now. Shutdown code can
+// use it to wait for consumers to take the backlog before stopping them.
+// Items taken but still being processed are not waited for; see Join.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) WaitUntilEmpty(ctx context.Context) error {
+	for {
+		q.lock()
+		if q.len() == 0 {
+			q.unlock()
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			q.unlock()
+			return err
+		}
+		ch := make(chan struct{})
+		q.emptyChans = append(q.emptyChans, ch)
+		q.unlock()
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			q.lock()
+			q.emptyChans = removeChan(q.emptyChans, ch)
+			q.unlock()
+			return ctx.Err()
+		}
+	}
+}
+
+// WatchSize returns a channel that receives the size of the queue, first as
+// it is now and then after each change. If the receiver falls behind and the
+// channel's buffer of buffer values fills up, the oldest value is discarded
+// to make room for the newest: intermediate sizes are coalesced, but the
+// queue is never held up by a watcher and the last value received is always
+// current once the channel is caught up. A buffer below one is taken as one.
+//
+// The channel is closed, and the watcher removed, when ctx is done or when
+// the queue is closed and empty, since its size cannot change after that.
+// Each call returns a stream of its own.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) WatchSize(ctx context.Context, buffer int) <-chan int {
+	if buffer < 1 {
+		buffer = 1
+	}
+	w := &sizeWatcher{ch: make(chan int, buffer)}
+	q.lock()
+	defer q.unlock()
+	w.ch <- q.len()
+	if q.closed && q.len() == 0 {
+		close(w.ch)
+		return w.ch
+	}
+	q.watchers = append(q.watchers, w)
+	w.stop = context.AfterFunc(ctx, func() {
+		q.lock()
+		defer q.unlock()
+		for i, other := range q.watchers {
+			if other == w {
+				close(w.ch)
+				last := len(q.watchers) - 1
+				copy(q.watchers[i:], q.watchers[i+1:])
+				q.watchers[last] = nil
+				q.watchers = q.watchers[:last]
+				return
+			}
+		}
+	})
+	return w.ch
+}
+
+// sizeWatcher is a stream returned by WatchSize.
+type sizeWatcher struct {
+	ch   chan int
+	stop func() bool // Stops the removal of the watcher when its context is done.
+}
+
+// sendSize sends the size n to every watcher, replacing the oldest value of
+// those that are full, and closes the streams once the queue is closed and
+// empty. The caller must hold q.mu exclusively; since sends happen only
+// under it, a receive that makes room guarantees the next send succeeds.
+func (q *ThreadSafeQueue) sendSize(n int) {
+	for _, w := range q.watchers {
+		select {
+		case w.ch <- n:
+		default:
+			select {
+			case <-w.ch:
+			default:
+			}
+			w.ch <- n
+		}
+	}
+	if q.closed && n == 0 {
+		q.closeWatchers()
+	}
+}
+
+// closeWatchers closes and removes every watcher. The caller must hold q.mu
+// exclusively.
+func (q *ThreadSafeQueue) closeWatchers() {
+	for i, w := range q.watchers {
+		w.stop()
+		close(w.ch)
+		q.watchers[i] = nil
+	}
+	q.watchers = q.watchers[:0]
+}
+
+// closeAll closes the channels and returns the slice emptied for reuse.
+func closeAll(chans []chan struct{}) []chan struct{} {
+	for i, ch := range chans {
+		close(ch)
+		chans[i] = nil
+	}
+	return chans[:0]
+}
+
+// WaitForSize blocks until the queue holds at least n items, and returns nil,
+// or until ctx is done, and returns ctx.Err(). It returns at once if the
+// queue holds n items already. If the queue is closed first, it returns
+// ErrClosed, since no more items can arrive.
+//
+// The size is checked inside every operation that changes it, so a waiter
+// is released even if the queue reaches n only for a moment, as when items
+// go straight to parked consumers, and may find fewer items by the time it
+// looks. Waiters with different thresholds are each released as soon as
+// their own is reached.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) WaitForSize(ctx context.Context, n int) error {
+	return q.waitSize(ctx, &sizeWait{n: n})
+}
+
+// WaitBelowThreshold blocks until the queue holds fewer than n items, and
+// returns nil, or until ctx is done, and returns ctx.Err(). It returns at
+// once if the queue holds fewer than n items already, and ErrClosed if the
+// queue is closed first, since producers have nothing more to do.
+//
+// It lets producers throttle themselves against an unbounded queue, making
+// items only while consumers keep up: paired with Dequeue, which blocks
+// while the queue is empty, it gives flow control in both directions
+// without a capacity and its blocked or dropped items. Like WaitForSize, it
+// is released by the size changes themselves rather than by polling, even
+// if the queue dips below n only for a moment, and waiters with different
+// thresholds are each released as soon as their own is crossed. Several
+// producers released together may push the queue back above n.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) WaitBelowThreshold(ctx context.Context, n int) error {
+	return q.waitSize(ctx, &sizeWait{n: n, below: true})
+}
+
+// waitSize waits for the size w asks for, for WaitForSize and
+// WaitBelowThreshold.
+func (q *ThreadSafeQueue) waitSize(ctx context.Context, w *sizeWait) error {
+	q.lock()
+	if w.reachedBy(q.len()) {
+		q.unlock()
+		return nil
+	}
+	if q.closed {
+		q.unlock()
+		return ErrClosed
+	}
+	if err := ctx.Err(); err != nil {
+		q.unlock()
+		return err
+	}
+	w.ready = make(chan struct{})
+	q.sizeWaits = append(q.sizeWaits, w)
+	q.unlock()
+	select {
+	case <-w.ready:
+	case <-ctx.Done():
+		q.lock()
+		defer q.unlock()
+		select {
+		case <-w.ready: // Released concurrently with ctx.
+		default:
+			q.removeSizeWait(w)
+			return ctx.Err()
+		}
+	}
+	if !w.reached {
+		return ErrClosed
+	}
+	return nil
+}
+
+// sizeWait is a call to WaitForSize waiting for the queue to hold n items,
+// or to WaitBelowThreshold waiting for it to hold fewer.
+type sizeWait struct {
+	n       int
+	below   bool          // Set by WaitBelowThreshold.
+	ready   chan struct{} // Closed when the wait is over.
+	reached bool          // The size was reached; otherwise the queue was closed.
+}
+
+// reachedBy reports whether a size of n ends the wait.
+func (w *sizeWait) reachedBy(n int) bool {
+	if w.below {
+		return n < w.n
+	}
+	return n >= w.n
+}
+
+// releaseSizeWaits releases the calls to WaitForSize and WaitBelowThreshold
+// that a size of n ends. The caller must hold q.mu exclusively.
+func (q *ThreadSafeQueue) releaseSizeWaits(n int) {
+	waits := q.sizeWaits[:0]
+	for _, w := range q.sizeWaits {
+		if w.reachedBy(n) {
+			w.reached = true
+			close(w.ready)
+		} else {
+			waits = append(waits, w)
+		}
+	}
+	clear(q.sizeWaits[len(waits):])
+	q.sizeWaits = waits
+}
+
+// closeSizeWaits releases every call to WaitForSize and WaitBelowThreshold
+// on a closed queue. The caller must hold q.mu exclusively.
+func (q *ThreadSafeQueue) closeSizeWaits() {
+	for i, w := range q.sizeWaits {
+		close(w.ready)
+		q.sizeWaits[i] = nil
+	}
+	q.sizeWaits = q.sizeWaits[:0]
+}
+
+// removeSizeWait removes a call to WaitForSize or WaitBelowThreshold that
+// gave up. The caller must hold q.mu exclusively.
+func (q *ThreadSafeQueue) removeSizeWait(w *sizeWait) {
+	for i, other := range q.sizeWaits {
+		if other == w {
+			last := len(q.sizeWaits) - 1
+			copy(q.sizeWaits[i:], q.sizeWaits[i+1:])
+			q.sizeWaits[last] = nil
+			q.sizeWaits = q.sizeWaits[:last]
+			return
+		}
+	}
+}
+
+// removeChan removes ch from chans, if present, and returns the shortened
+// slice.
+func removeChan(chans []chan struct{}, ch chan struct{}) []chan struct{} {
+	for i, other := range chans {
+		if other == ch {
+			last := len(chans) - 1
+			copy(chans[i:], chans[i+1:])
+			chans[last] = nil
+			return chans[:last]
+		}
+	}
+	return chans
+}
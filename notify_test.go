@@ -0,0 +1,511 @@
+package threadsafequeue
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// closed reports whether ch has been closed.
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// Test that NotifyEmpty is closed once the last item is taken, and at once
+// on an empty queue
+func TestNotifyEmpty(t *testing.T) {
+	q := NewThreadSafeQueue()
+	if !closed(q.NotifyEmpty()) {
+		t.Errorf("Expected NotifyEmpty on an empty queue to be closed")
+	}
+	q.Enqueue(1)
+	q.Enqueue(2)
+	first, second := q.NotifyEmpty(), q.NotifyEmpty()
+	if first == second {
+		t.Errorf("Expected each call to return a new channel")
+	}
+	q.TryDequeue()
+	if closed(first) {
+		t.Errorf("Expected NotifyEmpty to stay open while items remain")
+	}
+	q.TryDequeue()
+	if !closed(first) || !closed(second) {
+		t.Errorf("Expected NotifyEmpty to be closed once the queue is empty")
+	}
+
+	q.Enqueue(3)
+	ch := q.NotifyEmpty()
+	q.Drain()
+	if !closed(ch) {
+		t.Errorf("Expected Drain to close NotifyEmpty")
+	}
+}
+
+// Test that the drain is notified even when the queue is refilled before
+// anyone can look at it
+func TestNotifyEmptyRefill(t *testing.T) {
+	var q *ThreadSafeQueue
+	q = NewThreadSafeQueue(WithDequeueHook(func(interface{}, int) {
+		q.Enqueue("refill") // Right after the drain, before Dequeue returns.
+	}))
+	q.Enqueue("last")
+	ch := q.NotifyEmpty()
+	go q.Dequeue()
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected NotifyEmpty to be closed by the drain")
+	}
+	awaitCount(t, q.Size, 1)
+}
+
+// Test that NotifyNonEmpty is closed by the first item stored, and at once
+// on a queue that holds items
+func TestNotifyNonEmpty(t *testing.T) {
+	q := NewThreadSafeQueue()
+	ch := q.NotifyNonEmpty()
+	if closed(ch) {
+		t.Errorf("Expected NotifyNonEmpty to stay open on an empty queue")
+	}
+	q.Enqueue(1)
+	if !closed(ch) {
+		t.Errorf("Expected NotifyNonEmpty to be closed once an item is stored")
+	}
+	if !closed(q.NotifyNonEmpty()) {
+		t.Errorf("Expected NotifyNonEmpty on a non-empty queue to be closed")
+	}
+	q.TryDequeue()
+	ch = q.NotifyNonEmpty()
+	q.EnqueueFront(2)
+	if !closed(ch) {
+		t.Errorf("Expected EnqueueFront to close NotifyNonEmpty")
+	}
+}
+
+// Test that an item stored between a check of IsEmpty and the call to
+// NotifyNonEmpty is not missed
+func TestNotifyNonEmptyLostWakeup(t *testing.T) {
+	q := NewThreadSafeQueue()
+	if !q.IsEmpty() {
+		t.Fatalf("Expected a new queue to be empty")
+	}
+	done := make(chan struct{})
+	go func() {
+		q.Enqueue("work") // Lands after the check, before the call.
+		close(done)
+	}()
+	<-done
+	select {
+	case <-q.NotifyNonEmpty():
+	case <-time.After(time.Second):
+		t.Fatalf("Expected NotifyNonEmpty to report the item stored before the call")
+	}
+	if item, ok := q.TryDequeue(); !ok || item != "work" {
+		t.Errorf("Expected TryDequeue to return work, but got %v, %v", item, ok)
+	}
+}
+
+// Test that an event loop woken by NotifyNonEmpty sees every item
+func TestNotifyNonEmptyLoop(t *testing.T) {
+	q := NewThreadSafeQueue()
+	const n = 1000
+	go func() {
+		for i := 0; i < n; i++ {
+			q.Enqueue(i)
+		}
+	}()
+	for got := 0; got < n; {
+		select {
+		case <-q.NotifyNonEmpty():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected a wakeup after %d items", got)
+		}
+		for {
+			item, ok := q.TryDequeue()
+			if !ok {
+				break
+			}
+			if item != got {
+				t.Fatalf("Expected item %d, but got %v", got, item)
+			}
+			got++
+		}
+	}
+}
+
+// Test that waiters with different thresholds are each released when their
+// own is reached by a slow producer
+func TestWaitForSize(t *testing.T) {
+	q := NewThreadSafeQueue()
+	thresholds := []int{1, 10, 100}
+	results := make([]chan error, len(thresholds))
+	for i, n := range thresholds {
+		results[i] = make(chan error, 1)
+		go func(n int, result chan error) {
+			result <- q.WaitForSize(context.Background(), n)
+		}(n, results[i])
+	}
+	awaitCount(t, func() int {
+		q.mu.RLock()
+		defer q.mu.RUnlock()
+		return len(q.sizeWaits)
+	}, len(thresholds))
+
+	next := 0
+	for size := 1; size <= 100; size++ {
+		q.Enqueue(size)
+		for i := next; i < len(thresholds); i++ {
+			if thresholds[i] > size {
+				select {
+				case err := <-results[i]:
+					t.Fatalf("Expected the waiter for %d to wait at size %d, but it returned %v", thresholds[i], size, err)
+				default:
+				}
+				continue
+			}
+			select {
+			case err := <-results[i]:
+				if err != nil {
+					t.Errorf("Expected the waiter for %d to return nil, but got %v", thresholds[i], err)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Expected the waiter for %d to be released at size %d", thresholds[i], size)
+			}
+			next++
+		}
+		time.Sleep(100 * time.Microsecond) // A slow producer.
+	}
+}
+
+// Test that WaitForSize returns at once when the size is reached, and
+// reports cancellation and Close
+func TestWaitForSizeEnds(t *testing.T) {
+	q := NewThreadSafeQueue()
+	q.Enqueue(1)
+	if err := q.WaitForSize(context.Background(), 1); err != nil {
+		t.Errorf("Expected WaitForSize(1) on a queue of one item to return nil, but got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.WaitForSize(ctx, 2); err != context.DeadlineExceeded {
+		t.Errorf("Expected WaitForSize to return %v, but got %v", context.DeadlineExceeded, err)
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- q.WaitForSize(context.Background(), 5)
+	}()
+	awaitCount(t, func() int {
+		q.mu.RLock()
+		defer q.mu.RUnlock()
+		return len(q.sizeWaits)
+	}, 1)
+	q.Close()
+	if err := <-result; err != ErrClosed {
+		t.Errorf("Expected WaitForSize to return %v after Close, but got %v", ErrClosed, err)
+	}
+	if err := q.WaitForSize(context.Background(), 5); err != ErrClosed {
+		t.Errorf("Expected WaitForSize on a closed queue to return %v, but got %v", ErrClosed, err)
+	}
+}
+
+// Test that WaitUntilEmpty returns when lagging consumers take the last item
+func TestWaitUntilEmpty(t *testing.T) {
+	q := NewThreadSafeQueue()
+	const producers, perProducer = 4, 50
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				q.Enqueue(i)
+			}
+		}()
+	}
+	wg.Wait() // The producers have stopped.
+	for c := 0; c < 2; c++ {
+		go func() {
+			for {
+				if _, ok := q.Dequeue(); !ok {
+					return
+				}
+				time.Sleep(50 * time.Microsecond) // Lagging behind.
+			}
+		}()
+	}
+	if err := q.WaitUntilEmpty(context.Background()); err != nil {
+		t.Fatalf("Expected WaitUntilEmpty to return nil, but got %v", err)
+	}
+	if got := q.Stats().Dequeued; got != producers*perProducer {
+		t.Errorf("Expected WaitUntilEmpty to return once all %d items were taken, but %d were", producers*perProducer, got)
+	}
+	q.Close()
+}
+
+// Test that WaitUntilEmpty keeps waiting when the queue is refilled in the
+// operation that empties it
+func TestWaitUntilEmptyRefill(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(1))
+	q.Enqueue("a")
+	go q.Enqueue("b") // Blocks until a is taken, then takes its place.
+	awaitCount(t, func() int { return q.Stats().WaitingProducers }, 1)
+	result := make(chan error, 1)
+	go func() {
+		result <- q.WaitUntilEmpty(context.Background())
+	}()
+	awaitCount(t, func() int {
+		q.mu.RLock()
+		defer q.mu.RUnlock()
+		return len(q.emptyChans)
+	}, 1)
+
+	q.TryDequeue() // Empties the queue, and b fills it in the same section.
+	select {
+	case err := <-result:
+		t.Fatalf("Expected WaitUntilEmpty to keep waiting through the refill, but it returned %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	q.TryDequeue()
+	if err := <-result; err != nil {
+		t.Errorf("Expected WaitUntilEmpty to return nil, but got %v", err)
+	}
+
+	q.Enqueue("c")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.WaitUntilEmpty(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected WaitUntilEmpty to return %v, but got %v", context.DeadlineExceeded, err)
+	}
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if len(q.emptyChans) != 0 {
+		t.Errorf("Expected WaitUntilEmpty to leave no channel behind on cancellation")
+	}
+}
+
+// receiveAll returns the values ch holds without blocking.
+func receiveAll(ch <-chan int) []int {
+	var values []int
+	for {
+		select {
+		case v, ok := <-ch:
+			if !ok {
+				return values
+			}
+			values = append(values, v)
+		default:
+			return values
+		}
+	}
+}
+
+// Test that WatchSize streams every size to each watcher, coalescing those
+// a slow watcher has no room for
+func TestWatchSize(t *testing.T) {
+	q := NewThreadSafeQueue()
+	q.Enqueue(0)
+	all := q.WatchSize(context.Background(), 10)
+	slow := q.WatchSize(context.Background(), 2)
+	q.Enqueue(1)
+	q.Enqueue(2)
+	q.TryDequeue()
+	q.Drain()
+
+	if got, want := receiveAll(all), []int{1, 2, 3, 2, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the watcher to receive %v, but got %v", want, got)
+	}
+	if got, want := receiveAll(slow), []int{2, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the slow watcher to receive %v, but got %v", want, got)
+	}
+}
+
+// Test that WatchSize closes its stream when ctx is done, and when the queue
+// is closed and drained
+func TestWatchSizeEnds(t *testing.T) {
+	q := NewThreadSafeQueue()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := q.WatchSize(ctx, 1)
+	kept := q.WatchSize(context.Background(), 1)
+	cancel()
+	<-cancelled // The current size.
+	select {
+	case _, ok := <-cancelled:
+		if ok {
+			t.Errorf("Expected no value after cancellation")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the stream to be closed after cancellation")
+	}
+
+	q.Enqueue(1)
+	q.Close()
+	if got, want := receiveAll(kept), []int{1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the watcher to receive %v until the queue is drained, but got %v", want, got)
+	}
+	q.TryDequeue()
+	if got, ok := <-kept; !ok || got != 0 {
+		t.Errorf("Expected the watcher to receive 0, but got %v, %v", got, ok)
+	}
+	if _, ok := <-kept; ok {
+		t.Errorf("Expected the stream to be closed once the closed queue is drained")
+	}
+	if got := receiveAll(q.WatchSize(context.Background(), 1)); !reflect.DeepEqual(got, []int{0}) {
+		t.Errorf("Expected a watcher of a closed empty queue to receive [0] and end, but got %v", got)
+	}
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if len(q.watchers) != 0 {
+		t.Errorf("Expected no watcher left, but found %d", len(q.watchers))
+	}
+}
+
+// Test that concurrent watchers each end with the final size
+func TestWatchSizeConcurrent(t *testing.T) {
+	q := NewThreadSafeQueue()
+	var wg sync.WaitGroup
+	last := make([]int, 4)
+	for i := range last {
+		ch := q.WatchSize(context.Background(), 1)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := range ch {
+				last[i] = n
+			}
+		}(i)
+	}
+	for i := 0; i < 1000; i++ {
+		q.Enqueue(i)
+	}
+	q.Close()
+	q.Drain()
+	wg.Wait()
+	for i, n := range last {
+		if n != 0 {
+			t.Errorf("Expected watcher %d to end with size 0, but got %d", i, n)
+		}
+	}
+}
+
+// Test that waiters with different thresholds are each released when the
+// queue drains below their own
+func TestWaitBelowThreshold(t *testing.T) {
+	q := NewThreadSafeQueue()
+	for i := 0; i < 100; i++ {
+		q.Enqueue(i)
+	}
+	thresholds := []int{50, 10, 1}
+	results := make([]chan error, len(thresholds))
+	for i, n := range thresholds {
+		results[i] = make(chan error, 1)
+		go func(n int, result chan error) {
+			result <- q.WaitBelowThreshold(context.Background(), n)
+		}(n, results[i])
+	}
+	awaitCount(t, func() int {
+		q.mu.RLock()
+		defer q.mu.RUnlock()
+		return len(q.sizeWaits)
+	}, len(thresholds))
+
+	next := 0
+	for size := 99; size >= 0; size-- {
+		q.TryDequeue()
+		for i := next; i < len(thresholds); i++ {
+			if size >= thresholds[i] {
+				select {
+				case err := <-results[i]:
+					t.Fatalf("Expected the waiter for %d to wait at size %d, but it returned %v", thresholds[i], size, err)
+				default:
+				}
+				continue
+			}
+			select {
+			case err := <-results[i]:
+				if err != nil {
+					t.Errorf("Expected the waiter for %d to return nil, but got %v", thresholds[i], err)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Expected the waiter for %d to be released at size %d", thresholds[i], size)
+			}
+			next++
+		}
+	}
+}
+
+// Test that WaitBelowThreshold returns at once below the threshold, and
+// reports cancellation and Close
+func TestWaitBelowThresholdEnds(t *testing.T) {
+	q := NewThreadSafeQueue()
+	if err := q.WaitBelowThreshold(context.Background(), 1); err != nil {
+		t.Errorf("Expected WaitBelowThreshold(1) on an empty queue to return nil, but got %v", err)
+	}
+	q.Enqueue(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.WaitBelowThreshold(ctx, 1); err != context.DeadlineExceeded {
+		t.Errorf("Expected WaitBelowThreshold to return %v, but got %v", context.DeadlineExceeded, err)
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- q.WaitBelowThreshold(context.Background(), 1)
+	}()
+	awaitCount(t, func() int {
+		q.mu.RLock()
+		defer q.mu.RUnlock()
+		return len(q.sizeWaits)
+	}, 1)
+	q.Close()
+	if err := <-result; err != ErrClosed {
+		t.Errorf("Expected WaitBelowThreshold to return %v after Close, but got %v", ErrClosed, err)
+	}
+}
+
+// Test that producers waiting below a threshold keep an unbounded queue
+// near it while a consumer drains it
+func TestWaitBelowThresholdFlowControl(t *testing.T) {
+	const producers, threshold, items = 4, 8, 500
+	q := NewThreadSafeQueue()
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < items; i++ {
+				if err := q.WaitBelowThreshold(context.Background(), threshold); err != nil {
+					t.Errorf("Expected the wait to succeed, but got %v", err)
+					return
+				}
+				q.Enqueue(i)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		q.Close()
+	}()
+	n := 0
+	for {
+		if _, ok := q.Dequeue(); !ok {
+			break
+		}
+		n++
+	}
+	if n != producers*items {
+		t.Errorf("Expected %d items, but got %d", producers*items, n)
+	}
+	// Each producer adds at most one item after seeing fewer than threshold.
+	if hw := q.Stats().HighWater; hw > threshold-1+producers {
+		t.Errorf("Expected the queue to stay under %d items, but it reached %d", threshold+producers, hw)
+	}
+}
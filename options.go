@@ -0,0 +1,67 @@
+package threadsafequeue
+
+// Option configures a ThreadSafeQueue at construction time.
+type Option func(*ThreadSafeQueue)
+
+// OverflowPolicy decides what a bounded queue does with an item enqueued
+// while it is full.
+type OverflowPolicy int
+
+const (
+	// Block makes Enqueue wait until a Dequeue frees space; blocked producers
+	// get the space in the order they started waiting. TryEnqueue returns
+	// ErrFull instead of waiting. This is the default.
+	Block OverflowPolicy = iota
+	// DropNewest discards the item being enqueued.
+	DropNewest
+	// DropOldest discards the item at the front of the queue to make room
+	// for the new one.
+	DropOldest
+)
+
+// String returns the name of the policy.
+func (p OverflowPolicy) String() string {
+	switch p {
+	case Block:
+		return "Block"
+	case DropNewest:
+		return "DropNewest"
+	case DropOldest:
+		return "DropOldest"
+	default:
+		return "OverflowPolicy(unknown)"
+	}
+}
+
+// WithCapacity bounds the queue to at most n items. What happens when a full
+// queue receives another item is decided by the overflow policy, which
+// defaults to Block. A value of zero or less leaves the queue unbounded.
+func WithCapacity(n int) Option {
+	return func(q *ThreadSafeQueue) {
+		if n < 0 {
+			n = 0
+		}
+		q.capacity = n
+	}
+}
+
+// WithOverflowPolicy sets how a bounded queue handles an item enqueued while
+// it is full. It has no effect on an unbounded queue.
+func WithOverflowPolicy(p OverflowPolicy) Option {
+	return func(q *ThreadSafeQueue) {
+		q.overflow = p
+	}
+}
+
+// WithInitialCapacity preallocates storage for n items, so the first n
+// Enqueues never reallocate. On a bounded queue n is capped at the bound. The
+// automatic shrink policy of WithShrink never releases storage below n; an
+// explicit Compact still can.
+func WithInitialCapacity(n int) Option {
+	return func(q *ThreadSafeQueue) {
+		if n < 0 {
+			n = 0
+		}
+		q.initialCap = n
+	}
+}
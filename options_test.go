@@ -0,0 +1,197 @@
+package threadsafequeue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Test that a bounded queue blocks Enqueue until a Dequeue frees space
+func TestBoundedQueueBlocks(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(2))
+	q.Enqueue(1)
+	q.Enqueue(2)
+
+	done := make(chan bool)
+	go func() {
+		q.Enqueue(3)
+		done <- true
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Enqueue on a full queue should block")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if item, ok := q.Dequeue(); !ok || item != 1 {
+		t.Errorf("Expected to dequeue 1, got %v", item)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Enqueue was not released by Dequeue")
+	}
+
+	if q.Size() != 2 {
+		t.Errorf("Expected size to be 2, got %d", q.Size())
+	}
+	if q.Cap() != 2 {
+		t.Errorf("Expected capacity to be 2, got %d", q.Cap())
+	}
+}
+
+// Test that TryEnqueue and EnqueueContext report a full queue
+func TestBoundedQueueTryEnqueue(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(1))
+	if err := q.TryEnqueue(1); err != nil {
+		t.Errorf("Expected TryEnqueue to succeed, got %v", err)
+	}
+	if err := q.TryEnqueue(2); err != ErrFull {
+		t.Errorf("Expected ErrFull, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := q.EnqueueContext(ctx, 2); err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	if q.Dropped() != 0 {
+		t.Errorf("Blocking policy should not drop items, got %d", q.Dropped())
+	}
+
+	q.Close()
+	if err := q.TryEnqueue(3); err != ErrClosed {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+}
+
+// Test the DropNewest overflow policy
+func TestBoundedQueueDropNewest(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(2), WithOverflowPolicy(DropNewest))
+	for i := 0; i < 5; i++ {
+		q.Enqueue(i)
+	}
+
+	if q.Dropped() != 3 {
+		t.Errorf("Expected 3 dropped items, got %d", q.Dropped())
+	}
+	if err := q.EnqueueContext(context.Background(), 5); err != ErrFull {
+		t.Errorf("Expected ErrFull, got %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		item, ok := q.Dequeue()
+		if !ok || item != i {
+			t.Errorf("Expected to dequeue %d, got %v", i, item)
+		}
+	}
+}
+
+// Test the DropOldest overflow policy
+func TestBoundedQueueDropOldest(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(2), WithOverflowPolicy(DropOldest))
+	for i := 0; i < 5; i++ {
+		q.Enqueue(i)
+	}
+	if err := q.TryEnqueue(5); err != nil {
+		t.Errorf("Expected TryEnqueue to evict the oldest item, got %v", err)
+	}
+
+	if q.Dropped() != 4 {
+		t.Errorf("Expected 4 dropped items, got %d", q.Dropped())
+	}
+
+	for _, expected := range []int{4, 5} {
+		item, ok := q.Dequeue()
+		if !ok || item != expected {
+			t.Errorf("Expected to dequeue %d, got %v", expected, item)
+		}
+	}
+}
+
+// Test that Close releases producers blocked on a full queue
+func TestBoundedQueueCloseReleasesProducers(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(1))
+	q.Enqueue(1)
+
+	done := make(chan error)
+	go func() {
+		done <- q.EnqueueContext(context.Background(), 2)
+	}()
+
+	// Allow some time for the producer to start and block
+	time.Sleep(100 * time.Millisecond)
+	q.Close()
+
+	select {
+	case err := <-done:
+		if err != ErrClosed {
+			t.Errorf("Expected ErrClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Blocked producer was not released by Close")
+	}
+}
+
+// Test that WithInitialCapacity preallocates storage up front
+func TestInitialCapacity(t *testing.T) {
+	q := NewThreadSafeQueue(WithInitialCapacity(1000))
+	if c := q.Stats().StorageCapacity; c != 1024 {
+		t.Fatalf("Expected 1024 preallocated slots, got %d", c)
+	}
+	for i := 0; i < 1000; i++ {
+		q.Enqueue(i)
+	}
+	if c := q.Stats().StorageCapacity; c != 1024 {
+		t.Errorf("Expected no reallocation, got %d slots", c)
+	}
+}
+
+// Test that the preallocation never exceeds the bound
+func TestInitialCapacityCappedByBound(t *testing.T) {
+	q := NewThreadSafeQueue(WithInitialCapacity(1000), WithCapacity(10))
+	if c := q.Stats().StorageCapacity; c != 16 {
+		t.Errorf("Expected 16 preallocated slots, got %d", c)
+	}
+}
+
+// Test that the shrink policy keeps the preallocated storage
+func TestInitialCapacityWithShrink(t *testing.T) {
+	q := NewThreadSafeQueue(WithInitialCapacity(1000), WithShrink(0, 2))
+	for i := 0; i < 5000; i++ {
+		q.Enqueue(i)
+	}
+	q.Drain()
+	if c := q.Stats().StorageCapacity; c != 1024 {
+		t.Errorf("Expected the storage to shrink to 1024, got %d", c)
+	}
+	if _, after := q.Compact(); after != 0 {
+		t.Errorf("Expected Compact to release the storage, got %d", after)
+	}
+}
+
+// Benchmark enqueueing a million items with and without preallocation
+func BenchmarkEnqueueMillion(b *testing.B) {
+	const n = 1000000
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"Grow", nil},
+		{"Preallocated", []Option{WithInitialCapacity(n)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			var item interface{} = struct{}{}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				q := NewThreadSafeQueue(bc.opts...)
+				for j := 0; j < n; j++ {
+					q.Enqueue(item)
+				}
+			}
+		})
+	}
+}
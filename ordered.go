@@ -0,0 +1,145 @@
+package threadsafequeue
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// orderedResult is a processed item tagged with its position in the source.
+type orderedResult struct {
+	seq    uint64
+	result interface{}
+	err    error
+}
+
+// ProcessOrdered processes items from q with a pool of workers and returns a
+// queue that receives the results strictly in the order the items were
+// dequeued, even though workers finish out of order. Results that finish
+// ahead of an earlier, slower item are buffered; WithReorderWindow bounds how
+// far ahead of the oldest unreleased item the workers may run (four times the
+// number of workers by default).
+//
+// By default an item for which fn fails is skipped and reported to the
+// error queue and handler, if configured. With HaltOnError, the first failure
+// (in source order) is reported and processing stops. The output queue is
+// closed once processing stops: when q is closed and drained, ctx is done,
+// or a failure halts it. Items taken from q whose results were not released
+// are then put back at the front of q in their original order, beyond the
+// capacity of a full q and even into a closed one, so nothing is lost when
+// processing is interrupted.
+func ProcessOrdered(ctx context.Context, q *ThreadSafeQueue, workers int, fn func(interface{}) (interface{}, error), opts ...StageOption) *ThreadSafeQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	cfg := &stage{window: 4 * workers}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.window < 1 {
+		cfg.window = 1
+	}
+
+	out := NewThreadSafeQueue()
+	ctx, cancel := context.WithCancel(ctx)
+	tokens := make(chan struct{}, cfg.window) // One token per unreleased item.
+	jobs := make(chan orderedResult)
+	results := make(chan orderedResult, workers)
+
+	var mu sync.Mutex
+	taken := make(map[uint64]interface{}) // Items taken from q and not yet released.
+
+	// The dispatcher tags items with sequence numbers.
+	go func() {
+		defer close(jobs)
+		for seq := uint64(0); ; seq++ {
+			select {
+			case tokens <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			item, err := q.DequeueContext(ctx)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			taken[seq] = item
+			mu.Unlock()
+			select {
+			case jobs <- orderedResult{seq: seq, result: item}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				result, err := fn(job.result)
+				results <- orderedResult{seq: job.seq, result: result, err: err}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// The collector releases results in sequence order.
+	go func() {
+		defer cancel()
+		pending := make(map[uint64]orderedResult)
+		var next uint64
+		stopped := false
+		for r := range results {
+			if stopped {
+				continue // Keep draining so the workers can exit.
+			}
+			pending[r.seq] = r
+			for {
+				r, ok := pending[next]
+				if !ok {
+					break
+				}
+				if ctx.Err() != nil {
+					stopped = true // Cancelled: release nothing more.
+					break
+				}
+				delete(pending, next)
+				mu.Lock()
+				item := taken[next]
+				delete(taken, next)
+				mu.Unlock()
+				next++
+				<-tokens
+				if r.err == nil {
+					out.Enqueue(r.result)
+					continue
+				}
+				cfg.report(item, r.err)
+				if cfg.halt {
+					stopped = true
+					cancel()
+					break
+				}
+			}
+		}
+
+		// Put back whatever was taken but not released, oldest at the front.
+		seqs := make([]uint64, 0, len(taken))
+		for seq := range taken {
+			seqs = append(seqs, seq)
+		}
+		sort.Slice(seqs, func(i, j int) bool { return seqs[i] > seqs[j] })
+		for _, seq := range seqs {
+			q.putBack(taken[seq])
+		}
+		out.Close()
+	}()
+
+	return out
+}
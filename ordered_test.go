@@ -0,0 +1,245 @@
+package threadsafequeue
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test that results are released in source order despite out-of-order completion
+func TestProcessOrdered(t *testing.T) {
+	q := NewThreadSafeQueue()
+	const count = 500
+	for i := 0; i < count; i++ {
+		q.Enqueue(i)
+	}
+	q.Close()
+
+	out := ProcessOrdered(context.Background(), q, 8, func(v interface{}) (interface{}, error) {
+		time.Sleep(time.Duration(rand.Intn(200)) * time.Microsecond)
+		return v.(int) * 10, nil
+	})
+
+	for i := 0; i < count; i++ {
+		item, ok := out.Dequeue()
+		if !ok || item != i*10 {
+			t.Fatalf("Expected result %d, got %v", i*10, item)
+		}
+	}
+	if _, ok := out.Dequeue(); ok {
+		t.Error("Output should be closed once the source is drained")
+	}
+}
+
+// Test that the reorder window bounds how far workers run ahead
+func TestProcessOrderedWindow(t *testing.T) {
+	q := NewThreadSafeQueue()
+	for i := 0; i < 100; i++ {
+		q.Enqueue(i)
+	}
+	q.Close()
+
+	release := make(chan struct{})
+	var started int32
+	out := ProcessOrdered(context.Background(), q, 4, func(v interface{}) (interface{}, error) {
+		atomic.AddInt32(&started, 1)
+		if v == 0 {
+			<-release // The first item is slow.
+		}
+		return v, nil
+	}, WithReorderWindow(10))
+
+	// Allow some time for the workers to run as far ahead as they may
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&started); n != 10 {
+		t.Errorf("Expected exactly 10 items in flight, got %d", n)
+	}
+	if !out.IsEmpty() {
+		t.Error("No result may be released before the first item")
+	}
+
+	close(release)
+	for i := 0; i < 100; i++ {
+		if item, ok := out.Dequeue(); !ok || item != i {
+			t.Fatalf("Expected result %d, got %v", i, item)
+		}
+	}
+}
+
+// Test that failures are skipped and reported by default
+func TestProcessOrderedSkipErrors(t *testing.T) {
+	q := NewThreadSafeQueue()
+	for i := 0; i < 10; i++ {
+		q.Enqueue(i)
+	}
+	q.Close()
+
+	errs := NewThreadSafeQueue()
+	out := ProcessOrdered(context.Background(), q, 3, func(v interface{}) (interface{}, error) {
+		if v.(int)%3 == 0 {
+			return nil, errors.New("bad")
+		}
+		return v, nil
+	}, WithErrorQueue(errs))
+
+	var results []interface{}
+	for {
+		item, ok := out.Dequeue()
+		if !ok {
+			break
+		}
+		results = append(results, item)
+	}
+
+	expected := []interface{}{1, 2, 4, 5, 7, 8}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, results)
+	}
+	for i := range expected {
+		if results[i] != expected[i] {
+			t.Errorf("Expected %v at position %d, got %v", expected[i], i, results[i])
+		}
+	}
+
+	// Errors are reported in source order too.
+	for _, bad := range []int{0, 3, 6, 9} {
+		item, _ := errs.TryDequeue()
+		if se, ok := item.(*StageError); !ok || se.Item != bad {
+			t.Errorf("Expected an error for %d, got %v", bad, item)
+		}
+	}
+}
+
+// Test that HaltOnError stops at the first failure and returns unreleased items
+func TestProcessOrderedHalt(t *testing.T) {
+	q := NewThreadSafeQueue()
+	for i := 0; i < 20; i++ {
+		q.Enqueue(i)
+	}
+
+	var reported []interface{}
+	out := ProcessOrdered(context.Background(), q, 4, func(v interface{}) (interface{}, error) {
+		if v == 5 {
+			return nil, errors.New("bad")
+		}
+		return v, nil
+	}, HaltOnError(), WithErrorHandler(func(item interface{}, err error) {
+		reported = append(reported, item)
+	}))
+
+	for i := 0; i < 5; i++ {
+		if item, ok := out.Dequeue(); !ok || item != i {
+			t.Fatalf("Expected result %d, got %v", i, item)
+		}
+	}
+	if item, ok := out.Dequeue(); ok {
+		t.Fatalf("Output should be closed after the failure, got %v", item)
+	}
+
+	if len(reported) != 1 || reported[0] != 5 {
+		t.Errorf("Expected only item 5 to be reported, got %v", reported)
+	}
+
+	// Everything after the failing item is back in the source, in order.
+	items := q.ToSlice()
+	if len(items) != 14 {
+		t.Fatalf("Expected 14 items back in the source, got %v", items)
+	}
+	for i, item := range items {
+		if item != i+6 {
+			t.Errorf("Expected %d at position %d, got %v", i+6, i, item)
+		}
+	}
+}
+
+// Test that cancellation closes the output and requeues unreleased items
+func TestProcessOrderedCancel(t *testing.T) {
+	q := NewThreadSafeQueue()
+	for i := 0; i < 10; i++ {
+		q.Enqueue(i)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	block := make(chan struct{})
+	out := ProcessOrdered(ctx, q, 2, func(v interface{}) (interface{}, error) {
+		if v == 3 {
+			<-block
+		}
+		return v, nil
+	})
+
+	for i := 0; i < 3; i++ {
+		if item, ok := out.Dequeue(); !ok || item != i {
+			t.Fatalf("Expected result %d, got %v", i, item)
+		}
+	}
+
+	cancel()
+	close(block)
+	if item, ok := out.Dequeue(); ok {
+		t.Errorf("Output should be closed after cancellation, got %v", item)
+	}
+
+	items := q.ToSlice()
+	if len(items) != 7 {
+		t.Fatalf("Expected the 7 unreleased items back in the source, got %v", items)
+	}
+	for i, item := range items {
+		if item != i+3 {
+			t.Errorf("Expected %d at position %d, got %v", i+3, i, item)
+		}
+	}
+}
+
+// Test that unreleased items go back into a source that is full or closed
+func TestProcessOrderedCancelFullOrClosed(t *testing.T) {
+	for _, closeSource := range []bool{false, true} {
+		q := NewThreadSafeQueue(WithCapacity(2), WithDebugChecks(true))
+		q.Enqueue(0)
+		q.Enqueue(1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		block := make(chan struct{})
+		out := ProcessOrdered(ctx, q, 1, func(v interface{}) (interface{}, error) {
+			<-block
+			return v, nil
+		})
+
+		for !q.IsEmpty() { // Wait for both items to be taken.
+			time.Sleep(time.Millisecond)
+		}
+		q.Enqueue(10)
+		q.Enqueue(11) // Full again.
+		if closeSource {
+			q.Close()
+		}
+		cancel()
+		close(block)
+
+		done := make(chan struct{})
+		go func() {
+			out.Dequeue()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("ProcessOrdered did not stop after cancellation")
+		}
+
+		items := q.Drain()
+		want := []interface{}{0, 1, 10, 11}
+		if len(items) != len(want) {
+			t.Fatalf("Expected %v with closed=%v, got %v", want, closeSource, items)
+		}
+		for i := range want {
+			if items[i] != want[i] {
+				t.Errorf("Expected %v with closed=%v, got %v", want, closeSource, items)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package threadsafequeue
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// ErrCorrupt is returned, wrapped with the details, when data being loaded
+// into a queue is not in the expected format or ends early.
+var ErrCorrupt = errors.New("threadsafequeue: corrupt data")
+
+// The format written by Save is a header of the magic string, the format
+// version and the item count, then every item as a record with an empty
+// head, whose body holds the bytes written by encode. Records are described
+// with formatVersion.
+//
+//	header: "TSQS", version (uint16), count (uint64), checksum of the
+//	        header (uint32), all big-endian
+const (
+	snapshotMagic = "TSQS"
+	headerLen     = len(snapshotMagic) + 2 + 8
+
+	maxFrameLen = 1 << 31 // Longer item lengths are taken for corruption.
+)
+
+// LoadOption configures Load.
+type LoadOption func(*loadOptions)
+
+type loadOptions struct {
+	replace     bool
+	skipCorrupt bool
+}
+
+// LoadReplace makes Load replace the items in the queue, rather than add the
+// loaded ones after them. The items replaced are removed as if by Drain.
+func LoadReplace(replace bool) LoadOption {
+	return func(o *loadOptions) {
+		o.replace = replace
+	}
+}
+
+// LoadSkipCorrupt makes Load, and RecoverWAL, leave out the records that fail
+// their checksum and read on, to salvage what is left of a damaged file. The
+// error returned then joins a *CorruptError for each record skipped, while
+// the other records are read as usual. Damage that leaves the records after
+// it impossible to find, such as a corrupt length or header, still stops
+// the read, and records of files written before checksums were added cannot
+// be checked.
+func LoadSkipCorrupt(skip bool) LoadOption {
+	return func(o *loadOptions) {
+		o.skipCorrupt = skip
+	}
+}
+
+// Save writes the items in the queue to w, in FIFO order, encoding each one
+// with codec. Items are written one at a time, each with its length in
+// front and checksummed, after a header giving their count, so that Load
+// can check that it has read them all and intact. The snapshot is
+// consistent: Save copies the list of items in a single critical section,
+// but not the items themselves, and encodes them without holding the lock,
+// so producers and consumers carry on while a large queue is written. The
+// queue is not modified, and an item changed after it was enqueued is
+// written as it is when encoded.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) Save(w io.Writer, codec Codec) error {
+	return save(w, q.ToSlice(), codec)
+}
+
+// save writes items in the format of Save.
+func save(w io.Writer, items []interface{}, codec Codec) error {
+	bw := bufio.NewWriter(w)
+	if err := writeHeader(bw, len(items)); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	var rec []byte
+	for i, item := range items {
+		buf.Reset()
+		if err := codec.Encode(&buf, item); err != nil {
+			return fmt.Errorf("threadsafequeue: encoding item %d: %w", i, err)
+		}
+		rec = appendRecord(rec[:0], nil, buf.Bytes())
+		if _, err := bw.Write(rec); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Load reads items written by Save from r, decoding each one with codec,
+// and adds them to the back of the queue, or replaces its items with them
+// under LoadReplace. Decoded items are checked as EnqueueContext would,
+// against WithRejectNil and WithElementType.
+//
+// The whole stream is read and checked before the queue is touched: if the
+// header is not that of a snapshot, the stream ends early, an item fails its
+// checksum or cannot be decoded, Load returns an error, wrapping ErrCorrupt
+// for a malformed or truncated stream, and the queue is left unchanged. To
+// that end, Load holds on to the decoded items in a list until the end, as
+// Save does, at the cost of one interface value per item: the items are not
+// copied, and the stream is read one item at a time. A damaged item is
+// reported as a *CorruptError giving its position; with LoadSkipCorrupt,
+// such items are left out instead. Streams in an older format version are
+// read as well, and newer ones refused with ErrVersion. The items are then
+// added as by EnqueueBatch, so a full bounded queue applies its overflow
+// policy, blocking if need be. If the queue is closed, Load returns
+// ErrClosed.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) Load(r io.Reader, codec Codec, opts ...LoadOption) error {
+	var o loadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var items []interface{}
+	skipped, err := readSnapshot(r, "", codec, o.skipCorrupt, func(i int, item interface{}) error {
+		if err := q.validate(item); err != nil {
+			return fmt.Errorf("threadsafequeue: item %d: %w", i, err)
+		}
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	q.lock()
+	defer q.unlock()
+	if err := q.load(items, o.replace); err != nil {
+		return err
+	}
+	return skipped
+}
+
+// readSnapshot reads a snapshot in the format of Save from r, passing each
+// item decoded by codec to add with its index. A damaged item is returned
+// as a *CorruptError for file, unless skip is set, in which case it is left
+// out and the errors for all such items are returned joined in skipped.
+func readSnapshot(r io.Reader, file string, codec Codec, skip bool, add func(i int, item interface{}) error) (skipped, err error) {
+	cr := &countingReader{r: bufio.NewReader(r)}
+	version, count, err := readHeader(cr)
+	if err != nil {
+		if file != "" {
+			err = fmt.Errorf("%s: %w", file, err)
+		}
+		return nil, err
+	}
+	var errs []error
+	var buf bytes.Buffer
+	for i := uint64(0); i < count; i++ {
+		offset := cr.n
+		var err error
+		if version == formatV1 {
+			err = readFrame(cr, &buf)
+		} else if err = readRecord(cr, nil, &buf); err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			cerr := &CorruptError{File: file, Record: int(i), Offset: offset, Err: err}
+			if err == errChecksum && skip {
+				errs = append(errs, cerr)
+				continue
+			}
+			return nil, cerr
+		}
+		item, err := codec.Decode(&buf)
+		if err != nil {
+			if file != "" {
+				return nil, fmt.Errorf("threadsafequeue: %s: decoding item %d: %w", file, i, err)
+			}
+			return nil, fmt.Errorf("threadsafequeue: decoding item %d: %w", i, err)
+		}
+		if err := add(int(i), item); err != nil {
+			return nil, err
+		}
+	}
+	return errors.Join(errs...), nil
+}
+
+// load adds items as EnqueueBatch does, first removing the queue's own if
+// replace is set. It returns ErrClosed if the queue is closed. The caller
+// must hold q.mu exclusively.
+func (q *ThreadSafeQueue) load(items []interface{}, replace bool) error {
+	if q.closed {
+		q.rejected += uint64(len(items))
+		return ErrClosed
+	}
+	if replace {
+		for range q.drain() {
+			q.taskDone() // Nobody will take the replaced items.
+		}
+	}
+	for i, item := range items {
+		// Waiting for room unlocks, so the queue may be closed meanwhile.
+		if q.put(nil, item, extra{}, false) == ErrClosed {
+			q.rejected += uint64(len(items) - i - 1)
+			return ErrClosed
+		}
+	}
+	return nil
+}
+
+// writeHeader writes the snapshot header for count items.
+func writeHeader(w io.Writer, count int) error {
+	h := make([]byte, headerLen, headerLen+checksumLen)
+	copy(h, snapshotMagic)
+	binary.BigEndian.PutUint16(h[len(snapshotMagic):], formatVersion)
+	binary.BigEndian.PutUint64(h[len(snapshotMagic)+2:], uint64(count))
+	_, err := w.Write(appendChecksum(h, h))
+	return err
+}
+
+// readHeader checks the snapshot header and returns the format version and
+// the item count.
+func readHeader(r io.Reader) (version uint16, count uint64, err error) {
+	var h [headerLen]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, 0, fmt.Errorf("%w: header: %w", ErrCorrupt, err)
+	}
+	if string(h[:len(snapshotMagic)]) != snapshotMagic {
+		return 0, 0, fmt.Errorf("%w: not a queue snapshot", ErrCorrupt)
+	}
+	version = binary.BigEndian.Uint16(h[len(snapshotMagic):])
+	if err := checkVersion(version, "snapshot"); err != nil {
+		return 0, 0, err
+	}
+	if version >= formatV2 {
+		if err := readChecksum(r, crc32.Checksum(h[:], castagnoli)); err != nil {
+			return 0, 0, fmt.Errorf("%w: header: %w", ErrCorrupt, err)
+		}
+	}
+	return version, binary.BigEndian.Uint64(h[len(snapshotMagic)+2:]), nil
+}
+
+// frameReader is what readFrame reads from.
+type frameReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// readFrame reads an item framed by its length, as a uvarint, into buf, as
+// format version 1 writes them. The buffer grows as the bytes arrive, so a
+// corrupt length cannot make it allocate more than the stream holds.
+func readFrame(r frameReader, buf *bytes.Buffer) error {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if n > maxFrameLen {
+		return fmt.Errorf("item length %d out of range", n)
+	}
+	buf.Reset()
+	if _, err := io.CopyN(buf, r, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return nil
+}
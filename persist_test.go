@@ -0,0 +1,230 @@
+package threadsafequeue
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// encodeInt and decodeInt save int items as eight bytes
+func encodeInt(item interface{}, w io.Writer) error {
+	v, ok := item.(int)
+	if !ok {
+		return fmt.Errorf("%T is not an int", item)
+	}
+	return binary.Write(w, binary.BigEndian, int64(v))
+}
+
+func decodeInt(r io.Reader) (interface{}, error) {
+	var v int64
+	err := binary.Read(r, binary.BigEndian, &v)
+	return int(v), err
+}
+
+// decodeFunc is a Codec encoding ints and decoding with the function
+type decodeFunc func(r io.Reader) (interface{}, error)
+
+func (f decodeFunc) Encode(w io.Writer, item interface{}) error { return encodeInt(item, w) }
+
+func (f decodeFunc) Decode(r io.Reader) (interface{}, error) { return f(r) }
+
+// savedInts returns a snapshot of the items 0 to n-1
+func savedInts(t *testing.T, n int) []byte {
+	t.Helper()
+	q := NewThreadSafeQueue()
+	for i := 0; i < n; i++ {
+		q.Enqueue(i)
+	}
+	var buf bytes.Buffer
+	if err := q.Save(&buf, &intCodec{}); err != nil {
+		t.Fatalf("Expected Save to succeed, got %v", err)
+	}
+	return buf.Bytes()
+}
+
+// Test that Load restores the items written by Save in order
+func TestSaveLoad(t *testing.T) {
+	q := NewThreadSafeQueue()
+	for i := 0; i < 1000; i++ {
+		q.Enqueue(i)
+	}
+	var buf bytes.Buffer
+	if err := q.Save(&buf, &intCodec{}); err != nil {
+		t.Fatalf("Expected Save to succeed, got %v", err)
+	}
+	if q.Size() != 1000 {
+		t.Errorf("Expected Save to leave 1000 items, got %d", q.Size())
+	}
+	loaded := NewThreadSafeQueue()
+	if err := loaded.Load(&buf, &intCodec{}); err != nil {
+		t.Fatalf("Expected Load to succeed, got %v", err)
+	}
+	if got, want := loaded.ToSlice(), q.ToSlice(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the loaded items to match the saved ones")
+	}
+}
+
+// Test that Load appends by default and replaces with LoadReplace
+func TestLoadAppendOrReplace(t *testing.T) {
+	data := savedInts(t, 2)
+	q := NewThreadSafeQueue()
+	q.Enqueue(-1)
+	if err := q.Load(bytes.NewReader(data), &intCodec{}); err != nil {
+		t.Fatalf("Expected Load to succeed, got %v", err)
+	}
+	if got := q.ToSlice(); !reflect.DeepEqual(got, []interface{}{-1, 0, 1}) {
+		t.Errorf("Expected the items to be appended, got %v", got)
+	}
+	if err := q.Load(bytes.NewReader(data), &intCodec{}, LoadReplace(true)); err != nil {
+		t.Fatalf("Expected Load to succeed, got %v", err)
+	}
+	if got := q.ToSlice(); !reflect.DeepEqual(got, []interface{}{0, 1}) {
+		t.Errorf("Expected the items to be replaced, got %v", got)
+	}
+	q.Close()
+	if err := q.Load(bytes.NewReader(data), &intCodec{}); err != ErrClosed {
+		t.Errorf("Expected ErrClosed loading into a closed queue, got %v", err)
+	}
+}
+
+// Test that Load fails cleanly at every point a snapshot can be cut short
+func TestLoadTruncated(t *testing.T) {
+	data := savedInts(t, 3)
+	for i := 0; i < len(data); i++ {
+		q := NewThreadSafeQueue()
+		q.Enqueue("kept")
+		err := q.Load(bytes.NewReader(data[:i]), &intCodec{})
+		if !errors.Is(err, ErrCorrupt) || !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("Expected a truncation error at %d bytes, got %v", i, err)
+		}
+		if q.Size() != 1 {
+			t.Errorf("Expected a failed Load at %d bytes to leave the queue unchanged, got %d items", i, q.Size())
+		}
+	}
+}
+
+// Test that Load checks the header
+func TestLoadHeader(t *testing.T) {
+	data := savedInts(t, 1)
+	q := NewThreadSafeQueue()
+
+	bad := append([]byte("XXXX"), data[4:]...)
+	if err := q.Load(bytes.NewReader(bad), &intCodec{}); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for a bad magic string, got %v", err)
+	}
+	newer := append([]byte(nil), data...)
+	binary.BigEndian.PutUint16(newer[4:], formatVersion+1)
+	if err := q.Load(bytes.NewReader(newer), &intCodec{}); !errors.Is(err, ErrVersion) {
+		t.Errorf("Expected ErrVersion for a newer format version, got %v", err)
+	}
+	if !q.IsEmpty() {
+		t.Errorf("Expected failed loads to add nothing, got %d items", q.Size())
+	}
+}
+
+// Test that encode and decode errors are reported with the item's position
+func TestSaveLoadErrors(t *testing.T) {
+	q := NewThreadSafeQueue()
+	q.EnqueueBatch(1, "two")
+	if err := q.Save(io.Discard, &intCodec{}); err == nil {
+		t.Error("Expected Save to fail on an item intCodec cannot encode")
+	}
+
+	failing := errors.New("bad item")
+	decode := func(r io.Reader) (interface{}, error) {
+		return nil, failing
+	}
+	if err := q.Load(bytes.NewReader(savedInts(t, 1)), decodeFunc(decode)); !errors.Is(err, failing) {
+		t.Errorf("Expected the decode error, got %v", err)
+	}
+
+	strict := NewThreadSafeQueue(WithRejectNil(true))
+	decodeNil := func(r io.Reader) (interface{}, error) {
+		_, err := io.Copy(io.Discard, r)
+		return nil, err
+	}
+	if err := strict.Load(bytes.NewReader(savedInts(t, 1)), decodeFunc(decodeNil)); !errors.Is(err, ErrNilItem) {
+		t.Errorf("Expected ErrNilItem loading a nil item, got %v", err)
+	}
+}
+
+// Test that flipping any bit of a snapshot is detected and loads nothing
+func TestLoadDetectsFlippedBits(t *testing.T) {
+	data := savedInts(t, 20)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		bad := append([]byte(nil), data...)
+		at, bit := rng.Intn(len(bad)), rng.Intn(8)
+		bad[at] ^= 1 << bit
+		q := NewThreadSafeQueue()
+		err := q.Load(bytes.NewReader(bad), &intCodec{})
+		if !errors.Is(err, ErrCorrupt) && !errors.Is(err, ErrVersion) {
+			t.Fatalf("Expected flipping bit %d of byte %d to be detected, got %v", bit, at, err)
+		}
+		if !q.IsEmpty() {
+			t.Fatalf("Expected a damaged snapshot to load nothing, got %v", q.ToSlice())
+		}
+	}
+}
+
+// Test that LoadSkipCorrupt leaves out the items that fail their checksum
+// and reports each of them
+func TestLoadSkipCorrupt(t *testing.T) {
+	data := savedInts(t, 10)
+	record := func(i int) int { return headerLen + checksumLen + i*(4+checksumLen+8+checksumLen) }
+	bad := append([]byte(nil), data...)
+	bad[record(3)+4+checksumLen] ^= 1
+	bad[record(7)+4+checksumLen+8] ^= 1 // The checksum of the body.
+
+	q := NewThreadSafeQueue()
+	err := q.Load(bytes.NewReader(bad), &intCodec{})
+	var cerr *CorruptError
+	if !errors.As(err, &cerr) || cerr.Record != 3 || cerr.Offset != int64(record(3)) || !q.IsEmpty() {
+		t.Fatalf("Expected a CorruptError for record 3 and nothing loaded, got %v", err)
+	}
+
+	err = q.Load(bytes.NewReader(bad), &intCodec{}, LoadSkipCorrupt(true))
+	if want := []interface{}{0, 1, 2, 4, 5, 6, 8, 9}; !reflect.DeepEqual(q.ToSlice(), want) {
+		t.Errorf("Expected the intact items %v, got %v", want, q.ToSlice())
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok || len(joined.Unwrap()) != 2 {
+		t.Fatalf("Expected two skipped records to be reported, got %v", err)
+	}
+	for i, want := range []int{3, 7} {
+		if !errors.As(joined.Unwrap()[i], &cerr) || cerr.Record != want {
+			t.Errorf("Expected record %d to be reported, got %v", want, joined.Unwrap()[i])
+		}
+	}
+
+	bad = append([]byte(nil), data...)
+	bad[record(5)] ^= 1 // The length, which cannot be skipped.
+	if err := NewThreadSafeQueue().Load(bytes.NewReader(bad), &intCodec{}, LoadSkipCorrupt(true)); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected a damaged length to stop the load, got %v", err)
+	}
+}
+
+// Test that snapshots in format version 1, without checksums, still load
+func TestLoadVersion1(t *testing.T) {
+	data := []byte(snapshotMagic)
+	data = binary.BigEndian.AppendUint16(data, formatV1)
+	data = binary.BigEndian.AppendUint64(data, 3)
+	for i := 0; i < 3; i++ {
+		var item bytes.Buffer
+		encodeInt(i, &item)
+		data = binary.AppendUvarint(data, uint64(item.Len()))
+		data = append(data, item.Bytes()...)
+	}
+	q := NewThreadSafeQueue()
+	if err := q.Load(bytes.NewReader(data), &intCodec{}); err != nil {
+		t.Fatalf("Expected a version 1 snapshot to load, got %v", err)
+	}
+	if want := []interface{}{0, 1, 2}; !reflect.DeepEqual(q.ToSlice(), want) {
+		t.Errorf("Expected %v, got %v", want, q.ToSlice())
+	}
+}
@@ -0,0 +1,67 @@
+package threadsafequeue
+
+import "context"
+
+// Propagator carries context across the queue, from the producer of an item
+// to its consumer, such as the trace span that enqueued it. The queue treats
+// what it carries as opaque: Inject turns the producer's context into a
+// carrier kept beside the item, and Extract turns it back into a context for
+// the consumer. The queueotel package provides one for OpenTelemetry.
+type Propagator interface {
+	// Inject returns what ctx should carry to the consumer.
+	Inject(ctx context.Context) map[string]string
+	// Extract returns ctx with the carrier of an item applied, such as the
+	// producer's span context. The carrier is nil for items enqueued
+	// without EnqueueSpan.
+	Extract(ctx context.Context, carrier map[string]string) context.Context
+}
+
+// carrier is what a Propagator injected for an item.
+type carrier = map[string]string
+
+// WithPropagator makes EnqueueSpan keep p.Inject of its context with the
+// item, and DequeueSpan return p.Extract of it. Without a propagator, the
+// queue keeps nothing beside its items and the span methods behave like
+// Enqueue and Dequeue.
+func WithPropagator(p Propagator) Option {
+	return func(q *ThreadSafeQueue) {
+		q.propagator = p
+	}
+}
+
+// EnqueueSpan is like Enqueue but keeps the context of ctx, as injected by
+// the queue's Propagator, with the item, for DequeueSpan to hand to the
+// consumer. ctx does not cancel the call. Items it enqueues can be dequeued
+// by any method; only DequeueSpan sees the carried context.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) EnqueueSpan(ctx context.Context, item interface{}) {
+	q.mustValidate(item)
+	item = q.copyItem(item)
+	var x extra
+	if q.propagator != nil {
+		x.carrier = q.propagator.Inject(ctx)
+	}
+	q.throttle(nil, 1)
+	r := q.startRegion(traceEnqueueRegion)
+	q.lock()
+	q.put(nil, item, x, false)
+	q.unlock()
+	endRegion(r)
+}
+
+// DequeueSpan is like Dequeue but also returns ctx with the context carried
+// by the item applied by the queue's Propagator, so that the consumer can,
+// for instance, start its span with a link to the producer's. Without a
+// propagator, or if the queue is closed and drained, it returns ctx itself.
+// ctx does not cancel the call.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) DequeueSpan(ctx context.Context) (interface{}, context.Context, bool) {
+	item, x, ok := q.dequeueExtra()
+	if !ok {
+		return nil, ctx, false
+	}
+	if q.propagator != nil {
+		ctx = q.propagator.Extract(ctx, x.carrier)
+	}
+	return item, ctx, true
+}
@@ -0,0 +1,98 @@
+package threadsafequeue
+
+import (
+	"context"
+	"testing"
+)
+
+type traceIDKey struct{}
+
+// testPropagator carries a trace ID stored in the context.
+type testPropagator struct{}
+
+func (testPropagator) Inject(ctx context.Context) map[string]string {
+	id, _ := ctx.Value(traceIDKey{}).(string)
+	return map[string]string{"trace": id}
+}
+
+func (testPropagator) Extract(ctx context.Context, carrier map[string]string) context.Context {
+	if id, ok := carrier["trace"]; ok {
+		return context.WithValue(ctx, traceIDKey{}, id)
+	}
+	return ctx
+}
+
+func traceID(ctx context.Context) string {
+	id, _ := ctx.Value(traceIDKey{}).(string)
+	return id
+}
+
+// Test that DequeueSpan returns the context each item was enqueued with,
+// whichever way the item travelled through the queue
+func TestPropagation(t *testing.T) {
+	q := NewThreadSafeQueue(WithPropagator(testPropagator{}), WithCapacity(3), WithOverflowPolicy(DropOldest))
+	span := func(id string) context.Context { return context.WithValue(context.Background(), traceIDKey{}, id) }
+	q.EnqueueSpan(span("a"), 1)
+	q.Enqueue(2)
+	q.EnqueueSpan(span("c"), 3)
+	q.EnqueueSpan(span("d"), 4) // Evicts 1 and its carrier.
+	q.EnqueueFront(0)           // Evicts 2.
+
+	want := []struct {
+		item  int
+		trace string
+	}{{0, ""}, {3, "c"}}
+	for _, w := range want {
+		item, ctx, ok := q.DequeueSpan(context.Background())
+		if !ok || item != w.item || traceID(ctx) != w.trace {
+			t.Errorf("Expected item %d with trace %q, got %v with %q", w.item, w.trace, item, traceID(ctx))
+		}
+	}
+	q.Drain() // Drops 4 and its carrier.
+
+	done := make(chan string)
+	go func() {
+		_, ctx, _ := q.DequeueSpan(context.Background())
+		done <- traceID(ctx)
+	}()
+	awaitCount(t, q.WaitingConsumers, 1)
+	q.EnqueueSpan(span("e"), 5) // Handed straight to the parked consumer.
+	if id := <-done; id != "e" {
+		t.Errorf("Expected the handed item to carry trace e, got %q", id)
+	}
+
+	q.Close()
+	ctx := span("mine")
+	if _, got, ok := q.DequeueSpan(ctx); ok || got != ctx {
+		t.Error("Expected DequeueSpan on a closed queue to return false and the given context")
+	}
+}
+
+// Test that a producer blocked on a full queue keeps its carrier until its
+// item is stored
+func TestPropagationBlockedProducer(t *testing.T) {
+	q := NewThreadSafeQueue(WithPropagator(testPropagator{}), WithCapacity(1))
+	q.Enqueue(1)
+	go q.EnqueueSpan(context.WithValue(context.Background(), traceIDKey{}, "b"), 2)
+	awaitCount(t, q.WaitingProducers, 1)
+	q.Dequeue()
+	if _, ctx, _ := q.DequeueSpan(context.Background()); traceID(ctx) != "b" {
+		t.Errorf("Expected the blocked producer's trace, got %q", traceID(ctx))
+	}
+}
+
+// Test that without a propagator the span methods behave like Enqueue and
+// Dequeue
+func TestNoPropagator(t *testing.T) {
+	q := NewThreadSafeQueue()
+	ctx := context.WithValue(context.Background(), traceIDKey{}, "a")
+	q.EnqueueSpan(ctx, 1)
+	base := context.Background()
+	item, got, ok := q.DequeueSpan(base)
+	if !ok || item != 1 || got != base {
+		t.Errorf("Expected item 1 and the given context, got %v, %v", item, got)
+	}
+	if q.extras.cap() != 0 {
+		t.Error("Expected nothing to be kept beside the items")
+	}
+}
@@ -0,0 +1,145 @@
+package threadsafequeue
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultSubscriberCapacity is the capacity of subscriber queues created by
+// PubSub when no options are given.
+const DefaultSubscriberCapacity = 1024
+
+// PubSub routes published items to subscriber queues by topic. Topics are
+// dot-separated names such as "orders.created". A subscription pattern
+// matches a topic segment by segment, where a "*" segment matches any single
+// segment: "orders.*" matches "orders.created" but not "orders" or
+// "orders.created.eu".
+//
+// Publishers are never blocked by slow subscribers. Every subscriber gets its
+// own bounded queue and items that do not fit are dropped according to that
+// queue's overflow policy; Dropped reports how many items a subscriber lost.
+type PubSub struct {
+	subs map[*ThreadSafeQueue]*subscription // Subscriptions by queue.
+	opts []Option                           // Default options for subscriber queues.
+	mu   sync.RWMutex                       // Mutex to protect concurrent access to subs.
+}
+
+// subscription is a single Subscribe call.
+type subscription struct {
+	pattern  []string      // Pattern split into segments.
+	rejected atomic.Uint64 // Items rejected by a full queue using the Block policy.
+}
+
+// NewPubSub initializes and returns a new PubSub. The given options are
+// applied to every subscriber queue, after a default of
+// WithCapacity(DefaultSubscriberCapacity) and WithOverflowPolicy(DropOldest).
+func NewPubSub(opts ...Option) *PubSub {
+	defaults := []Option{WithCapacity(DefaultSubscriberCapacity), WithOverflowPolicy(DropOldest)}
+	return &PubSub{
+		subs: make(map[*ThreadSafeQueue]*subscription),
+		opts: append(defaults, opts...),
+	}
+}
+
+// Subscribe returns a new queue receiving every item published to a topic
+// that matches pattern. Options override the PubSub defaults for this
+// subscriber only. The caller consumes the queue at its own pace and calls
+// Unsubscribe when done.
+// This method is safe for concurrent use.
+func (p *PubSub) Subscribe(pattern string, opts ...Option) *ThreadSafeQueue {
+	q := NewThreadSafeQueue(append(append([]Option(nil), p.opts...), opts...)...)
+	p.mu.Lock()
+	p.subs[q] = &subscription{pattern: strings.Split(pattern, ".")}
+	p.mu.Unlock()
+	return q
+}
+
+// Unsubscribe detaches the subscriber queue q and closes it, so its consumer
+// terminates once it has drained the items already delivered. It reports
+// whether q was subscribed.
+// This method is safe for concurrent use.
+func (p *PubSub) Unsubscribe(q *ThreadSafeQueue) bool {
+	p.mu.Lock()
+	_, ok := p.subs[q]
+	delete(p.subs, q)
+	p.mu.Unlock()
+	if ok {
+		q.Close()
+	}
+	return ok
+}
+
+// Publish delivers item to every subscriber whose pattern matches topic and
+// returns the number of subscribers that accepted it. It never blocks: a
+// subscriber whose queue is full loses an item according to its overflow
+// policy.
+// This method is safe for concurrent use.
+func (p *PubSub) Publish(topic string, item interface{}) int {
+	segments := strings.Split(topic, ".")
+	delivered := 0
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for q, sub := range p.subs {
+		if !matchTopic(sub.pattern, segments) {
+			continue
+		}
+		switch err := q.TryEnqueue(item); err {
+		case nil:
+			delivered++
+		case ErrFull:
+			if q.overflow == Block {
+				// The queue does not count rejections under the Block
+				// policy, so the subscription does.
+				sub.rejected.Add(1)
+			}
+		}
+	}
+	return delivered
+}
+
+// Dropped returns the number of published items the subscriber queue q has
+// lost because it was full.
+// This method is safe for concurrent use.
+func (p *PubSub) Dropped(q *ThreadSafeQueue) uint64 {
+	p.mu.RLock()
+	var rejected uint64
+	if sub, ok := p.subs[q]; ok {
+		rejected = sub.rejected.Load()
+	}
+	p.mu.RUnlock()
+	return rejected + q.Dropped()
+}
+
+// Subscribers returns the number of current subscriptions.
+// This method is safe for concurrent use.
+func (p *PubSub) Subscribers() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.subs)
+}
+
+// Close unsubscribes and closes every subscriber queue.
+// This method is safe for concurrent use.
+func (p *PubSub) Close() {
+	p.mu.Lock()
+	subs := p.subs
+	p.subs = make(map[*ThreadSafeQueue]*subscription)
+	p.mu.Unlock()
+	for q := range subs {
+		q.Close()
+	}
+}
+
+// matchTopic reports whether the pattern segments match the topic segments.
+func matchTopic(pattern, topic []string) bool {
+	if len(pattern) != len(topic) {
+		return false
+	}
+	for i, seg := range pattern {
+		if seg != "*" && seg != topic[i] {
+			return false
+		}
+	}
+	return true
+}
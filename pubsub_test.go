@@ -0,0 +1,153 @@
+package threadsafequeue
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test topic pattern matching
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		pattern, topic string
+		match          bool
+	}{
+		{"orders.created", "orders.created", true},
+		{"orders.created", "orders.deleted", false},
+		{"orders.*", "orders.created", true},
+		{"orders.*", "orders", false},
+		{"orders.*", "orders.created.eu", false},
+		{"*.created", "payments.created", true},
+		{"*", "orders", true},
+	}
+
+	for _, tt := range tests {
+		got := matchTopic(splitTopic(tt.pattern), splitTopic(tt.topic))
+		if got != tt.match {
+			t.Errorf("matchTopic(%q, %q) = %v, expected %v", tt.pattern, tt.topic, got, tt.match)
+		}
+	}
+}
+
+// Test that Publish delivers only to matching subscribers
+func TestPubSubPublish(t *testing.T) {
+	p := NewPubSub()
+	all := p.Subscribe("orders.*")
+	created := p.Subscribe("orders.created")
+	payments := p.Subscribe("payments.*")
+
+	if n := p.Publish("orders.created", "o1"); n != 2 {
+		t.Errorf("Expected 2 deliveries, got %d", n)
+	}
+	if n := p.Publish("orders.deleted", "o2"); n != 1 {
+		t.Errorf("Expected 1 delivery, got %d", n)
+	}
+
+	if all.Size() != 2 || created.Size() != 1 || payments.Size() != 0 {
+		t.Errorf("Unexpected queue sizes %d, %d, %d", all.Size(), created.Size(), payments.Size())
+	}
+
+	if item, _ := created.Dequeue(); item != "o1" {
+		t.Errorf("Expected to dequeue o1, got %v", item)
+	}
+}
+
+// Test that Unsubscribe detaches and closes the subscriber queue
+func TestPubSubUnsubscribe(t *testing.T) {
+	p := NewPubSub()
+	q := p.Subscribe("events")
+	p.Publish("events", 1)
+
+	if !p.Unsubscribe(q) {
+		t.Error("Expected Unsubscribe to report an existing subscription")
+	}
+	if p.Unsubscribe(q) {
+		t.Error("Expected a second Unsubscribe to report no subscription")
+	}
+	if n := p.Publish("events", 2); n != 0 {
+		t.Errorf("Expected no deliveries after Unsubscribe, got %d", n)
+	}
+
+	if item, ok := q.Dequeue(); !ok || item != 1 {
+		t.Errorf("Expected to drain 1, got %v", item)
+	}
+	if _, ok := q.Dequeue(); ok {
+		t.Error("Dequeue should fail on an unsubscribed queue")
+	}
+}
+
+// Test that a slow subscriber does not block publishers and counts its drops
+func TestPubSubSlowSubscriber(t *testing.T) {
+	p := NewPubSub(WithCapacity(10))
+	fast := p.Subscribe("ticks", WithCapacity(1000))
+	slow := p.Subscribe("ticks")
+	blocking := p.Subscribe("ticks", WithOverflowPolicy(Block))
+
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			p.Publish("ticks", i)
+		}
+		done <- true
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a slow subscriber")
+	}
+
+	if fast.Size() != 100 || p.Dropped(fast) != 0 {
+		t.Errorf("Fast subscriber should receive everything, got %d items and %d drops", fast.Size(), p.Dropped(fast))
+	}
+	if slow.Size() != 10 || p.Dropped(slow) != 90 {
+		t.Errorf("Slow subscriber should keep 10 and drop 90, got %d and %d", slow.Size(), p.Dropped(slow))
+	}
+	if item, _ := slow.Dequeue(); item != 90 {
+		t.Errorf("DropOldest subscriber should keep the latest items, got %v first", item)
+	}
+	if blocking.Size() != 10 || p.Dropped(blocking) != 90 {
+		t.Errorf("Blocking subscriber should keep 10 and drop 90, got %d and %d", blocking.Size(), p.Dropped(blocking))
+	}
+	if item, _ := blocking.Dequeue(); item != 0 {
+		t.Errorf("Blocking subscriber should keep the earliest items, got %v first", item)
+	}
+}
+
+// Test concurrent publishing, subscribing and unsubscribing
+func TestPubSubConcurrent(t *testing.T) {
+	p := NewPubSub()
+	var wg sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				p.Publish("load.test", j)
+			}
+		}()
+	}
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				q := p.Subscribe("load.*")
+				p.Unsubscribe(q)
+			}
+		}()
+	}
+
+	wg.Wait()
+	p.Close()
+	if p.Subscribers() != 0 {
+		t.Errorf("Expected no subscribers after Close, got %d", p.Subscribers())
+	}
+}
+
+func splitTopic(s string) []string {
+	return strings.Split(s, ".")
+}
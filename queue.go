@@ -2,64 +2,832 @@
 package threadsafequeue
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"runtime/trace"
 	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrClosed is returned by operations on a queue or stack that has been
+	// closed: by blocking reads once no items are left, and by writes.
+	ErrClosed = errors.New("threadsafequeue: closed")
+	// ErrFull is returned by TryEnqueue when a bounded queue has no room for
+	// the item.
+	ErrFull = errors.New("threadsafequeue: queue full")
+)
+
+// Queue is the FIFO behavior shared by the queues in this package. Code
+// that takes a queue as a dependency can accept a Queue, so that its tests
+// may pass a fake such as queuetest.Recorder instead.
+type Queue interface {
+	// Enqueue adds an item to the end of the queue.
+	Enqueue(item interface{})
+	// Dequeue removes and returns the item at the front of the queue,
+	// blocking while it is empty. The boolean is false once the queue is
+	// closed and drained.
+	Dequeue() (interface{}, bool)
+	// TryDequeue is like Dequeue but returns false at once if the queue is
+	// empty.
+	TryDequeue() (interface{}, bool)
+	// Size returns the number of items in the queue.
+	Size() int
+	// IsEmpty reports whether the queue has no items.
+	IsEmpty() bool
+	// Close stops the queue from accepting items and releases blocked
+	// Dequeue calls once the remaining items are gone.
+	Close()
+}
+
+var (
+	_ Queue = (*ThreadSafeQueue)(nil)
+	_ Queue = (*TwoLockQueue)(nil)
+	_ Queue = (*ShardedQueue)(nil)
+	_ Queue = (*MPSCQueue)(nil)
+	_ Queue = (*RingQueue)(nil)
+	_ Queue = (*FairQueue)(nil)
 )
 
 // ThreadSafeQueue represents a FIFO (first-in-first-out) data structure that
-// supports safe concurrent access. It uses a slice to store the items
-// and a condition variable to synchronize access.
+// supports safe concurrent access. It uses a ring buffer (or, with
+// WithChunkedStorage, a list of fixed-size chunks) to store the items, and
+// FIFO wait lists so that parked consumers are handed items, and producers
+// blocked on a full queue are given room, in the order they started waiting.
+//
+// A queue is unbounded unless it is created with WithCapacity, in which case
+// its OverflowPolicy decides whether a full queue blocks producers or drops
+// items.
+//
+// The zero value is an empty, unbounded queue ready to use, so a queue can be
+// embedded in another struct without a constructor call. A queue must not be
+// copied after first use.
 type ThreadSafeQueue struct {
-	queue []interface{} // Internal slice to hold the queue items.
-	mu    sync.Mutex    // Mutex to protect concurrent access to the queue slice.
-	cond  *sync.Cond    // Condition variable to coordinate enqueue and dequeue operations.
+	noCopy        noCopy                        // Makes go vet flag copies.
+	items         storage                       // Ring buffer, or chunk list with WithChunkedStorage, holding the queue items.
+	mu            sync.RWMutex                  // Protects the queue; read-only operations share it, mutations hold it exclusively.
+	closed        bool                          // Set by Close; no further items are accepted.
+	capacity      int                           // Maximum number of items; zero means unbounded.
+	overflow      OverflowPolicy                // What to do with items enqueued while the queue is full.
+	dropped       uint64                        // Number of items discarded by the overflow policy.
+	enqueued      uint64                        // Number of items stored, or discarded on arrival by DropNewest.
+	dequeued      uint64                        // Number of items removed by consumers and Drain.
+	rejected      uint64                        // Number of items refused because the queue was closed, full or the wait was abandoned.
+	highWater     int                           // Largest number of items ever held at once.
+	peak          int                           // Largest number of items held at once since the last StatsDelta.
+	deltaBase     Stats                         // Totals at the last StatsDelta.
+	tee           *tee                          // Mirror configured by Tee, if any.
+	teeDropped    uint64                        // Number of copies the mirror could not take.
+	notifiers     []chan struct{}               // Channels poked when an item is added or the queue is closed.
+	shrinkMin     int                           // Storage capacity WithShrink never goes below.
+	shrinkFactor  float64                       // Shrink once fewer than capacity/shrinkFactor items remain; zero disables.
+	initialCap    int                           // Items preallocated by WithInitialCapacity.
+	size          atomic.Int64                  // Mirror of items.len(), updated with every mutation so Size can skip the lock.
+	wait          WaitStrategy                  // How consumers wait on an empty queue.
+	tracing       bool                          // Set by WithTracing.
+	tasks         ring[*trace.Task]             // With tracing, the task of each item, in the same order as items.
+	latency       bool                          // Set by WithLatencyTracking.
+	stamps        ring[time.Time]               // With latency tracking, the enqueue time of each item, in the same order as items.
+	waits         latencyStats                  // With latency tracking, how long removed items waited.
+	deltaWaits    latencyStats                  // Like waits, since the last StatsDelta.
+	onWait        func(time.Duration)           // Set by OnWait.
+	propagator    Propagator                    // Set by WithPropagator.
+	extras        ring[extra]                   // With a propagator, tag statistics or metadata, what is kept beside each item, in the same order as items.
+	extrasBase    int                           // Position of the front extra, from which a Ticket finds its item.
+	tombs         int                           // Slots of cancelled items left in the storage, never at the front; see Ticket.Cancel.
+	name          string                        // Set by WithName.
+	logger        *slog.Logger                  // Set by WithLogger.
+	logFormat     func(interface{}) string      // Set by WithLogFormatter.
+	logs          []logEvent                    // Records to log once the lock is released.
+	hooks         []hook                        // Set by WithEnqueueHook and WithDequeueHook.
+	hookEvents    []hookEvent                   // Events to pass to the hooks once the lock is released.
+	marks         *watermarks                   // Set by WithWatermarks.
+	emptyChans    []chan struct{}               // Channels returned by NotifyEmpty, closed when the queue empties.
+	filledChans   []chan struct{}               // Channels returned by NotifyNonEmpty, closed when an item is stored.
+	sizeWaits     []*sizeWait                   // Calls to WaitForSize and WaitBelowThreshold, in the order they started waiting.
+	unfinished    int                           // Items stored and not yet marked done with TaskDone.
+	joinChans     []chan struct{}               // Channels of calls to Join, closed when no item is unfinished.
+	watchers      []*sizeWatcher                // Streams returned by WatchSize.
+	idle          *idleWatch                    // Set by WithIdleCallback.
+	tags          *tagStats                     // Set by WithTagStats.
+	metaOn        bool                          // Set by the first EnqueueWithMeta with attributes.
+	futuresOn     bool                          // Set by the first Submit.
+	ticketsOn     bool                          // Set by the first Submit or EnqueueCancelable, or cancel a follower mirrors.
+	canceled      uint64                        // Number of items removed by Ticket.Cancel, also counted in dropped.
+	claim         bool                          // Set while a worker pool removes an item, completing its future itself.
+	waitq         waitList                      // Consumers parked in Dequeue, longest-waiting first.
+	putq          waitList                      // Producers blocked on a full bounded queue, longest-waiting first.
+	polling       int                           // Consumers waiting without parking, under WaitSpinThenBlock or WaitSleep.
+	rejectNil     bool                          // Set by WithRejectNil.
+	elemType      reflect.Type                  // Set by WithElementType.
+	elemLast      atomic.Value                  // The last type found to implement an interface elemType.
+	copier        func(interface{}) interface{} // Set by WithCopier.
+	stuck         *stuckWatch                   // Set by WithStuckWaiterHandler.
+	clock         Clock                         // Source of time, set by WithClock.
+	history       *history                      // Set by WithHistory.
+	depth         *depthSampler                 // Set by WithDepthSampling.
+	debug         bool                          // Set by WithDebugChecks.
+	rates         *rateWindow                   // Set by WithRateTracking.
+	snapshotErr   func(error)                   // Set by WithSnapshotErrorHandler.
+	doneChan      chan struct{}                 // Made on first use, closed by Close.
+	wal           *wal                          // Set by WithWAL.
+	replicas      []*replica                    // Added by StartReplication.
+	follower      *follower                     // Set by NewFollower.
+	audit         *audit                        // Set by WithAuditWriter.
+	limit         atomic.Pointer[limiter]       // Set by WithEnqueueRateLimit and SetEnqueueRateLimit.
+	throttled     time.Duration                 // Time producers waited for the enqueue rate limit.
+	shedAt        int                           // Threshold set by WithLoadShedding; zero disables shedding.
+	shedMax       float64                       // Drop probability WithLoadShedding reaches at the capacity.
+	shedCount     uint64                        // Number of items shed, also counted in dropped.
+	rand          func() float64                // Set by WithRand.
+	adaptive      *adaptive                     // Set by WithAdaptiveCapacity.
+	quota         *tagQuota                     // Set by WithTagQuota.
+	quotaBlock    bool                          // Set by WithTagQuotaBlocking.
+	quotaRejected uint64                        // Number of items refused by WithTagQuota, also counted in rejected.
+	pressure      *backpressure                 // Set by WithBackpressure, or by the first call to Backpressure.
+	workerPanics  uint64                        // Number of handler panics recovered by RunWorkers.
+	abandoned     int                           // Number of RunWorkers handlers still running past WithHandlerTimeout.
+	workers       int                           // Number of RunWorkers workers running.
+	overBound     int                           // Items putBack stored beyond the capacity, which WithDebugChecks allows for.
 }
 
-// NewThreadSafeQueue initializes and returns a new instance of ThreadSafeQueue.
+// NewThreadSafeQueue initializes and returns a new instance of ThreadSafeQueue,
+// applying the given options in order.
 // It is safe to be used concurrently.
-func NewThreadSafeQueue() *ThreadSafeQueue {
-	q := &ThreadSafeQueue{}
-	q.cond = sync.NewCond(&q.mu) // Create a condition variable with the queue's mutex.
+func NewThreadSafeQueue(opts ...Option) *ThreadSafeQueue {
+	q := &ThreadSafeQueue{debug: debugChecksDefault.Load()}
+	for _, opt := range opts {
+		opt(q)
+	}
+	if q.quota != nil && q.tags == nil {
+		q.tags = &tagStats{max: quotaTags, byTag: make(map[string]*TagStats)}
+	}
+	if q.capacity > 0 && q.initialCap > q.capacity {
+		q.initialCap = q.capacity // Never preallocate beyond the bound.
+	}
+	q.init()
+	if q.rates != nil {
+		q.rates.start = q.clock.Now()
+	}
+	if q.initialCap > 0 {
+		q.items.preallocate(q.initialCap)
+	}
+	if q.wal != nil {
+		q.openWAL()
+	}
+	if q.audit != nil {
+		q.startAudit()
+	}
+	if q.adaptive != nil {
+		q.startAdaptive()
+	}
 	return q
 }
 
 // Enqueue adds an item to the end of the queue. The provided item can be of any type.
 // If there are any waiting Dequeue calls, it signals one of them that an item is available.
+// If the queue is bounded and full, the overflow policy decides whether Enqueue
+// blocks until there is room or an item is dropped.
+// Items enqueued after Close are discarded. Enqueue panics if the queue
+// refuses the item, as with WithRejectNil or WithElementType.
 // This method is safe for concurrent use.
 func (q *ThreadSafeQueue) Enqueue(item interface{}) {
-	q.mu.Lock() // Lock the mutex to protect concurrent access.
-	q.queue = append(q.queue, item)
-	q.cond.Signal() // Signal any waiting Dequeue operations that a new item is available.
-	q.mu.Unlock()
+	q.mustValidate(item)
+	item = q.copyItem(item)
+	q.throttle(nil, 1)
+	r := q.startRegion(traceEnqueueRegion)
+	q.lock() // Lock the mutex to protect concurrent access.
+	q.put(nil, item, extra{}, false)
+	q.unlock() // Hands the item to a parked Dequeue, if any.
+	endRegion(r)
+}
+
+// EnqueueContext is like Enqueue but reports what happened to the item. When
+// a full bounded queue or the enqueue rate limit blocks, it gives up and
+// returns ctx.Err() once ctx is done. It returns ErrFull if the item was
+// dropped by the DropNewest policy, ErrShed if it was shed by
+// WithLoadShedding, and ErrClosed if the queue has been closed. If the queue
+// refuses the item, as with WithRejectNil or WithElementType, it returns the
+// reason instead of panicking.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) EnqueueContext(ctx context.Context, item interface{}) error {
+	if err := q.validate(item); err != nil {
+		return err
+	}
+	item = q.copyItem(item)
+	if err := q.throttle(ctx, 1); err != nil {
+		return err
+	}
+	q.lock()
+	defer q.unlock()
+	return q.put(ctx, item, extra{}, false)
+}
+
+// TryEnqueue adds an item to the end of the queue without blocking. If the
+// queue is bounded and full, it returns ErrFull under the Block and
+// DropNewest policies (the latter counting the item as dropped) and evicts
+// the front item under DropOldest. It returns ErrClosed if the queue has
+// been closed, ErrRateLimited if WithEnqueueRateLimit has no token for the
+// item, ErrShed if WithLoadShedding dropped it, and the reason if the queue
+// refuses the item, as with WithRejectNil or WithElementType.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) TryEnqueue(item interface{}) error {
+	if err := q.validate(item); err != nil {
+		return err
+	}
+	item = q.copyItem(item)
+	q.lock()
+	defer q.unlock()
+	if q.closed {
+		q.rejected++
+		return ErrClosed
+	}
+	if q.rateLimited() {
+		q.rejected++
+		return ErrRateLimited
+	}
+	if q.shed(item, extra{}) {
+		return ErrShed
+	}
+	if q.full() {
+		switch q.overflow {
+		case DropOldest:
+			x := q.frontExtra()
+			q.tagDropped(x.tag, false)
+			x.future.complete(nil, ErrFull)
+			old, _ := q.pop()
+			q.drop(old, q.overflow.String())
+			q.taskDone() // No consumer will take it.
+		case DropNewest:
+			q.enqueued++
+			q.tagDropped("", true)
+			q.drop(item, q.overflow.String())
+			return ErrFull
+		default:
+			q.rejected++
+			return ErrFull
+		}
+	}
+	q.store(item, extra{}, false)
+	return nil
+}
+
+// EnqueueFront inserts an item at the front of the queue so that the next
+// Dequeue returns it, ahead of anything already waiting. It is intended for
+// urgent control messages that must preempt the backlog.
+// Repeated EnqueueFront calls are served in LIFO order among themselves: the
+// most recently inserted front item is dequeued first.
+// Like Enqueue, this is an amortized O(1) operation on the ring buffer.
+// If there are any waiting Dequeue calls, it signals one of them that an item is available.
+// A full bounded queue and a refused item are handled as for Enqueue.
+// Items enqueued after Close are discarded.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) EnqueueFront(item interface{}) {
+	q.mustValidate(item)
+	item = q.copyItem(item)
+	q.throttle(nil, 1)
+	q.lock()
+	q.put(nil, item, extra{}, true)
+	q.unlock()
+}
+
+// putBack stores at the front of the queue an item a consumer took but
+// could not pass on, as FanOut and ProcessOrdered do when interrupted. Unlike
+// EnqueueFront, it never blocks or drops anything: the item was already
+// admitted once, so it goes back beyond the capacity of a full bounded queue,
+// and into a closed queue, from which consumers can still take it.
+func (q *ThreadSafeQueue) putBack(item interface{}) {
+	q.lock()
+	if q.full() {
+		q.overBound = max(q.overBound, q.len()+1-q.capacity)
+	}
+	q.store(item, extra{}, true)
+	q.unlock()
+}
+
+// EnqueueBatch adds items to the end of the queue in order, taking the lock
+// once for all of them, and wakes as many waiting Dequeue calls as there are
+// new items. Each item is subject to the overflow policy as with Enqueue; if
+// the queue is closed, the remaining items are discarded. If the queue
+// refuses any of the items, as with WithRejectNil or WithElementType,
+// EnqueueBatch panics without adding any.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) EnqueueBatch(items ...interface{}) {
+	for _, item := range items {
+		q.mustValidate(item)
+	}
+	if q.copier != nil {
+		copies := make([]interface{}, len(items))
+		for i, item := range items {
+			copies[i] = q.copier(item)
+		}
+		items = copies
+	}
+	if len(items) > 0 {
+		q.throttle(nil, len(items))
+	}
+	q.lock()
+	defer q.unlock()
+	for i, item := range items {
+		// Waiting for room unlocks, handing the items added so far to
+		// parked consumers first.
+		if q.put(nil, item, extra{}, false) == ErrClosed {
+			q.rejected += uint64(len(items) - i - 1) // The rest are discarded too.
+			break
+		}
+	}
+}
+
+// store adds an item, with what to keep beside it, for which there is room at the front
+// or the back of the queue. The caller must hold q.mu.
+func (q *ThreadSafeQueue) store(item interface{}, x extra, front bool) {
+	if q.wal != nil {
+		q.walAdded(item, front)
+	}
+	if q.replicas != nil {
+		q.replAdded(item, front)
+	}
+	if front {
+		q.items.pushFront(item)
+	} else {
+		q.items.pushBack(item)
+	}
+	if q.tags != nil {
+		x.tag = q.tagAdded(x.tag)
+	}
+	q.traceAdded(front)
+	q.stampAdded(x.enqueuedAt, front)
+	q.extraAdded(item, x, front)
+	q.added(item)
+	q.enqueued++
+	q.rateAdded(1)
+	q.unfinished++
+	if n := q.len(); n > q.peak {
+		q.peak = n
+		if n > q.highWater {
+			q.highWater = n
+		}
+	}
+	if q.hooks != nil {
+		q.hookLater(item, q.len(), hookEnqueue)
+	}
+	if front {
+		q.record(OpEnqueueFront, item)
+	} else {
+		q.record(OpEnqueue, item)
+	}
+}
+
+// drop counts item as discarded by policy, the overflow policy,
+// LoadShedding or Cancel. The caller must hold q.mu.
+func (q *ThreadSafeQueue) drop(item interface{}, policy string) {
+	q.dropped++
+	q.record(OpDrop, item)
+	if q.logger != nil {
+		q.logLater(slog.LevelDebug, "item dropped", item, slog.String(LogKeyPolicy, policy))
+	}
+	if q.hooks != nil {
+		q.hookLater(item, q.len(), hookDrop)
+	}
+}
+
+// added tells everyone interested that item has just been stored, apart from
+// parked consumers, which unlock serves. The caller must hold q.mu.
+func (q *ThreadSafeQueue) added(item interface{}) {
+	q.size.Add(1)
+	q.sizeChanged()
+	q.poke()
+	if q.tee != nil {
+		q.tee.enqueued(item)
+	}
+}
+
+// full reports whether a bounded queue has no room left. The caller must hold q.mu.
+func (q *ThreadSafeQueue) full() bool {
+	return q.capacity > 0 && q.len() >= q.capacity
+}
+
+// put stores an item, with what to keep beside it, at the front or the back of the
+// queue according to the overflow policy, waiting under the Block policy
+// until a consumer makes room for it. A nil error means the item was stored;
+// otherwise it was not. A nil ctx waits without cancellation. The caller must
+// hold q.mu.
+func (q *ThreadSafeQueue) put(ctx context.Context, item interface{}, x extra, front bool) error {
+	if !front && q.shed(item, x) {
+		return ErrShed
+	}
+	for q.full() && !q.closed {
+		switch q.overflow {
+		case DropNewest:
+			q.enqueued++
+			q.tagDropped(x.tag, true)
+			q.drop(item, q.overflow.String())
+			return ErrFull
+		case DropOldest:
+			x := q.frontExtra()
+			q.tagDropped(x.tag, false)
+			x.future.complete(nil, ErrFull)
+			old, _ := q.pop()
+			q.drop(old, q.overflow.String())
+			q.taskDone() // No consumer will take it.
+		default:
+			if ctx != nil {
+				if err := ctx.Err(); err != nil {
+					q.rejected++
+					return err
+				}
+			}
+			err := q.parkProducer(ctx, item, x, front)
+			if err != nil {
+				q.rejected++
+			}
+			return err
+		}
+	}
+	if q.closed {
+		q.rejected++
+		return ErrClosed
+	}
+	q.store(item, x, front)
+	return nil
 }
 
 // Dequeue removes and returns the item from the front of the queue.
-// If the queue is empty, this call will block until an item is enqueued.
+// If the queue is empty, this call will block until an item is enqueued or
+// the queue is closed.
 // The return value is the dequeued item and a boolean indicating success.
-// If the queue is empty, the boolean value will be false.
+// The boolean value is false only when the queue has been closed and all
+// remaining items have been dequeued.
 // This method is safe for concurrent use.
 func (q *ThreadSafeQueue) Dequeue() (interface{}, bool) {
-	q.mu.Lock()
-	defer q.mu.Unlock()
-	for len(q.queue) == 0 {
-		q.cond.Wait() // Wait until an item is available.
+	r := q.startRegion(traceDequeueRegion)
+	q.lock()
+	item, _, handed := q.awaitItems() // Wait until an item is available.
+	if handed {
+		endRegion(r) // A producer removed the item for us.
+		return item, true
+	}
+	item, ok := q.remove()
+	q.unlock()
+	endRegion(r)
+	return item, ok
+}
+
+// DequeueContext is like Dequeue but gives up when ctx is done. It returns
+// ctx.Err() on cancellation and ErrClosed once the queue has been closed and
+// drained.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) DequeueContext(ctx context.Context) (interface{}, error) {
+	item, _, err := q.dequeueContext(ctx, false)
+	return item, err
+}
+
+// TryDequeue removes and returns the item from the front of the queue
+// without blocking. The boolean value is false if the queue is empty.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) TryDequeue() (interface{}, bool) {
+	q.lock()
+	item, ok := q.remove()
+	q.unlock()
+	return item, ok
+}
+
+// remove removes the front item on behalf of a consumer. The caller must
+// hold q.mu.
+func (q *ThreadSafeQueue) remove() (interface{}, bool) {
+	q.observeWait()
+	q.orphaned()
+	item, ok := q.pop()
+	if !ok {
+		return nil, false
+	}
+	if q.tee != nil {
+		q.tee.dequeued(item)
+	}
+	q.dequeued++
+	q.rateRemoved(1)
+	q.record(OpDequeue, item)
+	if q.hooks != nil {
+		q.hookLater(item, q.len(), hookDequeue)
+	}
+	return item, true
+}
+
+// pop removes the front item. The caller must hold q.mu.
+func (q *ThreadSafeQueue) pop() (interface{}, bool) {
+	item, ok := q.items.popFront()
+	if !ok {
+		return nil, false
+	}
+	q.traceRemoved()
+	q.stampRemoved()
+	q.extraRemoved()
+	q.skipCanceled()
+	q.size.Add(-1)
+	q.sizeChanged()
+	q.maybeShrink()
+	if q.wal != nil {
+		q.walRemoved(1)
+	}
+	if q.replicas != nil {
+		q.replRemoved(1)
 	}
-	item := q.queue[0]
-	q.queue = q.queue[1:]
 	return item, true
 }
 
+// Peek returns the item at the front of the queue without removing it.
+// The boolean value is false if the queue is empty.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) Peek() (interface{}, bool) {
+	q.rlock()
+	defer q.mu.RUnlock()
+	return q.items.front()
+}
+
+// ToSlice returns a copy of the items currently in the queue, in FIFO order.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) ToSlice() []interface{} {
+	q.rlock()
+	defer q.mu.RUnlock()
+	return q.liveItems()
+}
+
+// Drain removes and returns all items currently in the queue, in FIFO order.
+// It does not block and does not close the queue.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) Drain() []interface{} {
+	q.lock()
+	defer q.unlock()
+	return q.drain()
+}
+
+// drain removes and returns all items. The caller must hold q.mu
+// exclusively.
+func (q *ThreadSafeQueue) drain() []interface{} {
+	items := q.liveItems()
+	q.items.clear()
+	q.tombs = 0
+	q.traceCleared()
+	q.stampsCleared()
+	q.extrasCleared()
+	q.size.Add(-int64(len(items)))
+	if len(items) > 0 {
+		q.sizeChanged()
+		if q.wal != nil {
+			q.walRemoved(len(items))
+		}
+		if q.replicas != nil {
+			q.replRemoved(len(items))
+		}
+	}
+	q.dequeued += uint64(len(items))
+	q.rateRemoved(len(items))
+	q.maybeShrink()
+	q.record(OpDrain, nil)
+	if q.audit != nil {
+		for _, item := range items {
+			q.audited(OpDrain, item)
+		}
+		q.auditClosed()
+	}
+	if q.hooks != nil {
+		for i, item := range items {
+			q.hookLater(item, len(items)-i-1, hookDequeue)
+		}
+	}
+	return items
+}
+
+// Close marks the queue as closed. Items already in the queue can still be
+// dequeued; once they are gone, all blocked and future Dequeue calls return
+// immediately with a false boolean. Items enqueued after Close are discarded,
+// and producers blocked on a full queue give up.
+// Calling Close more than once has no effect.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) Close() {
+	q.lock()
+	if q.logger != nil && !q.closed {
+		q.logLater(slog.LevelInfo, "queue closed", nil)
+	}
+	if !q.closed && q.doneChan != nil {
+		close(q.doneChan)
+	}
+	wasClosed := q.closed
+	q.closed = true
+	q.poke()
+	q.closeSizeWaits()
+	if q.wal != nil {
+		q.walClosed()
+	}
+	if q.replicas != nil && !wasClosed {
+		q.replClosed()
+	}
+	if q.audit != nil {
+		q.auditClosed()
+	}
+	if q.pressure != nil {
+		q.pressure.close()
+	}
+	if q.len() == 0 && len(q.watchers) > 0 {
+		q.closeWatchers()
+	}
+	q.record(OpClose, nil)
+	q.unlock() // Releases every parked Dequeue and blocked producer.
+}
+
 // IsEmpty returns true if the queue has no items, and false otherwise.
+// Like Size, it never takes the lock.
 // This method is safe for concurrent use.
 func (q *ThreadSafeQueue) IsEmpty() bool {
-	q.mu.Lock()
-	defer q.mu.Unlock()
-	return len(q.queue) == 0
+	return q.size.Load() == 0
 }
 
-// Size returns the number of items currently in the queue.
+// Size returns the number of items currently in the queue. It reads a counter
+// maintained by every operation that adds or removes items, so it never
+// contends with producers and consumers for the lock; the result matches the
+// queue's contents as of the end of the most recent operation.
 // This method is safe for concurrent use.
 func (q *ThreadSafeQueue) Size() int {
+	return int(q.size.Load())
+}
+
+// Cap returns the maximum number of items the queue holds, or zero if it is
+// unbounded. With WithAdaptiveCapacity, it is the current bound.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) Cap() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.capacity
+}
+
+// Dropped returns the number of items discarded by the overflow policy of a
+// bounded queue.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) Dropped() uint64 {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.dropped
+}
+
+// init gives a queue without storage, such as the zero value, an empty ring
+// buffer, and one without a clock the system clock. The caller must hold
+// q.mu exclusively, or own q.
+func (q *ThreadSafeQueue) init() {
+	if q.items == nil {
+		q.items = &ring[interface{}]{}
+	}
+	if q.clock == nil {
+		q.clock = systemClock{}
+	}
+}
+
+// lock acquires q.mu exclusively. Every operation starts with it, rather than
+// with q.mu.Lock, so that the zero value is initialized on first use.
+func (q *ThreadSafeQueue) lock() {
 	q.mu.Lock()
-	defer q.mu.Unlock()
-	return len(q.queue)
+	q.init()
+}
+
+// rlock acquires q.mu for reading. If the queue has not been used yet, it
+// first initializes the storage under the exclusive lock, checking again
+// there in case another goroutine got to it first.
+func (q *ThreadSafeQueue) rlock() {
+	q.mu.RLock()
+	if q.items != nil {
+		return
+	}
+	q.mu.RUnlock()
+	q.lock()
+	q.mu.Unlock()
+	q.mu.RLock()
+}
+
+// noCopy may be embedded in structs that must not be copied after first use,
+// for go vet's copylocks check to flag. See https://golang.org/issues/8005.
+type noCopy struct{}
+
+// Lock is a no-op used by go vet's copylocks check.
+func (*noCopy) Lock() {}
+
+// Unlock is a no-op used by go vet's copylocks check.
+func (*noCopy) Unlock() {}
+
+// unlock releases q.mu. Every critical section ends here, so this is where
+// waiters are woken according to the state the section left behind (see
+// settle), where builds with the race detector check that the size counter
+// matches the items, whichever path changed them, where WithDebugChecks and
+// WithDepthSampling do their work, and after which queued log records are
+// written and hooks run.
+func (q *ThreadSafeQueue) unlock() {
+	var w *waiter
+	if q.waitq.head != nil || q.putq.head != nil {
+		w = q.settle() // Nobody is waiting in the common case under load.
+	}
+	if q.depth != nil {
+		q.sampleDepth()
+	}
+	if raceEnabled {
+		q.checkSize()
+	}
+	if q.debug {
+		q.checkInvariants()
+	}
+	var logs []logEvent
+	if q.logger != nil {
+		logs, q.logs = q.logs, nil
+	}
+	var events []hookEvent
+	if q.hookEvents != nil {
+		events, q.hookEvents = q.hookEvents, nil
+	}
+	q.mu.Unlock()
+	release(w)
+	if logs != nil {
+		q.flushLogs(logs)
+	}
+	if events != nil {
+		q.runHooks(events)
+	}
+}
+
+// checkSize panics if the size counter has drifted from the number of items.
+// The caller must hold q.mu.
+func (q *ThreadSafeQueue) checkSize() {
+	if n, want := q.size.Load(), int64(q.len()); n != want {
+		panic(fmt.Sprintf("threadsafequeue: size counter is %d but the queue holds %d items", n, want))
+	}
+	if q.tracing && q.tasks.len() != q.items.len() {
+		panic(fmt.Sprintf("threadsafequeue: %d trace tasks for %d items", q.tasks.len(), q.items.len()))
+	}
+}
+
+// addNotifier registers ch to receive a token whenever an item is added to
+// the queue or the queue is closed. Tokens are sent without blocking, so ch
+// should have a buffer of one: a pending token means "look again".
+func (q *ThreadSafeQueue) addNotifier(ch chan struct{}) {
+	q.lock()
+	q.notifiers = append(q.notifiers, ch)
+	q.unlock()
+}
+
+// removeNotifier unregisters a channel added by addNotifier.
+func (q *ThreadSafeQueue) removeNotifier(ch chan struct{}) {
+	q.lock()
+	defer q.unlock()
+	for i, c := range q.notifiers {
+		if c == ch {
+			q.notifiers = append(q.notifiers[:i], q.notifiers[i+1:]...)
+			return
+		}
+	}
+}
+
+// poke sends a token to every notifier that does not already hold one. The
+// caller must hold q.mu.
+func (q *ThreadSafeQueue) poke() {
+	for _, ch := range q.notifiers {
+		notify(ch)
+	}
+}
+
+// notify sends a token to ch unless it already holds one.
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// poll removes the front item on behalf of a consumer without blocking. In
+// addition to TryDequeue's result it reports, atomically with it, whether
+// the queue is closed.
+func (q *ThreadSafeQueue) poll() (item interface{}, ok, closed bool) {
+	q.lock()
+	defer q.unlock()
+	item, ok = q.remove()
+	return item, ok, q.closed
+}
+
+// watchContext arranges for cond to be broadcast when ctx is done, so that
+// goroutines blocked in cond.Wait can observe the cancellation. The returned
+// function releases the watcher and must be called once waiting is over.
+func watchContext(ctx context.Context, cond *sync.Cond) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			cond.L.Lock()
+			cond.Broadcast()
+			cond.L.Unlock()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
 }
@@ -1,6 +1,10 @@
 package threadsafequeue
 
 import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -160,8 +164,10 @@ func TestSizeWithConcurrentOperations(t *testing.T) {
 	q := NewThreadSafeQueue()
 	const count = 1000
 	var enqueued, dequeued int32
+	var wg sync.WaitGroup
 
 	enqueue := func() {
+		defer wg.Done()
 		for i := 0; i < count; i++ {
 			q.Enqueue(i)
 			atomic.AddInt32(&enqueued, 1)
@@ -169,20 +175,21 @@ func TestSizeWithConcurrentOperations(t *testing.T) {
 	}
 
 	dequeue := func() {
+		defer wg.Done()
 		for i := 0; i < count; i++ {
 			q.Dequeue()
 			atomic.AddInt32(&dequeued, 1)
 		}
 	}
 
+	wg.Add(4)
 	go enqueue()
 	go enqueue()
 	go dequeue()
 	go dequeue()
+	wg.Wait()
 
-	time.Sleep(1 * time.Second) // Allow time for the goroutines to complete
-
-	expectedSize := enqueued - dequeued
+	expectedSize := atomic.LoadInt32(&enqueued) - atomic.LoadInt32(&dequeued)
 	if int(expectedSize) != q.Size() {
 		t.Errorf("Expected size to be %d, got %d", expectedSize, q.Size())
 	}
@@ -223,20 +230,25 @@ func TestDequeueDoesNotProceedWhenEmpty(t *testing.T) {
 
 	go func() {
 		_, ok := q.Dequeue()
-		if ok {
-			t.Error("Dequeue succeeded when it should have failed due to an empty queue")
-		}
-		done <- true
+		done <- ok
 	}()
 
-	// Allow some time for the Dequeue goroutine to start
-	time.Sleep(100 * time.Millisecond)
-
 	// Since we have not enqueued anything, the Dequeue should continue to block
 	select {
 	case <-done:
 		t.Error("Dequeue should not have completed")
-	case <-time.After(500 * time.Millisecond): // Allow time to ensure that Dequeue is still blocking
+	case <-time.After(200 * time.Millisecond): // Allow time to ensure that Dequeue is still blocking
+	}
+
+	// Closing the empty queue releases the Dequeue with a false boolean
+	q.Close()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Error("Dequeue succeeded when it should have failed due to a closed, empty queue")
+		}
+	case <-time.After(time.Second):
+		t.Error("Dequeue did not return after Close")
 	}
 }
 
@@ -278,3 +290,554 @@ func TestEnqueueDequeueCount(t *testing.T) {
 		t.Errorf("Expected size to be 0, got %d", q.Size())
 	}
 }
+
+// Test that EnqueueFront places an item ahead of the existing backlog
+func TestEnqueueFront(t *testing.T) {
+	q := NewThreadSafeQueue()
+	for i := 0; i < 3; i++ {
+		q.Enqueue(i)
+	}
+
+	q.EnqueueFront("urgent")
+
+	if q.Size() != 4 {
+		t.Errorf("Expected size to be 4, got %d", q.Size())
+	}
+
+	expected := []interface{}{"urgent", 0, 1, 2}
+	for _, e := range expected {
+		item, ok := q.Dequeue()
+		if !ok || item != e {
+			t.Errorf("Expected to dequeue %v, got %v", e, item)
+		}
+	}
+}
+
+// Test that repeated EnqueueFront calls are served in LIFO order among themselves
+func TestEnqueueFrontLIFO(t *testing.T) {
+	q := NewThreadSafeQueue()
+	q.Enqueue("backlog")
+	q.EnqueueFront("first")
+	q.EnqueueFront("second")
+
+	expected := []interface{}{"second", "first", "backlog"}
+	for _, e := range expected {
+		item, ok := q.Dequeue()
+		if !ok || item != e {
+			t.Errorf("Expected to dequeue %v, got %v", e, item)
+		}
+	}
+}
+
+// Test that EnqueueFront wakes a blocked Dequeue
+func TestEnqueueFrontWakesDequeue(t *testing.T) {
+	q := NewThreadSafeQueue()
+	done := make(chan interface{})
+
+	go func() {
+		item, _ := q.Dequeue()
+		done <- item
+	}()
+
+	// Allow some time for the Dequeue goroutine to start and block
+	time.Sleep(100 * time.Millisecond)
+	q.EnqueueFront("pause")
+
+	select {
+	case item := <-done:
+		if item != "pause" {
+			t.Errorf("Expected to dequeue pause, got %v", item)
+		}
+	case <-time.After(time.Second):
+		t.Error("Dequeue was not woken by EnqueueFront")
+	}
+}
+
+// Test that TryDequeue does not block on an empty queue
+func TestTryDequeue(t *testing.T) {
+	q := NewThreadSafeQueue()
+	if _, ok := q.TryDequeue(); ok {
+		t.Error("TryDequeue on an empty queue should fail")
+	}
+
+	q.Enqueue(42)
+	item, ok := q.TryDequeue()
+	if !ok || item != 42 {
+		t.Errorf("Expected to dequeue 42, got %v", item)
+	}
+}
+
+// Test that a closed queue can still be drained and then reports failure
+func TestCloseDrains(t *testing.T) {
+	q := NewThreadSafeQueue()
+	q.Enqueue(1)
+	q.Close()
+	q.Enqueue(2)
+
+	if item, ok := q.Dequeue(); !ok || item != 1 {
+		t.Errorf("Expected to dequeue 1 after close, got %v", item)
+	}
+	if _, ok := q.Dequeue(); ok {
+		t.Error("Dequeue should fail once the closed queue is drained")
+	}
+}
+
+// Test that Close releases every blocked Dequeue with a false boolean and
+// leaves no goroutine behind
+func TestCloseReleasesBlockedConsumers(t *testing.T) {
+	q := NewThreadSafeQueue()
+	const consumers = 10
+	before := runtime.NumGoroutine()
+	results := make(chan bool, consumers)
+
+	for i := 0; i < consumers; i++ {
+		go func() {
+			_, ok := q.Dequeue()
+			results <- ok
+		}()
+	}
+
+	// Wait until every consumer is parked in Dequeue
+	deadline := time.Now().Add(time.Second)
+	for {
+		q.mu.RLock()
+		waiting := q.waitq.len
+		q.mu.RUnlock()
+		if waiting == consumers || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	q.Close()
+	timeout := time.After(time.Second)
+	for i := 0; i < consumers; i++ {
+		select {
+		case ok := <-results:
+			if ok {
+				t.Error("Expected blocked Dequeue to fail after Close")
+			}
+		case <-timeout:
+			t.Fatalf("Only %d of %d consumers returned after Close", i, consumers)
+		}
+	}
+
+	// Dequeue calls after Close return immediately
+	if _, ok := q.Dequeue(); ok {
+		t.Error("Expected Dequeue on a closed, empty queue to fail")
+	}
+
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > before && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("Expected at most %d goroutines after Close, got %d", before, n)
+	}
+}
+
+// Test that DequeueContext honors cancellation and close
+func TestDequeueContext(t *testing.T) {
+	q := NewThreadSafeQueue()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := q.DequeueContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	q.Enqueue(42)
+	item, err := q.DequeueContext(context.Background())
+	if err != nil || item != 42 {
+		t.Errorf("Expected to dequeue 42, got %v (%v)", item, err)
+	}
+
+	q.Close()
+	if _, err := q.DequeueContext(context.Background()); err != ErrClosed {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+}
+
+// Test that Peek and ToSlice observe the queue without modifying it
+func TestPeekAndToSlice(t *testing.T) {
+	q := NewThreadSafeQueue()
+	if _, ok := q.Peek(); ok {
+		t.Error("Peek on an empty queue should fail")
+	}
+
+	for i := 0; i < 3; i++ {
+		q.Enqueue(i)
+	}
+
+	if item, ok := q.Peek(); !ok || item != 0 {
+		t.Errorf("Expected to peek 0, got %v", item)
+	}
+
+	items := q.ToSlice()
+	for i, item := range items {
+		if item != i {
+			t.Errorf("Expected %d at position %d, got %v", i, i, item)
+		}
+	}
+
+	if q.Size() != 3 {
+		t.Errorf("Expected size to be 3, got %d", q.Size())
+	}
+}
+
+// Test that the backing storage stays bounded over a long-running steady state
+func TestStorageStaysBounded(t *testing.T) {
+	q := NewThreadSafeQueue()
+	count := 10000000
+	if testing.Short() {
+		count = 100000
+	}
+	const backlog = 100
+
+	for i := 0; i < backlog; i++ {
+		q.Enqueue(i)
+	}
+	for i := 0; i < count; i++ {
+		q.Enqueue(i)
+		q.Dequeue()
+	}
+
+	if q.Size() != backlog {
+		t.Errorf("Expected size to be %d, got %d", backlog, q.Size())
+	}
+	if c := q.Stats().StorageCapacity; c > 2*backlog {
+		t.Errorf("Expected the backing capacity to stay below %d, got %d", 2*backlog, c)
+	}
+}
+
+// Test that EnqueueFront and Enqueue interleave correctly across wrap-around
+func TestEnqueueFrontWrapAround(t *testing.T) {
+	q := NewThreadSafeQueue()
+	var expected []interface{}
+	for i := 0; i < 100; i++ {
+		if i%3 == 0 {
+			q.EnqueueFront(i)
+			expected = append([]interface{}{i}, expected...)
+		} else {
+			q.Enqueue(i)
+			expected = append(expected, i)
+		}
+		if i%5 == 0 {
+			q.Dequeue()
+			expected = expected[1:]
+		}
+	}
+
+	items := q.ToSlice()
+	if len(items) != len(expected) {
+		t.Fatalf("Expected %d items, got %d", len(expected), len(items))
+	}
+	for i := range expected {
+		if items[i] != expected[i] {
+			t.Fatalf("Expected %v at position %d, got %v", expected[i], i, items[i])
+		}
+	}
+}
+
+// Benchmark a steady state with a small backlog
+func BenchmarkEnqueueDequeue(b *testing.B) {
+	q := NewThreadSafeQueue()
+	var item interface{} = struct{}{}
+	for i := 0; i < 100; i++ {
+		q.Enqueue(item)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q.Enqueue(item)
+		q.Dequeue()
+	}
+}
+
+// Benchmark filling the queue with a burst and then draining it
+func BenchmarkEnqueueBurstThenDequeue(b *testing.B) {
+	q := NewThreadSafeQueue()
+	var item interface{} = struct{}{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 1000; j++ {
+			q.Enqueue(item)
+		}
+		for j := 0; j < 1000; j++ {
+			q.Dequeue()
+		}
+	}
+}
+
+// Test that Size and IsEmpty do not wait for the lock
+func TestSizeWithoutLock(t *testing.T) {
+	q := NewThreadSafeQueue()
+	q.Enqueue(1)
+	q.EnqueueFront(0)
+
+	q.mu.Lock() // Simulate a long critical section.
+	done := make(chan int)
+	go func() {
+		if q.IsEmpty() {
+			t.Error("Expected the queue not to be empty")
+		}
+		done <- q.Size()
+	}()
+	select {
+	case size := <-done:
+		if size != 2 {
+			t.Errorf("Expected size to be 2, got %d", size)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected Size not to block on the lock")
+	}
+	q.mu.Unlock()
+}
+
+// Test that the size counter follows every mutation path
+func TestSizeCounterConsistency(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(3), WithOverflowPolicy(DropOldest))
+	check := func(want int) {
+		t.Helper()
+		q.mu.Lock()
+		q.checkSize()
+		q.mu.Unlock()
+		if q.Size() != want {
+			t.Errorf("Expected size to be %d, got %d", want, q.Size())
+		}
+	}
+	for i := 0; i < 5; i++ {
+		q.Enqueue(i) // The last two drop the oldest item.
+	}
+	check(3)
+	q.EnqueueFront(-1)
+	check(3)
+	q.TryEnqueue(9)
+	check(3)
+	q.Dequeue()
+	check(2)
+	q.TryDequeue()
+	check(1)
+	q.Drain()
+	check(0)
+
+	q.size.Add(1) // Corrupt the counter.
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected checkSize to panic on a drifted counter")
+		}
+	}()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.checkSize()
+}
+
+// Test that read-only operations can run while another reader holds the lock
+func TestReadersShareLock(t *testing.T) {
+	q := NewThreadSafeQueue()
+	q.Enqueue(1)
+
+	q.mu.RLock() // Simulate a long read-only operation.
+	done := make(chan struct{})
+	go func() {
+		q.Peek()
+		q.ToSlice()
+		q.Stats()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Expected read-only operations not to wait for another reader")
+	}
+	q.mu.RUnlock()
+}
+
+// Benchmark a producer and a consumer with and without 16 goroutines
+// peeking at the queue
+func BenchmarkEnqueueDequeueWithReaders(b *testing.B) {
+	for _, readers := range []int{0, 16} {
+		b.Run(fmt.Sprintf("Readers%d", readers), func(b *testing.B) {
+			q := NewThreadSafeQueue()
+			stop := make(chan struct{})
+			var wg sync.WaitGroup
+			for r := 0; r < readers; r++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for {
+						select {
+						case <-stop:
+							return
+						default:
+							q.Peek()
+						}
+					}
+				}()
+			}
+			var item interface{} = struct{}{}
+			b.ReportAllocs()
+			b.ResetTimer()
+			go func() {
+				for i := 0; i < b.N; i++ {
+					q.Enqueue(item)
+				}
+			}()
+			for i := 0; i < b.N; i++ {
+				q.Dequeue()
+			}
+			b.StopTimer()
+			close(stop)
+			wg.Wait()
+		})
+	}
+}
+
+// Benchmark 16 producers and 16 consumers on an unbounded and a bounded queue
+func BenchmarkContended16(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"Unbounded", nil},
+		{"Bounded", []Option{WithCapacity(64)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			q := NewThreadSafeQueue(bc.opts...)
+			var item interface{} = struct{}{}
+			var wg sync.WaitGroup
+			b.ReportAllocs()
+			b.ResetTimer()
+			for g := 0; g < 16; g++ {
+				n := b.N / 16
+				if g < b.N%16 {
+					n++
+				}
+				wg.Add(2)
+				go func(n int) {
+					defer wg.Done()
+					for i := 0; i < n; i++ {
+						q.Enqueue(item)
+					}
+				}(n)
+				go func(n int) {
+					defer wg.Done()
+					for i := 0; i < n; i++ {
+						q.Dequeue()
+					}
+				}(n)
+			}
+			wg.Wait()
+		})
+	}
+}
+
+// Test that no item is lost or duplicated, and no goroutine is left blocked,
+// when many producers and consumers hammer a small bounded queue
+func TestContendedBoundedStress(t *testing.T) {
+	const goroutines, perGoroutine = 16, 2000
+	q := NewThreadSafeQueue(WithCapacity(4))
+	var seen [goroutines * perGoroutine]atomic.Bool
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(2)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < perGoroutine; i++ {
+				q.Enqueue(g*perGoroutine + i)
+			}
+		}(g)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < perGoroutine; i++ {
+				var item interface{}
+				if i%2 == 0 {
+					item, _ = q.Dequeue()
+				} else {
+					var ok bool
+					for !ok {
+						item, ok = q.TryDequeue()
+						// Yield between polls: an item arriving while
+						// Dequeue callers are parked goes to them, so a
+						// tight loop would only hold up the producers.
+						runtime.Gosched()
+					}
+				}
+				if seen[item.(int)].Swap(true) {
+					t.Errorf("Item %v dequeued twice", item)
+				}
+			}
+		}(g)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatalf("Goroutines still blocked with %d items queued", q.Size())
+	}
+	for i := range seen {
+		if !seen[i].Load() {
+			t.Fatalf("Item %d was never dequeued", i)
+		}
+	}
+}
+
+// Test that the zero value is usable, including by several goroutines racing
+// on first use, with readers and writers alike
+func TestZeroValue(t *testing.T) {
+	for it := 0; it < 100; it++ {
+		var q ThreadSafeQueue
+		const producers = 4
+		var wg sync.WaitGroup
+		for p := 0; p < producers; p++ {
+			wg.Add(3)
+			go func(p int) {
+				defer wg.Done()
+				q.Enqueue(p)
+			}(p)
+			go func() {
+				defer wg.Done()
+				q.Peek()
+				q.ToSlice()
+				q.Stats()
+			}()
+			go func() {
+				defer wg.Done()
+				if _, ok := q.Dequeue(); !ok {
+					t.Error("Expected Dequeue on the zero value to return an item")
+				}
+			}()
+		}
+		wg.Wait()
+		if q.Size() != 0 {
+			t.Fatalf("Expected an empty queue, got size %d", q.Size())
+		}
+	}
+}
+
+// Test that a queue embedded in another struct works without a constructor
+func TestZeroValueEmbedded(t *testing.T) {
+	var jobs struct {
+		name string
+		ThreadSafeQueue
+	}
+	jobs.Enqueue(1)
+	jobs.EnqueueFront(0)
+	if got := jobs.ToSlice(); len(got) != 2 || got[0] != 0 || got[1] != 1 {
+		t.Errorf("Expected [0 1], got %v", got)
+	}
+	if jobs.Cap() != 0 {
+		t.Errorf("Expected the zero value to be unbounded, got capacity %d", jobs.Cap())
+	}
+	jobs.Close()
+	jobs.Dequeue()
+	jobs.Dequeue()
+	if _, ok := jobs.Dequeue(); ok {
+		t.Error("Expected Dequeue on a closed, drained queue to return false")
+	}
+}
@@ -0,0 +1,21 @@
+module github.com/sandeepkv93/threadsafequeue/queueotel
+
+go 1.22
+
+require (
+	github.com/sandeepkv93/threadsafequeue v0.0.0
+	go.opentelemetry.io/otel v1.32.0
+	go.opentelemetry.io/otel/metric v1.32.0
+	go.opentelemetry.io/otel/sdk v1.32.0
+	go.opentelemetry.io/otel/sdk/metric v1.32.0
+	go.opentelemetry.io/otel/trace v1.32.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	golang.org/x/sys v0.27.0 // indirect
+)
+
+replace github.com/sandeepkv93/threadsafequeue => ../
@@ -0,0 +1,118 @@
+// Package queueotel connects a threadsafequeue to OpenTelemetry: it reports
+// the queue's state as metrics and carries trace context from producers to
+// consumers. It lives in a module of its own so that the queue itself does
+// not depend on OpenTelemetry.
+package queueotel
+
+import (
+	"context"
+	"time"
+
+	queue "github.com/sandeepkv93/threadsafequeue"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// System is the messaging.system attribute attached to every measurement.
+const System = "threadsafequeue"
+
+// Instrument registers instruments on meter that report q, each measurement
+// carrying messaging.system=threadsafequeue and attrs, such as the
+// messaging.destination.name of the queue:
+//
+//	messaging.client.sent.messages      counter    items enqueued
+//	messaging.client.consumed.messages  counter    items dequeued, including by Drain
+//	threadsafequeue.dropped             counter    items discarded by the overflow policy
+//	threadsafequeue.rejected            counter    items refused by the queue
+//	threadsafequeue.size                gauge      items in the queue
+//	threadsafequeue.capacity            gauge      bound of the queue, zero if unbounded
+//	threadsafequeue.waiting.consumers   gauge      consumers waiting for an item
+//	threadsafequeue.waiting.producers   gauge      producers waiting for room
+//	threadsafequeue.wait.duration       histogram  seconds items spent in the queue
+//
+// The counters and gauges are read from q.Stats when the meter collects, so
+// they cost the queue nothing in between. The histogram is fed through
+// q.OnWait and records only if q was created WithLatencyTracking(true);
+// Instrument replaces any function registered there before.
+func Instrument(q *queue.ThreadSafeQueue, meter metric.Meter, attrs ...attribute.KeyValue) error {
+	set := attribute.NewSet(append([]attribute.KeyValue{attribute.String("messaging.system", System)}, attrs...)...)
+	opt := metric.WithAttributeSet(set)
+
+	sent, err := meter.Int64ObservableCounter("messaging.client.sent.messages",
+		metric.WithUnit("{message}"), metric.WithDescription("Number of items enqueued."))
+	if err != nil {
+		return err
+	}
+	consumed, err := meter.Int64ObservableCounter("messaging.client.consumed.messages",
+		metric.WithUnit("{message}"), metric.WithDescription("Number of items dequeued."))
+	if err != nil {
+		return err
+	}
+	dropped, err := meter.Int64ObservableCounter("threadsafequeue.dropped",
+		metric.WithUnit("{message}"), metric.WithDescription("Number of items discarded by the overflow policy."))
+	if err != nil {
+		return err
+	}
+	rejected, err := meter.Int64ObservableCounter("threadsafequeue.rejected",
+		metric.WithUnit("{message}"), metric.WithDescription("Number of items refused by the queue."))
+	if err != nil {
+		return err
+	}
+	size, err := meter.Int64ObservableGauge("threadsafequeue.size",
+		metric.WithUnit("{message}"), metric.WithDescription("Number of items in the queue."))
+	if err != nil {
+		return err
+	}
+	capacity, err := meter.Int64ObservableGauge("threadsafequeue.capacity",
+		metric.WithUnit("{message}"), metric.WithDescription("Maximum number of items in the queue, or zero if it is unbounded."))
+	if err != nil {
+		return err
+	}
+	consumers, err := meter.Int64ObservableGauge("threadsafequeue.waiting.consumers",
+		metric.WithUnit("{consumer}"), metric.WithDescription("Number of consumers waiting for an item."))
+	if err != nil {
+		return err
+	}
+	producers, err := meter.Int64ObservableGauge("threadsafequeue.waiting.producers",
+		metric.WithUnit("{producer}"), metric.WithDescription("Number of producers waiting for room in the queue."))
+	if err != nil {
+		return err
+	}
+	wait, err := meter.Float64Histogram("threadsafequeue.wait.duration",
+		metric.WithUnit("s"), metric.WithDescription("Time items spent in the queue."),
+		metric.WithExplicitBucketBoundaries(bucketBounds()...))
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		s := q.Stats()
+		o.ObserveInt64(sent, int64(s.Enqueued), opt)
+		o.ObserveInt64(consumed, int64(s.Dequeued), opt)
+		o.ObserveInt64(dropped, int64(s.Dropped), opt)
+		o.ObserveInt64(rejected, int64(s.Rejected), opt)
+		o.ObserveInt64(size, int64(s.Size), opt)
+		o.ObserveInt64(capacity, int64(s.Capacity), opt)
+		o.ObserveInt64(consumers, int64(s.WaitingConsumers), opt)
+		o.ObserveInt64(producers, int64(s.WaitingProducers), opt)
+		return nil
+	}, sent, consumed, dropped, rejected, size, capacity, consumers, producers)
+	if err != nil {
+		return err
+	}
+
+	q.OnWait(func(d time.Duration) {
+		wait.Record(context.Background(), d.Seconds(), opt)
+	})
+	return nil
+}
+
+// bucketBounds returns the queue's latency buckets in seconds, so that the
+// histogram lines up with Stats().Latency.
+func bucketBounds() []float64 {
+	var bounds []float64
+	for _, b := range queue.LatencyBucketBounds() {
+		bounds = append(bounds, b.Seconds())
+	}
+	return bounds
+}
@@ -0,0 +1,102 @@
+package queueotel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	queue "github.com/sandeepkv93/threadsafequeue"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// Test that the instruments report the queue's statistics and waits, with
+// the given attributes
+func TestInstrument(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	defer provider.Shutdown(context.Background())
+
+	q := queue.NewThreadSafeQueue(queue.WithCapacity(2), queue.WithOverflowPolicy(queue.DropOldest), queue.WithLatencyTracking(true))
+	dest := attribute.String("messaging.destination.name", "jobs")
+	if err := Instrument(q, provider.Meter("test"), dest); err != nil {
+		t.Fatalf("Expected Instrument to succeed, got %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		q.Enqueue(i) // The third evicts the first.
+	}
+	q.Dequeue()
+	q.Close()
+	q.TryEnqueue(3)
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Expected Collect to succeed, got %v", err)
+	}
+	metrics := make(map[string]metricdata.Metrics)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m
+		}
+	}
+
+	want := map[string]int64{
+		"messaging.client.sent.messages":     3,
+		"messaging.client.consumed.messages": 1,
+		"threadsafequeue.dropped":            1,
+		"threadsafequeue.rejected":           1,
+		"threadsafequeue.size":               1,
+		"threadsafequeue.capacity":           2,
+		"threadsafequeue.waiting.consumers":  0,
+		"threadsafequeue.waiting.producers":  0,
+	}
+	for name, value := range want {
+		m, ok := metrics[name]
+		if !ok {
+			t.Errorf("Expected %s to be reported", name)
+			continue
+		}
+		var points []metricdata.DataPoint[int64]
+		switch data := m.Data.(type) {
+		case metricdata.Sum[int64]:
+			if !data.IsMonotonic {
+				t.Errorf("Expected %s to be a monotonic counter", name)
+			}
+			points = data.DataPoints
+		case metricdata.Gauge[int64]:
+			points = data.DataPoints
+		default:
+			t.Errorf("Expected %s to be an integer counter or gauge, got %T", name, m.Data)
+			continue
+		}
+		if len(points) != 1 || points[0].Value != value {
+			t.Errorf("Expected %s to be %d, got %v", name, value, points)
+			continue
+		}
+		checkAttributes(t, name, points[0].Attributes)
+	}
+
+	hist, ok := metrics["threadsafequeue.wait.duration"].Data.(metricdata.Histogram[float64])
+	if !ok || len(hist.DataPoints) != 1 {
+		t.Fatalf("Expected one wait histogram point, got %+v", metrics["threadsafequeue.wait.duration"])
+	}
+	p := hist.DataPoints[0]
+	if p.Count != 1 {
+		t.Errorf("Expected 1 recorded wait, got %d", p.Count)
+	}
+	if len(p.Bounds) != len(queue.LatencyBucketBounds()) || p.Bounds[0] != time.Millisecond.Seconds() {
+		t.Errorf("Expected the histogram to use the queue's buckets, got %v", p.Bounds)
+	}
+	checkAttributes(t, "threadsafequeue.wait.duration", p.Attributes)
+}
+
+func checkAttributes(t *testing.T, name string, attrs attribute.Set) {
+	t.Helper()
+	if v, _ := attrs.Value("messaging.system"); v.AsString() != System {
+		t.Errorf("Expected %s to carry messaging.system=%s, got %v", name, System, attrs)
+	}
+	if v, _ := attrs.Value("messaging.destination.name"); v.AsString() != "jobs" {
+		t.Errorf("Expected %s to carry the given attributes, got %v", name, attrs)
+	}
+}
@@ -0,0 +1,58 @@
+package queueotel
+
+import (
+	"context"
+
+	queue "github.com/sandeepkv93/threadsafequeue"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Propagator returns a threadsafequeue.Propagator that carries the trace
+// context of the producer, and anything else p propagates such as baggage,
+// to the consumer. If p is nil, it uses the global propagator set with
+// otel.SetTextMapPropagator at the time of each call. Pass it to a queue with
+// threadsafequeue.WithPropagator, and enqueue and dequeue with EnqueueSpan and
+// DequeueSpan.
+func Propagator(p propagation.TextMapPropagator) queue.Propagator {
+	return propagator{p}
+}
+
+type propagator struct {
+	p propagation.TextMapPropagator
+}
+
+func (p propagator) propagator() propagation.TextMapPropagator {
+	if p.p != nil {
+		return p.p
+	}
+	return otel.GetTextMapPropagator()
+}
+
+func (p propagator) Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	p.propagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+func (p propagator) Extract(ctx context.Context, carrier map[string]string) context.Context {
+	if carrier == nil {
+		return ctx
+	}
+	return p.propagator().Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+// Link returns a link to the producer's span carried by ctx, as returned by
+// DequeueSpan. The consumer of an item usually belongs to a trace of its
+// own, so rather than starting its span as a child of the producer's, it
+// starts it with the link:
+//
+//	item, producer, ok := q.DequeueSpan(ctx)
+//	ctx, span := tracer.Start(ctx, "process", trace.WithLinks(queueotel.Link(producer)))
+func Link(ctx context.Context) trace.Link {
+	return trace.LinkFromContext(ctx)
+}
@@ -0,0 +1,74 @@
+package queueotel
+
+import (
+	"context"
+	"testing"
+
+	queue "github.com/sandeepkv93/threadsafequeue"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Test that a consumer span started with Link is linked to the span that
+// enqueued the item, across a goroutine boundary
+func TestPropagatorLinksSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer provider.Shutdown(context.Background())
+	tracer := provider.Tracer("test")
+
+	q := queue.NewThreadSafeQueue(queue.WithPropagator(Propagator(propagation.TraceContext{})))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		item, producer, ok := q.DequeueSpan(context.Background())
+		if !ok || item != "job" {
+			t.Errorf("Expected to dequeue the job, got %v, %v", item, ok)
+			return
+		}
+		_, span := tracer.Start(context.Background(), "consume", trace.WithLinks(Link(producer)))
+		span.End()
+	}()
+
+	ctx, span := tracer.Start(context.Background(), "produce")
+	q.EnqueueSpan(ctx, "job")
+	span.End()
+	<-done
+
+	var produce, consume sdktrace.ReadOnlySpan
+	for _, s := range recorder.Ended() {
+		switch s.Name() {
+		case "produce":
+			produce = s
+		case "consume":
+			consume = s
+		}
+	}
+	if produce == nil || consume == nil {
+		t.Fatalf("Expected both spans to be recorded, got %v", recorder.Ended())
+	}
+	links := consume.Links()
+	if len(links) != 1 || !links[0].SpanContext.Equal(produce.SpanContext().WithRemote(true)) {
+		t.Errorf("Expected the consumer span to link to %v, got %v", produce.SpanContext(), links)
+	}
+	if consume.SpanContext().TraceID() == produce.SpanContext().TraceID() {
+		t.Error("Expected the consumer span to start a trace of its own")
+	}
+}
+
+// Test that items enqueued without a span carry nothing
+func TestPropagatorWithoutSpan(t *testing.T) {
+	p := Propagator(propagation.TraceContext{})
+	if c := p.Inject(context.Background()); c != nil {
+		t.Errorf("Expected no carrier without a span, got %v", c)
+	}
+	ctx := context.Background()
+	if got := p.Extract(ctx, nil); got != ctx {
+		t.Error("Expected Extract of no carrier to return the context unchanged")
+	}
+	if Link(ctx).SpanContext.IsValid() {
+		t.Error("Expected no link without a producer span")
+	}
+}
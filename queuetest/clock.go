@@ -0,0 +1,156 @@
+package queuetest
+
+import (
+	"sync"
+	"time"
+
+	queue "github.com/sandeepkv93/threadsafequeue"
+)
+
+// FakeClock is a threadsafequeue.Clock whose time only moves when Advance is
+// called, so tests of time-based behavior run instantly and always the same
+// way. Pass it to a queue with threadsafequeue.WithClock.
+//
+// Timers fire during Advance, in the order they are due: channel timers
+// receive the time without blocking, and AfterFunc functions run in the
+// goroutine calling Advance, before it returns. A timer set for zero or less
+// fires at the next Advance, even Advance(0).
+type FakeClock struct {
+	mu     sync.Mutex
+	cond   *sync.Cond // Signaled when a timer is created or reset.
+	now    time.Time
+	timers map[*fakeTimer]struct{} // Pending timers.
+	seq    uint64                  // Orders timers due at the same time by when they were set.
+}
+
+var _ queue.Clock = (*FakeClock)(nil)
+
+// NewFakeClock returns a FakeClock set to start.
+func NewFakeClock(start time.Time) *FakeClock {
+	c := &FakeClock{now: start, timers: make(map[*fakeTimer]struct{})}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now returns the clock's current time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer returns a timer that receives the clock's time once Advance has
+// moved it d past now.
+func (c *FakeClock) NewTimer(d time.Duration) queue.Timer {
+	return c.newTimer(d, make(chan time.Time, 1), nil)
+}
+
+// After is like NewTimer(d).C().
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+// AfterFunc returns a timer that calls f once Advance has moved the clock d
+// past now.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) queue.Timer {
+	return c.newTimer(d, nil, f)
+}
+
+func (c *FakeClock) newTimer(d time.Duration, ch chan time.Time, f func()) *fakeTimer {
+	t := &fakeTimer{clock: c, c: ch, f: f}
+	t.Reset(d)
+	return t
+}
+
+// Advance moves the clock forward by d, firing the timers due by then.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	var funcs []func()
+	for {
+		var next *fakeTimer
+		for t := range c.timers {
+			if !t.when.After(end) && (next == nil || t.before(next)) {
+				next = t
+			}
+		}
+		if next == nil {
+			break
+		}
+		delete(c.timers, next)
+		if next.when.After(c.now) {
+			c.now = next.when
+		}
+		if next.f != nil {
+			funcs = append(funcs, next.f)
+		} else {
+			select {
+			case next.c <- c.now:
+			default:
+			}
+		}
+	}
+	c.now = end
+	c.mu.Unlock()
+	for _, f := range funcs {
+		f()
+	}
+}
+
+// BlockUntilTimers blocks until at least n timers are pending, which tells a
+// test that the code under test has started waiting on the clock and that
+// Advance will wake it.
+func (c *FakeClock) BlockUntilTimers(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
+
+// Timers returns the number of pending timers.
+func (c *FakeClock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// fakeTimer is a timer of a FakeClock, guarded by the clock's mutex.
+type fakeTimer struct {
+	clock *FakeClock
+	when  time.Time
+	c     chan time.Time // Nil for AfterFunc timers.
+	f     func()         // Nil for channel timers.
+	seq   uint64         // When the timer was set, relative to the others.
+}
+
+// before reports whether t is due before u.
+func (t *fakeTimer) before(u *fakeTimer) bool {
+	return t.when.Before(u.when) || (t.when.Equal(u.when) && t.seq < u.seq)
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, pending := c.timers[t]
+	delete(c.timers, t)
+	return pending
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, pending := c.timers[t]
+	t.when = c.now.Add(d)
+	c.seq++
+	t.seq = c.seq
+	c.timers[t] = struct{}{}
+	c.cond.Broadcast()
+	return pending
+}
@@ -0,0 +1,114 @@
+package queuetest
+
+import (
+	"testing"
+	"time"
+
+	queue "github.com/sandeepkv93/threadsafequeue"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Test that timers fire only once the clock is advanced past them, in order
+func TestFakeClockTimers(t *testing.T) {
+	c := NewFakeClock(epoch)
+	var fired []string
+	c.AfterFunc(2*time.Second, func() { fired = append(fired, "two") })
+	c.AfterFunc(time.Second, func() { fired = append(fired, "one") })
+	timer := c.NewTimer(3 * time.Second)
+	stopped := c.AfterFunc(time.Second, func() { fired = append(fired, "stopped") })
+	if !stopped.Stop() || stopped.Stop() {
+		t.Error("Expected Stop to report the timer pending only the first time")
+	}
+
+	c.Advance(1500 * time.Millisecond)
+	if len(fired) != 1 || fired[0] != "one" {
+		t.Errorf("Expected only the one-second timer to fire, got %v", fired)
+	}
+	c.Advance(2 * time.Second)
+	if len(fired) != 2 || fired[1] != "two" {
+		t.Errorf("Expected the two-second timer to fire next, got %v", fired)
+	}
+	select {
+	case now := <-timer.C():
+		if want := epoch.Add(3 * time.Second); !now.Equal(want) {
+			t.Errorf("Expected the timer to receive %v, got %v", want, now)
+		}
+	default:
+		t.Error("Expected the three-second timer to have fired")
+	}
+	if got, want := c.Now(), epoch.Add(3500*time.Millisecond); !got.Equal(want) {
+		t.Errorf("Expected the clock at %v, got %v", want, got)
+	}
+	if timer.Reset(time.Second) {
+		t.Error("Expected Reset of a fired timer to report it was not pending")
+	}
+	if c.Timers() != 1 {
+		t.Errorf("Expected the reset timer to be pending, got %d timers", c.Timers())
+	}
+}
+
+// Test that a queue using the WaitSleep strategy sleeps on the fake clock
+func TestFakeClockWaitSleep(t *testing.T) {
+	c := NewFakeClock(epoch)
+	q := queue.NewThreadSafeQueue(queue.WithClock(c), queue.WithWaitStrategy(queue.WaitSleep))
+	result := make(chan interface{})
+	go func() {
+		item, _ := q.Dequeue()
+		result <- item
+	}()
+	c.BlockUntilTimers(1) // The consumer found the queue empty and sleeps.
+	q.Enqueue(1)
+	c.Advance(time.Second)
+	if item := <-result; item != 1 {
+		t.Errorf("Expected to dequeue 1, got %v", item)
+	}
+}
+
+// Test that the stuck-waiter handler fires exactly when the fake clock
+// reaches the threshold
+func TestFakeClockStuckWaiter(t *testing.T) {
+	c := NewFakeClock(epoch)
+	reports := make(chan queue.StuckReport, 1)
+	q := queue.NewThreadSafeQueue(queue.WithClock(c), queue.WithStuckWaiterHandler(time.Minute, func(r queue.StuckReport) {
+		reports <- r
+	}))
+	go q.Dequeue()
+	c.BlockUntilTimers(1)
+	c.Advance(59 * time.Second)
+	select {
+	case r := <-reports:
+		t.Fatalf("Expected no report before the threshold, got %v", r)
+	default:
+	}
+	c.Advance(time.Second)
+	select {
+	case r := <-reports:
+		if r.Consumers != 1 || r.Longest != time.Minute {
+			t.Errorf("Expected one consumer stuck for a minute, got %v", r)
+		}
+	default:
+		t.Error("Expected a report once the threshold passed")
+	}
+	q.Close()
+}
+
+// Test that TeeEvents and Recorder calls take their time from the clock
+func TestFakeClockTimestamps(t *testing.T) {
+	c := NewFakeClock(epoch)
+	q := queue.NewThreadSafeQueue(queue.WithClock(c))
+	mirror := queue.NewThreadSafeQueue()
+	q.Tee(mirror, queue.MirrorDequeues())
+	c.Advance(time.Hour)
+	q.Enqueue(1)
+	if e, _ := mirror.TryDequeue(); !e.(queue.TeeEvent).Time.Equal(epoch.Add(time.Hour)) {
+		t.Errorf("Expected the event at %v, got %v", epoch.Add(time.Hour), e)
+	}
+
+	r := NewRecorder()
+	r.SetClock(c)
+	r.Enqueue(1)
+	if got := r.Calls()[0].Time; !got.Equal(epoch.Add(time.Hour)) {
+		t.Errorf("Expected the call at %v, got %v", epoch.Add(time.Hour), got)
+	}
+}
@@ -0,0 +1,240 @@
+// Package queuetest provides fakes for testing code that uses
+// threadsafequeue without goroutines or sleeps: a Recorder that stands in for
+// a Queue, and a FakeClock that controls the time a queue sees.
+package queuetest
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	queue "github.com/sandeepkv93/threadsafequeue"
+)
+
+// Method names a method of threadsafequeue.Queue.
+type Method string
+
+// The methods a Recorder records.
+const (
+	Enqueue    Method = "Enqueue"
+	Dequeue    Method = "Dequeue"
+	TryDequeue Method = "TryDequeue"
+	Size       Method = "Size"
+	IsEmpty    Method = "IsEmpty"
+	Close      Method = "Close"
+)
+
+// Call is one recorded call to a Recorder.
+type Call struct {
+	Method Method
+	Item   interface{} // Argument of Enqueue, or item returned by Dequeue and TryDequeue.
+	OK     bool        // Boolean returned by Dequeue, TryDequeue and IsEmpty.
+	Size   int         // Result of Size.
+	Time   time.Time   // When the call was made.
+}
+
+// String describes the call and its result.
+func (c Call) String() string {
+	switch c.Method {
+	case Enqueue:
+		return fmt.Sprintf("Enqueue(%v)", c.Item)
+	case Dequeue, TryDequeue:
+		return fmt.Sprintf("%s() = %v, %v", c.Method, c.Item, c.OK)
+	case Size:
+		return fmt.Sprintf("Size() = %d", c.Size)
+	case IsEmpty:
+		return fmt.Sprintf("IsEmpty() = %v", c.OK)
+	default:
+		return string(c.Method) + "()"
+	}
+}
+
+// response is a scripted result for Dequeue or TryDequeue.
+type response struct {
+	item interface{}
+	ok   bool
+}
+
+// Recorder is a fake threadsafequeue.Queue that records every call. It keeps
+// its items in a plain FIFO and never blocks: Dequeue on an empty Recorder
+// returns false as if the queue had been closed, so a consumer loop under
+// test ends once it has taken the items it was given. Individual Dequeue and
+// TryDequeue calls can be scripted with Respond.
+//
+// A Recorder is safe for concurrent use, but the order of concurrent calls
+// is up to the scheduler; tests are deterministic when the code under test
+// calls it from one goroutine.
+type Recorder struct {
+	mu      sync.Mutex
+	items   []interface{}
+	closed  bool
+	calls   []Call
+	counts  map[Method]int
+	scripts map[Method]map[int]response
+	clock   queue.Clock // Times calls; nil means the system clock.
+}
+
+var _ queue.Queue = (*Recorder)(nil)
+
+// NewRecorder returns a Recorder holding items, in order. Putting them there
+// is not recorded.
+func NewRecorder(items ...interface{}) *Recorder {
+	return &Recorder{
+		items:   append([]interface{}(nil), items...),
+		counts:  make(map[Method]int),
+		scripts: make(map[Method]map[int]response),
+	}
+}
+
+// Respond scripts the n-th call to m, counting from 1, to return item and ok
+// without touching the Recorder's items. For instance, Respond(Dequeue, 3,
+// nil, false) makes the third Dequeue report a closed queue. It panics
+// unless m is Dequeue or TryDequeue and n is positive.
+func (r *Recorder) Respond(m Method, n int, item interface{}, ok bool) {
+	if m != Dequeue && m != TryDequeue {
+		panic(fmt.Sprintf("queuetest: cannot script %s", m))
+	}
+	if n <= 0 {
+		panic("queuetest: calls are counted from 1")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.scripts[m] == nil {
+		r.scripts[m] = make(map[int]response)
+	}
+	r.scripts[m][n] = response{item, ok}
+}
+
+// SetClock makes the Recorder time calls with c, such as a FakeClock,
+// instead of the system clock.
+func (r *Recorder) SetClock(c queue.Clock) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clock = c
+}
+
+// record appends a call. The caller must hold r.mu.
+func (r *Recorder) record(c Call) {
+	if r.clock != nil {
+		c.Time = r.clock.Now()
+	} else {
+		c.Time = time.Now()
+	}
+	r.counts[c.Method]++
+	r.calls = append(r.calls, c)
+}
+
+// Enqueue records the call and adds item to the end of the queue, unless
+// the Recorder has been closed.
+func (r *Recorder) Enqueue(item interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record(Call{Method: Enqueue, Item: item})
+	if !r.closed {
+		r.items = append(r.items, item)
+	}
+}
+
+// Dequeue returns the scripted response for this call, if any, and
+// otherwise removes and returns the front item. It returns false if there is
+// none, instead of blocking.
+func (r *Recorder) Dequeue() (interface{}, bool) {
+	return r.dequeue(Dequeue)
+}
+
+// TryDequeue is like Dequeue, with its own count of calls for Respond.
+func (r *Recorder) TryDequeue() (interface{}, bool) {
+	return r.dequeue(TryDequeue)
+}
+
+func (r *Recorder) dequeue(m Method) (interface{}, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	resp, scripted := r.scripts[m][r.counts[m]+1]
+	if !scripted && len(r.items) > 0 {
+		resp = response{r.items[0], true}
+		r.items[0] = nil
+		r.items = r.items[1:]
+	}
+	r.record(Call{Method: m, Item: resp.item, OK: resp.ok})
+	return resp.item, resp.ok
+}
+
+// Size records the call and returns the number of items.
+func (r *Recorder) Size() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record(Call{Method: Size, Size: len(r.items)})
+	return len(r.items)
+}
+
+// IsEmpty records the call and reports whether there are no items.
+func (r *Recorder) IsEmpty() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record(Call{Method: IsEmpty, OK: len(r.items) == 0})
+	return len(r.items) == 0
+}
+
+// Close records the call and discards items enqueued from then on.
+func (r *Recorder) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record(Call{Method: Close})
+	r.closed = true
+}
+
+// Calls returns the calls recorded so far, in order.
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// Enqueued returns the items passed to Enqueue so far, in order, including
+// those discarded after Close.
+func (r *Recorder) Enqueued() []interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var items []interface{}
+	for _, c := range r.calls {
+		if c.Method == Enqueue {
+			items = append(items, c.Item)
+		}
+	}
+	return items
+}
+
+// AssertEnqueuedInOrder fails t unless the items passed to Enqueue are
+// exactly items, in order, as compared by reflect.DeepEqual.
+func (r *Recorder) AssertEnqueuedInOrder(t testing.TB, items ...interface{}) {
+	t.Helper()
+	got := r.Enqueued()
+	if len(got) != len(items) || (len(items) > 0 && !reflect.DeepEqual(got, items)) {
+		t.Errorf("queuetest: expected Enqueue calls with %v, got %v", items, got)
+	}
+}
+
+// AssertCalls fails t unless m was called n times.
+func (r *Recorder) AssertCalls(t testing.TB, m Method, n int) {
+	t.Helper()
+	r.mu.Lock()
+	got := r.counts[m]
+	r.mu.Unlock()
+	if got != n {
+		t.Errorf("queuetest: expected %d calls to %s, got %d", n, m, got)
+	}
+}
+
+// AssertClosed fails t unless Close was called.
+func (r *Recorder) AssertClosed(t testing.TB) {
+	t.Helper()
+	r.mu.Lock()
+	closed := r.closed
+	r.mu.Unlock()
+	if !closed {
+		t.Error("queuetest: expected the queue to be closed")
+	}
+}
@@ -0,0 +1,140 @@
+package queuetest
+
+import (
+	"fmt"
+	"testing"
+
+	queue "github.com/sandeepkv93/threadsafequeue"
+)
+
+// produce and consume stand in for code under test that depends on a queue.
+func produce(q queue.Queue, n int) {
+	for i := 0; i < n; i++ {
+		q.Enqueue(i)
+	}
+	q.Close()
+}
+
+func consume(q queue.Queue) (sum int) {
+	for {
+		item, ok := q.Dequeue()
+		if !ok {
+			return sum
+		}
+		sum += item.(int)
+	}
+}
+
+// Test that calls are recorded in order with their arguments and results
+func TestRecorderRecordsCalls(t *testing.T) {
+	r := NewRecorder()
+	produce(r, 3)
+	r.AssertEnqueuedInOrder(t, 0, 1, 2)
+	r.AssertCalls(t, Enqueue, 3)
+	r.AssertClosed(t)
+
+	if sum := consume(r); sum != 3 {
+		t.Errorf("Expected the consumer to sum to 3, got %d", sum)
+	}
+	r.AssertCalls(t, Dequeue, 4)
+	calls := r.Calls()
+	if len(calls) != 8 {
+		t.Fatalf("Expected 8 calls, got %v", calls)
+	}
+	if got := calls[4].String(); got != "Dequeue() = 0, true" {
+		t.Errorf("Expected the first Dequeue to return 0, got %s", got)
+	}
+	if got := calls[7].String(); got != "Dequeue() = <nil>, false" {
+		t.Errorf("Expected the last Dequeue to report closed, got %s", got)
+	}
+	for i := 1; i < len(calls); i++ {
+		if calls[i].Time.Before(calls[i-1].Time) {
+			t.Errorf("Expected call times to be ordered, got %v before %v", calls[i-1].Time, calls[i].Time)
+		}
+	}
+}
+
+// Test that scripted responses replace the queue's own for the chosen calls
+func TestRecorderRespond(t *testing.T) {
+	r := NewRecorder(10, 20, 30)
+	r.Respond(Dequeue, 3, nil, false)
+	r.Respond(TryDequeue, 1, "scripted", true)
+	if sum := consume(r); sum != 30 {
+		t.Errorf("Expected the consumer to stop at the third Dequeue with 30, got %d", sum)
+	}
+	if item, ok := r.TryDequeue(); item != "scripted" || !ok {
+		t.Errorf("Expected the scripted TryDequeue result, got %v, %v", item, ok)
+	}
+	if r.Size() != 1 || r.IsEmpty() {
+		t.Errorf("Expected the scripted calls to leave one item, got %d", r.Size())
+	}
+	if item, ok := r.TryDequeue(); item != 30 || !ok {
+		t.Errorf("Expected 30, got %v, %v", item, ok)
+	}
+}
+
+// Test that Respond panics for methods it cannot script
+func TestRecorderRespondInvalid(t *testing.T) {
+	for _, m := range []Method{Enqueue, Size} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected Respond(%s) to panic", m)
+				}
+			}()
+			NewRecorder().Respond(m, 1, nil, false)
+		}()
+	}
+}
+
+// fakeT records failures instead of failing the test.
+type fakeT struct {
+	testing.TB
+	failures []string
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.failures = append(f.failures, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeT) Error(args ...interface{}) {
+	f.failures = append(f.failures, fmt.Sprint(args...))
+}
+
+// Test that the assertions fail when expectations are not met
+func TestRecorderAssertionsFail(t *testing.T) {
+	r := NewRecorder()
+	r.Enqueue(1)
+	r.Enqueue(2)
+	f := &fakeT{}
+	r.AssertEnqueuedInOrder(f, 2, 1)
+	r.AssertEnqueuedInOrder(f, 1)
+	r.AssertCalls(f, Enqueue, 1)
+	r.AssertClosed(f)
+	if len(f.failures) != 4 {
+		t.Errorf("Expected 4 failures, got %q", f.failures)
+	}
+	f.failures = nil
+	r.AssertEnqueuedInOrder(f, 1, 2)
+	if len(f.failures) != 0 {
+		t.Errorf("Expected no failures, got %q", f.failures)
+	}
+}
+
+func ExampleRecorder() {
+	r := NewRecorder("a", "b")
+	r.Respond(Dequeue, 2, nil, false) // The queue closes under the consumer.
+	for {
+		item, ok := r.Dequeue()
+		if !ok {
+			break
+		}
+		fmt.Println(item)
+	}
+	fmt.Println(r.Size())
+	// Output:
+	// a
+	// 1
+}
@@ -0,0 +1,141 @@
+package threadsafequeue
+
+import (
+	"errors"
+	"log/slog"
+)
+
+// ErrQuotaExceeded is returned by EnqueueTagged when the item's tag already
+// has as many items pending as WithTagQuota allows.
+var ErrQuotaExceeded = errors.New("threadsafequeue: tag quota exceeded")
+
+const (
+	// quotaTags is the number of tags counted for WithTagQuota when
+	// WithTagStats does not set another limit.
+	quotaTags = 1024
+	// quotaPolicy names tag quotas in log records.
+	quotaPolicy = "TagQuota"
+)
+
+// WithTagQuota caps the items each tag given to EnqueueTagged may have
+// pending in the queue, so that one producer flooding it cannot starve the
+// others, whatever the total depth: perTag sets the cap of the tags it
+// names, and defaultMax that of the others, zero meaning no cap. An
+// EnqueueTagged call whose tag is at its cap returns ErrQuotaExceeded, or
+// with WithTagQuotaBlocking waits until an item of the tag leaves the queue.
+// Refused items are counted as rejected, in Stats.QuotaRejected and in the
+// tag's TagStats too, and logged at Debug level with TagQuota as the policy.
+// Items enqueued any other way are not capped.
+//
+// Quotas count pending items with the tag statistics of WithTagStats, which
+// they turn on for up to 1024 tags unless WithTagStats sets another limit;
+// tags beyond it share the count, and the cap, of TagOverflow. It panics if
+// a cap is negative.
+func WithTagQuota(defaultMax int, perTag map[string]int) Option {
+	if defaultMax < 0 {
+		panic("threadsafequeue: WithTagQuota needs a non-negative quota")
+	}
+	quotas := make(map[string]int, len(perTag))
+	for tag, max := range perTag {
+		if max < 0 {
+			panic("threadsafequeue: WithTagQuota needs a non-negative quota")
+		}
+		quotas[tag] = max
+	}
+	return func(q *ThreadSafeQueue) {
+		q.quota = &tagQuota{def: defaultMax, byTag: quotas, reserved: make(map[string]int)}
+	}
+}
+
+// WithTagQuotaBlocking makes EnqueueTagged wait for room under the quota of
+// its tag, set by WithTagQuota, instead of returning ErrQuotaExceeded. The
+// wait ends when an item of the tag leaves the queue or the queue is closed.
+func WithTagQuotaBlocking(enabled bool) Option {
+	return func(q *ThreadSafeQueue) {
+		q.quotaBlock = enabled
+	}
+}
+
+// tagQuota is the state behind WithTagQuota, protected by the queue's lock.
+type tagQuota struct {
+	def      int
+	byTag    map[string]int
+	reserved map[string]int // Room taken by items admitted and not yet stored, by counting tag.
+	freed    chan struct{}  // Closed when an item leaves while producers wait.
+}
+
+// max returns the cap of tag, or zero if it has none.
+func (t *tagQuota) max(tag string) int {
+	if max, ok := t.byTag[tag]; ok {
+		return max
+	}
+	return t.def
+}
+
+// awaitQuota returns nil once the quota of tag has room for an item, or the
+// queue is closed, for put to refuse the item. Without WithTagQuotaBlocking
+// it returns ErrQuotaExceeded at once if the quota is full, counting the
+// item as refused. The room is reserved until the caller, done with put,
+// calls releaseQuota: put may wait for room in a full bounded queue, and
+// the items of the tag admitted meanwhile must count against the quota
+// before they are pending. The caller must hold q.mu exclusively, which may
+// be released and reacquired.
+func (q *ThreadSafeQueue) awaitQuota(tag string, item interface{}) error {
+	t := q.quota
+	max := t.max(tag)
+	if max == 0 {
+		return nil
+	}
+	for !q.closed {
+		key, s := q.tags.lookup(tag)
+		if s.Pending+t.reserved[key] < max {
+			break
+		}
+		if !q.quotaBlock {
+			s.QuotaRejected++
+			q.quotaRejected++
+			q.rejected++
+			if q.logger != nil {
+				q.logLater(slog.LevelDebug, "item rejected", item, slog.String(LogKeyPolicy, quotaPolicy), slog.String(LogKeyTag, tag))
+			}
+			return ErrQuotaExceeded
+		}
+		if t.freed == nil {
+			t.freed = make(chan struct{})
+		}
+		freed, done := t.freed, q.done()
+		q.unlock()
+		select {
+		case <-freed:
+		case <-done:
+		}
+		q.mu.Lock()
+	}
+	key, _ := q.tags.lookup(tag)
+	t.reserved[key]++
+	return nil
+}
+
+// releaseQuota gives back the room awaitQuota reserved for an item of tag,
+// once put has stored it, so that it counts as pending instead, or refused
+// it. The caller must hold q.mu exclusively.
+func (q *ThreadSafeQueue) releaseQuota(tag string) {
+	t := q.quota
+	if t.max(tag) == 0 {
+		return
+	}
+	key, _ := q.tags.lookup(tag)
+	if t.reserved[key]--; t.reserved[key] == 0 {
+		delete(t.reserved, key)
+	}
+	q.quotaFreed() // For producers that found the room taken.
+}
+
+// quotaFreed wakes the producers waiting for room under a quota after an
+// item left the queue. The caller must hold q.mu exclusively.
+func (q *ThreadSafeQueue) quotaFreed() {
+	if t := q.quota; t.freed != nil {
+		close(t.freed)
+		t.freed = nil
+	}
+}
@@ -0,0 +1,144 @@
+package threadsafequeue
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test that a flooding tag is held to its quota while a trickling one
+// always fits
+func TestTagQuota(t *testing.T) {
+	q := NewThreadSafeQueue(WithTagQuota(10, nil))
+	stop := make(chan struct{})
+	var flood, consumer sync.WaitGroup
+	flood.Add(1)
+	go func() {
+		defer flood.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			runtime.Gosched() // Let the others run on a single CPU.
+			if err := q.EnqueueTagged("flood", i); err != nil && !errors.Is(err, ErrQuotaExceeded) {
+				t.Errorf("Expected the flood to be refused by its quota, but got %v", err)
+				return
+			}
+		}
+	}()
+	consumer.Add(1)
+	go func() {
+		defer consumer.Done()
+		for _, ok := q.Dequeue(); ok; _, ok = q.Dequeue() {
+			time.Sleep(200 * time.Microsecond) // Slower than the flood.
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		if err := q.EnqueueTagged("trickle", i); err != nil {
+			t.Fatalf("Expected the trickle to always fit, but item %d got %v", i, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(stop)
+	flood.Wait()
+	q.Close()
+	consumer.Wait()
+
+	s, byTag := q.Stats(), q.StatsByTag()
+	if byTag["flood"].QuotaRejected == 0 || byTag["flood"].QuotaRejected != s.QuotaRejected {
+		t.Errorf("Expected the flood's refusals in both stats, but got %d and %d", byTag["flood"].QuotaRejected, s.QuotaRejected)
+	}
+	if byTag["trickle"].Enqueued != 50 || byTag["trickle"].QuotaRejected != 0 {
+		t.Errorf("Expected all 50 trickle items enqueued, but got %+v", byTag["trickle"])
+	}
+	if s.HighWater > 20 {
+		t.Errorf("Expected at most 10 items of each tag, but the queue held %d", s.HighWater)
+	}
+}
+
+// Test that WithTagQuotaBlocking waits for an item of the tag to leave, and
+// that per-tag caps override the default
+func TestTagQuotaBlocking(t *testing.T) {
+	q := NewThreadSafeQueue(WithTagQuota(0, map[string]int{"a": 2}), WithTagQuotaBlocking(true))
+	q.EnqueueTagged("a", 1)
+	q.EnqueueTagged("a", 2)
+	for i := 0; i < 10; i++ {
+		q.EnqueueTagged("b", i) // No cap.
+	}
+	result := make(chan error, 2)
+	for i := 3; i <= 4; i++ {
+		go func(i int) {
+			result <- q.EnqueueTagged("a", i)
+		}(i)
+	}
+	select {
+	case err := <-result:
+		t.Fatalf("Expected the third item of a to wait, but it returned %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	if item, _ := q.Dequeue(); item != 1 {
+		t.Fatalf("Expected to dequeue 1, but got %v", item)
+	}
+	if err := <-result; err != nil {
+		t.Errorf("Expected a waiting item of a to be admitted, but got %v", err)
+	}
+	q.Close()
+	if err := <-result; !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected Close to refuse the other waiting item, but got %v", err)
+	}
+	if n := q.StatsByTag()["a"].Pending; n != 2 {
+		t.Errorf("Expected 2 items of a pending, but got %d", n)
+	}
+}
+
+// Test that producers of a tag blocked on a full queue count against its
+// quota, so that concurrent ones cannot all pass the check before any of
+// them is stored
+func TestTagQuotaConcurrentBlockedProducers(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(3), WithTagQuota(2, nil))
+	q.EnqueueBatch("x", "y", "z") // Full: tagged producers wait for room.
+	result := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		go func(i int) {
+			result <- q.EnqueueTagged("a", i)
+		}(i)
+	}
+	for i := 0; i < 3; i++ {
+		if err := <-result; !errors.Is(err, ErrQuotaExceeded) {
+			t.Fatalf("Expected the producers beyond the quota refused, but got %v", err)
+		}
+	}
+	awaitCount(t, q.WaitingProducers, 2)
+	for i := 0; i < 3; i++ {
+		q.Dequeue() // Room for all three, but the quota leaves two.
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-result; err != nil {
+			t.Errorf("Expected the waiting producers admitted, but got %v", err)
+		}
+	}
+	if s := q.StatsByTag()["a"]; s.Pending != 2 || s.QuotaRejected != 3 {
+		t.Errorf("Expected 2 items of a pending and 3 refused, but got %+v", s)
+	}
+}
+
+// Test that WithTagQuota rejects negative caps
+func TestTagQuotaInvalid(t *testing.T) {
+	for _, c := range []struct {
+		def   int
+		byTag map[string]int
+	}{{-1, nil}, {1, map[string]int{"a": -1}}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected a panic for %d and %v", c.def, c.byTag)
+				}
+			}()
+			WithTagQuota(c.def, c.byTag)
+		}()
+	}
+}
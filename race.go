@@ -0,0 +1,8 @@
+//go:build race
+
+package threadsafequeue
+
+// raceEnabled reports whether the package was built with the race detector,
+// which enables extra checks for misuse that would otherwise corrupt state
+// silently.
+const raceEnabled = true
@@ -0,0 +1,139 @@
+package threadsafequeue
+
+import "time"
+
+const (
+	// rateBucket is the span of one bucket of the rate window.
+	rateBucket = time.Second
+	// rateBuckets is the number of buckets, making a window of ten seconds.
+	rateBuckets = 10
+)
+
+// WithRateTracking makes the queue count the items enqueued and dequeued per
+// second over the last ten seconds, for EnqueueRate and DequeueRate. The
+// counts are kept in a fixed ring of one-second buckets, advanced by the
+// operations themselves with the queue's clock, so no goroutine is involved
+// and memory stays constant. Tracking costs a clock reading on each enqueue
+// and dequeue; with it off, the queue pays a single branch per operation.
+func WithRateTracking(enabled bool) Option {
+	return func(q *ThreadSafeQueue) {
+		if enabled {
+			q.rates = &rateWindow{}
+		} else {
+			q.rates = nil
+		}
+	}
+}
+
+// EnqueueRate returns the items stored per second over the last ten
+// seconds, or over the time since the queue was created if that is shorter,
+// or zero without WithRateTracking. Items dropped on arrival or refused are
+// not counted.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) EnqueueRate() float64 {
+	q.rlock()
+	defer q.mu.RUnlock()
+	if q.rates == nil {
+		return 0
+	}
+	return q.rates.rate(q.clock.Now(), false)
+}
+
+// DequeueRate returns the items removed by consumers per second, Drain
+// included, over the same window as EnqueueRate, or zero without
+// WithRateTracking.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) DequeueRate() float64 {
+	q.rlock()
+	defer q.mu.RUnlock()
+	if q.rates == nil {
+		return 0
+	}
+	return q.rates.rate(q.clock.Now(), true)
+}
+
+// EstimatedDrainTime estimates how long the items in the queue will take to
+// be consumed if consumers keep up the rate reported by DequeueRate. It is
+// only an estimate: it ignores items still to arrive and any change of pace.
+// The boolean is false if the rate is zero, as when no item was dequeued in
+// the window, or unknown without WithRateTracking.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) EstimatedDrainTime() (time.Duration, bool) {
+	q.rlock()
+	defer q.mu.RUnlock()
+	if q.rates == nil {
+		return 0, false
+	}
+	rate := q.rates.rate(q.clock.Now(), true)
+	if rate <= 0 {
+		return 0, false
+	}
+	return time.Duration(float64(q.len()) / rate * float64(time.Second)), true
+}
+
+// rateWindow is the ring behind WithRateTracking, protected by the queue's
+// lock.
+type rateWindow struct {
+	start   time.Time // When the queue was created.
+	buckets [rateBuckets]rateCount
+}
+
+// rateCount counts the items of one second of the window.
+type rateCount struct {
+	second   int64 // Seconds since start at which the bucket began.
+	enqueued uint64
+	dequeued uint64
+}
+
+// bucket returns the bucket for the time now, cleared if it last counted an
+// earlier second.
+func (w *rateWindow) bucket(now time.Time) *rateCount {
+	second := int64(now.Sub(w.start) / rateBucket)
+	b := &w.buckets[second%rateBuckets]
+	if b.second != second {
+		*b = rateCount{second: second}
+	}
+	return b
+}
+
+// rate returns the items per second over the window ending at now.
+func (w *rateWindow) rate(now time.Time, dequeued bool) float64 {
+	elapsed := now.Sub(w.start)
+	second := int64(elapsed / rateBucket)
+	var n uint64
+	for _, b := range w.buckets {
+		if b.second > second-rateBuckets && b.second <= second {
+			if dequeued {
+				n += b.dequeued
+			} else {
+				n += b.enqueued
+			}
+		}
+	}
+	// The window spans the buckets before the current one and the part of
+	// the current one elapsed, or less right after the queue was created.
+	if span := time.Duration(rateBuckets-1)*rateBucket + elapsed%rateBucket; elapsed > span {
+		elapsed = span
+	}
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(n) / elapsed.Seconds()
+}
+
+// rateAdded counts n items stored. The caller must hold q.mu exclusively.
+func (q *ThreadSafeQueue) rateAdded(n int) {
+	if q.rates == nil {
+		return
+	}
+	q.rates.bucket(q.clock.Now()).enqueued += uint64(n)
+}
+
+// rateRemoved counts n items removed by consumers. The caller must hold q.mu
+// exclusively.
+func (q *ThreadSafeQueue) rateRemoved(n int) {
+	if q.rates == nil {
+		return
+	}
+	q.rates.bucket(q.clock.Now()).dequeued += uint64(n)
+}
@@ -0,0 +1,96 @@
+package threadsafequeue
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that the rates average over the elapsed time right after creation
+// and over ten seconds afterwards
+func TestRates(t *testing.T) {
+	c := newManualClock()
+	q := NewThreadSafeQueue(WithClock(c), WithRateTracking(true))
+	if r := q.EnqueueRate(); r != 0 {
+		t.Errorf("Expected no rate at creation, got %v", r)
+	}
+	c.advance(500 * time.Millisecond)
+	q.EnqueueBatch(1, 2, 3, 4, 5)
+	c.advance(500 * time.Millisecond)
+	if r := q.EnqueueRate(); r != 5 {
+		t.Errorf("Expected 5 items/s over the first second, got %v", r)
+	}
+	q.Drain()
+
+	// Ten items a second in, four out, for twenty seconds.
+	for s := 1; s < 20; s++ {
+		c.advance(500 * time.Millisecond)
+		for i := 0; i < 10; i++ {
+			q.Enqueue(i)
+		}
+		for i := 0; i < 4; i++ {
+			q.TryDequeue()
+		}
+		c.advance(500 * time.Millisecond)
+	}
+	if r := q.EnqueueRate(); r != 10 {
+		t.Errorf("Expected 10 items/s in, got %v", r)
+	}
+	if r := q.DequeueRate(); r != 4 {
+		t.Errorf("Expected 4 items/s out, got %v", r)
+	}
+
+	// An idle stretch ages the counts out of the window, which ends with
+	// five idle seconds and starts with four busy ones.
+	c.advance(5 * time.Second)
+	if r := q.EnqueueRate(); r != 40.0/9 {
+		t.Errorf("Expected %v items/s with half the window idle, got %v", 40.0/9, r)
+	}
+	c.advance(time.Minute)
+	if r := q.EnqueueRate(); r != 0 {
+		t.Errorf("Expected no rate after a minute idle, got %v", r)
+	}
+	n := len(q.Drain())
+	c.advance(time.Second)
+	if r := q.DequeueRate(); r != float64(n)/9 {
+		t.Errorf("Expected Drain to count %d items over the window, got %v items/s", n, r)
+	}
+}
+
+// Test that a queue without rate tracking reports no rate
+func TestRatesOff(t *testing.T) {
+	q := NewThreadSafeQueue()
+	q.Enqueue(1)
+	q.TryDequeue()
+	if q.EnqueueRate() != 0 || q.DequeueRate() != 0 {
+		t.Errorf("Expected no rates without tracking, got %v and %v", q.EnqueueRate(), q.DequeueRate())
+	}
+}
+
+// Test that the drain time is the backlog over the dequeue rate of a
+// constant-rate consumer
+func TestEstimatedDrainTime(t *testing.T) {
+	c := newManualClock()
+	q := NewThreadSafeQueue(WithClock(c), WithRateTracking(true))
+	for i := 0; i < 1000; i++ {
+		q.Enqueue(i)
+	}
+	if _, ok := q.EstimatedDrainTime(); ok {
+		t.Error("Expected no estimate before anything is dequeued")
+	}
+	for s := 0; s < 10; s++ {
+		for i := 0; i < 20; i++ {
+			q.TryDequeue() // Twenty items a second.
+		}
+		c.advance(time.Second)
+	}
+	if d, ok := q.EstimatedDrainTime(); !ok || d != 40*time.Second {
+		t.Errorf("Expected 800 items to take 40s at 20/s, got %v, %v", d, ok)
+	}
+	c.advance(time.Minute)
+	if _, ok := q.EstimatedDrainTime(); ok {
+		t.Error("Expected no estimate once consumers stopped for the whole window")
+	}
+	if _, ok := NewThreadSafeQueue().EstimatedDrainTime(); ok {
+		t.Error("Expected no estimate without rate tracking")
+	}
+}
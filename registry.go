@@ -0,0 +1,110 @@
+package threadsafequeue
+
+import (
+	"sort"
+	"sync"
+)
+
+// Registry is a concurrency-safe collection of named queues. Queues are
+// created on first use, so callers never need to coordinate get-or-create
+// logic themselves.
+type Registry struct {
+	queues map[string]*ThreadSafeQueue // Queues by name.
+	opts   []Option                    // Options applied to every queue the registry creates.
+	mu     sync.Mutex                  // Mutex to protect concurrent access to the map.
+}
+
+// NewRegistry initializes and returns an empty Registry. The given options are
+// applied to every queue the registry creates.
+func NewRegistry(opts ...Option) *Registry {
+	return &Registry{
+		queues: make(map[string]*ThreadSafeQueue),
+		opts:   opts,
+	}
+}
+
+// Get returns the queue registered under name, creating it with the
+// registry's default options if it does not exist yet. Concurrent calls for
+// the same name always return the same queue.
+// This method is safe for concurrent use.
+func (r *Registry) Get(name string) *ThreadSafeQueue {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	q, ok := r.queues[name]
+	if !ok {
+		q = NewThreadSafeQueue(r.opts...)
+		r.queues[name] = q
+	}
+	return q
+}
+
+// Delete removes the queue registered under name, closes it and discards any
+// items left in it, so that its consumers terminate. Deleting a name that is
+// not registered has no effect. A later Get for the same name creates a new
+// queue.
+// This method is safe for concurrent use.
+func (r *Registry) Delete(name string) {
+	r.mu.Lock()
+	q, ok := r.queues[name]
+	delete(r.queues, name)
+	r.mu.Unlock()
+	if ok {
+		q.Close()
+		q.Drain()
+	}
+}
+
+// Names returns the names of all registered queues in sorted order.
+// This method is safe for concurrent use.
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.queues))
+	for name := range r.queues {
+		names = append(names, name)
+	}
+	r.mu.Unlock()
+	sort.Strings(names)
+	return names
+}
+
+// Range calls fn for each registered queue in name order until fn returns
+// false. It iterates over a snapshot taken when Range is called, so fn may
+// safely call Get or Delete.
+// This method is safe for concurrent use.
+func (r *Registry) Range(fn func(name string, q *ThreadSafeQueue) bool) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.queues))
+	queues := make(map[string]*ThreadSafeQueue, len(r.queues))
+	for name, q := range r.queues {
+		names = append(names, name)
+		queues[name] = q
+	}
+	r.mu.Unlock()
+	sort.Strings(names)
+	for _, name := range names {
+		if !fn(name, queues[name]) {
+			return
+		}
+	}
+}
+
+// Len returns the number of registered queues.
+// This method is safe for concurrent use.
+func (r *Registry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.queues)
+}
+
+// TotalSize returns the number of items queued across all registered queues.
+// The queues are sampled one after another, so the result is approximate
+// while they are being modified.
+// This method is safe for concurrent use.
+func (r *Registry) TotalSize() int {
+	total := 0
+	r.Range(func(_ string, q *ThreadSafeQueue) bool {
+		total += q.Size()
+		return true
+	})
+	return total
+}
@@ -0,0 +1,130 @@
+package threadsafequeue
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test that Get creates a queue on first use and returns it afterwards
+func TestRegistryGet(t *testing.T) {
+	r := NewRegistry()
+	q := r.Get("orders")
+	if q == nil {
+		t.Fatal("Expected Get to return a queue")
+	}
+	if r.Get("orders") != q {
+		t.Error("Expected Get to return the same queue for the same name")
+	}
+	if r.Get("payments") == q {
+		t.Error("Expected Get to return different queues for different names")
+	}
+	if r.Len() != 2 {
+		t.Errorf("Expected 2 queues, got %d", r.Len())
+	}
+}
+
+// Test that concurrent Get calls for the same name create exactly one queue
+func TestRegistryConcurrentGet(t *testing.T) {
+	r := NewRegistry()
+	const goroutines = 64
+	results := make([]*ThreadSafeQueue, goroutines)
+	var wg sync.WaitGroup
+
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = r.Get("shared")
+		}(i)
+	}
+	wg.Wait()
+
+	for i, q := range results {
+		if q != results[0] {
+			t.Fatalf("Goroutine %d got a different queue", i)
+		}
+	}
+}
+
+// Test that the registry applies its default options to new queues
+func TestRegistryDefaultOptions(t *testing.T) {
+	applied := 0
+	r := NewRegistry(func(q *ThreadSafeQueue) { applied++ })
+	r.Get("a")
+	r.Get("a")
+	r.Get("b")
+	if applied != 2 {
+		t.Errorf("Expected options to be applied twice, got %d", applied)
+	}
+}
+
+// Test that Delete closes and drains the removed queue
+func TestRegistryDelete(t *testing.T) {
+	r := NewRegistry()
+	q := r.Get("jobs")
+	q.Enqueue(1)
+	q.Enqueue(2)
+
+	done := make(chan bool)
+	go func() {
+		// Wait for the items to be drained by Delete, then observe the close.
+		for !q.IsEmpty() {
+			time.Sleep(time.Millisecond)
+		}
+		_, ok := q.Dequeue()
+		done <- ok
+	}()
+
+	r.Delete("jobs")
+
+	select {
+	case ok := <-done:
+		if ok {
+			t.Error("Dequeue should fail on a deleted queue")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Consumer of a deleted queue did not terminate")
+	}
+
+	if r.Len() != 0 {
+		t.Errorf("Expected no queues after Delete, got %d", r.Len())
+	}
+	if r.Get("jobs") == q {
+		t.Error("Expected Get after Delete to create a new queue")
+	}
+}
+
+// Test Names, Range and TotalSize
+func TestRegistryRange(t *testing.T) {
+	r := NewRegistry()
+	r.Get("c").Enqueue(1)
+	r.Get("a").Enqueue(1)
+	r.Get("a").Enqueue(2)
+	r.Get("b")
+
+	names := r.Names()
+	expected := []string{"a", "b", "c"}
+	if len(names) != len(expected) {
+		t.Fatalf("Expected names %v, got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("Expected name %s at position %d, got %s", expected[i], i, names[i])
+		}
+	}
+
+	var visited []string
+	r.Range(func(name string, q *ThreadSafeQueue) bool {
+		visited = append(visited, name)
+		r.Delete(name) // Range must tolerate modification from the callback.
+		return name != "b"
+	})
+	if len(visited) != 2 {
+		t.Errorf("Expected Range to stop after 2 queues, visited %v", visited)
+	}
+
+	if r.TotalSize() != 1 {
+		t.Errorf("Expected total size to be 1, got %d", r.TotalSize())
+	}
+}
@@ -0,0 +1,550 @@
+package threadsafequeue
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// The stream written by StartReplication is a series of records in the
+// format described with formatVersion, each with a head of the operation
+// and its sequence number, and a body depending on the operation:
+//
+//	head:    operation (byte), sequence number (uint64, big-endian)
+//	state:   'S', then every item, in the format of Save
+//	enqueue: 'E' or, for an item stored at the front, 'F', then the item
+//	dequeue: 'D', then the number of items removed from the front (uvarint)
+//	cancel:  'X', then the slot from the front of the item removed by
+//	         Ticket.Cancel (uvarint)
+//	purge:   'P', then nothing
+//	close:   'C', then nothing
+//
+// Operations are numbered from one in the order they happened on the
+// primary. A state record carries the number of the last operation it
+// reflects, and the operations after it follow. Cancelled items keep their
+// slots on the follower as they do on the primary, until the items ahead of
+// them are removed or a purge releases them all, as in the write-ahead log.
+const (
+	replState   = 'S'
+	replEnqueue = 'E'
+	replFront   = 'F'
+	replDequeue = 'D'
+	replCancel  = 'X'
+	replPurge   = 'P'
+	replClose   = 'C'
+
+	replHeadLen = 1 + 8
+
+	// maxReplBacklog bounds the operations waiting to be sent to a replica.
+	// Past it, they are dropped and the replica is sent the whole state
+	// instead, so a slow connection costs the queue no more memory than a
+	// copy of its items.
+	maxReplBacklog = 1 << 16
+
+	defaultResync = time.Minute
+)
+
+// ReplicationOption configures StartReplication.
+type ReplicationOption func(*replicationOptions)
+
+type replicationOptions struct {
+	resync time.Duration
+}
+
+// ReplicationResync sets how often StartReplication sends the whole state
+// of the queue again, so that a follower that went wrong recovers; zero
+// turns the resends off. The default is a minute.
+func ReplicationResync(every time.Duration) ReplicationOption {
+	return func(o *replicationOptions) {
+		o.resync = every
+	}
+}
+
+// StartReplication streams the operations on the queue over conn to a
+// follower created with NewFollower at the other end, encoding items with
+// codec, so that the follower's queue mirrors this one as a warm standby.
+// It sends the whole state of the queue first, which lets a follower join
+// at any time, and then every enqueue, dequeue, drop, drain and close, in
+// the order they happen. The state is sent again every minute, or as set
+// by ReplicationResync, and whenever the connection falls too far behind.
+// Operations are recorded under the queue's lock but encoded and written
+// from a goroutine of its own, so a slow connection never blocks producers
+// and consumers.
+//
+// It returns the error of sending the initial state, in which case no
+// goroutine is started. Replication ends once the queue is closed and
+// empty, when conn fails, or when stop is called; stop waits for the
+// goroutine to exit and returns the error that ended it, or nil. A failure
+// is also logged. Reconnecting is left to the caller: a new call with a new
+// connection starts over with the whole state. A queue can replicate to
+// several connections at once.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) StartReplication(conn net.Conn, codec Codec, opts ...ReplicationOption) (stop func() error, err error) {
+	o := replicationOptions{resync: defaultResync}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	r := &replica{conn: conn, codec: codec, w: bufio.NewWriter(conn), wake: make(chan struct{}, 1)}
+	q.lock()
+	q.purgeCanceled() // The state leaves the slots of cancelled items out.
+	items := q.liveItems()
+	q.replicas = append(q.replicas, r)
+	if q.closed {
+		r.add(replOp{kind: replClose})
+	}
+	q.unlock()
+	if err := r.sendState(items, 0); err != nil {
+		q.removeReplica(r)
+		return nil, err
+	}
+	quit := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		err := q.replicate(r, o.resync, quit)
+		q.removeReplica(r)
+		if err != nil {
+			select {
+			case <-quit:
+				return // The write was cut short by stop.
+			default:
+			}
+			r.err = err
+			if q.logger != nil {
+				q.log(logEvent{level: slog.LevelError, msg: "replication failed", size: q.Size(), attrs: []slog.Attr{
+					slog.String(LogKeyError, err.Error()),
+				}})
+			}
+		}
+	}()
+	var once sync.Once
+	return func() error {
+		once.Do(func() {
+			close(quit)
+			conn.SetWriteDeadline(time.Now()) // Unblock a write in progress.
+		})
+		<-exited
+		conn.SetWriteDeadline(time.Time{})
+		return r.err
+	}, nil
+}
+
+// replica is the state of one StartReplication. Apart from the fields used
+// only by its goroutine, it is protected by the queue's lock.
+type replica struct {
+	conn   net.Conn
+	codec  Codec
+	w      *bufio.Writer // Used only by the goroutine.
+	buf    bytes.Buffer  // Used only by the goroutine.
+	rec    []byte        // Used only by the goroutine.
+	seq    uint64        // Number of the last operation.
+	ops    []replOp      // Operations not yet sent.
+	spare  []replOp      // Recycled operations slice.
+	resync bool          // The whole state is due, superseding ops.
+	wake   chan struct{} // Signalled when ops or resync change.
+	err    error         // Error that ended replication, set before the goroutine exits.
+}
+
+// replOp is an operation waiting to be sent to a replica.
+type replOp struct {
+	kind byte
+	seq  uint64
+	item interface{}
+	n    int
+}
+
+// add numbers op and queues it for sending. The caller must hold the
+// queue's lock.
+func (r *replica) add(op replOp) {
+	r.seq++
+	op.seq = r.seq
+	if r.resync {
+		return // The state will include it.
+	}
+	if len(r.ops) >= maxReplBacklog {
+		clear(r.ops)
+		r.ops = r.ops[:0]
+		r.resync = true
+	} else {
+		r.ops = append(r.ops, op)
+	}
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// replAdded records item as stored at the front or the back for every
+// replica. The caller must hold q.mu exclusively.
+func (q *ThreadSafeQueue) replAdded(item interface{}, front bool) {
+	kind := byte(replEnqueue)
+	if front {
+		kind = replFront
+	}
+	for _, r := range q.replicas {
+		r.add(replOp{kind: kind, item: item})
+	}
+}
+
+// replRemoved records the removal of n items from the front for every
+// replica. The caller must hold q.mu exclusively.
+func (q *ThreadSafeQueue) replRemoved(n int) {
+	for _, r := range q.replicas {
+		r.add(replOp{kind: replDequeue, n: n})
+	}
+}
+
+// replCanceled records the removal of the i-th item from the front by
+// Cancel for every replica. The caller must hold q.mu exclusively.
+func (q *ThreadSafeQueue) replCanceled(i int) {
+	for _, r := range q.replicas {
+		r.add(replOp{kind: replCancel, n: i})
+	}
+}
+
+// replPurged records the release of the slots of all cancelled items for
+// every replica. The caller must hold q.mu exclusively.
+func (q *ThreadSafeQueue) replPurged() {
+	for _, r := range q.replicas {
+		r.add(replOp{kind: replPurge})
+	}
+}
+
+// replClosed records that the queue was closed for every replica. The
+// caller must hold q.mu exclusively.
+func (q *ThreadSafeQueue) replClosed() {
+	for _, r := range q.replicas {
+		r.add(replOp{kind: replClose})
+	}
+}
+
+// removeReplica stops recording operations for r.
+func (q *ThreadSafeQueue) removeReplica(r *replica) {
+	q.lock()
+	defer q.unlock()
+	for i, s := range q.replicas {
+		if s == r {
+			last := len(q.replicas) - 1
+			copy(q.replicas[i:], q.replicas[i+1:])
+			q.replicas[last] = nil
+			q.replicas = q.replicas[:last]
+			return
+		}
+	}
+}
+
+// replicate sends the operations recorded for r as they come, and the whole
+// state every resync, until the queue is closed and empty, quit is closed
+// or a write fails.
+func (q *ThreadSafeQueue) replicate(r *replica, resync time.Duration, quit <-chan struct{}) error {
+	var timer Timer
+	var tick <-chan time.Time
+	if resync > 0 {
+		timer = q.clock.NewTimer(resync)
+		defer timer.Stop()
+		tick = timer.C()
+	}
+	for {
+		select {
+		case <-quit:
+			return nil
+		case <-r.wake:
+		case <-tick:
+			timer.Reset(resync)
+			q.lock()
+			r.resync = true
+			q.unlock()
+		}
+		q.lock()
+		if r.resync {
+			q.purgeCanceled() // The state leaves the slots of cancelled items out.
+		}
+		ops, state := r.ops, r.resync
+		r.ops, r.spare, r.resync = r.spare[:0], ops, false
+		var items []interface{}
+		if state {
+			items = q.liveItems()
+		}
+		seq := r.seq
+		finished := q.closed && q.len() == 0
+		q.unlock()
+		var err error
+		if state {
+			err = r.sendState(items, seq) // Supersedes the operations taken.
+		} else {
+			err = r.sendOps(ops)
+		}
+		clear(ops)
+		if err != nil {
+			return err
+		}
+		if finished {
+			return nil
+		}
+	}
+}
+
+// sendState writes a state record of items as of operation seq.
+func (r *replica) sendState(items []interface{}, seq uint64) error {
+	r.buf.Reset()
+	if err := save(&r.buf, items, r.codec); err != nil {
+		return err
+	}
+	if err := r.write(replState, seq, r.buf.Bytes()); err != nil {
+		return err
+	}
+	return r.w.Flush()
+}
+
+// sendOps writes a record for each of ops.
+func (r *replica) sendOps(ops []replOp) error {
+	for _, op := range ops {
+		r.buf.Reset()
+		switch op.kind {
+		case replEnqueue, replFront:
+			if err := r.codec.Encode(&r.buf, op.item); err != nil {
+				return fmt.Errorf("threadsafequeue: encoding item of operation %d: %w", op.seq, err)
+			}
+		case replDequeue, replCancel:
+			var b [binary.MaxVarintLen64]byte
+			r.buf.Write(b[:binary.PutUvarint(b[:], uint64(op.n))])
+		}
+		if err := r.write(op.kind, op.seq, r.buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return r.w.Flush()
+}
+
+// write writes a record of operation seq of kind with body.
+func (r *replica) write(kind byte, seq uint64, body []byte) error {
+	var head [replHeadLen]byte
+	head[0] = kind
+	binary.BigEndian.PutUint64(head[1:], seq)
+	r.rec = appendRecord(r.rec[:0], head[:], body)
+	_, err := r.w.Write(r.rec)
+	return err
+}
+
+// NewFollower returns a new queue, created with opts, that mirrors the queue
+// replicating to it with StartReplication at the other end of conn, reading
+// items with codec. It should be created like the primary, with at least
+// its capacity. Operations are applied as they arrive from a goroutine of
+// its own, each exactly once: one numbered at or before the state already
+// applied is skipped. The follower is meant as a warm standby, read but not
+// consumed from while it follows, since its items are removed as the
+// primary's consumers remove them.
+//
+// Following ends when the primary closes its queue and it has emptied, or
+// when reading from conn fails, such as when the caller closes conn to
+// promote the follower after a failover; FollowerDone and FollowerErr
+// report it. The queue is then an ordinary queue, closed if the primary
+// was. Operations are not deduplicated across connections: a follower
+// given a new connection should be a new queue, which the initial state
+// brings up to date.
+func NewFollower(conn net.Conn, codec Codec, opts ...Option) *ThreadSafeQueue {
+	q := NewThreadSafeQueue(opts...)
+	q.follower = &follower{done: make(chan struct{})}
+	go func() {
+		err := q.follow(conn, codec)
+		if err != nil {
+			err = fmt.Errorf("threadsafequeue: following: %w", err)
+			if q.logger != nil {
+				q.log(logEvent{level: slog.LevelError, msg: "replication failed", size: q.Size(), attrs: []slog.Attr{
+					slog.String(LogKeyError, err.Error()),
+				}})
+			}
+		}
+		q.follower.err = err
+		close(q.follower.done)
+	}()
+	return q
+}
+
+// follower is the state behind NewFollower.
+type follower struct {
+	done chan struct{}
+	err  error // Set before done is closed.
+}
+
+// FollowerDone returns a channel closed once a queue created by NewFollower
+// stops following, or nil for other queues.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) FollowerDone() <-chan struct{} {
+	if q.follower == nil {
+		return nil
+	}
+	return q.follower.done
+}
+
+// FollowerErr returns the error that ended following for a queue created by
+// NewFollower, or nil while it follows, if it ended with the primary's
+// queue closed and empty, and for other queues.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) FollowerErr() error {
+	if q.follower == nil {
+		return nil
+	}
+	select {
+	case <-q.follower.done:
+		return q.follower.err
+	default:
+		return nil
+	}
+}
+
+// errReplication describes a stream that does not fit the follower.
+var errReplication = errors.New("replication stream out of step")
+
+// follow applies the operations read from conn until the primary's queue
+// is closed and empty or reading fails.
+func (q *ThreadSafeQueue) follow(conn net.Conn, codec Codec) error {
+	r := bufio.NewReader(conn)
+	head := make([]byte, replHeadLen)
+	var buf bytes.Buffer
+	var last uint64
+	synced := false
+	for {
+		if err := readRecord(r, head, &buf); err != nil {
+			if err == errChecksum || err == errHeaderChecksum {
+				err = fmt.Errorf("%w: operation after %d: %w", ErrCorrupt, last, err)
+			}
+			return err
+		}
+		kind, seq := head[0], binary.BigEndian.Uint64(head[1:])
+		if kind == replState {
+			var items []interface{}
+			if _, err := readSnapshot(&buf, "", codec, false, func(_ int, item interface{}) error {
+				items = append(items, item)
+				return nil
+			}); err != nil {
+				return err
+			}
+			if err := q.mirror(items); err != nil {
+				return err
+			}
+			last, synced = seq, true
+			continue
+		}
+		if !synced {
+			return fmt.Errorf("%w: operation %d before any state", errReplication, seq)
+		}
+		if seq <= last {
+			continue // Already applied.
+		}
+		if seq != last+1 {
+			return fmt.Errorf("%w: operation %d follows %d", errReplication, seq, last)
+		}
+		last = seq
+		switch kind {
+		case replEnqueue, replFront:
+			item, err := codec.Decode(&buf)
+			if err != nil {
+				return fmt.Errorf("decoding item of operation %d: %w", seq, err)
+			}
+			if err := q.mirrorAdded(item, kind == replFront); err != nil {
+				return err
+			}
+		case replDequeue:
+			n, err := binary.ReadUvarint(&buf)
+			if err != nil {
+				return fmt.Errorf("%w: malformed operation %d", errReplication, seq)
+			}
+			if err := q.mirrorRemoved(n); err != nil {
+				return err
+			}
+		case replCancel:
+			i, err := binary.ReadUvarint(&buf)
+			if err != nil {
+				return fmt.Errorf("%w: malformed operation %d", errReplication, seq)
+			}
+			if err := q.mirrorCanceled(i); err != nil {
+				return err
+			}
+		case replPurge:
+			q.mirrorPurged()
+		case replClose:
+			q.Close()
+		default:
+			return fmt.Errorf("%w: unknown operation %q", errReplication, kind)
+		}
+		if q.finished() {
+			return nil // The primary sends nothing more.
+		}
+	}
+}
+
+// finished reports whether the queue is closed and empty.
+func (q *ThreadSafeQueue) finished() bool {
+	q.rlock()
+	defer q.mu.RUnlock()
+	return q.closed && q.len() == 0
+}
+
+// mirror replaces the items in the queue with those of a state record.
+func (q *ThreadSafeQueue) mirror(items []interface{}) error {
+	q.lock()
+	defer q.unlock()
+	for range q.drain() {
+		q.taskDone() // Taken on the primary.
+	}
+	if q.capacity > 0 && len(items) > q.capacity {
+		return fmt.Errorf("%w: %d items for a capacity of %d", errReplication, len(items), q.capacity)
+	}
+	for _, item := range items {
+		q.store(item, extra{}, false)
+	}
+	return nil
+}
+
+// mirrorAdded stores an item enqueued on the primary.
+func (q *ThreadSafeQueue) mirrorAdded(item interface{}, front bool) error {
+	q.lock()
+	defer q.unlock()
+	if q.full() {
+		return fmt.Errorf("%w: no room for an item at a capacity of %d", errReplication, q.capacity)
+	}
+	q.store(item, extra{}, front)
+	return nil
+}
+
+// mirrorRemoved removes n items dequeued on the primary.
+func (q *ThreadSafeQueue) mirrorRemoved(n uint64) error {
+	q.lock()
+	defer q.unlock()
+	if n > uint64(q.len()) {
+		return fmt.Errorf("%w: %d items removed of %d", errReplication, n, q.len())
+	}
+	for ; n > 0; n-- {
+		q.remove()
+		q.taskDone() // Taken on the primary.
+	}
+	return nil
+}
+
+// mirrorCanceled marks the i-th slot from the front as cancelled, as it was
+// on the primary.
+func (q *ThreadSafeQueue) mirrorCanceled(i uint64) error {
+	q.lock()
+	defer q.unlock()
+	q.startExtras()
+	q.ticketsOn = true // Marks the slots of cancelled items beside them.
+	if i >= uint64(q.items.len()) || q.extras.at(int(i)).canceled {
+		return fmt.Errorf("%w: slot %d canceled, not an item of %d", errReplication, i, q.items.len())
+	}
+	q.cancel(int(i), q.items.at(int(i)))
+	return nil
+}
+
+// mirrorPurged releases the slots of cancelled items, as the primary did.
+func (q *ThreadSafeQueue) mirrorPurged() {
+	q.lock()
+	defer q.unlock()
+	q.purgeCanceled()
+}
@@ -0,0 +1,234 @@
+package threadsafequeue
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// awaitMirror waits until the follower holds want
+func awaitMirror(t *testing.T, f *ThreadSafeQueue, want []interface{}) {
+	t.Helper()
+	var got []interface{}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if got = f.ToSlice(); reflect.DeepEqual(got, want) || (len(got) == 0 && len(want) == 0) {
+			return
+		}
+	}
+	t.Fatalf("Expected the follower to hold %v, got %v", want, got)
+}
+
+// Test that a follower joining late mirrors the primary's items and every
+// operation after, and ends once the primary is closed and empty
+func TestReplication(t *testing.T) {
+	primary := NewThreadSafeQueue()
+	primary.EnqueueBatch(1, 2, 3)
+	src, dst := net.Pipe()
+	defer dst.Close()
+	follower := NewFollower(dst, &intCodec{})
+	stop, err := primary.StartReplication(src, &intCodec{})
+	if err != nil {
+		t.Fatalf("Expected replication to start, got %v", err)
+	}
+	awaitMirror(t, follower, []interface{}{1, 2, 3})
+
+	primary.Dequeue()
+	primary.EnqueueFront(0)
+	primary.Enqueue(4)
+	awaitMirror(t, follower, []interface{}{0, 2, 3, 4})
+	primary.Drain()
+	primary.EnqueueBatch(5, 6)
+	awaitMirror(t, follower, []interface{}{5, 6})
+
+	primary.Close()
+	primary.Dequeue()
+	awaitMirror(t, follower, []interface{}{6})
+	if err := follower.TryEnqueue(7); err != ErrClosed {
+		t.Errorf("Expected the follower to be closed with the primary, got %v", err)
+	}
+	primary.Dequeue()
+	select {
+	case <-follower.FollowerDone():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the follower to finish once the primary is closed and empty")
+	}
+	if err := follower.FollowerErr(); err != nil {
+		t.Errorf("Expected the follower to finish cleanly, got %v", err)
+	}
+	if err := stop(); err != nil {
+		t.Errorf("Expected replication to finish cleanly, got %v", err)
+	}
+}
+
+// Test that items cancelled on the primary are removed from the follower
+func TestReplicationCancel(t *testing.T) {
+	primary := NewThreadSafeQueue()
+	var tickets []*Ticket
+	for i := 1; i <= 5; i++ {
+		tickets = append(tickets, primary.EnqueueCancelable(i))
+	}
+	src, dst := net.Pipe()
+	defer dst.Close()
+	follower := NewFollower(dst, &intCodec{})
+	stop, err := primary.StartReplication(src, &intCodec{})
+	if err != nil {
+		t.Fatalf("Expected replication to start, got %v", err)
+	}
+	defer stop()
+	awaitMirror(t, follower, []interface{}{1, 2, 3, 4, 5})
+	if !tickets[3].Cancel() || !tickets[0].Cancel() {
+		t.Fatal("Expected to cancel queued items on a replicated queue")
+	}
+	awaitMirror(t, follower, []interface{}{2, 3, 5})
+	if s := follower.Stats(); s.Canceled != 2 {
+		t.Errorf("Expected the follower to count 2 cancelled items, got %d", s.Canceled)
+	}
+
+	// A second replica releases the cancelled slots on the primary, and the
+	// first follower with it, so both agree on the slots cancelled next.
+	src2, dst2 := net.Pipe()
+	defer dst2.Close()
+	second := NewFollower(dst2, &intCodec{})
+	stop2, err := primary.StartReplication(src2, &intCodec{})
+	if err != nil {
+		t.Fatalf("Expected a second replication to start, got %v", err)
+	}
+	defer stop2()
+	awaitMirror(t, second, []interface{}{2, 3, 5})
+	if !tickets[4].Cancel() {
+		t.Fatal("Expected to cancel the last item")
+	}
+	awaitMirror(t, follower, []interface{}{2, 3})
+	awaitMirror(t, second, []interface{}{2, 3})
+}
+
+// Test that a follower keeps up with concurrent producers and consumers
+func TestReplicationConcurrent(t *testing.T) {
+	primary := NewThreadSafeQueue(WithCapacity(64))
+	src, dst := net.Pipe()
+	defer dst.Close()
+	follower := NewFollower(dst, &intCodec{}, WithCapacity(64))
+	stop, err := primary.StartReplication(src, &intCodec{})
+	if err != nil {
+		t.Fatalf("Expected replication to start, got %v", err)
+	}
+	defer stop()
+
+	var wg sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				primary.Enqueue(p*1000 + i)
+			}
+		}(p)
+	}
+	for c := 0; c < 3; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 650; i++ {
+				primary.Dequeue()
+			}
+		}()
+	}
+	wg.Wait()
+	awaitMirror(t, follower, primary.ToSlice())
+	if err := follower.FollowerErr(); err != nil {
+		t.Errorf("Expected the follower to keep following, got %v", err)
+	}
+}
+
+// Test that the follower applies each operation once, skipping those the
+// state covers, and stops on a gap
+func TestFollowerExactlyOnce(t *testing.T) {
+	src, dst := net.Pipe()
+	defer src.Close()
+	follower := NewFollower(dst, &intCodec{})
+	r := &replica{conn: src, codec: &intCodec{}, w: bufio.NewWriter(src)}
+	send := func(op replOp) {
+		t.Helper()
+		if err := r.sendOps([]replOp{op}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.sendState([]interface{}{1, 2}, 5); err != nil {
+		t.Fatal(err)
+	}
+	send(replOp{kind: replEnqueue, seq: 4, item: 9})
+	send(replOp{kind: replEnqueue, seq: 6, item: 3})
+	send(replOp{kind: replEnqueue, seq: 6, item: 3})
+	send(replOp{kind: replDequeue, seq: 7, n: 1})
+	awaitMirror(t, follower, []interface{}{2, 3})
+
+	send(replOp{kind: replEnqueue, seq: 9, item: 4})
+	<-follower.FollowerDone()
+	if err := follower.FollowerErr(); !errors.Is(err, errReplication) {
+		t.Errorf("Expected a gap to end following, got %v", err)
+	}
+	if got := follower.ToSlice(); !reflect.DeepEqual(got, []interface{}{2, 3}) {
+		t.Errorf("Expected the follower to keep its items, got %v", got)
+	}
+}
+
+// Test that replication ends with the error of a failed connection, and a
+// follower with that of its own
+func TestReplicationConnError(t *testing.T) {
+	primary := NewThreadSafeQueue()
+	src, dst := net.Pipe()
+	follower := NewFollower(dst, &intCodec{})
+	stop, err := primary.StartReplication(src, &intCodec{}, ReplicationResync(0))
+	if err != nil {
+		t.Fatalf("Expected replication to start, got %v", err)
+	}
+	dst.Close()
+	<-follower.FollowerDone()
+	if follower.FollowerErr() == nil {
+		t.Error("Expected the follower to report its closed connection")
+	}
+	primary.Enqueue(1)
+	awaitCount(t, func() int {
+		primary.mu.RLock()
+		defer primary.mu.RUnlock()
+		return len(primary.replicas)
+	}, 0)
+	if err := stop(); err == nil {
+		t.Error("Expected stop to report the failed connection")
+	}
+
+	src, dst = net.Pipe()
+	dst.Close()
+	if _, err := primary.StartReplication(src, &intCodec{}); err == nil {
+		t.Error("Expected StartReplication to fail on a closed connection")
+	}
+}
+
+// Test that a stopped replication leaves the follower in place, and that the
+// state is sent again every resync interval
+func TestReplicationResync(t *testing.T) {
+	primary := NewThreadSafeQueue()
+	primary.EnqueueBatch(1, 2)
+	src, dst := net.Pipe()
+	defer dst.Close()
+	follower := NewFollower(dst, &intCodec{})
+	stop, err := primary.StartReplication(src, &intCodec{}, ReplicationResync(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Expected replication to start, got %v", err)
+	}
+	awaitMirror(t, follower, []interface{}{1, 2})
+	follower.Dequeue() // Knocks the follower out of step.
+	awaitMirror(t, follower, []interface{}{1, 2})
+
+	if err := stop(); err != nil {
+		t.Errorf("Expected stop to return nil, got %v", err)
+	}
+	primary.Enqueue(3)
+	if got := follower.ToSlice(); !reflect.DeepEqual(got, []interface{}{1, 2}) {
+		t.Errorf("Expected the follower to stop mirroring, got %v", got)
+	}
+}
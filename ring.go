@@ -0,0 +1,178 @@
+package threadsafequeue
+
+import (
+	"context"
+	"sync"
+)
+
+// RingQueue is a fixed-capacity FIFO queue that never blocks producers: when
+// it is full, Enqueue overwrites the oldest retained item. It is meant for
+// "keep the last N events" use cases such as crash-dump context or recent
+// activity feeds.
+//
+// Unlike a bounded queue that drops its oldest item on overflow, RingQueue is
+// backed by an array preallocated at construction and tracked with head and
+// length indices, so its memory use is constant and steady-state operations
+// do not allocate.
+type RingQueue struct {
+	buf        []interface{} // Preallocated storage; len(buf) is the capacity.
+	head       int           // Index of the oldest retained item.
+	count      int           // Number of retained items.
+	overwrites uint64        // Number of items lost to overwriting.
+	mu         sync.Mutex    // Mutex to protect concurrent access to the ring.
+	cond       *sync.Cond    // Condition variable to coordinate enqueue and dequeue operations.
+	closed     bool          // Set by Close; no further items are accepted.
+}
+
+// NewRingQueue initializes and returns a new RingQueue that retains at most
+// capacity items. It panics if capacity is not positive.
+func NewRingQueue(capacity int) *RingQueue {
+	if capacity <= 0 {
+		panic("threadsafequeue: RingQueue capacity must be positive")
+	}
+	r := &RingQueue{buf: make([]interface{}, capacity)}
+	r.cond = sync.NewCond(&r.mu)
+	return r
+}
+
+// Enqueue adds an item to the end of the ring. If the ring is full, the
+// oldest item is overwritten and the overwrite counter is incremented.
+// Enqueue never blocks. Items enqueued after Close are discarded.
+// This method is safe for concurrent use.
+func (r *RingQueue) Enqueue(item interface{}) {
+	r.mu.Lock()
+	if !r.closed {
+		n := len(r.buf)
+		if r.count == n {
+			r.buf[r.head] = item
+			r.head = (r.head + 1) % n
+			r.overwrites++
+		} else {
+			r.buf[(r.head+r.count)%n] = item
+			r.count++
+		}
+		r.cond.Signal()
+	}
+	r.mu.Unlock()
+}
+
+// Dequeue removes and returns the oldest retained item, blocking while the
+// ring is empty. The boolean value is false only when the ring has been
+// closed and all remaining items have been dequeued.
+// This method is safe for concurrent use.
+func (r *RingQueue) Dequeue() (interface{}, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for r.count == 0 && !r.closed {
+		r.cond.Wait()
+	}
+	return r.pop()
+}
+
+// DequeueContext is like Dequeue but gives up when ctx is done. It returns
+// ctx.Err() on cancellation and ErrClosed once the ring has been closed and
+// drained.
+// This method is safe for concurrent use.
+func (r *RingQueue) DequeueContext(ctx context.Context) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stop := watchContext(ctx, r.cond)
+	defer stop()
+	for r.count == 0 && !r.closed {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		r.cond.Wait()
+	}
+	item, ok := r.pop()
+	if !ok {
+		return nil, ErrClosed
+	}
+	return item, nil
+}
+
+// TryDequeue removes and returns the oldest retained item without blocking.
+// The boolean value is false if the ring is empty.
+// This method is safe for concurrent use.
+func (r *RingQueue) TryDequeue() (interface{}, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pop()
+}
+
+// pop removes the oldest item. The caller must hold r.mu.
+func (r *RingQueue) pop() (interface{}, bool) {
+	if r.count == 0 {
+		return nil, false
+	}
+	item := r.buf[r.head]
+	r.buf[r.head] = nil // Drop the reference so the item can be collected.
+	r.head = (r.head + 1) % len(r.buf)
+	r.count--
+	return item, true
+}
+
+// Peek returns the oldest retained item without removing it.
+// The boolean value is false if the ring is empty.
+// This method is safe for concurrent use.
+func (r *RingQueue) Peek() (interface{}, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.count == 0 {
+		return nil, false
+	}
+	return r.buf[r.head], true
+}
+
+// ToSlice returns a copy of the retained items, oldest first.
+// This method is safe for concurrent use.
+func (r *RingQueue) ToSlice() []interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	items := make([]interface{}, r.count)
+	for i := range items {
+		items[i] = r.buf[(r.head+i)%len(r.buf)]
+	}
+	return items
+}
+
+// Overwrites returns the number of items that have been overwritten because
+// the ring was full.
+// This method is safe for concurrent use.
+func (r *RingQueue) Overwrites() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.overwrites
+}
+
+// Close marks the ring as closed. Retained items can still be dequeued; once
+// they are gone, all blocked and future Dequeue calls return immediately with
+// a false boolean. Items enqueued after Close are discarded.
+// This method is safe for concurrent use.
+func (r *RingQueue) Close() {
+	r.mu.Lock()
+	r.closed = true
+	r.cond.Broadcast()
+	r.mu.Unlock()
+}
+
+// Cap returns the fixed capacity of the ring.
+func (r *RingQueue) Cap() int {
+	return len(r.buf)
+}
+
+// IsEmpty returns true if the ring has no items, and false otherwise.
+// This method is safe for concurrent use.
+func (r *RingQueue) IsEmpty() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.count == 0
+}
+
+// Size returns the number of items currently retained.
+// This method is safe for concurrent use.
+func (r *RingQueue) Size() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.count
+}
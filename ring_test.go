@@ -0,0 +1,171 @@
+package threadsafequeue
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test that a RingQueue behaves like a FIFO queue while it has room
+func TestRingQueueFIFO(t *testing.T) {
+	r := NewRingQueue(4)
+	for i := 0; i < 3; i++ {
+		r.Enqueue(i)
+	}
+
+	if r.Size() != 3 {
+		t.Errorf("Expected size to be 3, got %d", r.Size())
+	}
+
+	if item, ok := r.Peek(); !ok || item != 0 {
+		t.Errorf("Expected to peek 0, got %v", item)
+	}
+
+	for i := 0; i < 3; i++ {
+		item, ok := r.Dequeue()
+		if !ok || item != i {
+			t.Errorf("Expected to dequeue %d, got %v", i, item)
+		}
+	}
+
+	if !r.IsEmpty() {
+		t.Error("Ring should be empty after dequeuing every item")
+	}
+}
+
+// Test that a full RingQueue overwrites its oldest items and counts them
+func TestRingQueueOverwrite(t *testing.T) {
+	r := NewRingQueue(3)
+	for i := 0; i < 5; i++ {
+		r.Enqueue(i)
+	}
+
+	if r.Size() != 3 {
+		t.Errorf("Expected size to be 3, got %d", r.Size())
+	}
+	if r.Overwrites() != 2 {
+		t.Errorf("Expected 2 overwrites, got %d", r.Overwrites())
+	}
+
+	items := r.ToSlice()
+	expected := []interface{}{2, 3, 4}
+	if len(items) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, items)
+	}
+	for i := range expected {
+		if items[i] != expected[i] {
+			t.Errorf("Expected %v at position %d, got %v", expected[i], i, items[i])
+		}
+	}
+
+	if item, ok := r.TryDequeue(); !ok || item != 2 {
+		t.Errorf("Expected to dequeue 2, got %v", item)
+	}
+}
+
+// Test that NewRingQueue rejects a non-positive capacity
+func TestRingQueueInvalidCapacity(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected NewRingQueue(0) to panic")
+		}
+	}()
+	NewRingQueue(0)
+}
+
+// Test that Dequeue blocks until an item arrives and is released by Close
+func TestRingQueueBlockingAndClose(t *testing.T) {
+	r := NewRingQueue(2)
+	done := make(chan interface{})
+
+	go func() {
+		item, _ := r.Dequeue()
+		done <- item
+	}()
+
+	// Allow some time for the Dequeue goroutine to start and block
+	time.Sleep(100 * time.Millisecond)
+	r.Enqueue(42)
+
+	select {
+	case item := <-done:
+		if item != 42 {
+			t.Errorf("Expected to dequeue 42, got %v", item)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Dequeue was not woken by Enqueue")
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, ok := r.Dequeue(); ok {
+			t.Error("Dequeue should fail on a closed, empty ring")
+		}
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	r.Close()
+	wg.Wait()
+}
+
+// Test concurrent enqueues and dequeues never exceed the capacity
+func TestRingQueueConcurrentOperations(t *testing.T) {
+	r := NewRingQueue(16)
+	const count = 1000
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < count; i++ {
+			r.Enqueue(i)
+			if r.Size() > r.Cap() {
+				t.Errorf("Size %d exceeds capacity %d", r.Size(), r.Cap())
+			}
+		}
+	}()
+
+	dequeued := 0
+	go func() {
+		defer wg.Done()
+		for {
+			if _, ok := r.Dequeue(); !ok {
+				return
+			}
+			dequeued++
+		}
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	r.Close()
+	wg.Wait()
+
+	if uint64(dequeued)+r.Overwrites() != count {
+		t.Errorf("Expected dequeued + overwrites to be %d, got %d + %d", count, dequeued, r.Overwrites())
+	}
+}
+
+// Benchmark steady-state overwriting; it should report zero allocations.
+func BenchmarkRingQueueOverwrite(b *testing.B) {
+	r := NewRingQueue(1024)
+	var item interface{} = struct{}{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Enqueue(item)
+	}
+}
+
+// Benchmark a steady enqueue/dequeue cycle; it should report zero allocations.
+func BenchmarkRingQueueEnqueueDequeue(b *testing.B) {
+	r := NewRingQueue(1024)
+	var item interface{} = struct{}{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Enqueue(item)
+		r.TryDequeue()
+	}
+}
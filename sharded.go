@@ -0,0 +1,164 @@
+package threadsafequeue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// ShardedQueue spreads items over several independent ThreadSafeQueues to
+// reduce lock contention, trading strict FIFO order for throughput.
+//
+// Ordering is relaxed: items in the same shard are dequeued in the order
+// they were enqueued, but items in different shards may be dequeued in any
+// order relative to each other. Without a key function, consecutive items go
+// to different shards, so no ordering between them is guaranteed at all;
+// with WithShardKey, items with the same key share a shard and keep their
+// relative order.
+type ShardedQueue struct {
+	shards  []*ThreadSafeQueue
+	key     func(item interface{}) string // Routes items to shards; nil means round-robin.
+	enqNext atomic.Uint64                 // Round-robin position for Enqueue.
+	deqNext atomic.Uint64                 // Shard a Dequeue scans first, rotated to spread consumers.
+	closed  atomic.Bool                   // Set by Close.
+
+	mu      sync.Mutex   // Serializes consumers that found every shard empty.
+	cond    *sync.Cond   // Consumers waiting for an item in any shard, tied to mu.
+	waiting atomic.Int32 // Consumers in the wait loop; producers skip the wakeup when zero.
+}
+
+// ShardOption configures a ShardedQueue at construction time.
+type ShardOption func(*ShardedQueue)
+
+// WithShardKey routes every item to a shard chosen by hashing key(item), so
+// items with the same key are dequeued in the order they were enqueued.
+func WithShardKey(key func(item interface{}) string) ShardOption {
+	return func(s *ShardedQueue) {
+		s.key = key
+	}
+}
+
+// NewShardedQueue creates a queue made of the given number of shards. It
+// panics if shards is not positive.
+func NewShardedQueue(shards int, opts ...ShardOption) *ShardedQueue {
+	if shards <= 0 {
+		panic("threadsafequeue: a sharded queue needs at least one shard")
+	}
+	s := &ShardedQueue{shards: make([]*ThreadSafeQueue, shards)}
+	for i := range s.shards {
+		s.shards[i] = NewThreadSafeQueue()
+	}
+	s.cond = sync.NewCond(&s.mu)
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Enqueue adds an item to one of the shards and wakes a waiting Dequeue, if
+// any. Items enqueued after Close are discarded.
+// This method is safe for concurrent use.
+func (s *ShardedQueue) Enqueue(item interface{}) {
+	var i uint64
+	if s.key != nil {
+		i = uint64(hashKey(s.key(item)))
+	} else {
+		i = s.enqNext.Add(1)
+	}
+	s.shards[i%uint64(len(s.shards))].Enqueue(item)
+
+	// A consumer registers in waiting before it scans the shards, so either
+	// its scan finds the item added above or this load sees it and wakes it.
+	if s.waiting.Load() > 0 {
+		s.mu.Lock()
+		s.cond.Signal()
+		s.mu.Unlock()
+	}
+}
+
+// Dequeue removes and returns an item from a non-empty shard. If every shard
+// is empty, it blocks until an item is enqueued or the queue is closed. The
+// boolean value is false only once the queue is closed and drained.
+// This method is safe for concurrent use.
+func (s *ShardedQueue) Dequeue() (interface{}, bool) {
+	item, err := s.DequeueContext(context.Background())
+	return item, err == nil
+}
+
+// DequeueContext is like Dequeue but gives up when ctx is done. It returns
+// ctx.Err() on cancellation and ErrClosed once the queue has been closed and
+// drained.
+// This method is safe for concurrent use.
+func (s *ShardedQueue) DequeueContext(ctx context.Context) (interface{}, error) {
+	if item, ok := s.TryDequeue(); ok {
+		return item, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stop := watchContext(ctx, s.cond)
+	defer stop()
+	s.waiting.Add(1)
+	defer s.waiting.Add(-1)
+	for {
+		if item, ok := s.TryDequeue(); ok {
+			return item, nil
+		}
+		if s.closed.Load() {
+			return nil, ErrClosed
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		s.cond.Wait()
+	}
+}
+
+// TryDequeue removes and returns an item from a non-empty shard without
+// blocking. The boolean value is false if every shard is empty.
+// This method is safe for concurrent use.
+func (s *ShardedQueue) TryDequeue() (interface{}, bool) {
+	n := uint64(len(s.shards))
+	start := s.deqNext.Add(1)
+	for i := uint64(0); i < n; i++ {
+		if item, ok := s.shards[(start+i)%n].TryDequeue(); ok {
+			return item, true
+		}
+	}
+	return nil, false
+}
+
+// Close closes every shard. Items already queued can still be dequeued; once
+// they are gone, blocked and future Dequeue calls return false.
+// This method is safe for concurrent use.
+func (s *ShardedQueue) Close() {
+	for _, q := range s.shards {
+		q.Close()
+	}
+	s.mu.Lock()
+	s.closed.Store(true)
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
+
+// Size returns the number of items in all shards. The shards are counted one
+// at a time, so under concurrent use the total is approximate.
+// This method is safe for concurrent use.
+func (s *ShardedQueue) Size() int {
+	size := 0
+	for _, q := range s.shards {
+		size += q.Size()
+	}
+	return size
+}
+
+// IsEmpty checks if every shard is empty.
+// This method is safe for concurrent use.
+func (s *ShardedQueue) IsEmpty() bool {
+	return s.Size() == 0
+}
+
+// Shards returns the number of shards.
+func (s *ShardedQueue) Shards() int {
+	return len(s.shards)
+}
@@ -0,0 +1,165 @@
+package threadsafequeue
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test that every item enqueued on a sharded queue is dequeued exactly once
+func TestShardedQueue(t *testing.T) {
+	q := NewShardedQueue(4)
+	for i := 0; i < 100; i++ {
+		q.Enqueue(i)
+	}
+	if q.Size() != 100 {
+		t.Errorf("Expected size to be 100, got %d", q.Size())
+	}
+	seen := make(map[interface{}]bool)
+	for i := 0; i < 100; i++ {
+		item, ok := q.TryDequeue()
+		if !ok {
+			t.Fatalf("Expected item %d to be available", i)
+		}
+		if seen[item] {
+			t.Fatalf("Item %v dequeued twice", item)
+		}
+		seen[item] = true
+	}
+	if !q.IsEmpty() {
+		t.Error("Expected the queue to be empty")
+	}
+}
+
+// Test that items with the same key keep their order
+func TestShardedQueueKey(t *testing.T) {
+	q := NewShardedQueue(8, WithShardKey(func(item interface{}) string {
+		return item.([2]string)[0]
+	}))
+	for i := 0; i < 50; i++ {
+		for _, k := range []string{"a", "b", "c"} {
+			q.Enqueue([2]string{k, fmt.Sprint(i)})
+		}
+	}
+	next := map[string]int{}
+	for i := 0; i < 150; i++ {
+		item, _ := q.Dequeue()
+		v := item.([2]string)
+		if v[1] != fmt.Sprint(next[v[0]]) {
+			t.Fatalf("Key %s: expected item %d, got %s", v[0], next[v[0]], v[1])
+		}
+		next[v[0]]++
+	}
+}
+
+// Test that Dequeue blocks while every shard is empty and wakes on Enqueue
+func TestShardedQueueBlocks(t *testing.T) {
+	q := NewShardedQueue(4)
+	result := make(chan interface{}, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			item, _ := q.Dequeue()
+			result <- item
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	if len(result) != 0 {
+		t.Fatal("Expected every Dequeue to block")
+	}
+	for i := 0; i < 3; i++ {
+		q.Enqueue(i)
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-result:
+		case <-time.After(time.Second):
+			t.Fatal("Expected every blocked Dequeue to wake")
+		}
+	}
+}
+
+// Test that Close releases consumers once every shard is drained
+func TestShardedQueueClose(t *testing.T) {
+	q := NewShardedQueue(4)
+	q.Enqueue(1)
+	done := make(chan bool)
+	go func() {
+		q.Dequeue()
+		_, ok := q.Dequeue()
+		done <- ok
+	}()
+	time.Sleep(100 * time.Millisecond)
+	q.Close()
+	if ok := <-done; ok {
+		t.Error("Expected Dequeue on a closed, drained queue to return false")
+	}
+}
+
+// Test that concurrent producers and consumers deliver every item
+func TestShardedQueueConcurrent(t *testing.T) {
+	q := NewShardedQueue(4)
+	const producers, perProducer = 8, 2000
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				q.Enqueue(p*perProducer + i)
+			}
+		}(p)
+	}
+	go func() {
+		wg.Wait()
+		q.Close()
+	}()
+
+	var mu sync.Mutex
+	count := 0
+	var consumers sync.WaitGroup
+	for c := 0; c < 8; c++ {
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			for {
+				if _, ok := q.Dequeue(); !ok {
+					return
+				}
+				mu.Lock()
+				count++
+				mu.Unlock()
+			}
+		}()
+	}
+	consumers.Wait()
+	if count != producers*perProducer {
+		t.Errorf("Expected %d items, got %d", producers*perProducer, count)
+	}
+}
+
+// Benchmark parallel enqueue and dequeue on a single-lock and a sharded queue
+func BenchmarkSharded(b *testing.B) {
+	var item interface{} = struct{}{}
+	for _, bc := range []struct {
+		name string
+		q    interface {
+			Enqueue(interface{})
+			Dequeue() (interface{}, bool)
+		}
+	}{
+		{"SingleLock", NewThreadSafeQueue()},
+		{"Sharded8", NewShardedQueue(8)},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetParallelism(4)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					bc.q.Enqueue(item)
+					bc.q.Dequeue()
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package threadsafequeue
+
+import (
+	"errors"
+	"math/rand"
+)
+
+// ErrShed is returned by EnqueueContext and TryEnqueue when WithLoadShedding
+// dropped the item.
+var ErrShed = errors.New("threadsafequeue: item shed under load")
+
+// WithLoadShedding makes the queue drop some of the items enqueued while it
+// holds more than threshold items, to degrade gracefully under overload
+// rather than fall over. Each item arriving above the threshold is dropped
+// with a probability that rises linearly from zero at the threshold to
+// maxDropProbability at the capacity, or, for an unbounded queue, at twice
+// the threshold, and stays there beyond. Shedding comes before the overflow
+// policy, which handles the items kept as usual.
+//
+// A shed item is counted as enqueued and dropped, in Stats.Shed too, logged
+// and passed to the hooks of WithDropHook like an item dropped by the
+// overflow policy, with LoadShedding as the policy. EnqueueContext and
+// TryEnqueue return ErrShed for it. Items added at the front, by
+// EnqueueFront and Requeue, are never shed. WithRand sets the source of the
+// random draws.
+func WithLoadShedding(threshold int, maxDropProbability float64) Option {
+	if threshold < 1 {
+		panic("threadsafequeue: WithLoadShedding needs a positive threshold")
+	}
+	if !(maxDropProbability > 0 && maxDropProbability <= 1) {
+		panic("threadsafequeue: WithLoadShedding needs a drop probability in (0, 1]")
+	}
+	return func(q *ThreadSafeQueue) {
+		q.shedAt = threshold
+		q.shedMax = maxDropProbability
+	}
+}
+
+// WithRand makes the queue draw the random numbers of WithLoadShedding, and
+// of the jitter of WithRetry, from rnd, which returns numbers in [0, 1) like
+// rand.Float64, instead of from package math/rand. It is called under the
+// queue's lock, so it need not be safe for concurrent use; tests can pass a
+// seeded rand.New(...).Float64 or a fixed sequence to make shedding
+// deterministic.
+func WithRand(rnd func() float64) Option {
+	return func(q *ThreadSafeQueue) {
+		q.rand = rnd
+	}
+}
+
+// random returns a number in [0, 1) drawn as WithRand sets. The caller must
+// hold q.mu exclusively.
+func (q *ThreadSafeQueue) random() float64 {
+	if q.rand == nil {
+		return rand.Float64()
+	}
+	return q.rand()
+}
+
+// shedPolicy names load shedding in log records.
+const shedPolicy = "LoadShedding"
+
+// shedProbability returns the probability that an item arriving now is
+// shed. The caller must hold q.mu.
+func (q *ThreadSafeQueue) shedProbability() float64 {
+	over := q.len() - q.shedAt
+	if over <= 0 {
+		return 0
+	}
+	limit := 2 * q.shedAt
+	if q.capacity > 0 {
+		limit = q.capacity
+	}
+	if span := limit - q.shedAt; over < span {
+		return q.shedMax * float64(over) / float64(span)
+	}
+	return q.shedMax
+}
+
+// shed drops an arriving item, with what was to be kept beside it, if load
+// shedding calls for it, and reports whether it did. The caller must hold
+// q.mu exclusively.
+func (q *ThreadSafeQueue) shed(item interface{}, x extra) bool {
+	if q.shedAt == 0 || q.closed {
+		return false
+	}
+	p := q.shedProbability()
+	if p == 0 {
+		return false
+	}
+	if q.random() >= p {
+		return false
+	}
+	q.enqueued++
+	q.shedCount++
+	q.tagDropped(x.tag, true)
+	q.drop(item, shedPolicy)
+	return true
+}
@@ -0,0 +1,101 @@
+package threadsafequeue
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// fixedRand returns a WithRand source that always draws r
+func fixedRand(r float64) func() float64 {
+	return func() float64 { return r }
+}
+
+// Test that the drop probability ramps from the threshold to the capacity,
+// or to twice the threshold for an unbounded queue
+func TestShedProbability(t *testing.T) {
+	for _, c := range []struct {
+		capacity, size int
+		want           float64
+	}{
+		{0, 10, 0}, {0, 15, 0.25}, {0, 20, 0.5}, {0, 40, 0.5},
+		{30, 5, 0}, {30, 20, 0.25}, {30, 29, 0.475},
+	} {
+		q := NewThreadSafeQueue(WithCapacity(c.capacity), WithLoadShedding(10, 0.5))
+		for i := 0; i < c.size; i++ {
+			q.items.pushBack(i)
+		}
+		if got := q.shedProbability(); math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("Expected a probability of %v at %d of %d, got %v", c.want, c.size, c.capacity, got)
+		}
+	}
+}
+
+// Test that shed items are reported as dropped and to the producer
+func TestLoadShedding(t *testing.T) {
+	var dropped []interface{}
+	q := NewThreadSafeQueue(WithLoadShedding(2, 1), WithRand(fixedRand(0.4)),
+		WithDropHook(func(item interface{}, size int) { dropped = append(dropped, item) }))
+	for i := 0; i < 3; i++ {
+		if err := q.TryEnqueue(i); err != nil {
+			t.Fatalf("Expected item %d to be kept, got %v", i, err)
+		}
+	}
+	// At 3 items, halfway from 2 to 4, the probability is 0.5 > 0.4.
+	if err := q.EnqueueContext(context.Background(), 3); !errors.Is(err, ErrShed) {
+		t.Errorf("Expected EnqueueContext to return ErrShed, got %v", err)
+	}
+	if err := q.TryEnqueue(4); !errors.Is(err, ErrShed) {
+		t.Errorf("Expected TryEnqueue to return ErrShed, got %v", err)
+	}
+	q.Enqueue(5)
+	q.EnqueueFront(6) // Never shed.
+	s := q.Stats()
+	if s.Size != 4 || s.Enqueued != 7 || s.Dropped != 3 || s.Shed != 3 {
+		t.Errorf("Expected 4 items, 7 enqueued, 3 dropped and 3 shed, got %+v", s)
+	}
+	if len(dropped) != 3 || dropped[0] != 3 || dropped[2] != 5 {
+		t.Errorf("Expected the drop hook to see 3, 4 and 5, got %v", dropped)
+	}
+}
+
+// Test that the share of items shed follows the probability
+func TestLoadSheddingRate(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	q := NewThreadSafeQueue(WithCapacity(200), WithLoadShedding(100, 0.8), WithRand(rnd.Float64))
+	for i := 0; i < 150; i++ {
+		q.Enqueue(i) // Fills past the threshold, shedding some.
+	}
+	for q.Size() < 150 {
+		q.Enqueue(0)
+	}
+	base := q.Stats().Shed
+	const n = 10000
+	for i := 0; i < n; i++ {
+		if q.TryEnqueue(i) == nil {
+			q.TryDequeue() // Stays at 150 items, where p is 0.4.
+		}
+	}
+	if share := float64(q.Stats().Shed-base) / n; math.Abs(share-0.4) > 0.03 {
+		t.Errorf("Expected about 40%% of the items to be shed, got %.1f%%", share*100)
+	}
+}
+
+// Test that WithLoadShedding rejects invalid settings
+func TestLoadSheddingInvalid(t *testing.T) {
+	for _, c := range []struct {
+		threshold int
+		p         float64
+	}{{0, 0.5}, {10, 0}, {10, 1.5}, {10, math.NaN()}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected a panic for threshold %d and probability %v", c.threshold, c.p)
+				}
+			}()
+			WithLoadShedding(c.threshold, c.p)
+		}()
+	}
+}
@@ -0,0 +1,173 @@
+package threadsafequeue
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// WithSnapshotErrorHandler makes the queue call fn with the error of every
+// snapshot started by StartSnapshots that fails to be written. fn is called
+// from the snapshot goroutine, which carries on and tries again at the next
+// interval.
+func WithSnapshotErrorHandler(fn func(err error)) Option {
+	return func(q *ThreadSafeQueue) {
+		q.snapshotErr = fn
+	}
+}
+
+// StartSnapshots writes the items in the queue to the file at path now, and
+// again every interval from a goroutine of its own, in the format of Save
+// with each item encoded by codec. Each snapshot is written to a temporary
+// file in the same directory, synced to disk and renamed over path, so
+// that path always holds a complete snapshot, the previous one if a write
+// fails. Intervals in which no item was stored or removed are skipped.
+//
+// It returns the error of the first snapshot, in which case no goroutine is
+// started. Later failures are logged and passed to the handler set by
+// WithSnapshotErrorHandler. Calling stop ends the snapshots and waits for
+// the goroutine to exit. Closing the queue ends them too, after a last
+// snapshot of the items left in it.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) StartSnapshots(path string, every time.Duration, codec Codec) (stop func(), err error) {
+	if every <= 0 {
+		return nil, errors.New("threadsafequeue: StartSnapshots needs a positive interval")
+	}
+	items, version := q.snapshot()
+	if err := writeSnapshot(path, items, codec); err != nil {
+		return nil, err
+	}
+	q.lock()
+	done := q.done()
+	q.unlock()
+	quit := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		timer := q.clock.NewTimer(every)
+		defer timer.Stop()
+		for {
+			select {
+			case <-quit:
+				select {
+				case <-done: // Closed too; take the last snapshot.
+					q.saveSnapshot(path, codec, version)
+				default:
+				}
+				return
+			case <-done:
+				q.saveSnapshot(path, codec, version)
+				return
+			case <-timer.C():
+				version = q.saveSnapshot(path, codec, version)
+				timer.Reset(every)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(quit) })
+		<-exited
+	}, nil
+}
+
+// RestoreSnapshot returns a new queue, created with opts, holding the items
+// of the snapshot written at path by StartSnapshots, read back with codec.
+// A bounded queue must have room for them all unless its overflow policy
+// drops items. If there is no snapshot, the error wraps fs.ErrNotExist.
+func RestoreSnapshot(path string, codec Codec, opts ...Option) (*ThreadSafeQueue, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	q := NewThreadSafeQueue(opts...)
+	if err := q.Load(f, codec); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// saveSnapshot writes a snapshot to path unless the queue is unchanged since
+// version, and returns the version of the queue written, or last if none
+// was.
+func (q *ThreadSafeQueue) saveSnapshot(path string, codec Codec, last uint64) uint64 {
+	items, version := q.snapshot()
+	if version == last {
+		return last
+	}
+	if err := writeSnapshot(path, items, codec); err != nil {
+		if q.logger != nil {
+			q.log(logEvent{level: slog.LevelError, msg: "snapshot failed", size: len(items), attrs: []slog.Attr{
+				slog.String(LogKeyError, err.Error()),
+			}})
+		}
+		if q.snapshotErr != nil {
+			q.snapshotErr(err)
+		}
+		return last // Try again at the next interval.
+	}
+	return version
+}
+
+// snapshot returns the items in the queue and a version that changes
+// whenever an item is stored or removed.
+func (q *ThreadSafeQueue) snapshot() ([]interface{}, uint64) {
+	q.rlock()
+	defer q.mu.RUnlock()
+	return q.liveItems(), q.enqueued + q.dequeued + q.dropped
+}
+
+// done returns a channel closed by Close. The caller must hold q.mu
+// exclusively.
+func (q *ThreadSafeQueue) done() <-chan struct{} {
+	if q.doneChan == nil {
+		q.doneChan = make(chan struct{})
+		if q.closed {
+			close(q.doneChan)
+		}
+	}
+	return q.doneChan
+}
+
+// writeSnapshot writes items to a temporary file next to path and renames
+// it over path once it is safely on disk.
+func writeSnapshot(path string, items []interface{}, codec Codec) (err error) {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".*"+walTempExt)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if err = save(f, items, codec); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// syncDir makes a rename in dir durable where the system allows syncing a
+// directory, and does nothing elsewhere.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
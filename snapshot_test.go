@@ -0,0 +1,158 @@
+package threadsafequeue
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// intCodec is a Codec for int items that counts its encodes and can be made
+// to fail
+type intCodec struct {
+	encodes atomic.Int64
+	fail    atomic.Bool
+}
+
+func (c *intCodec) Encode(w io.Writer, item interface{}) error {
+	if c.fail.Load() {
+		return errors.New("disk on fire")
+	}
+	c.encodes.Add(1)
+	return encodeInt(item, w)
+}
+
+func (c *intCodec) Decode(r io.Reader) (interface{}, error) {
+	return decodeInt(r)
+}
+
+// awaitSnapshot waits until the snapshot at path holds want
+func awaitSnapshot(t *testing.T, path string, want []interface{}) {
+	t.Helper()
+	var got []interface{}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		q, err := RestoreSnapshot(path, &intCodec{})
+		if err != nil {
+			t.Fatalf("Expected the snapshot to restore, got %v", err)
+		}
+		if got = q.ToSlice(); reflect.DeepEqual(got, want) {
+			return
+		}
+	}
+	t.Fatalf("Expected the snapshot to hold %v, got %v", want, got)
+}
+
+// Test that StartSnapshots writes the queue at once and again as it changes
+func TestStartSnapshots(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.snap")
+	q := NewThreadSafeQueue()
+	q.EnqueueBatch(1, 2)
+	codec := &intCodec{}
+	stop, err := q.StartSnapshots(path, 10*time.Millisecond, codec)
+	if err != nil {
+		t.Fatalf("Expected StartSnapshots to succeed, got %v", err)
+	}
+	defer stop()
+	awaitSnapshot(t, path, []interface{}{1, 2})
+
+	q.Dequeue()
+	q.Enqueue(3)
+	awaitSnapshot(t, path, []interface{}{2, 3})
+
+	encodes := codec.encodes.Load()
+	time.Sleep(50 * time.Millisecond)
+	if n := codec.encodes.Load(); n != encodes {
+		t.Errorf("Expected no snapshot of an unchanged queue, got %d more items encoded", n-encodes)
+	}
+	stop()
+	stop()
+}
+
+// Test that a failed snapshot leaves the previous one in place and is reported
+func TestSnapshotFailureKeepsPrevious(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "queue.snap")
+	errs := make(chan error, 10)
+	q := NewThreadSafeQueue(WithSnapshotErrorHandler(func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}))
+	q.EnqueueBatch(1, 2)
+	codec := &intCodec{}
+	stop, err := q.StartSnapshots(path, 10*time.Millisecond, codec)
+	if err != nil {
+		t.Fatalf("Expected StartSnapshots to succeed, got %v", err)
+	}
+	defer stop()
+
+	codec.fail.Store(true)
+	q.Enqueue(3)
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Error("Expected the handler to get an error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the failed snapshot to be reported")
+	}
+	restored, err := RestoreSnapshot(path, codec)
+	if err != nil {
+		t.Fatalf("Expected the previous snapshot to restore, got %v", err)
+	}
+	if got := restored.ToSlice(); !reflect.DeepEqual(got, []interface{}{1, 2}) {
+		t.Errorf("Expected the previous snapshot [1 2], got %v", got)
+	}
+
+	codec.fail.Store(false)
+	awaitSnapshot(t, path, []interface{}{1, 2, 3})
+	stop()
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected only the snapshot to be left, got %d files", len(entries))
+	}
+}
+
+// Test that closing the queue takes a last snapshot and ends the goroutine
+func TestSnapshotsStopOnClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.snap")
+	q := NewThreadSafeQueue()
+	stop, err := q.StartSnapshots(path, time.Hour, &intCodec{})
+	if err != nil {
+		t.Fatalf("Expected StartSnapshots to succeed, got %v", err)
+	}
+	q.Enqueue(7)
+	q.Close()
+	finished := make(chan struct{})
+	go func() {
+		stop()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the snapshot goroutine to exit on Close")
+	}
+	awaitSnapshot(t, path, []interface{}{7})
+}
+
+// Test that StartSnapshots and RestoreSnapshot report errors
+func TestSnapshotErrors(t *testing.T) {
+	dir := t.TempDir()
+	q := NewThreadSafeQueue()
+	if _, err := q.StartSnapshots(filepath.Join(dir, "missing", "queue.snap"), time.Second, &intCodec{}); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+	if _, err := q.StartSnapshots(filepath.Join(dir, "queue.snap"), 0, &intCodec{}); err == nil {
+		t.Error("Expected an error for a zero interval")
+	}
+	if _, err := RestoreSnapshot(filepath.Join(dir, "none.snap"), &intCodec{}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist restoring a missing snapshot, got %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package threadsafequeue
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// cacheLinePad separates fields written by different goroutines so they do
+// not share a cache line.
+type cacheLinePad [64]byte
+
+// SPSCQueue is a bounded FIFO queue for exactly one producer goroutine and
+// one consumer goroutine. The producer owns the tail index and the consumer
+// the head index, and each only reads the other's with an atomic load, so no
+// lock is involved.
+//
+// SPSCQueue is NOT safe for more than one goroutine calling Enqueue or
+// EnqueueWait, or more than one calling Dequeue or DequeueWait; doing so
+// corrupts the queue. Size and Cap may be called from anywhere.
+type SPSCQueue struct {
+	buf  []interface{} // Slots; the length is a power of two.
+	mask uint64        // len(buf) - 1.
+	cap  uint64        // Maximum number of items.
+
+	_              cacheLinePad
+	head           atomic.Uint64 // Position of the next item to dequeue; written by the consumer.
+	cachedTail     uint64        // Consumer's last view of tail.
+	consumerParked atomic.Bool   // Set while DequeueWait may park.
+	notEmpty       chan struct{} // Poked when an item is added to a parked consumer's queue.
+
+	_              cacheLinePad
+	tail           atomic.Uint64 // Position of the next free slot; written by the producer.
+	cachedHead     uint64        // Producer's last view of head.
+	producerParked atomic.Bool   // Set while EnqueueWait may park.
+	notFull        chan struct{} // Poked when an item is removed while the producer is parked.
+}
+
+// NewSPSCQueue creates a single-producer single-consumer queue holding up to
+// capacity items. It panics if capacity is not positive.
+func NewSPSCQueue(capacity int) *SPSCQueue {
+	if capacity <= 0 {
+		panic("threadsafequeue: SPSC queue capacity must be positive")
+	}
+	size := nextPowerOfTwo(capacity)
+	return &SPSCQueue{
+		buf:      make([]interface{}, size),
+		mask:     uint64(size - 1),
+		cap:      uint64(capacity),
+		notEmpty: make(chan struct{}, 1),
+		notFull:  make(chan struct{}, 1),
+	}
+}
+
+// Enqueue adds an item to the end of the queue and reports whether there was
+// room for it. It never blocks. Only the producer goroutine may call it.
+func (q *SPSCQueue) Enqueue(item interface{}) bool {
+	tail := q.tail.Load()
+	if tail-q.cachedHead == q.cap {
+		q.cachedHead = q.head.Load()
+		if tail-q.cachedHead == q.cap {
+			return false
+		}
+	}
+	q.buf[tail&q.mask] = item
+	q.tail.Store(tail + 1)
+	if q.consumerParked.Load() {
+		notify(q.notEmpty)
+	}
+	return true
+}
+
+// Dequeue removes and returns the item from the front of the queue. The
+// boolean value is false if the queue is empty. It never blocks. Only the
+// consumer goroutine may call it.
+func (q *SPSCQueue) Dequeue() (interface{}, bool) {
+	head := q.head.Load()
+	if head == q.cachedTail {
+		q.cachedTail = q.tail.Load()
+		if head == q.cachedTail {
+			return nil, false
+		}
+	}
+	i := head & q.mask
+	item := q.buf[i]
+	q.buf[i] = nil // Drop the reference so the item can be collected.
+	q.head.Store(head + 1)
+	if q.producerParked.Load() {
+		notify(q.notFull)
+	}
+	return item, true
+}
+
+// EnqueueWait is like Enqueue but parks the producer until there is room or
+// ctx is done, in which case it returns ctx.Err().
+func (q *SPSCQueue) EnqueueWait(ctx context.Context, item interface{}) error {
+	for {
+		if q.Enqueue(item) {
+			return nil
+		}
+		// Announce the park before checking again, so a Dequeue either sees
+		// the flag or frees the slot the second check finds.
+		q.producerParked.Store(true)
+		if q.Enqueue(item) {
+			q.producerParked.Store(false)
+			return nil
+		}
+		select {
+		case <-q.notFull:
+		case <-ctx.Done():
+			q.producerParked.Store(false)
+			return ctx.Err()
+		}
+		q.producerParked.Store(false)
+	}
+}
+
+// DequeueWait is like Dequeue but parks the consumer until an item arrives or
+// ctx is done, in which case it returns ctx.Err().
+func (q *SPSCQueue) DequeueWait(ctx context.Context) (interface{}, error) {
+	for {
+		if item, ok := q.Dequeue(); ok {
+			return item, nil
+		}
+		q.consumerParked.Store(true)
+		if item, ok := q.Dequeue(); ok {
+			q.consumerParked.Store(false)
+			return item, nil
+		}
+		select {
+		case <-q.notEmpty:
+		case <-ctx.Done():
+			q.consumerParked.Store(false)
+			return nil, ctx.Err()
+		}
+		q.consumerParked.Store(false)
+	}
+}
+
+// Size returns the number of items in the queue. It may be called from any
+// goroutine; the result is a snapshot that concurrent operations can change.
+func (q *SPSCQueue) Size() int {
+	head := q.head.Load()
+	return int(q.tail.Load() - head)
+}
+
+// Cap returns the maximum number of items the queue holds.
+func (q *SPSCQueue) Cap() int {
+	return int(q.cap)
+}
@@ -0,0 +1,114 @@
+package threadsafequeue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Test that the SPSC queue preserves order and reports full and empty
+func TestSPSCQueue(t *testing.T) {
+	q := NewSPSCQueue(3)
+	if q.Cap() != 3 {
+		t.Errorf("Expected capacity to be 3, got %d", q.Cap())
+	}
+	for i := 0; i < 3; i++ {
+		if !q.Enqueue(i) {
+			t.Fatalf("Expected Enqueue(%d) to succeed", i)
+		}
+	}
+	if q.Enqueue(3) {
+		t.Error("Expected Enqueue on a full queue to fail")
+	}
+	if q.Size() != 3 {
+		t.Errorf("Expected size to be 3, got %d", q.Size())
+	}
+	for i := 0; i < 3; i++ {
+		if item, ok := q.Dequeue(); !ok || item != i {
+			t.Fatalf("Expected to dequeue %d, got %v", i, item)
+		}
+	}
+	if _, ok := q.Dequeue(); ok {
+		t.Error("Expected Dequeue on an empty queue to fail")
+	}
+}
+
+// Test that one producer and one consumer exchange items in order, parking
+// when the queue is full or empty
+func TestSPSCQueueWait(t *testing.T) {
+	q := NewSPSCQueue(8)
+	const n = 100000
+	ctx := context.Background()
+	go func() {
+		for i := 0; i < n; i++ {
+			if err := q.EnqueueWait(ctx, i); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < n; i++ {
+		item, err := q.DequeueWait(ctx)
+		if err != nil || item != i {
+			t.Fatalf("Expected to dequeue %d, got %v (%v)", i, item, err)
+		}
+	}
+}
+
+// Test that the blocking wrappers give up when their context is done
+func TestSPSCQueueWaitCancel(t *testing.T) {
+	q := NewSPSCQueue(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := q.DequeueWait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+	q.Enqueue(1)
+	if err := q.EnqueueWait(ctx, 2); err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+}
+
+// Benchmark one producer and one consumer on the SPSC queue, the mutex queue
+// and a buffered channel
+func BenchmarkSPSC(b *testing.B) {
+	const capacity = 1024
+	var item interface{} = struct{}{}
+	b.Run("SPSC", func(b *testing.B) {
+		q := NewSPSCQueue(capacity)
+		ctx := context.Background()
+		b.ReportAllocs()
+		go func() {
+			for i := 0; i < b.N; i++ {
+				q.EnqueueWait(ctx, item)
+			}
+		}()
+		for i := 0; i < b.N; i++ {
+			q.DequeueWait(ctx)
+		}
+	})
+	b.Run("Mutex", func(b *testing.B) {
+		q := NewThreadSafeQueue(WithCapacity(capacity))
+		b.ReportAllocs()
+		go func() {
+			for i := 0; i < b.N; i++ {
+				q.Enqueue(item)
+			}
+		}()
+		for i := 0; i < b.N; i++ {
+			q.Dequeue()
+		}
+	})
+	b.Run("Channel", func(b *testing.B) {
+		ch := make(chan interface{}, capacity)
+		b.ReportAllocs()
+		go func() {
+			for i := 0; i < b.N; i++ {
+				ch <- item
+			}
+		}()
+		for i := 0; i < b.N; i++ {
+			<-ch
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package threadsafequeue
+
+import (
+	"context"
+	"sync"
+)
+
+// ThreadSafeStack represents a LIFO (last-in-first-out) data structure that
+// supports safe concurrent access. It mirrors ThreadSafeQueue: items are kept
+// in a slice, and Pop calls blocked on an empty stack park on the same kind
+// of wait list as the queue's Dequeue calls, so they are served in the order
+// they started waiting, each pushed item going straight to the Pop that has
+// waited longest.
+type ThreadSafeStack struct {
+	items  []interface{} // Internal slice to hold the stack items; the top is the last element.
+	mu     sync.Mutex    // Mutex to protect concurrent access to the items slice.
+	waitq  waitList      // Pop calls parked on the empty stack, longest-waiting first.
+	closed bool          // Set by Close; no further items are accepted.
+}
+
+// NewThreadSafeStack initializes and returns a new instance of ThreadSafeStack.
+// It is safe to be used concurrently.
+func NewThreadSafeStack() *ThreadSafeStack {
+	return &ThreadSafeStack{}
+}
+
+// Push adds an item to the top of the stack. The provided item can be of any type.
+// If there are any waiting Pop calls, it hands the item to the one that has
+// waited longest. Items pushed after Close are discarded.
+// This method is safe for concurrent use.
+func (s *ThreadSafeStack) Push(item interface{}) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	// Pop only parks on an empty stack, and every push serves a parked Pop
+	// first, so the stack stays empty while anyone is waiting.
+	if w := handOff(&s.waitq, item); w != nil {
+		s.mu.Unlock()
+		release(w)
+		return
+	}
+	s.items = append(s.items, item)
+	s.mu.Unlock()
+}
+
+// Pop removes and returns the item from the top of the stack.
+// If the stack is empty, this call will block until an item is pushed or
+// the stack is closed.
+// The boolean value is false only when the stack has been closed and all
+// remaining items have been popped.
+// This method is safe for concurrent use.
+func (s *ThreadSafeStack) Pop() (interface{}, bool) {
+	item, err := s.PopContext(context.Background())
+	return item, err == nil
+}
+
+// PopContext is like Pop but gives up when ctx is done. It returns
+// ctx.Err() on cancellation and ErrClosed once the stack has been closed and
+// drained.
+// This method is safe for concurrent use.
+func (s *ThreadSafeStack) PopContext(ctx context.Context) (interface{}, error) {
+	s.mu.Lock()
+	if item, ok := s.pop(); ok || s.closed {
+		s.mu.Unlock()
+		if !ok {
+			return nil, ErrClosed
+		}
+		return item, nil
+	}
+	if err := ctx.Err(); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	return parkOn(ctx, &s.mu, &s.waitq)
+}
+
+// TryPop removes and returns the item from the top of the stack without
+// blocking. The boolean value is false if the stack is empty.
+// This method is safe for concurrent use.
+func (s *ThreadSafeStack) TryPop() (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pop()
+}
+
+// pop removes the top item. The caller must hold s.mu.
+func (s *ThreadSafeStack) pop() (interface{}, bool) {
+	n := len(s.items)
+	if n == 0 {
+		return nil, false
+	}
+	item := s.items[n-1]
+	s.items[n-1] = nil // Drop the reference so the item can be collected.
+	s.items = s.items[:n-1]
+	return item, true
+}
+
+// Peek returns the item at the top of the stack without removing it.
+// The boolean value is false if the stack is empty.
+// This method is safe for concurrent use.
+func (s *ThreadSafeStack) Peek() (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.items) == 0 {
+		return nil, false
+	}
+	return s.items[len(s.items)-1], true
+}
+
+// Close marks the stack as closed. Items already on the stack can still be
+// popped; once they are gone, all blocked and future Pop calls return
+// immediately with a false boolean. Items pushed after Close are discarded.
+// Calling Close more than once has no effect.
+// This method is safe for concurrent use.
+func (s *ThreadSafeStack) Close() {
+	s.mu.Lock()
+	s.closed = true
+	w := s.waitq.popAll()
+	s.mu.Unlock()
+	release(w) // Every parked Pop leaves empty-handed.
+}
+
+// IsEmpty returns true if the stack has no items, and false otherwise.
+// This method is safe for concurrent use.
+func (s *ThreadSafeStack) IsEmpty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.items) == 0
+}
+
+// Size returns the number of items currently on the stack.
+// This method is safe for concurrent use.
+func (s *ThreadSafeStack) Size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.items)
+}
@@ -0,0 +1,214 @@
+package threadsafequeue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test that NewThreadSafeStack returns an empty, non-nil stack
+func TestNewThreadSafeStack(t *testing.T) {
+	s := NewThreadSafeStack()
+	if s == nil {
+		t.Fatal("Expected new stack to be non-nil")
+	}
+
+	if !s.IsEmpty() {
+		t.Error("New stack should be empty")
+	}
+}
+
+// Test that items are popped in LIFO order
+func TestStackOrdering(t *testing.T) {
+	s := NewThreadSafeStack()
+	for i := 0; i < 10; i++ {
+		s.Push(i)
+	}
+
+	if s.Size() != 10 {
+		t.Errorf("Expected size to be 10, got %d", s.Size())
+	}
+
+	for i := 9; i >= 0; i-- {
+		item, ok := s.Pop()
+		if !ok || item != i {
+			t.Errorf("Expected to pop %d, got %v", i, item)
+		}
+	}
+
+	if !s.IsEmpty() {
+		t.Error("Stack should be empty after popping every item")
+	}
+}
+
+// Test that Peek returns the top item without removing it
+func TestStackPeek(t *testing.T) {
+	s := NewThreadSafeStack()
+	if _, ok := s.Peek(); ok {
+		t.Error("Peek on an empty stack should fail")
+	}
+
+	s.Push(1)
+	s.Push(2)
+
+	item, ok := s.Peek()
+	if !ok || item != 2 {
+		t.Errorf("Expected to peek 2, got %v", item)
+	}
+	if s.Size() != 2 {
+		t.Errorf("Peek should not change the size, got %d", s.Size())
+	}
+}
+
+// Test that TryPop does not block on an empty stack
+func TestStackTryPop(t *testing.T) {
+	s := NewThreadSafeStack()
+	if _, ok := s.TryPop(); ok {
+		t.Error("TryPop on an empty stack should fail")
+	}
+
+	s.Push(42)
+	item, ok := s.TryPop()
+	if !ok || item != 42 {
+		t.Errorf("Expected to pop 42, got %v", item)
+	}
+}
+
+// Test that Pop blocks until an item is pushed
+func TestStackPopWait(t *testing.T) {
+	s := NewThreadSafeStack()
+	done := make(chan interface{})
+
+	go func() {
+		item, _ := s.Pop()
+		done <- item
+	}()
+
+	// Allow some time for the Pop goroutine to start and block
+	time.Sleep(100 * time.Millisecond)
+	s.Push(42)
+
+	select {
+	case item := <-done:
+		if item != 42 {
+			t.Errorf("Expected to pop 42, got %v", item)
+		}
+	case <-time.After(time.Second):
+		t.Error("Pop was not woken by Push")
+	}
+}
+
+// Test concurrent pushes and pops
+func TestStackConcurrentOperations(t *testing.T) {
+	s := NewThreadSafeStack()
+	const count = 1000
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < count; i++ {
+			s.Push(i)
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < count; i++ {
+			if _, ok := s.Pop(); !ok {
+				t.Errorf("Pop failed on iteration %d", i)
+			}
+		}
+	}()
+
+	wg.Wait()
+
+	if s.Size() != 0 {
+		t.Errorf("Expected stack size to be 0, got %d", s.Size())
+	}
+}
+
+// Test that Close releases every blocked Pop and drains remaining items first
+func TestStackClose(t *testing.T) {
+	s := NewThreadSafeStack()
+	const waiters = 3
+	var wg sync.WaitGroup
+
+	for i := 0; i < waiters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := s.Pop(); ok {
+				t.Error("Pop should fail on a closed, empty stack")
+			}
+		}()
+	}
+
+	// Allow some time for the Pop goroutines to start and block
+	time.Sleep(100 * time.Millisecond)
+	s.Close()
+	wg.Wait()
+
+	closed := NewThreadSafeStack()
+	closed.Push(1)
+	closed.Close()
+	closed.Push(2)
+
+	if item, ok := closed.Pop(); !ok || item != 1 {
+		t.Errorf("Expected to pop 1 after close, got %v", item)
+	}
+	if _, ok := closed.Pop(); ok {
+		t.Error("Pop should fail once the closed stack is drained")
+	}
+}
+
+// Test that PopContext gives up when its context is cancelled
+func TestStackPopContext(t *testing.T) {
+	s := NewThreadSafeStack()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := s.PopContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	s.Push(42)
+	item, err := s.PopContext(context.Background())
+	if err != nil || item != 42 {
+		t.Errorf("Expected to pop 42, got %v (%v)", item, err)
+	}
+
+	s.Close()
+	if _, err := s.PopContext(context.Background()); err != ErrClosed {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+}
+
+// Test that parked Pop calls are served in the order they started waiting
+func TestStackWaitOrderEqualsServeOrder(t *testing.T) {
+	s := NewThreadSafeStack()
+	const consumers = 8
+	type served struct{ consumer, item int }
+	results := make(chan served, consumers)
+
+	for c := 0; c < consumers; c++ {
+		c := c
+		go func() {
+			item, _ := s.Pop()
+			results <- served{c, item.(int)}
+		}()
+		awaitListed(t, &s.mu, &s.waitq, c+1)
+	}
+
+	for i := 0; i < consumers; i++ {
+		s.Push(i)
+		r := <-results
+		if r.consumer != i || r.item != i {
+			t.Errorf("Expected consumer %d to get item %d, consumer %d got %d", i, i, r.consumer, r.item)
+		}
+	}
+	if !s.IsEmpty() {
+		t.Error("Items handed to parked Pop calls should not stay on the stack")
+	}
+}
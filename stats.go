@@ -0,0 +1,143 @@
+package threadsafequeue
+
+import "time"
+
+// Stats is a point-in-time snapshot of a queue's state, taken in a single
+// critical section so that its fields are consistent with each other.
+//
+// The totals count since the queue was created and are maintained by every
+// operation under the queue's lock, so they are exact: at any snapshot,
+// Enqueued - Dequeued - Dropped == Size.
+type Stats struct {
+	Size             int // Number of items in the queue.
+	Capacity         int // Bound set by WithCapacity, or as adjusted by WithAdaptiveCapacity, or zero if the queue is unbounded.
+	StorageCapacity  int // Number of items the backing array holds before it must grow.
+	WaitingConsumers int // Dequeue calls waiting for an item.
+	WaitingProducers int // Enqueue calls waiting for room in a full bounded queue.
+
+	Enqueued  uint64 // Items accepted, including those DropNewest discarded on arrival.
+	Dequeued  uint64 // Items removed by consumers, including by Drain.
+	Dropped   uint64 // Items discarded by the overflow policy, as reported by Dropped.
+	Rejected  uint64 // Items refused: enqueued after Close, turned away by TryEnqueue or a tag quota, or abandoned by EnqueueContext.
+	HighWater int    // Largest number of items the queue has held at once.
+
+	Latency LatencyStats // How long items waited, with WithLatencyTracking; otherwise zero.
+
+	WALBytes int64 // Disk space taken by the write-ahead log, with WithWAL; otherwise zero.
+
+	Shed          uint64        // Items dropped by WithLoadShedding, also counted in Dropped.
+	QuotaRejected uint64        // Items refused by WithTagQuota, also counted in Rejected.
+	Throttled     time.Duration // Time producers spent waiting for WithEnqueueRateLimit, added up.
+	WorkerPanics  uint64        // Handler panics recovered by RunWorkers.
+	Canceled      uint64        // Items removed by Ticket.Cancel, also counted in Dropped.
+
+	AbandonedWorkers int // Handlers of RunWorkers still running past WithHandlerTimeout, each holding a goroutine.
+	Workers          int // Workers of RunWorkers running, as WithAutoscale adjusts them; abandoned ones are not counted.
+}
+
+// Stats returns a snapshot of the queue's state.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) Stats() Stats {
+	q.rlock()
+	defer q.mu.RUnlock()
+	return Stats{
+		Size:             q.len(),
+		Capacity:         q.capacity,
+		StorageCapacity:  q.items.cap(),
+		WaitingConsumers: q.waitingConsumers(),
+		WaitingProducers: q.putq.len,
+		Enqueued:         q.enqueued,
+		Dequeued:         q.dequeued,
+		Dropped:          q.dropped,
+		Rejected:         q.rejected,
+		HighWater:        q.highWater,
+		Latency:          q.waits.snapshot(),
+		WALBytes:         q.walBytes(),
+		Shed:             q.shedCount,
+		QuotaRejected:    q.quotaRejected,
+		Throttled:        q.throttled,
+		WorkerPanics:     q.workerPanics,
+		Canceled:         q.canceled,
+		AbandonedWorkers: q.abandoned,
+		Workers:          q.workers,
+	}
+}
+
+// StatsDelta returns the queue's state like Stats, except that the totals
+// and Latency count only what happened since the previous call to
+// StatsDelta, or since the queue was created for the first call, and
+// HighWater is the largest size over the same interval. Each call starts a
+// new interval, so it suits a single reporting goroutine computing per
+// interval rates; the cumulative totals remain available from Stats. The
+// snapshot and the start of the next interval happen in one critical
+// section, so every operation is counted in exactly one interval.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) StatsDelta() Stats {
+	q.lock()
+	defer q.unlock()
+	base := q.deltaBase
+	s := Stats{
+		Size:             q.len(),
+		Capacity:         q.capacity,
+		StorageCapacity:  q.items.cap(),
+		WaitingConsumers: q.waitingConsumers(),
+		WaitingProducers: q.putq.len,
+		Enqueued:         q.enqueued - base.Enqueued,
+		Dequeued:         q.dequeued - base.Dequeued,
+		Dropped:          q.dropped - base.Dropped,
+		Rejected:         q.rejected - base.Rejected,
+		HighWater:        q.peak,
+		Latency:          q.deltaWaits.snapshot(),
+		WALBytes:         q.walBytes(),
+		Shed:             q.shedCount - base.Shed,
+		QuotaRejected:    q.quotaRejected - base.QuotaRejected,
+		Throttled:        q.throttled - base.Throttled,
+		WorkerPanics:     q.workerPanics - base.WorkerPanics,
+		Canceled:         q.canceled - base.Canceled,
+		AbandonedWorkers: q.abandoned,
+		Workers:          q.workers,
+	}
+	q.deltaBase = Stats{Enqueued: q.enqueued, Dequeued: q.dequeued, Dropped: q.dropped, Rejected: q.rejected, Shed: q.shedCount,
+		QuotaRejected: q.quotaRejected, Throttled: q.throttled, WorkerPanics: q.workerPanics, Canceled: q.canceled}
+	q.peak = q.len()
+	q.deltaWaits = latencyStats{}
+	return s
+}
+
+// Workers returns the number of workers running in the RunWorkers calls on
+// the queue, which changes as WithAutoscale grows and shrinks a pool.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) Workers() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.workers
+}
+
+// WaitingConsumers returns the number of goroutines currently waiting in
+// Dequeue, DequeueContext or a batch dequeue for an item, whatever their
+// wait strategy. The count is exact: it changes only under the queue's lock,
+// as consumers start and stop waiting.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) WaitingConsumers() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.waitingConsumers()
+}
+
+// WaitingProducers returns the number of goroutines currently blocked in
+// Enqueue, EnqueueContext, EnqueueFront or EnqueueBatch waiting for room in a
+// full bounded queue. It is always zero for unbounded queues and for the
+// DropNewest and DropOldest policies, which never block. Like
+// WaitingConsumers, the count is exact.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) WaitingProducers() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.putq.len
+}
+
+// waitingConsumers counts parked consumers and those polling under the
+// WaitSpinThenBlock and WaitSleep strategies. The caller must hold q.mu.
+func (q *ThreadSafeQueue) waitingConsumers() int {
+	return q.waitq.len + q.polling
+}
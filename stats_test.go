@@ -0,0 +1,277 @@
+package threadsafequeue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test that Stats reports the queue's size and capacities
+func TestStats(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(100))
+	for i := 0; i < 20; i++ {
+		q.Enqueue(i)
+	}
+
+	s := q.Stats()
+	if s.Size != 20 {
+		t.Errorf("Expected size to be 20, got %d", s.Size)
+	}
+	if s.Capacity != 100 {
+		t.Errorf("Expected capacity to be 100, got %d", s.Capacity)
+	}
+	if s.StorageCapacity < 20 {
+		t.Errorf("Expected storage capacity of at least 20, got %d", s.StorageCapacity)
+	}
+}
+
+// Test that WaitingConsumers counts blocked consumers exactly, whatever the
+// wait strategy, and drops by one for each item delivered
+func TestWaitingConsumers(t *testing.T) {
+	for _, s := range waitStrategies {
+		t.Run(s.String(), func(t *testing.T) {
+			q := NewThreadSafeQueue(WithWaitStrategy(s))
+			const k, j = 5, 3
+			done := make(chan struct{}, k)
+			for i := 0; i < k; i++ {
+				go func() {
+					q.Dequeue()
+					done <- struct{}{}
+				}()
+			}
+			awaitCount(t, q.WaitingConsumers, k)
+			if n := q.Stats().WaitingConsumers; n != k {
+				t.Errorf("Expected Stats to report %d waiting consumers, got %d", k, n)
+			}
+
+			for i := 0; i < j; i++ {
+				q.Enqueue(i)
+			}
+			for i := 0; i < j; i++ {
+				<-done
+			}
+			awaitCount(t, q.WaitingConsumers, k-j)
+
+			q.Close()
+			awaitCount(t, q.WaitingConsumers, 0)
+		})
+	}
+}
+
+// Test that WaitingProducers counts producers blocked on a full queue
+func TestWaitingProducers(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(1))
+	q.Enqueue(0)
+	for i := 1; i <= 3; i++ {
+		go q.Enqueue(i)
+	}
+	awaitCount(t, q.WaitingProducers, 3)
+	if n := q.Stats().WaitingProducers; n != 3 {
+		t.Errorf("Expected Stats to report 3 waiting producers, got %d", n)
+	}
+
+	q.Dequeue()
+	awaitCount(t, q.WaitingProducers, 2)
+	q.Close()
+	awaitCount(t, q.WaitingProducers, 0)
+
+	if n := NewThreadSafeQueue().WaitingProducers(); n != 0 {
+		t.Errorf("Expected no waiting producers on an unbounded queue, got %d", n)
+	}
+}
+
+// Test that the totals of Stats follow every path that adds, removes or
+// refuses items
+func TestStatsTotals(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(3), WithOverflowPolicy(DropOldest))
+	for i := 0; i < 5; i++ {
+		q.Enqueue(i) // The last two evict the oldest items.
+	}
+	q.EnqueueBatch(5, 6)
+	q.TryDequeue()
+	q.DequeueBatch(1)
+	q.Drain()
+	q.Close()
+	q.Enqueue(7)
+	q.TryEnqueue(8)
+	q.EnqueueBatch(9, 10)
+
+	s := q.Stats()
+	if s.Enqueued != 7 || s.Dequeued != 3 || s.Dropped != 4 || s.Rejected != 4 {
+		t.Errorf("Expected 7 enqueued, 3 dequeued, 4 dropped and 4 rejected, got %d, %d, %d and %d", s.Enqueued, s.Dequeued, s.Dropped, s.Rejected)
+	}
+	if s.HighWater != 3 {
+		t.Errorf("Expected a high-water mark of 3, got %d", s.HighWater)
+	}
+
+	q = NewThreadSafeQueue(WithCapacity(1), WithOverflowPolicy(DropNewest))
+	q.Enqueue(1)
+	q.Enqueue(2) // Dropped on arrival.
+	if s := q.Stats(); s.Enqueued-s.Dequeued-s.Dropped != uint64(s.Size) {
+		t.Errorf("Expected totals to account for the size under DropNewest, got %+v", s)
+	}
+
+	q = NewThreadSafeQueue(WithCapacity(1))
+	q.Enqueue(1)
+	if q.TryEnqueue(2) != ErrFull {
+		t.Fatal("Expected TryEnqueue to find the queue full")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	q.EnqueueContext(ctx, 3)
+	if s := q.Stats(); s.Enqueued != 1 || s.Rejected != 2 {
+		t.Errorf("Expected 1 enqueued and 2 rejected, got %d and %d", s.Enqueued, s.Rejected)
+	}
+}
+
+// Test that the totals of Stats account for the size once concurrent
+// producers and consumers stop, whatever the mix of operations
+func TestStatsTotalsConcurrent(t *testing.T) {
+	for _, p := range []OverflowPolicy{Block, DropNewest, DropOldest} {
+		t.Run(p.String(), func(t *testing.T) {
+			q := NewThreadSafeQueue(WithCapacity(8), WithOverflowPolicy(p))
+			const producers, consumers, perGoroutine = 4, 4, 1000
+			var wg sync.WaitGroup
+			var offered atomic.Uint64
+			for g := 0; g < producers; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < perGoroutine; i++ {
+						switch i % 3 {
+						case 0:
+							q.Enqueue(i)
+						case 1:
+							q.TryEnqueue(i)
+						default:
+							q.EnqueueBatch(i, -i)
+							offered.Add(1)
+						}
+						offered.Add(1)
+					}
+				}(g)
+			}
+			var consumed sync.WaitGroup
+			for g := 0; g < consumers; g++ {
+				consumed.Add(1)
+				go func(g int) {
+					defer consumed.Done()
+					for i := 0; ; i++ {
+						if g == 0 && i%50 == 0 {
+							q.Drain()
+						}
+						if _, ok := q.Dequeue(); !ok {
+							return
+						}
+					}
+				}(g)
+			}
+			wg.Wait()
+			q.Close()
+			consumed.Wait()
+
+			s := q.Stats()
+			if s.Enqueued-s.Dequeued-s.Dropped != uint64(s.Size) {
+				t.Errorf("Expected enqueued - dequeued - dropped == size, got %d - %d - %d != %d", s.Enqueued, s.Dequeued, s.Dropped, s.Size)
+			}
+			if s.HighWater > 8 {
+				t.Errorf("Expected the high-water mark to stay within the capacity, got %d", s.HighWater)
+			}
+			if total := s.Enqueued + s.Rejected; total != offered.Load() {
+				t.Errorf("Expected the %d items offered to be enqueued or rejected, got %d", offered.Load(), total)
+			}
+		})
+	}
+}
+
+// awaitCount waits until count returns want, failing the test if it does
+// Test that StatsDelta counts what happened since the previous call
+func TestStatsDelta(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(3), WithOverflowPolicy(DropNewest))
+	q.EnqueueBatch(1, 2, 3, 4)
+	q.TryDequeue()
+	d := q.StatsDelta()
+	if d.Enqueued != 4 || d.Dequeued != 1 || d.Dropped != 1 || d.HighWater != 3 || d.Size != 2 {
+		t.Errorf("Expected the first interval to count everything so far, got %+v", d)
+	}
+
+	q.TryDequeue()
+	q.Close()
+	q.Enqueue(5)
+	d = q.StatsDelta()
+	if d.Enqueued != 0 || d.Dequeued != 1 || d.Dropped != 0 || d.Rejected != 1 || d.HighWater != 2 || d.Size != 1 {
+		t.Errorf("Expected the second interval to count only its own operations, got %+v", d)
+	}
+	if s := q.Stats(); s.Enqueued != 4 || s.Dequeued != 2 || s.HighWater != 3 {
+		t.Errorf("Expected the cumulative totals to be unaffected, got %+v", s)
+	}
+	if d = q.StatsDelta(); d.Enqueued != 0 || d.Dequeued != 0 || d.Rejected != 0 || d.HighWater != 1 {
+		t.Errorf("Expected an empty interval, got %+v", d)
+	}
+}
+
+// Test that intervals add up to the totals under concurrent traffic, with
+// no operation lost or counted twice at their boundaries
+func TestStatsDeltaConcurrent(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(16), WithOverflowPolicy(DropOldest), WithLatencyTracking(true))
+	var wg sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				q.Enqueue(i)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				q.TryDequeue()
+			}
+		}()
+	}
+	var sum Stats
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	add := func(d Stats) {
+		sum.Enqueued += d.Enqueued
+		sum.Dequeued += d.Dequeued
+		sum.Dropped += d.Dropped
+		sum.Latency.Count += d.Latency.Count
+	}
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		add(q.StatsDelta())
+	}
+	add(q.StatsDelta())
+
+	s := q.Stats()
+	if sum.Enqueued != s.Enqueued || sum.Dequeued != s.Dequeued || sum.Dropped != s.Dropped || sum.Latency.Count != s.Latency.Count {
+		t.Errorf("Expected the intervals to add up to %+v, got %+v", s, sum)
+	}
+}
+
+// not within a few seconds.
+func awaitCount(t *testing.T, count func() int, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		n := count()
+		if n == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a count of %d, got %d", want, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,144 @@
+package threadsafequeue
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// StuckReport describes the waiters that have been blocked on a queue for
+// longer than the threshold given to WithStuckWaiterHandler.
+type StuckReport struct {
+	Consumers int           // Dequeue calls blocked longer than the threshold.
+	Producers int           // Enqueue calls blocked on a full queue longer than the threshold.
+	Longest   time.Duration // How long the longest-blocked of them has been waiting.
+	// Stacks holds, for each stuck waiter, the stack at which it started
+	// waiting. It is only filled in builds with the race detector, where
+	// capturing a stack for every wait is an acceptable cost.
+	Stacks []string
+}
+
+// String summarizes the report in one line.
+func (r StuckReport) String() string {
+	return fmt.Sprintf("%d consumers and %d producers blocked, the longest for %v", r.Consumers, r.Producers, r.Longest)
+}
+
+// WithStuckWaiterHandler makes the queue call fn when goroutines have been
+// blocked on it for longer than threshold: consumers waiting for an item, or
+// producers waiting for room in a full bounded queue. fn is called from its
+// own goroutine, without the queue's lock held, and again every threshold
+// for as long as any waiter stays stuck.
+//
+// No goroutine runs while nobody is waiting: a timer is armed when the first
+// waiter blocks and stops once the last one is released. Consumers using the
+// WaitSleep strategy poll rather than block and are not watched.
+// It panics if threshold is not positive.
+func WithStuckWaiterHandler(threshold time.Duration, fn func(report StuckReport)) Option {
+	if threshold <= 0 {
+		panic("threadsafequeue: WithStuckWaiterHandler needs a positive threshold")
+	}
+	return func(q *ThreadSafeQueue) {
+		q.stuck = &stuckWatch{threshold: threshold, fn: fn}
+	}
+}
+
+// stuckWatch is the state behind WithStuckWaiterHandler, protected by the
+// queue's lock.
+type stuckWatch struct {
+	threshold time.Duration
+	fn        func(StuckReport)
+	timer     Timer // Created on first use and reused.
+	armed     bool  // The timer is due to fire.
+}
+
+// maxStuckStack bounds the frames recorded for a waiter.
+const maxStuckStack = 32
+
+// watchWaiter records when w started waiting and makes sure a check is due
+// if the queue has a stuck-waiter handler. The caller must hold q.mu.
+func (q *ThreadSafeQueue) watchWaiter(w *waiter) {
+	s := q.stuck
+	if s == nil {
+		return
+	}
+	w.since = q.clock.Now()
+	if raceEnabled {
+		if w.stack == nil {
+			w.stack = make([]uintptr, maxStuckStack)
+		}
+		w.stack = w.stack[:runtime.Callers(3, w.stack[:maxStuckStack])]
+	}
+	if !s.armed {
+		s.armed = true
+		if s.timer == nil {
+			s.timer = q.clock.AfterFunc(s.threshold, q.checkStuck)
+		} else {
+			s.timer.Reset(s.threshold)
+		}
+	}
+}
+
+// checkStuck runs when the stuck-waiter timer fires. It reports the waiters
+// blocked longer than the threshold and re-arms the timer for as long as
+// anyone is waiting.
+func (q *ThreadSafeQueue) checkStuck() {
+	q.lock()
+	s := q.stuck
+	now := q.clock.Now()
+	var report StuckReport
+	next := s.threshold // Re-check stuck waiters after another threshold.
+	scan := func(l *waitList) (stuck int) {
+		// Waiters are listed in the order they started waiting, so the
+		// stuck ones come first.
+		for w := l.head; w != nil; w = w.next {
+			waited := now.Sub(w.since)
+			if waited < s.threshold {
+				if d := s.threshold - waited; d < next {
+					next = d
+				}
+				break
+			}
+			stuck++
+			if waited > report.Longest {
+				report.Longest = waited
+			}
+			if raceEnabled {
+				report.Stacks = append(report.Stacks, formatStack(w.stack))
+			}
+		}
+		return stuck
+	}
+	report.Consumers = scan(&q.waitq)
+	report.Producers = scan(&q.putq)
+	s.armed = q.waitq.head != nil || q.putq.head != nil
+	if s.armed {
+		s.timer.Reset(next)
+	}
+	size := q.len()
+	q.unlock()
+	if report.Consumers+report.Producers > 0 {
+		if q.logger != nil {
+			q.log(logEvent{level: slog.LevelWarn, msg: "waiters stuck", size: size, attrs: []slog.Attr{
+				slog.Int(LogKeyConsumers, report.Consumers),
+				slog.Int(LogKeyProducers, report.Producers),
+				slog.Duration(LogKeyLongest, report.Longest),
+			}})
+		}
+		s.fn(report)
+	}
+}
+
+// formatStack renders program counters captured with runtime.Callers.
+func formatStack(pcs []uintptr) string {
+	var b strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			return b.String()
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package threadsafequeue
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that a consumer blocked past the threshold is reported, and that
+// reports stop once it is released
+func TestStuckConsumerReported(t *testing.T) {
+	reports := make(chan StuckReport, 16)
+	q := NewThreadSafeQueue(WithStuckWaiterHandler(20*time.Millisecond, func(r StuckReport) {
+		reports <- r
+	}))
+	go func() { q.Dequeue() }()
+
+	select {
+	case r := <-reports:
+		if r.Consumers != 1 || r.Producers != 0 {
+			t.Errorf("Expected 1 stuck consumer, got %v", r)
+		}
+		if r.Longest < 20*time.Millisecond {
+			t.Errorf("Expected the consumer to have waited at least 20ms, got %v", r.Longest)
+		}
+		if raceEnabled && (len(r.Stacks) != 1 || !strings.Contains(r.Stacks[0], "TestStuckConsumerReported")) {
+			t.Errorf("Expected the stack of the stuck consumer, got %q", r.Stacks)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a report for the stuck consumer")
+	}
+
+	q.Enqueue(1)
+	awaitCount(t, q.WaitingConsumers, 0)
+	for len(reports) > 0 {
+		<-reports // Reports sent before the release.
+	}
+	time.Sleep(60 * time.Millisecond)
+	if len(reports) != 0 {
+		t.Errorf("Expected no reports once nobody waits, got %v", <-reports)
+	}
+	q.mu.RLock()
+	armed := q.stuck.armed
+	q.mu.RUnlock()
+	if armed {
+		t.Error("Expected the timer to be disarmed once nobody waits")
+	}
+}
+
+// Test that producers blocked on a full queue are reported, and that waiters
+// younger than the threshold are not
+func TestStuckProducersReported(t *testing.T) {
+	reports := make(chan StuckReport, 16)
+	q := NewThreadSafeQueue(WithCapacity(1), WithStuckWaiterHandler(30*time.Millisecond, func(r StuckReport) {
+		reports <- r
+	}))
+	q.Enqueue(0)
+	go q.Enqueue(1)
+	go q.Enqueue(2)
+	awaitCount(t, q.WaitingProducers, 2)
+
+	select {
+	case r := <-reports:
+		if r.Producers != 2 || r.Consumers != 0 {
+			t.Errorf("Expected 2 stuck producers, got %v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a report for the stuck producers")
+	}
+	q.Close()
+}
+
+// Test that a waiter released before the threshold is never reported
+func TestStuckWaiterNotReportedBeforeThreshold(t *testing.T) {
+	reports := make(chan StuckReport, 1)
+	q := NewThreadSafeQueue(WithStuckWaiterHandler(50*time.Millisecond, func(r StuckReport) {
+		reports <- r
+	}))
+	done := make(chan struct{})
+	go func() {
+		q.Dequeue()
+		close(done)
+	}()
+	awaitCount(t, q.WaitingConsumers, 1)
+	q.Enqueue(1)
+	<-done
+
+	select {
+	case r := <-reports:
+		t.Errorf("Expected no report, got %v", r)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// Test that WithStuckWaiterHandler rejects a non-positive threshold
+func TestStuckWaiterHandlerInvalidThreshold(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected WithStuckWaiterHandler(0, ...) to panic")
+		}
+	}()
+	WithStuckWaiterHandler(0, func(StuckReport) {})
+}
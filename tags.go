@@ -0,0 +1,132 @@
+package threadsafequeue
+
+// TagOverflow is the tag under which WithTagStats counts the items of tags
+// beyond its limit.
+const TagOverflow = "(overflow)"
+
+// TagStats are the counters kept for one tag by WithTagStats.
+type TagStats struct {
+	Enqueued uint64 // Items enqueued with the tag, including those dropped on arrival by DropNewest.
+	Pending  int    // Items with the tag still in the queue.
+	Dropped  uint64 // Items with the tag discarded by the overflow policy.
+
+	QuotaRejected uint64 // Items with the tag refused by WithTagQuota.
+}
+
+// WithTagStats makes the queue count its items by the tag given to
+// EnqueueTagged, so that StatsByTag can tell who is filling it. Items
+// enqueued any other way count under the empty tag. At most maxTags
+// distinct tags are counted, the empty one included; the items of any
+// further tag count under TagOverflow, so that a producer inventing tags
+// cannot make the queue grow without bound. The queue keeps each item's tag
+// beside it, to count it out of Pending when it leaves. It panics if maxTags
+// is not positive.
+func WithTagStats(maxTags int) Option {
+	if maxTags <= 0 {
+		panic("threadsafequeue: WithTagStats needs a positive number of tags")
+	}
+	return func(q *ThreadSafeQueue) {
+		q.tags = &tagStats{max: maxTags, byTag: make(map[string]*TagStats)}
+	}
+}
+
+// EnqueueTagged is like Enqueue but counts the item under tag, such as the
+// name of its producer, in the queue's tag statistics, and holds it to the
+// tag's quota set by WithTagQuota. Without WithTagStats or WithTagQuota, the
+// tag is ignored. It returns ErrQuotaExceeded if the quota refused the item,
+// and otherwise what EnqueueContext would.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) EnqueueTagged(tag string, item interface{}) error {
+	q.mustValidate(item)
+	item = q.copyItem(item)
+	q.throttle(nil, 1)
+	r := q.startRegion(traceEnqueueRegion)
+	q.lock()
+	var err error
+	if q.quota != nil {
+		err = q.awaitQuota(tag, item)
+	}
+	if err == nil {
+		err = q.put(nil, item, extra{tag: tag}, false)
+		if q.quota != nil {
+			q.releaseQuota(tag)
+		}
+	}
+	q.unlock()
+	endRegion(r)
+	return err
+}
+
+// StatsByTag returns a snapshot of the counters kept by WithTagStats, by
+// tag, or nil if the queue keeps none.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) StatsByTag() map[string]TagStats {
+	q.rlock()
+	defer q.mu.RUnlock()
+	if q.tags == nil {
+		return nil
+	}
+	stats := make(map[string]TagStats, len(q.tags.byTag))
+	for tag, s := range q.tags.byTag {
+		stats[tag] = *s
+	}
+	return stats
+}
+
+// tagStats is the state behind WithTagStats, protected by the queue's lock.
+type tagStats struct {
+	max   int
+	byTag map[string]*TagStats
+}
+
+// lookup returns the tag items of tag count under, and its counters,
+// creating them if the limit allows.
+func (t *tagStats) lookup(tag string) (string, *TagStats) {
+	if s, ok := t.byTag[tag]; ok {
+		return tag, s
+	}
+	if len(t.byTag) >= t.max && tag != TagOverflow {
+		tag = TagOverflow
+		if s, ok := t.byTag[tag]; ok {
+			return tag, s
+		}
+	}
+	s := &TagStats{}
+	t.byTag[tag] = s
+	return tag, s
+}
+
+// tagAdded counts an item stored with tag and returns the tag to keep
+// beside it. The caller must hold q.mu.
+func (q *ThreadSafeQueue) tagAdded(tag string) string {
+	tag, s := q.tags.lookup(tag)
+	s.Enqueued++
+	s.Pending++
+	return tag
+}
+
+// tagDropped counts an item with tag discarded by the overflow policy;
+// arriving is true for one dropped on arrival, which was never stored. The
+// caller must hold q.mu.
+func (q *ThreadSafeQueue) tagDropped(tag string, arriving bool) {
+	if q.tags == nil {
+		return
+	}
+	_, s := q.tags.lookup(tag)
+	if arriving {
+		s.Enqueued++
+	}
+	s.Dropped++
+}
+
+// tagRemoved counts out of Pending an item leaving the queue, with the tag
+// kept beside it. The caller must hold q.mu.
+func (q *ThreadSafeQueue) tagRemoved(tag string) {
+	if q.tags == nil {
+		return
+	}
+	q.tags.byTag[tag].Pending--
+	if q.quota != nil {
+		q.quotaFreed()
+	}
+}
@@ -0,0 +1,111 @@
+package threadsafequeue
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// Test that items are counted by tag as they come, go and are dropped
+func TestStatsByTag(t *testing.T) {
+	q := NewThreadSafeQueue(WithTagStats(10), WithCapacity(3), WithOverflowPolicy(DropOldest))
+	q.EnqueueTagged("a", 1)
+	q.EnqueueTagged("b", 2)
+	q.Enqueue(3)
+	q.EnqueueTagged("b", 4) // Evicts 1, tagged a.
+	q.TryDequeue()          // 2, tagged b.
+
+	want := map[string]TagStats{
+		"a": {Enqueued: 1, Pending: 0, Dropped: 1},
+		"b": {Enqueued: 2, Pending: 1},
+		"":  {Enqueued: 1, Pending: 1},
+	}
+	if got := q.StatsByTag(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, but got %v", want, got)
+	}
+	q.Drain()
+	for tag, s := range q.StatsByTag() {
+		if s.Pending != 0 {
+			t.Errorf("Expected nothing pending for %q after Drain, but got %d", tag, s.Pending)
+		}
+	}
+}
+
+// Test that items dropped on arrival count as enqueued and dropped under
+// their tag
+func TestStatsByTagDropNewest(t *testing.T) {
+	q := NewThreadSafeQueue(WithTagStats(10), WithCapacity(1), WithOverflowPolicy(DropNewest))
+	q.EnqueueTagged("a", 1)
+	q.EnqueueTagged("b", 2)
+	q.TryEnqueue(3)
+	want := map[string]TagStats{
+		"a": {Enqueued: 1, Pending: 1},
+		"b": {Enqueued: 1, Dropped: 1},
+		"":  {Enqueued: 1, Dropped: 1},
+	}
+	if got := q.StatsByTag(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, but got %v", want, got)
+	}
+}
+
+// Test that tags beyond the limit count under TagOverflow
+func TestStatsByTagOverflow(t *testing.T) {
+	q := NewThreadSafeQueue(WithTagStats(2))
+	for _, tag := range []string{"a", "b", "c", "d", "a"} {
+		q.EnqueueTagged(tag, tag)
+	}
+	q.TryDequeue() // a
+	q.TryDequeue() // b
+	q.TryDequeue() // c, counted under TagOverflow.
+	want := map[string]TagStats{
+		"a":         {Enqueued: 2, Pending: 1},
+		"b":         {Enqueued: 1},
+		TagOverflow: {Enqueued: 2, Pending: 1},
+	}
+	if got := q.StatsByTag(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, but got %v", want, got)
+	}
+}
+
+// Test that blocked producers and parked consumers keep the counts right
+func TestStatsByTagConcurrent(t *testing.T) {
+	q := NewThreadSafeQueue(WithTagStats(4), WithCapacity(2), WithDebugChecks(true))
+	tags := []string{"a", "b", "c"}
+	const perTag = 200
+	var wg sync.WaitGroup
+	for _, tag := range tags {
+		wg.Add(1)
+		go func(tag string) {
+			defer wg.Done()
+			for i := 0; i < perTag; i++ {
+				q.EnqueueTagged(tag, i)
+			}
+		}(tag)
+	}
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < len(tags)*perTag; i++ {
+			q.Dequeue()
+		}
+		close(done)
+	}()
+	wg.Wait()
+	<-done
+	for _, tag := range tags {
+		if s := q.StatsByTag()[tag]; s != (TagStats{Enqueued: perTag}) {
+			t.Errorf("Expected %d enqueued and none pending for %q, but got %+v", perTag, tag, s)
+		}
+	}
+}
+
+// Test that a queue without tag statistics keeps none
+func TestStatsByTagOff(t *testing.T) {
+	q := NewThreadSafeQueue()
+	q.EnqueueTagged("a", 1)
+	if got := q.StatsByTag(); got != nil {
+		t.Errorf("Expected no tag statistics, but got %v", got)
+	}
+	if q.extras.cap() != 0 {
+		t.Error("Expected no tags to be kept beside the items")
+	}
+}
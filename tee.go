@@ -0,0 +1,115 @@
+package threadsafequeue
+
+import "time"
+
+// TeeOp identifies the operation a TeeEvent records.
+type TeeOp int
+
+const (
+	// TeeEnqueued records an item entering the primary queue.
+	TeeEnqueued TeeOp = iota
+	// TeeDequeued records a consumer taking an item from the primary queue.
+	TeeDequeued
+)
+
+// String returns the name of the operation.
+func (op TeeOp) String() string {
+	switch op {
+	case TeeEnqueued:
+		return "Enqueued"
+	case TeeDequeued:
+		return "Dequeued"
+	default:
+		return "TeeOp(unknown)"
+	}
+}
+
+// TeeEvent is what a mirror queue receives when dequeues are mirrored as
+// well as enqueues. Time is taken inside the primary queue's critical
+// section, so the difference between the Enqueued and Dequeued events of an
+// item is its time in the primary queue.
+type TeeEvent struct {
+	Op   TeeOp
+	Item interface{}
+	Time time.Time
+}
+
+// TeeOption configures mirroring set up by Tee.
+type TeeOption func(*tee)
+
+// MirrorDequeues makes the mirror receive a TeeEvent for every enqueue and
+// every dequeue on the primary queue, instead of the bare enqueued items.
+func MirrorDequeues() TeeOption {
+	return func(t *tee) {
+		t.events = true
+	}
+}
+
+// tee is the mirroring state of a queue. It is guarded by the primary
+// queue's mutex.
+type tee struct {
+	mirror  *ThreadSafeQueue // Queue receiving copies.
+	events  bool             // Send TeeEvent values, including dequeues.
+	dropped *uint64          // Primary queue's counter of copies the mirror could not take.
+	clock   Clock            // Primary queue's clock, which timestamps events.
+}
+
+// Tee starts duplicating every item enqueued on q onto mirror, replacing any
+// previous mirror; a nil mirror stops mirroring. The mirror never affects q:
+// copies are offered with TryEnqueue, and a copy that does not fit in a full
+// mirror is dropped and counted by TeeDropped. Consumers of q are unaware of
+// the mirror.
+//
+// Copies are made inside q's critical section, so the mirror sees items in
+// exactly the order q accepted them, and once Tee returns no further copies
+// reach a mirror it replaced. Because of this, mirrors must not form a
+// cycle, and Tee panics if mirror is q itself.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) Tee(mirror *ThreadSafeQueue, opts ...TeeOption) {
+	if mirror == q {
+		panic("threadsafequeue: queue cannot mirror itself")
+	}
+	q.lock()
+	defer q.unlock()
+	if mirror == nil {
+		q.tee = nil
+		return
+	}
+	t := &tee{mirror: mirror, dropped: &q.teeDropped, clock: q.clock}
+	for _, opt := range opts {
+		opt(t)
+	}
+	q.tee = t
+}
+
+// TeeDropped returns the number of copies dropped because a mirror set up by
+// Tee was full or closed.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) TeeDropped() uint64 {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.teeDropped
+}
+
+// enqueued mirrors an item entering the primary queue.
+func (t *tee) enqueued(item interface{}) {
+	if t.events {
+		t.offer(TeeEvent{Op: TeeEnqueued, Item: item, Time: t.clock.Now()})
+		return
+	}
+	t.offer(item)
+}
+
+// dequeued mirrors an item leaving the primary queue, if requested.
+func (t *tee) dequeued(item interface{}) {
+	if t.events {
+		t.offer(TeeEvent{Op: TeeDequeued, Item: item, Time: t.clock.Now()})
+	}
+}
+
+// offer hands a copy to the mirror without ever blocking.
+func (t *tee) offer(v interface{}) {
+	if t.mirror.TryEnqueue(v) != nil {
+		*t.dropped++
+	}
+}
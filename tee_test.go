@@ -0,0 +1,120 @@
+package threadsafequeue
+
+import (
+	"sync"
+	"testing"
+)
+
+// Test that Tee mirrors enqueued items without affecting the primary queue
+func TestTee(t *testing.T) {
+	q := NewThreadSafeQueue()
+	mirror := NewThreadSafeQueue()
+	q.Tee(mirror)
+
+	q.Enqueue(1)
+	q.EnqueueFront(0)
+	if err := q.TryEnqueue(2); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []int{0, 1, 2} {
+		if item, ok := q.Dequeue(); !ok || item != expected {
+			t.Errorf("Expected primary to dequeue %d, got %v", expected, item)
+		}
+	}
+
+	// The mirror sees items in the order the primary accepted them.
+	for _, expected := range []int{1, 0, 2} {
+		if item, ok := mirror.TryDequeue(); !ok || item != expected {
+			t.Errorf("Expected mirror to dequeue %d, got %v", expected, item)
+		}
+	}
+	if !mirror.IsEmpty() {
+		t.Error("Dequeues should not be mirrored by default")
+	}
+}
+
+// Test that a full mirror drops copies instead of blocking the primary
+func TestTeeFullMirror(t *testing.T) {
+	q := NewThreadSafeQueue()
+	mirror := NewThreadSafeQueue(WithCapacity(2))
+	q.Tee(mirror)
+
+	for i := 0; i < 5; i++ {
+		q.Enqueue(i)
+	}
+
+	if q.Size() != 5 {
+		t.Errorf("Expected primary size to be 5, got %d", q.Size())
+	}
+	if mirror.Size() != 2 {
+		t.Errorf("Expected mirror size to be 2, got %d", mirror.Size())
+	}
+	if q.TeeDropped() != 3 {
+		t.Errorf("Expected 3 dropped copies, got %d", q.TeeDropped())
+	}
+}
+
+// Test that MirrorDequeues records both enqueue and dequeue events
+func TestTeeMirrorDequeues(t *testing.T) {
+	q := NewThreadSafeQueue()
+	mirror := NewThreadSafeQueue()
+	q.Tee(mirror, MirrorDequeues())
+
+	q.Enqueue("job")
+	q.Dequeue()
+
+	in, _ := mirror.TryDequeue()
+	out, _ := mirror.TryDequeue()
+	enq, ok1 := in.(TeeEvent)
+	deq, ok2 := out.(TeeEvent)
+	if !ok1 || !ok2 {
+		t.Fatalf("Expected TeeEvent values, got %T and %T", in, out)
+	}
+	if enq.Op != TeeEnqueued || deq.Op != TeeDequeued || enq.Item != "job" || deq.Item != "job" {
+		t.Errorf("Unexpected events %+v and %+v", enq, deq)
+	}
+	if deq.Time.Before(enq.Time) {
+		t.Error("Dequeue event should not precede the enqueue event")
+	}
+}
+
+// Test that detaching the mirror mid-stream is race-free
+func TestTeeDetach(t *testing.T) {
+	q := NewThreadSafeQueue()
+	mirror := NewThreadSafeQueue()
+	q.Tee(mirror)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				q.Enqueue(j)
+			}
+		}()
+	}
+
+	q.Tee(nil)
+	n := mirror.Size()
+	wg.Wait()
+
+	if mirror.Size() != n {
+		t.Errorf("Mirror received %d copies after detach", mirror.Size()-n)
+	}
+	if q.Size() != 4000 {
+		t.Errorf("Expected primary size to be 4000, got %d", q.Size())
+	}
+}
+
+// Test that a queue cannot mirror itself
+func TestTeeSelf(t *testing.T) {
+	q := NewThreadSafeQueue()
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected Tee(q) on q to panic")
+		}
+	}()
+	q.Tee(q)
+}
@@ -0,0 +1,207 @@
+package threadsafequeue
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrCanceled completes the Future of an item removed from the queue by
+// Cancel.
+var ErrCanceled = errors.New("threadsafequeue: item canceled")
+
+// cancelPolicy is the policy logged for an item removed by Cancel.
+const cancelPolicy = "Cancel"
+
+// Ticket is the handle of an item enqueued by EnqueueCancelable or Submit,
+// with which the producer can take it back before a consumer does, say once
+// the user who asked for the job is gone.
+type Ticket struct {
+	q      *ThreadSafeQueue
+	future *Future     // Completed with ErrCanceled by Cancel, for an item enqueued by Submit.
+	queued bool        // Set while the item is in the queue, protected by q.mu.
+	item   interface{} // The item, while queued.
+	pos    int         // While queued, the item is the (pos-q.extrasBase)-th from the front, protected by q.mu.
+}
+
+// EnqueueCancelable is like Enqueue but returns a Ticket whose Cancel takes
+// the item back out of the queue, as long as no consumer has taken it yet.
+// Like EnqueueWithMeta, it makes the queue keep what goes beside its items
+// from the first call on. An item the queue refuses or drops gets a ticket
+// too, whose Cancel reports false.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) EnqueueCancelable(item interface{}) *Ticket {
+	q.mustValidate(item)
+	item = q.copyItem(item)
+	t := &Ticket{q: q}
+	q.throttle(nil, 1)
+	r := q.startRegion(traceEnqueueRegion)
+	q.lock()
+	q.startExtras()
+	q.ticketsOn = true
+	q.put(nil, item, extra{ticket: t}, false)
+	q.unlock()
+	endRegion(r)
+	return t
+}
+
+// Cancel removes the item from the queue and returns true if it is still
+// queued. Otherwise, if a consumer took it, or it was dropped, drained or
+// cancelled before, it returns false and does nothing. Cancel and the
+// consumers decide under the queue's lock, so an item is either taken or
+// cancelled, never both. A removed item is counted in Stats.Canceled, and
+// as dropped, with the policy "Cancel" in logs; the future of an item
+// enqueued by Submit completes with ErrCanceled.
+//
+// Cancel takes constant time: it marks the item's slot as cancelled where
+// it stands, and consumers skip such slots as they reach the front, so no
+// other item moves. The slot, and the item with it, is only released then,
+// or when the queue is drained. The removal is recorded in the log of
+// WithWAL and sent to the followers of StartReplication, which remove the
+// same item.
+// This method is safe for concurrent use.
+func (t *Ticket) Cancel() bool {
+	q := t.q
+	q.lock()
+	defer q.unlock()
+	if !t.queued {
+		return false
+	}
+	q.cancel(t.pos-q.extrasBase, t.item)
+	return true
+}
+
+// Cancel is Ticket.Cancel for the item of the future: it removes the item
+// from the queue and completes the future with ErrCanceled, if no consumer
+// has taken the item yet, and reports whether it did.
+// This method is safe for concurrent use.
+func (f *Future) Cancel() bool {
+	if f.ticket == nil {
+		return false // Refused by the queue on arrival.
+	}
+	return f.ticket.Cancel()
+}
+
+// cancel marks the slot of item, the i-th from the front, as cancelled on
+// behalf of Cancel, or of a follower mirroring it, and accounts for the item
+// as removed. The caller must hold q.mu exclusively, and the queue must keep
+// extras.
+func (q *ThreadSafeQueue) cancel(i int, item interface{}) {
+	x := q.extras.at(i)
+	if x.ticket != nil {
+		x.ticket.queued, x.ticket.item = false, nil
+	}
+	x.future.complete(nil, ErrCanceled)
+	q.tagDropped(x.tag, false)
+	q.tagRemoved(x.tag)
+	q.extras.set(i, extra{canceled: true})
+	if q.tracing {
+		q.tasks.at(i).End()
+		q.tasks.set(i, nil)
+	}
+	if q.latency {
+		q.stamps.set(i, time.Time{})
+	}
+	q.tombs++
+	q.size.Add(-1)
+	q.sizeChanged()
+	q.canceled++
+	q.drop(item, cancelPolicy)
+	q.taskDone() // No consumer will take it.
+	if q.wal != nil {
+		q.walCanceled(i)
+	}
+	if q.replicas != nil {
+		q.replCanceled(i)
+	}
+	q.skipCanceled()
+}
+
+// skipCanceled releases the slots of cancelled items at the front of the
+// queue, so that the front item is always one still queued. Each slot is
+// released once, so this costs constant amortized time. The caller must
+// hold q.mu.
+func (q *ThreadSafeQueue) skipCanceled() {
+	for q.tombs > 0 {
+		if x, _ := q.extras.front(); !x.canceled {
+			return
+		}
+		q.items.popFront()
+		if q.tracing {
+			q.tasks.popFront()
+		}
+		if q.latency {
+			q.stamps.popFront()
+		}
+		q.extras.popFront()
+		q.extrasBase++
+		q.tombs--
+	}
+}
+
+// purgeCanceled releases the slots of all cancelled items, moving the other
+// items up, for the copies of the queue made by CompactWAL and
+// StartReplication, which leave them out, to line up with the queue again.
+// The purge is recorded in the log of WithWAL and sent to the followers of
+// StartReplication, which do the same, so that the positions in later
+// cancel records hold for them too. It takes time proportional to the size
+// of the queue, like the copies. The caller must hold q.mu exclusively.
+func (q *ThreadSafeQueue) purgeCanceled() {
+	if q.tombs == 0 {
+		return
+	}
+	items := q.items.appendTo(make([]interface{}, 0, q.items.len()))
+	extras := q.extras.appendTo(make([]extra, 0, len(items)))
+	tasks := q.tasks.appendTo(nil)
+	stamps := q.stamps.appendTo(nil)
+	q.items.clear()
+	q.extras.clear()
+	q.tasks.clear()
+	q.stamps.clear()
+	for i, x := range extras {
+		if x.canceled {
+			continue
+		}
+		if x.ticket != nil {
+			x.ticket.pos = q.extrasBase + q.extras.len()
+		}
+		q.items.pushBack(items[i])
+		q.extras.pushBack(x)
+		if q.tracing {
+			q.tasks.pushBack(tasks[i])
+		}
+		if q.latency {
+			q.stamps.pushBack(stamps[i])
+		}
+	}
+	q.tombs = 0
+	q.maybeShrink()
+	if q.wal != nil {
+		q.walPurged()
+	}
+	if q.replicas != nil {
+		q.replPurged()
+	}
+}
+
+// liveItems returns a copy of the items in the queue, front first, leaving
+// out the slots of cancelled items. The caller must hold q.mu.
+func (q *ThreadSafeQueue) liveItems() []interface{} {
+	items := q.items.appendTo(make([]interface{}, 0, q.items.len()))
+	if q.tombs == 0 {
+		return items
+	}
+	live := items[:0]
+	for i, item := range items {
+		if !q.extras.at(i).canceled {
+			live = append(live, item)
+		}
+	}
+	clear(items[len(live):])
+	return live
+}
+
+// len returns the number of items in the queue, leaving out the slots of
+// cancelled items. The caller must hold q.mu.
+func (q *ThreadSafeQueue) len() int {
+	return q.items.len() - q.tombs
+}
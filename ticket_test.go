@@ -0,0 +1,154 @@
+package threadsafequeue
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// Test that Cancel removes a queued item once, keeps the order of the
+// others and counts it, and is too late once a consumer took the item
+func TestTicketCancel(t *testing.T) {
+	q := NewThreadSafeQueue(WithLatencyTracking(true), WithDebugChecks(true))
+	q.Enqueue("plain") // Queued before the queue kept tickets.
+	var tickets []*Ticket
+	for i := 0; i < 5; i++ {
+		tickets = append(tickets, q.EnqueueCancelable(i))
+	}
+	if !tickets[2].Cancel() {
+		t.Fatal("Expected to cancel a queued item")
+	}
+	if tickets[2].Cancel() {
+		t.Error("Expected a second Cancel to report false")
+	}
+	if s := q.Stats(); s.Canceled != 1 || s.Dropped != 1 || s.Size != 5 {
+		t.Errorf("Expected 1 cancelled and dropped with 5 left, got %+v", s)
+	}
+	if item, _ := q.Dequeue(); item != "plain" {
+		t.Errorf("Expected the plain item first, got %v", item)
+	}
+	if item, _ := q.Dequeue(); item != 0 {
+		t.Errorf("Expected 0, got %v", item)
+	}
+	if tickets[0].Cancel() {
+		t.Error("Expected Cancel of a dequeued item to report false")
+	}
+	q.Close()
+	var got []interface{}
+	for item, ok := q.Dequeue(); ok; item, ok = q.Dequeue() {
+		got = append(got, item)
+	}
+	if len(got) != 3 || got[0] != 1 || got[1] != 3 || got[2] != 4 {
+		t.Errorf("Expected 1, 3, 4, got %v", got)
+	}
+}
+
+// Test that cancelling a submitted item completes its future with
+// ErrCanceled, and that a refused item cannot be cancelled
+func TestFutureCancel(t *testing.T) {
+	q := NewThreadSafeQueue(WithRejectNil(true))
+	f := q.Submit(1)
+	if !f.Cancel() {
+		t.Fatal("Expected to cancel a queued item")
+	}
+	if _, err := f.Wait(context.Background()); err != ErrCanceled {
+		t.Errorf("Expected ErrCanceled, got %v", err)
+	}
+	if q.Submit(nil).Cancel() {
+		t.Error("Expected Cancel of a refused item to report false")
+	}
+	q.Close()
+	if q.EnqueueCancelable(2).Cancel() {
+		t.Error("Expected Cancel of an item enqueued after Close to report false")
+	}
+}
+
+// Test that tickets keep finding their items while others are added at
+// either end, taken and cancelled from either side of them
+func TestTicketCancelPositions(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithChunkedStorage(4)}} {
+		q := NewThreadSafeQueue(append(opts, WithDebugChecks(true))...) // Checks every ticket after each operation.
+		rnd := rand.New(rand.NewSource(1))
+		tickets := make(map[int]*Ticket)
+		var want []int
+		for i := 0; i < 2000; i++ {
+			switch op := rnd.Intn(10); {
+			case op < 4:
+				tickets[i] = q.EnqueueCancelable(i)
+				want = append(want, i)
+			case op < 5:
+				q.EnqueueFront(-i)
+				want = append([]int{-i}, want...)
+			case op < 7 && len(want) > 0:
+				q.TryDequeue()
+				want = want[1:]
+			case len(want) > 0:
+				k := rnd.Intn(len(want))
+				ticket, ok := tickets[want[k]]
+				if !ok {
+					continue // Enqueued without a ticket.
+				}
+				if !ticket.Cancel() {
+					t.Fatalf("Expected to cancel item %d", want[k])
+				}
+				want = append(want[:k], want[k+1:]...)
+			}
+		}
+		got := q.ToSlice()
+		if len(got) != len(want) {
+			t.Fatalf("Expected %d items left, got %d", len(want), len(got))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("Expected %v, got %v", want, got)
+			}
+		}
+	}
+}
+
+// Test that when Cancel races with consumers, every item is either
+// delivered or cancelled, never both
+func TestTicketCancelRace(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithChunkedStorage(16)}} {
+		const total = 2000
+		q := NewThreadSafeQueue(opts...)
+		tickets := make([]*Ticket, total)
+		for i := range tickets {
+			tickets[i] = q.EnqueueCancelable(i)
+		}
+		delivered := make([]bool, total)
+		cancelled := make([]bool, total)
+		var wg sync.WaitGroup
+		for c := 0; c < 2; c++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for item, ok := q.Dequeue(); ok; item, ok = q.Dequeue() {
+					delivered[item.(int)] = true // Each item goes to one consumer.
+				}
+			}()
+		}
+		rnd := rand.New(rand.NewSource(1))
+		for _, i := range rnd.Perm(total)[:total/2] {
+			cancelled[i] = tickets[i].Cancel()
+		}
+		q.Close()
+		wg.Wait()
+		n := 0
+		for i := 0; i < total; i++ {
+			if delivered[i] && cancelled[i] {
+				t.Fatalf("Expected item %d delivered or cancelled, not both", i)
+			}
+			if delivered[i] || cancelled[i] {
+				n++
+			}
+		}
+		if n != total {
+			t.Errorf("Expected all %d items delivered or cancelled, got %d", total, n)
+		}
+		if s := q.Stats(); s.Dequeued+s.Canceled != total {
+			t.Errorf("Expected the stats to add up to %d, got %+v", total, s)
+		}
+	}
+}
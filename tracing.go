@@ -0,0 +1,84 @@
+package threadsafequeue
+
+import (
+	"context"
+	"runtime/trace"
+)
+
+// WithTracing makes the queue visible in execution traces collected with
+// runtime/trace and viewed with `go tool trace`. Enqueue and Dequeue calls
+// are wrapped in regions, time spent blocked waiting for an item or for room
+// is marked as a separate region, and each item gets a task that begins when
+// it is enqueued and ends when it is dequeued or discarded, so its time in
+// the queue shows up in the trace's user-defined tasks view.
+//
+// Tracing is off by default; a queue without it pays a single branch per
+// operation.
+func WithTracing(enabled bool) Option {
+	return func(q *ThreadSafeQueue) {
+		q.tracing = enabled
+	}
+}
+
+// Trace annotation names.
+const (
+	traceItemTask      = "threadsafequeue.item"
+	traceEnqueueRegion = "threadsafequeue.Enqueue"
+	traceDequeueRegion = "threadsafequeue.Dequeue"
+	traceWaitRegion    = "threadsafequeue.wait"
+)
+
+// startRegion starts a trace region if tracing is enabled. The result is nil
+// otherwise, which endRegion accepts.
+func (q *ThreadSafeQueue) startRegion(name string) *trace.Region {
+	if !q.tracing {
+		return nil
+	}
+	return trace.StartRegion(context.Background(), name)
+}
+
+// endRegion ends a region returned by startRegion.
+func endRegion(r *trace.Region) {
+	if r != nil {
+		r.End()
+	}
+}
+
+// traceAdded starts the task of an item just stored at the front or the
+// back of the queue. The caller must hold q.mu.
+func (q *ThreadSafeQueue) traceAdded(front bool) {
+	if !q.tracing {
+		return
+	}
+	_, task := trace.NewTask(context.Background(), traceItemTask)
+	if front {
+		q.tasks.pushFront(task)
+	} else {
+		q.tasks.pushBack(task)
+	}
+}
+
+// traceRemoved ends the task of the item just removed from the front of the
+// queue. The caller must hold q.mu.
+func (q *ThreadSafeQueue) traceRemoved() {
+	if !q.tracing {
+		return
+	}
+	if task, ok := q.tasks.popFront(); ok {
+		task.End()
+	}
+}
+
+// traceCleared ends the tasks of every item, apart from the nil left in the
+// slots of cancelled items, whose tasks Cancel ended. The caller must hold
+// q.mu.
+func (q *ThreadSafeQueue) traceCleared() {
+	if !q.tracing {
+		return
+	}
+	for task, ok := q.tasks.popFront(); ok; task, ok = q.tasks.popFront() {
+		if task != nil {
+			task.End()
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package threadsafequeue
+
+import (
+	"bytes"
+	"runtime/trace"
+	"strings"
+	"testing"
+)
+
+// Test that WithTracing emits item tasks and operation regions.
+func TestTracingAnnotations(t *testing.T) {
+	var buf bytes.Buffer
+	if err := trace.Start(&buf); err != nil {
+		t.Skipf("cannot start trace: %v", err)
+	}
+	q := NewThreadSafeQueue(WithTracing(true))
+	q.Enqueue(1)
+	q.Dequeue()
+	trace.Stop()
+
+	for _, name := range []string{traceItemTask, traceEnqueueRegion, traceDequeueRegion} {
+		if !strings.Contains(buf.String(), name) {
+			t.Errorf("Expected the trace to mention %q", name)
+		}
+	}
+}
+
+// Test that every item keeps its task as items are added and removed in
+// every way the queue supports.
+func TestTracingTasksFollowItems(t *testing.T) {
+	q := NewThreadSafeQueue(WithTracing(true), WithCapacity(3), WithOverflowPolicy(DropOldest))
+	check := func(step string) {
+		if q.tasks.len() != q.items.len() {
+			t.Errorf("After %s: Expected %d tasks, got %d", step, q.items.len(), q.tasks.len())
+		}
+	}
+
+	q.Enqueue(1)
+	q.EnqueueFront(0)
+	check("EnqueueFront")
+	q.EnqueueBatch(2, 3, 4)
+	check("EnqueueBatch with drops")
+	q.Dequeue()
+	check("Dequeue")
+	q.Drain()
+	check("Drain")
+	if q.tasks.len() != 0 {
+		t.Errorf("Expected no tasks after Drain, got %d", q.tasks.len())
+	}
+}
+
+// Test that a queue without tracing keeps no tasks.
+func TestTracingDisabled(t *testing.T) {
+	q := NewThreadSafeQueue()
+	q.Enqueue(1)
+	if q.tasks.len() != 0 {
+		t.Errorf("Expected no tasks without tracing, got %d", q.tasks.len())
+	}
+}
@@ -0,0 +1,173 @@
+package threadsafequeue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// TwoLockQueue is an unbounded FIFO queue with the same blocking semantics as
+// ThreadSafeQueue, built on Michael and Scott's two-lock algorithm: producers
+// take a tail lock and consumers a head lock, and a dummy node at the head
+// keeps the two ends apart, so producers and consumers only contend when
+// the queue is empty. It pays off with many producers and consumers running
+// in parallel; each Enqueue allocates a node, so on few cores the
+// single-lock queue is faster.
+//
+// It offers the basic queue operations only; use ThreadSafeQueue for bounds,
+// options and the other extensions.
+type TwoLockQueue struct {
+	headMu  sync.Mutex   // Serializes consumers.
+	head    *lockNode    // Dummy node; the front item is head.next.
+	cond    *sync.Cond   // Consumers waiting for an item, tied to headMu.
+	waiting atomic.Int32 // Consumers in the wait loop; producers skip the wakeup when zero.
+
+	tailMu sync.Mutex // Serializes producers.
+	tail   *lockNode  // Last node.
+
+	closed atomic.Bool  // Set by Close; no further items are accepted.
+	size   atomic.Int64 // Number of items.
+	nodes  sync.Pool    // Retired dummy nodes, reused by Enqueue.
+}
+
+// lockNode is a node of a TwoLockQueue. next is atomic because a producer
+// links a new node under the tail lock while a consumer may be reading the
+// same field under the head lock.
+type lockNode struct {
+	item interface{}
+	next atomic.Pointer[lockNode]
+}
+
+// NewTwoLockQueue initializes and returns a new instance of TwoLockQueue.
+// It is safe to be used concurrently.
+func NewTwoLockQueue() *TwoLockQueue {
+	q := &TwoLockQueue{}
+	q.head = &lockNode{}
+	q.tail = q.head
+	q.cond = sync.NewCond(&q.headMu)
+	return q
+}
+
+// Enqueue adds an item to the end of the queue. If there are any waiting
+// Dequeue calls, it signals one of them that an item is available.
+// Items enqueued after Close are discarded.
+// This method is safe for concurrent use.
+func (q *TwoLockQueue) Enqueue(item interface{}) {
+	n, _ := q.nodes.Get().(*lockNode)
+	if n == nil {
+		n = &lockNode{}
+	}
+	n.item = item
+	q.tailMu.Lock()
+	if q.closed.Load() {
+		q.tailMu.Unlock()
+		n.item = nil
+		q.nodes.Put(n)
+		return
+	}
+	q.size.Add(1)
+	q.tail.next.Store(n)
+	q.tail = n
+	q.tailMu.Unlock()
+
+	// A consumer registers in waiting before it checks for an item, so either
+	// it sees the node linked above or this load sees it and wakes it.
+	if q.waiting.Load() > 0 {
+		q.headMu.Lock()
+		q.cond.Signal()
+		q.headMu.Unlock()
+	}
+}
+
+// Dequeue removes and returns the item from the front of the queue.
+// If the queue is empty, it blocks until an item is enqueued or the queue is
+// closed. The boolean value is false only once the queue is closed and drained.
+// This method is safe for concurrent use.
+func (q *TwoLockQueue) Dequeue() (interface{}, bool) {
+	q.headMu.Lock()
+	defer q.headMu.Unlock()
+	q.waiting.Add(1)
+	for q.head.next.Load() == nil && !q.closed.Load() {
+		q.cond.Wait()
+	}
+	q.waiting.Add(-1)
+	return q.take()
+}
+
+// DequeueContext is like Dequeue but gives up when ctx is done. It returns
+// ctx.Err() on cancellation and ErrClosed once the queue has been closed and
+// drained.
+// This method is safe for concurrent use.
+func (q *TwoLockQueue) DequeueContext(ctx context.Context) (interface{}, error) {
+	q.headMu.Lock()
+	defer q.headMu.Unlock()
+	stop := watchContext(ctx, q.cond)
+	defer stop()
+	q.waiting.Add(1)
+	defer q.waiting.Add(-1)
+	for q.head.next.Load() == nil && !q.closed.Load() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		q.cond.Wait()
+	}
+	item, ok := q.take()
+	if !ok {
+		return nil, ErrClosed
+	}
+	return item, nil
+}
+
+// TryDequeue removes and returns the item from the front of the queue
+// without blocking. The boolean value is false if the queue is empty.
+// This method is safe for concurrent use.
+func (q *TwoLockQueue) TryDequeue() (interface{}, bool) {
+	q.headMu.Lock()
+	defer q.headMu.Unlock()
+	return q.take()
+}
+
+// take unlinks the front item. The caller must hold q.headMu.
+func (q *TwoLockQueue) take() (interface{}, bool) {
+	next := q.head.next.Load()
+	if next == nil {
+		return nil, false
+	}
+	item := next.item
+	next.item = nil // next becomes the dummy; drop the reference so the item can be collected.
+	old := q.head
+	q.head = next
+	q.size.Add(-1)
+	// Producers only touch the last node, which next or a later node now is,
+	// so the old dummy is unreachable and can be recycled.
+	old.next.Store(nil)
+	q.nodes.Put(old)
+	return item, true
+}
+
+// Close marks the queue as closed. Items already queued can still be
+// dequeued; once they are gone, blocked and future Dequeue calls return false.
+// Calling Close more than once has no further effect.
+// This method is safe for concurrent use.
+func (q *TwoLockQueue) Close() {
+	q.tailMu.Lock()
+	q.closed.Store(true)
+	q.tailMu.Unlock()
+
+	q.headMu.Lock()
+	q.cond.Broadcast()
+	q.headMu.Unlock()
+}
+
+// IsEmpty checks if the queue is empty.
+// This method is safe for concurrent use.
+func (q *TwoLockQueue) IsEmpty() bool {
+	return q.Size() == 0
+}
+
+// Size returns the number of items in the queue. It reads a counter without
+// taking either lock.
+// This method is safe for concurrent use.
+func (q *TwoLockQueue) Size() int {
+	return int(q.size.Load())
+}
@@ -0,0 +1,176 @@
+package threadsafequeue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test that the two-lock queue preserves FIFO order
+func TestTwoLockQueueOrder(t *testing.T) {
+	q := NewTwoLockQueue()
+	for i := 0; i < 10; i++ {
+		q.Enqueue(i)
+	}
+	if q.Size() != 10 {
+		t.Errorf("Expected size to be 10, got %d", q.Size())
+	}
+	for i := 0; i < 10; i++ {
+		if item, ok := q.Dequeue(); !ok || item != i {
+			t.Fatalf("Expected to dequeue %d, got %v", i, item)
+		}
+	}
+	if !q.IsEmpty() {
+		t.Error("Expected the queue to be empty")
+	}
+	if _, ok := q.TryDequeue(); ok {
+		t.Error("Expected TryDequeue on an empty queue to fail")
+	}
+}
+
+// Test that Dequeue blocks until an item is enqueued
+func TestTwoLockQueueBlocks(t *testing.T) {
+	q := NewTwoLockQueue()
+	result := make(chan interface{})
+	go func() {
+		item, _ := q.Dequeue()
+		result <- item
+	}()
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case item := <-result:
+		t.Fatalf("Expected Dequeue to block, got %v", item)
+	default:
+	}
+	q.Enqueue(42)
+	if item := <-result; item != 42 {
+		t.Errorf("Expected to dequeue 42, got %v", item)
+	}
+}
+
+// Test that Close releases blocked consumers after the queue drains
+func TestTwoLockQueueClose(t *testing.T) {
+	q := NewTwoLockQueue()
+	q.Enqueue(1)
+	q.Close()
+	q.Enqueue(2)
+	if item, ok := q.Dequeue(); !ok || item != 1 {
+		t.Errorf("Expected to dequeue 1, got %v", item)
+	}
+	if _, ok := q.Dequeue(); ok {
+		t.Error("Expected Dequeue on a closed, drained queue to return false")
+	}
+	if _, err := q.DequeueContext(context.Background()); err != ErrClosed {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+}
+
+// Test that DequeueContext gives up when its context is cancelled
+func TestTwoLockQueueDequeueContext(t *testing.T) {
+	q := NewTwoLockQueue()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := q.DequeueContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+}
+
+// Test that concurrent producers and consumers deliver every item exactly once
+func TestTwoLockQueueConcurrent(t *testing.T) {
+	q := NewTwoLockQueue()
+	const producers, perProducer = 8, 5000
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				q.Enqueue(p*perProducer + i)
+			}
+		}(p)
+	}
+
+	seen := make([]bool, producers*perProducer)
+	var mu sync.Mutex
+	var consumers sync.WaitGroup
+	for c := 0; c < 8; c++ {
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			for {
+				item, ok := q.Dequeue()
+				if !ok {
+					return
+				}
+				mu.Lock()
+				if seen[item.(int)] {
+					t.Errorf("Item %v dequeued twice", item)
+				}
+				seen[item.(int)] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	q.Close()
+	consumers.Wait()
+	for i, ok := range seen {
+		if !ok {
+			t.Fatalf("Item %d was never dequeued", i)
+		}
+	}
+}
+
+// queueOps is the subset of queue operations shared by the mutex-based
+// implementations, used to run the same benchmark against each.
+type queueOps interface {
+	Enqueue(item interface{})
+	Dequeue() (interface{}, bool)
+}
+
+// benchmarkProducersConsumers moves b.N items through q with the given
+// number of producer and consumer goroutines.
+func benchmarkProducersConsumers(b *testing.B, q queueOps, producers, consumers int) {
+	var item interface{} = struct{}{}
+	var wg sync.WaitGroup
+	b.ReportAllocs()
+	b.ResetTimer()
+	for p := 0; p < producers; p++ {
+		n := b.N / producers
+		if p < b.N%producers {
+			n++
+		}
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				q.Enqueue(item)
+			}
+		}(n)
+	}
+	for c := 0; c < consumers; c++ {
+		n := b.N / consumers
+		if c < b.N%consumers {
+			n++
+		}
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				q.Dequeue()
+			}
+		}(n)
+	}
+	wg.Wait()
+}
+
+// Benchmark 8 producers and 8 consumers on the single-lock and two-lock queues
+func BenchmarkTwoLock8x8(b *testing.B) {
+	b.Run("SingleLock", func(b *testing.B) {
+		benchmarkProducersConsumers(b, NewThreadSafeQueue(), 8, 8)
+	})
+	b.Run("TwoLock", func(b *testing.B) {
+		benchmarkProducersConsumers(b, NewTwoLockQueue(), 8, 8)
+	})
+}
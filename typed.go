@@ -0,0 +1,138 @@
+package threadsafequeue
+
+import (
+	"context"
+	"sync"
+)
+
+// TypedQueue is a FIFO queue of T with the same blocking and closing
+// semantics as ThreadSafeQueue. Items are stored as T in a ring buffer rather
+// than boxed in interface values, so enqueueing does not allocate per item
+// and consumers need no type assertions.
+//
+// For large T, EnqueuePtr and DequeueInto move each item with a single copy
+// in and a single copy out.
+type TypedQueue[T any] struct {
+	items   ring[T]    // Ring buffer holding the queue items.
+	mu      sync.Mutex // Mutex to protect concurrent access to the queue.
+	cond    *sync.Cond // Condition variable to coordinate enqueue and dequeue operations.
+	waiters int        // Consumers blocked in cond.Wait.
+	closed  bool       // Set by Close; no further items are accepted.
+}
+
+// NewTypedQueue initializes and returns a new instance of TypedQueue.
+// It is safe to be used concurrently.
+func NewTypedQueue[T any]() *TypedQueue[T] {
+	q := &TypedQueue[T]{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Enqueue adds an item to the end of the queue. If there are any waiting
+// Dequeue calls, it signals one of them that an item is available.
+// Items enqueued after Close are discarded.
+// This method is safe for concurrent use.
+func (q *TypedQueue[T]) Enqueue(item T) {
+	q.EnqueuePtr(&item)
+}
+
+// EnqueuePtr is like Enqueue but takes a pointer to the item, which is
+// copied once, directly into the queue's storage. The queue keeps no
+// reference to *item.
+// This method is safe for concurrent use.
+func (q *TypedQueue[T]) EnqueuePtr(item *T) {
+	q.mu.Lock()
+	if !q.closed {
+		q.items.pushBackPtr(item)
+		if q.waiters > 0 {
+			q.cond.Signal()
+		}
+	}
+	q.mu.Unlock()
+}
+
+// Dequeue removes and returns the item from the front of the queue.
+// If the queue is empty, it blocks until an item is enqueued or the queue is
+// closed. The boolean value is false only once the queue is closed and
+// drained, in which case the item is the zero value.
+// This method is safe for concurrent use.
+func (q *TypedQueue[T]) Dequeue() (T, bool) {
+	var item T
+	ok := q.DequeueInto(&item)
+	return item, ok
+}
+
+// DequeueInto is like Dequeue but moves the item into *dst with a single
+// copy. *dst is left untouched when it returns false.
+// This method is safe for concurrent use.
+func (q *TypedQueue[T]) DequeueInto(dst *T) bool {
+	q.mu.Lock()
+	for q.items.len() == 0 && !q.closed {
+		q.waiters++
+		q.cond.Wait() // Wait until an item is available.
+		q.waiters--
+	}
+	ok := q.items.popFrontInto(dst)
+	q.mu.Unlock()
+	return ok
+}
+
+// DequeueContext is like Dequeue but gives up when ctx is done. It returns
+// ctx.Err() on cancellation and ErrClosed once the queue has been closed and
+// drained.
+// This method is safe for concurrent use.
+func (q *TypedQueue[T]) DequeueContext(ctx context.Context) (T, error) {
+	var item T
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stop := watchContext(ctx, q.cond)
+	defer stop()
+	for q.items.len() == 0 && !q.closed {
+		if err := ctx.Err(); err != nil {
+			return item, err
+		}
+		q.waiters++
+		q.cond.Wait()
+		q.waiters--
+	}
+	if !q.items.popFrontInto(&item) {
+		return item, ErrClosed
+	}
+	return item, nil
+}
+
+// TryDequeue removes and returns the item from the front of the queue
+// without blocking. The boolean value is false if the queue is empty.
+// This method is safe for concurrent use.
+func (q *TypedQueue[T]) TryDequeue() (T, bool) {
+	var item T
+	q.mu.Lock()
+	ok := q.items.popFrontInto(&item)
+	q.mu.Unlock()
+	return item, ok
+}
+
+// Close marks the queue as closed. Items already in the queue can still be
+// dequeued; once they are gone, all blocked and future Dequeue calls return
+// false. Calling Close more than once has no effect.
+// This method is safe for concurrent use.
+func (q *TypedQueue[T]) Close() {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+// IsEmpty returns true if the queue has no items, and false otherwise.
+// This method is safe for concurrent use.
+func (q *TypedQueue[T]) IsEmpty() bool {
+	return q.Size() == 0
+}
+
+// Size returns the number of items currently in the queue.
+// This method is safe for concurrent use.
+func (q *TypedQueue[T]) Size() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.items.len()
+}
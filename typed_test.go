@@ -0,0 +1,121 @@
+package threadsafequeue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Test that TypedQueue preserves order without type assertions
+func TestTypedQueue(t *testing.T) {
+	q := NewTypedQueue[int]()
+	for i := 0; i < 10; i++ {
+		q.Enqueue(i)
+	}
+	if q.Size() != 10 {
+		t.Errorf("Expected size to be 10, got %d", q.Size())
+	}
+	for i := 0; i < 5; i++ {
+		if item, ok := q.Dequeue(); !ok || item != i {
+			t.Fatalf("Expected to dequeue %d, got %d", i, item)
+		}
+	}
+	var item int
+	for i := 5; i < 10; i++ {
+		if !q.DequeueInto(&item) || item != i {
+			t.Fatalf("Expected to dequeue %d, got %d", i, item)
+		}
+	}
+	if _, ok := q.TryDequeue(); ok {
+		t.Error("Expected TryDequeue on an empty queue to fail")
+	}
+}
+
+// Test that EnqueuePtr copies the item so later changes do not leak in
+func TestTypedQueueEnqueuePtr(t *testing.T) {
+	q := NewTypedQueue[[4]int]()
+	v := [4]int{1, 2, 3, 4}
+	q.EnqueuePtr(&v)
+	v[0] = 99
+	if item, _ := q.Dequeue(); item[0] != 1 {
+		t.Errorf("Expected the queued copy to be unchanged, got %v", item)
+	}
+}
+
+// Test that DequeueInto blocks until an item arrives and reports Close
+func TestTypedQueueBlockAndClose(t *testing.T) {
+	q := NewTypedQueue[string]()
+	result := make(chan string)
+	go func() {
+		var item string
+		q.DequeueInto(&item)
+		result <- item
+	}()
+	time.Sleep(100 * time.Millisecond)
+	q.Enqueue("hello")
+	if item := <-result; item != "hello" {
+		t.Errorf("Expected to dequeue hello, got %q", item)
+	}
+
+	q.Enqueue("last")
+	q.Close()
+	q.Enqueue("discarded")
+	item := "unchanged"
+	if !q.DequeueInto(&item) || item != "last" {
+		t.Errorf("Expected to dequeue last, got %q", item)
+	}
+	item = "unchanged"
+	if q.DequeueInto(&item) || item != "unchanged" {
+		t.Errorf("Expected DequeueInto on a closed, drained queue to fail and leave dst, got %q", item)
+	}
+	if _, err := q.DequeueContext(context.Background()); err != ErrClosed {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+}
+
+// Test that DequeueContext gives up when its context is cancelled
+func TestTypedQueueDequeueContext(t *testing.T) {
+	q := NewTypedQueue[int]()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := q.DequeueContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+}
+
+// largeItem is a 1KB value used to measure copying costs.
+type largeItem struct {
+	data [1024]byte
+}
+
+// Benchmark moving 1KB items through the queues by value and by pointer
+func BenchmarkTypedQueueLargeItem(b *testing.B) {
+	b.Run("Interface", func(b *testing.B) {
+		q := NewThreadSafeQueue()
+		var v largeItem
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			q.Enqueue(v)
+			item, _ := q.Dequeue()
+			v = item.(largeItem)
+		}
+	})
+	b.Run("Value", func(b *testing.B) {
+		q := NewTypedQueue[largeItem]()
+		var v largeItem
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			q.Enqueue(v)
+			v, _ = q.Dequeue()
+		}
+	})
+	b.Run("Pointer", func(b *testing.B) {
+		q := NewTypedQueue[largeItem]()
+		var v largeItem
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			q.EnqueuePtr(&v)
+			q.DequeueInto(&v)
+		}
+	})
+}
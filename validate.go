@@ -0,0 +1,111 @@
+package threadsafequeue
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var (
+	// ErrNilItem is returned, or panicked with, when a queue created with
+	// WithRejectNil(true) is given a nil item.
+	ErrNilItem = errors.New("threadsafequeue: nil item")
+	// ErrWrongType is returned, or panicked with, when a queue created with
+	// WithElementType is given an item of another type.
+	ErrWrongType = errors.New("threadsafequeue: wrong item type")
+)
+
+// WithRejectNil makes the queue refuse nil items, so that a producer's bug
+// fails where it happens instead of crashing a consumer later. Both a nil
+// interface and a nil pointer, map, channel or function stored in an
+// interface, such as (*T)(nil), count as nil; a nil slice is a valid empty
+// slice and is accepted. EnqueueContext and TryEnqueue return an error
+// wrapping ErrNilItem, while Enqueue, EnqueueFront and EnqueueBatch panic
+// with it. EnqueueBatch checks every item before adding any. Nil items are
+// accepted by default.
+func WithRejectNil(reject bool) Option {
+	return func(q *ThreadSafeQueue) {
+		q.rejectNil = reject
+	}
+}
+
+// WithElementType makes the queue refuse items whose dynamic type is not t,
+// so that a producer sending the wrong type fails at once instead of a
+// consumer's type assertion failing later. If t is an interface type, items
+// of any type implementing it are accepted instead, as is a nil item. Refused
+// items are handled as with WithRejectNil, with an error wrapping
+// ErrWrongType that names both types. Passing a nil t panics.
+//
+// For a concrete type, write reflect.TypeOf(Job{}); for an interface,
+// reflect.TypeOf((*io.Reader)(nil)).Elem(). The check costs a type
+// comparison per item, or about that when all items of an interface type
+// have the same dynamic type.
+func WithElementType(t reflect.Type) Option {
+	if t == nil {
+		panic("threadsafequeue: WithElementType needs a type")
+	}
+	return func(q *ThreadSafeQueue) {
+		q.elemType = t
+	}
+}
+
+// validate reports why the queue refuses item, if it does. It only reads
+// settings fixed at construction and the failure of the write-ahead log,
+// which is atomic, so the caller need not hold q.mu.
+func (q *ThreadSafeQueue) validate(item interface{}) error {
+	if err := q.WALErr(); err != nil {
+		return err
+	}
+	if q.rejectNil && isNil(item) {
+		if item == nil {
+			return ErrNilItem
+		}
+		return fmt.Errorf("%w of type %T", ErrNilItem, item)
+	}
+	if q.elemType != nil {
+		return q.checkType(item)
+	}
+	return nil
+}
+
+// checkType reports whether item has the type set by WithElementType.
+func (q *ThreadSafeQueue) checkType(item interface{}) error {
+	t := reflect.TypeOf(item)
+	if t == q.elemType {
+		return nil
+	}
+	if q.elemType.Kind() == reflect.Interface {
+		// Checking a method set is slow next to comparing types, so the
+		// last implementation accepted is remembered; queues rarely carry
+		// more than a few.
+		if t == nil || t == q.elemLast.Load() {
+			return nil
+		}
+		if t.Implements(q.elemType) {
+			q.elemLast.Store(t)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: got %v, want %v", ErrWrongType, t, q.elemType)
+}
+
+// mustValidate panics with the error from validate, for the enqueue methods
+// that cannot return one.
+func (q *ThreadSafeQueue) mustValidate(item interface{}) {
+	if err := q.validate(item); err != nil {
+		panic(err)
+	}
+}
+
+// isNil reports whether item is nil or holds a nil pointer, map, channel or
+// function.
+func isNil(item interface{}) bool {
+	if item == nil {
+		return true
+	}
+	switch v := reflect.ValueOf(item); v.Kind() {
+	case reflect.Pointer, reflect.UnsafePointer, reflect.Map, reflect.Chan, reflect.Func, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
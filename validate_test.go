@@ -0,0 +1,187 @@
+package threadsafequeue
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type job struct{ id int }
+
+// Test that isNil recognizes untyped nil and nil values held in an interface
+func TestIsNil(t *testing.T) {
+	var p *job
+	var m map[string]int
+	var ch chan int
+	var fn func()
+	var err error
+	tests := []struct {
+		item interface{}
+		want bool
+	}{
+		{nil, true},
+		{p, true},
+		{m, true},
+		{ch, true},
+		{fn, true},
+		{err, true},
+		{[]int(nil), false},
+		{0, false},
+		{"", false},
+		{job{}, false},
+		{&job{}, false},
+	}
+	for _, tt := range tests {
+		if got := isNil(tt.item); got != tt.want {
+			t.Errorf("isNil(%#v) = %v, want %v", tt.item, got, tt.want)
+		}
+	}
+}
+
+// Test that a queue created with WithRejectNil refuses nil items through the
+// error-returning methods and leaves the queue untouched
+func TestRejectNilErrors(t *testing.T) {
+	q := NewThreadSafeQueue(WithRejectNil(true))
+	if err := q.TryEnqueue(nil); err != ErrNilItem {
+		t.Errorf("Expected ErrNilItem, got %v", err)
+	}
+	err := q.EnqueueContext(context.Background(), (*job)(nil))
+	if !errors.Is(err, ErrNilItem) {
+		t.Errorf("Expected an error wrapping ErrNilItem, got %v", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "*threadsafequeue.job") {
+		t.Errorf("Expected the error to name the item's type, got %v", err)
+	}
+	if q.Size() != 0 {
+		t.Errorf("Expected no items to be enqueued, got size %d", q.Size())
+	}
+	if err := q.TryEnqueue(&job{}); err != nil {
+		t.Errorf("Expected a non-nil item to be accepted, got %v", err)
+	}
+}
+
+// Test that the methods without an error result panic on a nil item, and
+// that EnqueueBatch adds nothing from a batch containing one
+func TestRejectNilPanics(t *testing.T) {
+	q := NewThreadSafeQueue(WithRejectNil(true))
+	var p *job
+	calls := map[string]func(){
+		"Enqueue":      func() { q.Enqueue(nil) },
+		"EnqueueFront": func() { q.EnqueueFront(p) },
+		"EnqueueBatch": func() { q.EnqueueBatch(1, 2, p) },
+	}
+	for name, call := range calls {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("Expected %s to panic", name)
+				} else if err, ok := r.(error); !ok || !errors.Is(err, ErrNilItem) {
+					t.Errorf("Expected %s to panic with ErrNilItem, got %v", name, r)
+				}
+			}()
+			call()
+		}()
+	}
+	if q.Size() != 0 {
+		t.Errorf("Expected no items to be enqueued, got size %d", q.Size())
+	}
+}
+
+// Test that nil items are accepted by default
+func TestNilAcceptedByDefault(t *testing.T) {
+	q := NewThreadSafeQueue()
+	q.Enqueue(nil)
+	q.Enqueue((*job)(nil))
+	if q.Size() != 2 {
+		t.Errorf("Expected 2 items, got %d", q.Size())
+	}
+}
+
+type shape interface{ area() float64 }
+
+type square struct{ side float64 }
+
+func (s square) area() float64 { return s.side * s.side }
+
+// Test that WithElementType accepts only items of the exact type, and names
+// both types when refusing one
+func TestElementType(t *testing.T) {
+	q := NewThreadSafeQueue(WithElementType(reflect.TypeOf(job{})))
+	if err := q.TryEnqueue(job{1}); err != nil {
+		t.Errorf("Expected a job to be accepted, got %v", err)
+	}
+	for _, item := range []interface{}{&job{2}, 3, nil} {
+		err := q.TryEnqueue(item)
+		if !errors.Is(err, ErrWrongType) {
+			t.Errorf("Expected %#v to be refused with ErrWrongType, got %v", item, err)
+		} else if !strings.Contains(err.Error(), "want threadsafequeue.job") {
+			t.Errorf("Expected the error to name the wanted type, got %v", err)
+		}
+	}
+	func() {
+		defer func() {
+			err, _ := recover().(error)
+			if !errors.Is(err, ErrWrongType) || !strings.Contains(err.Error(), "got string") {
+				t.Errorf("Expected Enqueue to panic naming the item's type, got %v", err)
+			}
+		}()
+		q.Enqueue("job")
+	}()
+	if q.Size() != 1 {
+		t.Errorf("Expected only the job to be enqueued, got size %d", q.Size())
+	}
+}
+
+// Test that an interface element type accepts every implementation
+func TestElementTypeInterface(t *testing.T) {
+	q := NewThreadSafeQueue(WithElementType(reflect.TypeOf((*shape)(nil)).Elem()))
+	for _, item := range []interface{}{square{1}, &square{2}, nil} {
+		if err := q.TryEnqueue(item); err != nil {
+			t.Errorf("Expected %#v to be accepted, got %v", item, err)
+		}
+	}
+	if err := q.TryEnqueue(job{}); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected a job to be refused with ErrWrongType, got %v", err)
+	}
+
+	q = NewThreadSafeQueue(WithElementType(reflect.TypeOf((*shape)(nil)).Elem()), WithRejectNil(true))
+	if err := q.TryEnqueue(nil); err != ErrNilItem {
+		t.Errorf("Expected WithRejectNil to still refuse nil, got %v", err)
+	}
+}
+
+// Test that WithElementType panics on a nil type
+func TestElementTypeNil(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected WithElementType(nil) to panic")
+		}
+	}()
+	WithElementType(nil)
+}
+
+// Benchmark the cost of checking element types on Enqueue
+func BenchmarkElementType(b *testing.B) {
+	benchmarks := []struct {
+		name string
+		opts []Option
+		item interface{}
+	}{
+		{"None", nil, job{}},
+		{"Concrete", []Option{WithElementType(reflect.TypeOf(job{}))}, job{}},
+		{"Interface", []Option{WithElementType(reflect.TypeOf((*shape)(nil)).Elem())}, square{}},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			q := NewThreadSafeQueue(bm.opts...)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				q.Enqueue(bm.item)
+				q.Dequeue()
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package threadsafequeue
+
+import (
+	"runtime"
+	"time"
+)
+
+// WaitStrategy decides how a consumer waits when it finds the queue empty.
+// It only affects latency and CPU use, never which items are dequeued.
+type WaitStrategy int
+
+const (
+	// WaitBlock parks the consumer until a producer wakes it. This is the
+	// default and uses no CPU while waiting.
+	WaitBlock WaitStrategy = iota
+	// WaitSpinThenBlock first yields the processor in a loop for a bounded
+	// number of iterations, watching for an item, and parks only if none
+	// arrives. Items enqueued shortly after the consumer starts waiting are
+	// picked up without the cost of parking and rescheduling, at the price of
+	// some CPU.
+	WaitSpinThenBlock
+	// WaitSleep polls the queue with exponentially growing sleeps between
+	// checks, up to maxSleepWait. It adds latency but suits batch jobs that
+	// would rather not be woken for every item.
+	WaitSleep
+)
+
+const (
+	// spinIterations bounds the yields of WaitSpinThenBlock before parking.
+	spinIterations = 100
+	// minSleepWait and maxSleepWait bound the sleeps of WaitSleep.
+	minSleepWait = 50 * time.Microsecond
+	maxSleepWait = 10 * time.Millisecond
+)
+
+// String returns the name of the strategy.
+func (s WaitStrategy) String() string {
+	switch s {
+	case WaitBlock:
+		return "WaitBlock"
+	case WaitSpinThenBlock:
+		return "WaitSpinThenBlock"
+	case WaitSleep:
+		return "WaitSleep"
+	default:
+		return "WaitStrategy(unknown)"
+	}
+}
+
+// WithWaitStrategy sets how Dequeue and DequeueContext wait on an empty
+// queue. With WaitSleep, waiters notice Close and context cancellation at
+// their next check rather than immediately, and since they never park they
+// are not served in wait order: an item that arrives while other consumers
+// are parked goes to those first.
+func WithWaitStrategy(s WaitStrategy) Option {
+	return func(q *ThreadSafeQueue) {
+		q.wait = s
+	}
+}
+
+// awaitItem waits once for the queue to become non-empty or closed
+// according to the wait strategy; attempt counts the previous calls by the
+// same waiter, starting at zero. It also returns when done is closed; a nil
+// done never is. With claim, the waiter is a worker pool, as for park.
+// Callers loop until the condition holds, as with sync.Cond.Wait. The
+// caller must hold q.mu, which may be released and reacquired. If a
+// producer handed the waiter an item, awaitItem returns it and what was
+// kept beside it with true, already removed from the queue, and q.mu is no
+// longer held.
+func (q *ThreadSafeQueue) awaitItem(done <-chan struct{}, attempt int, claim bool) (interface{}, extra, bool) {
+	r := q.startRegion(traceWaitRegion)
+	defer endRegion(r)
+	switch q.wait {
+	case WaitSpinThenBlock:
+		if attempt == 0 {
+			q.polling++
+			q.unlock()
+			for i := 0; i < spinIterations && q.size.Load() == 0; i++ {
+				runtime.Gosched()
+			}
+			q.mu.Lock()
+			q.polling--
+			return nil, extra{}, false
+		}
+	case WaitSleep:
+		d := minSleepWait << attempt
+		if attempt > 16 || d > maxSleepWait {
+			d = maxSleepWait
+		}
+		q.polling++
+		q.unlock()
+		<-q.clock.After(d)
+		q.mu.Lock()
+		q.polling--
+		return nil, extra{}, false
+	}
+	return q.park(done, claim)
+}
+
+// park joins the wait list and blocks until a producer hands the waiter an
+// item, Close wakes it, or done is closed. Parked consumers are served in the
+// order they started waiting: each new item goes straight to the consumer at
+// the head of the list, so one that arrives later cannot take it first. The
+// caller must hold q.mu. If an item was handed over, park returns it with
+// true without reacquiring q.mu, so that the consumer does not queue for the
+// lock just to leave; otherwise q.mu is held again on return. With claim,
+// the waiter is a worker pool, which completes the future of the item it is
+// handed itself.
+func (q *ThreadSafeQueue) park(done <-chan struct{}, claim bool) (interface{}, extra, bool) {
+	w := waiterPool.Get().(*waiter)
+	w.claim = claim
+	q.waitq.pushBack(w)
+	q.watchWaiter(w)
+	q.unlock()
+	select {
+	case <-w.ready:
+	case <-done:
+		q.mu.Lock()
+		if w.queued {
+			q.waitq.remove(w)
+			waiterPool.Put(w)
+			return nil, extra{}, false
+		}
+		// Woken concurrently with done; collect the token, which the waker
+		// may send after unlocking, and keep any item handed over.
+		q.unlock()
+		<-w.ready
+	}
+	item, x, handed := w.item, w.extra, w.handed
+	w.item, w.extra, w.handed = nil, extra{}, false
+	waiterPool.Put(w)
+	if !handed {
+		q.mu.Lock()
+	}
+	return item, x, handed
+}
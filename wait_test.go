@@ -0,0 +1,188 @@
+package threadsafequeue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+var waitStrategies = []WaitStrategy{WaitBlock, WaitSpinThenBlock, WaitSleep}
+
+// Test that every wait strategy delivers items to a waiting consumer
+func TestWaitStrategies(t *testing.T) {
+	for _, s := range waitStrategies {
+		t.Run(s.String(), func(t *testing.T) {
+			q := NewThreadSafeQueue(WithWaitStrategy(s))
+			result := make(chan interface{})
+			go func() {
+				for i := 0; i < 3; i++ {
+					item, _ := q.Dequeue()
+					result <- item
+				}
+			}()
+			time.Sleep(100 * time.Millisecond)
+			for i := 0; i < 3; i++ {
+				q.Enqueue(i)
+				if item := <-result; item != i {
+					t.Errorf("Expected to dequeue %d, got %v", i, item)
+				}
+			}
+		})
+	}
+}
+
+// Test that every wait strategy observes Close and cancellation
+func TestWaitStrategiesRelease(t *testing.T) {
+	for _, s := range waitStrategies {
+		t.Run(s.String(), func(t *testing.T) {
+			q := NewThreadSafeQueue(WithWaitStrategy(s))
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			if _, err := q.DequeueContext(ctx); err != context.DeadlineExceeded {
+				t.Errorf("Expected DeadlineExceeded, got %v", err)
+			}
+
+			done := make(chan bool)
+			go func() {
+				_, ok := q.Dequeue()
+				done <- ok
+			}()
+			time.Sleep(100 * time.Millisecond)
+			q.Close()
+			select {
+			case ok := <-done:
+				if ok {
+					t.Error("Expected Dequeue on a closed queue to return false")
+				}
+			case <-time.After(time.Second):
+				t.Error("Expected Close to release the waiting Dequeue")
+			}
+		})
+	}
+}
+
+// Benchmark the wake-up latency of each strategy by passing an item back and
+// forth between two goroutines through a pair of queues
+func BenchmarkWaitStrategyPingPong(b *testing.B) {
+	for _, s := range []WaitStrategy{WaitBlock, WaitSpinThenBlock} {
+		b.Run(s.String(), func(b *testing.B) {
+			ping := NewThreadSafeQueue(WithWaitStrategy(s))
+			pong := NewThreadSafeQueue(WithWaitStrategy(s))
+			go func() {
+				for {
+					item, ok := ping.Dequeue()
+					if !ok {
+						return
+					}
+					pong.Enqueue(item)
+				}
+			}()
+			var item interface{} = struct{}{}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ping.Enqueue(item)
+				pong.Dequeue()
+			}
+			b.StopTimer()
+			ping.Close()
+		})
+	}
+}
+
+// Test that EnqueueBatch adds items in order under the overflow policy
+func TestEnqueueBatch(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(3), WithOverflowPolicy(DropNewest))
+	q.EnqueueBatch(1, 2, 3, 4)
+	if got := q.ToSlice(); len(got) != 3 || got[0] != 1 || got[2] != 3 {
+		t.Errorf("Expected [1 2 3], got %v", got)
+	}
+	if q.Dropped() != 1 {
+		t.Errorf("Expected 1 dropped item, got %d", q.Dropped())
+	}
+	q.Close()
+	q.EnqueueBatch(5)
+	if q.Size() != 3 {
+		t.Errorf("Expected items after Close to be discarded, got size %d", q.Size())
+	}
+}
+
+// Test that a batch larger than a bounded queue reaches a consumer that was
+// waiting before the batch started
+func TestEnqueueBatchBlocksForRoom(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(2))
+	result := make(chan interface{}, 5)
+	go func() {
+		for i := 0; i < 5; i++ {
+			item, _ := q.Dequeue()
+			result <- item
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+	q.EnqueueBatch(0, 1, 2, 3, 4)
+	for i := 0; i < 5; i++ {
+		select {
+		case item := <-result:
+			if item != i {
+				t.Fatalf("Expected to dequeue %d, got %v", i, item)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Consumer stuck waiting for item %d", i)
+		}
+	}
+}
+
+// Test that no consumer stays blocked while items are available, however
+// the items arrive
+func TestWakeupAccounting(t *testing.T) {
+	iterations := 500
+	if testing.Short() {
+		iterations = 50
+	}
+	const consumers = 8
+	for it := 0; it < iterations; it++ {
+		q := NewThreadSafeQueue()
+		done := make(chan struct{}, consumers)
+		for c := 0; c < consumers; c++ {
+			go func() {
+				q.Dequeue()
+				done <- struct{}{}
+			}()
+		}
+		// Wait until every consumer is parked.
+		for {
+			q.mu.Lock()
+			n := q.waitq.len
+			q.mu.Unlock()
+			if n == consumers {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		switch it % 3 {
+		case 0:
+			q.EnqueueBatch(1, 2, 3, 4, 5, 6, 7, 8)
+		case 1:
+			q.EnqueueBatch(1, 2, 3)
+			q.Enqueue(4)
+			q.EnqueueBatch(5, 6, 7, 8)
+		default:
+			q.EnqueueFront(1)
+			q.EnqueueBatch(2)
+			q.EnqueueBatch(3, 4, 5, 6, 7, 8, 9, 10) // More items than waiters.
+		}
+		for c := 0; c < consumers; c++ {
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Iteration %d: a consumer stayed blocked with %d items queued", it, q.Size())
+			}
+		}
+		q.mu.Lock()
+		if q.waitq.len != 0 {
+			t.Errorf("Iteration %d: expected no waiters, got %d", it, q.waitq.len)
+		}
+		q.mu.Unlock()
+	}
+}
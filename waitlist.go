@@ -0,0 +1,247 @@
+package threadsafequeue
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// waiter is a consumer parked in Dequeue or a producer blocked on a full
+// bounded queue. It is woken by a token on ready, sent when its item has
+// been handed over or by Close.
+type waiter struct {
+	ready      chan struct{} // Receives one token when the waiter may proceed.
+	item       interface{}   // For a consumer, the item handed over; for a producer, the item to store.
+	extra      extra         // What the queue keeps beside item.
+	front      bool          // For a producer, store the item at the front of the queue.
+	handed     bool          // The item was moved out of (consumer) or into (producer) the queue on the waiter's behalf.
+	claim      bool          // For a consumer, a worker pool, which completes the future of its item.
+	queued     bool          // Still on the wait list.
+	since      time.Time     // When the waiter started waiting, if the queue watches for stuck waiters.
+	stack      []uintptr     // Where it started waiting, in race builds watching for stuck waiters.
+	prev, next *waiter
+}
+
+// waiterPool recycles waiters and their channels, so parking does not
+// allocate. A waiter is only returned once its token has been received.
+var waiterPool = sync.Pool{
+	New: func() interface{} {
+		return &waiter{ready: make(chan struct{}, 1)}
+	},
+}
+
+// waitList is a doubly linked FIFO of waiters. Waiters are served in the
+// order they started waiting, which keeps a worker from starving while
+// others are served repeatedly.
+type waitList struct {
+	head, tail *waiter
+	len        int
+}
+
+// pushBack appends w to the list.
+func (l *waitList) pushBack(w *waiter) {
+	w.queued = true
+	w.prev, w.next = l.tail, nil
+	if l.tail != nil {
+		l.tail.next = w
+	} else {
+		l.head = w
+	}
+	l.tail = w
+	l.len++
+}
+
+// remove unlinks w, which must be on the list.
+func (l *waitList) remove(w *waiter) {
+	if w.prev != nil {
+		w.prev.next = w.next
+	} else {
+		l.head = w.next
+	}
+	if w.next != nil {
+		w.next.prev = w.prev
+	} else {
+		l.tail = w.prev
+	}
+	w.prev, w.next, w.queued = nil, nil, false
+	l.len--
+}
+
+// popFront unlinks and returns the longest-waiting waiter, or nil.
+func (l *waitList) popFront() *waiter {
+	w := l.head
+	if w != nil {
+		l.remove(w)
+	}
+	return w
+}
+
+// popAll unlinks every waiter and returns them chained through next, for
+// release to wake empty-handed, as Close does.
+func (l *waitList) popAll() *waiter {
+	var head, tail *waiter
+	for w := l.popFront(); w != nil; w = l.popFront() {
+		if tail == nil {
+			head = w
+		} else {
+			tail.next = w
+		}
+		tail = w
+	}
+	return head
+}
+
+// handOff gives item to the longest-waiting consumer on l, if any, and
+// returns it for the caller to release once it has unlocked, or nil.
+func handOff(l *waitList, item interface{}) *waiter {
+	w := l.popFront()
+	if w != nil {
+		w.item, w.handed = item, true
+	}
+	return w
+}
+
+// parkOn joins l, the wait list of a ThreadSafeStack or FairQueue guarded by
+// mu, and blocks until an item is handed over, Close wakes the waiter, or
+// ctx is done. It returns the item, ErrClosed or ctx.Err(). The caller must
+// hold mu, which is released on return.
+func parkOn(ctx context.Context, mu sync.Locker, l *waitList) (interface{}, error) {
+	w := waiterPool.Get().(*waiter)
+	l.pushBack(w)
+	mu.Unlock()
+	select {
+	case <-w.ready:
+	case <-ctx.Done():
+		mu.Lock()
+		if w.queued {
+			l.remove(w)
+			mu.Unlock()
+			waiterPool.Put(w)
+			return nil, ctx.Err()
+		}
+		// Woken concurrently with ctx; collect the token, which the waker
+		// sends after unlocking, and keep any item handed over.
+		mu.Unlock()
+		<-w.ready
+	}
+	item, handed := w.item, w.handed
+	w.item, w.handed = nil, false
+	waiterPool.Put(w)
+	if !handed {
+		return nil, ErrClosed
+	}
+	return item, nil
+}
+
+// settle wakes every waiter that the queue's current state lets proceed, and
+// is the only place anyone is woken. It runs at the end of each critical
+// section, from unlock, so operations never decide for themselves whom to
+// wake:
+//
+//   - While consumers are parked and items are queued, the front item is
+//     handed to the consumer that has waited longest. A batch of k items
+//     thus serves up to k consumers, and no one is woken when nothing
+//     arrived.
+//   - While producers are blocked and there is room, the item of the
+//     producer that has waited longest is stored on its behalf. Removing or
+//     clearing items thus admits as many producers as fit.
+//   - Once the queue is closed, consumers left without an item and all
+//     blocked producers are woken empty-handed and give up.
+//
+// The waiters to wake are returned chained through next, for the caller to
+// pass to release once q.mu is unlocked. The caller must hold q.mu.
+func (q *ThreadSafeQueue) settle() *waiter {
+	var head, tail *waiter
+	chain := func(w *waiter) {
+		if tail == nil {
+			head = w
+		} else {
+			tail.next = w
+		}
+		tail = w
+	}
+	for {
+		for q.waitq.head != nil && q.len() > 0 {
+			w := q.waitq.popFront()
+			w.extra = q.frontExtra()
+			q.claim = w.claim
+			w.item, w.handed = q.remove()
+			q.claim = false
+			chain(w)
+		}
+		if q.putq.head == nil || q.full() || q.closed {
+			break
+		}
+		for q.putq.head != nil && !q.full() {
+			w := q.putq.popFront()
+			q.store(w.item, w.extra, w.front)
+			w.handed = true
+			chain(w)
+		}
+	}
+	if q.closed {
+		for w := q.waitq.popFront(); w != nil; w = q.waitq.popFront() {
+			chain(w)
+		}
+		for w := q.putq.popFront(); w != nil; w = q.putq.popFront() {
+			chain(w)
+		}
+	}
+	return head
+}
+
+// release sends each waiter in a chain returned by settle its token. Doing
+// so after unlocking is safe: the waiters are off their wait lists and their
+// items already handed over, so no one else touches them until they run.
+func release(w *waiter) {
+	for w != nil {
+		next := w.next
+		w.next = nil
+		w.ready <- struct{}{} // w may be reused as soon as this is received.
+		w = next
+	}
+}
+
+// parkProducer joins the producer wait list with item and blocks until a
+// consumer makes room and stores the item on the producer's behalf, Close
+// wakes it, or ctx is done. Blocked producers are admitted in the order they
+// started waiting, so one that arrives later cannot take the room first. It
+// returns nil once the item is stored, ErrClosed if the queue was closed
+// first and ctx.Err() if ctx was done first; a nil ctx waits without
+// cancellation. The caller must hold q.mu, which is held again on return.
+func (q *ThreadSafeQueue) parkProducer(ctx context.Context, item interface{}, x extra, front bool) error {
+	var done <-chan struct{}
+	if ctx != nil {
+		done = ctx.Done()
+	}
+	w := waiterPool.Get().(*waiter)
+	w.item, w.extra, w.front = item, x, front
+	q.putq.pushBack(w)
+	q.watchWaiter(w)
+	r := q.startRegion(traceWaitRegion)
+	q.unlock()
+	var err error
+	select {
+	case <-w.ready:
+		q.mu.Lock()
+	case <-done:
+		q.mu.Lock()
+		if w.queued {
+			q.putq.remove(w)
+			err = ctx.Err()
+		} else {
+			// Admitted or closed concurrently; collect the token, which the
+			// waker sends after unlocking.
+			q.unlock()
+			<-w.ready
+			q.mu.Lock()
+		}
+	}
+	endRegion(r)
+	if err == nil && !w.handed {
+		err = ErrClosed
+	}
+	w.item, w.extra, w.front, w.handed = nil, extra{}, false, false
+	waiterPool.Put(w)
+	return err
+}
@@ -0,0 +1,578 @@
+package threadsafequeue
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// awaitParked waits until n consumers are parked on q.
+func awaitParked(t *testing.T, q *ThreadSafeQueue, n int) {
+	t.Helper()
+	awaitWaiting(t, q, &q.waitq, n)
+}
+
+// awaitBlocked waits until n producers are blocked on q.
+func awaitBlocked(t *testing.T, q *ThreadSafeQueue, n int) {
+	t.Helper()
+	awaitWaiting(t, q, &q.putq, n)
+}
+
+// awaitWaiting waits until l, one of q's wait lists, holds n waiters.
+func awaitWaiting(t *testing.T, q *ThreadSafeQueue, l *waitList, n int) {
+	t.Helper()
+	awaitListed(t, q.mu.RLocker(), l, n)
+}
+
+// awaitListed waits until l, guarded by mu, holds n waiters.
+func awaitListed(t *testing.T, mu sync.Locker, l *waitList, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		waiting := l.len
+		mu.Unlock()
+		if waiting == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d waiters, got %d", n, waiting)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Test that consumers are served in the order they started waiting
+func TestWaitOrderEqualsServeOrder(t *testing.T) {
+	q := NewThreadSafeQueue()
+	const consumers = 8
+	type served struct{ consumer, item int }
+	results := make(chan served, consumers)
+
+	for c := 0; c < consumers; c++ {
+		c := c
+		go func() {
+			item, _ := q.Dequeue()
+			results <- served{c, item.(int)}
+		}()
+		awaitParked(t, q, c+1)
+	}
+
+	for i := 0; i < consumers; i++ {
+		q.Enqueue(i)
+		r := <-results
+		if r.consumer != i || r.item != i {
+			t.Errorf("Expected consumer %d to get item %d, consumer %d got %d", i, i, r.consumer, r.item)
+		}
+	}
+}
+
+// Test that a batch of items is handed out in wait order as well
+func TestWaitOrderWithBatches(t *testing.T) {
+	q := NewThreadSafeQueue()
+	const consumers = 4
+	got := make([]chan interface{}, consumers)
+
+	for c := 0; c < consumers; c++ {
+		got[c] = make(chan interface{}, 1)
+		c := c
+		go func() {
+			item, _ := q.Dequeue()
+			got[c] <- item
+		}()
+		awaitParked(t, q, c+1)
+	}
+
+	q.EnqueueBatch(0, 1, 2, 3)
+	for c := 0; c < consumers; c++ {
+		if item := <-got[c]; item != c {
+			t.Errorf("Expected consumer %d to get %d, got %v", c, c, item)
+		}
+	}
+}
+
+// Test that an item handed to a parked consumer is out of reach of a
+// consumer that arrives before the parked one runs
+func TestHandedItemIsNotStolen(t *testing.T) {
+	q := NewThreadSafeQueue()
+	got := make(chan interface{}, 1)
+	go func() {
+		item, _ := q.Dequeue()
+		got <- item
+	}()
+	awaitParked(t, q, 1)
+
+	// Hand the item over without letting the parked consumer run.
+	q.mu.Lock()
+	q.store(42, extra{}, false)
+	w := q.settle()
+	q.mu.Unlock()
+
+	if item, ok := q.TryDequeue(); ok {
+		t.Errorf("TryDequeue took %v, which was handed to a parked consumer", item)
+	}
+	release(w)
+	if item := <-got; item != 42 {
+		t.Errorf("Expected the parked consumer to get 42, got %v", item)
+	}
+}
+
+// Test that a consumer that gives up leaves the wait list without disturbing
+// the order of the others
+func TestCancelledWaiterLeavesWaitList(t *testing.T) {
+	q := NewThreadSafeQueue()
+	results := make([]chan interface{}, 3)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	for c := range results {
+		results[c] = make(chan interface{}, 1)
+		c := c
+		go func() {
+			if c == 1 {
+				_, err := q.DequeueContext(ctx)
+				results[c] <- err
+				return
+			}
+			item, _ := q.Dequeue()
+			results[c] <- item
+		}()
+		awaitParked(t, q, c+1)
+	}
+
+	cancel()
+	if err := <-results[1]; err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	awaitParked(t, q, 2)
+
+	q.Enqueue("a")
+	if item := <-results[0]; item != "a" {
+		t.Errorf("Expected the first consumer to get a, got %v", item)
+	}
+	q.Enqueue("b")
+	if item := <-results[2]; item != "b" {
+		t.Errorf("Expected the third consumer to get b, got %v", item)
+	}
+}
+
+// Test that four consumers fed by a steady producer get similar shares
+func TestFairConsumerShares(t *testing.T) {
+	q := NewThreadSafeQueue()
+	const consumers = 4
+	const count = 2000
+	shares := make([]int, consumers)
+	var wg sync.WaitGroup
+
+	for c := 0; c < consumers; c++ {
+		wg.Add(1)
+		c := c
+		go func() {
+			defer wg.Done()
+			for {
+				if _, ok := q.Dequeue(); !ok {
+					return
+				}
+				shares[c]++
+			}
+		}()
+	}
+	awaitParked(t, q, consumers)
+
+	for i := 0; i < count; i++ {
+		q.Enqueue(i)
+		time.Sleep(10 * time.Microsecond)
+	}
+	q.Close()
+	wg.Wait()
+
+	for c, n := range shares {
+		if n < count/consumers/2 || n > count/consumers*3/2 {
+			t.Errorf("Consumer %d got %d of %d items, expected close to %d", c, n, count, count/consumers)
+		}
+	}
+}
+
+// Test that no item is lost or duplicated and the wait list empties when
+// consumers give up while being handed items
+func TestWaitListStress(t *testing.T) {
+	q := NewThreadSafeQueue()
+	const producers = 4
+	const perProducer = 500
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	seen := make(map[int]bool)
+
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		p := p
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				q.Enqueue(p*perProducer + i)
+			}
+		}()
+	}
+
+	var consumers sync.WaitGroup
+	for c := 0; c < 8; c++ {
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			for {
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Microsecond)
+				item, err := q.DequeueContext(ctx)
+				cancel()
+				if err == ErrClosed {
+					return
+				}
+				if err != nil {
+					continue
+				}
+				mu.Lock()
+				if seen[item.(int)] {
+					t.Errorf("Item %v dequeued twice", item)
+				}
+				seen[item.(int)] = true
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	q.Close()
+	consumers.Wait()
+
+	if len(seen) != producers*perProducer {
+		t.Errorf("Expected %d distinct items, got %d", producers*perProducer, len(seen))
+	}
+	if q.waitq.len != 0 {
+		t.Errorf("Expected an empty wait list, got %d", q.waitq.len)
+	}
+}
+
+// Test that producers blocked on a full queue are admitted in the order
+// they blocked
+func TestProducerWaitOrder(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(1))
+	const producers = 8
+	q.Enqueue(-1)
+
+	for p := 0; p < producers; p++ {
+		go q.Enqueue(p)
+		awaitBlocked(t, q, p+1)
+	}
+
+	// A slow consumer frees one slot at a time.
+	for i := -1; i < producers; i++ {
+		time.Sleep(time.Millisecond)
+		if item, _ := q.Dequeue(); item != i {
+			t.Errorf("Expected to dequeue %d, got %v", i, item)
+		}
+	}
+	if q.putq.len != 0 {
+		t.Errorf("Expected no blocked producers, got %d", q.putq.len)
+	}
+}
+
+// Test that room freed by Drain goes to blocked producers in order, and that
+// blocked EnqueueFront calls still insert at the front
+func TestProducersAdmittedAfterDrain(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(2))
+	q.Enqueue("a")
+	q.Enqueue("b")
+
+	go q.Enqueue("c")
+	awaitBlocked(t, q, 1)
+	go q.EnqueueFront("d")
+	awaitBlocked(t, q, 2)
+	go q.Enqueue("e")
+	awaitBlocked(t, q, 3)
+
+	q.Drain()
+	if got := q.ToSlice(); len(got) != 2 || got[0] != "d" || got[1] != "c" {
+		t.Errorf("Expected [d c] after Drain, got %v", got)
+	}
+	q.Dequeue()
+	awaitBlocked(t, q, 0)
+	if got := q.ToSlice(); len(got) != 2 || got[0] != "c" || got[1] != "e" {
+		t.Errorf("Expected [c e], got %v", got)
+	}
+}
+
+// Test that a producer that gives up leaves the wait list and its item is
+// not stored
+func TestCancelledProducerLeavesWaitList(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(1))
+	q.Enqueue(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+
+	go q.Enqueue(1)
+	awaitBlocked(t, q, 1)
+	go func() { errs <- q.EnqueueContext(ctx, "cancelled") }()
+	awaitBlocked(t, q, 2)
+	go q.Enqueue(2)
+	awaitBlocked(t, q, 3)
+
+	cancel()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if item, _ := q.Dequeue(); item != i {
+			t.Errorf("Expected to dequeue %d, got %v", i, item)
+		}
+	}
+}
+
+// Test that items, blocked producers and the wait list stay consistent when
+// producers give up while being admitted
+func TestProducerWaitListStress(t *testing.T) {
+	q := NewThreadSafeQueue(WithCapacity(2))
+	const producers = 8
+	const perProducer = 300
+	var stored sync.Map
+	var wg sync.WaitGroup
+
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		p := p
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				item := p*perProducer + i
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Microsecond)
+				if q.EnqueueContext(ctx, item) == nil {
+					stored.Store(item, true)
+				}
+				cancel()
+			}
+		}()
+	}
+
+	seen := make(map[interface{}]bool)
+	done := make(chan struct{})
+	go func() {
+		for {
+			item, ok := q.Dequeue()
+			if !ok {
+				close(done)
+				return
+			}
+			if seen[item] {
+				t.Errorf("Item %v dequeued twice", item)
+			}
+			seen[item] = true
+		}
+	}()
+
+	wg.Wait()
+	q.Close()
+	<-done
+
+	stored.Range(func(item, _ interface{}) bool {
+		if !seen[item] {
+			t.Errorf("Item %v was stored but never dequeued", item)
+		}
+		return true
+	})
+	if len(seen) == 0 {
+		t.Error("Expected some items to get through")
+	}
+	if q.putq.len != 0 {
+		t.Errorf("Expected no blocked producers, got %d", q.putq.len)
+	}
+}
+
+// Test each wake-up transition: which parked consumers and blocked
+// producers an operation releases, and which it leaves waiting
+func TestWakeTransitions(t *testing.T) {
+	tests := []struct {
+		name          string
+		consumers     int // Parked on an empty queue.
+		producers     int // Blocked on a full queue of capacity 2.
+		action        func(q *ThreadSafeQueue)
+		served        int // Consumers that get an item and producers whose item is stored.
+		closedOut     int // Waiters that give up because the queue closed.
+		waitingAfter  int // Waiters still waiting.
+		sizeAfter     int
+		storedInOrder []interface{} // Expected contents afterwards, if not nil.
+	}{
+		{"items arrive while n waiters", 3, 0, func(q *ThreadSafeQueue) { q.Enqueue(1) }, 1, 0, 2, 0, nil},
+		{"batch smaller than n waiters", 3, 0, func(q *ThreadSafeQueue) { q.EnqueueBatch(1, 2) }, 2, 0, 1, 0, nil},
+		{"batch larger than n waiters", 3, 0, func(q *ThreadSafeQueue) { q.EnqueueBatch(1, 2, 3, 4, 5) }, 3, 0, 0, 2, []interface{}{4, 5}},
+		{"front item while n waiters", 3, 0, func(q *ThreadSafeQueue) { q.EnqueueFront(1) }, 1, 0, 2, 0, nil},
+		{"close while n waiters", 3, 0, func(q *ThreadSafeQueue) { q.Close() }, 0, 3, 0, 0, nil},
+		{"clear while n waiters", 3, 0, func(q *ThreadSafeQueue) { q.Drain() }, 0, 0, 3, 0, nil},
+		{"items then close while n waiters", 3, 0, func(q *ThreadSafeQueue) {
+			q.mu.Lock()
+			q.store(1, extra{}, false)
+			q.closed = true
+			q.unlock()
+		}, 1, 2, 0, 0, nil},
+		{"dequeue while n producers", 0, 3, func(q *ThreadSafeQueue) { q.Dequeue() }, 1, 0, 2, 2, []interface{}{"full", "p0"}},
+		{"batch dequeue while n producers", 0, 3, func(q *ThreadSafeQueue) { q.DequeueBatch(2) }, 2, 0, 1, 2, []interface{}{"p0", "p1"}},
+		{"clear while n producers", 0, 3, func(q *ThreadSafeQueue) { q.Drain() }, 2, 0, 1, 2, []interface{}{"p0", "p1"}},
+		{"close while n producers", 0, 3, func(q *ThreadSafeQueue) { q.Close() }, 0, 3, 0, 2, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewThreadSafeQueue()
+			if tt.producers > 0 {
+				q = NewThreadSafeQueue(WithCapacity(2))
+				q.Enqueue("full")
+				q.Enqueue("full")
+			}
+			served := make(chan bool, tt.consumers+tt.producers)
+			for c := 0; c < tt.consumers; c++ {
+				go func() {
+					_, ok := q.Dequeue()
+					served <- ok
+				}()
+				awaitParked(t, q, c+1)
+			}
+			for p := 0; p < tt.producers; p++ {
+				item := fmt.Sprintf("p%d", p)
+				go func() { served <- q.EnqueueContext(context.Background(), item) == nil }()
+				awaitBlocked(t, q, p+1)
+			}
+
+			tt.action(q)
+
+			var got, closedOut int
+			for i := 0; i < tt.served+tt.closedOut; i++ {
+				select {
+				case ok := <-served:
+					if ok {
+						got++
+					} else {
+						closedOut++
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("Only %d waiters returned", got+closedOut)
+				}
+			}
+			if got != tt.served || closedOut != tt.closedOut {
+				t.Errorf("Expected %d served and %d closed out, got %d and %d", tt.served, tt.closedOut, got, closedOut)
+			}
+			select {
+			case <-served:
+				t.Error("More waiters returned than expected")
+			case <-time.After(20 * time.Millisecond):
+			}
+			q.mu.RLock()
+			waiting := q.waitq.len + q.putq.len
+			q.mu.RUnlock()
+			if waiting != tt.waitingAfter {
+				t.Errorf("Expected %d waiters left, got %d", tt.waitingAfter, waiting)
+			}
+			if q.Size() != tt.sizeAfter {
+				t.Errorf("Expected size %d, got %d", tt.sizeAfter, q.Size())
+			}
+			if tt.storedInOrder != nil {
+				if got := q.ToSlice(); fmt.Sprint(got) != fmt.Sprint(tt.storedInOrder) {
+					t.Errorf("Expected contents %v, got %v", tt.storedInOrder, got)
+				}
+			}
+			q.Close() // Release whoever is left.
+		})
+	}
+}
+
+// Test random interleavings of arrivals, clears and closes against parked
+// consumers and blocked producers: every waiter returns, no item is seen
+// twice and no accepted item is lost
+func TestWakeTransitionsRandomized(t *testing.T) {
+	iterations := 200
+	if testing.Short() {
+		iterations = 20
+	}
+	for it := 0; it < iterations; it++ {
+		rng := rand.New(rand.NewSource(int64(it)))
+		q := NewThreadSafeQueue(WithCapacity(1 + rng.Intn(4)))
+		var mu sync.Mutex
+		counts := make(map[int]int)
+		record := func(items ...interface{}) {
+			mu.Lock()
+			for _, item := range items {
+				counts[item.(int)]++
+			}
+			mu.Unlock()
+		}
+
+		var wg sync.WaitGroup
+		var stored []int // Items known to have been accepted.
+		next := 0
+		for c := rng.Intn(4); c > 0; c-- {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					item, ok := q.Dequeue()
+					if !ok {
+						return
+					}
+					record(item)
+				}
+			}()
+		}
+		for p := rng.Intn(4); p > 0; p-- {
+			items := []interface{}{next, next + 1, next + 2}
+			next += 3
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				q.EnqueueBatch(items...)
+			}()
+		}
+		for op := rng.Intn(6); op > 0; op-- {
+			switch rng.Intn(4) {
+			case 0:
+				if q.TryEnqueue(next) == nil {
+					stored = append(stored, next)
+				}
+				next++
+			case 1:
+				record(q.Drain()...)
+			case 2:
+				if item, ok := q.TryDequeue(); ok {
+					record(item)
+				}
+			default:
+				runtime.Gosched()
+			}
+		}
+		q.Close()
+
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Iteration %d: waiters still blocked after Close", it)
+		}
+		record(q.Drain()...)
+
+		for item, n := range counts {
+			if n != 1 {
+				t.Errorf("Iteration %d: item %d seen %d times", it, item, n)
+			}
+		}
+		for _, item := range stored {
+			if counts[item] == 0 {
+				t.Errorf("Iteration %d: item %d was accepted but never seen", it, item)
+			}
+		}
+		if q.waitq.len != 0 || q.putq.len != 0 {
+			t.Errorf("Iteration %d: expected no waiters, got %d and %d", it, q.waitq.len, q.putq.len)
+		}
+	}
+}
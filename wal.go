@@ -0,0 +1,761 @@
+package threadsafequeue
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrWAL is wrapped by the error a queue refuses items with once a write to
+// its write-ahead log has failed.
+var ErrWAL = errors.New("threadsafequeue: write-ahead log failed")
+
+// The log in the directory given to WithWAL is a series of segments, each
+// starting with a header of the magic string, the format version and their
+// checksum, and followed by a record for every change to the queue, in the
+// format described with formatVersion:
+//
+//	header:  "TSQW", version (uint16), checksum (uint32), big-endian
+//	enqueue: head 'E' or, for an item stored at the front, 'F', and the
+//	         encoded item as the body
+//	dequeue: head 'D', and the number of items removed from the front
+//	         (uvarint) as the body
+//	cancel:  head 'X', and the slot from the front of the item removed
+//	         by Ticket.Cancel (uvarint) as the body
+//	purge:   head 'P', and no body
+//
+// A cancelled item keeps its slot, as it does in the queue, until the items
+// ahead of it are dequeued or a purge record releases the slots of all
+// cancelled items, so that the slots in later cancel records still hold.
+// Segments are named by their sequence number, as in 00000000000000000001.wal.
+// Compaction writes the items pending at the end of segment N in the format
+// of Save to N.snap, which then stands for segments 1 to N.
+const (
+	walMagic     = "TSQW"
+	walHeaderLen = int64(len(walMagic) + 2 + checksumLen)
+	walSegExt    = ".wal"
+	walSnapExt   = ".snap"
+	walTempExt   = ".tmp"
+
+	walEnqueue = 'E'
+	walFront   = 'F'
+	walDequeue = 'D'
+	walCancel  = 'X'
+	walPurge   = 'P'
+)
+
+// WithWAL makes the queue durable with a write-ahead log in dir, created if
+// need be: every item is recorded in the log, encoded by codec, before the
+// call that stores it returns, and every removal after. When the queue is
+// created, the items the log shows as still pending are restored first, in
+// order, so that a process restarted after a crash carries on where it
+// stopped; RecoverWAL describes how the log is read. A bounded queue must
+// have room for them unless its overflow policy drops items.
+//
+// syncEvery sets how often the log is synced to disk: after every record if
+// it is 1, after every syncEvery records if it is more, and never if it is
+// zero, leaving that to WithWALSyncInterval or the operating system. Records
+// are written to the file as they are made, so items survive the process
+// crashing whatever the setting; syncing is what makes them survive the
+// machine crashing, and costs the most.
+//
+// Records are encoded and written under the queue's lock, in the order of
+// the changes they describe. If one cannot be, the log stops there and the
+// queue refuses every further item with an error wrapping ErrWAL, as it
+// does nil items under WithRejectNil; WALErr returns it. The same happens
+// if the log cannot be opened when the queue is created. Once the queue is
+// closed and empty, the log is synced and its file closed.
+// It panics if dir is empty, codec is nil or syncEvery is negative.
+func WithWAL(dir string, codec Codec, syncEvery int) Option {
+	if dir == "" || codec == nil || syncEvery < 0 {
+		panic("threadsafequeue: WithWAL needs a directory, a codec and a non-negative sync count")
+	}
+	return func(q *ThreadSafeQueue) {
+		l := q.walConfig()
+		l.dir, l.codec, l.syncEvery = dir, codec, syncEvery
+	}
+}
+
+// WithWALSyncInterval makes the queue sync its write-ahead log to disk no
+// later than d after a record is written, so that a burst of records costs
+// one sync. It combines with the sync count given to WithWAL, which it
+// needs. It panics if d is not positive.
+func WithWALSyncInterval(d time.Duration) Option {
+	if d <= 0 {
+		panic("threadsafequeue: WithWALSyncInterval needs a positive interval")
+	}
+	return func(q *ThreadSafeQueue) {
+		q.walConfig().interval = d
+	}
+}
+
+// WALErr returns the error that stopped the queue's write-ahead log, or nil
+// if it is working or the queue has none.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) WALErr() error {
+	if q.wal == nil {
+		return nil
+	}
+	if err := q.wal.failed.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+// RecoverWAL reads the write-ahead log kept in dir by WithWAL and returns
+// the items it shows as pending, enqueued and not yet dequeued, in queue
+// order. It starts from the newest snapshot written by compaction, if any,
+// and replays the segments written after it, ignoring older files that a
+// crash during compaction may have left. A record cut short at the end of
+// the last segment, as a crash while writing leaves it, is taken never to
+// have been written and is truncated from the file. Other damage is
+// reported as an error wrapping ErrCorrupt, a *CorruptError for a record
+// that fails its checksum. With LoadSkipCorrupt, such records are left out
+// and reported in the error returned along with the other items; leaving
+// out a dequeue record brings back the items it removed. Logs written in
+// an older format version are read as well. A directory without a log
+// holds no items.
+//
+// Queues created with WithWAL recover their items themselves; RecoverWAL is
+// for reading a log without a queue, and must not be used on the log of a
+// queue in use.
+func RecoverWAL(dir string, codec Codec, opts ...LoadOption) ([]interface{}, error) {
+	var o loadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	log, err := readWAL(dir, codec, o.skipCorrupt)
+	if err != nil {
+		return nil, err
+	}
+	if log.end < log.size {
+		if err := os.Truncate(walPath(dir, log.last, walSegExt), log.end); err != nil {
+			return nil, err
+		}
+	}
+	return log.items, errors.Join(log.skipped...)
+}
+
+// wal is the state behind WithWAL. Apart from failed and compactMu, it is
+// protected by the queue's lock.
+type wal struct {
+	dir        string
+	codec      Codec
+	syncEvery  int
+	interval   time.Duration
+	maxBytes   int64        // Size at which WithWALRotation starts a new segment.
+	maxRecords int          // Records after which WithWALRotation starts a new segment.
+	minBytes   int64        // Disk usage below which WithWALCompaction never compacts.
+	ratio      float64      // Records per pending item above which WithWALCompaction compacts.
+	f          *os.File     // Current segment; nil while recovering, and once closed or failed.
+	seq        uint64       // Sequence number of the current segment.
+	segBytes   int64        // Size of the current segment.
+	segRecords int          // Records in the current segment.
+	bytes      int64        // Disk usage of the segments and snapshot in use.
+	records    int          // Records since the snapshot in use.
+	compacting bool         // An automatic compaction is running.
+	compactMu  sync.Mutex   // Held by a compaction while it runs.
+	rec        []byte       // Record being written.
+	item       bytes.Buffer // Encoded item of the record.
+	unsynced   int          // Records written since the last sync.
+	timer      Timer        // Created on first use and reused.
+	armed      bool         // The timer is due to fire.
+	failed     atomic.Pointer[error]
+}
+
+// walConfig returns the queue's log settings, creating them for the first
+// option that sets one.
+func (q *ThreadSafeQueue) walConfig() *wal {
+	if q.wal == nil {
+		q.wal = &wal{}
+	}
+	return q.wal
+}
+
+// openWAL restores the items pending in the log and starts a new segment
+// for appending. NewThreadSafeQueue calls it once the queue is otherwise
+// ready.
+func (q *ThreadSafeQueue) openWAL() {
+	l := q.wal
+	if l.dir == "" {
+		panic("threadsafequeue: WithWALSyncInterval, WithWALRotation and WithWALCompaction need WithWAL")
+	}
+	log, err := createWAL(l.dir, l.codec)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrWAL, err)
+		l.failed.Store(&err)
+		return
+	}
+	q.lock()
+	defer q.unlock()
+	q.load(log.items, false) // Already in the log, so not logged again.
+	l.seq = log.last
+	l.bytes, l.records = log.bytes, log.records
+	if err := l.startSegment(); err != nil {
+		q.walFailed(err)
+		return
+	}
+	if log.canceled {
+		q.walPurged() // The queue restored the items without their slots.
+	}
+}
+
+// createWAL recovers the log in dir, creating the directory if need be:
+// it truncates a record cut short, as RecoverWAL does, and removes the
+// files that recovery ignored.
+func createWAL(dir string, codec Codec) (walLog, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return walLog{}, err
+	}
+	log, err := readWAL(dir, codec, false)
+	if err != nil {
+		return walLog{}, err
+	}
+	if log.end < log.size {
+		if err := os.Truncate(walPath(dir, log.last, walSegExt), log.end); err != nil {
+			return walLog{}, err
+		}
+	}
+	for _, name := range log.stale {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return walLog{}, err
+		}
+	}
+	return log, nil
+}
+
+// startSegment syncs and closes the current segment, if any, and creates the
+// next one. The caller must hold the queue's lock, or own the queue.
+func (l *wal) startSegment() error {
+	if l.f != nil {
+		if err := l.f.Sync(); err != nil {
+			return err
+		}
+		if err := l.f.Close(); err != nil {
+			return err
+		}
+		l.f = nil
+		l.unsynced = 0
+	}
+	f, err := os.OpenFile(walPath(l.dir, l.seq+1, walSegExt), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	h := make([]byte, walHeaderLen-checksumLen, walHeaderLen)
+	copy(h, walMagic)
+	binary.BigEndian.PutUint16(h[len(walMagic):], formatVersion)
+	if _, err := f.Write(appendChecksum(h, h)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	syncDir(l.dir)
+	l.f = f
+	l.seq++
+	l.segBytes, l.segRecords = walHeaderLen, 0
+	l.bytes += walHeaderLen
+	return nil
+}
+
+// walAdded logs item as stored at the front or the back. The caller must
+// hold q.mu exclusively.
+func (q *ThreadSafeQueue) walAdded(item interface{}, front bool) {
+	l := q.wal
+	if l.f == nil {
+		return
+	}
+	l.item.Reset()
+	if err := l.codec.Encode(&l.item, item); err != nil {
+		q.walFailed(fmt.Errorf("encoding item: %w", err))
+		return
+	}
+	kind := []byte{walEnqueue}
+	if front {
+		kind[0] = walFront
+	}
+	l.rec = appendRecord(l.rec[:0], kind, l.item.Bytes())
+	q.walWrite()
+}
+
+// walRemoved logs the removal of n items from the front. The caller must
+// hold q.mu exclusively.
+func (q *ThreadSafeQueue) walRemoved(n int) {
+	l := q.wal
+	if l.f == nil {
+		return
+	}
+	var b [binary.MaxVarintLen64]byte
+	l.rec = appendRecord(l.rec[:0], []byte{walDequeue}, b[:binary.PutUvarint(b[:], uint64(n))])
+	q.walWrite()
+	q.walClosed()
+}
+
+// walCanceled logs the removal of the i-th item from the front by Cancel.
+// The caller must hold q.mu exclusively.
+func (q *ThreadSafeQueue) walCanceled(i int) {
+	l := q.wal
+	if l.f == nil {
+		return
+	}
+	var b [binary.MaxVarintLen64]byte
+	l.rec = appendRecord(l.rec[:0], []byte{walCancel}, b[:binary.PutUvarint(b[:], uint64(i))])
+	q.walWrite()
+	q.walClosed()
+}
+
+// walPurged logs the release of the slots of all cancelled items. The caller
+// must hold q.mu exclusively.
+func (q *ThreadSafeQueue) walPurged() {
+	l := q.wal
+	if l.f == nil {
+		return
+	}
+	l.rec = appendRecord(l.rec[:0], []byte{walPurge}, nil)
+	q.walWrite()
+}
+
+// walWrite writes the record in l.rec and syncs the log as the settings
+// require. The caller must hold q.mu exclusively.
+func (q *ThreadSafeQueue) walWrite() {
+	l := q.wal
+	n, err := l.f.Write(l.rec)
+	l.segBytes += int64(n)
+	l.bytes += int64(n)
+	if err != nil {
+		q.walFailed(err)
+		return
+	}
+	l.segRecords++
+	l.records++
+	if (l.maxBytes > 0 && l.segBytes >= l.maxBytes) || (l.maxRecords > 0 && l.segRecords >= l.maxRecords) {
+		if err := l.startSegment(); err != nil {
+			q.walFailed(err)
+		}
+		q.maybeCompactWAL()
+		return
+	}
+	q.maybeCompactWAL()
+	l.unsynced++
+	if l.syncEvery > 0 && l.unsynced >= l.syncEvery {
+		q.walSync()
+	} else if l.interval > 0 && !l.armed {
+		l.armed = true
+		if l.timer == nil {
+			l.timer = q.clock.AfterFunc(l.interval, q.walTimer)
+		} else {
+			l.timer.Reset(l.interval)
+		}
+	}
+}
+
+// walTimer runs when the timer of WithWALSyncInterval fires.
+func (q *ThreadSafeQueue) walTimer() {
+	q.lock()
+	defer q.unlock()
+	q.wal.armed = false
+	if q.wal.f != nil && q.wal.unsynced > 0 {
+		q.walSync()
+	}
+}
+
+// walSync syncs the log to disk. The caller must hold q.mu exclusively.
+func (q *ThreadSafeQueue) walSync() {
+	if err := q.wal.f.Sync(); err != nil {
+		q.walFailed(err)
+		return
+	}
+	q.wal.unsynced = 0
+}
+
+// walClosed syncs and closes the log once the queue is closed and empty,
+// when nothing is left to record. The caller must hold q.mu exclusively.
+func (q *ThreadSafeQueue) walClosed() {
+	l := q.wal
+	if l.f == nil || !q.closed || q.len() > 0 {
+		return
+	}
+	if l.unsynced > 0 {
+		q.walSync()
+	}
+	if l.f != nil {
+		l.f.Close()
+		l.f = nil
+	}
+	if l.armed {
+		l.timer.Stop()
+		l.armed = false
+	}
+}
+
+// walFailed stops the log after err, so that the queue refuses further
+// items. The caller must hold q.mu exclusively.
+func (q *ThreadSafeQueue) walFailed(err error) {
+	l := q.wal
+	err = fmt.Errorf("%w: %w", ErrWAL, err)
+	l.failed.Store(&err)
+	if l.f != nil {
+		l.f.Close()
+		l.f = nil
+	}
+	if q.logger != nil {
+		q.logLater(slog.LevelError, "write-ahead log failed", nil, slog.String(LogKeyError, err.Error()))
+	}
+}
+
+// walLog is what readWAL finds in a log directory.
+type walLog struct {
+	items    []interface{} // Items pending.
+	canceled bool          // The log left slots of cancelled items.
+	last     uint64        // Sequence number of the last segment, or of the snapshot if none follows it.
+	end      int64         // Length of the last segment up to the end of its last whole record.
+	size     int64         // Length of the last segment.
+	bytes    int64         // Disk usage of the snapshot and segments in use.
+	records  int           // Records in the segments in use.
+	stale    []string      // Files that the snapshot makes obsolete, and temporary files.
+	skipped  []error       // Damaged records left out.
+}
+
+// readWAL replays the log in dir: the newest snapshot, then the segments
+// after it. With skip, records damaged in their body are left out and
+// listed in the log's skipped errors.
+func readWAL(dir string, codec Codec, skip bool) (walLog, error) {
+	var log walLog
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return log, nil
+	}
+	if err != nil {
+		return log, err
+	}
+	var snaps, segs []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasSuffix(name, walTempExt) {
+			log.stale = append(log.stale, name)
+		} else if seq, ok := walSeq(name, walSnapExt); ok {
+			snaps = append(snaps, seq)
+		} else if seq, ok := walSeq(name, walSegExt); ok {
+			segs = append(segs, seq)
+		}
+	}
+	var pending walPending
+	var base uint64
+	if len(snaps) > 0 {
+		base = snaps[len(snaps)-1] // ReadDir sorts by name, so by sequence number.
+		for _, seq := range snaps[:len(snaps)-1] {
+			log.stale = append(log.stale, filepath.Base(walPath(dir, seq, walSnapExt)))
+		}
+		path := walPath(dir, base, walSnapExt)
+		skipped, err := readWALSnapshot(path, codec, skip, &pending)
+		if err != nil {
+			return log, err
+		}
+		if skipped != nil {
+			log.skipped = append(log.skipped, skipped)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return log, err
+		}
+		log.bytes = info.Size()
+		log.last = base
+	}
+	for i, seq := range segs {
+		if seq <= base {
+			log.stale = append(log.stale, filepath.Base(walPath(dir, seq, walSegExt)))
+			continue
+		}
+		if seq != log.last+1 && log.last != 0 {
+			return log, fmt.Errorf("%w: segment %d follows %d", ErrCorrupt, seq, log.last)
+		}
+		path := walPath(dir, seq, walSegExt)
+		seg, err := readWALSegment(path, codec, skip, &pending)
+		if err != nil {
+			return log, err
+		}
+		log.skipped = append(log.skipped, seg.skipped...)
+		if seg.end < seg.size && i < len(segs)-1 {
+			return log, fmt.Errorf("%w: segment %d ends in a partial record at offset %d", ErrCorrupt, seq, seg.end)
+		}
+		log.last, log.end, log.size = seq, seg.end, seg.size
+		log.bytes += seg.end
+		log.records += seg.records
+	}
+	log.items, log.canceled = pending.live(), pending.dead > 0
+	return log, nil
+}
+
+// walSegmentInfo is what readWALSegment finds in a segment.
+type walSegmentInfo struct {
+	end     int64   // Length up to the end of the last whole record.
+	size    int64   // Length of the file.
+	records int     // Whole records.
+	skipped []error // Records left out for damage to their body.
+}
+
+// readWALSegment replays the segment at path onto pending. A segment cut
+// short, even within its header, ends at its last whole record.
+func readWALSegment(path string, codec Codec, skip bool, pending *walPending) (walSegmentInfo, error) {
+	var seg walSegmentInfo
+	f, err := os.Open(path)
+	if err != nil {
+		return seg, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return seg, err
+	}
+	seg.size = info.Size()
+	name := filepath.Base(path)
+	r := &countingReader{r: bufio.NewReader(f)}
+	h := make([]byte, walHeaderLen-checksumLen)
+	if _, err := io.ReadFull(r, h); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return seg, nil // Cut short while the segment was created.
+		}
+		return seg, err
+	}
+	if string(h[:len(walMagic)]) != walMagic {
+		return seg, fmt.Errorf("%w: %s is not a queue write-ahead log", ErrCorrupt, name)
+	}
+	version := binary.BigEndian.Uint16(h[len(walMagic):])
+	if err := checkVersion(version, "write-ahead log"); err != nil {
+		return seg, fmt.Errorf("%s: %w", name, err)
+	}
+	if version >= formatV2 {
+		if err := readChecksum(r, crc32.Checksum(h, castagnoli)); err == io.ErrUnexpectedEOF {
+			return seg, nil
+		} else if err != nil {
+			return seg, fmt.Errorf("%w: %s: header: %w", ErrCorrupt, name, err)
+		}
+	}
+	var buf bytes.Buffer
+	kind := make([]byte, 1)
+	for i := 0; ; i++ {
+		seg.end = r.n
+		if version == formatV1 {
+			err = readWALRecordV1(r, kind, &buf)
+		} else {
+			err = readRecord(r, kind, &buf)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return seg, nil
+		}
+		if err != nil {
+			cerr := &CorruptError{File: name, Record: i, Offset: seg.end, Err: err}
+			if err == errChecksum && skip {
+				seg.skipped = append(seg.skipped, cerr)
+				seg.records++
+				continue
+			}
+			return seg, cerr
+		}
+		switch kind[0] {
+		case walEnqueue, walFront:
+			item, err := codec.Decode(&buf)
+			if err != nil {
+				return seg, fmt.Errorf("threadsafequeue: %s: decoding record %d at offset %d: %w", name, i, seg.end, err)
+			}
+			if kind[0] == walFront {
+				pending.items.pushFront(item)
+				pending.canceled.pushFront(false)
+			} else {
+				pending.items.pushBack(item)
+				pending.canceled.pushBack(false)
+			}
+		case walDequeue:
+			n, err := binary.ReadUvarint(&buf)
+			if err != nil || buf.Len() > 0 {
+				return seg, &CorruptError{File: name, Record: i, Offset: seg.end, Err: errors.New("malformed dequeue record")}
+			}
+			if n > uint64(pending.len()) {
+				return seg, &CorruptError{File: name, Record: i, Offset: seg.end, Err: fmt.Errorf("removes %d of %d items", n, pending.len())}
+			}
+			for ; n > 0; n-- {
+				pending.popFront()
+			}
+		case walCancel:
+			k, err := binary.ReadUvarint(&buf)
+			if err != nil || buf.Len() > 0 {
+				return seg, &CorruptError{File: name, Record: i, Offset: seg.end, Err: errors.New("malformed cancel record")}
+			}
+			if !pending.cancel(k) {
+				return seg, &CorruptError{File: name, Record: i, Offset: seg.end, Err: fmt.Errorf("cancels slot %d, not an item pending", k)}
+			}
+		case walPurge:
+			if buf.Len() > 0 {
+				return seg, &CorruptError{File: name, Record: i, Offset: seg.end, Err: errors.New("malformed purge record")}
+			}
+			pending.purge()
+		default:
+			return seg, &CorruptError{File: name, Record: i, Offset: seg.end, Err: fmt.Errorf("unknown record type %q", kind[0])}
+		}
+		seg.records++
+	}
+}
+
+// readWALRecordV1 reads a record of a segment in format version 1, which
+// has no checksums, into the form readRecord gives it: the type in kind
+// and the item, or the count of a dequeue record, in buf.
+func readWALRecordV1(r *countingReader, kind []byte, buf *bytes.Buffer) error {
+	if _, err := io.ReadFull(r, kind); err != nil {
+		return err
+	}
+	switch kind[0] {
+	case walEnqueue, walFront:
+		return readFrame(r, buf)
+	case walDequeue:
+	default:
+		return fmt.Errorf("unknown record type %q", kind[0])
+	}
+	n, err := binary.ReadUvarint(r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	buf.Reset()
+	buf.Write(binary.AppendUvarint(nil, n))
+	return err
+}
+
+// readWALSnapshot reads the snapshot at path onto pending. With skip,
+// damaged items are left out and reported in skipped.
+func readWALSnapshot(path string, codec Codec, skip bool, pending *walPending) (skipped, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readSnapshot(f, filepath.Base(path), codec, skip, func(_ int, item interface{}) error {
+		pending.items.pushBack(item)
+		pending.canceled.pushBack(false)
+		return nil
+	})
+}
+
+// walPending is the list of items pending that replaying a log builds. As
+// in the queue that wrote the log, a cancelled item keeps its slot until
+// the items ahead of it are removed or a purge record comes.
+type walPending struct {
+	items    ring[interface{}]
+	canceled ring[bool] // Marks the slots of cancelled items, never at the front.
+	dead     int        // Slots of cancelled items.
+}
+
+// len returns the number of items pending.
+func (p *walPending) len() int {
+	return p.items.len() - p.dead
+}
+
+// popFront removes the front item.
+func (p *walPending) popFront() {
+	p.items.popFront()
+	p.canceled.popFront()
+	p.skipCanceled()
+}
+
+// cancel marks slot i as cancelled and reports whether it held an item.
+func (p *walPending) cancel(i uint64) bool {
+	if i >= uint64(p.items.len()) || p.canceled.at(int(i)) {
+		return false
+	}
+	p.canceled.set(int(i), true)
+	p.dead++
+	p.skipCanceled()
+	return true
+}
+
+// skipCanceled releases the slots of cancelled items at the front, as the
+// queue's skipCanceled does.
+func (p *walPending) skipCanceled() {
+	for p.dead > 0 {
+		if c, _ := p.canceled.front(); !c {
+			return
+		}
+		p.items.popFront()
+		p.canceled.popFront()
+		p.dead--
+	}
+}
+
+// purge releases the slots of all cancelled items.
+func (p *walPending) purge() {
+	if p.dead == 0 {
+		return
+	}
+	items := p.live()
+	p.items.clear()
+	p.canceled.clear()
+	for _, item := range items {
+		p.items.pushBack(item)
+		p.canceled.pushBack(false)
+	}
+	p.dead = 0
+}
+
+// live returns the items pending, front first.
+func (p *walPending) live() []interface{} {
+	items := p.items.appendTo(nil)
+	if p.dead == 0 {
+		return items
+	}
+	live := items[:0]
+	for i, item := range items {
+		if !p.canceled.at(i) {
+			live = append(live, item)
+		}
+	}
+	return live
+}
+
+// walPath returns the path of the segment or snapshot numbered seq.
+func walPath(dir string, seq uint64, ext string) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", seq, ext))
+}
+
+// walSeq returns the sequence number in the name of a segment or snapshot
+// with extension ext.
+func walSeq(name, ext string) (uint64, bool) {
+	digits, ok := strings.CutSuffix(name, ext)
+	if !ok || len(digits) != 20 {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(digits, 10, 64)
+	return seq, err == nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
@@ -0,0 +1,310 @@
+package threadsafequeue
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Test that a queue with a WAL restores its pending items in order
+func TestWALRecovers(t *testing.T) {
+	dir := t.TempDir()
+	q := NewThreadSafeQueue(WithWAL(dir, &intCodec{}, 1))
+	if err := q.WALErr(); err != nil {
+		t.Fatalf("Expected the WAL to open, got %v", err)
+	}
+	q.EnqueueBatch(1, 2, 3, 4, 5)
+	q.Dequeue()
+	q.TryDequeue()
+	q.EnqueueFront(0)
+
+	want := []interface{}{0, 3, 4, 5}
+	items, err := RecoverWAL(dir, &intCodec{})
+	if err != nil || !reflect.DeepEqual(items, want) {
+		t.Fatalf("Expected RecoverWAL to return %v, got %v and %v", want, items, err)
+	}
+	restarted := NewThreadSafeQueue(WithWAL(dir, &intCodec{}, 0))
+	if got := restarted.ToSlice(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected the restarted queue to hold %v, got %v", want, got)
+	}
+	restarted.Drain()
+	restarted.Enqueue(6)
+	if items, _ := RecoverWAL(dir, &intCodec{}); !reflect.DeepEqual(items, []interface{}{6}) {
+		t.Errorf("Expected the restarted queue to carry on the log, got %v", items)
+	}
+}
+
+// Test that the log records items cancelled from the middle of the queue
+func TestWALRecordsCancel(t *testing.T) {
+	dir := t.TempDir()
+	q := NewThreadSafeQueue(WithWAL(dir, &intCodec{}, 1))
+	var tickets []*Ticket
+	for i := 1; i <= 5; i++ {
+		tickets = append(tickets, q.EnqueueCancelable(i))
+	}
+	if !tickets[1].Cancel() || !tickets[3].Cancel() {
+		t.Fatal("Expected to cancel queued items on a queue with a WAL")
+	}
+	want := []interface{}{1, 3, 5}
+	items, err := RecoverWAL(dir, &intCodec{})
+	if err != nil || !reflect.DeepEqual(items, want) {
+		t.Fatalf("Expected RecoverWAL to return %v, got %v and %v", want, items, err)
+	}
+	restarted := NewThreadSafeQueue(WithWAL(dir, &intCodec{}, 0))
+	if got := restarted.ToSlice(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the restarted queue to hold %v, got %v", want, got)
+	}
+
+	// Cancelled slots left in the queue are released before a compaction,
+	// so later cancels recorded after it name the slots of the snapshot.
+	more := []*Ticket{restarted.EnqueueCancelable(6), restarted.EnqueueCancelable(7)}
+	if !more[0].Cancel() {
+		t.Fatal("Expected to cancel an item enqueued after a restart")
+	}
+	if err := restarted.CompactWAL(); err != nil {
+		t.Fatalf("Expected CompactWAL to succeed, got %v", err)
+	}
+	restarted.Enqueue(8)
+	if !more[1].Cancel() {
+		t.Fatal("Expected to cancel an item after a compaction")
+	}
+	want = []interface{}{1, 3, 5, 8}
+	if items, err := RecoverWAL(dir, &intCodec{}); err != nil || !reflect.DeepEqual(items, want) {
+		t.Errorf("Expected RecoverWAL to return %v after a compaction, got %v and %v", want, items, err)
+	}
+}
+
+// Test that recovery takes a log cut at any byte as it was before the cut record
+func TestWALTruncatedAtEveryOffset(t *testing.T) {
+	dir := t.TempDir()
+	path := walPath(dir, 1, walSegExt)
+	q := NewThreadSafeQueue(WithWAL(dir, &intCodec{}, 0))
+	type step struct {
+		end   int64
+		items []interface{}
+	}
+	steps := []step{}
+	mark := func() {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Expected the log to exist, got %v", err)
+		}
+		steps = append(steps, step{info.Size(), q.ToSlice()})
+	}
+	mark()
+	for _, op := range []func(){
+		func() { q.Enqueue(1) },
+		func() { q.Enqueue(2) },
+		func() { q.Dequeue() },
+		func() { q.EnqueueFront(3) },
+		func() { q.Enqueue(4) },
+		func() { q.Drain() },
+		func() { q.Enqueue(5) },
+	} {
+		op()
+		mark()
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected to read the log, got %v", err)
+	}
+
+	for i := 0; i <= len(data); i++ {
+		cut := t.TempDir()
+		if err := os.WriteFile(walPath(cut, 1, walSegExt), data[:i], 0o644); err != nil {
+			t.Fatal(err)
+		}
+		want := step{}
+		for _, s := range steps {
+			if s.end <= int64(i) {
+				want = s
+			}
+		}
+		items, err := RecoverWAL(cut, &intCodec{})
+		if err != nil {
+			t.Fatalf("Expected a log cut at %d bytes to recover, got %v", i, err)
+		}
+		if len(items) != len(want.items) || (len(items) > 0 && !reflect.DeepEqual(items, want.items)) {
+			t.Errorf("Expected a log cut at %d bytes to hold %v, got %v", i, want.items, items)
+		}
+		info, _ := os.Stat(walPath(cut, 1, walSegExt))
+		if info.Size() != want.end {
+			t.Errorf("Expected a log cut at %d bytes to be truncated to %d, got %d", i, want.end, info.Size())
+		}
+		restarted := NewThreadSafeQueue(WithWAL(cut, &intCodec{}, 1))
+		restarted.Enqueue(9)
+		items, err = RecoverWAL(cut, &intCodec{})
+		if err != nil || len(items) != len(want.items)+1 || items[len(items)-1] != 9 {
+			t.Errorf("Expected a log cut at %d bytes to take new records, got %v and %v", i, items, err)
+		}
+	}
+}
+
+// Test that RecoverWAL reports damage other than a cut-off end
+func TestWALCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	path := walPath(dir, 1, walSegExt)
+	q := NewThreadSafeQueue(WithWAL(dir, &intCodec{}, 0))
+	q.EnqueueBatch(1, 2)
+
+	data, _ := os.ReadFile(path)
+	bad := append([]byte(nil), data...)
+	bad[walHeaderLen] = 'X'
+	os.WriteFile(path, bad, 0o644)
+	if _, err := RecoverWAL(dir, &intCodec{}); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for a damaged record type, got %v", err)
+	}
+
+	os.WriteFile(path, appendRecord(append([]byte(nil), data...), []byte{walDequeue}, []byte{3}), 0o644)
+	if _, err := RecoverWAL(dir, &intCodec{}); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for removing more items than pending, got %v", err)
+	}
+
+	os.WriteFile(path, []byte("nonsense"), 0o644)
+	if _, err := RecoverWAL(dir, &intCodec{}); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for a bad header, got %v", err)
+	}
+	broken := NewThreadSafeQueue(WithWAL(dir, &intCodec{}, 0))
+	if err := broken.WALErr(); !errors.Is(err, ErrWAL) || !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected the queue to report the corrupt log, got %v", err)
+	}
+	if err := broken.TryEnqueue(1); !errors.Is(err, ErrWAL) {
+		t.Errorf("Expected a queue without its log to refuse items, got %v", err)
+	}
+}
+
+// Test that flipping any bit of a log segment is reported rather than
+// taken for a cut-off end
+func TestWALDetectsFlippedBits(t *testing.T) {
+	dir := t.TempDir()
+	path := walPath(dir, 1, walSegExt)
+	q := NewThreadSafeQueue(WithWAL(dir, &intCodec{}, 0))
+	q.EnqueueBatch(1, 2, 3, 4)
+	q.Dequeue()
+	q.EnqueueFront(5)
+	q.Close()
+	data, _ := os.ReadFile(path)
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		bad := append([]byte(nil), data...)
+		at, bit := rng.Intn(len(bad)), rng.Intn(8)
+		bad[at] ^= 1 << bit
+		os.WriteFile(path, bad, 0o644)
+		if _, err := RecoverWAL(dir, &intCodec{}); !errors.Is(err, ErrCorrupt) && !errors.Is(err, ErrVersion) {
+			t.Fatalf("Expected flipping bit %d of byte %d to be detected, got %v", bit, at, err)
+		}
+	}
+}
+
+// Test that LoadSkipCorrupt makes RecoverWAL leave out damaged records and
+// report them
+func TestWALSkipCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	path := walPath(dir, 1, walSegExt)
+	q := NewThreadSafeQueue(WithWAL(dir, &intCodec{}, 0))
+	q.EnqueueBatch(1, 2, 3)
+	data, _ := os.ReadFile(path)
+	record := func(i int) int64 { return walHeaderLen + int64(i)*(1+4+checksumLen+8+checksumLen) }
+	data[record(1)+1+4+checksumLen] ^= 1
+	os.WriteFile(path, data, 0o644)
+
+	_, err := RecoverWAL(dir, &intCodec{})
+	var cerr *CorruptError
+	if !errors.As(err, &cerr) || cerr.File != "00000000000000000001.wal" || cerr.Record != 1 || cerr.Offset != record(1) {
+		t.Fatalf("Expected a CorruptError for record 1, got %v", err)
+	}
+	items, err := RecoverWAL(dir, &intCodec{}, LoadSkipCorrupt(true))
+	if !errors.As(err, &cerr) || cerr.Record != 1 || !reflect.DeepEqual(items, []interface{}{1, 3}) {
+		t.Errorf("Expected items 1 and 3 with record 1 reported, got %v and %v", items, err)
+	}
+}
+
+// Test that a log written in format version 1 is recovered and carried on
+func TestWALVersion1(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte(walMagic)
+	data = binary.BigEndian.AppendUint16(data, formatV1)
+	for _, i := range []int{1, 2, 3} {
+		var item bytes.Buffer
+		encodeInt(i, &item)
+		data = append(data, walEnqueue)
+		data = binary.AppendUvarint(data, uint64(item.Len()))
+		data = append(data, item.Bytes()...)
+	}
+	data = append(data, walDequeue, 1)
+	os.WriteFile(walPath(dir, 1, walSegExt), data, 0o644)
+
+	q := NewThreadSafeQueue(WithWAL(dir, &intCodec{}, 1))
+	if err := q.WALErr(); err != nil {
+		t.Fatalf("Expected a version 1 log to open, got %v", err)
+	}
+	q.Enqueue(4)
+	items, err := RecoverWAL(dir, &intCodec{})
+	if want := []interface{}{2, 3, 4}; err != nil || !reflect.DeepEqual(items, want) {
+		t.Errorf("Expected %v, got %v and %v", want, items, err)
+	}
+}
+
+// Test that a failed record makes the queue refuse further items
+func TestWALWriteFailure(t *testing.T) {
+	dir := t.TempDir()
+	codec := &intCodec{}
+	q := NewThreadSafeQueue(WithWAL(dir, codec, 1))
+	q.Enqueue(1)
+	codec.fail.Store(true)
+	q.Enqueue(2)
+	if err := q.WALErr(); !errors.Is(err, ErrWAL) {
+		t.Fatalf("Expected WALErr to report the failure, got %v", err)
+	}
+	codec.fail.Store(false)
+	if err := q.EnqueueContext(context.Background(), 3); !errors.Is(err, ErrWAL) {
+		t.Errorf("Expected EnqueueContext to return the failure, got %v", err)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("Expected Enqueue to panic once the log has failed")
+			}
+		}()
+		q.Enqueue(4)
+	}()
+	if got := q.ToSlice(); !reflect.DeepEqual(got, []interface{}{1, 2}) {
+		t.Errorf("Expected the items stored before refusing to stay, got %v", got)
+	}
+	if item, ok := q.Dequeue(); !ok || item != 1 {
+		t.Errorf("Expected consumers to carry on, got %v", item)
+	}
+}
+
+// Test that the log is closed once the queue is closed and empty, and synced on a timer
+func TestWALCloseAndSyncInterval(t *testing.T) {
+	dir := t.TempDir()
+	q := NewThreadSafeQueue(WithWAL(dir, &intCodec{}, 0), WithWALSyncInterval(time.Millisecond))
+	q.Enqueue(1)
+	time.Sleep(20 * time.Millisecond)
+	q.Close()
+	if q.wal.f == nil {
+		t.Error("Expected the log to stay open while items are left")
+	}
+	q.Dequeue()
+	if q.wal.f != nil {
+		t.Error("Expected the log to be closed once the queue is closed and empty")
+	}
+	if items, err := RecoverWAL(dir, &intCodec{}); err != nil || len(items) != 0 {
+		t.Errorf("Expected an empty log, got %v and %v", items, err)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Expected WithWALSyncInterval without WithWAL to panic")
+		}
+	}()
+	NewThreadSafeQueue(WithWALSyncInterval(time.Second))
+}
@@ -0,0 +1,158 @@
+package threadsafequeue
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// WithWALRotation makes the queue start a new segment of its write-ahead
+// log once the current one holds maxBytes bytes or maxRecords records,
+// whichever comes first; a zero limit is not checked. Without rotation the
+// log has a single segment until it is compacted, which is what lets
+// compaction delete segments whose records are no longer needed. It needs
+// WithWAL, and panics if a limit is negative or both are zero.
+func WithWALRotation(maxBytes int64, maxRecords int) Option {
+	if maxBytes < 0 || maxRecords < 0 || (maxBytes == 0 && maxRecords == 0) {
+		panic("threadsafequeue: WithWALRotation needs a positive limit")
+	}
+	return func(q *ThreadSafeQueue) {
+		l := q.walConfig()
+		l.maxBytes, l.maxRecords = maxBytes, maxRecords
+	}
+}
+
+// WithWALCompaction makes the queue compact its write-ahead log, as
+// CompactWAL does, from a goroutine of its own once the log takes at least
+// minBytes on disk and holds more than ratio records for every item
+// pending, so that most of it describes items long gone. A ratio of 2 with
+// a minBytes of a few megabytes keeps the log within a few times the size of
+// the backlog. It needs WithWAL, and panics if minBytes is negative or
+// ratio is not positive.
+func WithWALCompaction(minBytes int64, ratio float64) Option {
+	if minBytes < 0 || !(ratio > 0) {
+		panic("threadsafequeue: WithWALCompaction needs a non-negative size and a positive ratio")
+	}
+	return func(q *ThreadSafeQueue) {
+		l := q.walConfig()
+		l.minBytes, l.ratio = minBytes, ratio
+	}
+}
+
+// CompactWAL rewrites the queue's write-ahead log as a snapshot of the items
+// pending and deletes the segments the snapshot stands for. It starts a new
+// segment and copies the list of items in a single critical section, so
+// producers and consumers carry on, logging to the new segment, while the
+// snapshot is written; only one compaction runs at a time.
+//
+// A crash at any point leaves a log that recovers to the same items. The
+// snapshot is written to a temporary file, synced and renamed into place,
+// and until the rename the old segments are the log. From the rename on,
+// the snapshot is: recovery reads the newest snapshot and only the segments
+// written after it, and deletes older files, so a crash before they are all
+// deleted does not mix the two.
+//
+// It returns the error that stopped the log, as WALErr does, and nil if the
+// log was closed with the queue. If the snapshot cannot be written, the log
+// carries on as it was and the error is returned.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) CompactWAL() error {
+	l := q.wal
+	if l == nil {
+		return errors.New("threadsafequeue: CompactWAL needs WithWAL")
+	}
+	l.compactMu.Lock()
+	defer l.compactMu.Unlock()
+	q.lock()
+	if l.f == nil {
+		q.unlock()
+		return q.WALErr()
+	}
+	if err := l.startSegment(); err != nil {
+		q.walFailed(err)
+		q.unlock()
+		return q.WALErr()
+	}
+	base := l.seq - 1
+	q.purgeCanceled() // The snapshot leaves the slots of cancelled items out.
+	items := q.liveItems()
+	records := l.records
+	q.unlock()
+
+	path := walPath(l.dir, base, walSnapExt)
+	if err := writeSnapshot(path, items, l.codec); err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	freed, err := removeWALBefore(l.dir, base)
+	q.lock()
+	l.bytes += info.Size() - freed
+	l.records -= records
+	q.unlock()
+	return err
+}
+
+// maybeCompactWAL starts a compaction if the settings of WithWALCompaction
+// call for one. The caller must hold q.mu exclusively.
+func (q *ThreadSafeQueue) maybeCompactWAL() {
+	l := q.wal
+	if l.ratio == 0 || l.compacting || l.f == nil || l.bytes < l.minBytes ||
+		float64(l.records) <= l.ratio*float64(q.len()) {
+		return
+	}
+	l.compacting = true
+	go func() {
+		err := q.CompactWAL()
+		q.lock()
+		l.compacting = false
+		if err != nil {
+			if q.logger != nil {
+				q.logLater(slog.LevelError, "write-ahead log compaction failed", nil, slog.String(LogKeyError, err.Error()))
+			}
+		} else {
+			q.maybeCompactWAL() // For the records written meanwhile.
+		}
+		q.unlock()
+	}()
+}
+
+// removeWALBefore deletes the segments up to base and the snapshots before
+// it, and returns the bytes they took.
+func removeWALBefore(dir string, base uint64) (int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	var freed int64
+	for _, e := range entries {
+		seq, ok := walSeq(e.Name(), walSegExt)
+		if !ok || seq > base {
+			seq, ok = walSeq(e.Name(), walSnapExt)
+			if !ok || seq >= base {
+				continue
+			}
+		}
+		info, err := e.Info()
+		if err != nil {
+			return freed, err
+		}
+		if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+			return freed, err
+		}
+		freed += info.Size()
+	}
+	return freed, nil
+}
+
+// walBytes returns the disk space taken by the log, if any. The caller must
+// hold q.mu.
+func (q *ThreadSafeQueue) walBytes() int64 {
+	if q.wal == nil {
+		return 0
+	}
+	return q.wal.bytes
+}
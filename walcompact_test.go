@@ -0,0 +1,238 @@
+package threadsafequeue
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// walFiles returns the names of the files in dir and their total size
+func walFiles(t *testing.T, dir string) ([]string, int64) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	var size int64
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, e.Name())
+		size += info.Size()
+	}
+	return names, size
+}
+
+// copyFiles copies the files of each source directory into a new directory
+func copyFiles(t *testing.T, srcs ...string) string {
+	t.Helper()
+	dst := t.TempDir()
+	for _, src := range srcs {
+		names, _ := walFiles(t, src)
+		for _, name := range names {
+			data, err := os.ReadFile(filepath.Join(src, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dst, name), data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return dst
+}
+
+// awaitCompaction waits for an automatic compaction to finish
+func awaitCompaction(t *testing.T, q *ThreadSafeQueue) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		q.mu.Lock()
+		compacting := q.wal.compacting
+		q.mu.Unlock()
+		if !compacting {
+			return
+		}
+	}
+	t.Fatal("Expected the automatic compaction to finish")
+}
+
+// Test that WithWALRotation starts new segments that recover as one log
+func TestWALRotation(t *testing.T) {
+	dir := t.TempDir()
+	q := NewThreadSafeQueue(WithWAL(dir, &intCodec{}, 0), WithWALRotation(0, 3))
+	for i := 0; i < 10; i++ {
+		q.Enqueue(i)
+	}
+	q.Dequeue()
+	names, size := walFiles(t, dir)
+	if len(names) != 4 {
+		t.Errorf("Expected 11 records in 4 segments, got %v", names)
+	}
+	if got := q.Stats().WALBytes; got != size {
+		t.Errorf("Expected WALBytes to be %d, got %d", size, got)
+	}
+	items, err := RecoverWAL(dir, &intCodec{})
+	if err != nil || !reflect.DeepEqual(items, q.ToSlice()) {
+		t.Errorf("Expected to recover %v, got %v and %v", q.ToSlice(), items, err)
+	}
+}
+
+// Test that CompactWAL replaces the consumed log with a snapshot
+func TestCompactWAL(t *testing.T) {
+	dir := t.TempDir()
+	q := NewThreadSafeQueue(WithWAL(dir, &intCodec{}, 0), WithWALRotation(0, 50))
+	for i := 0; i < 200; i++ {
+		q.Enqueue(i)
+	}
+	for i := 0; i < 190; i++ {
+		q.Dequeue()
+	}
+	before := q.Stats().WALBytes
+	if err := q.CompactWAL(); err != nil {
+		t.Fatalf("Expected CompactWAL to succeed, got %v", err)
+	}
+	names, size := walFiles(t, dir)
+	if len(names) != 2 || !strings.HasSuffix(names[0], walSnapExt) || !strings.HasSuffix(names[1], walSegExt) {
+		t.Errorf("Expected a snapshot and a new segment, got %v", names)
+	}
+	if got := q.Stats().WALBytes; got != size || got >= before {
+		t.Errorf("Expected WALBytes to drop from %d to the %d bytes on disk, got %d", before, size, got)
+	}
+
+	q.Enqueue(200)
+	q.Dequeue()
+	want := q.ToSlice()
+	restarted := NewThreadSafeQueue(WithWAL(dir, &intCodec{}, 0))
+	if got := restarted.ToSlice(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the compacted log to recover %v, got %v", want, got)
+	}
+	if _, size := walFiles(t, dir); restarted.Stats().WALBytes != size {
+		t.Errorf("Expected the recovered WALBytes to be %d, got %d", size, restarted.Stats().WALBytes)
+	}
+}
+
+// Test that a crash at any point of a compaction recovers the same items
+func TestCompactWALCrash(t *testing.T) {
+	dir := t.TempDir()
+	q := NewThreadSafeQueue(WithWAL(dir, &intCodec{}, 0), WithWALRotation(0, 4))
+	for i := 0; i < 20; i++ {
+		q.Enqueue(i)
+	}
+	for i := 0; i < 15; i++ {
+		q.Dequeue()
+	}
+	want := q.ToSlice()
+	before := copyFiles(t, dir)
+	if err := q.CompactWAL(); err != nil {
+		t.Fatalf("Expected CompactWAL to succeed, got %v", err)
+	}
+	after := copyFiles(t, dir)
+
+	written := copyFiles(t, before)
+	os.WriteFile(filepath.Join(written, "00000000000000000009.snap.123"+walTempExt), []byte("TSQS partial"), 0o644)
+	states := map[string]string{
+		"before the snapshot is renamed":      written,
+		"before the old segments are deleted": copyFiles(t, before, after),
+		"after the old segments are deleted":  after,
+	}
+	for when, dir := range states {
+		items, err := RecoverWAL(dir, &intCodec{})
+		if err != nil || !reflect.DeepEqual(items, want) {
+			t.Errorf("Expected a crash %s to recover %v, got %v and %v", when, want, items, err)
+		}
+		restarted := NewThreadSafeQueue(WithWAL(dir, &intCodec{}, 0))
+		if got := restarted.ToSlice(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected a queue restarted after a crash %s to hold %v, got %v", when, want, got)
+		}
+		names, _ := walFiles(t, dir)
+		var base uint64 // Zero without a snapshot.
+		for _, name := range names {
+			if seq, ok := walSeq(name, walSnapExt); ok {
+				base = seq
+			}
+		}
+		for _, name := range names {
+			if seq, ok := walSeq(name, walSegExt); strings.HasSuffix(name, walTempExt) || (ok && seq <= base) {
+				t.Errorf("Expected a restart after a crash %s to clean up, got %v", when, names)
+				break
+			}
+		}
+	}
+}
+
+// Test that compaction runs alongside enqueues and dequeues
+func TestCompactWALConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	q := NewThreadSafeQueue(WithWAL(dir, &intCodec{}, 0), WithWALRotation(0, 100), WithWALCompaction(0, 2))
+	var wg sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		wg.Add(2)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				q.Enqueue(p*2000 + i)
+			}
+		}(p)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1900; i++ {
+				q.Dequeue()
+			}
+		}()
+	}
+	stop := make(chan struct{})
+	compacted := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				compacted <- nil
+				return
+			default:
+			}
+			if err := q.CompactWAL(); err != nil {
+				compacted <- err
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	close(stop)
+	if err := <-compacted; err != nil {
+		t.Fatalf("Expected CompactWAL to succeed, got %v", err)
+	}
+	awaitCompaction(t, q)
+	items, err := RecoverWAL(dir, &intCodec{})
+	if err != nil || !reflect.DeepEqual(items, q.ToSlice()) {
+		t.Errorf("Expected the log to recover the %d items queued, got %d and %v", q.Size(), len(items), err)
+	}
+	if _, size := walFiles(t, dir); q.Stats().WALBytes != size {
+		t.Errorf("Expected WALBytes to be the %d bytes on disk, got %d", size, q.Stats().WALBytes)
+	}
+}
+
+// Test that WithWALCompaction compacts once the log is mostly consumed
+func TestWALAutoCompaction(t *testing.T) {
+	dir := t.TempDir()
+	q := NewThreadSafeQueue(WithWAL(dir, &intCodec{}, 0), WithWALRotation(0, 10), WithWALCompaction(500, 4))
+	for i := 0; i < 1000; i++ {
+		q.Enqueue(i)
+		q.Dequeue()
+	}
+	awaitCompaction(t, q)
+	if got := q.Stats().WALBytes; got >= 1000 {
+		t.Errorf("Expected automatic compaction to keep the log small, got %d bytes", got)
+	}
+	names, _ := walFiles(t, dir)
+	base, ok := walSeq(names[0], walSnapExt)
+	if seq, _ := walSeq(names[1], walSegExt); !ok || seq != base+1 {
+		t.Errorf("Expected a snapshot and only the segments after it, got %v", names)
+	}
+}
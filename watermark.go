@@ -0,0 +1,52 @@
+package threadsafequeue
+
+// WithWatermarks makes the queue call onHigh when its size rises above high,
+// and onLow when it then falls below low, so that producers can shed load
+// and resume without flapping: after onHigh, neither callback is called
+// again until the size has fallen below low, and after onLow, not until it
+// has risen above high again. Either callback may be nil.
+//
+// Crossings are detected inside the critical section of every operation that
+// changes the size, one item at a time, so no edge is missed however quickly
+// the size moves. The callbacks are called with the size at the crossing,
+// after the lock is released, like the hooks of WithEnqueueHook. It panics
+// if low is greater than high.
+func WithWatermarks(high, low int, onHigh func(size int), onLow func(size int)) Option {
+	if low > high {
+		panic("threadsafequeue: low watermark above the high watermark")
+	}
+	return func(q *ThreadSafeQueue) {
+		m := &watermarks{high: high, low: low}
+		m.onHigh = func(_ interface{}, size int) {
+			if onHigh != nil {
+				onHigh(size)
+			}
+		}
+		m.onLow = func(_ interface{}, size int) {
+			if onLow != nil {
+				onLow(size)
+			}
+		}
+		q.marks = m
+	}
+}
+
+// watermarks is the state behind WithWatermarks, protected by the queue's
+// lock.
+type watermarks struct {
+	high, low     int
+	onHigh, onLow func(interface{}, int)
+	above         bool // The size rose above high and has not fallen below low since.
+}
+
+// check reports a crossing of the watermarks by the size n of q. The caller
+// must hold q.mu exclusively.
+func (m *watermarks) check(q *ThreadSafeQueue, n int) {
+	if !m.above && n > m.high {
+		m.above = true
+		q.hookLater(nil, n, hookHigh)
+	} else if m.above && n < m.low {
+		m.above = false
+		q.hookLater(nil, n, hookLow)
+	}
+}
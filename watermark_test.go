@@ -0,0 +1,81 @@
+package threadsafequeue
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// Test that each crossing of the watermarks calls one callback, and that
+// moves between them call none
+func TestWatermarks(t *testing.T) {
+	var calls []string
+	q := NewThreadSafeQueue(WithWatermarks(3, 1,
+		func(size int) { calls = append(calls, fmt.Sprint("high ", size)) },
+		func(size int) { calls = append(calls, fmt.Sprint("low ", size)) }))
+	for i := 0; i < 5; i++ {
+		q.Enqueue(i) // Crosses above 3 at 4.
+	}
+	q.TryDequeue()
+	q.TryDequeue()
+	q.Enqueue(5) // Back to 4 without having fallen below 1.
+	q.TryDequeue()
+	q.TryDequeue()
+	q.TryDequeue() // 1 is not below 1.
+	q.TryDequeue() // Crosses below 1 at 0.
+	q.Enqueue(6)
+	q.TryDequeue() // Already low.
+	q.EnqueueBatch(1, 2, 3, 4, 5)
+	q.Drain()
+
+	want := []string{"high 4", "low 0", "high 4", "low 0"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("Expected callbacks %q, but got %q", want, calls)
+	}
+}
+
+// Test that a spike handed straight to parked consumers still crosses the
+// watermarks, since it is tracked item by item
+func TestWatermarksSpike(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	q := NewThreadSafeQueue(WithWatermarks(1, 1,
+		func(size int) {
+			mu.Lock()
+			calls = append(calls, fmt.Sprint("high ", size))
+			mu.Unlock()
+		},
+		func(size int) {
+			mu.Lock()
+			calls = append(calls, fmt.Sprint("low ", size))
+			mu.Unlock()
+		}))
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.Dequeue()
+		}()
+	}
+	awaitCount(t, func() int { return q.Stats().WaitingConsumers }, 2)
+	q.EnqueueBatch(1, 2) // The size reaches 2 before the consumers take both.
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"high 2", "low 0"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("Expected callbacks %q, but got %q", want, calls)
+	}
+}
+
+// Test that a low watermark above the high one panics
+func TestWatermarksInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected WithWatermarks to panic")
+		}
+	}()
+	WithWatermarks(1, 2, nil, nil)
+}
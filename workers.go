@@ -0,0 +1,682 @@
+package threadsafequeue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrHandlerTimeout is reported by RunWorkers for an item whose handler ran
+// longer than WithHandlerTimeout allows, and is the cause of the handler's
+// context then.
+var ErrHandlerTimeout = errors.New("threadsafequeue: handler timed out")
+
+// PanicError is the error of an item whose handler panicked in a worker pool
+// run by RunWorkers.
+type PanicError struct {
+	Item  interface{} // The item being handled.
+	Value interface{} // The value the handler panicked with.
+	Stack []byte      // The stack of the worker at the panic.
+}
+
+// Error implements the error interface.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("threadsafequeue: handler panicked on %v: %v\n\n%s", e.Item, e.Value, e.Stack)
+}
+
+// Unwrap returns the value the handler panicked with, if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// WorkerOption configures a worker pool run by RunWorkers or RunTasks.
+type WorkerOption func(*workerPool)
+
+// WithWorkerErrorHandler calls fn with every item the handler of RunWorkers
+// fails on, instead of collecting the errors for RunWorkers to return. It is
+// called from the worker goroutines, so it must be safe for concurrent use.
+func WithWorkerErrorHandler(fn func(item interface{}, err error)) WorkerOption {
+	return func(p *workerPool) {
+		p.onError = fn
+	}
+}
+
+// WithDeadLetterQueue enqueues on dlq every item whose handler panicked or
+// timed out, or, with WithRetry, that failed its last attempt, so that it can
+// be inspected or retried later, in addition to reporting its error.
+func WithDeadLetterQueue(dlq *ThreadSafeQueue) WorkerOption {
+	return func(p *workerPool) {
+		p.dlq = dlq
+	}
+}
+
+// WithHandlerTimeout limits each handler call to d: the handler's context
+// gets that deadline, with ErrHandlerTimeout as its cause, and if the
+// handler has not returned by then the pool reports ErrHandlerTimeout for
+// the item and moves on without it. Since a goroutine cannot be stopped from
+// outside, a handler that ignores its context keeps running: its worker is
+// abandoned, and counted in Stats.AbandonedWorkers until the handler
+// returns, and a new worker takes its place, so that n workers keep taking
+// items. Whatever the abandoned handler returns is discarded. It panics if d
+// is not positive.
+func WithHandlerTimeout(d time.Duration) WorkerOption {
+	if d <= 0 {
+		panic("threadsafequeue: WithHandlerTimeout needs a positive duration")
+	}
+	return func(p *workerPool) {
+		p.timeout = d
+	}
+}
+
+// WithStopOnError makes the first failed item stop the pool, as an
+// errgroup does, instead of reporting it and going on: workers take no
+// further items, those already handed to the handler are finished, with
+// their context left alone, and RunWorkers returns the error of the first
+// failure. The items that were not taken stay in the queue. A failure is a
+// handler error, a panic or, with WithHandlerTimeout, a timeout; every
+// failure is still passed to the function given to WithWorkerErrorHandler.
+func WithStopOnError(enabled bool) WorkerOption {
+	return func(p *workerPool) {
+		p.stopOnError = enabled
+	}
+}
+
+// WithKeyFunc lets at most one handler run at a time for the items of each
+// key(item), such as the resources they write to, while items of different
+// keys are handled in parallel. An item whose key is busy is held back, and
+// the worker moves on to the next item; once the handler of the key
+// returns, that worker goes on with the items held back for it, in the
+// order they were dequeued. Items held back have been taken from the queue,
+// so the pool finishes them even when it stops. A handler abandoned after
+// WithHandlerTimeout no longer counts for its key.
+func WithKeyFunc(key func(item interface{}) string) WorkerOption {
+	return func(p *workerPool) {
+		p.key = key
+	}
+}
+
+// WithRetry calls the handler again with an item it failed on, up to
+// maxAttempts calls in all, instead of reporting the failure at once. The
+// retry after the nth failed attempt waits base*2^(n-1), capped at max; with
+// jitter, a random part of up to half of that is taken off, drawn as
+// WithRand sets. The item waits on a timer of the queue's clock, not in a
+// worker, so workers go on with other items meanwhile, and retries take
+// precedence over new items once due. The item is reported as failed, with
+// the error of its last attempt, once no attempt is left, or if the pool
+// stops while it waits. Handlers learn the attempt from DeliveryFromContext.
+// Panics and timeouts are retried like errors. It panics unless
+// maxAttempts >= 1 and 0 < base <= max.
+func WithRetry(maxAttempts int, base, max time.Duration, jitter bool) WorkerOption {
+	if maxAttempts < 1 || base <= 0 || max < base {
+		panic("threadsafequeue: WithRetry needs maxAttempts >= 1 and 0 < base <= max")
+	}
+	return func(p *workerPool) {
+		p.retry = &retryPolicy{attempts: maxAttempts, base: base, max: max, jitter: jitter}
+	}
+}
+
+// Delivery describes a call of the handler of RunWorkers, as returned by
+// DeliveryFromContext.
+type Delivery struct {
+	Attempt     int // 1 for the first call with the item, 2 for its first retry, and so on.
+	MaxAttempts int // The number of attempts WithRetry allows.
+}
+
+// deliveryKey is the context key of a Delivery.
+type deliveryKey struct{}
+
+// DeliveryFromContext returns the Delivery of a handler call of RunWorkers,
+// from the context passed to the handler, so that it can tell a retry from a
+// first attempt or act differently on the last one. The boolean value is
+// false if ctx is not such a context, or the pool has no WithRetry.
+func DeliveryFromContext(ctx context.Context) (Delivery, bool) {
+	d, ok := ctx.Value(deliveryKey{}).(Delivery)
+	return d, ok
+}
+
+// retryPolicy is the state behind WithRetry.
+type retryPolicy struct {
+	attempts  int
+	base, max time.Duration
+	jitter    bool
+}
+
+// delay returns how long to wait before the retry after attempt failed.
+func (r *retryPolicy) delay(q *ThreadSafeQueue, attempt int) time.Duration {
+	d := r.base
+	for i := 1; i < attempt && d < r.max; i++ {
+		d *= 2
+	}
+	d = min(d, r.max)
+	if r.jitter {
+		q.lock()
+		d -= time.Duration(q.random() * float64(d/2))
+		q.unlock()
+	}
+	return d
+}
+
+// workItem is an item taken by a worker pool, with the number of the
+// attempt at it and, for a retry, the error of the previous one.
+type workItem struct {
+	item    interface{}
+	attempt int
+	err     error
+	trial   bool // The trial item of a half-open circuit breaker.
+	future  *Future
+}
+
+// workerPool is the state of one RunWorkers call.
+type workerPool struct {
+	q           *ThreadSafeQueue
+	handler     func(ctx context.Context, item interface{}) (interface{}, error)
+	onError     func(item interface{}, err error) // Set by WithWorkerErrorHandler.
+	dlq         *ThreadSafeQueue                  // Set by WithDeadLetterQueue.
+	timeout     time.Duration                     // Set by WithHandlerTimeout.
+	key         func(item interface{}) string     // Set by WithKeyFunc.
+	retry       *retryPolicy                      // Set by WithRetry.
+	breaker     *breaker                          // Set by WithCircuitBreaker.
+	breakerHook func(state BreakerState)          // Set by WithBreakerHook.
+	scale       *autoscale                        // Set by WithAutoscale.
+	itemLabel   func(item interface{}) string     // Set by WithItemLabel.
+	wg          sync.WaitGroup                    // One count per running worker.
+
+	stopOnError bool               // Set by WithStopOnError.
+	stop        context.CancelFunc // Stops the workers taking items, with WithStopOnError.
+
+	ctx, next context.Context // Passed to the handlers, and taking items while not done.
+
+	mu     sync.Mutex
+	active int                        // Running workers, each holding a count of wg.
+	nextID int                        // Index of the next worker started.
+	errs   []error                    // Handler errors, without WithWorkerErrorHandler.
+	first  error                      // The first failure, with WithStopOnError.
+	busy   map[string]*ring[workItem] // Keys being handled, with the items held back for them.
+
+	// With WithRetry, workers wait on both the queue and the retries that
+	// are due, and stop once the queue is closed and drained and no item
+	// is still in progress.
+	waiting   []chan struct{}     // Notifiers of the workers, also registered with the queue.
+	pending   int                 // Items taken and not yet handled for good.
+	scheduled map[*workItem]Timer // Retries waiting for their delay.
+	due       ring[workItem]      // Retries whose delay is over.
+}
+
+// worker is a goroutine of a worker pool.
+type worker struct {
+	index  int
+	ctx    context.Context    // Passed to the handlers, carrying the profiler labels of the worker.
+	next   context.Context    // The worker takes items while next is not done.
+	retire context.CancelFunc // Cancels next, with WithAutoscale.
+}
+
+// States of a handler call under WithHandlerTimeout, decided once.
+const (
+	callRunning int32 = iota
+	callReturned
+	callTimedOut
+)
+
+// RunWorkers runs a pool of n workers, each dequeuing items and calling
+// handler with them, and returns once every worker has stopped: when the
+// queue is closed and drained, or when ctx is done. Cancelling ctx is an
+// orderly way to stop the pool and is not reported as an error; handlers
+// get a context that is done then too, and workers take no further items
+// after their current one. A worker count below one is taken as one; with
+// WithAutoscale, n is only the count the pool starts with.
+//
+// By default, an error from handler does not stop the pool. It is passed
+// with its item to the function given to WithWorkerErrorHandler, if any, and
+// otherwise kept, so that RunWorkers returns all of them joined with
+// errors.Join, or nil if there were none. A panic in handler does not stop
+// the pool either: it is recovered, counted in Stats.WorkerPanics and
+// reported like an error, as a *PanicError carrying the stack, and the
+// worker goes on with the next item. No goroutine of the pool outlives the
+// call, except for handlers abandoned after WithHandlerTimeout. With
+// WithRetry, failed items are retried before they are reported; with
+// WithStopOnError, the first failure stops the pool.
+//
+// So that CPU and goroutine profiles tell the pools of a process apart, each
+// worker runs under the pprof labels threadsafequeue.worker, its index, and
+// threadsafequeue.queue, the name set by WithName, if any. The labels are
+// set once per worker, and are in the handler's context too, so that the
+// handler's own pprof.Do adds to them.
+//
+// Items enqueued by Submit have their future completed with the error of the
+// handler, and a nil result; RunTasks gives results.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) RunWorkers(ctx context.Context, n int, handler func(ctx context.Context, item interface{}) error, opts ...WorkerOption) error {
+	return q.RunTasks(ctx, n, func(ctx context.Context, item interface{}) (interface{}, error) {
+		return nil, handler(ctx, item)
+	}, opts...)
+}
+
+// RunTasks is like RunWorkers, but handler returns a result besides its
+// error. Once the pool is done with an item enqueued by Submit, after any
+// retries, the item's Future completes with the result of the last call, or
+// with its error if it failed, panicked or timed out.
+// This method is safe for concurrent use.
+func (q *ThreadSafeQueue) RunTasks(ctx context.Context, n int, handler func(ctx context.Context, item interface{}) (interface{}, error), opts ...WorkerOption) error {
+	if n < 1 {
+		n = 1
+	}
+	p := &workerPool{q: q, handler: handler}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.key != nil {
+		p.busy = make(map[string]*ring[workItem])
+	}
+	if p.retry != nil {
+		p.scheduled = make(map[*workItem]Timer)
+	}
+
+	p.ctx, p.next = ctx, ctx
+	if p.stopOnError {
+		p.next, p.stop = context.WithCancel(ctx)
+		defer p.stop()
+	}
+
+	p.mu.Lock()
+	if p.scale != nil {
+		n = min(max(n, p.scale.min), p.scale.max)
+	}
+	for i := 0; i < n; i++ {
+		p.spawn()
+	}
+	if p.scale != nil {
+		p.startAutoscale()
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+	if p.scale != nil {
+		p.stopAutoscale()
+	}
+	if p.breaker != nil {
+		p.stopBreaker()
+	}
+	if p.retry != nil {
+		p.abandonRetries()
+	}
+	if p.stopOnError {
+		return p.first
+	}
+	return errors.Join(p.errs...)
+}
+
+// spawn starts a worker. The caller must hold p.mu, and the pool must have a
+// running worker unless it is starting.
+func (p *workerPool) spawn() {
+	w := &worker{index: p.nextID, next: p.next}
+	p.nextID++
+	if p.scale != nil {
+		w.next, w.retire = context.WithCancel(p.next)
+		p.scale.workers[w] = struct{}{}
+	}
+	p.active++
+	p.wg.Add(1)
+	p.q.lock()
+	p.q.workers++
+	p.q.unlock()
+	go pprof.Do(p.ctx, p.labels(w), func(ctx context.Context) {
+		w.ctx = ctx
+		p.work(w)
+	})
+}
+
+// exit records that w stopped, and releases its count of p.wg.
+func (p *workerPool) exit(w *worker) {
+	p.mu.Lock()
+	p.active--
+	if p.scale != nil {
+		delete(p.scale.workers, w)
+		w.retire()
+	}
+	p.mu.Unlock()
+	p.q.lock()
+	p.q.workers--
+	if p.q.workers == 0 && p.q.closed {
+		p.q.stranded()
+	}
+	p.q.unlock()
+	p.wg.Done()
+}
+
+// work is the loop of worker w, which takes items until w.next is done and
+// calls the handler with w.ctx. It holds one count of p.wg until it stops,
+// or hands it over to its replacement when it is abandoned.
+func (p *workerPool) work(w *worker) {
+	next := w.next
+	var notify chan struct{}
+	if p.retry != nil {
+		notify = p.register()
+		defer p.unregister(notify)
+	}
+	for next.Err() == nil {
+		var trial bool
+		if p.breaker != nil {
+			var ok bool
+			if trial, ok = p.admit(next); !ok {
+				break
+			}
+		}
+		var j workItem
+		if p.retry != nil {
+			var ok bool
+			j, ok = p.take(next, notify)
+			if !ok {
+				if trial {
+					p.noTrial()
+				}
+				break
+			}
+		} else {
+			item, x, err := p.q.dequeueContext(next, true)
+			if err != nil {
+				if trial {
+					p.noTrial()
+				}
+				break // Cancelled, stopped, or closed and drained.
+			}
+			j = workItem{item: item, attempt: 1, future: x.future}
+		}
+		j.trial = trial
+		var key string
+		if p.key != nil {
+			key = p.key(j.item)
+			if !p.acquire(key, j) {
+				continue // Held back for the worker handling key.
+			}
+		}
+		if !p.serve(w, key, j) {
+			return
+		}
+	}
+	p.exit(w)
+}
+
+// serve handles j and then, with WithKeyFunc, the items held back for its
+// key until there are none left, releasing the key. It returns false if the
+// worker was abandoned, in which case its replacement goes on with the key.
+func (p *workerPool) serve(w *worker, key string, j workItem) bool {
+	for ok := true; ok; j, ok = p.heldBack(key) {
+		if p.timeout > 0 {
+			if !p.handleTimed(w, key, j) {
+				return false
+			}
+			continue
+		}
+		result, panicked, err := p.call(w.ctx, j)
+		p.handle(j, result, panicked, err)
+	}
+	return true
+}
+
+// acquire marks key as being handled and returns true, or holds j back and
+// returns false if it already is.
+func (p *workerPool) acquire(key string, j workItem) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	held, busy := p.busy[key]
+	if !busy {
+		p.busy[key] = nil
+		return true
+	}
+	if held == nil {
+		held = new(ring[workItem])
+		p.busy[key] = held
+	}
+	held.pushBack(j)
+	return false
+}
+
+// heldBack returns the next item held back for key, or releases the key
+// and returns false if there is none. Without WithKeyFunc, it always
+// returns false.
+func (p *workerPool) heldBack(key string) (workItem, bool) {
+	if p.key == nil {
+		return workItem{}, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if held := p.busy[key]; held != nil && held.len() > 0 {
+		return held.popFront()
+	}
+	delete(p.busy, key)
+	return workItem{}, false
+}
+
+// handleTimed calls the handler with j under WithHandlerTimeout. It returns
+// false if the call timed out, in which case a replacement worker has been
+// started and the caller must stop without releasing p.wg.
+func (p *workerPool) handleTimed(w *worker, key string, j workItem) bool {
+	hctx, cancel := context.WithTimeoutCause(w.ctx, p.timeout, ErrHandlerTimeout)
+	defer cancel()
+	var state atomic.Int32
+	stop := context.AfterFunc(hctx, func() {
+		if context.Cause(hctx) != ErrHandlerTimeout || !state.CompareAndSwap(callRunning, callTimedOut) {
+			return // Cancelled from outside, or returned just in time.
+		}
+		p.q.lock()
+		p.q.abandoned++
+		p.q.unlock()
+		p.handle(j, nil, false, ErrHandlerTimeout)
+		go func() { // Takes over w, the key and the count of p.wg of the abandoned worker.
+			pprof.SetGoroutineLabels(w.ctx)
+			if j, ok := p.heldBack(key); !ok || p.serve(w, key, j) {
+				p.work(w)
+			}
+		}()
+	})
+	defer stop()
+	result, panicked, err := p.call(hctx, j)
+	if !state.CompareAndSwap(callRunning, callReturned) {
+		p.q.lock()
+		p.q.abandoned--
+		p.q.unlock()
+		return false
+	}
+	p.handle(j, result, panicked, err)
+	return true
+}
+
+// handle deals with the outcome of the handler call for j: it schedules a
+// retry, or reports the error, if any, or else completes the future of j
+// with the result.
+func (p *workerPool) handle(j workItem, result interface{}, panicked bool, err error) {
+	if panicked {
+		p.q.lock()
+		p.q.workerPanics++
+		p.q.unlock()
+	}
+	if p.breaker != nil {
+		p.record(j.trial, err != nil)
+	}
+	if err != nil && p.retry != nil && j.attempt < p.retry.attempts {
+		p.scheduleRetry(j, err)
+		return
+	}
+	if err != nil {
+		p.fail(j, err, panicked || err == ErrHandlerTimeout || p.retry != nil)
+	} else {
+		j.future.complete(result, nil)
+	}
+	if p.retry != nil {
+		p.finished()
+	}
+}
+
+// fail reports the failure of j for good, completing its future with err and
+// sending its item to the dead letter queue too if dead.
+func (p *workerPool) fail(j workItem, err error, dead bool) {
+	j.future.complete(nil, err)
+	item := j.item
+	if p.stopOnError {
+		p.mu.Lock()
+		if p.first == nil {
+			p.first = err
+		}
+		p.mu.Unlock()
+		p.stop()
+	}
+	if p.dlq != nil && dead {
+		p.dlq.Enqueue(item)
+	}
+	if p.onError != nil {
+		p.onError(item, err)
+		return
+	}
+	if p.stopOnError {
+		return // Only the first failure is returned.
+	}
+	p.mu.Lock()
+	p.errs = append(p.errs, err)
+	p.mu.Unlock()
+}
+
+// call calls the handler with j, recovering a panic as a *PanicError.
+func (p *workerPool) call(ctx context.Context, j workItem) (result interface{}, panicked bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, panicked, err = nil, true, &PanicError{Item: j.item, Value: r, Stack: debug.Stack()}
+		}
+	}()
+	if p.retry != nil {
+		ctx = context.WithValue(ctx, deliveryKey{}, Delivery{Attempt: j.attempt, MaxAttempts: p.retry.attempts})
+	}
+	if p.itemLabel != nil {
+		pprof.Do(ctx, pprof.Labels(labelItem, p.itemLabel(j.item)), func(ctx context.Context) {
+			result, err = p.handler(ctx, j.item)
+		})
+		return result, false, err
+	}
+	result, err = p.handler(ctx, j.item)
+	return result, false, err
+}
+
+// register adds a notifier for a worker, woken when the queue or the
+// retries may have an item for it.
+func (p *workerPool) register() chan struct{} {
+	notify := make(chan struct{}, 1)
+	p.q.addNotifier(notify)
+	p.mu.Lock()
+	p.waiting = append(p.waiting, notify)
+	p.mu.Unlock()
+	return notify
+}
+
+// unregister removes a notifier added by register.
+func (p *workerPool) unregister(notify chan struct{}) {
+	p.q.removeNotifier(notify)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, ch := range p.waiting {
+		if ch == notify {
+			p.waiting = append(p.waiting[:i], p.waiting[i+1:]...)
+			return
+		}
+	}
+}
+
+// wake sends a token to every worker that does not already hold one. The
+// caller must hold p.mu.
+func (p *workerPool) wake() {
+	for _, ch := range p.waiting {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// take returns the next item for a worker under WithRetry: a retry that is
+// due, or else an item from the queue. It returns false once next is done,
+// or the queue is closed and drained with no item in progress.
+func (p *workerPool) take(next context.Context, notify chan struct{}) (workItem, bool) {
+	for {
+		p.mu.Lock()
+		if j, ok := p.due.popFront(); ok {
+			p.mu.Unlock()
+			return j, true
+		}
+		p.mu.Unlock()
+		item, x, ok, closed := p.q.pollClaim()
+		p.mu.Lock()
+		if ok {
+			p.pending++
+			p.mu.Unlock()
+			return workItem{item: item, attempt: 1, future: x.future}, true
+		}
+		idle := p.pending == 0
+		p.mu.Unlock()
+		if closed && idle {
+			return workItem{}, false
+		}
+		select {
+		case <-notify:
+		case <-next.Done():
+			return workItem{}, false
+		}
+	}
+}
+
+// finished records that an item taken under WithRetry was handled for good.
+func (p *workerPool) finished() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending--; p.pending == 0 {
+		p.wake() // The workers may stop if the queue is drained.
+	}
+}
+
+// scheduleRetry arranges for j to be retried after the delay for its
+// attempt, err being the error of the attempt.
+func (p *workerPool) scheduleRetry(j workItem, err error) {
+	r := &workItem{item: j.item, attempt: j.attempt + 1, err: err, future: j.future}
+	d := p.retry.delay(p.q, j.attempt)
+	p.mu.Lock()
+	p.scheduled[r] = nil
+	p.mu.Unlock()
+	t := p.q.clock.AfterFunc(d, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if _, ok := p.scheduled[r]; !ok {
+			return // The pool stopped meanwhile.
+		}
+		delete(p.scheduled, r)
+		p.due.pushBack(*r)
+		p.wake()
+	})
+	p.mu.Lock()
+	if _, ok := p.scheduled[r]; ok {
+		p.scheduled[r] = t
+	}
+	p.mu.Unlock()
+}
+
+// abandonRetries reports the retries left when the pool stopped as failed,
+// with the error of their last attempt.
+func (p *workerPool) abandonRetries() {
+	p.mu.Lock()
+	var left []workItem
+	for r, t := range p.scheduled {
+		if t != nil {
+			t.Stop()
+		}
+		left = append(left, *r)
+	}
+	clear(p.scheduled)
+	for j, ok := p.due.popFront(); ok; j, ok = p.due.popFront() {
+		left = append(left, j)
+	}
+	p.mu.Unlock()
+	for _, j := range left {
+		p.fail(j, j.err, true)
+	}
+}
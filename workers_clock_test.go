@@ -0,0 +1,112 @@
+package threadsafequeue_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	queue "github.com/sandeepkv93/threadsafequeue"
+	"github.com/sandeepkv93/threadsafequeue/queuetest"
+)
+
+// Test that RunWorkers retries a failing item on the exact backoff
+// schedule, with and without jitter, and gives up after the last attempt
+func TestFakeClockRetryBackoff(t *testing.T) {
+	for _, c := range []struct {
+		jitter bool
+		delays []time.Duration
+	}{
+		{false, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond}},
+		{true, []time.Duration{7500 * time.Microsecond, 15 * time.Millisecond, 30 * time.Millisecond, 37500 * time.Microsecond}},
+	} {
+		clock := queuetest.NewFakeClock(epoch)
+		q := queue.NewThreadSafeQueue(queue.WithClock(clock), queue.WithRand(func() float64 { return 0.5 }))
+		dlq := queue.NewThreadSafeQueue()
+		errFail := errors.New("fail")
+		attempts := make(chan queue.Delivery, 5)
+		result := make(chan error, 1)
+		go func() {
+			result <- q.RunWorkers(context.Background(), 1, func(ctx context.Context, item interface{}) error {
+				d, _ := queue.DeliveryFromContext(ctx)
+				attempts <- d
+				return errFail
+			}, queue.WithRetry(5, 10*time.Millisecond, 50*time.Millisecond, c.jitter), queue.WithDeadLetterQueue(dlq))
+		}()
+		q.Enqueue("item")
+		q.Close()
+		if d := <-attempts; d.Attempt != 1 || d.MaxAttempts != 5 {
+			t.Fatalf("Expected attempt 1 of 5, got %+v", d)
+		}
+		for i, delay := range c.delays {
+			clock.BlockUntilTimers(1)
+			clock.Advance(delay - time.Nanosecond)
+			if clock.Timers() != 1 {
+				t.Fatalf("Expected retry %d to wait %v, but it came earlier (jitter %v)", i+1, delay, c.jitter)
+			}
+			clock.Advance(time.Nanosecond)
+			if d := <-attempts; d.Attempt != i+2 {
+				t.Errorf("Expected attempt %d, got %d (jitter %v)", i+2, d.Attempt, c.jitter)
+			}
+		}
+		if err := <-result; !errors.Is(err, errFail) {
+			t.Errorf("Expected the last attempt's error, got %v", err)
+		}
+		if dlq.Size() != 1 || clock.Timers() != 0 {
+			t.Errorf("Expected the item in the dead letter queue and no retry left, got %d and %d timers", dlq.Size(), clock.Timers())
+		}
+	}
+}
+
+// Test that an autoscaled pool grows to its maximum during a burst its
+// workers cannot keep up with and shrinks back to its minimum once idle
+func TestFakeClockAutoscale(t *testing.T) {
+	clock := queuetest.NewFakeClock(epoch)
+	q := queue.NewThreadSafeQueue(queue.WithClock(clock))
+	tokens := make(chan struct{}) // Each lets one handler call return.
+	result := make(chan error, 1)
+	go func() {
+		result <- q.RunWorkers(context.Background(), 1, func(ctx context.Context, item interface{}) error {
+			<-tokens
+			return nil
+		}, queue.WithAutoscale(1, 8, time.Second, time.Second))
+	}()
+	enqueued, handled := 0, 0
+	prev := 1
+	for i := 0; i < 10; i++ { // A burst of 40 items a second, 10 of them handled.
+		for j := 0; j < 40; j++ {
+			q.Enqueue(enqueued)
+			enqueued++
+		}
+		for j := 0; j < 10; j++ {
+			tokens <- struct{}{}
+			handled++
+		}
+		clock.Advance(time.Second)
+		n := q.Workers()
+		if n < prev {
+			t.Fatalf("Expected the workers not to shrink during the burst, got %d after %d", n, prev)
+		}
+		prev = n
+	}
+	if prev != 8 {
+		t.Fatalf("Expected the pool to grow to 8 workers during the burst, got %d", prev)
+	}
+	for ; handled < enqueued; handled++ {
+		tokens <- struct{}{}
+	}
+	for i := 0; i < 10; i++ {
+		clock.Advance(time.Second)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for q.Stats().Workers != 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := q.Stats().Workers; n != 1 {
+		t.Errorf("Expected the idle pool to shrink back to 1 worker, got %d", n)
+	}
+	q.Close()
+	if err := <-result; err != nil || q.Workers() != 0 {
+		t.Errorf("Expected the pool to stop cleanly, got %v with %d workers", err, q.Workers())
+	}
+}
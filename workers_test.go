@@ -0,0 +1,491 @@
+package threadsafequeue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// awaitGoroutines fails the test unless the number of goroutines falls back
+// to before.
+func awaitGoroutines(t *testing.T, before int) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > before && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("Expected at most %d goroutines once the pool stopped, got %d", before, n)
+	}
+}
+
+// Test that the pool processes every item and returns the handler errors
+// joined, once the queue is closed and drained
+func TestRunWorkers(t *testing.T) {
+	q := NewThreadSafeQueue()
+	for i := 0; i < 100; i++ {
+		q.Enqueue(i)
+	}
+	q.Close()
+	var sum atomic.Int64
+	errOdd := errors.New("odd")
+	err := q.RunWorkers(context.Background(), 4, func(ctx context.Context, item interface{}) error {
+		sum.Add(int64(item.(int)))
+		if item.(int)%10 == 1 {
+			return fmt.Errorf("item %d: %w", item, errOdd)
+		}
+		return nil
+	})
+	if sum.Load() != 4950 {
+		t.Errorf("Expected every item to be handled, but the sum is %d", sum.Load())
+	}
+	if !errors.Is(err, errOdd) {
+		t.Fatalf("Expected the handler errors, but got %v", err)
+	}
+	if n := len(err.(interface{ Unwrap() []error }).Unwrap()); n != 10 {
+		t.Errorf("Expected 10 errors joined, but got %d", n)
+	}
+}
+
+// Test that WithWorkerErrorHandler receives the failed items instead of the
+// returned error
+func TestRunWorkersErrorHandler(t *testing.T) {
+	q := NewThreadSafeQueue()
+	q.EnqueueBatch(1, 2, 3)
+	q.Close()
+	var mu sync.Mutex
+	var failed []interface{}
+	err := q.RunWorkers(context.Background(), 2, func(ctx context.Context, item interface{}) error {
+		if item == 2 {
+			return errors.New("two")
+		}
+		return nil
+	}, WithWorkerErrorHandler(func(item interface{}, err error) {
+		mu.Lock()
+		failed = append(failed, item)
+		mu.Unlock()
+	}))
+	if err != nil {
+		t.Errorf("Expected no error with a handler, but got %v", err)
+	}
+	if len(failed) != 1 || failed[0] != 2 {
+		t.Errorf("Expected the handler to get item 2, but got %v", failed)
+	}
+}
+
+// Test that closing the queue and then cancelling the context stops the
+// pool without leaking goroutines
+func TestRunWorkersCloseThenCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+	q := NewThreadSafeQueue()
+	ctx, cancel := context.WithCancel(context.Background())
+	var handled atomic.Int32
+	done := make(chan error, 1)
+	go func() {
+		done <- q.RunWorkers(ctx, 4, func(ctx context.Context, item interface{}) error {
+			handled.Add(1)
+			return nil
+		})
+	}()
+	for i := 0; i < 20; i++ {
+		q.Enqueue(i)
+	}
+	q.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected a clean stop, but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the pool to stop once the queue was drained")
+	}
+	cancel()
+	if handled.Load() != 20 {
+		t.Errorf("Expected 20 items handled, but got %d", handled.Load())
+	}
+	awaitGoroutines(t, before)
+}
+
+// Test that cancelling the context stops the pool while items remain, with
+// handlers seeing the cancellation, and that closing afterwards is harmless
+func TestRunWorkersCancelThenClose(t *testing.T) {
+	before := runtime.NumGoroutine()
+	q := NewThreadSafeQueue()
+	for i := 0; i < 20; i++ {
+		q.Enqueue(i)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{}, 20)
+	done := make(chan error, 1)
+	go func() {
+		done <- q.RunWorkers(ctx, 2, func(ctx context.Context, item interface{}) error {
+			started <- struct{}{}
+			<-ctx.Done() // Stuck until cancelled.
+			return ctx.Err()
+		})
+	}()
+	<-started
+	<-started
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected the handlers' cancellation errors, but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the pool to stop once cancelled")
+	}
+	q.Close()
+	if n := q.Size(); n != 18 {
+		t.Errorf("Expected 18 items left after the cancel, but got %d", n)
+	}
+	awaitGoroutines(t, before)
+}
+
+// Test that handler panics are recovered as errors with the stack, counted,
+// and sent to the dead letter queue, while the rest of the items are still
+// processed by the full pool
+func TestRunWorkersPanic(t *testing.T) {
+	before := runtime.NumGoroutine()
+	q, dlq := NewThreadSafeQueue(), NewThreadSafeQueue()
+	for i := 0; i < 100; i++ {
+		q.Enqueue(i)
+	}
+	q.Close()
+	var handled atomic.Int32
+	errBad := errors.New("bad item")
+	err := q.RunWorkers(context.Background(), 4, func(ctx context.Context, item interface{}) error {
+		switch {
+		case item.(int)%25 == 7:
+			panic(errBad)
+		case item.(int)%25 == 8:
+			var m map[string]int
+			m["boom"]++ // A runtime panic.
+		}
+		handled.Add(1)
+		return nil
+	}, WithDeadLetterQueue(dlq))
+	if handled.Load() != 92 {
+		t.Errorf("Expected the other 92 items handled, but got %d", handled.Load())
+	}
+	errs := err.(interface{ Unwrap() []error }).Unwrap()
+	if len(errs) != 8 {
+		t.Fatalf("Expected 8 panics reported, but got %d", len(errs))
+	}
+	var pe *PanicError
+	if !errors.As(errs[0], &pe) || !strings.Contains(string(pe.Stack), "workers_test.go") {
+		t.Errorf("Expected a *PanicError with the stack, but got %v", errs[0])
+	}
+	if !errors.Is(err, errBad) {
+		t.Errorf("Expected to find the panic value, but got %v", err)
+	}
+	if n := q.Stats().WorkerPanics; n != 8 {
+		t.Errorf("Expected 8 panics counted, but got %d", n)
+	}
+	if n := dlq.Size(); n != 8 {
+		t.Errorf("Expected 8 items in the dead letter queue, but got %d", n)
+	}
+	awaitGoroutines(t, before)
+}
+
+// Test that a worker whose handler panicked keeps serving, so the pool does
+// not lose concurrency
+func TestRunWorkersPanicKeepsConcurrency(t *testing.T) {
+	q := NewThreadSafeQueue()
+	for i := 0; i < 4; i++ {
+		q.Enqueue(-1) // Enough panics to take every worker down.
+	}
+	for i := 0; i < 4; i++ {
+		q.Enqueue(i)
+	}
+	q.Close()
+	var mu sync.Mutex
+	arrived := 0
+	all := make(chan struct{})
+	q.RunWorkers(context.Background(), 4, func(ctx context.Context, item interface{}) error {
+		if item == -1 {
+			panic("boom")
+		}
+		mu.Lock()
+		if arrived++; arrived == 4 {
+			close(all)
+		}
+		mu.Unlock()
+		select {
+		case <-all: // Needs all four workers at once.
+		case <-time.After(5 * time.Second):
+			t.Error("Expected four workers to be running after the panics")
+		}
+		return nil
+	}, WithWorkerErrorHandler(func(item interface{}, err error) {}))
+}
+
+// Test that a handler stuck past WithHandlerTimeout is reported and
+// abandoned, and that a replacement keeps the pool at full concurrency
+func TestRunWorkersHandlerTimeout(t *testing.T) {
+	q, dlq := NewThreadSafeQueue(), NewThreadSafeQueue()
+	release := make(chan struct{})
+	var mu sync.Mutex
+	arrived := 0
+	pair := make(chan struct{})
+	var failed []interface{}
+	done := make(chan error, 1)
+	go func() {
+		done <- q.RunWorkers(context.Background(), 2, func(ctx context.Context, item interface{}) error {
+			if item == "stuck" {
+				<-release // Ignores its context.
+				return errors.New("discarded")
+			}
+			mu.Lock()
+			if arrived++; arrived == 2 {
+				close(pair)
+			}
+			mu.Unlock()
+			select {
+			case <-pair: // Needs two workers besides the stuck one.
+			case <-time.After(5 * time.Second):
+				t.Error("Expected two workers to be running besides the stuck one")
+			}
+			return nil
+		}, WithHandlerTimeout(20*time.Millisecond), WithDeadLetterQueue(dlq), WithWorkerErrorHandler(func(item interface{}, err error) {
+			mu.Lock()
+			failed = append(failed, item)
+			mu.Unlock()
+			if !errors.Is(err, ErrHandlerTimeout) {
+				t.Errorf("Expected ErrHandlerTimeout, but got %v", err)
+			}
+		}))
+	}()
+	q.Enqueue("stuck")
+	awaitCount(t, func() int { return q.Stats().AbandonedWorkers }, 1)
+	for i := 0; i < 4; i++ {
+		q.Enqueue(i)
+	}
+	q.Close()
+	if err := <-done; err != nil {
+		t.Errorf("Expected no error with a handler, but got %v", err)
+	}
+	if len(failed) != 1 || failed[0] != "stuck" {
+		t.Errorf("Expected the stuck item to time out, but got %v", failed)
+	}
+	if item, _ := dlq.TryDequeue(); item != "stuck" {
+		t.Errorf("Expected the stuck item in the dead letter queue, but got %v", item)
+	}
+	if n := q.Stats().AbandonedWorkers; n != 1 {
+		t.Errorf("Expected 1 abandoned worker, but got %d", n)
+	}
+	close(release)
+	awaitCount(t, func() int { return q.Stats().AbandonedWorkers }, 0)
+}
+
+// Test that the handler's context carries the deadline, with
+// ErrHandlerTimeout as its cause
+func TestRunWorkersHandlerTimeoutContext(t *testing.T) {
+	q := NewThreadSafeQueue()
+	q.Enqueue(1)
+	q.Close()
+	cause := make(chan error, 1)
+	err := q.RunWorkers(context.Background(), 1, func(ctx context.Context, item interface{}) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("Expected the handler's context to have a deadline")
+		}
+		<-ctx.Done()
+		cause <- context.Cause(ctx)
+		return ctx.Err()
+	}, WithHandlerTimeout(time.Millisecond))
+	if c := <-cause; c != ErrHandlerTimeout {
+		t.Errorf("Expected ErrHandlerTimeout as the cause, but got %v", c)
+	}
+	// The handler returning and the timeout race; either is reported.
+	if !errors.Is(err, ErrHandlerTimeout) && !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the timeout reported, but got %v", err)
+	}
+	awaitCount(t, func() int { return q.Stats().AbandonedWorkers }, 0)
+}
+
+// Test that WithHandlerTimeout rejects a duration that is not positive
+func TestHandlerTimeoutInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic for a zero timeout")
+		}
+	}()
+	WithHandlerTimeout(0)
+}
+
+// Test that with WithStopOnError the first failure stops the pool: no item
+// is taken after it, the ones in flight are finished, and RunWorkers
+// returns it, whether it comes at once or after the other workers moved on
+func TestRunWorkersStopOnError(t *testing.T) {
+	for _, slow := range []bool{false, true} {
+		q := NewThreadSafeQueue()
+		for i := 0; i < 1000; i++ {
+			q.Enqueue(i)
+		}
+		q.Close()
+		errFail := errors.New("fail")
+		var failed atomic.Bool
+		var handled, late, cancelled atomic.Int32
+		err := q.RunWorkers(context.Background(), 4, func(ctx context.Context, item interface{}) error {
+			if failed.Load() {
+				late.Add(1)
+			}
+			if item == 10 {
+				if slow {
+					time.Sleep(20 * time.Millisecond)
+				}
+				return errFail
+			}
+			time.Sleep(100 * time.Microsecond)
+			if ctx.Err() != nil {
+				cancelled.Add(1)
+			}
+			handled.Add(1)
+			return nil
+		}, WithStopOnError(true), WithWorkerErrorHandler(func(item interface{}, err error) {
+			failed.Store(true) // Called after the pool stopped taking items.
+		}))
+		if err != errFail {
+			t.Errorf("Expected the first failure, but got %v (slow %v)", err, slow)
+		}
+		if n := late.Load(); n != 0 {
+			t.Errorf("Expected no item taken after the failure, but got %d (slow %v)", n, slow)
+		}
+		if n := cancelled.Load(); n != 0 {
+			t.Errorf("Expected the items in flight to keep their context, but %d were cancelled (slow %v)", n, slow)
+		}
+		s := q.Stats()
+		if s.Dequeued != uint64(handled.Load())+1 {
+			t.Errorf("Expected every item taken to be finished, but %d were taken and %d handled (slow %v)", s.Dequeued, handled.Load(), slow)
+		}
+		if s.Size == 0 {
+			t.Errorf("Expected items left in the queue (slow %v)", slow)
+		}
+	}
+}
+
+// Test that WithKeyFunc never runs two handlers for the same key at once,
+// keeps the order of each key, and still runs different keys in parallel
+func TestRunWorkersKeyFunc(t *testing.T) {
+	q := NewThreadSafeQueue()
+	for i := 0; i < 1000; i++ {
+		q.Enqueue(i)
+	}
+	q.Close()
+	var running [10]atomic.Int32
+	var last [10]int
+	for k := range last {
+		last[k] = -1
+	}
+	var inFlight, maxInFlight atomic.Int32
+	var handled atomic.Int32
+	err := q.RunWorkers(context.Background(), 8, func(ctx context.Context, item interface{}) error {
+		i := item.(int)
+		k := i % 10
+		if running[k].Add(1) != 1 {
+			t.Errorf("Expected one handler at a time for key %d, but item %d overlapped", k, i)
+		}
+		defer running[k].Add(-1)
+		if n := inFlight.Add(1); n > maxInFlight.Load() {
+			maxInFlight.Store(n)
+		}
+		defer inFlight.Add(-1)
+		if i < last[k] {
+			t.Errorf("Expected key %d in order, but got %d after %d", k, i, last[k])
+		}
+		last[k] = i
+		time.Sleep(50 * time.Microsecond) // Lets the other workers run.
+		handled.Add(1)
+		return nil
+	}, WithKeyFunc(func(item interface{}) string {
+		return strconv.Itoa(item.(int) % 10)
+	}))
+	if err != nil {
+		t.Errorf("Expected no error, but got %v", err)
+	}
+	if n := handled.Load(); n != 1000 {
+		t.Errorf("Expected 1000 items handled, but got %d", n)
+	}
+	if n := maxInFlight.Load(); n < 2 {
+		t.Errorf("Expected different keys to run in parallel, but at most %d ran at once", n)
+	}
+}
+
+// Test that a retried item succeeds without being reported, while workers
+// go on with other items during its backoff
+func TestRunWorkersRetry(t *testing.T) {
+	q := NewThreadSafeQueue()
+	q.EnqueueBatch("flaky", 1, 2, 3)
+	q.Close()
+	var mu sync.Mutex
+	var order []interface{}
+	err := q.RunWorkers(context.Background(), 1, func(ctx context.Context, item interface{}) error {
+		d, ok := DeliveryFromContext(ctx)
+		if !ok {
+			t.Error("Expected a Delivery in the handler's context")
+		}
+		mu.Lock()
+		order = append(order, item)
+		mu.Unlock()
+		if item == "flaky" && d.Attempt < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	}, WithRetry(3, 20*time.Millisecond, time.Second, false))
+	if err != nil {
+		t.Errorf("Expected the retries to succeed, but got %v", err)
+	}
+	want := []interface{}{"flaky", 1, 2, 3, "flaky", "flaky"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("Expected the other items during the backoff %v, but got %v", want, order)
+	}
+	if _, ok := DeliveryFromContext(context.Background()); ok {
+		t.Error("Expected no Delivery outside a handler")
+	}
+}
+
+// Test that retries still waiting when the pool is cancelled are reported
+// with their last error
+func TestRunWorkersRetryCancel(t *testing.T) {
+	q := NewThreadSafeQueue()
+	q.Enqueue(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	errFail := errors.New("fail")
+	called := make(chan struct{}, 1)
+	result := make(chan error, 1)
+	go func() {
+		result <- q.RunWorkers(ctx, 2, func(ctx context.Context, item interface{}) error {
+			called <- struct{}{}
+			return errFail
+		}, WithRetry(5, time.Hour, time.Hour, false))
+	}()
+	<-called
+	cancel()
+	if err := <-result; !errors.Is(err, errFail) {
+		t.Errorf("Expected the waiting retry reported, but got %v", err)
+	}
+}
+
+// Test that WithRetry rejects inconsistent arguments
+func TestRetryInvalid(t *testing.T) {
+	for _, c := range []struct {
+		attempts  int
+		base, max time.Duration
+	}{{0, 1, 1}, {1, 0, 1}, {1, 2, 1}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected a panic for %+v", c)
+				}
+			}()
+			WithRetry(c.attempts, c.base, c.max, false)
+		}()
+	}
+}
@@ -0,0 +1,67 @@
+package threadsafequeue
+
+import "sync"
+
+// WorkStealingDeque is a double-ended work list for task schedulers. A single
+// owner goroutine pushes and pops tasks at the bottom in LIFO order, which
+// keeps recently created (and usually cache-hot) work local, while any number
+// of thief goroutines steal from the top in FIFO order, taking the oldest
+// work first.
+//
+// The owner-side methods (PushLocal, PopLocal) must only be called by the
+// owning goroutine; Steal may be called from any goroutine. This version
+// guards the storage with a mutex, but callers should rely only on the
+// owner/thief split so that the implementation can move to a lock-free
+// algorithm without changing the API.
+//
+// None of the operations block: PopLocal and Steal report false when the
+// deque is empty.
+type WorkStealingDeque struct {
+	tasks ring[interface{}] // Tasks; the owner's end is the back, thieves take from the front.
+	mu    sync.Mutex        // Mutex to protect concurrent access to the tasks.
+}
+
+// NewWorkStealingDeque initializes and returns an empty WorkStealingDeque.
+func NewWorkStealingDeque() *WorkStealingDeque {
+	return &WorkStealingDeque{}
+}
+
+// PushLocal adds a task at the owner's end of the deque.
+// It must only be called by the owning goroutine.
+func (d *WorkStealingDeque) PushLocal(task interface{}) {
+	d.mu.Lock()
+	d.tasks.pushBack(task)
+	d.mu.Unlock()
+}
+
+// PopLocal removes and returns the most recently pushed task.
+// The boolean value is false if the deque is empty.
+// It must only be called by the owning goroutine.
+func (d *WorkStealingDeque) PopLocal() (interface{}, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.tasks.popBack()
+}
+
+// Steal removes and returns the oldest task from the opposite end to the
+// owner. The boolean value is false if the deque is empty.
+// It is safe to call from any goroutine.
+func (d *WorkStealingDeque) Steal() (interface{}, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.tasks.popFront()
+}
+
+// Size returns the number of tasks currently in the deque.
+// It is safe to call from any goroutine.
+func (d *WorkStealingDeque) Size() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.tasks.len()
+}
+
+// IsEmpty returns true if the deque has no tasks, and false otherwise.
+// It is safe to call from any goroutine.
+func (d *WorkStealingDeque) IsEmpty() bool {
+	return d.Size() == 0
+}
@@ -0,0 +1,115 @@
+package threadsafequeue
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// Test that the owner pops in LIFO order and thieves steal in FIFO order
+func TestWorkStealingDequeOrdering(t *testing.T) {
+	d := NewWorkStealingDeque()
+	for i := 0; i < 5; i++ {
+		d.PushLocal(i)
+	}
+
+	if item, ok := d.Steal(); !ok || item != 0 {
+		t.Errorf("Expected to steal 0, got %v", item)
+	}
+	if item, ok := d.PopLocal(); !ok || item != 4 {
+		t.Errorf("Expected to pop 4, got %v", item)
+	}
+	if d.Size() != 3 {
+		t.Errorf("Expected size to be 3, got %d", d.Size())
+	}
+}
+
+// Test that an empty deque reports failure on both ends
+func TestWorkStealingDequeEmpty(t *testing.T) {
+	d := NewWorkStealingDeque()
+	if _, ok := d.PopLocal(); ok {
+		t.Error("PopLocal on an empty deque should fail")
+	}
+	if _, ok := d.Steal(); ok {
+		t.Error("Steal on an empty deque should fail")
+	}
+	if !d.IsEmpty() {
+		t.Error("New deque should be empty")
+	}
+}
+
+// Test that the deque grows past its initial size while wrapped around
+func TestWorkStealingDequeGrow(t *testing.T) {
+	d := NewWorkStealingDeque()
+	for i := 0; i < minRingSize/2; i++ {
+		d.PushLocal(i)
+	}
+	for i := 0; i < minRingSize/2; i++ {
+		d.Steal()
+	}
+
+	const count = minRingSize * 4
+	for i := 0; i < count; i++ {
+		d.PushLocal(i)
+	}
+	for i := 0; i < count; i++ {
+		item, ok := d.Steal()
+		if !ok || item != i {
+			t.Errorf("Expected to steal %d, got %v", i, item)
+		}
+	}
+}
+
+// Test that every task is executed exactly once by one owner and 8 thieves
+func TestWorkStealingDequeStress(t *testing.T) {
+	d := NewWorkStealingDeque()
+	const count = 100000
+	const thieves = 8
+	seen := make([]int32, count)
+	var processed int64
+	var wg sync.WaitGroup
+
+	run := func(task interface{}) {
+		atomic.AddInt32(&seen[task.(int)], 1)
+		atomic.AddInt64(&processed, 1)
+	}
+
+	for i := 0; i < thieves; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for atomic.LoadInt64(&processed) < count {
+				if task, ok := d.Steal(); ok {
+					run(task)
+				} else {
+					runtime.Gosched()
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < count; i++ {
+		d.PushLocal(i)
+		if i%3 == 0 {
+			if task, ok := d.PopLocal(); ok {
+				run(task)
+			}
+		}
+	}
+	for {
+		task, ok := d.PopLocal()
+		if !ok {
+			break
+		}
+		run(task)
+	}
+
+	wg.Wait()
+
+	for i, n := range seen {
+		if n != 1 {
+			t.Fatalf("Task %d was executed %d times", i, n)
+		}
+	}
+}